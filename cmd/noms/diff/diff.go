@@ -5,9 +5,12 @@
 package diff
 
 import (
+	"context"
+	"fmt"
 	"io"
 
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/stormasm/noms/go/util/writers"
 	humanize "github.com/dustin/go-humanize"
 )
@@ -29,6 +32,7 @@ type (
 type diffWriter struct {
 	w         io.Writer
 	leftRight bool
+	ctx       context.Context
 }
 
 func (w diffWriter) Write(p []byte) (n int, err error) {
@@ -43,15 +47,19 @@ func shouldDescend(v1, v2 types.Value) bool {
 // Diff writes the diff from |v1| to |v2| to |w|.
 // If |leftRight| is true then the left-right diff is used for ordered sequences - see Diff vs DiffLeftRight in Set and Map.
 func Diff(w io.Writer, v1, v2 types.Value, leftRight bool) error {
+	return DiffContext(context.Background(), w, v1, v2, leftRight)
+}
+
+// DiffContext is like Diff, but adds each difference it finds to the progress of |ctx| as a value, and stops, returning ctx.Err(), if |ctx| is canceled.
+func DiffContext(ctx context.Context, w io.Writer, v1, v2 types.Value, leftRight bool) error {
 	if v1.Equals(v2) {
 		return nil
 	}
 
-	dw := diffWriter{w, leftRight}
+	dw := diffWriter{w, leftRight, ctx}
 
 	if !shouldDescend(v1, v2) {
-		line(dw, DEL, nil, v1)
-		return line(dw, ADD, nil, v2)
+		return replace(dw, line, nil, v1, v2)
 	}
 
 	return diff(dw, types.Path{}, nil, v1, v2)
@@ -84,9 +92,13 @@ func diffLists(w diffWriter, p types.Path, v1, v2 types.List) (err error) {
 	wroteHdr := false
 
 	for splice := range spliceChan {
+		if err == nil {
+			err = w.ctx.Err()
+		}
 		if err != nil {
 			break
 		}
+		progress.Add(w.ctx, progress.Progress{Values: splice.SpRemoved + splice.SpAdded})
 
 		if splice.SpRemoved == splice.SpAdded {
 			// Heuristic: list only has modifications.
@@ -99,8 +111,7 @@ func diffLists(w diffWriter, p types.Path, v1, v2 types.List) (err error) {
 					err = diff(w, append(p, types.NewIndexPath(idx)), idx, lastEl, newEl)
 				} else {
 					writeHeader(w, p, &wroteHdr)
-					line(w, DEL, nil, v1.Get(splice.SpAt+i))
-					err = line(w, ADD, nil, v2.Get(splice.SpFrom+i))
+					err = replace(w, line, nil, lastEl, newEl)
 				}
 			}
 			continue
@@ -117,7 +128,9 @@ func diffLists(w diffWriter, p types.Path, v1, v2 types.List) (err error) {
 		}
 	}
 
-	err = writeFooter(w, &wroteHdr)
+	if ferr := writeFooter(w, &wroteHdr); err == nil {
+		err = ferr
+	}
 
 	if err != nil {
 		stopChan <- struct{}{}
@@ -187,9 +200,13 @@ func diffOrdered(w diffWriter, p types.Path, lf lineFunc, ppf pathPartFunc, df d
 	wroteHdr := false
 
 	for change := range changeChan {
+		if err == nil {
+			err = w.ctx.Err()
+		}
 		if err != nil {
 			break
 		}
+		progress.Add(w.ctx, progress.Progress{Values: 1})
 
 		k := kf(change.V)
 
@@ -207,8 +224,7 @@ func diffOrdered(w diffWriter, p types.Path, lf lineFunc, ppf pathPartFunc, df d
 				err = diff(w, append(p, ppf(k)), change.V, c1, c2)
 			} else {
 				writeHeader(w, p, &wroteHdr)
-				lf(w, DEL, k, c1)
-				err = lf(w, ADD, k, c2)
+				err = replace(w, lf, k, c1, c2)
 			}
 		default:
 			panic("unknown change type")
@@ -246,6 +262,39 @@ func writeFooter(w io.Writer, wroteHdr *bool) error {
 	return write(w, []byte("  }\n"))
 }
 
+// replace writes that |v1| was replaced by |v2|. If they're Blobs that share some of their chunks, it also writes how many bytes of the chunks that differ were removed and added.
+func replace(w io.Writer, lf lineFunc, key, v1, v2 types.Value) error {
+	lf(w, DEL, key, v1)
+	if err := lf(w, ADD, key, v2); err != nil {
+		return err
+	}
+	b1, ok1 := v1.(types.Blob)
+	b2, ok2 := v2.(types.Blob)
+	if !ok1 || !ok2 {
+		return nil
+	}
+
+	spliceChan := make(chan types.Splice)
+	go func() {
+		b2.Diff(b1, spliceChan, nil)
+		close(spliceChan)
+	}()
+	ranges, removed, added := 0, uint64(0), uint64(0)
+	for splice := range spliceChan {
+		ranges++
+		removed += splice.SpRemoved
+		added += splice.SpAdded
+	}
+	if removed == b1.Len() && added == b2.Len() {
+		return nil
+	}
+	noun := "ranges"
+	if ranges == 1 {
+		noun = "range"
+	}
+	return write(w, []byte(fmt.Sprintf("    %d %s of chunks changed: -%s +%s\n", ranges, noun, humanize.Bytes(removed), humanize.Bytes(added))))
+}
+
 func line(w io.Writer, op prefixOp, key, val types.Value) error {
 	genPrefix := func(w *writers.PrefixWriter) []byte {
 		return []byte(op)
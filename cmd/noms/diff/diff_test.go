@@ -6,10 +6,13 @@ package diff
 
 import (
 	"bytes"
+	"context"
+	"math/rand"
 	"strings"
 	"testing"
 
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/stormasm/noms/go/util/test"
 	"github.com/attic-labs/testify/assert"
 )
@@ -277,6 +280,28 @@ func TestNomsBlobDiff(t *testing.T) {
 	tf(false)
 }
 
+func TestNomsBlobDiffSharingChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(0)).Read(data)
+	data2 := append([]byte{}, data...)
+	copy(data2[1<<19:], "changed")
+	b1 := types.NewBlob(bytes.NewReader(data))
+	b2 := types.NewBlob(bytes.NewReader(data2))
+
+	buf := &bytes.Buffer{}
+	Diff(buf, b1, b2, false)
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal([]string{"-   Blob (1.0 MB)", "+   Blob (1.0 MB)"}, lines[:2])
+	assert.Regexp(`^    1 range of chunks changed: -\d+ kB \+\d+ kB$`, lines[2])
+
+	// The chunks are reported in the same way for Blobs in collections.
+	buf = &bytes.Buffer{}
+	Diff(buf, createList(b1), createList(b2), false)
+	assert.Contains(buf.String(), "1 range of chunks changed")
+}
+
 func TestNomsTypeDiff(t *testing.T) {
 	assert := assert.New(t)
 
@@ -319,3 +344,27 @@ func TestNomsRefDiff(t *testing.T) {
 	tf(true)
 	tf(false)
 }
+
+func TestNomsDiffContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var reported progress.Progress
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(p progress.Progress) {
+		reported = p
+	}))
+	buf := &bytes.Buffer{}
+	assert.NoError(DiffContext(ctx, buf, mm3, mm3x, false))
+	assert.Contains(buf.String(), `+   "a1": "a-one-diff"`)
+	// m3 and m4 changed, and a1 in m4.
+	assert.Equal(progress.Progress{Values: 3}, reported)
+
+	// Once the context is canceled, diffs stop.
+	cancel()
+	for _, vs := range [][2]types.Value{{mm3, mm3x}, {createList(1, 2, 3), createList(1, 4, 3)}} {
+		buf = &bytes.Buffer{}
+		assert.Equal(context.Canceled, DiffContext(ctx, buf, vs[0], vs[1], false))
+		assert.Empty(buf.String())
+	}
+	assert.Equal(progress.Progress{Values: 3}, reported)
+}
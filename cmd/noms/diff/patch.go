@@ -0,0 +1,576 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/marshal"
+	"github.com/stormasm/noms/go/types"
+)
+
+// PatchOpKind is what a PatchOp does.
+type PatchOpKind string
+
+const (
+	// PatchSet sets the value at Path to Value, adding it if it isn't there. If Path is empty, Value replaces the whole value. If Path indexes a Set, Value is inserted into it.
+	PatchSet PatchOpKind = "set"
+	// PatchRemove removes the struct field, Map entry or Set element at Path.
+	PatchRemove PatchOpKind = "remove"
+	// PatchSplice removes Remove elements of the List at Path starting at index At, and inserts Values in their place.
+	PatchSplice PatchOpKind = "splice"
+)
+
+// PatchOp is a single change to a value, at a Path relative to the value.
+type PatchOp struct {
+	Kind PatchOpKind
+	Path types.Path
+	// Key is the key to set or remove, when Path ends in a Map key which is spelled by its hash.
+	Key   types.Value
+	Value types.Value
+	// Old is the value at Path that a PatchSet replaces or a PatchRemove removes, or nil if a PatchSet adds it. Removed are the elements a PatchSplice removes. They're what Invert undoes the PatchOp with.
+	Old     types.Value
+	At      uint64
+	Remove  uint64
+	Values  []types.Value
+	Removed []types.Value
+}
+
+// Patch is a sequence of PatchOps, which turns one value into another when applied in order. Patches are concatenated with Compose, and undone with Invert, so a Patch can be kept for each change to a value, as on an undo stack, and replayed on another copy of the value. NewPatchList and ReadPatchList store them as Noms values.
+type Patch []PatchOp
+
+// MakePatch returns the Patch which turns |v1| into |v2|. Like Diff, it descends into Lists, Maps, Sets and Structs, so that each PatchOp is as deep as the values differ. The indices in PatchSplice operations take the operations before them into account.
+func MakePatch(v1, v2 types.Value) Patch {
+	p := Patch{}
+	p.diff(types.Path{}, v1, v2)
+	return p
+}
+
+// appendPath returns a copy of |p| with |part| appended, so that PatchOps never share the backing array of their Paths.
+func appendPath(p types.Path, part types.PathPart) types.Path {
+	res := make(types.Path, len(p), len(p)+1)
+	copy(res, p)
+	return append(res, part)
+}
+
+// keyPathPart returns the PathPart that addresses |k| in a Map or Set, and |k| itself if the PathPart can't spell it.
+func keyPathPart(k types.Value) (types.PathPart, types.Value) {
+	switch k.Type().Kind() {
+	case types.BoolKind, types.NumberKind, types.StringKind:
+		return types.NewIndexPath(k), nil
+	}
+	return types.NewHashIndexPath(k.Hash()), k
+}
+
+func (p *Patch) diff(path types.Path, v1, v2 types.Value) {
+	if v1.Equals(v2) {
+		return
+	}
+	if !shouldDescend(v1, v2) || (v1.Type().Kind() == types.StructKind && v1.(types.Struct).Type().Desc.(types.StructDesc).Name != v2.(types.Struct).Type().Desc.(types.StructDesc).Name) {
+		// Structs with different names are replaced whole, since applying changes field by field would keep the old name.
+		*p = append(*p, PatchOp{Kind: PatchSet, Path: path, Value: v2, Old: v1})
+		return
+	}
+	switch v1 := v1.(type) {
+	case types.List:
+		p.diffLists(path, v1, v2.(types.List))
+	case types.Map:
+		p.diffMaps(path, v1, v2.(types.Map))
+	case types.Set:
+		p.diffSets(path, v1, v2.(types.Set))
+	case types.Struct:
+		p.diffStructs(path, v1, v2.(types.Struct))
+	}
+}
+
+func (p *Patch) diffLists(path types.Path, l1, l2 types.List) {
+	spliceChan := make(chan types.Splice)
+	go func() {
+		l2.Diff(l1, spliceChan, nil)
+		close(spliceChan)
+	}()
+
+	// offset is how much the splices so far have moved the rest of the list along.
+	offset := int64(0)
+	for splice := range spliceChan {
+		at := uint64(int64(splice.SpAt) + offset)
+		if splice.SpRemoved == splice.SpAdded {
+			for i := uint64(0); i < splice.SpRemoved; i++ {
+				p.diff(appendPath(path, types.NewIndexPath(types.Number(at+i))), l1.Get(splice.SpAt+i), l2.Get(splice.SpFrom+i))
+			}
+			continue
+		}
+		values := make([]types.Value, splice.SpAdded)
+		for i := range values {
+			values[i] = l2.Get(splice.SpFrom + uint64(i))
+		}
+		removed := make([]types.Value, splice.SpRemoved)
+		for i := range removed {
+			removed[i] = l1.Get(splice.SpAt + uint64(i))
+		}
+		*p = append(*p, PatchOp{Kind: PatchSplice, Path: path, At: at, Remove: splice.SpRemoved, Values: values, Removed: removed})
+		offset += int64(splice.SpAdded) - int64(splice.SpRemoved)
+	}
+}
+
+func (p *Patch) diffMaps(path types.Path, m1, m2 types.Map) {
+	changes := make(chan types.ValueChanged)
+	go func() {
+		m2.Diff(m1, changes, nil)
+		close(changes)
+	}()
+
+	for change := range changes {
+		part, key := keyPathPart(change.V)
+		kp := appendPath(path, part)
+		switch change.ChangeType {
+		case types.DiffChangeAdded:
+			*p = append(*p, PatchOp{Kind: PatchSet, Path: kp, Key: key, Value: m2.Get(change.V)})
+		case types.DiffChangeRemoved:
+			*p = append(*p, PatchOp{Kind: PatchRemove, Path: kp, Key: key, Old: m1.Get(change.V)})
+		case types.DiffChangeModified:
+			p.diff(kp, m1.Get(change.V), m2.Get(change.V))
+		}
+	}
+}
+
+func (p *Patch) diffSets(path types.Path, s1, s2 types.Set) {
+	changes := make(chan types.ValueChanged)
+	go func() {
+		s2.Diff(s1, changes, nil)
+		close(changes)
+	}()
+
+	for change := range changes {
+		part, _ := keyPathPart(change.V)
+		vp := appendPath(path, part)
+		switch change.ChangeType {
+		case types.DiffChangeAdded:
+			*p = append(*p, PatchOp{Kind: PatchSet, Path: vp, Value: change.V})
+		case types.DiffChangeRemoved:
+			*p = append(*p, PatchOp{Kind: PatchRemove, Path: vp, Old: change.V})
+		}
+	}
+}
+
+func (p *Patch) diffStructs(path types.Path, s1, s2 types.Struct) {
+	changes := make(chan types.ValueChanged)
+	go func() {
+		s2.Diff(s1, changes, nil)
+		close(changes)
+	}()
+
+	for change := range changes {
+		name := string(change.V.(types.String))
+		fp := appendPath(path, types.NewFieldPath(name))
+		switch change.ChangeType {
+		case types.DiffChangeAdded:
+			*p = append(*p, PatchOp{Kind: PatchSet, Path: fp, Value: s2.Get(name)})
+		case types.DiffChangeRemoved:
+			*p = append(*p, PatchOp{Kind: PatchRemove, Path: fp, Old: s1.Get(name)})
+		case types.DiffChangeModified:
+			p.diff(fp, s1.Get(name), s2.Get(name))
+		}
+	}
+}
+
+// Apply returns the result of applying the operations in p to |v|, in order. It fails if an operation's Path doesn't lead anywhere in the value it's applied to, or leads to a value of the wrong kind.
+func (p Patch) Apply(v types.Value) (types.Value, error) {
+	var err error
+	for _, op := range p {
+		if v, err = op.apply(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Invert returns the Patch which undoes p, so that applying it to the result of applying p gives back the value p was applied to. It's p's PatchOps undone in reverse order, each setting back the Old value, or the Removed elements, of the PatchOp it undoes. It fails if a PatchOp doesn't have those, as when it was made by hand, or read from a patch written without them.
+func (p Patch) Invert() (Patch, error) {
+	inv := make(Patch, len(p))
+	for i, op := range p {
+		invOp := PatchOp{Path: op.Path, Key: op.Key}
+		switch op.Kind {
+		case PatchSet:
+			if op.Old == nil && len(op.Path) == 0 {
+				return nil, fmt.Errorf("can't invert setting the root without the old value")
+			}
+			if op.Old == nil {
+				invOp.Kind, invOp.Old = PatchRemove, op.Value
+			} else {
+				invOp.Kind, invOp.Value, invOp.Old = PatchSet, op.Old, op.Value
+			}
+		case PatchRemove:
+			if op.Old == nil {
+				return nil, fmt.Errorf("%s: can't invert removing a value without the old value", pathString(op.Path))
+			}
+			invOp.Kind, invOp.Value = PatchSet, op.Old
+		case PatchSplice:
+			if uint64(len(op.Removed)) != op.Remove {
+				return nil, fmt.Errorf("%s: can't invert removing %d elements at %d without the old elements", pathString(op.Path), op.Remove, op.At)
+			}
+			invOp.Kind, invOp.At, invOp.Remove = PatchSplice, op.At, uint64(len(op.Values))
+			invOp.Values, invOp.Removed = op.Removed, op.Values
+		default:
+			return nil, fmt.Errorf("%s: can't invert unknown operation %q", pathString(op.Path), op.Kind)
+		}
+		inv[len(p)-1-i] = invOp
+	}
+	return inv, nil
+}
+
+// Compose returns the Patch which does what p does and then what |other| does, so that applying it is the same as applying p and then |other|. Inverting it gives the inverse of |other| composed with that of p.
+func (p Patch) Compose(other Patch) Patch {
+	res := make(Patch, 0, len(p)+len(other))
+	return append(append(res, p...), other...)
+}
+
+func (op PatchOp) apply(v types.Value) (types.Value, error) {
+	var err error
+	if op.Kind == PatchSplice {
+		v, err = update(v, op.Path, func(v types.Value) (types.Value, error) {
+			l, ok := v.(types.List)
+			if !ok {
+				return nil, fmt.Errorf("can't splice a %s", v.Type().Describe())
+			}
+			if op.At+op.Remove > l.Len() {
+				return nil, fmt.Errorf("can't remove %d elements at %d from a list of %d", op.Remove, op.At, l.Len())
+			}
+			return l.Splice(op.At, op.Remove, op.Values...), nil
+		})
+	} else if len(op.Path) == 0 {
+		if op.Kind != PatchSet {
+			return nil, fmt.Errorf("can't %s the root", op.Kind)
+		}
+		v = op.Value
+	} else {
+		last := op.Path[len(op.Path)-1]
+		v, err = update(v, op.Path[:len(op.Path)-1], func(parent types.Value) (types.Value, error) {
+			switch parent := parent.(type) {
+			case types.Struct:
+				if fp, ok := last.(types.FieldPath); ok {
+					if op.Kind == PatchSet {
+						return setField(parent, fp.Name, op.Value), nil
+					}
+					return removeField(parent, fp.Name), nil
+				}
+			case types.List:
+				if ip, ok := last.(types.IndexPath); ok && op.Kind == PatchSet {
+					if idx, ok := listIndex(ip, parent); ok {
+						return parent.Set(idx, op.Value), nil
+					}
+				}
+			case types.Map:
+				key := op.Key
+				if key == nil {
+					key = mapKey(parent, last)
+				}
+				if key != nil && op.Kind == PatchSet {
+					return parent.Set(key, op.Value), nil
+				}
+				if key != nil && parent.Has(key) {
+					return parent.Remove(key), nil
+				}
+			case types.Set:
+				if op.Kind == PatchSet {
+					return parent.Insert(op.Value), nil
+				}
+				if elem := last.Resolve(parent); elem != nil {
+					return parent.Remove(elem), nil
+				}
+			}
+			return nil, fmt.Errorf("can't %s %s in a %s", op.Kind, last, parent.Type().Describe())
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathString(op.Path), err)
+	}
+	return v, nil
+}
+
+func pathString(p types.Path) string {
+	if len(p) == 0 {
+		return "(root)"
+	}
+	return p.String()
+}
+
+// update returns |v| with the value at |p| replaced by the result of |f|.
+func update(v types.Value, p types.Path, f func(v types.Value) (types.Value, error)) (types.Value, error) {
+	if len(p) == 0 {
+		return f(v)
+	}
+	child := p[0].Resolve(v)
+	if child == nil {
+		return nil, fmt.Errorf("%s not found", p[0])
+	}
+	child, err := update(child, p[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case types.Struct:
+		return setField(v, p[0].(types.FieldPath).Name, child), nil
+	case types.List:
+		idx, _ := listIndex(p[0].(types.IndexPath), v)
+		return v.Set(idx, child), nil
+	case types.Map:
+		return v.Set(mapKey(v, p[0]), child), nil
+	}
+	return nil, fmt.Errorf("can't change the elements of a %s", v.Type().Describe())
+}
+
+func listIndex(ip types.IndexPath, l types.List) (uint64, bool) {
+	n, ok := ip.Index.(types.Number)
+	if !ok || n < 0 || uint64(n) >= l.Len() {
+		return 0, false
+	}
+	return uint64(n), true
+}
+
+// mapKey returns the key which |part| addresses in |m|. Keys spelled by hash are looked up, and are nil if |m| doesn't have them.
+func mapKey(m types.Map, part types.PathPart) types.Value {
+	switch part := part.(type) {
+	case types.IndexPath:
+		return part.Index
+	case types.HashIndexPath:
+		return types.NewHashIndexIntoKeyPath(part.Hash).Resolve(m)
+	}
+	return nil
+}
+
+// setField returns |s| with the field |name| set to |v|. Unlike Struct.Set, the struct's type is made anew from its fields' values, so that it's what it would have been had the struct been made with them, rather than keeping a field type that's wider than the new value's, as a patch from a value with a wider type would otherwise leave behind.
+func setField(s types.Struct, name string, v types.Value) types.Struct {
+	desc := s.Type().Desc.(types.StructDesc)
+	data := types.StructData{name: v}
+	desc.IterFields(func(n string, t *types.Type) {
+		if n != name {
+			data[n] = s.Get(n)
+		}
+	})
+	return types.NewStruct(desc.Name, data)
+}
+
+func removeField(s types.Struct, name string) types.Struct {
+	desc := s.Type().Desc.(types.StructDesc)
+	data := types.StructData{}
+	desc.IterFields(func(n string, t *types.Type) {
+		if n != name {
+			data[n] = s.Get(n)
+		}
+	})
+	return types.NewStruct(desc.Name, data)
+}
+
+// The JSON encoding of a Patch. Values are encoded the way Noms stores them, in base64, and the chunks that the values refer to, and that the chunks refer to in turn, are included in Chunks, each after all the chunks it refers to. Show is a description of the value, for humans reviewing the patch.
+type (
+	jsonPatch struct {
+		Ops    []jsonPatchOp `json:"ops"`
+		Chunks []string      `json:"chunks,omitempty"`
+	}
+	jsonPatchOp struct {
+		Op      PatchOpKind  `json:"op"`
+		Path    string       `json:"path"`
+		Key     *jsonValue   `json:"key,omitempty"`
+		Value   *jsonValue   `json:"value,omitempty"`
+		Old     *jsonValue   `json:"old,omitempty"`
+		At      uint64       `json:"at,omitempty"`
+		Remove  uint64       `json:"remove,omitempty"`
+		Values  []*jsonValue `json:"values,omitempty"`
+		Removed []*jsonValue `json:"removed,omitempty"`
+	}
+	jsonValue struct {
+		Show string `json:"show"`
+		Data string `json:"data"`
+	}
+)
+
+// WritePatch writes p to |w| as JSON, along with every chunk that the values in it refer to, which it reads from |vr|.
+func WritePatch(w io.Writer, p Patch, vr types.ValueReader) error {
+	visited := hash.HashSet{}
+	jp := jsonPatch{Ops: []jsonPatchOp{}}
+
+	var addChunks func(v types.Value)
+	addChunks = func(v types.Value) {
+		v.WalkRefs(func(r types.Ref) {
+			h := r.TargetHash()
+			if visited.Has(h) {
+				return
+			}
+			visited.Insert(h)
+			target := vr.ReadValue(h)
+			if target == nil {
+				panic(fmt.Errorf("missing chunk %s", h))
+			}
+			addChunks(target)
+			jp.Chunks = append(jp.Chunks, base64.StdEncoding.EncodeToString(types.EncodeValue(target, nil).Data()))
+		})
+	}
+	encode := func(v types.Value) *jsonValue {
+		if v == nil {
+			return nil
+		}
+		addChunks(v)
+		show := &bytes.Buffer{}
+		writeEncodedValue(show, v)
+		return &jsonValue{show.String(), base64.StdEncoding.EncodeToString(types.EncodeValue(v, nil).Data())}
+	}
+
+	for _, op := range p {
+		jop := jsonPatchOp{Op: op.Kind, Path: op.Path.String(), Key: encode(op.Key), Value: encode(op.Value), Old: encode(op.Old), At: op.At, Remove: op.Remove}
+		for _, v := range op.Values {
+			jop.Values = append(jop.Values, encode(v))
+		}
+		for _, v := range op.Removed {
+			jop.Removed = append(jop.Removed, encode(v))
+		}
+		jp.Ops = append(jp.Ops, jop)
+	}
+	data, err := json.MarshalIndent(jp, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// ReadPatch reads a Patch written by WritePatch from |r|, writing the chunks that come with it to |vrw|.
+func ReadPatch(r io.Reader, vrw types.ValueReadWriter) (Patch, error) {
+	jp := jsonPatch{}
+	if err := json.NewDecoder(r).Decode(&jp); err != nil {
+		return nil, fmt.Errorf("Invalid patch: %s", err)
+	}
+
+	decode := func(s string) (types.Value, error) {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("Invalid patch: bad value %q", s)
+		}
+		return types.DecodeValue(chunks.NewChunk(data), vrw), nil
+	}
+	for _, s := range jp.Chunks {
+		v, err := decode(s)
+		if err != nil {
+			return nil, err
+		}
+		vrw.WriteValue(v)
+	}
+	decodeValue := func(jv *jsonValue) (types.Value, error) {
+		if jv == nil {
+			return nil, nil
+		}
+		return decode(jv.Data)
+	}
+
+	p := Patch{}
+	for _, jop := range jp.Ops {
+		path := types.Path{}
+		if jop.Path != "" {
+			var err error
+			if path, err = types.ParsePath(jop.Path); err != nil {
+				return nil, fmt.Errorf("Invalid patch: %s", err)
+			}
+		}
+		op := PatchOp{Kind: jop.Op, Path: path, At: jop.At, Remove: jop.Remove}
+		var err error
+		if op.Key, err = decodeValue(jop.Key); err != nil {
+			return nil, err
+		}
+		if op.Value, err = decodeValue(jop.Value); err != nil {
+			return nil, err
+		}
+		if op.Old, err = decodeValue(jop.Old); err != nil {
+			return nil, err
+		}
+		for _, jv := range jop.Values {
+			v, err := decodeValue(jv)
+			if err != nil {
+				return nil, err
+			}
+			op.Values = append(op.Values, v)
+		}
+		for _, jv := range jop.Removed {
+			v, err := decodeValue(jv)
+			if err != nil {
+				return nil, err
+			}
+			op.Removed = append(op.Removed, v)
+		}
+		if err := checkPatchOp(op); err != nil {
+			return nil, fmt.Errorf("Invalid patch: %s", err)
+		}
+		p = append(p, op)
+	}
+	return p, nil
+}
+
+func checkPatchOp(op PatchOp) error {
+	switch {
+	case op.Kind == PatchSet && op.Value == nil:
+		return fmt.Errorf("set of %s has no value", op.Path)
+	case op.Kind != PatchSet && op.Kind != PatchRemove && op.Kind != PatchSplice:
+		return fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return nil
+}
+
+// patchOp is how a PatchOp is stored in Noms, as a struct named PatchOp. Its Path is a types.Path, and the values it doesn't have are left out.
+type patchOp struct {
+	Op      string
+	Path    string
+	Key     types.Value   `noms:",omitempty"`
+	Value   types.Value   `noms:",omitempty"`
+	Old     types.Value   `noms:",omitempty"`
+	At      uint64        `noms:",omitempty"`
+	Remove  uint64        `noms:",omitempty"`
+	Values  []types.Value `noms:",omitempty"`
+	Removed []types.Value `noms:",omitempty"`
+}
+
+// NewPatchList returns p as a Noms List of structs, one for each PatchOp, so that it can be committed alongside the values it changes, as for an undo stack kept in a dataset. Unlike WritePatch, it doesn't copy the chunks the values in p refer to, which are expected to be in the same database. ReadPatchList reads it back.
+func NewPatchList(p Patch) types.List {
+	values := make([]types.Value, len(p))
+	for i, op := range p {
+		v, err := marshal.Marshal(patchOp{string(op.Kind), op.Path.String(), op.Key, op.Value, op.Old, op.At, op.Remove, op.Values, op.Removed})
+		if err != nil {
+			panic(err)
+		}
+		values[i] = v
+	}
+	return types.NewList(values...)
+}
+
+// ReadPatchList returns the Patch described by |l|, a List made by NewPatchList.
+func ReadPatchList(l types.List) (p Patch, err error) {
+	p = Patch{}
+	l.Iter(func(v types.Value, i uint64) bool {
+		var pop patchOp
+		if err = marshal.Unmarshal(v, &pop); err != nil {
+			return true
+		}
+		op := PatchOp{Kind: PatchOpKind(pop.Op), Path: types.Path{}, Key: pop.Key, Value: pop.Value, Old: pop.Old, At: pop.At, Remove: pop.Remove, Values: pop.Values, Removed: pop.Removed}
+		if pop.Path != "" {
+			if op.Path, err = types.ParsePath(pop.Path); err != nil {
+				return true
+			}
+		}
+		if err = checkPatchOp(op); err != nil {
+			err = fmt.Errorf("Invalid patch operation %d: %s", i, err)
+			return true
+		}
+		p = append(p, op)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
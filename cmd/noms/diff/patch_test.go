@@ -0,0 +1,182 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestPatchRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	structKey := types.NewStruct("Key", types.StructData{"id": types.Number(1)})
+	pairs := [][2]types.Value{
+		{types.Number(1), types.String("one")},
+		{types.Number(1), types.Number(2)},
+		{types.NewStruct("A", types.StructData{"x": types.Number(1)}), types.NewStruct("B", types.StructData{"x": types.Number(1)})},
+		{
+			types.NewStruct("S", types.StructData{"gone": types.Bool(true), "same": types.Number(1), "deep": aa1}),
+			types.NewStruct("S", types.StructData{"new": types.Bool(true), "same": types.Number(1), "deep": aa1x}),
+		},
+		{mm1, mm2},
+		{mm3, mm3x},
+		{createSet("a", "b", 3), createSet("b", 3, 4, structKey)},
+		{createList(0, 1, 2, 3, 4, 5), createList(0, 2, 3, "x", "y", 4, 5, 6)},
+		{createList(mm3, 1, 2), createList(mm3x, 1, 2)},
+		{types.NewMap(structKey, types.Number(1)), types.NewMap(structKey, types.Number(2), types.Number(3), structKey)},
+		{types.NewMap(structKey, types.Number(1), types.Number(3), types.Number(4)), types.NewMap()},
+	}
+	for _, p := range pairs {
+		patch := MakePatch(p[0], p[1])
+		applied, err := patch.Apply(p[0])
+		assert.NoError(err)
+		assert.True(p[1].Equals(applied), "%s != %s", types.EncodedValue(p[1]), types.EncodedValue(applied))
+
+		inverse, err := patch.Invert()
+		assert.NoError(err)
+		undone, err := inverse.Apply(applied)
+		assert.NoError(err)
+		assert.True(p[0].Equals(undone), "%s != %s", types.EncodedValue(p[0]), types.EncodedValue(undone))
+		assert.Equal(patch, mustInvert(t, inverse))
+	}
+	assert.Empty(MakePatch(mm1, mm1))
+}
+
+func mustInvert(t *testing.T, p Patch) Patch {
+	inverse, err := p.Invert()
+	assert.NoError(t, err)
+	return inverse
+}
+
+func TestPatchInvertErrors(t *testing.T) {
+	assert := assert.New(t)
+	path, err := types.ParsePath(".a")
+	assert.NoError(err)
+
+	_, err = Patch{{Kind: PatchSet, Path: types.Path{}, Value: types.Number(1)}}.Invert()
+	assert.EqualError(err, "can't invert setting the root without the old value")
+	_, err = Patch{{Kind: PatchRemove, Path: path}}.Invert()
+	assert.EqualError(err, ".a: can't invert removing a value without the old value")
+	_, err = Patch{{Kind: PatchSplice, Path: path, At: 1, Remove: 2}}.Invert()
+	assert.EqualError(err, ".a: can't invert removing 2 elements at 1 without the old elements")
+
+	// Adding a value is undone by removing it, without needing an old value.
+	assert.Equal(Patch{{Kind: PatchRemove, Path: path, Old: types.Number(1)}}, mustInvert(t, Patch{{Kind: PatchSet, Path: path, Value: types.Number(1)}}))
+}
+
+func TestPatchCompose(t *testing.T) {
+	assert := assert.New(t)
+	v1 := createStruct("S", "a", 1, "l", createList(1, 2, 3), "m", createMap("x", 1))
+	v2 := createStruct("S", "a", 2, "l", createList(1, 3), "m", createMap("x", 1, "y", 2))
+	v3 := createStruct("S", "l", createList(0, 1, 3, 4), "m", createMap("y", 3))
+
+	p1, p2 := MakePatch(v1, v2), MakePatch(v2, v3)
+	composed := p1.Compose(p2)
+	assert.Len(composed, len(p1)+len(p2))
+	applied, err := composed.Apply(v1)
+	assert.NoError(err)
+	assert.True(v3.Equals(applied))
+
+	// Undoing the composed Patch undoes the second, then the first.
+	inverse := mustInvert(t, composed)
+	assert.Equal(mustInvert(t, p2).Compose(mustInvert(t, p1)), inverse)
+	undone, err := inverse.Apply(v3)
+	assert.NoError(err)
+	assert.True(v1.Equals(undone))
+
+	// Composing doesn't change either Patch.
+	assert.Equal(MakePatch(v1, v2), p1)
+	assert.Empty(Patch{}.Compose(Patch{}))
+}
+
+func TestPatchList(t *testing.T) {
+	assert := assert.New(t)
+	structKey := types.NewStruct("Key", types.StructData{"id": types.Number(1)})
+	v1 := types.NewStruct("S", types.StructData{"l": createList(0, 1, 2, 3), "m": types.NewMap(structKey, types.Number(1)), "s": createSet(1, 2)})
+	v2 := types.NewStruct("S", types.StructData{"l": createList(1, 2, "x"), "m": types.NewMap(types.Number(2), structKey), "t": types.Bool(true)})
+	patch := MakePatch(v1, v2)
+
+	l := NewPatchList(patch)
+	assert.Equal(uint64(len(patch)), l.Len())
+	read, err := ReadPatchList(l)
+	assert.NoError(err)
+	applied, err := read.Apply(v1)
+	assert.NoError(err)
+	assert.True(v2.Equals(applied))
+	undone, err := mustInvert(t, read).Apply(applied)
+	assert.NoError(err)
+	assert.True(v1.Equals(undone))
+
+	read, err = ReadPatchList(NewPatchList(Patch{{Kind: PatchSet, Path: types.Path{}, Value: types.Number(1)}}))
+	assert.NoError(err)
+	assert.Equal(Patch{{Kind: PatchSet, Path: types.Path{}, Value: types.Number(1)}}, read)
+
+	bad := types.NewList(types.NewStruct("PatchOp", types.StructData{"op": types.String("frob"), "path": types.String(".a")}))
+	_, err = ReadPatchList(bad)
+	assert.EqualError(err, `Invalid patch operation 0: unknown operation "frob"`)
+}
+
+func TestPatchOps(t *testing.T) {
+	assert := assert.New(t)
+	patch := MakePatch(createList(0, 1, 2, 3), createList(1, 2, "x", "y"))
+	assert.Equal(Patch{
+		{Kind: PatchSplice, Path: types.Path{}, At: 0, Remove: 1, Values: []types.Value{}, Removed: valsToTypesValues(0)},
+		{Kind: PatchSplice, Path: types.Path{}, At: 2, Remove: 1, Values: valsToTypesValues("x", "y"), Removed: valsToTypesValues(3)},
+	}, patch)
+
+	path, err := types.ParsePath(`.deep["a1"]`)
+	assert.NoError(err)
+	v1 := types.NewStruct("S", types.StructData{"deep": aa1})
+	assert.Equal(Patch{{Kind: PatchSet, Path: path, Value: types.String("a-one-diff"), Old: types.String("a-one")}}, MakePatch(v1, types.NewStruct("S", types.StructData{"deep": aa1x})))
+}
+
+func TestPatchApplyErrors(t *testing.T) {
+	assert := assert.New(t)
+	path, err := types.ParsePath(`.a["b"]`)
+	assert.NoError(err)
+
+	_, err = Patch{{Kind: PatchSet, Path: path, Value: types.Number(1)}}.Apply(types.Number(1))
+	assert.EqualError(err, `.a["b"]: .a not found`)
+	_, err = Patch{{Kind: PatchRemove, Path: types.Path{}}}.Apply(types.Number(1))
+	assert.EqualError(err, "can't remove the root")
+	_, err = Patch{{Kind: PatchSplice, Path: types.Path{}, At: 2, Remove: 2}}.Apply(createList(1, 2, 3))
+	assert.EqualError(err, "(root): can't remove 2 elements at 2 from a list of 3")
+	_, err = Patch{{Kind: PatchRemove, Path: path}}.Apply(types.NewStruct("", types.StructData{"a": createMap("c", 1)}))
+	assert.EqualError(err, `.a["b"]: can't remove ["b"] in a Map<String, Number>`)
+}
+
+func TestWriteReadPatch(t *testing.T) {
+	assert := assert.New(t)
+	src := types.NewValueStore(types.NewBatchStoreAdaptor(chunks.NewMemoryStore()))
+	big := src.WriteValue(types.String("only in src"))
+	v1 := createMap("a", 1, "b", 2)
+	v2 := createMap("a", 1, "c", big)
+	v2 = v2.Set(types.NewStruct("Key", types.StructData{"r": big}), createList(1, 2))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(WritePatch(buf, MakePatch(v1, v2), src))
+	assert.Contains(buf.String(), `"show": "[\n  1,\n  2,\n]"`)
+
+	dest := types.NewValueStore(types.NewBatchStoreAdaptor(chunks.NewMemoryStore()))
+	patch, err := ReadPatch(buf, dest)
+	assert.NoError(err)
+	applied, err := patch.Apply(v1)
+	assert.NoError(err)
+	assert.True(v2.Equals(applied))
+	assert.Equal(types.String("only in src"), dest.ReadValue(big.TargetHash()))
+	undone, err := mustInvert(t, patch).Apply(applied)
+	assert.NoError(err)
+	assert.True(v1.Equals(undone))
+
+	_, err = ReadPatch(strings.NewReader(`{"ops": [{"op": "frob", "path": ".a"}]}`), dest)
+	assert.EqualError(err, `Invalid patch: unknown operation "frob"`)
+	_, err = ReadPatch(strings.NewReader(`{"ops": [{"op": "set", "path": ".a"}]}`), dest)
+	assert.EqualError(err, "Invalid patch: set of .a has no value")
+}
@@ -2,15 +2,17 @@ package diff
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/status"
 	humanize "github.com/dustin/go-humanize"
 )
 
-// Summary prints a summary of the diff between two values to stdout.
-func Summary(value1, value2 types.Value) {
+// PrintSummary prints a summary of the diff between two values to stdout.
+func PrintSummary(value1, value2 types.Value) {
 	if datas.IsCommitType(value1.Type()) && datas.IsCommitType(value2.Type()) {
 		fmt.Println("Comparing commit values")
 		value1 = value1.(types.Struct).Get(datas.ValueField)
@@ -40,11 +42,7 @@ func Summary(value1, value2 types.Value) {
 
 	acc := diffSummaryProgress{}
 	for p := range ch {
-		acc.Adds += p.Adds
-		acc.Removes += p.Removes
-		acc.Changes += p.Changes
-		acc.NewSize += p.NewSize
-		acc.OldSize += p.OldSize
+		acc.add(p)
 		if status.WillPrint() {
 			formatStatus(acc, singular, plural)
 		}
@@ -53,10 +51,97 @@ func Summary(value1, value2 types.Value) {
 	status.Done()
 }
 
+// Summary returns how many values were added, removed and changed going from |older| to |newer|, counted as PrintSummary counts them, and how many bytes of chunks only |newer| and only |older| are made of, read from |vr|, along with the encodings of the values themselves if they differ. Values are compared as they are by Diff, which skips the chunks the two share rather than visiting every difference, and only the chunks that aren't shared are read to count their bytes, so Summary is cheap for small changes to big values, as for showing the size of each commit in noms log.
+func Summary(older, newer types.Value, vr types.ValueReader) (adds, removes, changes, bytesAdded, bytesRemoved uint64) {
+	ch := make(chan diffSummaryProgress)
+	go func() {
+		diffSummary(ch, older, newer)
+		close(ch)
+	}()
+	acc := diffSummaryProgress{}
+	for p := range ch {
+		acc.add(p)
+	}
+
+	if !older.Equals(newer) {
+		bytesAdded, bytesRemoved = unsharedBytes(older, newer, vr)
+	}
+	return acc.Adds, acc.Removes, acc.Changes, bytesAdded, bytesRemoved
+}
+
+// unsharedBytes returns the size of the encoding of |newer| plus those of the chunks reachable only from it, and the same for |older|. The chunks are visited tallest first, as Pull does, since a chunk reachable from both is the same height on both sides, and all those of a given height have been found once there are no taller ones left to read.
+func unsharedBytes(older, newer types.Value, vr types.ValueReader) (bytesAdded, bytesRemoved uint64) {
+	newQ, oldQ := &types.RefByHeight{}, &types.RefByHeight{}
+	newSeen, oldSeen := hash.HashSet{}, hash.HashSet{}
+	visit := func(v types.Value, q *types.RefByHeight) uint64 {
+		v.WalkRefs(func(r types.Ref) {
+			q.PushBack(r)
+		})
+		return uint64(len(types.EncodeValue(v, nil).Data()))
+	}
+	read := func(refs types.RefSlice, q *types.RefByHeight, seen hash.HashSet) (n uint64) {
+		for _, r := range refs {
+			if h := r.TargetHash(); !seen.Has(h) {
+				seen.Insert(h)
+				n += visit(vr.ReadValue(h), q)
+			}
+		}
+		sort.Sort(q)
+		return
+	}
+
+	bytesAdded = visit(newer, newQ)
+	bytesRemoved = visit(older, oldQ)
+	sort.Sort(newQ)
+	sort.Sort(oldQ)
+	for !newQ.Empty() || !oldQ.Empty() {
+		var newHt, oldHt uint64
+		if !newQ.Empty() {
+			newHt = newQ.MaxHeight()
+		}
+		if !oldQ.Empty() {
+			oldHt = oldQ.MaxHeight()
+		}
+		if newHt > oldHt {
+			bytesAdded += read(newQ.PopRefsOfHeight(newHt), newQ, newSeen)
+			continue
+		}
+		if oldHt > newHt {
+			bytesRemoved += read(oldQ.PopRefsOfHeight(oldHt), oldQ, oldSeen)
+			continue
+		}
+		newRefs, oldRefs := newQ.PopRefsOfHeight(newHt), oldQ.PopRefsOfHeight(oldHt)
+		shared := hash.HashSet{}
+		for _, r := range newRefs {
+			shared.Insert(r.TargetHash())
+		}
+		onlyOld := types.RefSlice{}
+		for _, r := range oldRefs {
+			if h := r.TargetHash(); shared.Has(h) {
+				oldSeen.Insert(h)
+				newSeen.Insert(h)
+			} else {
+				onlyOld = append(onlyOld, r)
+			}
+		}
+		bytesAdded += read(newRefs, newQ, newSeen)
+		bytesRemoved += read(onlyOld, oldQ, oldSeen)
+	}
+	return
+}
+
 type diffSummaryProgress struct {
 	Adds, Removes, Changes, NewSize, OldSize uint64
 }
 
+func (acc *diffSummaryProgress) add(p diffSummaryProgress) {
+	acc.Adds += p.Adds
+	acc.Removes += p.Removes
+	acc.Changes += p.Changes
+	acc.NewSize += p.NewSize
+	acc.OldSize += p.OldSize
+}
+
 func diffSummary(ch chan diffSummaryProgress, v1, v2 types.Value) {
 	if !v1.Equals(v2) {
 		if shouldDescend(v1, v2) {
@@ -70,7 +155,8 @@ func diffSummary(ch chan diffSummaryProgress, v1, v2 types.Value) {
 			case types.StructKind:
 				diffSummaryStructs(ch, v1.(types.Struct), v2.(types.Struct))
 			default:
-				panic("Unrecognized type in diff function: " + v1.Type().Describe() + " and " + v2.Type().Describe())
+				// Values of other kinds, such as Tuples and Counters, are compared as a whole.
+				ch <- diffSummaryProgress{Changes: 1, NewSize: 1, OldSize: 1}
 			}
 		} else {
 			ch <- diffSummaryProgress{Adds: 1, Removes: 1, NewSize: 1, OldSize: 1}
@@ -0,0 +1,55 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	s1 := createStruct("s", "a", 1, "b", "two", "c", 3)
+	s2 := createStruct("s", "a", 1, "b", "two-diff", "d", 4)
+	adds, removes, changes, bytesAdded, bytesRemoved := Summary(s1, s2, vs)
+	assert.Equal([]uint64{1, 1, 1}, []uint64{adds, removes, changes})
+	assert.Equal(uint64(len(types.EncodeValue(s2, nil).Data())), bytesAdded)
+	assert.Equal(uint64(len(types.EncodeValue(s1, nil).Data())), bytesRemoved)
+
+	adds, removes, changes, bytesAdded, bytesRemoved = Summary(s1, s1, vs)
+	assert.Equal([]uint64{0, 0, 0, 0, 0}, []uint64{adds, removes, changes, bytesAdded, bytesRemoved})
+
+	values := make(chan types.Value)
+	listChan := types.NewStreamingList(vs, values)
+	for i := 0; i < 20000; i++ {
+		values <- types.String(fmt.Sprintf("value %d", i))
+	}
+	close(values)
+	l1 := vs.ReadValue(vs.WriteValue(<-listChan).TargetHash()).(types.List)
+	l2 := l1.Set(5000, types.String("changed")).Append(types.String("value 20000"))
+	vs.WriteValue(l2)
+
+	adds, removes, changes, bytesAdded, bytesRemoved = Summary(l1, l2, vs)
+	assert.Equal([]uint64{1, 0, 1}, []uint64{adds, removes, changes})
+
+	// Only the chunks on the paths to the changed elements differ, which are much smaller than the List.
+	assert.True(bytesAdded > 0)
+	assert.True(bytesRemoved > 0)
+	adds, _, _, size, _ := Summary(types.NewList(), l1, vs)
+	assert.Equal(uint64(20000), adds)
+	assert.True(bytesAdded < size/4, "%d bytes added of %d", bytesAdded, size)
+	assert.True(bytesRemoved < size/4, "%d bytes removed of %d", bytesRemoved, size)
+
+	// Going back undoes it.
+	adds, removes, changes, bytesAdded2, bytesRemoved2 := Summary(l2, l1, vs)
+	assert.Equal([]uint64{0, 1, 1}, []uint64{adds, removes, changes})
+	assert.Equal(bytesAdded, bytesRemoved2)
+	assert.Equal(bytesRemoved, bytesAdded2)
+}
@@ -16,15 +16,38 @@ import (
 )
 
 var commands = []*util.Command{
+	nomsApply,
+	nomsBackup,
+	nomsBlob,
+	nomsCdc,
 	nomsCommit,
 	nomsConfig,
+	nomsCsv,
 	nomsDiff,
 	nomsDs,
+	nomsFsck,
+	nomsGit,
+	nomsIngest,
+	nomsGrep,
+	nomsJson,
 	nomsLog,
+	nomsMerge,
+	nomsMount,
+	nomsParquet,
+	nomsQuery,
+	nomsRecompress,
+	nomsRepl,
+	nomsReplicate,
+	nomsRestore,
+	nomsRetention,
+	nomsRoot,
 	nomsServe,
 	nomsShow,
+	nomsSqlite,
+	nomsStats,
 	nomsSync,
 	nomsVersion,
+	nomsWatch,
 }
 
 var actions = []string{
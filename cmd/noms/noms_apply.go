@@ -0,0 +1,68 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/noms/diff"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var nomsApply = &util.Command{
+	Run:       runApply,
+	UsageLine: "apply [options] <patch> <dataset>",
+	Short:     "Applies a patch to the head of a dataset and commits the result",
+	Long:      "Reads a patch written by noms diff --patch from the patch file, or from stdin if it's -, applies it to the value of the head of the dataset, and commits the result to the dataset. Nothing is committed if any part of the patch doesn't apply.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset argument.",
+	Flags:     setupApplyFlags,
+	Nargs:     2,
+}
+
+func setupApplyFlags() *flag.FlagSet {
+	applyFlagSet := flag.NewFlagSet("apply", flag.ExitOnError)
+	spec.RegisterCommitMetaFlags(applyFlagSet)
+	verbose.RegisterVerboseFlags(applyFlagSet)
+	return applyFlagSet
+}
+
+func runApply(args []string) int {
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		in = f
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(args[1])
+	d.CheckError(err)
+	defer db.Close()
+
+	head, ok := ds.MaybeHead()
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Dataset %s has no data", args[1]))
+	}
+	patch, err := diff.ReadPatch(in, db)
+	d.CheckErrorNoUsage(err)
+	value, err := patch.Apply(head.Get(datas.ValueField))
+	d.CheckErrorNoUsage(err)
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+	oldHeadRef := ds.HeadRef()
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Fprintf(os.Stdout, "Applied %d changes, new head #%s (was #%s)\n", len(patch), ds.HeadRef().TargetHash().String(), oldHeadRef.TargetHash().String())
+	return 0
+}
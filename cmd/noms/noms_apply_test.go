@@ -0,0 +1,65 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestApply(t *testing.T) {
+	suite.Run(t, &nomsApplyTestSuite{})
+}
+
+type nomsApplyTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsApplyTestSuite) TestDiffPatchApply() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	v1 := types.NewStruct("Photo", types.StructData{
+		"title": types.String("beach"),
+		"tags":  types.NewSet(types.String("sea")),
+	})
+	v2 := types.NewStruct("Photo", types.StructData{
+		"title": types.String("beach at dusk"),
+		"tags":  types.NewSet(types.String("sea"), types.String("sunset")),
+		"size":  types.NewList(types.Number(640), types.Number(480)),
+	})
+	_, err = db.CommitValue(db.GetDataset("before"), v1)
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("after"), v2)
+	s.NoError(err)
+	other, err := db.CommitValue(db.GetDataset("other"), v1.Set("author", types.String("jo")))
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("unrelated"), types.Number(42))
+	s.NoError(err)
+	db.Close()
+
+	patch, _ := s.MustRun(main, []string{"diff", "--patch", dbSpec + "::before", dbSpec + "::after"})
+	patchFile := filepath.Join(s.TempDir, "patch.json")
+	s.NoError(ioutil.WriteFile(patchFile, []byte(patch), 0644))
+
+	out, _ := s.MustRun(main, []string{"apply", patchFile, dbSpec + "::other"})
+	s.Contains(out, "Applied 3 changes, new head #")
+	s.Contains(out, "(was #"+other.HeadRef().TargetHash().String()+")")
+
+	db, err = spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	s.True(v2.Set("author", types.String("jo")).Equals(db.GetDataset("other").HeadValue()))
+	db.Close()
+
+	_, stderr, recovered := s.Run(main, []string{"apply", patchFile, dbSpec + "::unrelated"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, `.size: can't set .size in a Number`)
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/backup"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var (
+	backupCodec   string
+	backupKeyFile string
+	restoreForce  bool
+)
+
+var nomsBackup = &util.Command{
+	Run:       runBackup,
+	UsageLine: "backup [options] <database> <archive>",
+	Short:     "Writes a database to a single archive file",
+	Long:      "Writes every chunk reachable from the root of the database to the archive file exactly once. Archives can be restored into any kind of database with noms restore.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupBackupFlags,
+	Nargs:     2,
+}
+
+var nomsRestore = &util.Command{
+	Run:       runRestore,
+	UsageLine: "restore [options] <archive> <database>",
+	Short:     "Restores an archive written by noms backup into a database",
+	Long:      "Copies the chunks in the archive into the database and then sets its root to that of the archive. The database must be empty unless --force is given.\n\nArchives of databases of an older version whose data is still valid, e.g. 7, are restored too, so backing such a database up and restoring it into a new one upgrades it.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupRestoreFlags,
+	Nargs:     2,
+}
+
+func setupBackupFlags() *flag.FlagSet {
+	backupFlagSet := flag.NewFlagSet("backup", flag.ExitOnError)
+	backupFlagSet.StringVar(&backupCodec, "codec", string(chunks.DefaultCodec), "compression applied to chunks in the archive: none, snappy, flate or zstd")
+	backupFlagSet.StringVar(&backupKeyFile, "key-file", "", "if set, file holding a 16, 24 or 32 byte AES key, raw or hex encoded, with which to encrypt the archive")
+	spec.RegisterDatabaseFlags(backupFlagSet)
+	verbose.RegisterVerboseFlags(backupFlagSet)
+	return backupFlagSet
+}
+
+func setupRestoreFlags() *flag.FlagSet {
+	restoreFlagSet := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreFlagSet.StringVar(&backupKeyFile, "key-file", "", "file holding the key with which the archive was encrypted")
+	restoreFlagSet.BoolVar(&restoreForce, "force", false, "restore even if the database isn't empty, replacing its root")
+	spec.RegisterDatabaseFlags(restoreFlagSet)
+	verbose.RegisterVerboseFlags(restoreFlagSet)
+	return restoreFlagSet
+}
+
+// readKeyFile returns the key in |path| as a KeyProvider, or nil if |path| is empty.
+func readKeyFile(path string) (chunks.KeyProvider, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return chunks.ReadKeyFile(path)
+}
+
+func runBackup(args []string) int {
+	codec, err := chunks.ParseCodec(backupCodec)
+	d.CheckError(err)
+	keys, err := readKeyFile(backupKeyFile)
+	d.CheckErrorNoUsage(err)
+
+	cs, err := config.NewResolver().GetChunkStore(args[0])
+	d.CheckError(err)
+	defer cs.Close()
+
+	f, err := os.Create(args[1])
+	d.CheckErrorNoUsage(err)
+	m, err := backup.Backup(cs, f, backup.Options{Codec: codec, Keys: keys})
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+		os.Remove(args[1])
+	}
+	d.CheckErrorNoUsage(err)
+
+	fmt.Printf("Backed up %d chunks with root %s to %s\n", m.Chunks, m.Root, args[1])
+	return 0
+}
+
+func runRestore(args []string) int {
+	keys, err := readKeyFile(backupKeyFile)
+	d.CheckErrorNoUsage(err)
+
+	f, err := os.Open(args[0])
+	d.CheckErrorNoUsage(err)
+	defer f.Close()
+
+	cs, err := config.NewResolver().GetChunkStore(args[1])
+	d.CheckError(err)
+	defer cs.Close()
+
+	m, err := backup.Restore(f, cs, keys, restoreForce)
+	d.CheckErrorNoUsage(err)
+
+	fmt.Printf("Restored %d chunks with root %s from %s\n", m.Chunks, m.Root, args[0])
+	return 0
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestBackup(t *testing.T) {
+	suite.Run(t, &nomsBackupTestSuite{})
+}
+
+type nomsBackupTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsBackupTestSuite) TestBackupAndRestore() {
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	_, err := sourceDB.CommitValue(sourceDB.GetDataset("ds"), types.NewList(types.Number(1), types.String("two")))
+	s.NoError(err)
+	sourceDB.Close()
+
+	keyFile := path.Join(s.TempDir, "key")
+	s.NoError(ioutil.WriteFile(keyFile, []byte("000102030405060708090a0b0c0d0e0f\n"), 0600))
+	archive := path.Join(s.TempDir, "archive")
+	sout, _ := s.MustRun(main, []string{"backup", "--codec", "flate", "--key-file", keyFile, spec.CreateDatabaseSpecString("ldb", s.LdbDir), archive})
+	s.Contains(sout, "Backed up")
+
+	dest := path.Join(s.TempDir, "dest")
+	destSpec := spec.CreateDatabaseSpecString("nbs", dest)
+	sout, _ = s.MustRun(main, []string{"restore", "--key-file", keyFile, archive, destSpec})
+	s.Contains(sout, "Restored")
+
+	sout, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", dest, "ds.value")})
+	s.Contains(sout, `"two"`)
+
+	// Restoring again would clobber the database.
+	defer func() {
+		s.Equal(clienttest.ExitError{1}, recover())
+	}()
+	s.MustRun(main, []string{"restore", "--key-file", keyFile, archive, destSpec})
+}
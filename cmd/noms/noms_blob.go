@@ -0,0 +1,209 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/noms/diff"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progressreader"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var (
+	blobQuiet bool
+
+	// blobCheckpointBytes is how much of a file blob put reads between checkpoints.
+	blobCheckpointBytes uint64 = 64 << 20
+)
+
+var nomsBlob = &util.Command{
+	Run:       runBlob,
+	UsageLine: "blob put [options] <file|-> <path> | get [options] <path> <file|->",
+	Short:     "Stores files as blobs, and retrieves them",
+	Long: `put reads a file, or stdin if it's -, into a blob, and commits it to a dataset. The path is the dataset, in which case the blob becomes the value of its new head, or the dataset followed by .value and a path within the value of its current head, e.g. photos.value.originals["beach.jpg"], to add the blob there.
+
+Files are read in 64MB parts, and after each part what's been read so far is committed to a checkpoint dataset, named after the dataset with /blob-put added. If put is interrupted, running it again with the same file and path carries on from the last checkpoint, as long as the file hasn't changed. The checkpoint dataset is deleted once the blob is committed. Stdin can't be resumed.
+
+get writes the blob at the path to a file, or to stdout if it's -.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the path argument.`,
+	Flags: setupBlobFlags,
+	Nargs: 3,
+}
+
+func setupBlobFlags() *flag.FlagSet {
+	blobFlagSet := flag.NewFlagSet("blob", flag.ExitOnError)
+	blobFlagSet.BoolVar(&blobQuiet, "quiet", false, "silence progress output")
+	spec.RegisterCommitMetaFlags(blobFlagSet)
+	verbose.RegisterVerboseFlags(blobFlagSet)
+	return blobFlagSet
+}
+
+func runBlob(args []string) int {
+	if len(args) != 3 {
+		d.CheckError(fmt.Errorf("blob %s takes 2 arguments", args[0]))
+	}
+	switch args[0] {
+	case "put":
+		runBlobPut(args[1], args[2])
+	case "get":
+		runBlobGet(args[1], args[2])
+	default:
+		d.CheckError(fmt.Errorf("Unknown blob subcommand %s", args[0]))
+	}
+	return 0
+}
+
+// blobProgress returns a progressreader.Callback which reports how much of |total| bytes, or an unknown amount if it's negative, have been copied, counting from |offset|.
+func blobProgress(verb string, offset uint64, total int64) progressreader.Callback {
+	start := time.Now()
+	return func(seen uint64) {
+		if blobQuiet {
+			return
+		}
+		elapsed := time.Since(start).Seconds()
+		rate := uint64(float64(seen) / elapsed)
+		if total < 0 {
+			status.Printf("%s %s in %ds (%s/s)...", humanize.Bytes(offset+seen), verb, int(elapsed), humanize.Bytes(rate))
+		} else {
+			status.Printf("%s of %s %s in %ds (%s/s)...", humanize.Bytes(offset+seen), humanize.Bytes(uint64(total)), verb, int(elapsed), humanize.Bytes(rate))
+		}
+	}
+}
+
+func runBlobPut(file, pathSpec string) {
+	cfg := config.NewResolver()
+	sp, err := cfg.GetPathSpec(pathSpec)
+	d.CheckError(err)
+	path := sp.Path
+	if path.Dataset == "" || !path.At.IsZero() || path.Ancestors != 0 {
+		d.CheckError(fmt.Errorf("Invalid path %s, must be a dataset, optionally followed by .value and a path within it", pathSpec))
+	}
+	if len(path.Path) > 0 {
+		if fp, ok := path.Path[0].(types.FieldPath); !ok || fp.Name != datas.ValueField {
+			d.CheckError(fmt.Errorf("Invalid path %s, must be a dataset, optionally followed by .value and a path within it", pathSpec))
+		}
+	}
+	db, err := sp.DbSpec.Database()
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+	ds := db.GetDataset(path.Dataset)
+
+	blob := types.NewEmptyBlob()
+	var in io.Reader = os.Stdin
+	size := int64(-1)
+	var checkpoint datas.Dataset
+	var source, modified string
+	if file != "-" {
+		f, err := os.Open(file)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		fi, err := f.Stat()
+		d.CheckErrorNoUsage(err)
+		source, err = filepath.Abs(file)
+		d.CheckErrorNoUsage(err)
+		size, modified = fi.Size(), fi.ModTime().UTC().Format(time.RFC3339Nano)
+
+		checkpoint = db.GetDataset(ds.ID() + "/blob-put")
+		if head, ok := checkpoint.MaybeHeadValue(); ok {
+			if cp, ok := head.(types.Struct); ok && cp.Type().Desc.(types.StructDesc).Name == "BlobPut" &&
+				cp.Get("source").Equals(types.String(source)) && cp.Get("size").Equals(types.Number(size)) && cp.Get("modified").Equals(types.String(modified)) {
+				blob = cp.Get("blob").(types.Blob)
+				_, err = f.Seek(int64(blob.Len()), 0)
+				d.CheckErrorNoUsage(err)
+				fmt.Printf("Resuming %s at %s of %s\n", file, humanize.Bytes(blob.Len()), humanize.Bytes(uint64(size)))
+			}
+		}
+		in = f
+	}
+
+	pr := progressreader.New(in, blobProgress("read", blob.Len(), size))
+	for {
+		part := types.NewStreamingBlob(db, io.LimitReader(pr, int64(blobCheckpointBytes)))
+		// Streamed blobs can't read the chunks they've written until they're read back from db, and Concat needs to.
+		part = db.ReadValue(db.WriteValue(part).TargetHash()).(types.Blob)
+		blob = blob.Concat(part)
+		if part.Len() < blobCheckpointBytes {
+			break
+		}
+		if source == "" {
+			// Stdin can't be resumed, so there's no point checkpointing it.
+			continue
+		}
+		checkpoint, err = db.CommitValue(checkpoint, types.NewStruct("BlobPut", types.StructData{
+			"source":   types.String(source),
+			"size":     types.Number(size),
+			"modified": types.String(modified),
+			"blob":     blob,
+		}))
+		d.CheckErrorNoUsage(err)
+	}
+	if !blobQuiet {
+		status.Done()
+	}
+
+	var value types.Value = blob
+	if len(path.Path) > 1 {
+		head, ok := ds.MaybeHeadValue()
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Dataset %s has no data", path.Dataset))
+		}
+		value, err = diff.Patch{{Kind: diff.PatchSet, Path: path.Path[1:], Value: blob}}.Apply(head)
+		d.CheckErrorNoUsage(err)
+	}
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+	if _, ok := checkpoint.MaybeHeadRef(); ok {
+		_, err = db.Delete(checkpoint)
+		d.CheckErrorNoUsage(err)
+	}
+	fmt.Printf("Put %s (%s) at %s, new head #%s\n", file, humanize.Bytes(blob.Len()), pathSpec, ds.HeadRef().TargetHash().String())
+}
+
+func runBlobGet(pathSpec, file string) {
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(pathSpec)
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+	if value == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", pathSpec))
+	}
+	blob, ok := value.(types.Blob)
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Value at %s is a %s, not a Blob", pathSpec, value.Type().Describe()))
+	}
+
+	var out io.Writer = os.Stdout
+	if file == "-" {
+		// Progress goes to stdout too, so it would end up in the data.
+		blobQuiet = true
+	} else {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		out = f
+	}
+	_, err = io.Copy(out, progressreader.New(blob.Reader(), blobProgress("written", 0, int64(blob.Len()))))
+	d.CheckErrorNoUsage(err)
+	if !blobQuiet {
+		status.Done()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestBlob(t *testing.T) {
+	suite.Run(t, &nomsBlobTestSuite{})
+}
+
+type nomsBlobTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsBlobTestSuite) writeFile(name string, size int) (string, []byte) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	file := filepath.Join(s.TempDir, name)
+	s.NoError(ioutil.WriteFile(file, data, 0644))
+	return file, data
+}
+
+func (s *nomsBlobTestSuite) TestPutGet() {
+	defer func(b uint64) { blobCheckpointBytes = b }(blobCheckpointBytes)
+	blobCheckpointBytes = 1 << 16
+	file, data := s.writeFile("in", 300000)
+	dbSpec := spec.CreateDatabaseSpecString("ldb", filepath.Join(s.TempDir, "putget"))
+
+	out, _ := s.MustRun(main, []string{"blob", "put", "--quiet", file, dbSpec + "::files"})
+	s.Contains(out, "Put "+file+" (300 kB) at "+dbSpec+"::files, new head #")
+
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	s.True(types.NewBlob(bytes.NewReader(data)).Equals(db.GetDataset("files").HeadValue()))
+	_, ok := db.GetDataset("files/blob-put").MaybeHeadRef()
+	s.False(ok)
+	db.Close()
+
+	outFile := filepath.Join(s.TempDir, "out")
+	s.MustRun(main, []string{"blob", "get", "--quiet", dbSpec + "::files.value", outFile})
+	got, err := ioutil.ReadFile(outFile)
+	s.NoError(err)
+	s.Equal(data, got)
+
+	_, stderr, recovered := s.Run(main, []string{"blob", "get", dbSpec + "::files.meta", outFile})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "not a Blob")
+}
+
+func (s *nomsBlobTestSuite) TestPutAtPath() {
+	file, data := s.writeFile("in", 1000)
+	dbSpec := spec.CreateDatabaseSpecString("ldb", filepath.Join(s.TempDir, "path"))
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("photos"), types.NewStruct("", types.StructData{"originals": types.NewMap()}))
+	s.NoError(err)
+	db.Close()
+
+	s.MustRun(main, []string{"blob", "put", "--quiet", file, dbSpec + `::photos.value.originals["beach.jpg"]`})
+	db, err = spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	expected := types.NewStruct("", types.StructData{"originals": types.NewMap(types.String("beach.jpg"), types.NewBlob(bytes.NewReader(data)))})
+	s.True(expected.Equals(db.GetDataset("photos").HeadValue()))
+	db.Close()
+}
+
+func (s *nomsBlobTestSuite) TestPutResume() {
+	defer func(b uint64) { blobCheckpointBytes = b }(blobCheckpointBytes)
+	blobCheckpointBytes = 1 << 16
+	file, data := s.writeFile("in", 200000)
+	fi, err := os.Stat(file)
+	s.NoError(err)
+	dbSpec := spec.CreateDatabaseSpecString("ldb", filepath.Join(s.TempDir, "resume"))
+
+	// Pretend an earlier put got as far as the first checkpoint, except that its data differs from the file's, to show that it's used.
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	partial := make([]byte, blobCheckpointBytes)
+	_, err = db.CommitValue(db.GetDataset("files/blob-put"), types.NewStruct("BlobPut", types.StructData{
+		"source":   types.String(file),
+		"size":     types.Number(len(data)),
+		"modified": types.String(fi.ModTime().UTC().Format(time.RFC3339Nano)),
+		"blob":     types.NewBlob(bytes.NewReader(partial)),
+	}))
+	s.NoError(err)
+	db.Close()
+
+	out, _ := s.MustRun(main, []string{"blob", "put", "--quiet", file, dbSpec + "::files"})
+	s.Contains(out, "Resuming "+file+" at 66 kB of 200 kB\n")
+
+	db, err = spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	expected := append(partial, data[blobCheckpointBytes:]...)
+	s.True(types.NewBlob(bytes.NewReader(expected)).Equals(db.GetDataset("files").HeadValue()))
+	db.Close()
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/cdc"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	cdcInterval   time.Duration
+	cdcWebhook    string
+	cdcAfter      string
+	cdcExpandRefs int
+	cdcCount      int
+)
+
+var nomsCdc = &util.Command{
+	Run:       runCdc,
+	UsageLine: "cdc [options] <dataset>",
+	Short:     "Streams the changes committed to a dataset as JSON events",
+	Long: `cdc waits for commits to a dataset, and for each one, writes an event to stdout as a line of JSON, or with --webhook, POSTs it to a URL, holding the dataset, the hash of the commit and of its parent, its meta, and a list of changes, each of which says what was "added", "removed" or "modified" at which path in the value of the commit, with the old and new values as JSON, as noms show --format json writes them. If several commits are made between checks, there's an event for each of them.
+
+cdc stops if a webhook doesn't respond with a 2xx. To carry on where it stopped, pass the hash of the last commit that was sent to --after, and events are first sent for the commits made since.
+
+To publish the events to a Kafka topic, pipe them into a producer, e.g.
+
+  noms cdc <dataset> | kcat -P -b <broker> -t <topic>
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset argument.`,
+	Flags: setupCdcFlags,
+	Nargs: 1,
+}
+
+func setupCdcFlags() *flag.FlagSet {
+	cdcFlagSet := flag.NewFlagSet("cdc", flag.ExitOnError)
+	cdcFlagSet.DurationVar(&cdcInterval, "interval", time.Second, "how often to check for commits, unless the database is served by a server that says when they happen")
+	cdcFlagSet.StringVar(&cdcWebhook, "webhook", "", "URL to POST each event to, rather than writing it to stdout")
+	cdcFlagSet.StringVar(&cdcAfter, "after", "", "hash of the last commit whose event was sent, to send events for the commits made since first")
+	cdcFlagSet.IntVar(&cdcExpandRefs, "expand-refs", 0, "how many levels of Refs in values to replace with the values they point to")
+	cdcFlagSet.IntVar(&cdcCount, "n", 0, "stop after this many events; 0 means stream forever")
+	return cdcFlagSet
+}
+
+// errCdcDone stops noms cdc once it's sent -n events.
+var errCdcDone = errors.New("done")
+
+// countSink stops noms cdc after -n events.
+type countSink struct {
+	cdc.Sink
+	sent int
+}
+
+func (s *countSink) Send(e cdc.Event) error {
+	if err := s.Sink.Send(e); err != nil {
+		return err
+	}
+	s.sent++
+	if s.sent == cdcCount {
+		return errCdcDone
+	}
+	return nil
+}
+
+func runCdc(args []string) int {
+	opts := cdc.Options{Interval: cdcInterval, ExpandRefs: cdcExpandRefs}
+	if cdcAfter != "" {
+		h, ok := hash.MaybeParse(cdcAfter)
+		if !ok {
+			d.CheckError(fmt.Errorf("Invalid hash %s", cdcAfter))
+		}
+		opts.After = h
+	}
+	db, ds, err := config.NewResolver().GetDataset(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	sink := cdc.NewWriterSink(os.Stdout)
+	if cdcWebhook != "" {
+		sink = cdc.NewWebhookSink(cdcWebhook)
+	}
+	if err := cdc.Tail(db, ds.ID(), opts, &countSink{Sink: sink}); err != errCdcDone {
+		d.CheckErrorNoUsage(err)
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stormasm/noms/go/cdc"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsCdc(t *testing.T) {
+	suite.Run(t, &nomsCdcTestSuite{})
+}
+
+type nomsCdcTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsCdcTestSuite) TestCdc() {
+	dsSpec := "mem://cdc::ds"
+	defer spec.DropMemStore("cdc")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	ds, err = db.CommitValue(ds, types.NewMap(types.String("a"), types.Number(1)))
+	s.NoError(err)
+	first := ds.HeadRef().TargetHash().String()
+	db.Close()
+
+	// Commits made later are streamed as they're made.
+	done := (&nomsWatchTestSuite{s.ClientTestSuite}).commitLater(dsSpec,
+		types.NewMap(types.String("a"), types.Number(2)),
+		types.NewMap(types.String("a"), types.Number(2), types.String("b"), types.Number(3)))
+	stdout, _ := s.MustRun(main, []string{"cdc", "--interval", "5ms", "-n", "2", dsSpec})
+	<-done
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	s.Len(lines, 2)
+	events := make([]cdc.Event, len(lines))
+	for i, l := range lines {
+		s.NoError(json.Unmarshal([]byte(l), &events[i]))
+	}
+	s.Equal(first, events[0].Parent)
+	s.Equal(map[string]interface{}{"message": "commit 1"}, events[0].Meta)
+	s.Equal([]cdc.Change{{Op: "modified", Path: `["a"]`, Old: float64(1), New: float64(2)}}, events[0].Changes)
+	s.Equal(events[0].Commit, events[1].Parent)
+	s.Equal([]cdc.Change{{Op: "added", Path: `["b"]`, New: float64(3)}}, events[1].Changes)
+
+	// With --after, the commits made since are sent first, here to a webhook.
+	posted := []cdc.Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e cdc.Event
+		s.NoError(json.NewDecoder(r.Body).Decode(&e))
+		posted = append(posted, e)
+	}))
+	defer server.Close()
+	stdout, _ = s.MustRun(main, []string{"cdc", "--after", first, "--webhook", server.URL, "-n", "2", dsSpec})
+	s.Equal("", stdout)
+	s.Equal(events, posted)
+
+	_, _, recovered := s.Run(main, []string{"cdc", "--after", types.String("nope").Hash().String(), dsSpec})
+	s.NotNil(recovered)
+}
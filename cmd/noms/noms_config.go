@@ -16,24 +16,111 @@ import (
 
 var nomsConfig = &util.Command{
 	Run:       runConfig,
-	UsageLine: "config ",
-	Short:     "Display noms config info",
-	Long:      "Prints the active configuration if a .nomsconfig file is present",
-	Flags:     setupConfigFlags,
-	Nargs:     0,
+	UsageLine: "config [init [<database>] | list | get <key> | set <key> <value> | add-alias <alias> <url> | rm-alias <alias>]",
+	Short:     "Display or edit noms config info",
+	Long: `With no arguments, prints the active configuration if a .nomsconfig file is present, with included files merged in.
+
+The subcommands edit the nearest .nomsconfig file, as written, without expanding environment variables or following includes. Comments in the file aren't preserved.
+
+  init [<database>]        creates a .nomsconfig in the current directory, optionally with <database> as its default database
+  list                     prints each key that's set, with its value
+  get <key>                prints the value of <key>
+  set <key> <value>        sets <key> to <value>, or clears it if <value> is empty
+  add-alias <alias> <url>  defines <alias> as the database or workspace <url>
+  rm-alias <alias>         removes the definition of <alias>
+
+Keys are db.<alias>.url, db.<alias>.urls (comma separated), db.<alias>.probe_timeout, db.<alias>.auth_token, db.<alias>.aws_profile, db.<alias>.key_file, db.<alias>.access_file and db.<alias>.options.<option>. The default database's alias is "default".`,
+	Flags: setupConfigFlags,
+	Nargs: 0,
 }
 
 func setupConfigFlags() *flag.FlagSet {
 	return flag.NewFlagSet("config", flag.ExitOnError)
 }
 
+// configSubcommands maps each subcommand to the number of arguments it takes and a function that runs it against the config file.
+var configSubcommands = map[string]struct {
+	nargs int
+	run   func(cf *config.ConfigFile, args []string) (save bool, err error)
+}{
+	"list": {0, func(cf *config.ConfigFile, args []string) (bool, error) {
+		for _, key := range cf.Keys() {
+			val, _ := cf.Get(key)
+			fmt.Printf("%s=%s\n", key, val)
+		}
+		return false, nil
+	}},
+	"get": {1, func(cf *config.ConfigFile, args []string) (bool, error) {
+		val, err := cf.Get(args[0])
+		if err == nil {
+			fmt.Println(val)
+		}
+		return false, err
+	}},
+	"set": {2, func(cf *config.ConfigFile, args []string) (bool, error) {
+		return true, cf.Set(args[0], args[1])
+	}},
+	"add-alias": {2, func(cf *config.ConfigFile, args []string) (bool, error) {
+		return true, cf.AddAlias(args[0], args[1])
+	}},
+	"rm-alias": {1, func(cf *config.ConfigFile, args []string) (bool, error) {
+		return true, cf.RemoveAlias(args[0])
+	}},
+}
+
 func runConfig(args []string) int {
-	c, err := config.FindNomsConfig()
+	if len(args) == 0 {
+		c, err := config.FindNomsConfig()
+		if err == config.NoConfig {
+			fmt.Fprintf(os.Stdout, "no config active\n")
+		} else {
+			d.CheckError(err)
+			fmt.Fprintf(os.Stdout, "%s\n", c.String())
+		}
+		return 0
+	}
+
+	if args[0] == "init" {
+		return runConfigInit(args[1:])
+	}
+	sub, ok := configSubcommands[args[0]]
+	if !ok {
+		d.CheckError(fmt.Errorf("Unknown config subcommand %s", args[0]))
+	}
+	if len(args)-1 != sub.nargs {
+		d.CheckError(fmt.Errorf("config %s takes %d arguments", args[0], sub.nargs))
+	}
+	file, err := config.FindNomsConfigFile()
 	if err == config.NoConfig {
-		fmt.Fprintf(os.Stdout, "no config active\n")
-	} else {
-		d.CheckError(err)
-		fmt.Fprintf(os.Stdout, "%s\n", c.String())
+		d.CheckErrorNoUsage(fmt.Errorf("%s; create one with noms config init", err))
+	}
+	d.CheckErrorNoUsage(err)
+	cf, err := config.LoadConfigFile(file)
+	d.CheckErrorNoUsage(err)
+	save, err := sub.run(cf, args[1:])
+	d.CheckErrorNoUsage(err)
+	if save {
+		d.CheckErrorNoUsage(cf.Save())
+	}
+	return 0
+}
+
+func runConfigInit(args []string) int {
+	if len(args) > 1 {
+		d.CheckError(fmt.Errorf("config init takes at most 1 argument"))
+	}
+	_, err := os.Stat(config.NomsConfigFile)
+	if err == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("%s already exists", config.NomsConfigFile))
+	} else if !os.IsNotExist(err) {
+		d.CheckErrorNoUsage(err)
+	}
+	cf, err := config.LoadConfigFile(config.NomsConfigFile)
+	d.CheckErrorNoUsage(err)
+	if len(args) == 1 {
+		d.CheckErrorNoUsage(cf.AddAlias(config.DefaultDbAlias, args[0]))
 	}
+	d.CheckErrorNoUsage(cf.Save())
+	fmt.Printf("Created %s\n", config.NomsConfigFile)
 	return 0
 }
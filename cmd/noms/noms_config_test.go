@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestConfigCommand(t *testing.T) {
+	suite.Run(t, &nomsConfigTestSuite{})
+}
+
+type nomsConfigTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsConfigTestSuite) TestEditConfig() {
+	cwd, err := os.Getwd()
+	s.NoError(err)
+	defer os.Chdir(cwd)
+	dir := path.Join(s.TempDir, "edit")
+	s.NoError(os.MkdirAll(dir, 0777))
+	s.NoError(os.Chdir(dir))
+
+	sout, _ := s.MustRun(main, []string{"config", "init", "ldb:./local"})
+	s.Equal("Created .nomsconfig\n", sout)
+	s.MustRun(main, []string{"config", "add-alias", "origin", "http://test.com:8080/foo"})
+	s.MustRun(main, []string{"config", "set", "db.origin.auth_token", "${NOMS_TOKEN}"})
+	s.MustRun(main, []string{"config", "set", "db.default.options.block_cache", "1GiB"})
+
+	sout, _ = s.MustRun(main, []string{"config", "get", "db.default.url"})
+	s.Equal("ldb:./local\n", sout)
+	sout, _ = s.MustRun(main, []string{"config", "list"})
+	s.Equal("db.default.url=ldb:./local\ndb.default.options.block_cache=1GiB\ndb.origin.url=http://test.com:8080/foo\ndb.origin.auth_token=${NOMS_TOKEN}\n", sout)
+
+	// Edits don't expand environment variables or qualify paths.
+	data, err := ioutil.ReadFile(config.NomsConfigFile)
+	s.NoError(err)
+	s.Contains(string(data), `url = "ldb:./local"`)
+	s.Contains(string(data), `auth_token = "${NOMS_TOKEN}"`)
+
+	s.MustRun(main, []string{"config", "rm-alias", "origin"})
+	sout, _ = s.MustRun(main, []string{"config", "list"})
+	s.Equal("db.default.url=ldb:./local\ndb.default.options.block_cache=1GiB\n", sout)
+
+	_, _, err2 := s.Run(main, []string{"config", "get", "db.origin.url"})
+	s.Equal(clienttest.ExitError{1}, err2)
+	_, _, err2 = s.Run(main, []string{"config", "set", "db.default.url", "bogus:spec"})
+	s.Equal(clienttest.ExitError{1}, err2)
+	_, _, err2 = s.Run(main, []string{"config", "init"})
+	s.Equal(clienttest.ExitError{1}, err2)
+}
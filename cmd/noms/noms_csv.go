@@ -0,0 +1,311 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"context"
+	encodingcsv "encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/csv"
+	"github.com/stormasm/noms/go/util/progress"
+	"github.com/stormasm/noms/go/util/progressreader"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	csvDelimiter   string
+	csvHeader      string
+	csvRename      string
+	csvColumnTypes string
+	csvNoInfer     bool
+	csvSampleRows  int
+	csvName        string
+	csvPrimaryKey  string
+	csvSkipRecords uint
+	csvQuiet       bool
+)
+
+var nomsCsv = &util.Command{
+	Run:       runCsv,
+	UsageLine: "csv import [options] <file|-> <dataset> | export [options] <path> <file|->",
+	Short:     "Imports CSV files into datasets, and exports them again",
+	Long: `import reads a CSV file, or stdin if it's -, and commits its rows to a dataset, as a List of structs named Row, with a field for each column, or with --pk, as a Map of them. The first row is the header, unless --header gives the names of the columns; --rename changes some of them, e.g. --rename "First Name=first,Last Name=last".
+
+The type of each column is inferred from the first --sample-rows rows: Bool if they're all booleans, otherwise Number if they're all numbers, otherwise String. --column-types overrides some of them, by column name or 0-based index, e.g. --column-types zip=String,2=Number, and --no-infer makes every column a String unless it's overridden.
+
+--pk names the columns, by name or 0-based index, that make up the primary key of each row, e.g. --pk id. With one column, the rows are imported as a Map from that column's value to the row; with several, the keys of the Map are structs named Key with a field for each of the columns. The file is read as it's imported, and a Map's rows are sorted on disk, so files much bigger than memory can be imported.
+
+export writes the List or Map of structs at a path, e.g. a dataset, or its .value, to a file, or stdout if it's -, with a header row.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset and path arguments.`,
+	Flags: setupCsvFlags,
+	Nargs: 3,
+}
+
+func setupCsvFlags() *flag.FlagSet {
+	csvFlagSet := flag.NewFlagSet("csv", flag.ExitOnError)
+	csvFlagSet.StringVar(&csvDelimiter, "delimiter", ",", "field delimiter, which must be a single character")
+	csvFlagSet.StringVar(&csvHeader, "header", "", "comma-separated names of the columns, if the file doesn't have a header row")
+	csvFlagSet.StringVar(&csvRename, "rename", "", "comma-separated old=new pairs of columns to rename")
+	csvFlagSet.StringVar(&csvColumnTypes, "column-types", "", "comma-separated column=type pairs, where type is Bool, Number or String, to override the inferred types of columns")
+	csvFlagSet.BoolVar(&csvNoInfer, "no-infer", false, "don't infer the types of columns, making them strings unless --column-types says otherwise")
+	csvFlagSet.IntVar(&csvSampleRows, "sample-rows", 1000, "number of rows to infer the types of columns from")
+	csvFlagSet.StringVar(&csvName, "name", "Row", "name of the struct each row is imported as")
+	csvFlagSet.StringVar(&csvPrimaryKey, "pk", "", "comma-separated columns making up the primary key of each row, to import the rows as a Map")
+	csvFlagSet.UintVar(&csvSkipRecords, "skip-records", 0, "number of records to skip at the start of the file, before the header row")
+	csvFlagSet.BoolVar(&csvQuiet, "quiet", false, "silence progress output")
+	spec.RegisterCommitMetaFlags(csvFlagSet)
+	verbose.RegisterVerboseFlags(csvFlagSet)
+	return csvFlagSet
+}
+
+func runCsv(args []string) int {
+	if len(args) != 3 {
+		d.CheckError(fmt.Errorf("csv %s takes 2 arguments", args[0]))
+	}
+	delim, err := csv.StringToRune(csvDelimiter)
+	d.CheckError(err)
+	switch args[0] {
+	case "import":
+		runCsvImport(args[1], args[2], delim)
+	case "export":
+		runCsvExport(args[1], args[2], delim)
+	default:
+		d.CheckError(fmt.Errorf("Unknown csv subcommand %s", args[0]))
+	}
+	return 0
+}
+
+// tryCsv calls f, and returns the error it panics with, if it's one the csv package panics with on bad input, or because reading was canceled.
+func tryCsv(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r == context.Canceled {
+				err = context.Canceled
+				return
+			}
+			pe, ok := r.(*encodingcsv.ParseError)
+			if !ok {
+				panic(r)
+			}
+			err = pe
+		}
+	}()
+	return d.Unwrap(d.Try(f))
+}
+
+func runCsvImport(file, dsSpec string, delim rune) {
+	renames, err := parseColumnPairs("rename", csvRename)
+	d.CheckError(err)
+	columnTypes, err := parseColumnPairs("column-types", csvColumnTypes)
+	d.CheckError(err)
+
+	var in io.Reader = os.Stdin
+	size := int64(-1)
+	if file != "-" {
+		f, err := os.Open(file)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		fi, err := f.Stat()
+		d.CheckErrorNoUsage(err)
+		in, size = f, fi.Size()
+	}
+	// Ctrl-C stops the import, leaving the dataset as it was.
+	ctx, stop := progress.WithInterrupt(context.Background())
+	defer stop()
+	bar := progress.NewBar("Importing")
+	if !csvQuiet {
+		ctx = progress.WithReporter(ctx, bar)
+	}
+	if size >= 0 {
+		progress.Add(ctx, progress.Progress{TotalBytes: uint64(size)})
+	}
+	cr := csv.NewCSVReader(progress.NewReader(ctx, in), delim)
+	err = csv.SkipRecords(cr, csvSkipRecords)
+	if err == io.EOF {
+		err = fmt.Errorf("--skip-records skipped past the end of %s", file)
+	}
+	d.CheckErrorNoUsage(err)
+
+	var headers []string
+	if csvHeader != "" {
+		headers = strings.Split(csvHeader, ",")
+	} else {
+		headers, err = cr.Read()
+		if err == io.EOF {
+			err = fmt.Errorf("%s is empty", file)
+		}
+		d.CheckErrorNoUsage(err)
+	}
+	origHeaders := append([]string{}, headers...)
+	for _, r := range renames {
+		i := columnIndex(origHeaders, r[0])
+		if i < 0 {
+			d.CheckErrorNoUsage(fmt.Errorf("Can't rename %s, there's no such column", r[0]))
+		}
+		headers[i] = r[1]
+	}
+	seen := map[string]bool{}
+	for _, h := range headers {
+		if seen[h] {
+			d.CheckErrorNoUsage(fmt.Errorf("Column %s appears more than once, use --header or --rename to give the columns unique names", h))
+		}
+		seen[h] = true
+	}
+
+	var rr csv.RecordReader = cr
+	kinds := make(csv.KindSlice, len(headers))
+	for i := range kinds {
+		kinds[i] = types.StringKind
+	}
+	if !csvNoInfer {
+		kinds, rr, err = csv.InferKinds(cr, csvSampleRows, len(headers))
+		d.CheckErrorNoUsage(err)
+	}
+	for _, ct := range columnTypes {
+		i := columnIndex(headers, ct[0])
+		if i < 0 {
+			i = columnIndex(origHeaders, ct[0])
+		}
+		if i < 0 {
+			d.CheckErrorNoUsage(fmt.Errorf("Can't set the type of %s, there's no such column", ct[0]))
+		}
+		k, ok := csv.StringToKind[ct[1]]
+		if !ok || (k != types.BoolKind && k != types.NumberKind && k != types.StringKind) {
+			d.CheckErrorNoUsage(fmt.Errorf("Invalid type %s for column %s, must be Bool, Number or String", ct[1], ct[0]))
+		}
+		kinds[i] = k
+	}
+
+	pks := []string{}
+	if csvPrimaryKey != "" {
+		for _, pk := range strings.Split(csvPrimaryKey, ",") {
+			if columnIndex(headers, pk) < 0 {
+				d.CheckErrorNoUsage(fmt.Errorf("Invalid --pk, there's no column %s", pk))
+			}
+			pks = append(pks, pk)
+		}
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	rr = csv.WithContext(ctx, rr)
+	var value types.Value
+	err = tryCsv(func() {
+		switch len(pks) {
+		case 0:
+			value, _ = csv.ReadToList(rr, csvName, headers, kinds, db)
+		case 1:
+			value = csv.ReadToMap(rr, csvName, headers, pks, kinds, db)
+		default:
+			value = csv.ReadToCompositeKeyMap(rr, csvName, "Key", headers, pks, kinds, db)
+		}
+	})
+	bar.Done()
+	if err == context.Canceled {
+		err = fmt.Errorf("Importing %s was canceled, leaving %s unchanged", file, dsSpec)
+	}
+	d.CheckErrorNoUsage(err)
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", map[string]string{"inputFile": file}, nil)
+	d.CheckErrorNoUsage(err)
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Imported %d rows of %s into %s, new head #%s\n", value.(types.Collection).Len(), file, dsSpec, ds.HeadRef().TargetHash().String())
+}
+
+func runCsvExport(pathSpec, file string, delim rune) {
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(pathSpec)
+	d.CheckError(err)
+	defer db.Close()
+	if value == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", pathSpec))
+	}
+	if c, ok := value.(types.Struct); ok && datas.IsCommitType(c.Type()) {
+		// A dataset means the value of its head.
+		value = c.Get(datas.ValueField)
+	}
+
+	var out io.Writer = os.Stdout
+	if file != "-" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		out = f
+	}
+	err = d.Try(func() {
+		switch v := value.(type) {
+		case types.List:
+			csv.WriteList(v, csv.GetListElemDesc(v, db), delim, out)
+		case types.Map:
+			csv.WriteMap(v, csv.GetMapElemDesc(v, db), delim, out)
+		default:
+			d.PanicIfError(fmt.Errorf("Value at %s is a %s, not a List or Map of structs", pathSpec, value.Type().Describe()))
+		}
+	})
+	d.CheckErrorNoUsage(d.Unwrap(err))
+}
+
+// readProgress returns a progressreader.Callback which reports how much of a file of |size| bytes, or of stdin if it's negative, has been read.
+func readProgress(size int64) progressreader.Callback {
+	start := time.Now()
+	return func(seen uint64) {
+		elapsed := time.Since(start).Seconds()
+		rate := uint64(float64(seen) / elapsed)
+		if size < 0 {
+			status.Printf("%s read in %ds (%s/s)...", humanize.Bytes(seen), int(elapsed), humanize.Bytes(rate))
+		} else {
+			status.Printf("%s of %s read in %ds (%s/s)...", humanize.Bytes(seen), humanize.Bytes(uint64(size)), int(elapsed), humanize.Bytes(rate))
+		}
+	}
+}
+
+// parseColumnPairs parses |str|, a comma-separated list of name=value pairs as taken by --rename and --column-types.
+func parseColumnPairs(flagName, str string) ([][2]string, error) {
+	pairs := [][2]string{}
+	if str == "" {
+		return pairs, nil
+	}
+	for _, p := range strings.Split(str, ",") {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("Invalid --%s %s, must be name=value", flagName, p)
+		}
+		pairs = append(pairs, [2]string{kv[0], kv[1]})
+	}
+	return pairs, nil
+}
+
+// columnIndex returns the index of |column|, which is either a column name or a 0-based index, in |headers|, or -1 if there's no such column.
+func columnIndex(headers []string, column string) int {
+	for i, h := range headers {
+		if h == column {
+			return i
+		}
+	}
+	if i, err := strconv.Atoi(column); err == nil && i >= 0 && i < len(headers) {
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestCsv(t *testing.T) {
+	suite.Run(t, &nomsCsvTestSuite{})
+}
+
+type nomsCsvTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsCsvTestSuite) writeCsv(name, data string) string {
+	file := filepath.Join(s.TempDir, name)
+	s.NoError(ioutil.WriteFile(file, []byte(data), 0644))
+	return file
+}
+
+func (s *nomsCsvTestSuite) TestImportList() {
+	file := s.writeCsv("in.csv", "name;age;zip;member\nalice;30;01234;true\nbob;25;98765;false\n")
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "list"), "people")
+
+	out, _ := s.MustRun(main, []string{"csv", "import", "--quiet", "--delimiter", ";", "--rename", "member=isMember", "--column-types", "zip=String", file, dsSpec})
+	s.Contains(out, "Imported 2 rows of "+file+" into "+dsSpec+", new head #")
+
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	l := ds.HeadValue().(types.List)
+	s.Equal(uint64(2), l.Len())
+	row := l.Get(0).(types.Struct)
+	s.Equal("Row", row.Type().Desc.(types.StructDesc).Name)
+	s.Equal(types.String("alice"), row.Get("name"))
+	s.Equal(types.Number(30), row.Get("age"))
+	s.Equal(types.String("01234"), row.Get("zip"))
+	s.Equal(types.Bool(true), row.Get("isMember"))
+}
+
+func (s *nomsCsvTestSuite) TestImportNoInferHeader() {
+	file := s.writeCsv("in.csv", "skipped\nalice,30\nbob,25\n")
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "noinfer"), "people")
+
+	s.MustRun(main, []string{"csv", "import", "--quiet", "--skip-records", "1", "--header", "name,age", "--no-infer", "--pk", "name", file, dsSpec})
+
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	m := ds.HeadValue().(types.Map)
+	s.Equal(uint64(2), m.Len())
+	s.Equal(types.String("30"), m.Get(types.String("alice")).(types.Struct).Get("age"))
+}
+
+func (s *nomsCsvTestSuite) TestImportCompositeKeyExport() {
+	file := s.writeCsv("in.csv", "year,month,count\n2016,1,10\n2016,2,20\n2017,1,30\n")
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "composite"), "counts")
+
+	s.MustRun(main, []string{"csv", "import", "--quiet", "--pk", "year,month", file, dsSpec})
+
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	m := ds.HeadValue().(types.Map)
+	s.Equal(uint64(3), m.Len())
+	key := types.NewStruct("Key", types.StructData{"year": types.Number(2017), "month": types.Number(1)})
+	s.Equal(types.Number(30), m.Get(key).(types.Struct).Get("count"))
+	db.Close()
+
+	// Struct fields are exported in name order, and the rows in the order of their keys.
+	out, _ := s.MustRun(main, []string{"csv", "export", dsSpec, "-"})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	s.Equal("count,month,year", lines[0])
+	rows := lines[1:]
+	sort.Strings(rows)
+	s.Equal([]string{"10,1,2016", "20,2,2016", "30,1,2017"}, rows)
+}
+
+func (s *nomsCsvTestSuite) TestBadColumns() {
+	file := s.writeCsv("in.csv", "a,b\n1,2\n")
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "bad"), "ds")
+
+	_, stderr, recovered := s.Run(main, []string{"csv", "import", "--quiet", "--rename", "c=d", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Can't rename c, there's no such column")
+
+	_, stderr, recovered = s.Run(main, []string{"csv", "import", "--quiet", "--rename", "b=a", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Column a appears more than once")
+
+	_, stderr, recovered = s.Run(main, []string{"csv", "import", "--quiet", "--column-types", "a=Blob", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Invalid type Blob for column a")
+
+	_, stderr, recovered = s.Run(main, []string{"csv", "import", "--quiet", "--pk", "c", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Invalid --pk, there's no column c")
+}
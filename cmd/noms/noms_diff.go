@@ -5,24 +5,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/stormasm/noms/cmd/noms/diff"
 	"github.com/stormasm/noms/cmd/util"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/outputpager"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/stormasm/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
-var summarize bool
+var (
+	summarize bool
+	patch     bool
+)
 
 var nomsDiff = &util.Command{
 	Run:       runDiff,
-	UsageLine: "diff [--summarize] <object1> <object2>",
+	UsageLine: "diff [--summarize | --patch] <object1> <object2>",
 	Short:     "Shows the difference between two objects",
-	Long:      "See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object arguments.",
+	Long:      "--patch writes the difference as a patch instead, which noms apply can apply to another dataset. If both objects are commits, the patch is of their values. Patches are JSON, listing the changes path by path, and include all the data that the new values refer to.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object arguments.",
 	Flags:     setupDiffFlags,
 	Nargs:     2,
 }
@@ -30,6 +38,7 @@ var nomsDiff = &util.Command{
 func setupDiffFlags() *flag.FlagSet {
 	diffFlagSet := flag.NewFlagSet("diff", flag.ExitOnError)
 	diffFlagSet.BoolVar(&summarize, "summarize", false, "Writes a summary of the changes instead")
+	diffFlagSet.BoolVar(&patch, "patch", false, "Writes a patch that noms apply can apply instead")
 	outputpager.RegisterOutputpagerFlags(diffFlagSet)
 	verbose.RegisterVerboseFlags(diffFlagSet)
 
@@ -52,14 +61,32 @@ func runDiff(args []string) int {
 	}
 	defer db2.Close()
 
+	if summarize && patch {
+		d.CheckError(fmt.Errorf("At most one of --summarize and --patch may be given"))
+	}
+
 	if summarize {
-		diff.Summary(value1, value2)
+		diff.PrintSummary(value1, value2)
 		return 0
 	}
 
+	if patch {
+		if datas.IsCommitType(value1.Type()) && datas.IsCommitType(value2.Type()) {
+			value1 = value1.(types.Struct).Get(datas.ValueField)
+			value2 = value2.(types.Struct).Get(datas.ValueField)
+		}
+		d.CheckErrorNoUsage(diff.WritePatch(os.Stdout, diff.MakePatch(value1, value2), db2))
+		return 0
+	}
+
+	// Ctrl-C stops the diff, which can take a long time for big values, rather than killing noms with the pager still open.
+	ctx, stop := progress.WithInterrupt(context.Background())
+	defer stop()
 	pgr := outputpager.Start()
 	defer pgr.Stop()
 
-	diff.Diff(pgr.Writer, value1, value2, false)
+	if err := diff.DiffContext(ctx, pgr.Writer, value1, value2, false); err == context.Canceled {
+		fmt.Fprintln(os.Stderr, "Diff canceled")
+	}
 	return 0
 }
@@ -6,22 +6,33 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/stormasm/noms/cmd/util"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
-var toDelete string
+var (
+	toDelete   string
+	deleteMany bool
+	rename     bool
+)
 
 var nomsDs = &util.Command{
 	Run:       runDs,
-	UsageLine: "ds [<database> | -d <dataset>]",
+	UsageLine: "ds [<database> | -d <dataset> | --delete <dataset>... | --rename <dataset> <new-name>]",
 	Short:     "Noms dataset management",
-	Long:      "See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
+	Long:      "With a database, lists its datasets; with --verbose, along with the hash and height of each one's head, and the date of its last commit.\n\n--delete deletes each dataset given, where the names of the datasets may be patterns as understood by path.Match, e.g. db::tmp-* (quoted, so the shell leaves them alone), to delete every dataset that matches. --rename moves the head of a dataset to a new dataset, in the same database, which must not exist yet.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
 	Flags:     setupDsFlags,
 	Nargs:     0,
 }
@@ -29,13 +40,16 @@ var nomsDs = &util.Command{
 func setupDsFlags() *flag.FlagSet {
 	dsFlagSet := flag.NewFlagSet("ds", flag.ExitOnError)
 	dsFlagSet.StringVar(&toDelete, "d", "", "dataset to delete")
+	dsFlagSet.BoolVar(&deleteMany, "delete", false, "delete the datasets given as arguments")
+	dsFlagSet.BoolVar(&rename, "rename", false, "rename the dataset given as the first argument to the second")
 	verbose.RegisterVerboseFlags(dsFlagSet)
 	return dsFlagSet
 }
 
 func runDs(args []string) int {
 	cfg := config.NewResolver()
-	if toDelete != "" {
+	switch {
+	case toDelete != "":
 		db, set, err := cfg.GetDataset(toDelete)
 		d.CheckError(err)
 		defer db.Close()
@@ -49,7 +63,19 @@ func runDs(args []string) int {
 		d.CheckError(err)
 
 		fmt.Printf("Deleted %v (was #%v)\n", toDelete, oldCommitRef.TargetHash().String())
-	} else {
+	case deleteMany:
+		if len(args) == 0 {
+			d.CheckError(fmt.Errorf("--delete needs at least one dataset"))
+		}
+		for _, arg := range args {
+			deleteDatasets(cfg, arg)
+		}
+	case rename:
+		if len(args) != 2 {
+			d.CheckError(fmt.Errorf("--rename takes a dataset and its new name"))
+		}
+		renameDataset(cfg, args[0], args[1])
+	default:
 		dbSpec := ""
 		if len(args) >= 1 {
 			dbSpec = args[0]
@@ -58,9 +84,78 @@ func runDs(args []string) int {
 		d.CheckError(err)
 		defer store.Close()
 
+		if !verbose.Verbose() {
+			store.Datasets().IterAll(func(k, v types.Value) {
+				fmt.Println(k)
+			})
+			return 0
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
 		store.Datasets().IterAll(func(k, v types.Value) {
-			fmt.Println(k)
+			headRef := v.(types.Ref)
+			date := "-"
+			if t, ok := spec.CommitMetaDate(headRef.TargetValue(store).(types.Struct)); ok {
+				date = t.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t#%s\t%d\t%s\n", k.(types.String), headRef.TargetHash().String(), headRef.Height(), date)
 		})
+		w.Flush()
 	}
 	return 0
 }
+
+// deleteDatasets deletes the datasets that |dsSpec| names, which may be a pattern.
+func deleteDatasets(cfg *config.Resolver, dsSpec string) {
+	resolved := cfg.ResolvePathSpec(dsSpec)
+	i := strings.LastIndex(resolved, spec.Separator)
+	if i < 0 {
+		d.CheckError(fmt.Errorf("Invalid dataset %s", dsSpec))
+	}
+	pattern := resolved[i+len(spec.Separator):]
+	if _, err := path.Match(pattern, ""); err != nil {
+		d.CheckError(fmt.Errorf("Invalid pattern %s: %s", pattern, err))
+	}
+	db, err := cfg.GetDatabase(resolved[:i])
+	d.CheckError(err)
+	defer db.Close()
+
+	matched := []string{}
+	db.Datasets().IterAll(func(k, v types.Value) {
+		if ok, _ := path.Match(pattern, string(k.(types.String))); ok {
+			matched = append(matched, string(k.(types.String)))
+		}
+	})
+	if len(matched) == 0 {
+		d.CheckErrorNoUsage(fmt.Errorf("No datasets match %s", dsSpec))
+	}
+	for _, id := range matched {
+		ds := db.GetDataset(id)
+		oldCommitRef := ds.HeadRef()
+		_, err = db.Delete(ds)
+		d.CheckErrorNoUsage(err)
+		fmt.Printf("Deleted %v (was #%v)\n", id, oldCommitRef.TargetHash().String())
+	}
+}
+
+func renameDataset(cfg *config.Resolver, dsSpec, newName string) {
+	if !datasetRe.MatchString(newName) {
+		d.CheckError(fmt.Errorf("Invalid dataset %s, must match %s", newName, datas.DatasetRe.String()))
+	}
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	headRef, ok := ds.MaybeHeadRef()
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Dataset %s not found", ds.ID()))
+	}
+	newDs := db.GetDataset(newName)
+	if _, ok := newDs.MaybeHeadRef(); ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Dataset %s already exists", newName))
+	}
+	_, err = db.SetHead(newDs, headRef)
+	d.CheckErrorNoUsage(err)
+	_, err = db.Delete(ds)
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Renamed %s to %s (#%s)\n", ds.ID(), newName, headRef.TargetHash().String())
+}
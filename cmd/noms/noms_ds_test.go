@@ -5,6 +5,8 @@
 package main
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stormasm/noms/go/chunks"
@@ -83,3 +85,61 @@ func (s *nomsDsTestSuite) TestNomsDs() {
 	rtnVal, _ = s.MustRun(main, []string{"ds", dbSpec})
 	s.Equal("", rtnVal)
 }
+
+// setupDatasets commits a value to each of |ids| in a new database, and returns its spec.
+func (s *nomsDsTestSuite) setupDatasets(name string, ids ...string) string {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", filepath.Join(s.TempDir, name))
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	for _, id := range ids {
+		_, err = db.CommitValue(db.GetDataset(id), types.String(id))
+		s.NoError(err)
+	}
+	s.NoError(db.Close())
+	return dbSpec
+}
+
+func (s *nomsDsTestSuite) TestNomsDsDeleteMany() {
+	dbSpec := s.setupDatasets("deletemany", "keep", "tmp-1", "tmp-2", "other")
+
+	out, _ := s.MustRun(main, []string{"ds", "--delete", dbSpec + "::tmp-*", dbSpec + "::other"})
+	s.Regexp("^Deleted tmp-1 \\(was #[0-9a-v]{32}\\)\nDeleted tmp-2 \\(was #[0-9a-v]{32}\\)\nDeleted other \\(was #[0-9a-v]{32}\\)\n$", out)
+	out, _ = s.MustRun(main, []string{"ds", dbSpec})
+	s.Equal("keep\n", out)
+
+	_, stderr, recovered := s.Run(main, []string{"ds", "--delete", dbSpec + "::tmp-*"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "No datasets match")
+}
+
+func (s *nomsDsTestSuite) TestNomsDsRename() {
+	dbSpec := s.setupDatasets("rename", "old", "taken")
+
+	out, _ := s.MustRun(main, []string{"ds", "--rename", dbSpec + "::old", "new"})
+	s.Regexp("^Renamed old to new \\(#[0-9a-v]{32}\\)\n$", out)
+	out, _ = s.MustRun(main, []string{"ds", dbSpec})
+	s.Equal("new\ntaken\n", out)
+
+	_, stderr, recovered := s.Run(main, []string{"ds", "--rename", dbSpec + "::new", "taken"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Dataset taken already exists")
+}
+
+func (s *nomsDsTestSuite) TestNomsDsVerbose() {
+	dbSpec := s.setupDatasets("verbose", "a")
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	meta := types.NewStruct("Meta", types.StructData{"date": types.String("2016-10-01T12:00:00Z")})
+	ds, err := db.Commit(db.GetDataset("a"), types.Number(2), datas.CommitOptions{Meta: meta})
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("b"), types.Number(3))
+	s.NoError(err)
+	s.NoError(db.Close())
+
+	out, _ := s.MustRun(main, []string{"ds", "-v", dbSpec})
+	lines := strings.Split(out, "\n")
+	s.Len(lines, 3)
+	s.Equal([]string{"a", "#" + ds.HeadRef().TargetHash().String(), "2", "2016-10-01T12:00:00Z"}, strings.Fields(lines[0]))
+	fields := strings.Fields(lines[1])
+	s.Equal([]string{"b", "1", "-"}, []string{fields[0], fields[2], fields[3]})
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var (
+	fsckRepair bool
+	fsckQuiet  bool
+)
+
+var nomsFsck = &util.Command{
+	Run:       runFsck,
+	UsageLine: "fsck [--repair] <database>",
+	Short:     "Checks the integrity of a database",
+	Long:      "Reads every chunk reachable from the root of the database, starting with the head of each dataset, and checks that each one is present and that its data matches its hash, and that every dataset head, and every parent of a commit, is a well formed commit. Each problem found is printed, and fsck fails if there are any.\n\nWith --repair, datasets whose heads are missing or aren't commits are deleted. Other problems can't be repaired here; noms sync or noms restore can copy good chunks back from another database.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupFsckFlags,
+	Nargs:     1,
+}
+
+func setupFsckFlags() *flag.FlagSet {
+	fsckFlagSet := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fsckFlagSet.BoolVar(&fsckRepair, "repair", false, "delete datasets whose heads are missing or aren't commits")
+	fsckFlagSet.BoolVar(&fsckQuiet, "quiet", false, "silence progress output")
+	verbose.RegisterVerboseFlags(fsckFlagSet)
+	return fsckFlagSet
+}
+
+func runFsck(args []string) int {
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	var checked int
+	var problems []datas.FsckProblem
+	err = d.Try(func() {
+		checked, problems = datas.Fsck(db, func(checked int) {
+			if !fsckQuiet {
+				status.Printf("Checked %d chunks...", checked)
+			}
+		})
+	})
+	if !fsckQuiet {
+		status.Done()
+	}
+	d.CheckErrorNoUsage(d.Unwrap(err))
+
+	unrepaired := 0
+	for _, p := range problems {
+		if fsckRepair && p.Head {
+			_, err := db.Delete(db.GetDataset(p.Dataset))
+			d.CheckErrorNoUsage(err)
+			fmt.Printf("%s; deleted dataset %s\n", p, p.Dataset)
+			continue
+		}
+		fmt.Println(p)
+		unrepaired++
+	}
+
+	switch {
+	case len(problems) == 0:
+		fmt.Printf("Checked %d chunks, no problems found\n", checked)
+	case unrepaired == 0:
+		fmt.Printf("Checked %d chunks, repaired %d problems\n", checked, len(problems))
+	default:
+		d.CheckErrorNoUsage(fmt.Errorf("Checked %d chunks, found %d problems, %d of them unrepaired", checked, len(problems), unrepaired))
+	}
+	return 0
+}
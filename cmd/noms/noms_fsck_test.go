@@ -0,0 +1,55 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestFsck(t *testing.T) {
+	suite.Run(t, &nomsFsckTestSuite{})
+}
+
+type nomsFsckTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsFsckTestSuite) TestFsck() {
+	db := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	_, err := db.CommitValue(db.GetDataset("good"), types.NewList(types.Number(1), types.Number(2)))
+	s.NoError(err)
+	db.Close()
+
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	sout, _ := s.MustRun(main, []string{"fsck", "--quiet", dbSpec})
+	s.Contains(sout, "no problems found")
+
+	// Add a dataset whose head was never written.
+	cs := chunks.NewLevelDBStore(s.LdbDir, "", 1, false)
+	db = datas.NewDatabase(cs)
+	missing := datas.NewCommit(types.String("missing"), types.NewSet(), types.EmptyStruct)
+	root := types.EncodeValue(db.Datasets().Set(types.String("bad"), types.NewRef(missing)), nil)
+	cs.Put(root)
+	s.True(cs.UpdateRoot(root.Hash(), cs.Root()))
+	db.Close()
+
+	sout, _, recovered := s.Run(main, []string{"fsck", "--quiet", dbSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(sout, "bad: head "+missing.Hash().String()+" is missing")
+
+	sout, _ = s.MustRun(main, []string{"fsck", "--quiet", "--repair", dbSpec})
+	s.Contains(sout, "deleted dataset bad")
+	s.Contains(sout, "repaired 1 problems")
+
+	sout, _ = s.MustRun(main, []string{"fsck", "--quiet", dbSpec})
+	s.Contains(sout, "no problems found")
+}
@@ -0,0 +1,338 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	gitRev   string
+	gitQuiet bool
+)
+
+var nomsGit = &util.Command{
+	Run:       runGit,
+	UsageLine: "git import [options] <repo> <dataset>",
+	Short:     "Imports the history of a git repository",
+	Long: `import reads the history of the git repository <repo> up to --rev, which is HEAD by default, and commits it to <dataset>, one Noms commit for each git commit, with the same parents, so that the history can be looked at with noms log, diff and the rest.
+
+The value of each commit is its git tree, as a Map from names to the Maps of subtrees and the Blobs of files. Executable files are Structs named Executable, with their Blob in data, symlinks are Structs named Symlink, with their target, and submodules are Structs named Submodule, with the hash of their commit. The meta of each commit has the date and message of the git commit, its author and committer, their emails in authorEmail and committerEmail, and its hash in gitHash.
+
+Trees, files and commits that have already been imported aren't read again, so running import again after new commits only imports those. The dataset must be empty, or its head must be a commit that --rev descends from. The git command must be installed.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset argument.`,
+	Flags: setupGitFlags,
+	Nargs: 3,
+}
+
+func setupGitFlags() *flag.FlagSet {
+	gitFlagSet := flag.NewFlagSet("git", flag.ExitOnError)
+	gitFlagSet.StringVar(&gitRev, "rev", "HEAD", "the git revision, e.g. a branch, tag or commit hash, whose history to import")
+	gitFlagSet.BoolVar(&gitQuiet, "quiet", false, "silence progress output")
+	verbose.RegisterVerboseFlags(gitFlagSet)
+	return gitFlagSet
+}
+
+func runGit(args []string) int {
+	if args[0] != "import" {
+		d.CheckError(fmt.Errorf("Unknown git subcommand %s", args[0]))
+	}
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(args[2])
+	d.CheckError(err)
+	defer db.Close()
+
+	imp := newGitImporter(db, args[1])
+	defer imp.close()
+	ds, n, err := imp.importHistory(ds, gitRev)
+	d.CheckErrorNoUsage(err)
+	if !gitQuiet {
+		status.Done()
+		fmt.Printf("Imported %d commits to %s, head #%s\n", n, args[2], ds.HeadRef().TargetHash())
+	}
+	return 0
+}
+
+// gitImporter maps the objects of a git repository to Noms values, caching those it's mapped by their git hashes, since git objects, like Noms values, don't change.
+type gitImporter struct {
+	db      datas.Database
+	repo    string
+	cat     *exec.Cmd
+	in      io.WriteCloser
+	out     *bufio.Reader
+	commits map[string]types.Ref
+	objects map[string]types.Value
+}
+
+func newGitImporter(db datas.Database, repo string) *gitImporter {
+	return &gitImporter{db: db, repo: repo, commits: map[string]types.Ref{}, objects: map[string]types.Value{}}
+}
+
+func (imp *gitImporter) close() {
+	if imp.cat != nil {
+		imp.in.Close()
+		imp.cat.Wait()
+	}
+}
+
+func (imp *gitImporter) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", imp.repo}, args...)...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// readObject returns the contents of the git object |hash|, which must be of type |kind|, read with a long-running git cat-file --batch.
+func (imp *gitImporter) readObject(hash, kind string) ([]byte, error) {
+	if imp.cat == nil {
+		imp.cat = exec.Command("git", "-C", imp.repo, "cat-file", "--batch")
+		in, err := imp.cat.StdinPipe()
+		d.PanicIfError(err)
+		out, err := imp.cat.StdoutPipe()
+		d.PanicIfError(err)
+		if err := imp.cat.Start(); err != nil {
+			return nil, err
+		}
+		imp.in, imp.out = in, bufio.NewReader(out)
+	}
+
+	if _, err := fmt.Fprintln(imp.in, hash); err != nil {
+		return nil, err
+	}
+	header, err := imp.out.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != kind {
+		return nil, fmt.Errorf("git object %s isn't a %s: %s", hash, kind, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size+1) // followed by a newline
+	if _, err := io.ReadFull(imp.out, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+// importHistory commits the history of |rev| to |ds|, returning the number of git commits it imported.
+func (imp *gitImporter) importHistory(ds datas.Dataset, rev string) (datas.Dataset, int, error) {
+	if head, ok := ds.MaybeHead(); ok {
+		imp.findImported(head)
+	}
+	out, err := imp.git("rev-list", "--topo-order", "--reverse", rev, "--")
+	if err != nil {
+		return ds, 0, err
+	}
+	hashes := strings.Fields(string(out))
+	if len(hashes) == 0 {
+		return ds, 0, fmt.Errorf("%s has no commits", rev)
+	}
+
+	n := 0
+	for i, h := range hashes {
+		if _, ok := imp.commits[h]; ok {
+			continue
+		}
+		c, err := imp.importCommit(h)
+		if err != nil {
+			return ds, n, err
+		}
+		imp.commits[h] = imp.db.WriteValue(c)
+		n++
+		if !gitQuiet {
+			status.Printf("Imported %d of %d commits...", i+1, len(hashes))
+		}
+	}
+	head := imp.commits[hashes[len(hashes)-1]]
+	if r, ok := ds.MaybeHeadRef(); ok && r.Equals(head) {
+		return ds, n, nil
+	}
+	ds, err = imp.db.FastForward(ds, head)
+	return ds, n, err
+}
+
+// findImported adds the commits in the history of |head| that were imported from git to those which aren't imported again.
+func (imp *gitImporter) findImported(head types.Struct) {
+	pending := []types.Struct{head}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		meta, ok := c.Get(datas.MetaField).(types.Struct)
+		if !ok {
+			continue
+		}
+		h, ok := meta.MaybeGet("gitHash")
+		if !ok {
+			continue
+		}
+		if _, seen := imp.commits[string(h.(types.String))]; seen {
+			continue
+		}
+		imp.commits[string(h.(types.String))] = types.NewRef(c)
+		c.Get(datas.ParentsField).(types.Set).IterAll(func(p types.Value) {
+			pending = append(pending, imp.db.ReadValue(p.(types.Ref).TargetHash()).(types.Struct))
+		})
+	}
+}
+
+// importCommit returns the Noms commit of the git commit |hash|, whose parents must have been imported.
+func (imp *gitImporter) importCommit(hash string) (types.Struct, error) {
+	data, err := imp.readObject(hash, "commit")
+	if err != nil {
+		return types.Struct{}, err
+	}
+	headers, message := string(data), ""
+	if i := strings.Index(headers, "\n\n"); i >= 0 {
+		headers, message = headers[:i], headers[i+2:]
+	}
+
+	meta := types.StructData{"gitHash": types.String(hash), "message": types.String(message)}
+	parents := types.NewSet()
+	var tree types.Value
+	for _, line := range strings.Split(headers, "\n") {
+		// Continuation lines, e.g. of signatures, start with a space.
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			continue
+		}
+		switch fields[0] {
+		case "tree":
+			if tree, err = imp.importTree(fields[1]); err != nil {
+				return types.Struct{}, err
+			}
+		case "parent":
+			r, ok := imp.commits[fields[1]]
+			if !ok {
+				return types.Struct{}, fmt.Errorf("Parent %s of git commit %s hasn't been imported", fields[1], hash)
+			}
+			parents = parents.Insert(r)
+		case "author", "committer":
+			name, email, date, err := parseGitSignature(fields[1])
+			if err != nil {
+				return types.Struct{}, fmt.Errorf("Bad %s of git commit %s: %s", fields[0], hash, err)
+			}
+			meta[fields[0]], meta[fields[0]+"Email"] = types.String(name), types.String(email)
+			if fields[0] == "author" {
+				meta["date"] = types.String(date.Format(spec.CommitMetaDateFormat))
+			}
+		}
+	}
+	if tree == nil {
+		return types.Struct{}, fmt.Errorf("git commit %s has no tree", hash)
+	}
+	return datas.NewCommit(tree, parents, types.NewStruct("Meta", meta)), nil
+}
+
+// parseGitSignature parses the author or committer of a git commit, e.g. "A U Thor <author@example.com> 1476600000 +0200".
+func parseGitSignature(sig string) (name, email string, date time.Time, err error) {
+	lt, gt := strings.Index(sig, "<"), strings.LastIndex(sig, ">")
+	if lt < 0 || gt < lt {
+		return "", "", time.Time{}, fmt.Errorf("no email in %q", sig)
+	}
+	name, email = strings.TrimSpace(sig[:lt]), sig[lt+1:gt]
+	fields := strings.Fields(sig[gt+1:])
+	if len(fields) != 2 {
+		return "", "", time.Time{}, fmt.Errorf("no date in %q", sig)
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	zone, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return name, email, time.Unix(secs, 0).In(zone.Location()), nil
+}
+
+// importTree returns the Map of the git tree |hash|.
+func (imp *gitImporter) importTree(hash string) (types.Value, error) {
+	if v, ok := imp.objects[hash]; ok {
+		return v, nil
+	}
+	data, err := imp.readObject(hash, "tree")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each entry is "<mode> <name>\0" followed by the 20 bytes of the hash of its object.
+	kvs := []types.Value{}
+	for len(data) > 0 {
+		sp, nul := bytes.IndexByte(data, ' '), bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return nil, fmt.Errorf("Bad git tree %s", hash)
+		}
+		mode, name, h := string(data[:sp]), string(data[sp+1:nul]), fmt.Sprintf("%x", data[nul+1:nul+21])
+		data = data[nul+21:]
+
+		var v types.Value
+		switch mode {
+		case "40000":
+			v, err = imp.importTree(h)
+		case "100644", "100664":
+			v, err = imp.importBlob(h)
+		case "100755":
+			if v, err = imp.importBlob(h); err == nil {
+				v = types.NewStruct("Executable", types.StructData{"data": v})
+			}
+		case "120000":
+			var target []byte
+			if target, err = imp.readObject(h, "blob"); err == nil {
+				v = types.NewStruct("Symlink", types.StructData{"target": types.String(target)})
+			}
+		case "160000":
+			v = types.NewStruct("Submodule", types.StructData{"commit": types.String(h)})
+		default:
+			err = fmt.Errorf("Unknown mode %s of %s in git tree %s", mode, name, hash)
+		}
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, types.String(name), v)
+	}
+	m := types.NewMap(kvs...)
+	imp.objects[hash] = m
+	return m, nil
+}
+
+// importBlob returns the Blob of the git blob |hash|. Its chunks are written as it's read, so that only the roots of the Blobs imported are kept in memory.
+func (imp *gitImporter) importBlob(hash string) (types.Value, error) {
+	if v, ok := imp.objects[hash]; ok {
+		return v, nil
+	}
+	data, err := imp.readObject(hash, "blob")
+	if err != nil {
+		return nil, err
+	}
+	b := types.NewStreamingBlob(imp.db, bytes.NewReader(data))
+	imp.objects[hash] = b
+	return b, nil
+}
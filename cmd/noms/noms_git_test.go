@@ -0,0 +1,107 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestNomsGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	suite.Run(t, &nomsGitTestSuite{})
+}
+
+type nomsGitTestSuite struct {
+	clienttest.ClientTestSuite
+	repo string
+}
+
+func (s *nomsGitTestSuite) git(args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", s.repo}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=A U Thor", "GIT_AUTHOR_EMAIL=author@example.com", "GIT_AUTHOR_DATE=1476600000 +0200",
+		"GIT_COMMITTER_NAME=C O Mitter", "GIT_COMMITTER_EMAIL=committer@example.com", "GIT_COMMITTER_DATE=1476600000 +0200")
+	out, err := cmd.CombinedOutput()
+	s.NoError(err, string(out))
+	return string(bytes.TrimSpace(out))
+}
+
+func (s *nomsGitTestSuite) write(name, contents string, mode os.FileMode) {
+	path := filepath.Join(s.repo, name)
+	s.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.NoError(ioutil.WriteFile(path, []byte(contents), mode))
+	s.NoError(os.Chmod(path, mode))
+}
+
+func (s *nomsGitTestSuite) TestImport() {
+	s.repo = filepath.Join(s.TempDir, "repo")
+	s.NoError(os.Mkdir(s.repo, 0755))
+	s.git("init", "-q")
+	s.write("README", "hello\n", 0644)
+	s.write("bin/run", "#!/bin/sh\n", 0755)
+	s.NoError(os.Symlink("README", filepath.Join(s.repo, "LINK")))
+	s.git("add", ".")
+	s.git("commit", "-q", "-m", "first")
+	first := s.git("rev-parse", "HEAD")
+	s.git("checkout", "-q", "-b", "side")
+	s.write("side.txt", "side\n", 0644)
+	s.git("add", ".")
+	s.git("commit", "-q", "-m", "side")
+	s.git("checkout", "-q", "-")
+	s.write("README", "hello again\n", 0644)
+	s.git("commit", "-q", "-am", "second")
+	s.git("merge", "-q", "--no-edit", "side")
+
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	out, _ := s.MustRun(main, []string{"git", "import", "--quiet", s.repo, dbSpec + "::git"})
+	s.Equal("", out)
+
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	head := db.GetDataset("git").Head()
+	s.Equal(uint64(2), head.Get(datas.ParentsField).(types.Set).Len())
+	meta := head.Get(datas.MetaField).(types.Struct)
+	s.Equal(types.String(s.git("rev-parse", "HEAD")), meta.Get("gitHash"))
+	s.Equal(types.String("A U Thor"), meta.Get("author"))
+	s.Equal(types.String("committer@example.com"), meta.Get("committerEmail"))
+	s.Equal(types.String("2016-10-16T08:40:00+0200"), meta.Get("date"))
+	s.Equal(types.String("Merge branch 'side'\n"), meta.Get("message"))
+
+	tree := head.Get(datas.ValueField).(types.Map)
+	s.Equal(uint64(4), tree.Len())
+	s.True(types.NewBlob(bytes.NewBufferString("hello again\n")).Equals(tree.Get(types.String("README"))))
+	s.True(types.NewStruct("Symlink", types.StructData{"target": types.String("README")}).Equals(tree.Get(types.String("LINK"))))
+	run := tree.Get(types.String("bin")).(types.Map).Get(types.String("run")).(types.Struct)
+	s.Equal("Executable", run.Type().Desc.(types.StructDesc).Name)
+	s.True(types.NewBlob(bytes.NewBufferString("#!/bin/sh\n")).Equals(run.Get("data")))
+	s.True(tree.Has(types.String("side.txt")))
+	db.Close()
+
+	// Importing again only imports new commits, and importing from elsewhere in the history is refused.
+	s.write("new", "new\n", 0644)
+	s.git("add", ".")
+	s.git("commit", "-q", "-m", "third")
+	out, _ = s.MustRun(main, []string{"git", "import", s.repo, dbSpec + "::git"})
+	s.Contains(out, "Imported 1 commits to "+dbSpec+"::git, head #")
+	_, _, recovered := s.Run(main, []string{"git", "import", "--rev", first, s.repo, dbSpec + "::git"})
+	s.NotNil(recovered)
+
+	db, err = spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	defer db.Close()
+	s.True(db.GetDataset("git").HeadValue().(types.Map).Has(types.String("new")))
+}
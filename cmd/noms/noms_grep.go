@@ -0,0 +1,201 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"sync"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	grepFields     bool
+	grepIgnoreCase bool
+	grepMaxDepth   int
+	grepParallel   int
+)
+
+var nomsGrep = &util.Command{
+	Run:       runGrep,
+	UsageLine: "grep [options] <pattern> <object>",
+	Short:     "Searches the strings in a Noms object for a regular expression",
+	Long: `Walks the object, and everything it refers to, printing the path of each String that matches the regular expression <pattern>, and the String. Strings are found wherever they are: in struct fields, lists, sets, and the keys and values of maps. With --fields, struct fields whose names match are printed too, with their values, or for collections, structs and Blobs, their types.
+
+Paths are relative to the object, e.g. .people[3].name, or to the value a Ref refers to, e.g. #<hash>.name, which can be shown with noms show <database>::#<hash>.name. Each chunk is only searched once, so a String that's in several places may be printed for just one of them. The search follows Refs, including the parents of commits, so searching a dataset searches all its history; search its .value to just search its head. --max-depth limits how many Refs deep the search goes, and --parallel is how many chunks are loaded and searched at once, in which case matches are printed in no particular order.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object argument.`,
+	Flags: setupGrepFlags,
+	Nargs: 2,
+}
+
+func setupGrepFlags() *flag.FlagSet {
+	grepFlagSet := flag.NewFlagSet("grep", flag.ExitOnError)
+	grepFlagSet.BoolVar(&grepFields, "fields", false, "also search the names of struct fields")
+	grepFlagSet.BoolVar(&grepIgnoreCase, "ignore-case", false, "match without regard to case")
+	grepFlagSet.IntVar(&grepMaxDepth, "max-depth", 0, "how many refs deep to search, or 0 for all of them")
+	grepFlagSet.IntVar(&grepParallel, "parallel", runtime.NumCPU(), "how many chunks to load and search at once")
+	verbose.RegisterVerboseFlags(grepFlagSet)
+	return grepFlagSet
+}
+
+func runGrep(args []string) int {
+	pattern := args[0]
+	if grepIgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	d.CheckError(err)
+	if grepMaxDepth < 0 {
+		d.CheckError(fmt.Errorf("--max-depth must not be negative"))
+	}
+	if grepParallel < 1 {
+		d.CheckError(fmt.Errorf("--parallel must be at least 1"))
+	}
+
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(args[1])
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+	if value == nil {
+		fmt.Fprintf(os.Stderr, "Object not found: %s\n", args[1])
+		return 0
+	}
+
+	g := newGrepper(re, db, os.Stdout)
+	g.search("", value, 0)
+	g.wg.Wait()
+	return 0
+}
+
+// grepper searches values for Strings, and optionally struct field names, matching a regular expression, and prints where it finds them.
+type grepper struct {
+	re  *regexp.Regexp
+	vr  types.ValueReader
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu      sync.Mutex
+	out     io.Writer
+	visited map[hash.Hash]bool
+}
+
+func newGrepper(re *regexp.Regexp, vr types.ValueReader, out io.Writer) *grepper {
+	return &grepper{re: re, vr: vr, sem: make(chan struct{}, grepParallel-1), out: out, visited: map[hash.Hash]bool{}}
+}
+
+// match prints a match of |v| at |path|. Values that aren't primitives, which fields whose names match can have, are summarized by their types, rather than read in full.
+func (g *grepper) match(path string, v types.Value) {
+	summary := v.Type().Describe()
+	if k := v.Type().Kind(); types.IsPrimitiveKind(k) && k != types.BlobKind {
+		summary = types.EncodedValue(v)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(g.out, "%s: %s\n", path, summary)
+}
+
+// search searches |v|, which is at |path|, |depth| Refs from where the search started.
+func (g *grepper) search(path string, v types.Value, depth int) {
+	switch v := v.(type) {
+	case types.String:
+		if g.re.MatchString(string(v)) {
+			g.match(path, v)
+		}
+	case types.Struct:
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, _ *types.Type) {
+			fieldPath := path + types.NewFieldPath(name).String()
+			fv := v.Get(name)
+			if grepFields && g.re.MatchString(name) {
+				g.match(fieldPath, fv)
+			}
+			g.search(fieldPath, fv, depth)
+		})
+	case types.List:
+		v.IterAll(func(ev types.Value, i uint64) {
+			g.search(fmt.Sprintf("%s[%d]", path, i), ev, depth)
+		})
+	case types.Tuple:
+		v.IterAll(func(ev types.Value, i uint64) {
+			g.search(fmt.Sprintf("%s[%d]", path, i), ev, depth)
+		})
+	case types.Set:
+		v.IterAll(func(ev types.Value) {
+			g.search(path+indexPath(ev, false), ev, depth)
+		})
+	case types.Map:
+		v.IterAll(func(k, mv types.Value) {
+			g.search(path+indexPath(k, true), k, depth)
+			g.search(path+indexPath(k, false), mv, depth)
+		})
+	case types.Ref:
+		g.searchRef(v, depth+1)
+	case types.Blob, types.Bool, types.Number, *types.Type:
+	default:
+		v.WalkValues(func(cv types.Value) {
+			g.search(path, cv, depth)
+		})
+	}
+}
+
+// indexPath returns the path of an element of a Set or a Map, or with |intoKey|, the key of a Map entry. Elements and keys that aren't primitives are spelled by their hashes.
+func indexPath(k types.Value, intoKey bool) string {
+	switch k.(type) {
+	case types.String, types.Bool, types.Number:
+		if intoKey {
+			return types.NewIndexIntoKeyPath(k).String()
+		}
+		return types.NewIndexPath(k).String()
+	}
+	if intoKey {
+		return types.NewHashIndexIntoKeyPath(k.Hash()).String()
+	}
+	return types.NewHashIndexPath(k.Hash()).String()
+}
+
+// searchRef searches the target of |r|, unless it's already been searched or it's too deep, on another goroutine if one's free.
+func (g *grepper) searchRef(r types.Ref, depth int) {
+	if grepMaxDepth > 0 && depth > grepMaxDepth {
+		return
+	}
+	target := r.TargetHash()
+	g.mu.Lock()
+	seen := g.visited[target]
+	g.visited[target] = true
+	g.mu.Unlock()
+	if seen {
+		return
+	}
+
+	load := func() {
+		v := g.vr.ReadValue(target)
+		d.PanicIfTrue(v == nil, "Ref to missing chunk #%s", target.String())
+		g.search("#"+target.String(), v, depth)
+	}
+	select {
+	case g.sem <- struct{}{}:
+		g.wg.Add(1)
+		go func() {
+			defer func() {
+				<-g.sem
+				g.wg.Done()
+			}()
+			load()
+		}()
+	default:
+		// All the goroutines are busy, so search it on this one rather than waiting.
+		load()
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestGrep(t *testing.T) {
+	suite.Run(t, &nomsGrepTestSuite{})
+}
+
+type nomsGrepTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// setup commits a value which has Strings in every kind of place, and a Ref to a List of more, and returns the spec of its dataset and the hash of the List.
+func (s *nomsGrepTestSuite) setup(dsName string) (string, string) {
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, dsName)
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+
+	nested := types.NewList(types.String("apple pie"), types.String("banana"))
+	ref := db.WriteValue(nested)
+	deeper := db.WriteValue(types.NewList(db.WriteValue(types.NewList(types.String("cherry")))))
+	key := types.NewStruct("Key", types.StructData{"fruit": types.String("apple")})
+	_, err = db.CommitValue(ds, types.NewStruct("Basket", types.StructData{
+		"name":    types.String("Apple basket"),
+		"count":   types.Number(3),
+		"tags":    types.NewSet(types.String("apple"), types.String("red")),
+		"prices":  types.NewMap(types.String("apple"), types.String("cheap"), key, types.String("apple tart")),
+		"nested":  ref,
+		"appleID": types.String("x"),
+		"deeper":  deeper,
+	}))
+	s.NoError(err)
+	return dsSpec, ref.TargetHash().String()
+}
+
+func (s *nomsGrepTestSuite) grep(args ...string) []string {
+	out, _ := s.MustRun(main, append([]string{"grep"}, args...))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if lines[0] == "" {
+		return []string{}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func (s *nomsGrepTestSuite) TestGrep() {
+	dsSpec, nested := s.setup("grep")
+	keyHash := types.NewStruct("Key", types.StructData{"fruit": types.String("apple")}).Hash().String()
+
+	s.Equal([]string{
+		"#" + nested + "[0]: \"apple pie\"",
+		`.prices["apple"]@key: "apple"`,
+		".prices[#" + keyHash + "]: \"apple tart\"",
+		".prices[#" + keyHash + "]@key.fruit: \"apple\"",
+		`.tags["apple"]: "apple"`,
+	}, s.grep("^apple", dsSpec+".value"))
+
+	s.Equal([]string{
+		`.name: "Apple basket"`,
+	}, s.grep("--ignore-case", "--parallel", "1", "basket$", dsSpec+".value"))
+
+	s.Equal([]string{
+		`.appleID: "x"`,
+		`.tags: Set<String>`,
+	}, s.grep("--fields", "^(appleID|tags)$", dsSpec+".value"))
+
+	// "cherry" is two Refs deep.
+	s.Equal([]string{}, s.grep("--max-depth", "1", "cherry", dsSpec+".value"))
+	s.Len(s.grep("--max-depth", "2", "cherry", dsSpec+".value"), 1)
+	s.Equal([]string{}, s.grep("banana", dsSpec+".value.tags"))
+}
+
+func (s *nomsGrepTestSuite) TestGrepHistory() {
+	s.setup("history")
+	dsSpec, nested := s.setup("history")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	first := ds.Head().Get("parents").(types.Set).First().(types.Ref).TargetHash().String()
+	db.Close()
+
+	// Searching the dataset searches its history too, but Refs to the same value are only followed once.
+	s.Equal([]string{"#" + nested + "[1]: \"banana\""}, s.grep("banana", dsSpec))
+	s.Equal([]string{
+		"#" + first + ".value.name: \"Apple basket\"",
+		`.value.name: "Apple basket"`,
+	}, s.grep("Apple basket", dsSpec))
+}
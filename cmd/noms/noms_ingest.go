@@ -0,0 +1,310 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/jsontonoms"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+const (
+	// ingestOffsetField is the field of the meta of the commits noms ingest makes holding how many bytes of its input had been read.
+	ingestOffsetField = "ingestOffset"
+	// ingestOffsetsField is the field of the meta of the commits noms ingest makes holding, with --offset-field, a Map from the partitions of the records it's read to the offset of the last one of each.
+	ingestOffsetsField = "ingestOffsets"
+)
+
+var (
+	ingestInterval       time.Duration
+	ingestBatchSize      int
+	ingestKey            string
+	ingestOffsetName     string
+	ingestPartitionName  string
+	ingestFollow         bool
+	ingestFollowInterval = 250 * time.Millisecond
+)
+
+var nomsIngest = &util.Command{
+	Run:       runIngest,
+	UsageLine: "ingest [options] <file|-> <dataset>",
+	Short:     "Continuously commits records read from a stream to a dataset",
+	Long: `ingest reads records as JSON Lines, a JSON value on each line, from a file, or stdin if it's -, and commits them to a dataset in batches, every --interval, or once --batch-size records have been read, and when the input ends. Records are converted as by noms json import, and appended to the List at the head of the dataset, or with --key, set in the Map at its head, by the value of the field --key names, so that later records for the same key replace earlier ones, as change data capture needs. With --follow, the file is read as it grows, like tail -f, until ingest is interrupted.
+
+Each commit's meta records where in the input its last record was, so that ingest can be restarted without records being lost or committed twice: in ingestOffset, how many bytes of the input had been read, which are skipped when ingest is restarted with the same input, or with --offset-field, in ingestOffsets, the offset of the last record of each partition, as given by the fields --offset-field and --partition-field of the records, and records at or before those offsets are skipped.
+
+To consume a Kafka topic, pipe the output of a consumer that writes each message with its partition and offset as JSON into ingest, e.g.
+
+  kcat -C -b <broker> -t <topic> -J | noms ingest --offset-field offset --partition-field partition - <dataset>
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset argument.`,
+	Flags: setupIngestFlags,
+	Nargs: 2,
+}
+
+func setupIngestFlags() *flag.FlagSet {
+	ingestFlagSet := flag.NewFlagSet("ingest", flag.ExitOnError)
+	ingestFlagSet.DurationVar(&ingestInterval, "interval", 10*time.Second, "how often to commit the records read since the last commit")
+	ingestFlagSet.IntVar(&ingestBatchSize, "batch-size", 10000, "how many records to read before committing them, however long it's been")
+	ingestFlagSet.StringVar(&ingestKey, "key", "", "if set, the field of each record to set it in a Map by")
+	ingestFlagSet.StringVar(&ingestOffsetName, "offset-field", "", "if set, the field of each record holding its offset in its partition, which is checkpointed instead of the bytes read")
+	ingestFlagSet.StringVar(&ingestPartitionName, "partition-field", "", "with --offset-field, the field of each record holding its partition")
+	ingestFlagSet.BoolVar(&ingestFollow, "follow", false, "keep reading the file as it grows")
+	spec.RegisterCommitMetaFlags(ingestFlagSet)
+	verbose.RegisterVerboseFlags(ingestFlagSet)
+	return ingestFlagSet
+}
+
+func runIngest(args []string) int {
+	file, dsSpec := args[0], args[1]
+	if ingestInterval <= 0 || ingestBatchSize <= 0 {
+		d.CheckError(fmt.Errorf("--interval and --batch-size must be positive"))
+	}
+	if ingestPartitionName != "" && ingestOffsetName == "" {
+		d.CheckError(fmt.Errorf("--partition-field needs --offset-field"))
+	}
+	if ingestFollow && file == "-" {
+		d.CheckError(fmt.Errorf("--follow can't be used with stdin"))
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	ing, err := newIngester(db, ds, file)
+	d.CheckErrorNoUsage(err)
+
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		in = f
+	}
+	if ing.offset > 0 && ingestOffsetName == "" {
+		if f, ok := in.(*os.File); ok && file != "-" {
+			_, err = f.Seek(int64(ing.offset), 0)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, in, int64(ing.offset))
+		}
+		d.CheckErrorNoUsage(err)
+	}
+
+	// Interrupting ingest commits what it's read before it exits.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	records, recordsErr := readRecords(in, ing.offset)
+	d.CheckErrorNoUsage(ing.run(records, recordsErr, stop))
+	fmt.Printf("Ingested %d records into %s in %d commits\n", ing.ingested, dsSpec, ing.commits)
+	return 0
+}
+
+// ingestRecord is a line of the input of noms ingest, and the offset in the input of the end of it.
+type ingestRecord struct {
+	line []byte
+	end  uint64
+}
+
+// readRecords returns a channel of the lines of |in|, which starts at |offset| in the input, and a function returning the error that ended them, if there was one. With --follow, reading carries on at the end of in.
+func readRecords(in io.Reader, offset uint64) (<-chan ingestRecord, func() error) {
+	records := make(chan ingestRecord, 64)
+	var err error
+	go func() {
+		defer close(records)
+		r := bufio.NewReader(in)
+		partial := []byte{}
+		for {
+			line, rerr := r.ReadBytes('\n')
+			partial = append(partial, line...)
+			if rerr == io.EOF && ingestFollow {
+				time.Sleep(ingestFollowInterval)
+				continue
+			}
+			if rerr != nil && rerr != io.EOF {
+				err = rerr
+				return
+			}
+			offset += uint64(len(partial))
+			if len(bytes.TrimSpace(partial)) > 0 {
+				records <- ingestRecord{partial, offset}
+			}
+			partial = []byte{}
+			if rerr == io.EOF {
+				return
+			}
+		}
+	}()
+	return records, func() error { return err }
+}
+
+// ingester commits the records of noms ingest to a dataset.
+type ingester struct {
+	db   datas.Database
+	ds   datas.Dataset
+	file string
+	opts jsontonoms.Options
+
+	list types.List
+	m    types.Map
+	// offset is how many bytes of the input have been read, and offsets the offset of the last record of each partition.
+	offset  uint64
+	offsets types.Map
+
+	pending, ingested, commits int
+}
+
+// newIngester returns an ingester which carries on from the checkpoint of the head of |ds|, if it has one.
+func newIngester(db datas.Database, ds datas.Dataset, file string) (*ingester, error) {
+	ing := &ingester{db: db, ds: ds, file: file, opts: jsontonoms.Options{Structs: true}, list: types.NewList(), m: types.NewMap(), offsets: types.NewMap()}
+	head, ok := ds.MaybeHead()
+	if !ok {
+		return ing, nil
+	}
+	v := head.Get(datas.ValueField)
+	if ingestKey == "" {
+		if ing.list, ok = v.(types.List); !ok {
+			return nil, fmt.Errorf("The head of the dataset is a %s, not a List", v.Type().Describe())
+		}
+	} else if ing.m, ok = v.(types.Map); !ok {
+		return nil, fmt.Errorf("The head of the dataset is a %s, not a Map", v.Type().Describe())
+	}
+	if meta, ok := head.Get(datas.MetaField).(types.Struct); ok {
+		if n, ok := meta.MaybeGet(ingestOffsetField); ok {
+			ing.offset = uint64(n.(types.Number))
+		}
+		if m, ok := meta.MaybeGet(ingestOffsetsField); ok {
+			ing.offsets = m.(types.Map)
+		}
+	}
+	return ing, nil
+}
+
+// run ingests |records|, committing them every --interval and --batch-size, until they end, or until there's a signal on |stop|.
+func (ing *ingester) run(records <-chan ingestRecord, recordsErr func() error, stop <-chan os.Signal) error {
+	ticker := time.NewTicker(ingestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				if err := ing.commit(); err != nil {
+					return err
+				}
+				return recordsErr()
+			}
+			if err := ing.add(rec); err != nil {
+				return err
+			}
+			if ing.pending >= ingestBatchSize {
+				if err := ing.commit(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := ing.commit(); err != nil {
+				return err
+			}
+		case <-stop:
+			return ing.commit()
+		}
+	}
+}
+
+// field returns the field |name| of the record |v|, which is a struct, as jsontonoms makes objects.
+func field(v types.Value, name string) (types.Value, bool) {
+	if s, ok := v.(types.Struct); ok {
+		return s.MaybeGet(name)
+	}
+	return nil, false
+}
+
+func (ing *ingester) add(rec ingestRecord) error {
+	ing.offset = rec.end
+	dec := json.NewDecoder(bytes.NewReader(rec.line))
+	dec.UseNumber()
+	var o interface{}
+	if err := dec.Decode(&o); err != nil {
+		return fmt.Errorf("Record ending at byte %d: %s", rec.end, err)
+	}
+	v, err := jsontonoms.NomsValueFromJSON(o, ing.opts)
+	if err != nil || v == nil {
+		return fmt.Errorf("Record ending at byte %d: %v", rec.end, err)
+	}
+
+	if ingestOffsetName != "" {
+		offset, ok := field(v, ingestOffsetName)
+		if _, isNumber := offset.(types.Number); !ok || !isNumber {
+			return fmt.Errorf("Record ending at byte %d has no number in %s", rec.end, ingestOffsetName)
+		}
+		var partition types.Value = types.String("")
+		if ingestPartitionName != "" {
+			if partition, ok = field(v, ingestPartitionName); !ok {
+				return fmt.Errorf("Record ending at byte %d has no %s", rec.end, ingestPartitionName)
+			}
+		}
+		if last, ok := ing.offsets.MaybeGet(partition); ok && !last.Less(offset) {
+			// It was committed before ingest was restarted.
+			return nil
+		}
+		ing.offsets = ing.offsets.Set(partition, offset)
+	}
+
+	if ingestKey != "" {
+		k, ok := field(v, ingestKey)
+		if !ok {
+			return fmt.Errorf("Record ending at byte %d has no %s", rec.end, ingestKey)
+		}
+		ing.m = ing.m.Set(k, v)
+	} else {
+		ing.list = ing.list.Append(v)
+	}
+	ing.pending++
+	return nil
+}
+
+// commit commits the records added since the last commit, if there are any, together with the checkpoint of where they end.
+func (ing *ingester) commit() error {
+	if ing.pending == 0 {
+		return nil
+	}
+	checkpoint := map[string]types.Value{ingestOffsetField: types.Number(ing.offset)}
+	if ingestOffsetName != "" {
+		checkpoint = map[string]types.Value{ingestOffsetsField: ing.offsets}
+	}
+	meta, err := spec.CreateCommitMetaStruct(ing.db, "", "", map[string]string{"inputFile": ing.file}, checkpoint)
+	if err != nil {
+		return err
+	}
+	var v types.Value = ing.list
+	if ingestKey != "" {
+		v = ing.m
+	}
+	if ing.ds, err = ing.db.Commit(ing.ds, v, datas.CommitOptions{Meta: meta}); err != nil {
+		return err
+	}
+	ing.ingested += ing.pending
+	ing.pending = 0
+	ing.commits++
+	return nil
+}
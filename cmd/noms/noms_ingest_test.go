@@ -0,0 +1,115 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestNomsIngest(t *testing.T) {
+	suite.Run(t, &nomsIngestTestSuite{})
+}
+
+type nomsIngestTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsIngestTestSuite) appendLines(file string, lines ...string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	s.NoError(err)
+	defer f.Close()
+	for _, l := range lines {
+		_, err = f.WriteString(l + "\n")
+		s.NoError(err)
+	}
+}
+
+func (s *nomsIngestTestSuite) head(dsSpec string) types.Struct {
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	return ds.Head()
+}
+
+func (s *nomsIngestTestSuite) TestIngestList() {
+	file := filepath.Join(s.TempDir, "events.jsonl")
+	s.appendLines(file, `{"n": 1}`, `{"n": 2}`, ``, `{"n": 3}`)
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "events")
+
+	out, _ := s.MustRun(main, []string{"ingest", "--batch-size", "2", file, dsSpec})
+	s.Equal("Ingested 3 records into "+dsSpec+" in 2 commits\n", out)
+	head := s.head(dsSpec)
+	s.Equal(uint64(3), head.Get(datas.ValueField).(types.List).Len())
+	fi, err := os.Stat(file)
+	s.NoError(err)
+	s.Equal(types.Number(fi.Size()), head.Get(datas.MetaField).(types.Struct).Get(ingestOffsetField))
+
+	// Restarting carries on where the last commit left off.
+	s.appendLines(file, `{"n": 4}`, `{"n": 5}`)
+	out, _ = s.MustRun(main, []string{"ingest", file, dsSpec})
+	s.Equal("Ingested 2 records into "+dsSpec+" in 1 commits\n", out)
+	list := s.head(dsSpec).Get(datas.ValueField).(types.List)
+	s.Equal(uint64(5), list.Len())
+	for i := uint64(0); i < 5; i++ {
+		s.Equal(types.Number(i+1), list.Get(i).(types.Struct).Get("n"))
+	}
+
+	// So does reading the same input from stdin.
+	s.appendLines(file, `{"n": 6}`)
+	in, err := os.Open(file)
+	s.NoError(err)
+	defer in.Close()
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+	os.Stdin = in
+	out, _ = s.MustRun(main, []string{"ingest", "-", dsSpec})
+	s.Equal("Ingested 1 records into "+dsSpec+" in 1 commits\n", out)
+
+	bad := filepath.Join(s.TempDir, "bad.jsonl")
+	s.NoError(ioutil.WriteFile(bad, []byte("{\"n\": 1}\n{nope\n"), 0644))
+	_, _, recovered := s.Run(main, []string{"ingest", bad, spec.CreateValueSpecString("ldb", s.LdbDir, "bad")})
+	s.NotNil(recovered)
+}
+
+func (s *nomsIngestTestSuite) TestIngestKeyAndOffsets() {
+	file := filepath.Join(s.TempDir, "changes.jsonl")
+	s.appendLines(file,
+		`{"partition": 0, "offset": 10, "id": "a", "v": 1}`,
+		`{"partition": 1, "offset": 10, "id": "b", "v": 1}`,
+		`{"partition": 0, "offset": 11, "id": "a", "v": 2}`)
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "changes")
+	args := []string{"ingest", "--key", "id", "--offset-field", "offset", "--partition-field", "partition", file, dsSpec}
+
+	s.MustRun(main, args)
+	head := s.head(dsSpec)
+	m := head.Get(datas.ValueField).(types.Map)
+	s.Equal(uint64(2), m.Len())
+	s.Equal(types.Number(2), m.Get(types.String("a")).(types.Struct).Get("v"))
+	offsets := head.Get(datas.MetaField).(types.Struct).Get(ingestOffsetsField).(types.Map)
+	s.True(types.NewMap(types.Number(0), types.Number(11), types.Number(1), types.Number(10)).Equals(offsets))
+
+	// A consumer restarted from earlier offsets replays records that have been committed, which are skipped.
+	s.NoError(os.Remove(file))
+	s.appendLines(file,
+		`{"partition": 0, "offset": 11, "id": "a", "v": 2}`,
+		`{"partition": 1, "offset": 10, "id": "b", "v": 1}`,
+		`{"partition": 1, "offset": 11, "id": "b", "v": 3}`)
+	out, _ := s.MustRun(main, args)
+	s.Equal("Ingested 1 records into "+dsSpec+" in 1 commits\n", out)
+	m = s.head(dsSpec).Get(datas.ValueField).(types.Map)
+	s.Equal(types.Number(3), m.Get(types.String("b")).(types.Struct).Get("v"))
+
+	// The head must be what ingest makes.
+	_, _, recovered := s.Run(main, []string{"ingest", file, dsSpec})
+	s.NotNil(recovered)
+}
@@ -0,0 +1,191 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/jsontonoms"
+	"github.com/stormasm/noms/go/util/progressreader"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	jsonMaps       bool
+	jsonStructName string
+	jsonNumbers    string
+	jsonLines      bool
+	jsonQuiet      bool
+	jsonSpill      bool
+)
+
+var jsonNumberModes = map[string]jsontonoms.NumberMode{
+	"number": jsontonoms.NumbersAsNumber,
+	"exact":  jsontonoms.NumbersExact,
+	"string": jsontonoms.NumbersAsString,
+}
+
+var nomsJson = &util.Command{
+	Run:       runJson,
+	UsageLine: "json import [options] <file|-> <dataset>",
+	Short:     "Imports JSON and JSON Lines files into datasets",
+	Long: `import reads a JSON file, or stdin if it's -, and commits it to a dataset, with the name of the file in the commit's meta. Arrays become Lists, and objects become structs, with a field for each key, or with --maps, Maps from String keys to their values. Nulls are left out.
+
+With --lines, which is the default for files named *.jsonl or *.ndjson, the file is JSON Lines, a JSON value on each line, and it's imported as a List of those values, converted as they're read, so it can be much bigger than memory. With --spill, the List is built in a temporary database on local disk, and only copied into the dataset's database once it's complete, so that a remote database isn't sent anything until then, and nothing is left in it if the import fails.
+
+--numbers says how numbers are imported: as the nearest Number, the default; exact, as Numbers, failing if any number can't be represented exactly, e.g. an integer above 2^53; or string, as Strings of the numbers as they're written in the file.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset argument.`,
+	Flags: setupJsonFlags,
+	Nargs: 3,
+}
+
+func setupJsonFlags() *flag.FlagSet {
+	jsonFlagSet := flag.NewFlagSet("json", flag.ExitOnError)
+	jsonFlagSet.BoolVar(&jsonMaps, "maps", false, "import objects as Maps rather than structs")
+	jsonFlagSet.StringVar(&jsonStructName, "struct-name", "", "name of the structs objects are imported as")
+	jsonFlagSet.StringVar(&jsonNumbers, "numbers", "number", "how to import numbers: number, exact or string")
+	jsonFlagSet.BoolVar(&jsonLines, "lines", false, "the file is JSON Lines, one value per line")
+	jsonFlagSet.BoolVar(&jsonQuiet, "quiet", false, "silence progress output")
+	jsonFlagSet.BoolVar(&jsonSpill, "spill", false, "with --lines, build the List on local disk and copy it into the database once it's complete")
+	spec.RegisterCommitMetaFlags(jsonFlagSet)
+	verbose.RegisterVerboseFlags(jsonFlagSet)
+	return jsonFlagSet
+}
+
+func runJson(args []string) int {
+	if args[0] != "import" {
+		d.CheckError(fmt.Errorf("Unknown json subcommand %s", args[0]))
+	}
+	file, dsSpec := args[1], args[2]
+	mode, ok := jsonNumberModes[jsonNumbers]
+	if !ok {
+		d.CheckError(fmt.Errorf("Invalid --numbers %s, must be number, exact or string", jsonNumbers))
+	}
+	if jsonMaps && jsonStructName != "" {
+		d.CheckError(fmt.Errorf("--struct-name can't be used with --maps"))
+	}
+	opts := jsontonoms.Options{Structs: !jsonMaps, StructName: jsonStructName, Numbers: mode}
+	lines := jsonLines
+	if ext := filepath.Ext(file); ext == ".jsonl" || ext == ".ndjson" {
+		lines = true
+	}
+
+	var in io.Reader = os.Stdin
+	size := int64(-1)
+	if file != "-" {
+		f, err := os.Open(file)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		fi, err := f.Stat()
+		d.CheckErrorNoUsage(err)
+		in, size = f, fi.Size()
+	}
+	if !jsonQuiet {
+		in = progressreader.New(in, readProgress(size))
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+	var value types.Value
+	var spill *datas.Spill
+	format := "json"
+	if lines {
+		format = "jsonl"
+		var vrw types.ValueReadWriter = db
+		if jsonSpill {
+			spill, err = datas.NewSpill()
+			d.CheckErrorNoUsage(err)
+			defer spill.Close()
+			vrw = spill
+		}
+		value, err = importJsonLines(vrw, dec, opts)
+	} else {
+		value, err = importJson(dec, opts)
+	}
+	if !jsonQuiet {
+		status.Done()
+	}
+	d.CheckErrorNoUsage(err)
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", map[string]string{"inputFile": file, "format": format}, nil)
+	d.CheckErrorNoUsage(err)
+	if spill != nil {
+		ds, err = spill.CommitTo(db, ds, value, datas.CommitOptions{Meta: meta})
+	} else {
+		ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	}
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Imported %s into %s, new head #%s\n", file, dsSpec, ds.HeadRef().TargetHash().String())
+	return 0
+}
+
+func importJson(dec *json.Decoder, opts jsontonoms.Options) (types.Value, error) {
+	var o interface{}
+	if err := dec.Decode(&o); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("No JSON to import")
+		}
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("There's more than one JSON value, use --lines to import them as a List")
+	}
+	v, err := jsontonoms.NomsValueFromJSON(o, opts)
+	if err == nil && v == nil {
+		err = fmt.Errorf("Can't import null")
+	}
+	return v, err
+}
+
+// importJsonLines converts the values |dec| reads into a List as they're read, so that only the List's unwritten chunks are kept in memory.
+func importJsonLines(vrw types.ValueReadWriter, dec *json.Decoder, opts jsontonoms.Options) (types.Value, error) {
+	values := make(chan types.Value, 16)
+	list := types.NewStreamingList(vrw, values)
+	defer func() {
+		if values != nil {
+			close(values)
+			<-list
+		}
+	}()
+
+	for line := 1; ; line++ {
+		var o interface{}
+		err := dec.Decode(&o)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Value %d: %s", line, err)
+		}
+		v, err := jsontonoms.NomsValueFromJSON(o, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Value %d: %s", line, err)
+		}
+		if v != nil {
+			values <- v
+		}
+	}
+	close(values)
+	values = nil
+	return <-list, nil
+}
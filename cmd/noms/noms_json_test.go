@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestJson(t *testing.T) {
+	suite.Run(t, &nomsJsonTestSuite{})
+}
+
+type nomsJsonTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsJsonTestSuite) writeJson(name, data string) string {
+	file := filepath.Join(s.TempDir, name)
+	s.NoError(ioutil.WriteFile(file, []byte(data), 0644))
+	return file
+}
+
+func (s *nomsJsonTestSuite) headValue(dsSpec string) (types.Value, types.Struct) {
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	return ds.HeadValue(), ds.Head().Get(datas.MetaField).(types.Struct)
+}
+
+func (s *nomsJsonTestSuite) TestImport() {
+	file := s.writeJson("in.json", `{"name": "alice", "tags": ["a", "b"], "age": 30, "spouse": null}`)
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "json"), "people")
+
+	out, _ := s.MustRun(main, []string{"json", "import", "--quiet", "--struct-name", "Person", file, dsSpec})
+	s.Contains(out, "Imported "+file+" into "+dsSpec+", new head #")
+
+	v, meta := s.headValue(dsSpec)
+	s.True(types.NewStruct("Person", types.StructData{
+		"name": types.String("alice"),
+		"tags": types.NewList(types.String("a"), types.String("b")),
+		"age":  types.Number(30),
+	}).Equals(v))
+	s.Equal(types.String(file), meta.Get("inputFile"))
+	s.Equal(types.String("json"), meta.Get("format"))
+
+	s.MustRun(main, []string{"json", "import", "--quiet", "--maps", "--numbers", "string", file, dsSpec})
+	v, _ = s.headValue(dsSpec)
+	s.True(types.NewMap(
+		types.String("name"), types.String("alice"),
+		types.String("tags"), types.NewList(types.String("a"), types.String("b")),
+		types.String("age"), types.String("30"),
+	).Equals(v))
+}
+
+func (s *nomsJsonTestSuite) TestImportLines() {
+	file := s.writeJson("in.jsonl", "{\"n\": 1}\n{\"n\": 2}\n\n{\"n\": 3}\n")
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "jsonl"), "rows")
+
+	s.MustRun(main, []string{"json", "import", "--quiet", "--maps", file, dsSpec})
+
+	v, meta := s.headValue(dsSpec)
+	l := v.(types.List)
+	s.Equal(uint64(3), l.Len())
+	s.True(types.NewMap(types.String("n"), types.Number(3)).Equals(l.Get(2)))
+	s.Equal(types.String("jsonl"), meta.Get("format"))
+
+	s.MustRun(main, []string{"json", "import", "--quiet", "--maps", "--spill", file, dsSpec})
+	v, meta = s.headValue(dsSpec)
+	s.True(l.Equals(v))
+	s.Equal(types.String("jsonl"), meta.Get("format"))
+}
+
+func (s *nomsJsonTestSuite) TestImportErrors() {
+	dsSpec := spec.CreateValueSpecString("ldb", filepath.Join(s.LdbDir, "errors"), "ds")
+
+	file := s.writeJson("two.json", "1\n2\n")
+	_, stderr, recovered := s.Run(main, []string{"json", "import", "--quiet", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "There's more than one JSON value, use --lines")
+
+	file = s.writeJson("big.json", "[1, 9007199254740993]")
+	_, stderr, recovered = s.Run(main, []string{"json", "import", "--quiet", "--numbers", "exact", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Number 9007199254740993 can't be represented exactly")
+
+	file = s.writeJson("bad.jsonl", "{}\n{\n")
+	_, stderr, recovered = s.Run(main, []string{"json", "import", "--quiet", file, dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Value 2: unexpected EOF")
+
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	_, ok := ds.MaybeHeadRef()
+	s.False(ok)
+}
@@ -10,17 +10,20 @@ import (
 	"io"
 	"math"
 	"strings"
+	"time"
 
 	"github.com/stormasm/noms/cmd/noms/diff"
 	"github.com/stormasm/noms/cmd/util"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/orderedparallel"
 	"github.com/stormasm/noms/go/util/outputpager"
 	"github.com/stormasm/noms/go/util/verbose"
 	"github.com/stormasm/noms/go/util/writers"
+	humanize "github.com/dustin/go-humanize"
 	flag "github.com/juju/gnuflag"
 	"github.com/mgutz/ansi"
 )
@@ -33,6 +36,10 @@ var (
 	oneline    bool
 	showGraph  bool
 	showValue  bool
+	showStat   bool
+	logSince   string
+	logUntil   string
+	logPath    string
 )
 
 const parallelism = 16
@@ -41,7 +48,7 @@ var nomsLog = &util.Command{
 	Run:       runLog,
 	UsageLine: "log [options] <commitObject>",
 	Short:     "Displays the history of a Noms dataset",
-	Long:      "commitObject must be a dataset or object spec that refers to a commit. See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details.",
+	Long:      "commitObject must be a dataset or object spec that refers to a commit. See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details.\n\nDates given to --since and --until are compared with the date in each commit's meta, and may be in RFC 3339 format, e.g. 2016-01-02T15:04:05Z, or just a date. Commits without a date are skipped if either is given.",
 	Flags:     setupLogFlags,
 	Nargs:     1,
 }
@@ -51,9 +58,14 @@ func setupLogFlags() *flag.FlagSet {
 	logFlagSet.IntVar(&color, "color", -1, "value of 1 forces color on, 0 forces color off")
 	logFlagSet.IntVar(&maxLines, "max-lines", 9, "max number of lines to show per commit (-1 for all lines)")
 	logFlagSet.IntVar(&maxCommits, "n", 0, "max number of commits to display (0 for all commits)")
+	logFlagSet.IntVar(&maxCommits, "max-count", 0, "same as -n")
+	logFlagSet.StringVar(&logSince, "since", "", "only show commits dated at or after this date")
+	logFlagSet.StringVar(&logUntil, "until", "", "only show commits dated at or before this date")
+	logFlagSet.StringVar(&logPath, "path", "", "only show commits that changed the value at this path within the commit's value, e.g. .foo[0]")
 	logFlagSet.BoolVar(&oneline, "oneline", false, "show a summary of each commit on a single line")
 	logFlagSet.BoolVar(&showGraph, "graph", false, "show ascii-based commit hierarchy on left side of output")
 	logFlagSet.BoolVar(&showValue, "show-value", false, "show commit value rather than diff information -- this is temporary")
+	logFlagSet.BoolVar(&showStat, "stat", false, "show how many values each commit added, removed and changed, and how many bytes of new and old chunks it's made of")
 	outputpager.RegisterOutputpagerFlags(logFlagSet)
 	verbose.RegisterVerboseFlags(logFlagSet)
 	return logFlagSet
@@ -78,6 +90,9 @@ func runLog(args []string) int {
 		d.CheckError(fmt.Errorf("%s does not reference a Commit object", args[0]))
 	}
 
+	filter, err := newCommitFilter(logSince, logUntil, logPath)
+	d.CheckErrorNoUsage(err)
+
 	iter := NewCommitIterator(database, origCommit)
 	displayed := 0
 	if maxCommits <= 0 {
@@ -95,6 +110,9 @@ func runLog(args []string) int {
 
 	go func() {
 		for ln, ok := iter.Next(); !done && ok && displayed < maxCommits; ln, ok = iter.Next() {
+			if !filter.matches(ln.commit, database) {
+				continue
+			}
 			inChan <- ln
 			displayed++
 		}
@@ -117,6 +135,55 @@ func runLog(args []string) int {
 	return 0
 }
 
+// commitFilter selects the commits that are shown, according to the --since, --until and --path flags.
+type commitFilter struct {
+	since, until time.Time
+	path         types.Path
+}
+
+func newCommitFilter(since, until, path string) (f commitFilter, err error) {
+	if since != "" {
+		if f.since, err = spec.ParseCommitMetaDate(since); err != nil {
+			return f, fmt.Errorf("Invalid --since date: %s", since)
+		}
+	}
+	if until != "" {
+		if f.until, err = spec.ParseCommitMetaDate(until); err != nil {
+			return f, fmt.Errorf("Invalid --until date: %s", until)
+		}
+	}
+	if path != "" {
+		if f.path, err = types.ParsePath(path); err != nil {
+			return f, fmt.Errorf("Invalid --path %s: %s", path, err)
+		}
+	}
+	return f, nil
+}
+
+// matches returns true if |commit| should be shown. With a path, that's if the value at the path differs from that in the commit's first parent, the same one its diff is shown against.
+func (f commitFilter) matches(commit types.Struct, db datas.Database) bool {
+	if !f.since.IsZero() || !f.until.IsZero() {
+		date, ok := spec.CommitMetaDate(commit)
+		if !ok || (!f.since.IsZero() && date.Before(f.since)) || (!f.until.IsZero() && date.After(f.until)) {
+			return false
+		}
+	}
+	if f.path != nil {
+		val := f.path.Resolve(commit.Get(datas.ValueField))
+		parents := commit.Get(datas.ParentsField).(types.Set)
+		if parents.Len() == 0 {
+			return val != nil
+		}
+		parentCommit := parents.First().(types.Ref).TargetValue(db).(types.Struct)
+		parentVal := f.path.Resolve(parentCommit.Get(datas.ValueField))
+		if val == nil || parentVal == nil {
+			return (val == nil) != (parentVal == nil)
+		}
+		return !val.Equals(parentVal)
+	}
+	return true
+}
+
 // Prints the information for one commit in the log, including ascii graph on left side of commits if
 // -graph arg is true.
 func printCommit(node LogNode, w io.Writer, db datas.Database) (err error) {
@@ -163,6 +230,10 @@ func printCommit(node LogNode, w io.Writer, db datas.Database) (err error) {
 	fmt.Fprintf(w, "%s%s\n", genGraph(node, 0), hashStr)
 	fmt.Fprintf(w, "%s%s\n", genGraph(node, 1), parentStr)
 	lineno := 1
+	if showStat && len(parents) > 0 {
+		lineno++
+		fmt.Fprintf(w, "%s%-*s %s\n", genGraph(node, lineno), maxFieldNameLen+1, "Stat:", commitStat(node.commit, parents[0], db))
+	}
 
 	if maxLines != 0 {
 		lineno, err = writeMetaLines(node, maxLines, lineno, maxFieldNameLen, w)
@@ -180,6 +251,19 @@ func printCommit(node LogNode, w io.Writer, db datas.Database) (err error) {
 	return
 }
 
+// commitStat summarizes the changes |commit| made to the value of its parent |parent|, as in "2 insertions, 0 deletions, 1 change, +1.2 kB, -40 B".
+func commitStat(commit types.Struct, parent types.Ref, db datas.Database) string {
+	parentCommit := parent.TargetValue(db).(types.Struct)
+	adds, removes, changes, bytesAdded, bytesRemoved := diff.Summary(parentCommit.Get(datas.ValueField), commit.Get(datas.ValueField), db)
+	pluralize := func(n uint64, singular, plural string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, singular)
+		}
+		return fmt.Sprintf("%s %s", humanize.Comma(int64(n)), plural)
+	}
+	return fmt.Sprintf("%s, %s, %s, +%s, -%s", pluralize(adds, "insertion", "insertions"), pluralize(removes, "deletion", "deletions"), pluralize(changes, "change", "changes"), humanize.Bytes(bytesAdded), humanize.Bytes(bytesRemoved))
+}
+
 // Generates ascii graph chars to display on the left side of the commit info if -graph arg is true.
 func genGraph(node LogNode, lineno int) string {
 	if !showGraph {
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stormasm/noms/go/datas"
@@ -102,6 +103,69 @@ func (s *nomsLogTestSuite) TestNArg() {
 	s.Contains(res, h1.String())
 }
 
+func (s *nomsLogTestSuite) TestFilters() {
+	str := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	db, err := spec.GetDatabase(str)
+	s.NoError(err)
+
+	ds := db.GetDataset("filtered")
+	hashes := []string{}
+	for i, date := range []string{"2016-01-01T00:00:00Z", "2016-02-01T00:00:00Z", "2016-03-01T00:00:00Z", ""} {
+		meta := types.EmptyStruct
+		if date != "" {
+			meta = types.NewStruct("Meta", types.StructData{"date": types.String(date)})
+		}
+		// Only the first and third commits change the value of .a.
+		v := types.NewStruct("", types.StructData{"a": types.Number(i / 2 * 2), "b": types.Number(i)})
+		ds, err = db.Commit(ds, v, datas.CommitOptions{Meta: meta})
+		s.NoError(err)
+		hashes = append(hashes, ds.Head().Hash().String())
+	}
+	db.Close()
+
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "filtered")
+	shown := func(args ...string) []bool {
+		res, _ := s.MustRun(main, append(append([]string{"log", "--oneline"}, args...), dsSpec))
+		// Each line starts with the commit's hash, followed by its parent's.
+		found := make([]bool, len(hashes))
+		for _, line := range strings.Split(res, "\n") {
+			for i, h := range hashes {
+				found[i] = found[i] || strings.HasPrefix(line, h)
+			}
+		}
+		return found
+	}
+	s.Equal([]bool{false, true, true, false}, shown("--since", "2016-01-15"))
+	s.Equal([]bool{true, true, false, false}, shown("--until", "2016-02-01T00:00:00Z"))
+	s.Equal([]bool{false, true, false, false}, shown("--since", "2016-02-01", "--until", "2016-02-01"))
+	s.Equal([]bool{true, false, true, false}, shown("--path", ".a"))
+	s.Equal([]bool{false, false, true, false}, shown("--path", ".a", "--max-count", "1"))
+
+	_, _, recovered := s.Run(main, []string{"log", "--since", "yesterday", dsSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+}
+
+func (s *nomsLogTestSuite) TestStat() {
+	str := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	db, err := spec.GetDatabase(str)
+	s.NoError(err)
+
+	ds := db.GetDataset("stat")
+	ds, err = addCommitWithValue(ds, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2)))
+	s.NoError(err)
+	ds, err = addCommitWithValue(ds, types.NewMap(types.String("a"), types.Number(3), types.String("c"), types.Number(4), types.String("d"), types.Number(5)))
+	s.NoError(err)
+	db.Close()
+
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "stat")
+	res, _ := s.MustRun(main, []string{"log", "--stat", dsSpec})
+	s.Contains(res, "Stat:   2 insertions, 1 deletion, 1 change, +")
+	s.Equal(1, strings.Count(res, "Stat:"))
+
+	res, _ = s.MustRun(main, []string{"log", dsSpec})
+	s.NotContains(res, "Stat:")
+}
+
 func (s *nomsLogTestSuite) TestEmptyCommit() {
 	str := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
 	db, err := spec.GetDatabase(str)
@@ -0,0 +1,213 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/merge"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/status"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var datasetRe = regexp.MustCompile("^" + datas.DatasetRe.String() + "$")
+
+var (
+	mergeOurs   bool
+	mergeTheirs bool
+	mergeFail   bool
+	mergeRecord bool
+	mergeQuiet  bool
+	mergePolicy string
+
+	// mergeInput is where conflicts are resolved from when no policy is given.
+	mergeInput io.Reader = os.Stdin
+)
+
+var nomsMerge = &util.Command{
+	Run:       runMerge,
+	UsageLine: "merge [options] <database> <left-dataset> <right-dataset> <output-dataset>",
+	Short:     "Merges and commits the heads of two datasets",
+	Long:      "Finds the common ancestor of the heads of left-dataset and right-dataset, merges the changes each made to its value, and commits the result to output-dataset, with both heads as its parents. Where both changed the same value differently, you're asked which to keep, unless --ours, --theirs, --fail or --record-conflicts says what to do. With --record-conflicts, the conflicts are committed to <output-dataset>/conflicts as a List of Conflict structs, each with the path, the base, left and right values, and the left and right changes, to be settled later, and the merge isn't committed. --policy resolves the conflicts at given paths, and below them, with other policies, e.g. --policy .count=add,.tags=union adds up the changes to .count, and keeps the elements both added to .tags.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupMergeFlags,
+	Nargs:     4,
+}
+
+func setupMergeFlags() *flag.FlagSet {
+	mergeFlagSet := flag.NewFlagSet("merge", flag.ExitOnError)
+	mergeFlagSet.BoolVar(&mergeOurs, "ours", false, "resolve conflicts by keeping the value from left-dataset")
+	mergeFlagSet.BoolVar(&mergeTheirs, "theirs", false, "resolve conflicts by keeping the value from right-dataset")
+	mergeFlagSet.BoolVar(&mergeFail, "fail", false, "fail at the first conflict, without committing anything")
+	mergeFlagSet.BoolVar(&mergeRecord, "record-conflicts", false, "rather than failing at conflicts, commit them to <output-dataset>/conflicts, without committing the merge")
+	mergeFlagSet.StringVar(&mergePolicy, "policy", "", "comma-separated path=policy pairs, resolving the conflicts at each path with the policy, which is one of "+strings.Join(merge.PolicyNames(), ", "))
+	mergeFlagSet.BoolVar(&mergeQuiet, "quiet", false, "silence progress output")
+	spec.RegisterCommitMetaFlags(mergeFlagSet)
+	verbose.RegisterVerboseFlags(mergeFlagSet)
+	return mergeFlagSet
+}
+
+func runMerge(args []string) int {
+	policies := 0
+	for _, set := range []bool{mergeOurs, mergeTheirs, mergeFail, mergeRecord} {
+		if set {
+			policies++
+		}
+	}
+	if policies > 1 {
+		d.CheckError(fmt.Errorf("At most one of --ours, --theirs, --fail and --record-conflicts may be given"))
+	}
+
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	getHead := func(name string) (datas.Dataset, types.Struct) {
+		if !datasetRe.MatchString(name) {
+			d.CheckError(fmt.Errorf("Invalid dataset %s, must match %s", name, datas.DatasetRe.String()))
+		}
+		ds := db.GetDataset(name)
+		head, ok := ds.MaybeHead()
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Dataset %s has no data", name))
+		}
+		return ds, head
+	}
+	leftDS, left := getHead(args[1])
+	rightDS, right := getHead(args[2])
+	if !datasetRe.MatchString(args[3]) {
+		d.CheckError(fmt.Errorf("Invalid dataset %s, must match %s", args[3], datas.DatasetRe.String()))
+	}
+	outDS := db.GetDataset(args[3])
+
+	ancestor, ok := datas.FindCommonAncestor(left, right, db)
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Datasets %s and %s have no common ancestor", args[1], args[2]))
+	}
+
+	var def merge.Policy
+	var recorder *merge.ConflictRecorder
+	switch {
+	case mergeOurs:
+		def = merge.Ours
+	case mergeTheirs:
+		def = merge.Theirs
+	case mergeFail:
+		def = merge.Fail
+	case mergeRecord:
+		recorder = merge.NewConflictRecorder(nil)
+		def = recorder
+	default:
+		in := bufio.NewReader(mergeInput)
+		def = merge.ResolveFunc(func(aChange, bChange types.DiffChangeType, a, b types.Value, path types.Path) (types.DiffChangeType, types.Value, bool) {
+			return cliResolve(in, os.Stdout, aChange, bChange, a, b, path)
+		})
+	}
+	policy, err := merge.ParsePolicies(mergePolicy, def)
+	d.CheckError(err)
+
+	pc := make(chan struct{}, 128)
+	go func() {
+		count := 0
+		for range pc {
+			if !mergeQuiet {
+				count++
+				status.Printf("Applied %d changes...", count)
+			}
+		}
+	}()
+	merged, err := merge.ThreeWay(left.Get(datas.ValueField), right.Get(datas.ValueField), ancestor.Get(datas.ValueField), db, policy, pc)
+	close(pc)
+	if !mergeQuiet {
+		status.Done()
+	}
+	d.CheckErrorNoUsage(err)
+
+	if recorder != nil && len(recorder.Conflicts) > 0 {
+		conflictsDS := db.GetDataset(args[3] + "/conflicts")
+		meta, err := spec.CreateCommitMetaStruct(db, "", fmt.Sprintf("Conflicts merging %s and %s", args[1], args[2]), nil, nil)
+		d.CheckErrorNoUsage(err)
+		_, err = db.Commit(conflictsDS, merge.NewConflictList(recorder.Conflicts), datas.CommitOptions{Meta: meta})
+		d.CheckErrorNoUsage(err)
+		d.CheckErrorNoUsage(fmt.Errorf("Recorded %d conflicts merging %s and %s in %s, leaving %s unchanged", len(recorder.Conflicts), args[1], args[2], conflictsDS.ID(), args[3]))
+	}
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+	outDS, err = db.Commit(outDS, merged, datas.CommitOptions{
+		Parents: types.NewSet(leftDS.HeadRef(), rightDS.HeadRef()),
+		Meta:    meta,
+	})
+	d.CheckErrorNoUsage(err)
+	fmt.Fprintf(os.Stdout, "Merged %s and %s into %s, new head #%s\n", args[1], args[2], args[3], outDS.HeadRef().TargetHash().String())
+	return 0
+}
+
+// cliResolve asks on |out| which of two conflicting changes to keep, reading the answer from |in|. a and b are nil if they were removed. Booleans, numbers and strings of the same type can also be mashed together: ORed, added or concatenated.
+func cliResolve(in *bufio.Reader, out io.Writer, aChange, bChange types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
+	describe := func(change types.DiffChangeType, v types.Value) string {
+		if change == types.DiffChangeRemoved || v == nil {
+			return "(removed)"
+		}
+		return types.EncodedValue(v)
+	}
+	mashable := false
+	if a != nil && b != nil && a.Type().Equals(b.Type()) {
+		switch a.(type) {
+		case types.Bool, types.Number, types.String:
+			mashable = true
+		}
+	}
+
+	fmt.Fprintf(out, "\nConflict at: %s\n", path.String())
+	fmt.Fprintf(out, "Left:  %s\nRight: %s\n\n", describe(aChange, a), describe(bChange, b))
+	prompt := "Enter 'l' to accept the left value, 'r' to accept the right value, "
+	if mashable {
+		prompt += "'m' to mash them together, "
+	}
+	prompt += "or 'f' to fail the merge"
+	for {
+		fmt.Fprintln(out, prompt)
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			// Running out of input fails the merge, rather than looping forever.
+			return change, merged, false
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "l":
+			return aChange, a, true
+		case "r":
+			return bChange, b, true
+		case "f":
+			return change, merged, false
+		case "m":
+			if !mashable {
+				continue
+			}
+			switch a := a.(type) {
+			case types.Bool:
+				merged = types.Bool(bool(a) || bool(b.(types.Bool)))
+			case types.Number:
+				merged = types.Number(float64(a) + float64(b.(types.Number)))
+			case types.String:
+				merged = types.String(string(a) + string(b.(types.String)))
+			}
+			fmt.Fprintln(out, "Replacing with", types.EncodedValue(merged))
+			return aChange, merged, true
+		}
+	}
+}
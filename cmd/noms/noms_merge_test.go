@@ -0,0 +1,156 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/merge"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestMerge(t *testing.T) {
+	suite.Run(t, &nomsMergeTestSuite{})
+}
+
+type nomsMergeTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// setupMerge commits a struct to "parent", and then changes to it on "left" and "right", which both change "conflict".
+func (s *nomsMergeTestSuite) setupMerge() string {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	defer db.Close()
+
+	parent, err := db.CommitValue(db.GetDataset("parent"), types.NewStruct("", types.StructData{
+		"num": types.Number(1), "str": types.String("parent"), "conflict": types.String("parent"),
+	}))
+	s.NoError(err)
+	for name, data := range map[string]types.StructData{
+		"left":  {"num": types.Number(2), "str": types.String("parent"), "conflict": types.String("left")},
+		"right": {"num": types.Number(1), "str": types.String("right"), "conflict": types.String("right")},
+	} {
+		ds, err := db.SetHead(db.GetDataset(name), parent.HeadRef())
+		s.NoError(err)
+		_, err = db.CommitValue(ds, types.NewStruct("", data))
+		s.NoError(err)
+	}
+	return dbSpec
+}
+
+func (s *nomsMergeTestSuite) mergedValue(dbSpec, ds string) types.Struct {
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	defer db.Close()
+	head := db.GetDataset(ds).Head()
+	s.Equal(2, int(head.Get(datas.ParentsField).(types.Set).Len()))
+	return head.Get(datas.ValueField).(types.Struct)
+}
+
+func (s *nomsMergeTestSuite) TestPolicies() {
+	dbSpec := s.setupMerge()
+
+	sout, _ := s.MustRun(main, []string{"merge", "--quiet", "--ours", dbSpec, "left", "right", "ours"})
+	s.Contains(sout, "Merged left and right into ours")
+	merged := s.mergedValue(dbSpec, "ours")
+	s.Equal(types.Number(2), merged.Get("num"))
+	s.Equal(types.String("right"), merged.Get("str"))
+	s.Equal(types.String("left"), merged.Get("conflict"))
+
+	s.MustRun(main, []string{"merge", "--quiet", "--theirs", dbSpec, "left", "right", "theirs"})
+	s.Equal(types.String("right"), s.mergedValue(dbSpec, "theirs").Get("conflict"))
+
+	_, _, recovered := s.Run(main, []string{"merge", "--quiet", "--fail", dbSpec, "left", "right", "failed"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	_, ok := db.GetDataset("failed").MaybeHead()
+	s.False(ok)
+	db.Close()
+
+	// Policies for paths take precedence over --ours.
+	s.MustRun(main, []string{"merge", "--quiet", "--ours", "--policy", ".conflict=theirs", dbSpec, "left", "right", "paths"})
+	merged = s.mergedValue(dbSpec, "paths")
+	s.Equal(types.String("right"), merged.Get("conflict"))
+	s.Equal(types.Number(2), merged.Get("num"))
+
+	_, _, recovered = s.Run(main, []string{"merge", "--quiet", dbSpec, "left", "nonexistent", "out"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+}
+
+func (s *nomsMergeTestSuite) TestRecordConflicts() {
+	dbSpec := s.setupMerge()
+
+	_, serr, recovered := s.Run(main, []string{"merge", "--quiet", "--record-conflicts", dbSpec, "left", "right", "recorded"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(serr, "Recorded 1 conflicts merging left and right in recorded/conflicts, leaving recorded unchanged")
+
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	defer db.Close()
+	_, ok := db.GetDataset("recorded").MaybeHead()
+	s.False(ok)
+	conflicts, err := merge.ReadConflictList(db.GetDataset("recorded/conflicts").HeadValue().(types.List))
+	s.NoError(err)
+	s.Len(conflicts, 1)
+	s.Equal(".conflict", conflicts[0].Path.String())
+	s.Equal(types.String("parent"), conflicts[0].Parent)
+	s.Equal(types.String("left"), conflicts[0].A)
+	s.Equal(types.String("right"), conflicts[0].B)
+}
+
+func (s *nomsMergeTestSuite) TestInteractive() {
+	dbSpec := s.setupMerge()
+	defer func() { mergeInput = nil }()
+
+	mergeInput = strings.NewReader("x\nm\n")
+	sout, _ := s.MustRun(main, []string{"merge", "--quiet", dbSpec, "left", "right", "mashed"})
+	s.Contains(sout, "Conflict at: .conflict")
+	s.Equal(types.String("leftright"), s.mergedValue(dbSpec, "mashed").Get("conflict"))
+}
+
+func TestCLIResolve(t *testing.T) {
+	assert := assert.New(t)
+	resolve := func(input string, a, b types.Value) (types.DiffChangeType, types.Value, bool) {
+		aChange, bChange := types.DiffChangeModified, types.DiffChangeModified
+		if a == nil {
+			aChange = types.DiffChangeRemoved
+		}
+		return cliResolve(bufio.NewReader(strings.NewReader(input)), ioutil.Discard, aChange, bChange, a, b, types.Path{})
+	}
+
+	_, v, ok := resolve("l\n", types.Number(1), types.Number(2))
+	assert.True(ok)
+	assert.Equal(types.Number(1), v)
+	_, v, ok = resolve("R\n", types.Number(1), types.Number(2))
+	assert.True(ok)
+	assert.Equal(types.Number(2), v)
+	_, v, ok = resolve("m\n", types.Number(1), types.Number(2))
+	assert.True(ok)
+	assert.Equal(types.Number(3), v)
+	_, v, ok = resolve("m\n", types.Bool(false), types.Bool(true))
+	assert.True(ok)
+	assert.Equal(types.Bool(true), v)
+
+	// Removals can be kept, but not mashed, and running out of input fails.
+	change, v, ok := resolve("l\n", nil, types.String("b"))
+	assert.True(ok)
+	assert.Equal(types.DiffChangeRemoved, change)
+	assert.Nil(v)
+	_, _, ok = resolve("m\n", nil, types.String("b"))
+	assert.False(ok)
+	_, _, ok = resolve("f\n", types.Number(1), types.Number(2))
+	assert.False(ok)
+}
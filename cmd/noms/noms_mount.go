@@ -0,0 +1,317 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+// snapshotsDir is the directory at the root of a mounted commit holding the values of the commits in its history.
+const snapshotsDir = ".snapshots"
+
+var mountDebug bool
+
+var nomsMount = &util.Command{
+	Run:       runMount,
+	UsageLine: "mount [options] <object> <dir>",
+	Short:     "Mounts a Noms value as a read-only filesystem",
+	Long:      "Mounts the value at <object> on <dir> with FUSE, so that it can be browsed with tools that work with files, until noms mount is interrupted. Structs and Maps are directories, whose entries are their fields and the values of their keys, and Lists are directories whose entries are their indexes. Blobs are files holding their bytes, and other values are files holding the way noms show writes them. Refs are followed to their targets.\n\nThe keys of Maps are named by their Strings, with any % or / escaped as %25 or %2F, by the way noms show writes them if they're Numbers or Bools, and by # followed by their hash otherwise.\n\nIf <object> is a commit, e.g. a dataset, its value is mounted, and the values of it and every commit in its history are in .snapshots, in directories named by the hashes of their commits.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object argument.",
+	Flags:     setupMountFlags,
+	Nargs:     2,
+}
+
+func setupMountFlags() *flag.FlagSet {
+	mountFlagSet := flag.NewFlagSet("mount", flag.ExitOnError)
+	mountFlagSet.BoolVar(&mountDebug, "debug", false, "log every FUSE request")
+	verbose.RegisterVerboseFlags(mountFlagSet)
+	return mountFlagSet
+}
+
+func runMount(args []string) int {
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(args[0])
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+	if value == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", args[0]))
+	}
+
+	nfs := pathfs.NewPathNodeFs(newMountFS(db, value), nil)
+	conn := nodefs.NewFileSystemConnector(nfs.Root(), &nodefs.Options{Debug: mountDebug})
+	server, err := fuse.NewServer(conn.RawFS(), args[1], &fuse.MountOptions{
+		Options: []string{"ro"},
+		FsName:  args[0],
+		Name:    "noms",
+		Debug:   mountDebug,
+	})
+	d.CheckErrorNoUsage(err)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		server.Unmount()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Mounted %s on %s, interrupt to unmount\n", args[0], args[1])
+	server.Serve()
+	return 0
+}
+
+// mountFS is a read-only pathfs.FileSystem of a Noms value. Since values can't change, nothing about them is cached but the history of a mounted commit.
+type mountFS struct {
+	pathfs.FileSystem
+	db     datas.Database
+	root   types.Value
+	commit types.Struct // commit whose value is root, if there is one
+
+	snapshotsOnce sync.Once
+	snapshots     map[hash.Hash]types.Struct
+}
+
+func newMountFS(db datas.Database, v types.Value) *mountFS {
+	fs := &mountFS{FileSystem: pathfs.NewDefaultFileSystem(), db: db, root: v}
+	if s, ok := v.(types.Struct); ok && datas.IsCommitType(s.Type()) {
+		fs.root, fs.commit = s.Get(datas.ValueField), s
+	}
+	return fs
+}
+
+// lookup returns the value at |path|, with Refs followed to their targets.
+func (fs *mountFS) lookup(path string) (types.Value, fuse.Status) {
+	v := fs.deref(fs.root)
+	if path == "" {
+		return v, fuse.OK
+	}
+	names := strings.Split(path, "/")
+	if fs.commit.Type() != nil && names[0] == snapshotsDir {
+		if len(names) == 1 {
+			return nil, fuse.OK
+		}
+		h, ok := hash.MaybeParse(names[1])
+		commit, found := fs.history()[h]
+		if !ok || !found {
+			return nil, fuse.ENOENT
+		}
+		v, names = fs.deref(commit.Get(datas.ValueField)), names[2:]
+	}
+	for _, name := range names {
+		child, ok := childNamed(v, name)
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		v = fs.deref(child)
+	}
+	return v, fuse.OK
+}
+
+func (fs *mountFS) deref(v types.Value) types.Value {
+	for {
+		r, ok := v.(types.Ref)
+		if !ok {
+			return v
+		}
+		v = fs.db.ReadValue(r.TargetHash())
+		d.PanicIfTrue(v == nil, "Missing chunk %s", r.TargetHash())
+	}
+}
+
+// history returns the mounted commit and every commit in its history, by hash.
+func (fs *mountFS) history() map[hash.Hash]types.Struct {
+	fs.snapshotsOnce.Do(func() {
+		fs.snapshots = map[hash.Hash]types.Struct{}
+		pending := []types.Struct{fs.commit}
+		for len(pending) > 0 {
+			c := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if _, ok := fs.snapshots[c.Hash()]; ok {
+				continue
+			}
+			fs.snapshots[c.Hash()] = c
+			c.Get(datas.ParentsField).(types.Set).IterAll(func(p types.Value) {
+				pending = append(pending, fs.db.ReadValue(p.(types.Ref).TargetHash()).(types.Struct))
+			})
+		}
+	})
+	return fs.snapshots
+}
+
+// isDir returns whether |v| is mounted as a directory. v is nil for the snapshots directory.
+func isDir(v types.Value) bool {
+	switch v.(type) {
+	case nil, types.Struct, types.Map, types.List:
+		return true
+	}
+	return false
+}
+
+// fileContents returns the contents of the file |v|, which isn't a Blob.
+func fileContents(v types.Value) []byte {
+	return []byte(types.EncodedValue(v) + "\n")
+}
+
+var nameEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+var nameUnescaper = strings.NewReplacer("%25", "%", "%2F", "/")
+
+// keyName returns the name of the entry of the key |k| of a Map.
+func keyName(k types.Value) string {
+	switch k := k.(type) {
+	case types.String:
+		return nameEscaper.Replace(string(k))
+	case types.Number, types.Bool:
+		return types.EncodedValue(k)
+	}
+	return "#" + k.Hash().String()
+}
+
+// childNamed returns the value of the entry |name| of the directory |v|.
+func childNamed(v types.Value, name string) (types.Value, bool) {
+	switch v := v.(type) {
+	case types.Struct:
+		return v.MaybeGet(name)
+	case types.Map:
+		if child, ok := v.MaybeGet(types.String(nameUnescaper.Replace(name))); ok {
+			return child, true
+		}
+		var child types.Value
+		v.Iter(func(k, v types.Value) bool {
+			if _, ok := k.(types.String); !ok && keyName(k) == name {
+				child = v
+			}
+			return child != nil
+		})
+		return child, child != nil
+	case types.List:
+		i, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || i >= v.Len() || strconv.FormatUint(i, 10) != name {
+			return nil, false
+		}
+		return v.Get(i), true
+	}
+	return nil, false
+}
+
+func (fs *mountFS) GetAttr(path string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	v, code := fs.lookup(path)
+	if code != fuse.OK {
+		return nil, code
+	}
+	if isDir(v) {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0555}, fuse.OK
+	}
+	at := &fuse.Attr{Mode: fuse.S_IFREG | 0444}
+	if b, ok := v.(types.Blob); ok {
+		at.Size = b.Len()
+	} else {
+		at.Size = uint64(len(fileContents(v)))
+	}
+	return at, fuse.OK
+}
+
+func (fs *mountFS) OpenDir(path string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	v, code := fs.lookup(path)
+	if code != fuse.OK {
+		return nil, code
+	}
+	entries := []fuse.DirEntry{}
+	add := func(name string, v types.Value) {
+		mode := uint32(fuse.S_IFREG)
+		if isDir(fs.deref(v)) {
+			mode = fuse.S_IFDIR
+		}
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: mode})
+	}
+	switch v := v.(type) {
+	case nil:
+		for h := range fs.history() {
+			entries = append(entries, fuse.DirEntry{Name: h.String(), Mode: fuse.S_IFDIR})
+		}
+	case types.Struct:
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, _ *types.Type) {
+			add(name, v.Get(name))
+		})
+	case types.Map:
+		v.IterAll(func(k, v types.Value) {
+			add(keyName(k), v)
+		})
+	case types.List:
+		v.IterAll(func(v types.Value, i uint64) {
+			add(strconv.FormatUint(i, 10), v)
+		})
+	default:
+		return nil, fuse.ENOTDIR
+	}
+	if path == "" && fs.commit.Type() != nil {
+		entries = append(entries, fuse.DirEntry{Name: snapshotsDir, Mode: fuse.S_IFDIR})
+	}
+	return entries, fuse.OK
+}
+
+func (fs *mountFS) Open(path string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, fuse.EROFS
+	}
+	v, code := fs.lookup(path)
+	if code != fuse.OK {
+		return nil, code
+	}
+	if isDir(v) {
+		return nil, fuse.Status(syscall.EISDIR)
+	}
+	if b, ok := v.(types.Blob); ok {
+		return &blobFile{nodefs.NewReadOnlyFile(nodefs.NewDefaultFile()), b}, fuse.OK
+	}
+	return nodefs.NewReadOnlyFile(nodefs.NewDataFile(fileContents(v))), fuse.OK
+}
+
+func (fs *mountFS) StatFs(path string) *fuse.StatfsOut {
+	return &fuse.StatfsOut{Bsize: 4096}
+}
+
+// blobFile is an open file holding the bytes of a Blob, which are read as they're needed.
+type blobFile struct {
+	nodefs.File
+	blob types.Blob
+}
+
+func (f *blobFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	if uint64(off) >= f.blob.Len() {
+		return fuse.ReadResultData(nil), fuse.OK
+	}
+	r := f.blob.Reader()
+	if _, err := r.Seek(off, 0); err != nil {
+		return nil, fuse.EIO
+	}
+	n, err := io.ReadFull(r, dest)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fuse.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), fuse.OK
+}
+
+func (f *blobFile) GetAttr(out *fuse.Attr) fuse.Status {
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = f.blob.Len()
+	return fuse.OK
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// The filesystem is tested without mounting it, since FUSE mounts need privileges tests don't have.
+
+func readMounted(assert *assert.Assertions, fs *mountFS, path string) string {
+	at, code := fs.GetAttr(path, nil)
+	assert.Equal(fuse.OK, code)
+	f, code := fs.Open(path, syscall.O_RDONLY, nil)
+	assert.Equal(fuse.OK, code)
+	buf := make([]byte, at.Size+10)
+	res, code := f.Read(buf, 0)
+	assert.Equal(fuse.OK, code)
+	data, _ := res.Bytes(buf)
+	assert.Len(data, int(at.Size))
+	return string(data)
+}
+
+func listMounted(assert *assert.Assertions, fs *mountFS, path string) []string {
+	entries, code := fs.OpenDir(path, nil)
+	assert.Equal(fuse.OK, code)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMountValues(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	blobData := bytes.Repeat([]byte("0123456789"), 10000)
+	blob := types.NewBlob(bytes.NewReader(blobData))
+	v := types.NewStruct("Photo", types.StructData{
+		"title": types.String("Sunset"),
+		"data":  db.WriteValue(blob),
+		"tags":  types.NewList(types.String("beach"), types.String("sky")),
+		"sizes": types.NewMap(types.String("a/b%"), types.Number(1), types.Number(42), types.Bool(true), types.NewList(), types.Number(3)),
+	})
+	fs := newMountFS(db, v)
+
+	assert.Equal([]string{"data", "sizes", "tags", "title"}, listMounted(assert, fs, ""))
+	assert.Equal("\"Sunset\"\n", readMounted(assert, fs, "title"))
+	assert.Equal([]string{"0", "1"}, listMounted(assert, fs, "tags"))
+	assert.Equal("\"sky\"\n", readMounted(assert, fs, "tags/1"))
+	emptyList := "#" + types.NewList().Hash().String()
+	assert.Equal([]string{emptyList, "42", "a%2Fb%25"}, listMounted(assert, fs, "sizes"))
+	assert.Equal("1\n", readMounted(assert, fs, "sizes/a%2Fb%25"))
+	assert.Equal("true\n", readMounted(assert, fs, "sizes/42"))
+	assert.Equal("3\n", readMounted(assert, fs, "sizes/"+emptyList))
+
+	// Blobs are read through Refs, a part at a time.
+	at, code := fs.GetAttr("data", nil)
+	assert.Equal(fuse.OK, code)
+	assert.Equal(uint32(fuse.S_IFREG|0444), at.Mode)
+	assert.Equal(uint64(len(blobData)), at.Size)
+	f, _ := fs.Open("data", syscall.O_RDONLY, nil)
+	buf := make([]byte, 100)
+	res, code := f.Read(buf, 54321)
+	assert.Equal(fuse.OK, code)
+	part, _ := res.Bytes(buf)
+	assert.Equal(blobData[54321:54421], part)
+	res, _ = f.Read(buf, int64(len(blobData)))
+	part, _ = res.Bytes(buf)
+	assert.Empty(part)
+
+	for _, p := range []string{"nope", "tags/2", "tags/01", "title/x", ".snapshots"} {
+		_, code = fs.GetAttr(p, nil)
+		assert.Equal(fuse.ENOENT, code, p)
+	}
+	_, code = fs.Open("title", syscall.O_WRONLY, nil)
+	assert.Equal(fuse.EROFS, code)
+	_, code = fs.Open("tags", syscall.O_RDONLY, nil)
+	assert.Equal(fuse.Status(syscall.EISDIR), code)
+	_, code = fs.OpenDir("title", nil)
+	assert.Equal(fuse.ENOTDIR, code)
+}
+
+func TestMountSnapshots(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	ds := db.GetDataset("ds")
+	commits := []string{}
+	for _, s := range []string{"one", "two", "three"} {
+		var err error
+		ds, err = db.CommitValue(ds, types.NewStruct("", types.StructData{"v": types.String(s)}))
+		assert.NoError(err)
+		commits = append(commits, ds.HeadRef().TargetHash().String())
+	}
+	fs := newMountFS(db, ds.Head())
+
+	assert.Equal([]string{".snapshots", "v"}, listMounted(assert, fs, ""))
+	assert.Equal("\"three\"\n", readMounted(assert, fs, "v"))
+	sort.Strings(commits)
+	assert.Equal(commits, listMounted(assert, fs, ".snapshots"))
+	for _, c := range commits {
+		assert.Equal([]string{"v"}, listMounted(assert, fs, ".snapshots/"+c))
+	}
+	first := db.ReadValue(ds.Head().Get(datas.ParentsField).(types.Set).First().(types.Ref).TargetHash()).(types.Struct)
+	first = db.ReadValue(first.Get(datas.ParentsField).(types.Set).First().(types.Ref).TargetHash()).(types.Struct)
+	assert.Equal("\"one\"\n", readMounted(assert, fs, ".snapshots/"+first.Hash().String()+"/v"))
+	_, code := fs.GetAttr(".snapshots/"+types.String("x").Hash().String(), nil)
+	assert.Equal(fuse.ENOENT, code)
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/ipc"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	parquetFormat      string
+	parquetBatchSize   int
+	parquetCompression string
+	parquetName        string
+	parquetPrimaryKey  string
+)
+
+var nomsParquet = &util.Command{
+	Run:       runParquet,
+	UsageLine: "parquet export [options] <path> <file|-> | import [options] <file|-> <dataset>",
+	Short:     "Exports datasets to Parquet and Arrow files for analytics tools, and imports them again",
+	Long: `export writes the List or Map of structs at a path, e.g. a dataset, or its .value, to a file, or stdout if it's -, with a column for each field of the structs, which must be Bools, Numbers or Strings. Fields that some of the structs don't have are nullable columns.
+
+--format is parquet, arrow for an Arrow IPC stream, or arrow-file for an Arrow file, also known as Feather version 2. By default, it's arrow-file for files ending in .arrow or .feather, arrow for files ending in .arrows, and otherwise parquet. --batch-size is the number of rows in each Parquet row group or Arrow record batch, and --compression is how Parquet pages are compressed: none, snappy or gzip.
+
+import reads a Parquet file, an Arrow file or an Arrow IPC stream, whichever it is, from a file, or stdin if it's -, and commits its rows to a dataset, as a List of structs named Row, with a field for each column, or with --pk, as a Map of them, in the same way as noms csv import.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset and path arguments.`,
+	Flags: setupParquetFlags,
+	Nargs: 3,
+}
+
+func setupParquetFlags() *flag.FlagSet {
+	parquetFlagSet := flag.NewFlagSet("parquet", flag.ExitOnError)
+	parquetFlagSet.StringVar(&parquetFormat, "format", "", "format to export to: parquet, arrow or arrow-file")
+	parquetFlagSet.IntVar(&parquetBatchSize, "batch-size", 64*1024, "number of rows in each row group or record batch")
+	parquetFlagSet.StringVar(&parquetCompression, "compression", "snappy", "how to compress Parquet pages: none, snappy or gzip")
+	parquetFlagSet.StringVar(&parquetName, "name", "Row", "name of the struct each row is imported as")
+	parquetFlagSet.StringVar(&parquetPrimaryKey, "pk", "", "comma-separated columns making up the primary key of each row, to import the rows as a Map")
+	spec.RegisterCommitMetaFlags(parquetFlagSet)
+	verbose.RegisterVerboseFlags(parquetFlagSet)
+	return parquetFlagSet
+}
+
+func runParquet(args []string) int {
+	if len(args) != 3 {
+		d.CheckError(fmt.Errorf("parquet %s takes 2 arguments", args[0]))
+	}
+	switch args[0] {
+	case "import":
+		runParquetImport(args[1], args[2])
+	case "export":
+		runParquetExport(args[1], args[2])
+	default:
+		d.CheckError(fmt.Errorf("Unknown parquet subcommand %s", args[0]))
+	}
+	return 0
+}
+
+func runParquetExport(pathSpec, file string) {
+	format := parquetFormat
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".arrow", ".feather":
+			format = "arrow-file"
+		case ".arrows":
+			format = "arrow"
+		default:
+			format = "parquet"
+		}
+	}
+	codec, ok := ipc.CodecNames[parquetCompression]
+	if !ok {
+		d.CheckError(fmt.Errorf("Invalid --compression %s, must be none, snappy or gzip", parquetCompression))
+	}
+
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(pathSpec)
+	d.CheckError(err)
+	defer db.Close()
+	if value == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", pathSpec))
+	}
+	if c, ok := value.(types.Struct); ok && datas.IsCommitType(c.Type()) {
+		// A dataset means the value of its head.
+		value = c.Get(datas.ValueField)
+	}
+	schema, err := ipc.SchemaOf(value)
+	d.CheckErrorNoUsage(err)
+
+	var out io.Writer = os.Stdout
+	if file != "-" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+	var w ipc.Writer
+	switch format {
+	case "parquet":
+		w, err = ipc.NewParquetWriter(bw, schema, parquetBatchSize, codec)
+	case "arrow":
+		w, err = ipc.NewArrowWriter(bw, schema, parquetBatchSize)
+	case "arrow-file":
+		w, err = ipc.NewArrowFileWriter(bw, schema, parquetBatchSize)
+	default:
+		d.CheckError(fmt.Errorf("Invalid --format %s, must be parquet, arrow or arrow-file", format))
+	}
+	d.CheckErrorNoUsage(err)
+	d.CheckErrorNoUsage(ipc.WriteValue(w, value))
+	d.CheckErrorNoUsage(bw.Flush())
+}
+
+func runParquetImport(file, dsSpec string) {
+	pks := []string{}
+	if parquetPrimaryKey != "" {
+		pks = strings.Split(parquetPrimaryKey, ",")
+	}
+
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		in = f
+	}
+	// Parquet files have their metadata at the end, so they're read from wherever they're stored, or if they're piped in, from memory. Arrow streams are read as they come.
+	br := bufio.NewReader(in)
+	var r ipc.Reader
+	magic, _ := br.Peek(4)
+	if ipc.IsParquet(magic) {
+		var ra io.ReaderAt
+		var size int64
+		if f, ok := in.(*os.File); ok && file != "-" {
+			fi, err := f.Stat()
+			d.CheckErrorNoUsage(err)
+			ra, size = f, fi.Size()
+		} else {
+			b, err := ioutil.ReadAll(br)
+			d.CheckErrorNoUsage(err)
+			ra, size = bytes.NewReader(b), int64(len(b))
+		}
+		var err error
+		r, err = ipc.NewParquetReader(ra, size, parquetName)
+		d.CheckErrorNoUsage(err)
+	} else {
+		var err error
+		r, err = ipc.NewArrowReader(br, parquetName)
+		d.CheckErrorNoUsage(err)
+	}
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	var value types.Collection
+	if len(pks) == 0 {
+		value, err = ipc.ReadToList(r, db)
+	} else {
+		value, err = ipc.ReadToMap(r, pks, "Key", db)
+	}
+	d.CheckErrorNoUsage(err)
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", map[string]string{"inputFile": file}, nil)
+	d.CheckErrorNoUsage(err)
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Imported %d rows of %s into %s, new head #%s\n", value.Len(), file, dsSpec, ds.HeadRef().TargetHash().String())
+}
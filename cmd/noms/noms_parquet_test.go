@@ -0,0 +1,100 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/ipc"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestParquet(t *testing.T) {
+	suite.Run(t, &nomsParquetTestSuite{})
+}
+
+type nomsParquetTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsParquetTestSuite) setupPeople() string {
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "people")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	_, err = db.CommitValue(ds, types.NewList(
+		types.NewStruct("Person", types.StructData{"name": types.String("alice"), "age": types.Number(30), "member": types.Bool(true)}),
+		types.NewStruct("Person", types.StructData{"name": types.String("bob"), "age": types.Number(25)}),
+	))
+	s.NoError(err)
+	return dsSpec
+}
+
+func (s *nomsParquetTestSuite) TestExportImport() {
+	dsSpec := s.setupPeople()
+	for _, name := range []string{"people.parquet", "people.arrow", "people.arrows"} {
+		file := filepath.Join(s.TempDir, name)
+		s.MustRun(main, []string{"parquet", "export", dsSpec, file})
+
+		outSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "imported")
+		out, _ := s.MustRun(main, []string{"parquet", "import", "--pk", "name", file, outSpec})
+		s.Contains(out, "Imported 2 rows of "+file+" into "+outSpec+", new head #")
+
+		db, ds, err := spec.GetDataset(outSpec)
+		s.NoError(err)
+		m := ds.HeadValue().(types.Map)
+		s.Equal(uint64(2), m.Len())
+		alice := m.Get(types.String("alice")).(types.Struct)
+		s.Equal("Row", alice.Type().Desc.(types.StructDesc).Name)
+		s.Equal(types.Number(30), alice.Get("age"))
+		s.Equal(types.Bool(true), alice.Get("member"))
+		_, ok := m.Get(types.String("bob")).(types.Struct).MaybeGet("member")
+		s.False(ok)
+		db.Close()
+	}
+}
+
+func (s *nomsParquetTestSuite) TestExportFormats() {
+	dsSpec := s.setupPeople()
+
+	file := filepath.Join(s.TempDir, "people.out")
+	s.MustRun(main, []string{"parquet", "export", "--compression", "gzip", dsSpec, file})
+	b, err := ioutil.ReadFile(file)
+	s.NoError(err)
+	s.True(ipc.IsParquet(b))
+
+	s.MustRun(main, []string{"parquet", "export", "--format", "arrow-file", dsSpec, file})
+	b, err = ioutil.ReadFile(file)
+	s.NoError(err)
+	s.Equal("ARROW1", string(b[:6]))
+}
+
+func (s *nomsParquetTestSuite) TestImportStdin() {
+	dsSpec := s.setupPeople()
+	file := filepath.Join(s.TempDir, "people.parquet")
+	s.MustRun(main, []string{"parquet", "export", dsSpec, file})
+
+	f, err := os.Open(file)
+	s.NoError(err)
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	outSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "stdin")
+	s.MustRun(main, []string{"parquet", "import", "--name", "Person", "-", outSpec})
+	db, ds, err := spec.GetDataset(outSpec)
+	s.NoError(err)
+	defer db.Close()
+	l := ds.HeadValue().(types.List)
+	s.Equal(uint64(2), l.Len())
+	s.Equal(types.String("bob"), l.Get(1).(types.Struct).Get("name"))
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/query"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/outputpager"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsQuery = &util.Command{
+	Run:       runQuery,
+	UsageLine: "query <query>",
+	Short:     "Queries a List or Map of structs",
+	Long: `Runs a query of the form SELECT * | <field> [AS <name>], ... FROM <object> [WHERE <condition>] [ORDER BY <field> [ASC | DESC], ...] [LIMIT <n> [OFFSET <m>]] and prints each row it finds, e.g.
+
+  noms query "SELECT name, address.city FROM \"ldb:/data::people\" WHERE age >= 21 AND name LIKE 'a%' ORDER BY name LIMIT 10"
+
+The object must be a List or Map, usually of structs, or a dataset whose head is one. Its fields are named as in a path, e.g. address.city, and _key is the key of each entry of a Map, or the index of each element of a List. Conditions compare fields with each other and with literals, which are 'strings', numbers, TRUE, FALSE and NULL, using =, != (or <>), <, <=, > and >=, IS [NOT] NULL, [NOT] LIKE and [NOT] IN (<literal>, ...), and combine them with AND, OR, NOT and parentheses. Names that aren't just letters, digits, underscores and dots, like most objects, need double quotes.
+
+Conditions on _key are answered by looking the key up, or by scanning the keys between the bounds they give, rather than reading the whole object, and when querying a dataset, so are conditions that a field equals a literal if the dataset has an index named by_<field> made from its head, as kept by the index package.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object.`,
+	Flags: setupQueryFlags,
+	Nargs: 1,
+}
+
+func setupQueryFlags() *flag.FlagSet {
+	queryFlagSet := flag.NewFlagSet("query", flag.ExitOnError)
+	outputpager.RegisterOutputpagerFlags(queryFlagSet)
+	verbose.RegisterVerboseFlags(queryFlagSet)
+	return queryFlagSet
+}
+
+func runQuery(args []string) int {
+	q, err := query.Parse(args[0])
+	d.CheckError(err)
+
+	cfg := config.NewResolver()
+	var res types.List
+	// A dataset is queried by its head, so that its indexes can be used; anything else is taken to be a path.
+	db, ds, err := cfg.GetDataset(q.From)
+	if err == nil {
+		if _, ok := ds.MaybeHeadRef(); ok {
+			defer db.Close()
+			res, err = q.RunDataset(db, ds)
+			d.CheckErrorNoUsage(err)
+		} else {
+			db.Close()
+		}
+	}
+	if res == (types.List{}) {
+		db, value, err := cfg.GetPath(q.From)
+		d.CheckErrorNoUsage(err)
+		defer db.Close()
+		if value == nil {
+			fmt.Fprintf(os.Stderr, "Object not found: %s\n", q.From)
+			return 1
+		}
+		res, err = q.Run(value)
+		d.CheckErrorNoUsage(err)
+	}
+
+	pgr := outputpager.Start()
+	defer pgr.Stop()
+	res.IterAll(func(v types.Value, i uint64) {
+		types.WriteEncodedValue(pgr.Writer, v)
+		fmt.Fprintln(pgr.Writer)
+	})
+	return 0
+}
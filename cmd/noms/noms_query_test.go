@@ -0,0 +1,56 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestNomsQuery(t *testing.T) {
+	suite.Run(t, &nomsQueryTestSuite{})
+}
+
+type nomsQueryTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsQueryTestSuite) TestNomsQuery() {
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "people")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	person := func(name string, age float64) types.Value {
+		return types.NewStruct("Person", types.StructData{"name": types.String(name), "age": types.Number(age)})
+	}
+	_, err = db.CommitValue(ds, types.NewStruct("Town", types.StructData{
+		"people": types.NewMap(
+			types.String("a"), person("Alice", 30),
+			types.String("b"), person("Bob", 17),
+			types.String("c"), person("Carol", 42),
+		),
+	}))
+	s.NoError(err)
+	db.Close()
+
+	out, _ := s.MustRun(main, []string{"query", `SELECT name, _key AS id FROM "` + dsSpec + `.value.people" WHERE age >= 21 ORDER BY age DESC`})
+	s.Equal("Person {\n  id: \"c\",\n  name: \"Carol\",\n}\nPerson {\n  id: \"a\",\n  name: \"Alice\",\n}\n", out)
+
+	// A dataset is queried by its head, which must be a List or a Map.
+	_, stderr, recovered := s.Run(main, []string{"query", `SELECT * FROM "` + dsSpec + `"`})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Can only query a List or a Map")
+	listSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "list")
+	db, ds, err = spec.GetDataset(listSpec)
+	s.NoError(err)
+	_, err = db.CommitValue(ds, types.NewList(person("Alice", 30), person("Bob", 17)))
+	s.NoError(err)
+	db.Close()
+	out, _ = s.MustRun(main, []string{"query", `SELECT name FROM "` + listSpec + `" WHERE _key = 1`})
+	s.Equal("Person {\n  name: \"Bob\",\n}\n", out)
+}
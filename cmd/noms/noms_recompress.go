@@ -0,0 +1,45 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	flag "github.com/juju/gnuflag"
+)
+
+var recompressCodec string
+
+var nomsRecompress = &util.Command{
+	Run:       runRecompress,
+	UsageLine: "recompress [--codec <codec>] <src-dir> <dst-dir>",
+	Short:     "Copies a LevelDB database, compressing its chunks with a different codec",
+	Long:      "recompress copies the LevelDB database in src-dir to a new database in dst-dir, re-encoding every chunk with the given codec. src-dir is left untouched; once the copy completes, dst-dir can replace it.",
+	Flags:     setupRecompressFlags,
+	Nargs:     2,
+}
+
+func setupRecompressFlags() *flag.FlagSet {
+	recompressFlagSet := flag.NewFlagSet("recompress", flag.ExitOnError)
+	recompressFlagSet.StringVar(&recompressCodec, "codec", string(chunks.ZstdCodec), "codec to compress chunks with: none, snappy, flate or zstd")
+	return recompressFlagSet
+}
+
+func runRecompress(args []string) int {
+	codec, err := chunks.ParseCodec(recompressCodec)
+	d.CheckError(err)
+
+	var count int
+	err = d.Try(func() {
+		count = chunks.RecompressLevelDBStore(args[0], args[1], 24, codec)
+	})
+	d.CheckError(d.Unwrap(err))
+
+	fmt.Printf("Recompressed %d chunks with %s into %s\n", count, codec, args[1])
+	return 0
+}
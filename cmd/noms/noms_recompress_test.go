@@ -0,0 +1,42 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestRecompress(t *testing.T) {
+	suite.Run(t, &nomsRecompressTestSuite{})
+}
+
+type nomsRecompressTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsRecompressTestSuite) TestRecompress() {
+	src, dst := s.LdbDir+"/src", s.LdbDir+"/dst"
+
+	db := datas.NewDatabase(chunks.NewLevelDBStore(src, "", 24, false))
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("recompress me"))
+	s.NoError(err)
+	head := ds.HeadRef()
+	db.Close()
+
+	stdout, _ := s.MustRun(main, []string{"recompress", "--codec", "flate", src, dst})
+	s.Contains(stdout, "with flate into "+dst)
+
+	cs := chunks.NewLevelDBStore(dst, "", 24, false)
+	s.Equal(chunks.FlateCodec, cs.Codec())
+	db = datas.NewDatabase(cs)
+	defer db.Close()
+	s.True(head.Equals(db.GetDataset("ds").HeadRef()))
+}
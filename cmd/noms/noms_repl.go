@@ -0,0 +1,282 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/cmd/noms/diff"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/lineedit"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsRepl = &util.Command{
+	Run:       runRepl,
+	UsageLine: "repl [<database>]",
+	Short:     "Explore a database interactively",
+	Long: `repl opens a database, the default one if none is given, and keeps it open while you explore it with the commands below. Paths are relative to the database, e.g. photos.value.originals or #2qi4jh5ka7cs0g4bnfjsrre3u6ds7m5n.value, and tab completes command names, dataset names and the fields of structs.
+
+Type help in the repl for its commands.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.`,
+	Flags: setupReplFlags,
+	Nargs: 0,
+}
+
+func setupReplFlags() *flag.FlagSet {
+	return flag.NewFlagSet("repl", flag.ExitOnError)
+}
+
+type replCommand struct {
+	usage string
+	help  string
+	nargs int
+	run   func(r *repl, args []string) error
+}
+
+var replCommands = map[string]replCommand{
+	"ls":     {"ls [<path>]", "lists the datasets, or the fields, keys or length of the value at the path", 0, (*repl).ls},
+	"show":   {"show <path>", "prints the value at the path", 1, (*repl).show},
+	"type":   {"type <path>", "prints the type of the value at the path", 1, (*repl).showType},
+	"log":    {"log <dataset> [<count>]", "lists the most recent commits of the dataset, 10 unless count is given", 1, (*repl).log},
+	"diff":   {"diff <path> <path>", "prints the differences between the values at the paths", 2, (*repl).diff},
+	"rebase": {"rebase", "picks up commits made to the database since it was opened", 0, (*repl).rebase},
+	"help":   {"help", "prints this help", 0, nil},
+	"quit":   {"quit", "leaves the repl, as do exit and Ctrl-D", 0, nil},
+}
+
+type repl struct {
+	db  datas.Database
+	out io.Writer
+}
+
+func runRepl(args []string) int {
+	dbSpec := ""
+	if len(args) > 0 {
+		dbSpec = args[0]
+	}
+	db, err := config.NewResolver().GetDatabase(dbSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	r := &repl{db, os.Stdout}
+	ed := lineedit.New(os.Stdin, os.Stdout, "noms> ", r.complete)
+	for {
+		line, err := ed.ReadLine()
+		if err == lineedit.ErrInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			return 0
+		}
+		d.CheckErrorNoUsage(err)
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return 0
+		}
+		if err := r.run(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+	}
+}
+
+// run runs the repl command |name|. Panics from reading the database are returned as errors, so that a bad path doesn't end the session.
+func (r *repl) run(name string, args []string) error {
+	if name == "help" {
+		// help lists replCommands, so it can't be in it.
+		r.help()
+		return nil
+	}
+	cmd, ok := replCommands[name]
+	if !ok || cmd.run == nil {
+		return fmt.Errorf("Unknown command %s, type help for the commands", name)
+	}
+	if len(args) < cmd.nargs {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	var err error
+	if perr := d.Try(func() { err = cmd.run(r, args) }); perr != nil {
+		return d.Unwrap(perr)
+	}
+	return err
+}
+
+func (r *repl) resolve(path string) (types.Value, error) {
+	p, err := spec.NewAbsolutePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v := p.Resolve(r.db)
+	if v == nil {
+		return nil, fmt.Errorf("Object not found: %s", path)
+	}
+	return v, nil
+}
+
+func (r *repl) ls(args []string) error {
+	if len(args) == 0 {
+		r.db.Datasets().IterAll(func(k, v types.Value) {
+			fmt.Fprintln(r.out, k)
+		})
+		return nil
+	}
+	v, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case types.Struct:
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, t *types.Type) {
+			fmt.Fprintf(r.out, "%s: %s\n", name, t.Describe())
+		})
+	case types.Map:
+		v.IterAll(func(k, _ types.Value) {
+			types.WriteEncodedValue(r.out, k)
+			fmt.Fprintln(r.out)
+		})
+	case types.Set:
+		v.IterAll(func(v types.Value) {
+			types.WriteEncodedValue(r.out, v)
+			fmt.Fprintln(r.out)
+		})
+	case types.List:
+		fmt.Fprintf(r.out, "%d elements\n", v.Len())
+	case types.Blob:
+		fmt.Fprintf(r.out, "%d bytes\n", v.Len())
+	default:
+		types.WriteEncodedValue(r.out, v)
+		fmt.Fprintln(r.out)
+	}
+	return nil
+}
+
+func (r *repl) show(args []string) error {
+	v, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if err = types.WriteEncodedValue(r.out, v); err == nil {
+		fmt.Fprintln(r.out)
+	}
+	return err
+}
+
+func (r *repl) showType(args []string) error {
+	v, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, v.Type().Describe())
+	return nil
+}
+
+func (r *repl) log(args []string) error {
+	count := 10
+	if len(args) > 1 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("Invalid count %s", args[1])
+		}
+	}
+	commit, ok := r.db.GetDataset(args[0]).MaybeHead()
+	if !ok {
+		return fmt.Errorf("Dataset %s not found", args[0])
+	}
+	for i := 0; i < count; i++ {
+		date := "-"
+		if t, ok := spec.CommitMetaDate(commit); ok {
+			date = t.Format(time.RFC3339)
+		}
+		fmt.Fprintf(r.out, "#%s %s\n", commit.Hash().String(), date)
+		parents := commitRefsFromSet(commit.Get(datas.ParentsField).(types.Set))
+		if len(parents) == 0 {
+			break
+		}
+		commit = parents[0].TargetValue(r.db).(types.Struct)
+	}
+	return nil
+}
+
+func (r *repl) diff(args []string) error {
+	v1, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	v2, err := r.resolve(args[1])
+	if err != nil {
+		return err
+	}
+	return diff.Diff(r.out, v1, v2, false)
+}
+
+func (r *repl) rebase(args []string) error {
+	r.db.Rebase()
+	return nil
+}
+
+func (r *repl) help() {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%-24s %s\n", replCommands[name].usage, replCommands[name].help)
+	}
+}
+
+// complete returns the completions of |line|: command names for the first word, and dataset names, or the fields of the struct at the path so far, for the rest.
+func (r *repl) complete(line string) (completions []string) {
+	i := strings.LastIndex(line, " ")
+	if i < 0 {
+		for name := range replCommands {
+			if strings.HasPrefix(name, line) {
+				completions = append(completions, name+" ")
+			}
+		}
+		return
+	}
+	before, word := line[:i+1], line[i+1:]
+
+	dot := strings.LastIndex(word, ".")
+	if dot < 0 {
+		r.db.Datasets().IterAll(func(k, v types.Value) {
+			if name := string(k.(types.String)); strings.HasPrefix(name, word) {
+				completions = append(completions, before+name)
+			}
+		})
+		return
+	}
+	d.Try(func() {
+		v, err := r.resolve(word[:dot])
+		if err != nil {
+			return
+		}
+		if s, ok := v.(types.Struct); ok {
+			s.Type().Desc.(types.StructDesc).IterFields(func(name string, t *types.Type) {
+				if strings.HasPrefix(name, word[dot+1:]) {
+					completions = append(completions, before+word[:dot+1]+name)
+				}
+			})
+		}
+	})
+	return
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsRepl(t *testing.T) {
+	suite.Run(t, &nomsReplTestSuite{})
+}
+
+type nomsReplTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsReplTestSuite) setupDatabase(name string) string {
+	dir := filepath.Join(s.LdbDir, name)
+	db := datas.NewDatabase(chunks.NewLevelDBStore(dir, "", 24, false))
+	defer db.Close()
+	ds, err := db.CommitValue(db.GetDataset("photos"), types.NewStruct("Photo", types.StructData{
+		"title": types.String("beach"),
+		"tags":  types.NewSet(types.String("sea"), types.String("sand")),
+	}))
+	s.NoError(err)
+	_, err = db.CommitValue(ds, types.NewStruct("Photo", types.StructData{
+		"title": types.String("beach at dusk"),
+		"tags":  types.NewSet(types.String("sea"), types.String("sand")),
+	}))
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("places"), types.String("here"))
+	s.NoError(err)
+	return spec.CreateDatabaseSpecString("ldb", dir)
+}
+
+// runRepl runs the repl on |dbSpec| with |input| as its stdin.
+func (s *nomsReplTestSuite) runRepl(dbSpec, input string) (stdout, stderr string) {
+	f, err := ioutil.TempFile(s.TempDir, "stdin")
+	s.NoError(err)
+	defer f.Close()
+	_, err = f.WriteString(input)
+	s.NoError(err)
+	_, err = f.Seek(0, 0)
+	s.NoError(err)
+
+	origStdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = origStdin }()
+	return s.MustRun(main, []string{"repl", dbSpec})
+}
+
+func (s *nomsReplTestSuite) TestCommands() {
+	dbSpec := s.setupDatabase("commands")
+	stdout, stderr := s.runRepl(dbSpec, `ls
+ls photos.value
+type photos.value.tags
+ls photos.value.tags
+log photos
+diff photos~1.value photos.value
+bogus
+show photos.value.nope
+show photos.value.title
+quit
+show photos.value.title
+`)
+	s.Contains(stdout, "photos\nplaces\ntags: Set<String>\ntitle: String\nSet<String>\n\"sand\"\n\"sea\"\n")
+	s.Equal(2, strings.Count(stdout, " -\n"), "log should print both commits")
+	s.Contains(stdout, "-   title: \"beach\"\n+   title: \"beach at dusk\"\n")
+	s.Equal(1, strings.Count(stdout, "\n\"beach at dusk\"\n"), "quit should end the repl")
+	s.Contains(stderr, "error: Unknown command bogus")
+	s.Contains(stderr, "error: Object not found: photos.value.nope")
+}
+
+func (s *nomsReplTestSuite) TestComplete() {
+	dbSpec := s.setupDatabase("complete")
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	defer db.Close()
+	r := &repl{db, ioutil.Discard}
+
+	s.Equal([]string{"show "}, r.complete("sh"))
+	s.Equal([]string{"show photos", "show places"}, r.complete("show p"))
+	s.Equal([]string{"ls photos.value"}, r.complete("ls photos.v"))
+	s.Equal([]string{"ls photos.value.tags", "ls photos.value.title"}, r.complete("ls photos.value.t"))
+	s.Empty(r.complete("ls nowhere.value.t"))
+	s.Empty(r.complete("ls photos.value.title.x"))
+}
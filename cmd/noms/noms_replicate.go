@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/replicate"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var (
+	replicateInterval time.Duration
+	replicateProgress string
+	replicateOnce     bool
+)
+
+var nomsReplicate = &util.Command{
+	Run:       runReplicate,
+	UsageLine: "replicate [options] <source-database> <dest-database>...",
+	Short:     "Continuously copies all datasets of a database to one or more others",
+	Long:      "Keeps each destination database a mirror of the source, e.g. as a hot standby, by copying new chunks and dataset heads whenever the source changes. Datasets deleted from the source are deleted from the destinations, which shouldn't be written to by anything else.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database arguments.",
+	Flags:     setupReplicateFlags,
+	Nargs:     2,
+}
+
+func setupReplicateFlags() *flag.FlagSet {
+	replicateFlagSet := flag.NewFlagSet("replicate", flag.ExitOnError)
+	replicateFlagSet.IntVar(&p, "p", 512, "parallelism")
+	replicateFlagSet.DurationVar(&replicateInterval, "interval", time.Second, "how often to check the source for changes")
+	replicateFlagSet.StringVar(&replicateProgress, "progress", "", "file in which to record how far replication has got, so it can resume without revisiting up to date destinations")
+	replicateFlagSet.BoolVar(&replicateOnce, "once", false, "replicate the current state of the source, then exit")
+	spec.RegisterDatabaseFlags(replicateFlagSet)
+	verbose.RegisterVerboseFlags(replicateFlagSet)
+	return replicateFlagSet
+}
+
+func runReplicate(args []string) int {
+	cfg := config.NewResolver()
+	src, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer src.Close()
+
+	dests := []replicate.Destination{}
+	for _, arg := range args[1:] {
+		db, err := cfg.GetDatabase(arg)
+		d.CheckError(err)
+		defer db.Close()
+		dests = append(dests, replicate.Destination{Name: cfg.ResolveDbSpec(arg), DB: db})
+	}
+
+	var r *replicate.Replicator
+	d.CheckErrorNoUsage(d.Try(func() {
+		r = replicate.New(src, dests, p, replicateProgress)
+	}))
+
+	report := func(updated int, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Replication failed, will retry: %s\n", err)
+		} else if updated > 0 {
+			fmt.Printf("Replicated %d dataset change(s) from %s\n", updated, args[0])
+		}
+	}
+	if replicateOnce {
+		updated, err := r.Sync()
+		d.CheckErrorNoUsage(err)
+		report(updated, nil)
+		return 0
+	}
+
+	stop := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		close(stop)
+	}()
+	r.Run(replicateInterval, stop, report)
+	return 0
+}
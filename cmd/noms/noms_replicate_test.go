@@ -0,0 +1,50 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestReplicate(t *testing.T) {
+	suite.Run(t, &nomsReplicateTestSuite{})
+}
+
+type nomsReplicateTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsReplicateTestSuite) TestReplicateOnce() {
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	_, err := sourceDB.CommitValue(sourceDB.GetDataset("ds1"), types.Number(42))
+	s.NoError(err)
+	_, err = sourceDB.CommitValue(sourceDB.GetDataset("ds2"), types.String("hello"))
+	s.NoError(err)
+	sourceDB.Close()
+
+	dest1, dest2 := path.Join(s.TempDir, "dest1"), path.Join(s.TempDir, "dest2")
+	progress := path.Join(s.TempDir, "progress")
+	args := []string{"replicate", "--once", "--progress", progress, spec.CreateDatabaseSpecString("ldb", s.LdbDir), spec.CreateDatabaseSpecString("ldb", dest1), spec.CreateDatabaseSpecString("ldb", dest2)}
+	sout, _ := s.MustRun(main, args)
+	s.Contains(sout, "Replicated 4 dataset change(s)")
+
+	for _, dir := range []string{dest1, dest2} {
+		db := datas.NewDatabase(chunks.NewLevelDBStore(dir, "", 1, false))
+		s.True(types.Number(42).Equals(db.GetDataset("ds1").HeadValue()))
+		s.True(types.String("hello").Equals(db.GetDataset("ds2").HeadValue()))
+		db.Close()
+	}
+
+	sout, _ = s.MustRun(main, args)
+	s.Equal("", sout)
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/retention"
+	"github.com/stormasm/noms/go/types"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	retentionEvery  time.Duration
+	retentionDryRun bool
+)
+
+var nomsRetention = &util.Command{
+	Run:       runRetention,
+	UsageLine: "retention [--every <interval>] [--dry-run] <policy-file> <database>",
+	Short:     "Prunes the histories of datasets according to retention policies",
+	Long: `retention rewrites the history of each dataset of the database that the policy file has a policy for, so that it only has the commits the policy keeps: the latest keep_last commits, and for each of the last keep_daily days, the latest commit made that day, by the date in its meta, in UTC. The head is always kept. The policy file is TOML, with a table for each dataset, or for each pattern, as understood by path.Match, of datasets, e.g.
+
+  [dataset.events]
+  keep_last = 1000
+
+  [dataset."metrics-*"]
+  keep_last = 10
+  keep_daily = 90
+
+With --every, the policies are applied again every interval, until retention is interrupted.
+
+Noms doesn't delete chunks in place: the space the dropped commits took is reclaimed when the database is copied, with noms backup and noms restore, or noms sync, which only copy the chunks that are still reachable.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.`,
+	Flags: setupRetentionFlags,
+	Nargs: 2,
+}
+
+func setupRetentionFlags() *flag.FlagSet {
+	retentionFlagSet := flag.NewFlagSet("retention", flag.ExitOnError)
+	retentionFlagSet.DurationVar(&retentionEvery, "every", 0, "if set, apply the policies again every interval")
+	retentionFlagSet.BoolVar(&retentionDryRun, "dry-run", false, "print what would be kept without changing anything")
+	return retentionFlagSet
+}
+
+func runRetention(args []string) int {
+	c, err := retention.LoadConfig(args[0])
+	d.CheckErrorNoUsage(err)
+	db, err := config.NewResolver().GetDatabase(args[1])
+	d.CheckError(err)
+	defer db.Close()
+
+	for {
+		if retentionDryRun {
+			planRetention(db, c)
+			return 0
+		}
+		results, err := retention.PruneAll(db, c, time.Now())
+		printRetention(results)
+		d.CheckErrorNoUsage(err)
+		if retentionEvery <= 0 {
+			return 0
+		}
+		time.Sleep(retentionEvery)
+		db.Rebase()
+	}
+}
+
+func printRetention(results map[string]retention.Result) {
+	ids := []string{}
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		res := results[id]
+		if res.Before == res.After {
+			fmt.Printf("%s: kept all %d commits\n", id, res.Commits)
+		} else {
+			fmt.Printf("%s: kept %d of %d commits, head #%s is now #%s\n", id, res.Kept, res.Commits, res.Before.String(), res.After.String())
+		}
+	}
+}
+
+func planRetention(db datas.Database, c *retention.Config) {
+	db.Datasets().IterAll(func(k, v types.Value) {
+		id := string(k.(types.String))
+		p, ok := c.PolicyFor(id)
+		if !ok {
+			return
+		}
+		kept, commits := retention.Plan(db, db.GetDataset(id).Head(), p, time.Now())
+		fmt.Printf("%s: would keep %d of %d commits\n", id, len(kept), commits)
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestNomsRetention(t *testing.T) {
+	suite.Run(t, &nomsRetentionTestSuite{})
+}
+
+type nomsRetentionTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsRetentionTestSuite) TestRetention() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	db, err := spec.GetDatabase(dbSpec)
+	s.NoError(err)
+	for _, id := range []string{"logs", "other"} {
+		ds := db.GetDataset(id)
+		for i := 0; i < 5; i++ {
+			ds, err = db.CommitValue(ds, types.Number(i))
+			s.NoError(err)
+		}
+	}
+	db.Close()
+	policies := filepath.Join(s.TempDir, "retention.toml")
+	s.NoError(ioutil.WriteFile(policies, []byte("[dataset.\"log*\"]\nkeep_last = 2\n"), 0644))
+
+	out, _ := s.MustRun(main, []string{"retention", "--dry-run", policies, dbSpec})
+	s.Equal("logs: would keep 2 of 5 commits\n", out)
+	out, _ = s.MustRun(main, []string{"retention", policies, dbSpec})
+	s.Contains(out, "logs: kept 2 of 5 commits, head #")
+	out, _ = s.MustRun(main, []string{"retention", policies, dbSpec})
+	s.Equal("logs: kept all 2 commits\n", out)
+
+	out, _ = s.MustRun(main, []string{"log", "--oneline", dbSpec + "::other"})
+	s.Len(strings.Split(strings.TrimSpace(out), "\n"), 5)
+}
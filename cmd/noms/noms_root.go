@@ -0,0 +1,118 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	rootHistory    bool
+	rootHistoryLen int
+	rootSet        string
+	rootForce      bool
+)
+
+var nomsRoot = &util.Command{
+	Run:       runRoot,
+	UsageLine: "root [--history [-n <count>] | --set <hash> --force] <database>",
+	Short:     "Shows, and for disaster recovery sets, the root of a database",
+	Long: `With no options, root prints the hash of the current root of the database, the map from dataset names to their heads.
+
+--history lists the previous roots of the database, most recent first, with when each became the root and how many datasets it had. Only LevelDB databases keep a history of their roots, of the last 1024 of them.
+
+--set makes the database's root the given hash, which must be the hash of a map of datasets in the database, e.g. a root from --history. This rolls every dataset in the database back to how it was at that root, which is a way to recover from a bad bulk operation, but also throws away everything committed since; it needs --force to be sure you mean it.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.`,
+	Flags: setupRootFlags,
+	Nargs: 1,
+}
+
+func setupRootFlags() *flag.FlagSet {
+	rootFlagSet := flag.NewFlagSet("root", flag.ExitOnError)
+	rootFlagSet.BoolVar(&rootHistory, "history", false, "list the previous roots of the database")
+	rootFlagSet.IntVar(&rootHistoryLen, "n", 20, "number of roots to list with --history")
+	rootFlagSet.StringVar(&rootSet, "set", "", "set the root of the database to this hash")
+	rootFlagSet.BoolVar(&rootForce, "force", false, "really set the root, discarding everything committed since")
+	return rootFlagSet
+}
+
+func runRoot(args []string) int {
+	if rootHistory && rootSet != "" {
+		d.CheckError(fmt.Errorf("--history and --set can't be used together"))
+	}
+	cs, err := config.NewResolver().GetChunkStore(args[0])
+	d.CheckError(err)
+	defer cs.Close()
+
+	switch {
+	case rootHistory:
+		var log []chunks.RootLogEntry
+		if rl, ok := cs.(chunks.RootLogger); ok {
+			log = rl.RootLog(rootHistoryLen)
+		}
+		if log == nil {
+			d.CheckErrorNoUsage(fmt.Errorf("%s doesn't keep a history of its roots", args[0]))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for i, e := range log {
+			current := ""
+			if i == 0 && e.Root == cs.Root() {
+				current = "\t(current)"
+			}
+			fmt.Fprintf(w, "#%s\t%s\t%s%s\n", e.Root.String(), e.Time.Format(time.RFC3339), describeRoot(cs, e.Root), current)
+		}
+		w.Flush()
+	case rootSet != "":
+		h, ok := hash.MaybeParse(rootSet)
+		if !ok {
+			d.CheckError(fmt.Errorf("Invalid hash %s", rootSet))
+		}
+		if !rootForce {
+			d.CheckErrorNoUsage(fmt.Errorf("Setting the root discards everything committed since %s was the root; use --force if that's what you want", h.String()))
+		}
+		c := cs.Get(h)
+		if c.IsEmpty() {
+			d.CheckErrorNoUsage(fmt.Errorf("%s not found in %s", h.String(), args[0]))
+		}
+		if _, ok := types.DecodeValue(c, nil).(types.Map); !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("%s isn't a database root, which is a Map of datasets", h.String()))
+		}
+		last := cs.Root()
+		if !cs.UpdateRoot(h, last) {
+			d.CheckErrorNoUsage(fmt.Errorf("The root of %s changed while it was being set, try again", args[0]))
+		}
+		fmt.Printf("Root set to #%s (was #%s)\n", h.String(), last.String())
+	default:
+		fmt.Printf("#%s\n", cs.Root().String())
+	}
+	return 0
+}
+
+// describeRoot returns the number of datasets in the root |h| of |cs|, or a note that the root's gone if it can't be read.
+func describeRoot(cs chunks.ChunkStore, h hash.Hash) string {
+	if h.IsEmpty() {
+		return "0 datasets"
+	}
+	c := cs.Get(h)
+	if c.IsEmpty() {
+		return "missing"
+	}
+	if m, ok := types.DecodeValue(c, nil).(types.Map); ok {
+		return fmt.Sprintf("%d datasets", m.Len())
+	}
+	return "not a Map"
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsRoot(t *testing.T) {
+	suite.Run(t, &nomsRootTestSuite{})
+}
+
+type nomsRootTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsRootTestSuite) TestHistoryAndSet() {
+	dir := s.LdbDir + "/root"
+	cs := chunks.NewLevelDBStore(dir, "", 24, false)
+	db := datas.NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("good"), types.String("keep me"))
+	s.NoError(err)
+	good := cs.Root()
+	_, err = db.CommitValue(db.GetDataset("bad"), types.String("oops"))
+	s.NoError(err)
+	_, err = db.Delete(ds)
+	s.NoError(err)
+	bad := cs.Root()
+	db.Close()
+
+	dbSpec := spec.CreateDatabaseSpecString("ldb", dir)
+	stdout, _ := s.MustRun(main, []string{"root", dbSpec})
+	s.Equal("#"+bad.String()+"\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"root", "--history", dbSpec})
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	s.Len(lines, 3)
+	s.Contains(lines[0], "#"+bad.String())
+	s.Contains(lines[0], "1 datasets")
+	s.Contains(lines[0], "(current)")
+	s.Contains(lines[2], "#"+good.String())
+	s.NotContains(lines[2], "(current)")
+
+	stdout, _ = s.MustRun(main, []string{"root", "--history", "-n", "1", dbSpec})
+	s.Equal(1, strings.Count(stdout, "\n"))
+
+	_, _, recovered := s.Run(main, []string{"root", "--set", good.String(), dbSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+
+	stdout, _ = s.MustRun(main, []string{"root", "--set", good.String(), "--force", dbSpec})
+	s.Equal("Root set to #"+good.String()+" (was #"+bad.String()+")\n", stdout)
+
+	db = datas.NewDatabase(chunks.NewLevelDBStore(dir, "", 24, false))
+	defer db.Close()
+	s.Equal(types.String("keep me"), db.GetDataset("good").HeadValue())
+	_, ok := db.GetDataset("bad").MaybeHeadRef()
+	s.False(ok)
+}
+
+func (s *nomsRootTestSuite) TestSetNotARoot() {
+	dir := s.LdbDir + "/notroot"
+	cs := chunks.NewLevelDBStore(dir, "", 24, false)
+	db := datas.NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("value"))
+	s.NoError(err)
+	commit := ds.HeadRef().TargetHash()
+	db.Close()
+
+	dbSpec := spec.CreateDatabaseSpecString("ldb", dir)
+	_, stderr, recovered := s.Run(main, []string{"root", "--set", commit.String(), "--force", dbSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "isn't a database root")
+}
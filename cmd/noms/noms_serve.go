@@ -5,11 +5,22 @@
 package main
 
 import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/datas"
@@ -20,14 +31,29 @@ import (
 )
 
 var (
-	port int
+	port        int
+	metricsPort int
+	quota       uint64
+	tlsCert     string
+	tlsKey      string
+	accessFile  string
+	storeRoot   string
+	idleTimeout time.Duration
+	requestLog  string
+	servePprof  bool
+	readOnly    bool
+	public      string
+	serveGRPC   bool
 )
 
+// serveDbNameRe matches the names of the databases noms serve --store-root hosts, which are directories under the root.
+var serveDbNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-_.]*$`)
+
 var nomsServe = &util.Command{
 	Run:       runServe,
 	UsageLine: "serve [options] <database>",
-	Short:     "Serves a Noms database over HTTP",
-	Long:      "See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Short:     "Serves a Noms database over HTTP or gRPC",
+	Long:      "With --tls-cert and --tls-key, the database is served over HTTPS instead.\n\nWith --access, requests must present a bearer token, e.g. the auth_token of a .nomsconfig alias, which the access file grants access to; the file also says what requests without a token may do. For example:\n\n  [anonymous]\n  read = [\"*\"]\n\n  [token.alice]\n  token = \"7e3f1c...\"\n  write = [\"*\"]\n\nDatasets may be named or matched with patterns like \"photos-*\", and being able to write a dataset implies being able to read it. Chunks aren't kept per dataset, so any token that may read some dataset may read them all, and reads can only be granted to every dataset, \"*\"; writes are checked dataset by dataset.\n\nWith --read-only, every write is rejected with 403 Forbidden. With --public, which implies --read-only, only the datasets matching its comma-separated patterns, e.g. --public=\"photos-*,index\", are listed, so clients only see those; the rest of the chunks can still be read by anyone who knows their hashes.\n\nThe value at the head of each dataset can also be queried with GraphQL, e.g. by web frontends, at /graphql/?ds=<dataset>, through a schema generated from its type. Such queries only need access to read that dataset.\n\nWith --grpc, the database is served over gRPC instead, as the service described by go/datas/grpc.proto, to grpc://host:port specs, or grpcs://host:port ones with --tls-cert and --tls-key. The tokens of calls are checked against --access in the same way, and writes to a --read-only server fail with PERMISSION_DENIED. GraphQL queries, --store-root and --request-log aren't supported over gRPC.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
 	Flags:     setupServeFlags,
 	Nargs:     0,
 }
@@ -35,6 +61,18 @@ var nomsServe = &util.Command{
 func setupServeFlags() *flag.FlagSet {
 	serveFlagSet := flag.NewFlagSet("serve", flag.ExitOnError)
 	serveFlagSet.IntVar(&port, "port", 8000, "port to listen on for HTTP requests")
+	serveFlagSet.Uint64Var(&quota, "quota", 0, "if set, maximum size in bytes of the database; writes that would exceed it fail with 507 Insufficient Storage")
+	serveFlagSet.StringVar(&tlsCert, "tls-cert", "", "if set, with --tls-key, file containing the certificate to serve HTTPS with")
+	serveFlagSet.StringVar(&tlsKey, "tls-key", "", "file containing the private key for --tls-cert")
+	serveFlagSet.StringVar(&accessFile, "access", "", "if set, TOML file granting access to bearer tokens; see above")
+	serveFlagSet.IntVar(&metricsPort, "metrics-port", 0, "if set, port on which to serve request metrics in the Prometheus format at /metrics, and chunk store metrics as JSON at /debug/vars")
+	serveFlagSet.BoolVar(&servePprof, "pprof", false, "with --metrics-port, also serve the Go profiler at /debug/pprof/")
+	serveFlagSet.StringVar(&requestLog, "request-log", "", "if set, file to append a line of JSON to for each request, or - for stdout")
+	serveFlagSet.BoolVar(&readOnly, "read-only", false, "reject every request that would write to the database")
+	serveFlagSet.StringVar(&public, "public", "", "if set, comma-separated patterns of the only datasets to serve, read-only; see above")
+	serveFlagSet.StringVar(&storeRoot, "store-root", "", "if set, directory whose subdirectories are the databases to serve; see above")
+	serveFlagSet.BoolVar(&serveGRPC, "grpc", false, "serve the database over gRPC on --port instead of HTTP; see above")
+	serveFlagSet.DurationVar(&idleTimeout, "idle-timeout", datas.DefaultIdleTimeout, "with --store-root, how long to keep each database open after its last request")
 	spec.RegisterDatabaseFlags(serveFlagSet)
 	verbose.RegisterVerboseFlags(serveFlagSet)
 	profile.RegisterProfileFlags(serveFlagSet)
@@ -42,27 +80,135 @@ func setupServeFlags() *flag.FlagSet {
 }
 
 func runServe(args []string) int {
-	cfg := config.NewResolver()
-	db := ""
+	if (tlsCert == "") != (tlsKey == "") {
+		d.CheckError(fmt.Errorf("--tls-cert and --tls-key must be given together"))
+	}
+	var access *datas.AccessControl
+	if accessFile != "" {
+		var err error
+		access, err = datas.LoadAccessControl(accessFile)
+		d.CheckErrorNoUsage(err)
+	}
+
+	if serveGRPC && (storeRoot != "" || requestLog != "") {
+		d.CheckError(fmt.Errorf("--store-root and --request-log can't be used with --grpc"))
+	}
+	if servePprof && metricsPort == 0 {
+		d.CheckError(fmt.Errorf("--pprof needs --metrics-port"))
+	}
+	var serverMetrics *datas.ServerMetrics
+	if metricsPort != 0 {
+		serverMetrics = datas.NewServerMetrics()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", serverMetrics)
+		mux.Handle("/debug/vars", expvar.Handler())
+		if servePprof {
+			mux.HandleFunc("/debug/pprof/", pprof.Index)
+			mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+			mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+			mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+			mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		}
+		go func() {
+			d.CheckError(http.ListenAndServe(fmt.Sprintf(":%d", metricsPort), mux))
+		}()
+	}
+	var logWriter io.Writer
+	if requestLog == "-" {
+		logWriter = os.Stdout
+	} else if requestLog != "" {
+		f, err := os.OpenFile(requestLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		d.CheckErrorNoUsage(err)
+		defer f.Close()
+		logWriter = f
+	}
+	// The AccountingStore of each database is kept once it's closed, so that when --store-root reopens the database, its chunks needn't all be counted again.
+	accountedMu := &sync.Mutex{}
+	accounted := map[string]*chunks.AccountingStore{}
+	wrap := func(cs chunks.ChunkStore, metricsName string) chunks.ChunkStore {
+		if quota != 0 {
+			accountedMu.Lock()
+			prev, ok := accounted[metricsName]
+			accountedMu.Unlock()
+			var as *chunks.AccountingStore
+			if ok {
+				as = chunks.NewAccountingStoreWithStats(cs, quota, prev.Stats())
+			} else {
+				as = chunks.NewAccountingStore(cs, quota)
+			}
+			accountedMu.Lock()
+			accounted[metricsName] = as
+			accountedMu.Unlock()
+			cs = as
+		}
+		if metricsPort != 0 {
+			cs = chunks.NewMeteredStore(cs, chunks.NewExpvarMetrics(metricsName))
+		}
+		if public != "" {
+			cs = datas.NewPublishedStore(cs, strings.Split(public, ","))
+		}
+		return cs
+	}
+
+	if serveGRPC {
+		cs, err := config.NewResolver().GetChunkStore(serveDbArg(args))
+		d.CheckError(err)
+		server := datas.NewGRPCServer(wrap(cs, "chunks"), port)
+		server.TLSCertFile, server.TLSKeyFile = tlsCert, tlsKey
+		server.Access = access
+		server.ReadOnly = readOnly || public != ""
+		return runUntilSignalled(server.Run, server.Stop)
+	}
+
+	var server *datas.RemoteDatabaseServer
+	if storeRoot != "" {
+		if len(args) > 0 {
+			d.CheckError(fmt.Errorf("A database can't be given with --store-root"))
+		}
+		server = datas.NewMultiDatabaseServer(func(name string) (chunks.ChunkStore, error) {
+			dir := filepath.Join(storeRoot, name)
+			if fi, err := os.Stat(dir); !serveDbNameRe.MatchString(name) || err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("No database %s", name)
+			}
+			cs, err := spec.GetChunkStore("ldb:" + dir)
+			if err != nil {
+				return nil, err
+			}
+			return wrap(cs, "chunks/"+name), nil
+		}, idleTimeout, port)
+	} else {
+		cs, err := config.NewResolver().GetChunkStore(serveDbArg(args))
+		d.CheckError(err)
+		server = datas.NewRemoteDatabaseServer(wrap(cs, "chunks"), port)
+	}
+	server.TLSCertFile, server.TLSKeyFile = tlsCert, tlsKey
+	server.Access = access
+	server.ReadOnly = readOnly || public != ""
+	server.Log, server.Metrics = logWriter, serverMetrics
+	return runUntilSignalled(server.Run, server.Stop)
+}
+
+// serveDbArg returns the database argument of noms serve, or "" for the default database.
+func serveDbArg(args []string) string {
 	if len(args) > 0 {
-		db = args[0]
+		return args[0]
 	}
-	cs, err := cfg.GetChunkStore(db)
-	d.CheckError(err)
-	server := datas.NewRemoteDatabaseServer(cs, port)
+	return ""
+}
 
-	// Shutdown server gracefully so that profile may be written
+// runUntilSignalled calls |run|, and calls |stop| when the process is interrupted or terminated, so that run returns and the profile may be written.
+func runUntilSignalled(run, stop func()) int {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	signal.Notify(c, syscall.SIGTERM)
 	go func() {
 		<-c
-		server.Stop()
+		stop()
 	}()
 
 	d.Try(func() {
 		defer profile.MaybeStartProfile().Stop()
-		server.Run()
+		run()
 	})
 	return 0
 }
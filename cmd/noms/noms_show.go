@@ -7,33 +7,49 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/stormasm/noms/cmd/util"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/outputpager"
+	"github.com/stormasm/noms/go/util/valueformat"
 	"github.com/stormasm/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
+var (
+	showFormat     string
+	showExpandRefs int
+)
+
 var nomsShow = &util.Command{
 	Run:       runShow,
-	UsageLine: "show <object>",
+	UsageLine: "show [options] <object>",
 	Short:     "Shows a serialization of a Noms object",
-	Long:      "See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object argument.",
+	Long:      "By default the object is shown the way Noms writes values, along with its type. --format=json, yaml or edn writes it in a format other programs can read instead, e.g. to pipe it into jq. In those formats, refs are written as \"#\" followed by their target hash, unless --expand-refs says how many refs deep to read and show the values they refer to.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object argument.",
 	Flags:     setupShowFlags,
 	Nargs:     1,
 }
 
 func setupShowFlags() *flag.FlagSet {
 	showFlagSet := flag.NewFlagSet("show", flag.ExitOnError)
+	showFlagSet.StringVar(&showFormat, "format", "human", "output format: human, "+strings.Join(valueformat.Formats, ", "))
+	showFlagSet.IntVar(&showExpandRefs, "expand-refs", 0, "with a --format other than human, how many refs deep to show the values refs refer to")
 	outputpager.RegisterOutputpagerFlags(showFlagSet)
 	verbose.RegisterVerboseFlags(showFlagSet)
 	return showFlagSet
 }
 
 func runShow(args []string) int {
+	if showFormat != "human" && !isValueFormat(showFormat) {
+		d.CheckError(fmt.Errorf("Invalid format %s, must be one of human, %s", showFormat, strings.Join(valueformat.Formats, ", ")))
+	}
+	if showExpandRefs < 0 {
+		d.CheckError(fmt.Errorf("--expand-refs must not be negative"))
+	}
+
 	cfg := config.NewResolver()
 	database, value, err := cfg.GetPath(args[0])
 	d.CheckErrorNoUsage(err)
@@ -47,7 +63,20 @@ func runShow(args []string) int {
 	pgr := outputpager.Start()
 	defer pgr.Stop()
 
+	if showFormat != "human" {
+		d.CheckErrorNoUsage(valueformat.Write(pgr.Writer, value, showFormat, database, showExpandRefs))
+		return 0
+	}
 	types.WriteEncodedValueWithTags(pgr.Writer, value)
 	fmt.Fprintln(pgr.Writer)
 	return 0
 }
+
+func isValueFormat(format string) bool {
+	for _, f := range valueformat.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
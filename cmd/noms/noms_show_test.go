@@ -70,3 +70,16 @@ func (s *nomsShowTestSuite) TestNomsShow() {
 	res, _ = s.MustRun(main, []string{"show", str})
 	test.EqualsIgnoreHashes(s.T(), res5, res)
 }
+
+func (s *nomsShowTestSuite) TestNomsShowFormat() {
+	str := spec.CreateValueSpecString("ldb", s.LdbDir, "dsFormat")
+	list := types.NewList(types.String("elem1"), types.Number(2))
+	writeTestData(str, list)
+
+	res, _ := s.MustRun(main, []string{"show", "--format", "json", "--expand-refs", "1", str + ".value"})
+	s.Equal("[\n  \"elem1\",\n  2\n]\n", res)
+	res, _ = s.MustRun(main, []string{"show", "--format", "edn", str + ".value"})
+	s.Regexp(`^#noms/ref "[0-9a-v]{32}"\n$`, res)
+	res, _ = s.MustRun(main, []string{"show", "--format", "yaml", "--expand-refs", "2", str})
+	s.Equal("\"meta\": {}\n\"parents\": []\n\"value\":\n  - \"elem1\"\n  - 2\n", res)
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/sqlite"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	sqliteTable      string
+	sqlitePrimaryKey string
+)
+
+var nomsSqlite = &util.Command{
+	Run:       runSqlite,
+	UsageLine: "sqlite import [options] <db.sqlite> <dataset> | export [options] <path> <db.sqlite>",
+	Short:     "Imports the tables of SQLite databases into datasets, and exports them again",
+	Long: `import reads the tables of a SQLite database, and commits them to a dataset as a Map from the name of each table to a Map of its rows, or with --table, just that table's Map. Each row is a struct named for its table, with a field for each column that isn't NULL: INTEGER and REAL values are Numbers, except in columns declared as BOOLEAN, where they're Bools, TEXT values are Strings, and BLOBs are Blobs. Rows are keyed by their table's primary key: its value, a struct named Key with a field for each column if it has several, or the rowid if there isn't one.
+
+export writes the value at a path, e.g. a dataset, or its .value, to a new SQLite database. A Map from names to Lists or Maps of structs, as import makes, is written as a table for each, and otherwise the value must be one List or Map of structs, which is written as a table named --table, or the name of the structs. Each table has a column for each field of the structs, declared as BOOLEAN, INTEGER, REAL, TEXT or BLOB. Its primary key is --pk, or the columns the Map is keyed by, so tables round trip; a Map keyed by whole Numbers has them as its INTEGER PRIMARY KEY.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the dataset and path arguments.`,
+	Flags: setupSqliteFlags,
+	Nargs: 3,
+}
+
+func setupSqliteFlags() *flag.FlagSet {
+	sqliteFlagSet := flag.NewFlagSet("sqlite", flag.ExitOnError)
+	sqliteFlagSet.StringVar(&sqliteTable, "table", "", "the table to import, or the name of the table to export")
+	sqliteFlagSet.StringVar(&sqlitePrimaryKey, "pk", "", "comma-separated columns making up the primary key of the table to export")
+	spec.RegisterCommitMetaFlags(sqliteFlagSet)
+	verbose.RegisterVerboseFlags(sqliteFlagSet)
+	return sqliteFlagSet
+}
+
+func runSqlite(args []string) int {
+	if len(args) != 3 {
+		d.CheckError(fmt.Errorf("sqlite %s takes 2 arguments", args[0]))
+	}
+	switch args[0] {
+	case "import":
+		runSqliteImport(args[1], args[2])
+	case "export":
+		runSqliteExport(args[1], args[2])
+	default:
+		d.CheckError(fmt.Errorf("Unknown sqlite subcommand %s", args[0]))
+	}
+	return 0
+}
+
+func runSqliteImport(file, dsSpec string) {
+	f, err := os.Open(file)
+	d.CheckErrorNoUsage(err)
+	defer f.Close()
+	fi, err := f.Stat()
+	d.CheckErrorNoUsage(err)
+	r, err := sqlite.NewReader(f, fi.Size())
+	d.CheckErrorNoUsage(err)
+
+	cfg := config.NewResolver()
+	db, ds, err := cfg.GetDataset(dsSpec)
+	d.CheckError(err)
+	defer db.Close()
+
+	var value types.Map
+	rows := uint64(0)
+	if sqliteTable != "" {
+		t, ok := r.Table(sqliteTable)
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Table %s not found in %s", sqliteTable, file))
+		}
+		value, err = r.ReadTable(t, db)
+		d.CheckErrorNoUsage(err)
+		rows = value.Len()
+	} else {
+		value, err = r.ReadAll(db)
+		d.CheckErrorNoUsage(err)
+		value.IterAll(func(_, t types.Value) {
+			rows += t.(types.Map).Len()
+		})
+	}
+
+	meta, err := spec.CreateCommitMetaStruct(db, "", "", map[string]string{"inputFile": file}, nil)
+	d.CheckErrorNoUsage(err)
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Imported %d rows of %s into %s, new head #%s\n", rows, file, dsSpec, ds.HeadRef().TargetHash().String())
+}
+
+func runSqliteExport(pathSpec, file string) {
+	var pk []string
+	if sqlitePrimaryKey != "" {
+		pk = strings.Split(sqlitePrimaryKey, ",")
+	}
+
+	cfg := config.NewResolver()
+	db, value, err := cfg.GetPath(pathSpec)
+	d.CheckError(err)
+	defer db.Close()
+	if value == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", pathSpec))
+	}
+	if c, ok := value.(types.Struct); ok && datas.IsCommitType(c.Type()) {
+		// A dataset means the value of its head.
+		value = c.Get(datas.ValueField)
+	}
+
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	d.CheckErrorNoUsage(err)
+	defer f.Close()
+	w := sqlite.NewWriter(f)
+	if m, ok := value.(types.Map); ok && isTableMap(m) {
+		if sqliteTable != "" || pk != nil {
+			d.CheckErrorNoUsage(fmt.Errorf("--table and --pk are only for exporting a single table"))
+		}
+		m.IterAll(func(name, t types.Value) {
+			d.CheckErrorNoUsage(w.WriteTable(string(name.(types.String)), t, nil))
+		})
+	} else {
+		name := sqliteTable
+		if name == "" {
+			name = structName(value)
+		}
+		if name == "" {
+			d.CheckErrorNoUsage(fmt.Errorf("The structs at %s have no name, so --table is needed", pathSpec))
+		}
+		d.CheckErrorNoUsage(w.WriteTable(name, value, pk))
+	}
+	d.CheckErrorNoUsage(w.Close())
+}
+
+// isTableMap returns whether |m| is a Map from String names to Lists or Maps, which are tables.
+func isTableMap(m types.Map) bool {
+	elemTypes := m.Type().Desc.(types.CompoundDesc).ElemTypes
+	if elemTypes[0].Kind() != types.StringKind {
+		return false
+	}
+	tableTypes := []*types.Type{elemTypes[1]}
+	if elemTypes[1].Kind() == types.UnionKind {
+		tableTypes = elemTypes[1].Desc.(types.CompoundDesc).ElemTypes
+	}
+	for _, t := range tableTypes {
+		if t.Kind() != types.ListKind && t.Kind() != types.MapKind {
+			return false
+		}
+	}
+	return !m.Empty()
+}
+
+// structName returns the name of the structs in |v|, a List of them or a Map whose values they are, or "" if they don't all have the same one.
+func structName(v types.Value) string {
+	var elemType *types.Type
+	switch v := v.(type) {
+	case types.List:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[0]
+	case types.Map:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[1]
+	default:
+		return ""
+	}
+	structTypes := []*types.Type{elemType}
+	if elemType.Kind() == types.UnionKind {
+		structTypes = elemType.Desc.(types.CompoundDesc).ElemTypes
+	}
+	name := ""
+	for i, t := range structTypes {
+		if t.Kind() != types.StructKind || i > 0 && t.Desc.(types.StructDesc).Name != name {
+			return ""
+		}
+		name = t.Desc.(types.StructDesc).Name
+	}
+	return name
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/sqlite"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestSqlite(t *testing.T) {
+	suite.Run(t, &nomsSqliteTestSuite{})
+}
+
+type nomsSqliteTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsSqliteTestSuite) setupPeople() string {
+	dsSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "people")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	_, err = db.CommitValue(ds, types.NewList(
+		types.NewStruct("Person", types.StructData{"name": types.String("alice"), "age": types.Number(30), "member": types.Bool(true)}),
+		types.NewStruct("Person", types.StructData{"name": types.String("bob"), "age": types.Number(25.5)}),
+	))
+	s.NoError(err)
+	return dsSpec
+}
+
+func (s *nomsSqliteTestSuite) headValue(dsSpec string) types.Value {
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	defer db.Close()
+	return ds.HeadValue()
+}
+
+func (s *nomsSqliteTestSuite) TestExportImport() {
+	dsSpec := s.setupPeople()
+	file := filepath.Join(s.TempDir, "people.sqlite")
+	s.MustRun(main, []string{"sqlite", "export", "--pk", "name", dsSpec, file})
+	b, err := ioutil.ReadFile(file)
+	s.NoError(err)
+	s.True(sqlite.IsSQLite(b))
+
+	outSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "imported")
+	out, _ := s.MustRun(main, []string{"sqlite", "import", file, outSpec})
+	s.Contains(out, "Imported 2 rows of "+file+" into "+outSpec+", new head #")
+
+	// The table is named for the structs, and its rows are keyed by its primary key.
+	tables := s.headValue(outSpec).(types.Map)
+	s.Equal(uint64(1), tables.Len())
+	people := tables.Get(types.String("Person")).(types.Map)
+	alice := people.Get(types.String("alice")).(types.Struct)
+	s.Equal("Person", alice.Type().Desc.(types.StructDesc).Name)
+	s.True(types.NewStruct("Person", types.StructData{"name": types.String("alice"), "age": types.Number(30), "member": types.Bool(true)}).Equals(alice))
+	s.True(types.NewStruct("Person", types.StructData{"name": types.String("bob"), "age": types.Number(25.5)}).Equals(people.Get(types.String("bob"))))
+
+	// A Map of tables round trips.
+	file2 := filepath.Join(s.TempDir, "people2.sqlite")
+	s.MustRun(main, []string{"sqlite", "export", outSpec, file2})
+	outSpec2 := spec.CreateValueSpecString("ldb", s.LdbDir, "imported2")
+	s.MustRun(main, []string{"sqlite", "import", file2, outSpec2})
+	s.True(tables.Equals(s.headValue(outSpec2)))
+
+	outSpec3 := spec.CreateValueSpecString("ldb", s.LdbDir, "table")
+	out, _ = s.MustRun(main, []string{"sqlite", "import", "--table", "person", file2, outSpec3})
+	s.Contains(out, "Imported 2 rows of "+file2)
+	s.True(people.Equals(s.headValue(outSpec3)))
+}
+
+func (s *nomsSqliteTestSuite) TestExportTableName() {
+	dsSpec := s.setupPeople()
+	file := filepath.Join(s.TempDir, "people.sqlite")
+	s.MustRun(main, []string{"sqlite", "export", "--table", "folks", dsSpec + ".value", file})
+
+	outSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "imported")
+	s.MustRun(main, []string{"sqlite", "import", "--table", "folks", file, outSpec})
+	// Without a primary key, rows are keyed by their rowids.
+	folks := s.headValue(outSpec).(types.Map)
+	s.Equal(types.String("bob"), folks.Get(types.Number(2)).(types.Struct).Get("name"))
+}
+
+func (s *nomsSqliteTestSuite) TestErrors() {
+	dsSpec := s.setupPeople()
+	file := filepath.Join(s.TempDir, "people.sqlite")
+	s.MustRun(main, []string{"sqlite", "export", dsSpec, file})
+
+	_, stderr, recovered := s.Run(main, []string{"sqlite", "import", "--table", "nope", file, spec.CreateValueSpecString("ldb", s.LdbDir, "out")})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Table nope not found in "+file)
+
+	_, stderr, recovered = s.Run(main, []string{"sqlite", "export", "--pk", "height", dsSpec, file})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Invalid primary key height")
+
+	notSqlite := filepath.Join(s.TempDir, "not.sqlite")
+	s.NoError(ioutil.WriteFile(notSqlite, []byte("not a database"), 0644))
+	_, _, recovered = s.Run(main, []string{"sqlite", "import", notSqlite, spec.CreateValueSpecString("ldb", s.LdbDir, "out")})
+	s.Equal(clienttest.ExitError{1}, recovered)
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/util/verbose"
+)
+
+var statsLargest int
+
+var nomsStats = &util.Command{
+	Run:       runStats,
+	UsageLine: "stats [--largest <n>] <database>",
+	Short:     "Shows how much storage each dataset uses",
+	Long:      "Traverses the history of every dataset in the database, and reports for each: how many commits it has, the height of its head, and how many chunks are reachable from its head and how big they are. Unique is how much of that isn't reachable from any other dataset, i.e. how much space deleting the dataset would free. The largest chunks of each dataset are listed too.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupStatsFlags,
+	Nargs:     1,
+}
+
+func setupStatsFlags() *flag.FlagSet {
+	statsFlagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+	statsFlagSet.IntVar(&statsLargest, "largest", 3, "number of the largest chunks of each dataset to list")
+	verbose.RegisterVerboseFlags(statsFlagSet)
+	return statsFlagSet
+}
+
+func runStats(args []string) int {
+	if statsLargest < 0 {
+		d.CheckError(fmt.Errorf("--largest must not be negative"))
+	}
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	stats := datas.ComputeDatasetStats(db, statsLargest)
+	if len(stats) == 0 {
+		fmt.Println("No datasets")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Dataset\tCommits\tHeight\tChunks\tTotal\tUnique\t")
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t\n", st.ID, st.Commits, st.HeadHeight, st.Chunks, humanize.Bytes(st.TotalBytes), humanize.Bytes(st.UniqueBytes))
+	}
+	w.Flush()
+
+	for _, st := range stats {
+		if len(st.Largest) == 0 {
+			continue
+		}
+		fmt.Printf("\nLargest chunks of %s:\n", st.ID)
+		for _, cs := range st.Largest {
+			fmt.Printf("  #%s  %8s  %s\n", cs.Hash, humanize.Bytes(cs.Bytes), cs.Desc)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+)
+
+func TestStats(t *testing.T) {
+	suite.Run(t, &nomsStatsTestSuite{})
+}
+
+type nomsStatsTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsStatsTestSuite) TestStats() {
+	dbSpec := spec.CreateDatabaseSpecString("ldb", s.LdbDir)
+	sout, _ := s.MustRun(main, []string{"stats", dbSpec})
+	s.Equal("No datasets\n", sout)
+
+	db := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	big := db.WriteValue(types.String(strings.Repeat("big", 1000)))
+	ds, err := db.CommitValue(db.GetDataset("photos"), types.NewStruct("Photo", types.StructData{"data": big}))
+	s.NoError(err)
+	_, err = db.CommitValue(ds, types.NewStruct("Photo", types.StructData{"data": big, "title": types.String("sunset")}))
+	s.NoError(err)
+	db.Close()
+
+	sout, _ = s.MustRun(main, []string{"stats", "--largest", "1", dbSpec})
+	lines := strings.Split(sout, "\n")
+	s.Equal([]string{"Dataset", "Commits", "Height", "Chunks", "Total", "Unique"}, strings.Fields(lines[0]))
+	s.Equal([]string{"photos", "2", "3", "3"}, strings.Fields(lines[1])[:4])
+	s.Equal("Largest chunks of photos:", lines[3])
+	s.Equal("#"+big.TargetHash().String(), strings.Fields(lines[4])[0])
+	s.Contains(lines[4], "String")
+}
@@ -5,17 +5,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/stormasm/noms/cmd/util"
 	"github.com/stormasm/noms/go/config"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/merge"
 	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/profile"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/stormasm/noms/go/util/status"
 	"github.com/stormasm/noms/go/util/verbose"
 	humanize "github.com/dustin/go-humanize"
@@ -23,14 +30,17 @@ import (
 )
 
 var (
-	p int
+	p          int
+	syncDryRun bool
+	syncBoth   bool
+	syncAll    bool
 )
 
 var nomsSync = &util.Command{
 	Run:       runSync,
 	UsageLine: "sync [options] <source-object> <dest-dataset>",
 	Short:     "Moves datasets between or within databases",
-	Long:      "See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.",
+	Long:      "With --all-datasets, the arguments are databases instead, and every dataset in the source is synced to the dataset of the same name in the destination.\n\nWith --bidirectional, the source must be a dataset too, and both datasets end up with the same head: if one head descends from the other, the other is fast-forwarded to it; otherwise the source head is pulled into the destination, merged with the destination head, and the merge is pushed back to the source. Merges fail if the heads conflict; resolve them with noms merge instead. Combined with --all-datasets, datasets that are only in the destination are synced back to the source too.\n\nWith --dry-run, nothing is written, and the number of chunks that would be copied, and approximately how big they are, is reported instead.\n\nInterrupting a sync, e.g. with Ctrl-C, stops it cleanly, leaving the destination dataset as it was. Syncs to a remote database keep a journal of the chunks the server has stored, so running an interrupted sync again only sends the ones it hasn't.\n\nSee Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.",
 	Flags:     setupSyncFlags,
 	Nargs:     2,
 }
@@ -38,6 +48,9 @@ var nomsSync = &util.Command{
 func setupSyncFlags() *flag.FlagSet {
 	syncFlagSet := flag.NewFlagSet("sync", flag.ExitOnError)
 	syncFlagSet.IntVar(&p, "p", 512, "parallelism")
+	syncFlagSet.BoolVar(&syncDryRun, "dry-run", false, "report what would be synced, without writing anything")
+	syncFlagSet.BoolVar(&syncBoth, "bidirectional", false, "sync in both directions, merging the heads if they've diverged")
+	syncFlagSet.BoolVar(&syncAll, "all-datasets", false, "sync every dataset between two databases")
 	spec.RegisterDatabaseFlags(syncFlagSet)
 	verbose.RegisterVerboseFlags(syncFlagSet)
 	profile.RegisterProfileFlags(syncFlagSet)
@@ -46,6 +59,20 @@ func setupSyncFlags() *flag.FlagSet {
 
 func runSync(args []string) int {
 	cfg := config.NewResolver()
+	if syncAll {
+		return runSyncAll(cfg, args)
+	}
+	if syncBoth {
+		dbA, dsA, err := cfg.GetDataset(args[0])
+		d.CheckError(err)
+		defer dbA.Close()
+		dbB, dsB, err := cfg.GetDataset(args[1])
+		d.CheckError(err)
+		defer dbB.Close()
+		syncBidirectional(dbA, dsA, args[0], dbB, dsB, args[1])
+		return 0
+	}
+
 	sourceStore, sourceObj, err := cfg.GetPath(args[0])
 	d.CheckError(err)
 	defer sourceStore.Close()
@@ -58,35 +85,89 @@ func runSync(args []string) int {
 	d.CheckError(err)
 	defer sinkDB.Close()
 
-	start := time.Now()
-	progressCh := make(chan datas.PullProgress)
-	lastProgressCh := make(chan datas.PullProgress)
+	syncHead(sourceStore, sinkDB, types.NewRef(sourceObj), sinkDataset, args[1])
+	return 0
+}
 
-	go func() {
-		var last datas.PullProgress
+// runSyncAll syncs every dataset in the database args[0] to the database args[1], and with --bidirectional, the other way too.
+func runSyncAll(cfg *config.Resolver, args []string) int {
+	srcDB, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer srcDB.Close()
+	sinkDB, err := cfg.GetDatabase(args[1])
+	d.CheckError(err)
+	defer sinkDB.Close()
 
-		for info := range progressCh {
-			if info.KnownCount == 1 {
-				// It's better to print "up to date" than "0% (0/1); 100% (1/1)".
-				continue
-			}
+	names := map[string]bool{}
+	addNames := func(datasets types.Map) {
+		datasets.IterAll(func(k, v types.Value) {
+			names[string(k.(types.String))] = true
+		})
+	}
+	addNames(srcDB.Datasets())
+	if syncBoth {
+		addNames(sinkDB.Datasets())
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
 
-			last = info
-			if status.WillPrint() {
-				pct := 100.0 * float64(info.DoneCount) / float64(info.KnownCount)
-				status.Printf("Syncing - %.2f%% (%s/s)", pct, bytesPerSec(info.ApproxWrittenBytes, start))
-			}
+	for _, name := range sorted {
+		srcDS, sinkDS := srcDB.GetDataset(name), sinkDB.GetDataset(name)
+		if syncBoth {
+			syncBidirectional(srcDB, srcDS, name, sinkDB, sinkDS, name)
+		} else {
+			syncHead(srcDB, sinkDB, srcDS.HeadRef(), sinkDS, name)
 		}
+	}
+	return 0
+}
 
-		lastProgressCh <- last
-	}()
-
-	sourceRef := types.NewRef(sourceObj)
+// syncHead pulls sourceRef from srcDB into sinkDB, and makes it the head of sinkDataset, which is called |name| in messages. With --dry-run, it only reports what it would do.
+func syncHead(srcDB, sinkDB datas.Database, sourceRef types.Ref, sinkDataset datas.Dataset, name string) datas.Dataset {
 	sinkRef, sinkExists := sinkDataset.MaybeHeadRef()
+	if syncDryRun {
+		if sinkExists && sourceRef.Equals(sinkRef) {
+			fmt.Printf("Dataset %s is already up to date.\n", name)
+		} else {
+			count, bytes := datas.EstimatePull(srcDB, sinkDB, sourceRef)
+			fmt.Printf("Would sync %d chunks (%s) to %s, making %s its head.\n", count, humanize.Bytes(bytes), name, sourceRef.TargetHash())
+		}
+		return sinkDataset
+	}
+
+	start := time.Now()
+	bar := progress.NewBar("Syncing")
+	var last progress.Progress
+	// Ctrl-C stops the pull, leaving the dataset as it was, rather than killing it part way through.
+	ctx, stop := progress.WithInterrupt(context.Background())
+	defer stop()
+	ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(info progress.Progress) {
+		if info.TotalChunks == 1 {
+			// It's better to print "up to date" than "0% (0/1); 100% (1/1)".
+			return
+		}
+		last = info
+		bar.Report(info)
+	}))
+
+	journal := openPushJournal(sinkDB, sourceRef)
 	nonFF := false
-	err = d.Try(func() {
+	var pullErr error
+	err := d.Try(func() {
 		defer profile.MaybeStartProfile().Stop()
-		datas.Pull(sourceStore, sinkDB, sourceRef, sinkRef, p, progressCh)
+		if journal != nil {
+			sinkDB.(*datas.RemoteDatabaseClient).SetPushJournal(journal)
+			defer sinkDB.(*datas.RemoteDatabaseClient).SetPushJournal(nil)
+			if n := journal.Len(); n > 0 {
+				fmt.Printf("Resuming an earlier sync of %s, which sent %d chunks.\n", name, n)
+			}
+		}
+		if pullErr = datas.PullContext(ctx, srcDB, sinkDB, sourceRef, sinkRef, p); pullErr != nil {
+			return
+		}
 
 		var err error
 		sinkDataset, err = sinkDB.FastForward(sinkDataset, sourceRef)
@@ -100,21 +181,111 @@ func runSync(args []string) int {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if journal != nil && pullErr == nil {
+		d.PanicIfError(journal.Remove())
+	}
+	if pullErr != nil {
+		if last.Chunks > 0 {
+			status.Done()
+		}
+		d.CheckErrorNoUsage(fmt.Errorf("Syncing %s was canceled, leaving it unchanged", name))
+	}
 
-	close(progressCh)
-	if last := <-lastProgressCh; last.DoneCount > 0 {
+	if last.Chunks > 0 {
 		status.Printf("Done - Synced %s in %s (%s/s)",
-			humanize.Bytes(last.ApproxWrittenBytes), since(start), bytesPerSec(last.ApproxWrittenBytes, start))
+			humanize.Bytes(last.Bytes), since(start), bytesPerSec(last.Bytes, start))
 		status.Done()
 	} else if !sinkExists {
-		fmt.Printf("All chunks already exist at destination! Created new dataset %s.\n", args[1])
+		fmt.Printf("All chunks already exist at destination! Created new dataset %s.\n", name)
 	} else if nonFF && !sourceRef.Equals(sinkRef) {
 		fmt.Printf("Abandoning %s; new head is %s\n", sinkRef.TargetHash(), sourceRef.TargetHash())
 	} else {
-		fmt.Printf("Dataset %s is already up to date.\n", args[1])
+		fmt.Printf("Dataset %s is already up to date.\n", name)
 	}
 
-	return 0
+	return sinkDataset
+}
+
+// openPushJournal returns the journal of the chunks sent to sinkDB by syncs of sourceRef, if sinkDB is remote, and nil if it isn't.
+func openPushJournal(sinkDB datas.Database, sourceRef types.Ref) *datas.PushJournal {
+	rdb, ok := sinkDB.(*datas.RemoteDatabaseClient)
+	if !ok {
+		return nil
+	}
+	key := hash.FromData([]byte(rdb.URL() + " " + sourceRef.TargetHash().String()))
+	journal, err := datas.OpenPushJournal(filepath.Join(os.TempDir(), "noms-push", key.String()))
+	d.CheckErrorNoUsage(err)
+	return journal
+}
+
+// syncBidirectional gives dsA and dsB the same head. If one head descends from the other, it's synced to the other. Otherwise, the head of dsA is pulled into dbB and merged with the head of dsB, and the merge is committed to dsB and synced back to dsA.
+func syncBidirectional(dbA datas.Database, dsA datas.Dataset, nameA string, dbB datas.Database, dsB datas.Dataset, nameB string) {
+	refA, okA := dsA.MaybeHeadRef()
+	refB, okB := dsB.MaybeHeadRef()
+	switch {
+	case !okA && !okB:
+		d.CheckErrorNoUsage(fmt.Errorf("Neither %s nor %s has any data", nameA, nameB))
+	case !okB:
+		syncHead(dbA, dbB, refA, dsB, nameB)
+		return
+	case !okA:
+		syncHead(dbB, dbA, refB, dsA, nameA)
+		return
+	case refA.Equals(refB):
+		fmt.Printf("Datasets %s and %s are already up to date.\n", nameA, nameB)
+		return
+	}
+
+	headA, headB := dsA.Head(), dsB.Head()
+	if datas.CommitDescendsFrom(headA, refB, dbA) {
+		syncHead(dbA, dbB, refA, dsB, nameB)
+		return
+	}
+	if datas.CommitDescendsFrom(headB, refA, dbB) {
+		syncHead(dbB, dbA, refB, dsA, nameA)
+		return
+	}
+
+	if syncDryRun {
+		count, bytes := datas.EstimatePull(dbA, dbB, refA)
+		fmt.Printf("Datasets %s and %s have diverged. Would sync %d chunks (%s) to %s to merge them, and sync the merge back to %s.\n", nameA, nameB, count, humanize.Bytes(bytes), nameB, nameA)
+		return
+	}
+	ancestor, ok := datas.FindCommonAncestor(headA, headB, eitherReader{dbA, dbB})
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Datasets %s and %s have no common ancestor", nameA, nameB))
+	}
+	datas.Pull(dbA, dbB, refA, refB, p, nil)
+	merged, err := merge.ThreeWay(headA.Get(datas.ValueField), headB.Get(datas.ValueField), ancestor.Get(datas.ValueField), dbB, nil, nil)
+	d.CheckErrorNoUsage(err)
+	meta, err := spec.CreateCommitMetaStruct(dbB, "", "", nil, nil)
+	d.CheckErrorNoUsage(err)
+	dsB, err = dbB.Commit(dsB, merged, datas.CommitOptions{Parents: types.NewSet(refA, refB), Meta: meta})
+	d.CheckErrorNoUsage(err)
+	fmt.Printf("Merged %s into %s, new head #%s\n", nameA, nameB, dsB.HeadRef().TargetHash())
+	syncHead(dbB, dbA, dsB.HeadRef(), dsA, nameA)
+}
+
+// eitherReader reads values from whichever of two databases has them, so that the histories of heads in different databases can be searched together.
+type eitherReader struct {
+	a, b types.ValueReader
+}
+
+func (r eitherReader) ReadValue(h hash.Hash) types.Value {
+	if v := r.a.ReadValue(h); v != nil {
+		return v
+	}
+	return r.b.ReadValue(h)
+}
+
+func (r eitherReader) ReadManyValues(hashes hash.HashSlice) types.ValueSlice {
+	vals := r.a.ReadManyValues(hashes)
+	for i, v := range vals {
+		if v == nil {
+			vals[i] = r.b.ReadValue(hashes[i])
+		}
+	}
+	return vals
 }
 
 func bytesPerSec(bytes uint64, start time.Time) string {
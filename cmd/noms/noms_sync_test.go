@@ -5,12 +5,16 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
 	"github.com/stormasm/noms/go/util/clienttest"
@@ -81,6 +85,46 @@ func (s *nomsSyncTestSuite) TestSync() {
 	s.Regexp("up to date", sout)
 }
 
+func (s *nomsSyncTestSuite) TestSyncToRemote() {
+	server := datas.NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	source, err := sourceDB.CommitValue(sourceDB.GetDataset("src"), types.Number(42))
+	s.NoError(err)
+	first := source.Head()
+	source, err = sourceDB.CommitValue(source, types.Number(43))
+	s.NoError(err)
+	second := source.HeadRef()
+	sourceDB.Close()
+
+	sourceSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "#"+first.Hash().String())
+	sout, _ := s.MustRun(main, []string{"sync", sourceSpec, url + "::dest"})
+	s.Regexp("Synced", sout)
+	s.NotContains(sout, "Resuming")
+
+	// As if a sync of the second commit had been interrupted, after the server stored a chunk, and one that it's lost since.
+	journalPath := filepath.Join(os.TempDir(), "noms-push", hash.FromData([]byte(url+" "+second.TargetHash().String())).String())
+	s.NoError(os.MkdirAll(filepath.Dir(journalPath), 0777))
+	defer os.Remove(journalPath)
+	stored, lost := first.Hash().Digest(), types.String("lost").Hash().Digest()
+	s.NoError(ioutil.WriteFile(journalPath, append(stored[:], lost[:]...), 0666))
+
+	sourceSpec = spec.CreateValueSpecString("ldb", s.LdbDir, "src")
+	sout, _ = s.MustRun(main, []string{"sync", sourceSpec, url + "::dest"})
+	s.Contains(sout, "Resuming an earlier sync of "+url+"::dest, which sent 1 chunks.")
+	_, err = os.Stat(journalPath)
+	s.True(os.IsNotExist(err))
+
+	db := datas.NewRemoteDatabase(url, "")
+	s.True(types.Number(43).Equals(db.GetDataset("dest").HeadValue()))
+	db.Close()
+}
+
 func (s *nomsSyncTestSuite) TestSync_Issue2598() {
 	ldb2dir := path.Join(s.TempDir, "ldb2")
 	defer s.NoError(os.RemoveAll(ldb2dir))
@@ -144,3 +188,102 @@ func (s *nomsSyncTestSuite) TestRewind() {
 	s.True(types.Number(42).Equals(dest.HeadValue()))
 	db.Close()
 }
+
+func (s *nomsSyncTestSuite) TestSyncDryRun() {
+	ldb2dir := path.Join(s.TempDir, "ldb2")
+	defer s.NoError(os.RemoveAll(ldb2dir))
+
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	_, err := sourceDB.CommitValue(sourceDB.GetDataset("src"), types.NewList(types.Number(1), types.Number(2)))
+	s.NoError(err)
+	sourceDB.Close()
+
+	sourceDataset := spec.CreateValueSpecString("ldb", s.LdbDir, "src")
+	sinkDatasetSpec := spec.CreateValueSpecString("ldb", ldb2dir, "dest")
+	sout, _ := s.MustRun(main, []string{"sync", "--dry-run", sourceDataset, sinkDatasetSpec})
+	s.Regexp(`Would sync \d+ chunks`, sout)
+
+	db := datas.NewDatabase(chunks.NewLevelDBStore(ldb2dir, "", 1, false))
+	_, ok := db.GetDataset("dest").MaybeHead()
+	s.False(ok)
+	db.Close()
+
+	s.MustRun(main, []string{"sync", sourceDataset, sinkDatasetSpec})
+	sout, _ = s.MustRun(main, []string{"sync", "--dry-run", sourceDataset, sinkDatasetSpec})
+	s.Regexp("up to date", sout)
+}
+
+func (s *nomsSyncTestSuite) TestSyncAllDatasets() {
+	ldb1dir, ldb2dir := path.Join(s.TempDir, "ldb1"), path.Join(s.TempDir, "ldb2")
+	defer s.NoError(os.RemoveAll(ldb1dir))
+	defer s.NoError(os.RemoveAll(ldb2dir))
+
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(ldb1dir, "", 1, false))
+	_, err := sourceDB.CommitValue(sourceDB.GetDataset("ds1"), types.Number(1))
+	s.NoError(err)
+	_, err = sourceDB.CommitValue(sourceDB.GetDataset("ds2"), types.Number(2))
+	s.NoError(err)
+	sourceDB.Close()
+	sinkDB := datas.NewDatabase(chunks.NewLevelDBStore(ldb2dir, "", 1, false))
+	_, err = sinkDB.CommitValue(sinkDB.GetDataset("ds3"), types.Number(3))
+	s.NoError(err)
+	sinkDB.Close()
+
+	sourceSpec := spec.CreateDatabaseSpecString("ldb", ldb1dir)
+	sinkSpec := spec.CreateDatabaseSpecString("ldb", ldb2dir)
+	s.MustRun(main, []string{"sync", "--all-datasets", sourceSpec, sinkSpec})
+
+	sinkDB = datas.NewDatabase(chunks.NewLevelDBStore(ldb2dir, "", 1, false))
+	s.Equal(uint64(3), sinkDB.Datasets().Len())
+	s.True(types.Number(1).Equals(sinkDB.GetDataset("ds1").HeadValue()))
+	s.True(types.Number(2).Equals(sinkDB.GetDataset("ds2").HeadValue()))
+	sinkDB.Close()
+
+	// With --bidirectional, ds3 is synced back to the source.
+	s.MustRun(main, []string{"sync", "--all-datasets", "--bidirectional", sourceSpec, sinkSpec})
+	sourceDB = datas.NewDatabase(chunks.NewLevelDBStore(ldb1dir, "", 1, false))
+	s.True(types.Number(3).Equals(sourceDB.GetDataset("ds3").HeadValue()))
+	sourceDB.Close()
+}
+
+func (s *nomsSyncTestSuite) TestSyncBidirectional() {
+	ldb2dir := path.Join(s.TempDir, "ldb2")
+	defer s.NoError(os.RemoveAll(ldb2dir))
+
+	sourceDB := datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	source, err := sourceDB.CommitValue(sourceDB.GetDataset("ds"), types.NewMap(types.String("a"), types.Number(1)))
+	s.NoError(err)
+	sourceDB.Close()
+
+	sourceSpec := spec.CreateValueSpecString("ldb", s.LdbDir, "ds")
+	sinkSpec := spec.CreateValueSpecString("ldb", ldb2dir, "ds")
+	s.MustRun(main, []string{"sync", "--bidirectional", sourceSpec, sinkSpec})
+
+	// Each side adds a key, so the heads diverge, and syncing merges them.
+	sourceDB = datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	source = sourceDB.GetDataset("ds")
+	_, err = sourceDB.CommitValue(source, source.HeadValue().(types.Map).Set(types.String("b"), types.Number(2)))
+	s.NoError(err)
+	sourceDB.Close()
+	sinkDB := datas.NewDatabase(chunks.NewLevelDBStore(ldb2dir, "", 1, false))
+	sink := sinkDB.GetDataset("ds")
+	_, err = sinkDB.CommitValue(sink, sink.HeadValue().(types.Map).Set(types.String("c"), types.Number(3)))
+	s.NoError(err)
+	sinkDB.Close()
+
+	sout, _ := s.MustRun(main, []string{"sync", "--bidirectional", "--dry-run", sourceSpec, sinkSpec})
+	s.Regexp("have diverged", sout)
+	sout, _ = s.MustRun(main, []string{"sync", "--bidirectional", sourceSpec, sinkSpec})
+	s.Regexp("Merged", sout)
+
+	expected := types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2), types.String("c"), types.Number(3))
+	sourceDB = datas.NewDatabase(chunks.NewLevelDBStore(s.LdbDir, "", 1, false))
+	sinkDB = datas.NewDatabase(chunks.NewLevelDBStore(ldb2dir, "", 1, false))
+	s.True(expected.Equals(sourceDB.GetDataset("ds").HeadValue()))
+	s.True(sourceDB.GetDataset("ds").HeadRef().Equals(sinkDB.GetDataset("ds").HeadRef()))
+	sourceDB.Close()
+	sinkDB.Close()
+
+	sout, _ = s.MustRun(main, []string{"sync", "--bidirectional", sourceSpec, sinkSpec})
+	s.Regexp("up to date", sout)
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/stormasm/noms/cmd/noms/diff"
+	"github.com/stormasm/noms/cmd/util"
+	"github.com/stormasm/noms/go/config"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	watchInterval time.Duration
+	watchDiff     bool
+	watchExec     string
+	watchCount    int
+)
+
+var nomsWatch = &util.Command{
+	Run:       runWatch,
+	UsageLine: "watch [options] <path>",
+	Short:     "Prints changes to a dataset as they're committed",
+	Long: `watch waits for the head of a dataset to change, and prints a summary of each new commit, its hash, date and message, or with --diff, how its value differs from the one before. The path is the dataset, or the dataset followed by a path within its head commit, e.g. photos.value.originals, in which case only commits which change the value at that path count as changes.
+
+--exec runs a program, through sh, on each change, with NOMS_DATASET set to the dataset, NOMS_HEAD to the hash of its new head and NOMS_PREVIOUS_HEAD to the hash of the old one. Either head is empty if the dataset doesn't exist at the time.
+
+See Spelling Objects at https://github.com/stormasm/noms/blob/master/doc/spelling.md for details on the path argument.`,
+	Flags: setupWatchFlags,
+	Nargs: 1,
+}
+
+func setupWatchFlags() *flag.FlagSet {
+	watchFlagSet := flag.NewFlagSet("watch", flag.ExitOnError)
+	watchFlagSet.DurationVar(&watchInterval, "interval", time.Second, "how often to check for changes, unless the database is served by a server that says when they happen")
+	watchFlagSet.BoolVar(&watchDiff, "diff", false, "print how the value changed, rather than a summary of the commit")
+	watchFlagSet.StringVar(&watchExec, "exec", "", "program to run on each change")
+	watchFlagSet.IntVar(&watchCount, "n", 0, "stop after this many changes; 0 means watch forever")
+	return watchFlagSet
+}
+
+func runWatch(args []string) int {
+	sp, err := config.NewResolver().GetPathSpec(args[0])
+	d.CheckError(err)
+	path := sp.Path
+	if path.Dataset == "" || !path.At.IsZero() || path.Ancestors != 0 {
+		d.CheckError(fmt.Errorf("Invalid path %s, must be a dataset, optionally followed by a path within its head", args[0]))
+	}
+	db, err := sp.DbSpec.Database()
+	d.CheckErrorNoUsage(err)
+	defer db.Close()
+
+	ds := db.GetDataset(path.Dataset)
+	if r, ok := ds.MaybeHeadRef(); ok {
+		fmt.Printf("Watching %s at #%s\n", args[0], r.TargetHash().String())
+	} else {
+		fmt.Printf("Watching %s, which doesn't exist yet\n", args[0])
+	}
+
+	changes := 0
+	datas.WatchHead(db, path.Dataset, watchInterval, func(old, new datas.Dataset) bool {
+		oldValue, newValue := watchedValue(old, path.Path), watchedValue(new, path.Path)
+		if len(path.Path) > 0 && valuesEqual(oldValue, newValue) {
+			return true
+		}
+		printChange(new, oldValue, newValue)
+		if watchExec != "" {
+			runWatchExec(old, new)
+		}
+		changes++
+		return watchCount == 0 || changes < watchCount
+	})
+	return 0
+}
+
+// watchedValue returns the value at |p| in the head of |ds|, or its head value if p is empty, or nil if there's no such value.
+func watchedValue(ds datas.Dataset, p types.Path) types.Value {
+	head, ok := ds.MaybeHead()
+	if !ok {
+		return nil
+	}
+	if len(p) == 0 {
+		return head.Get(datas.ValueField)
+	}
+	return p.Resolve(head)
+}
+
+func valuesEqual(v1, v2 types.Value) bool {
+	if v1 == nil || v2 == nil {
+		return v1 == nil && v2 == nil
+	}
+	return v1.Equals(v2)
+}
+
+func printChange(ds datas.Dataset, oldValue, newValue types.Value) {
+	head, ok := ds.MaybeHead()
+	if !ok {
+		fmt.Printf("Deleted %s\n", ds.ID())
+		return
+	}
+	date, message := "-", ""
+	if t, ok := spec.CommitMetaDate(head); ok {
+		date = t.Format(time.RFC3339)
+	}
+	if meta, ok := head.MaybeGet(datas.MetaField); ok {
+		if m, ok := meta.(types.Struct).MaybeGet("message"); ok {
+			message = " " + string(m.(types.String))
+		}
+	}
+	fmt.Printf("#%s %s%s\n", ds.HeadRef().TargetHash().String(), date, message)
+	if watchDiff && oldValue != nil && newValue != nil {
+		d.CheckErrorNoUsage(diff.Diff(os.Stdout, oldValue, newValue, false))
+	}
+}
+
+func runWatchExec(old, new datas.Dataset) {
+	headString := func(ds datas.Dataset) string {
+		if r, ok := ds.MaybeHeadRef(); ok {
+			return r.TargetHash().String()
+		}
+		return ""
+	}
+	cmd := exec.Command("sh", "-c", watchExec)
+	cmd.Env = append(os.Environ(), "NOMS_DATASET="+new.ID(), "NOMS_HEAD="+headString(new), "NOMS_PREVIOUS_HEAD="+headString(old))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		// One failed run shouldn't stop the watch.
+		fmt.Fprintf(os.Stderr, "%s: %s\n", watchExec, err)
+	}
+}
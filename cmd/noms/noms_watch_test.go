@@ -0,0 +1,83 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsWatch(t *testing.T) {
+	suite.Run(t, &nomsWatchTestSuite{})
+}
+
+type nomsWatchTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// commitLater commits each of |values| to |dsSpec| in turn, once watch has had time to start, and returns a channel which is closed once they're all committed.
+func (s *nomsWatchTestSuite) commitLater(dsSpec string, values ...types.Value) chan struct{} {
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer db.Close()
+		time.Sleep(50 * time.Millisecond)
+		for i, v := range values {
+			meta := types.NewStruct("Meta", types.StructData{"message": types.String(fmt.Sprintf("commit %d", i+1))})
+			var err error
+			ds, err = db.Commit(ds, v, datas.CommitOptions{Meta: meta})
+			s.NoError(err)
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	return done
+}
+
+func (s *nomsWatchTestSuite) TestWatchSummary() {
+	dsSpec := "mem://watch-summary::ds"
+	defer spec.DropMemStore("watch-summary")
+	done := s.commitLater(dsSpec, types.Number(1), types.Number(2))
+	stdout, _ := s.MustRun(main, []string{"watch", "--interval", "5ms", "-n", "2", dsSpec})
+	<-done
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	s.Len(lines, 3)
+	s.Equal("Watching "+dsSpec+", which doesn't exist yet", lines[0])
+	s.Contains(lines[1], " - commit 1")
+	s.Contains(lines[2], " - commit 2")
+}
+
+func (s *nomsWatchTestSuite) TestWatchPathDiffExec() {
+	dsSpec := "mem://watch-diff::ds"
+	defer spec.DropMemStore("watch-diff")
+	db, ds, err := spec.GetDataset(dsSpec)
+	s.NoError(err)
+	ds, err = db.CommitValue(ds, types.NewStruct("S", types.StructData{"a": types.Number(1), "b": types.Number(1)}))
+	s.NoError(err)
+	db.Close()
+
+	done := s.commitLater(dsSpec,
+		types.NewStruct("S", types.StructData{"a": types.Number(1), "b": types.Number(2)}),
+		types.NewStruct("S", types.StructData{"a": types.Number(3), "b": types.Number(2)}))
+	stdout, _ := s.MustRun(main, []string{"watch", "--interval", "5ms", "-n", "1", "--diff", "--exec", "echo exec $NOMS_DATASET $NOMS_PREVIOUS_HEAD", dsSpec + ".value.a"})
+	<-done
+
+	s.Contains(stdout, "Watching "+dsSpec+".value.a at #"+ds.HeadRef().TargetHash().String())
+	// The first commit doesn't change .value.a, so it's skipped.
+	s.NotContains(stdout, "commit 1")
+	s.Contains(stdout, " - commit 2\n-   1\n+   3\n")
+	s.Contains(stdout, "exec ds ")
+	s.NotContains(stdout, "exec ds "+ds.HeadRef().TargetHash().String())
+}
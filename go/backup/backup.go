@@ -0,0 +1,233 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package backup writes the contents of a Noms database to a single archive file, and restores archives into any ChunkStore. Archives don't depend on the storage engine they were made from, so they're suitable as offline, durable snapshots, and for moving databases between backends.
+package backup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+/*
+  Archive:
+    Magic        // archiveMagic
+    Manifest     // 4-byte length, followed by the JSON encoding of a Manifest
+    Chunk 0      // the root chunk
+     ..
+    Chunk N-1
+    End          // an all-zero hash, followed by the 4-byte number of chunks
+
+  Chunk:
+    Hash         // 20-byte hash of the chunk's data
+    Length       // 4-byte length of Data
+    Data         // compressed with Manifest.Codec, then encrypted if Manifest.Encrypted
+
+  All integers are big-endian. Each chunk reachable from the root is written exactly once.
+*/
+
+const (
+	archiveMagic    = "nomsbak1"
+	restoreBatchLen = 1 << 10
+	backupBatchLen  = 1 << 10
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Version   string       `json:"version"`
+	Root      string       `json:"root"`
+	Codec     chunks.Codec `json:"codec"`
+	Encrypted bool         `json:"encrypted"`
+	Created   time.Time    `json:"created"`
+	// Chunks is only known once the whole archive has been read or written; it's always 0 in the archive itself.
+	Chunks uint64 `json:"-"`
+}
+
+// Options controls how an archive is written.
+type Options struct {
+	// Codec compresses chunk data in the archive. The zero value means chunks.DefaultCodec.
+	Codec chunks.Codec
+	// Keys, if non-nil, encrypts chunk data in the archive with AES-GCM, as an EncryptedStore does. Restoring the archive requires the same keys.
+	Keys chunks.KeyProvider
+}
+
+// Backup writes all of the chunks reachable from the root of |cs| to |w| as an archive, and returns its manifest.
+func Backup(cs chunks.ChunkStore, w io.Writer, opts Options) (m Manifest, err error) {
+	if opts.Codec == "" {
+		opts.Codec = chunks.DefaultCodec
+	}
+	err = d.Unwrap(d.Try(func() {
+		root := cs.Root()
+		m = Manifest{Version: cs.Version(), Root: root.String(), Codec: opts.Codec, Encrypted: opts.Keys != nil, Created: time.Now().UTC()}
+		bw := bufio.NewWriter(w)
+		writeManifest(bw, m)
+
+		vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+		visited := hash.HashSet{}
+		next := hash.HashSlice{}
+		if !root.IsEmpty() {
+			next = append(next, root)
+			visited.Insert(root)
+		}
+		for len(next) > 0 {
+			batch := next
+			if len(batch) > backupBatchLen {
+				batch = batch[:backupBatchLen]
+			}
+			next = next[len(batch):]
+			for i, c := range cs.GetMany(batch) {
+				d.PanicIfTrue(c.IsEmpty(), "Chunk %s is missing from the database", batch[i])
+				writeChunk(bw, c, opts)
+				m.Chunks++
+				types.DecodeValue(c, vs).WalkRefs(func(r types.Ref) {
+					if h := r.TargetHash(); !visited.Has(h) {
+						visited.Insert(h)
+						next = append(next, h)
+					}
+				})
+			}
+		}
+
+		bw.Write(make([]byte, hash.ByteLen))
+		binary.Write(bw, binary.BigEndian, uint32(m.Chunks))
+		d.PanicIfError(bw.Flush())
+	}))
+	return
+}
+
+func writeManifest(w io.Writer, m Manifest) {
+	data, err := json.Marshal(m)
+	d.PanicIfError(err)
+	_, err = io.WriteString(w, archiveMagic)
+	d.PanicIfError(err)
+	d.PanicIfError(binary.Write(w, binary.BigEndian, uint32(len(data))))
+	_, err = w.Write(data)
+	d.PanicIfError(err)
+}
+
+func writeChunk(w io.Writer, c chunks.Chunk, opts Options) {
+	data := opts.Codec.Encode(c.Data())
+	if opts.Keys != nil {
+		data = chunks.EncryptChunk(chunks.NewChunkWithHash(c.Hash(), data), opts.Keys).Data()
+	}
+	digest := c.Hash().Digest()
+	_, err := w.Write(digest[:])
+	d.PanicIfError(err)
+	d.PanicIfError(binary.Write(w, binary.BigEndian, uint32(len(data))))
+	_, err = w.Write(data)
+	d.PanicIfError(err)
+}
+
+// ReadManifest returns the manifest at the start of the archive in |r|, leaving |r| positioned at the first chunk.
+func ReadManifest(r io.Reader) (m Manifest, err error) {
+	magic := make([]byte, len(archiveMagic))
+	if _, err = io.ReadFull(r, magic); err != nil || string(magic) != archiveMagic {
+		return Manifest{}, fmt.Errorf("Not a Noms archive")
+	}
+	length := uint32(0)
+	if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+		return
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &m)
+	return
+}
+
+// Restore writes the chunks in the archive in |r| to |cs|, and then makes the archive's root the root of |cs|. Archives of versions that constants.CanUpgrade() are restored too, which upgrades their data to NomsVersion. Every chunk is verified against its hash, and the archive must be complete, before the root is changed. |keys| must be given if the archive is encrypted. Restore fails if |cs| already has a root, unless |force| is true.
+func Restore(r io.Reader, cs chunks.ChunkStore, keys chunks.KeyProvider, force bool) (m Manifest, err error) {
+	br := bufio.NewReader(r)
+	if m, err = ReadManifest(br); err != nil {
+		return
+	}
+	if m.Version != constants.NomsVersion && !constants.CanUpgrade(m.Version) {
+		return m, fmt.Errorf("Archive contains data of version %s, which is incompatible with version %s", m.Version, constants.NomsVersion)
+	}
+	if m.Encrypted && keys == nil {
+		return m, fmt.Errorf("Archive is encrypted, but no key was given")
+	}
+	if _, err = chunks.ParseCodec(string(m.Codec)); err != nil {
+		return
+	}
+	last := cs.Root()
+	if !last.IsEmpty() && !force {
+		return m, fmt.Errorf("Database is not empty; its root is %s", last)
+	}
+
+	err = d.Unwrap(d.Try(func() {
+		batch := make([]chunks.Chunk, 0, restoreBatchLen)
+		flush := func() {
+			for len(batch) > 0 {
+				bpe := cs.PutMany(batch)
+				retry := make([]chunks.Chunk, 0, len(bpe))
+				for _, c := range batch {
+					for _, h := range bpe {
+						if h == c.Hash() {
+							retry = append(retry, c)
+							break
+						}
+					}
+				}
+				batch = retry
+			}
+		}
+
+		for {
+			c, ok := readChunk(br, m, keys)
+			if !ok {
+				break
+			}
+			batch = append(batch, c)
+			m.Chunks++
+			if len(batch) == restoreBatchLen {
+				flush()
+			}
+		}
+		flush()
+
+		count := uint32(0)
+		d.PanicIfError(binary.Read(br, binary.BigEndian, &count))
+		d.PanicIfFalse(uint64(count) == m.Chunks, "Archive is corrupt: it should contain %d chunks, but contains %d", count, m.Chunks)
+		d.PanicIfFalse(cs.UpdateRoot(hash.Parse(m.Root), last), "Database root changed during restore")
+	}))
+	return
+}
+
+// readChunk returns the next chunk in the archive, or false if it's reached the end of the chunks.
+func readChunk(r io.Reader, m Manifest, keys chunks.KeyProvider) (chunks.Chunk, bool) {
+	digest := hash.Digest{}
+	_, err := io.ReadFull(r, digest[:])
+	d.PanicIfError(err)
+	h := hash.New(digest)
+	if h.IsEmpty() {
+		return chunks.EmptyChunk, false
+	}
+
+	length := uint32(0)
+	d.PanicIfError(binary.Read(r, binary.BigEndian, &length))
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	d.PanicIfError(err)
+
+	if m.Encrypted {
+		data = chunks.DecryptChunk(chunks.NewChunkWithHash(h, data), keys).Data()
+	}
+	data, err = m.Codec.Decode(data)
+	d.PanicIfError(err)
+	c := chunks.NewChunk(data)
+	d.PanicIfFalse(c.Hash() == h, "Archive is corrupt: chunk %s has hash %s", h, c.Hash())
+	return c, true
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package backup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestBackupSuite(t *testing.T) {
+	suite.Run(t, &BackupSuite{})
+}
+
+type BackupSuite struct {
+	suite.Suite
+	cs *chunks.MemoryStore
+}
+
+func (suite *BackupSuite) SetupTest() {
+	suite.cs = chunks.NewMemoryStore()
+	db := datas.NewDatabase(suite.cs)
+	nums := []types.Value{}
+	for i := 0; i < 10000; i++ {
+		nums = append(nums, types.Number(i))
+	}
+	list := types.NewList(nums...)
+	ds, err := db.CommitValue(db.GetDataset("list"), list)
+	suite.NoError(err)
+	_, err = db.CommitValue(ds, types.NewMap(types.String("list"), list))
+	suite.NoError(err)
+	// The same list in another dataset shouldn't be written to the archive twice.
+	_, err = db.CommitValue(db.GetDataset("copy"), list)
+	suite.NoError(err)
+}
+
+func countChunks(cs *chunks.MemoryStore) (count uint64) {
+	cs.IterAll(func(c chunks.Chunk) { count++ })
+	return
+}
+
+func (suite *BackupSuite) roundTrip(opts Options, keys chunks.KeyProvider) {
+	buf := &bytes.Buffer{}
+	m, err := Backup(suite.cs, buf, opts)
+	suite.NoError(err)
+	suite.Equal(suite.cs.Root().String(), m.Root)
+	suite.Equal(opts.Keys != nil, m.Encrypted)
+	// Old roots aren't reachable from the current one, so they aren't backed up.
+	suite.True(m.Chunks < countChunks(suite.cs))
+
+	dest := chunks.NewMemoryStore()
+	restored, err := Restore(bytes.NewReader(buf.Bytes()), dest, keys, false)
+	suite.NoError(err)
+	suite.Equal(m.Chunks, restored.Chunks)
+	// Each chunk is written exactly once.
+	suite.Equal(m.Chunks, countChunks(dest))
+	suite.Equal(suite.cs.Root(), dest.Root())
+
+	db := datas.NewDatabase(dest)
+	orig := datas.NewDatabase(suite.cs)
+	suite.True(orig.Datasets().Equals(db.Datasets()))
+	suite.True(orig.GetDataset("list").HeadValue().Equals(db.GetDataset("list").HeadValue()))
+	suite.True(orig.GetDataset("copy").HeadValue().Equals(db.GetDataset("copy").HeadValue()))
+}
+
+func (suite *BackupSuite) TestRoundTrip() {
+	suite.roundTrip(Options{}, nil)
+	suite.roundTrip(Options{Codec: chunks.FlateCodec}, nil)
+	suite.roundTrip(Options{Codec: chunks.NoCompression}, nil)
+}
+
+func (suite *BackupSuite) TestEncrypted() {
+	keys := chunks.NewStaticKeyProvider(bytes.Repeat([]byte{1}, 32))
+	suite.roundTrip(Options{Keys: keys}, keys)
+
+	buf := &bytes.Buffer{}
+	_, err := Backup(suite.cs, buf, Options{Keys: keys})
+	suite.NoError(err)
+	suite.False(bytes.Contains(buf.Bytes(), []byte("list")))
+
+	_, err = Restore(bytes.NewReader(buf.Bytes()), chunks.NewMemoryStore(), nil, false)
+	suite.Error(err)
+
+	dest := chunks.NewMemoryStore()
+	_, err = Restore(bytes.NewReader(buf.Bytes()), dest, chunks.NewStaticKeyProvider(bytes.Repeat([]byte{2}, 32)), false)
+	suite.Error(err)
+	suite.True(dest.Root().IsEmpty())
+}
+
+func (suite *BackupSuite) TestEmptyDatabase() {
+	buf := &bytes.Buffer{}
+	m, err := Backup(chunks.NewMemoryStore(), buf, Options{})
+	suite.NoError(err)
+	suite.Equal(uint64(0), m.Chunks)
+
+	dest := chunks.NewMemoryStore()
+	_, err = Restore(buf, dest, nil, false)
+	suite.NoError(err)
+	suite.True(dest.Root().IsEmpty())
+}
+
+func (suite *BackupSuite) TestRestoreIntoNonEmptyDatabase() {
+	buf := &bytes.Buffer{}
+	_, err := Backup(suite.cs, buf, Options{})
+	suite.NoError(err)
+
+	dest := chunks.NewMemoryStore()
+	c := chunks.NewChunk([]byte("abc"))
+	dest.Put(c)
+	dest.UpdateRoot(c.Hash(), hash.Hash{})
+	_, err = Restore(bytes.NewReader(buf.Bytes()), dest, nil, false)
+	suite.Error(err)
+	suite.Equal(c.Hash(), dest.Root())
+
+	_, err = Restore(bytes.NewReader(buf.Bytes()), dest, nil, true)
+	suite.NoError(err)
+	suite.Equal(suite.cs.Root(), dest.Root())
+}
+
+func (suite *BackupSuite) TestRestoreUpgradesVersion() {
+	buf := &bytes.Buffer{}
+	m, err := Backup(suite.cs, buf, Options{})
+	suite.NoError(err)
+	r := bytes.NewReader(buf.Bytes())
+	_, err = ReadManifest(r)
+	suite.NoError(err)
+	chunkData := buf.Bytes()[buf.Len()-r.Len():]
+	withVersion := func(vers string) *bytes.Buffer {
+		archive := &bytes.Buffer{}
+		m.Version = vers
+		writeManifest(archive, m)
+		archive.Write(chunkData)
+		return archive
+	}
+
+	_, err = Restore(withVersion("6"), chunks.NewMemoryStore(), nil, false)
+	suite.Error(err)
+
+	dest := chunks.NewMemoryStore()
+	_, err = Restore(withVersion("7"), dest, nil, false)
+	suite.NoError(err)
+	suite.Equal(suite.cs.Root(), dest.Root())
+	suite.Equal(constants.NomsVersion, dest.Version())
+}
+
+func (suite *BackupSuite) TestCorruptArchive() {
+	buf := &bytes.Buffer{}
+	_, err := Backup(suite.cs, buf, Options{Codec: chunks.NoCompression})
+	suite.NoError(err)
+	data := buf.Bytes()
+
+	_, err = Restore(bytes.NewReader([]byte("not an archive")), chunks.NewMemoryStore(), nil, false)
+	suite.Error(err)
+
+	// Truncated
+	dest := chunks.NewMemoryStore()
+	_, err = Restore(bytes.NewReader(data[:len(data)/2]), dest, nil, false)
+	suite.Error(err)
+	suite.True(dest.Root().IsEmpty())
+
+	// Flip a bit in the last chunk's data, which precedes the end marker.
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)-hash.ByteLen-4-1] ^= 1
+	dest = chunks.NewMemoryStore()
+	_, err = Restore(bytes.NewReader(corrupt), dest, nil, false)
+	suite.Error(err)
+	suite.True(dest.Root().IsEmpty())
+}
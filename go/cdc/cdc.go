@@ -0,0 +1,230 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package cdc streams the changes made to a dataset, as change data capture, so that other systems can mirror a dataset without polling it and diffing its versions themselves. Tail watches the head of a dataset, and for each commit that's made to it, sends a Sink an Event holding the differences, as found by types.DiffStream, between the value of the commit and the value of its parent, with the values in them as JSON, as noms show --format json writes them. Sinks write Events to an io.Writer as JSON Lines, which can be piped into a Kafka producer, or POST them to a webhook.
+package cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/valueformat"
+)
+
+// Event is what's sent for a commit to a dataset. Parent is the hash of the commit whose value Changes are from, and is empty if there wasn't one. If the head of the dataset is set to a commit that doesn't descend from the last one, Commit is the new head, Parent the old one, and Changes are between them. If the dataset is deleted, Commit is empty and the whole value is removed.
+type Event struct {
+	Dataset string      `json:"dataset"`
+	Commit  string      `json:"commit"`
+	Parent  string      `json:"parent"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Changes []Change    `json:"changes"`
+}
+
+// Change is a difference between the values of two commits: what was "added", "removed" or "modified" at Path, which is spelled as in noms paths, and is empty for the whole value. Old is omitted for additions, and New for removals.
+type Change struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+var changeOps = map[types.DiffChangeType]string{
+	types.DiffChangeAdded:    "added",
+	types.DiffChangeRemoved:  "removed",
+	types.DiffChangeModified: "modified",
+}
+
+// Sink is where Tail sends Events. If Send returns an error, Tail stops.
+type Sink interface {
+	Send(e Event) error
+}
+
+type writerSink struct {
+	enc *json.Encoder
+}
+
+// NewWriterSink returns a Sink which writes each Event to |w| as a line of JSON.
+func NewWriterSink(w io.Writer) Sink {
+	return writerSink{json.NewEncoder(w)}
+}
+
+func (s writerSink) Send(e Event) error {
+	return s.enc.Encode(e)
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a Sink which POSTs each Event as JSON to |url|, and fails if the response isn't a 2xx.
+func NewWebhookSink(url string) Sink {
+	return webhookSink{url, &http.Client{Timeout: time.Minute}}
+}
+
+func (s webhookSink) Send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded to the event for commit %s with %s", s.url, e.Commit, res.Status)
+	}
+	return nil
+}
+
+// Options are the options of Tail.
+type Options struct {
+	// Interval is how often to check the head of the dataset, if the database can't say when it changes.
+	Interval time.Duration
+	// After, if set, is the hash of the last commit whose Event was sent, and Events are first sent for the commits made since, so that Tail can be restarted without missing any. Otherwise, only commits made after Tail starts are sent.
+	After hash.Hash
+	// ExpandRefs is how many levels of Refs in values are replaced with the values they point to, as with noms show --expand-refs.
+	ExpandRefs int
+}
+
+// Tail sends |sink| an Event for each commit made to the dataset |datasetID| in |db|, until Send returns an error, which Tail returns.
+func Tail(db datas.Database, datasetID string, opts Options, sink Sink) error {
+	// Events are sent from last, rather than from the head WatchHead saw last, so that commits made while Tail starts are sent with the next change.
+	db.Rebase()
+	last := maybeHead(db.GetDataset(datasetID))
+	var err error
+	if !opts.After.IsEmpty() {
+		after := db.ReadValue(opts.After)
+		if after == nil || !datas.IsCommitType(after.Type()) {
+			return fmt.Errorf("%s is not a commit", opts.After)
+		}
+		if err = send(sink, Events(db, datasetID, after, last, opts.ExpandRefs)); err != nil {
+			return err
+		}
+	}
+	datas.WatchHead(db, datasetID, opts.Interval, func(old, new datas.Dataset) bool {
+		head := maybeHead(new)
+		if err = send(sink, Events(db, datasetID, last, head, opts.ExpandRefs)); err != nil {
+			return false
+		}
+		last = head
+		return true
+	})
+	return err
+}
+
+// maybeHead returns the head of |ds|, or nil if it has none.
+func maybeHead(ds datas.Dataset) types.Value {
+	if head, ok := ds.MaybeHead(); ok {
+		return head
+	}
+	return nil
+}
+
+func send(sink Sink, events []Event) error {
+	for _, e := range events {
+		if err := sink.Send(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns the Events for the head of the dataset |datasetID| in |vr| moving from the commit |old| to the commit |new|, either of which may be nil if the dataset didn't, or doesn't, exist. If new descends from old, there's an Event for each commit after old up to new, following from each commit the parent old is, or otherwise the highest one; if not, there's one Event for the change from old to new. Values have |expandRefs| levels of Refs expanded.
+func Events(vr types.ValueReader, datasetID string, old, new types.Value, expandRefs int) []Event {
+	if new == nil {
+		if old == nil {
+			return nil
+		}
+		return []Event{event(vr, datasetID, old, nil, expandRefs)}
+	}
+
+	oldHash, oldHeight := hash.Hash{}, uint64(0)
+	if old != nil {
+		oldHash, oldHeight = old.Hash(), types.NewRef(old).Height()
+	}
+	commits := []types.Value{new}
+	for c := new.(types.Struct); ; {
+		parents := c.Get(datas.ParentsField).(types.Set)
+		if parents.Empty() {
+			if old != nil {
+				// old isn't in the history of new.
+				return []Event{event(vr, datasetID, old, new, expandRefs)}
+			}
+			break
+		}
+		var parent types.Ref
+		found := false
+		parents.IterAll(func(v types.Value) {
+			r := v.(types.Ref)
+			if r.TargetHash() == oldHash {
+				parent, found = r, true
+			} else if !found && (parent.TargetHash().IsEmpty() || r.Height() > parent.Height()) {
+				parent = r
+			}
+		})
+		if found {
+			break
+		}
+		if parent.Height() <= oldHeight {
+			return []Event{event(vr, datasetID, old, new, expandRefs)}
+		}
+		c = parent.TargetValue(vr).(types.Struct)
+		commits = append(commits, c)
+	}
+
+	events := make([]Event, 0, len(commits))
+	for i := len(commits) - 1; i >= 0; i-- {
+		parent := old
+		if i < len(commits)-1 {
+			parent = commits[i+1]
+		}
+		events = append(events, event(vr, datasetID, parent, commits[i], expandRefs))
+	}
+	return events
+}
+
+// event returns the Event for the change from the commit |from| to the commit |to|, either of which may be nil.
+func event(vr types.ValueReader, datasetID string, from, to types.Value, expandRefs int) Event {
+	e := Event{Dataset: datasetID, Changes: []Change{}}
+	var older, newer types.Value
+	if from != nil {
+		e.Parent = from.Hash().String()
+		older = from.(types.Struct).Get(datas.ValueField)
+	}
+	if to != nil {
+		e.Commit = to.Hash().String()
+		newer = to.(types.Struct).Get(datas.ValueField)
+		if meta, ok := to.(types.Struct).Get(datas.MetaField).(types.Struct); ok && meta.Type().Desc.(types.StructDesc).Len() > 0 {
+			e.Meta = valueformat.ToJSON(meta, vr, expandRefs)
+		}
+	}
+
+	ch := make(chan types.Difference)
+	go func() {
+		defer close(ch)
+		types.DiffStream(older, newer, ch, nil)
+	}()
+	for diff := range ch {
+		c := Change{Op: changeOps[diff.ChangeType], Path: diff.Path.String()}
+		if diff.OldValue != nil {
+			c.Old = valueformat.ToJSON(diff.OldValue, vr, expandRefs)
+		}
+		if diff.NewValue != nil {
+			c.New = valueformat.ToJSON(diff.NewValue, vr, expandRefs)
+		}
+		e.Changes = append(e.Changes, c)
+	}
+	return e
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+var errEnough = errors.New("enough")
+
+// countingSink collects Events, and stops Tail once it has |n|.
+type countingSink struct {
+	n      int
+	events []Event
+}
+
+func (s *countingSink) Send(e Event) error {
+	s.events = append(s.events, e)
+	if len(s.events) == s.n {
+		return errEnough
+	}
+	return nil
+}
+
+func commit(assert *assert.Assertions, db datas.Database, ds datas.Dataset, v types.Value) datas.Dataset {
+	ds, err := db.CommitValue(ds, v)
+	assert.NoError(err)
+	return ds
+}
+
+func TestEvents(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	ds := db.GetDataset("people")
+	ds = commit(assert, db, ds, types.NewMap(types.String("bob"), types.Number(1)))
+	first := ds.Head()
+	ds = commit(assert, db, ds, types.NewMap(types.String("bob"), types.Number(2), types.String("sue"), types.Number(3)))
+	second := ds.Head()
+	ds = commit(assert, db, ds, types.NewMap(types.String("sue"), types.Number(3)))
+	third := ds.Head()
+
+	// A commit is sent for each commit, in order.
+	events := Events(db, "people", nil, third, 0)
+	assert.Len(events, 3)
+	assert.Equal("", events[0].Parent)
+	assert.Equal(first.Hash().String(), events[0].Commit)
+	assert.Equal([]Change{{Op: "added", Path: "", New: map[string]interface{}{"bob": float64(1)}}}, roundTrip(assert, events[0]).Changes)
+	assert.Equal(first.Hash().String(), events[1].Parent)
+	assert.Equal([]Change{
+		{Op: "modified", Path: `["bob"]`, Old: float64(1), New: float64(2)},
+		{Op: "added", Path: `["sue"]`, New: float64(3)},
+	}, roundTrip(assert, events[1]).Changes)
+	assert.Equal([]Change{{Op: "removed", Path: `["bob"]`, Old: float64(2)}}, roundTrip(assert, events[2]).Changes)
+	assert.Equal(events[1:], Events(db, "people", first, third, 0))
+
+	// Moving the head elsewhere, or deleting the dataset, is a single change.
+	events = Events(db, "people", third, first, 0)
+	assert.Len(events, 1)
+	assert.Equal(third.Hash().String(), events[0].Parent)
+	assert.Equal(first.Hash().String(), events[0].Commit)
+	assert.Equal([]Change{{Op: "added", Path: `["bob"]`, New: float64(1)}, {Op: "removed", Path: `["sue"]`, Old: float64(3)}}, roundTrip(assert, events[0]).Changes)
+	events = Events(db, "people", second, nil, 0)
+	assert.Len(events, 1)
+	assert.Equal("", events[0].Commit)
+	assert.Equal("removed", events[0].Changes[0].Op)
+}
+
+// roundTrip returns |e| as it's read back from JSON.
+func roundTrip(assert *assert.Assertions, e Event) Event {
+	buf := &bytes.Buffer{}
+	assert.NoError(NewWriterSink(buf).Send(e))
+	var out Event
+	assert.NoError(json.Unmarshal(buf.Bytes(), &out))
+	return out
+}
+
+func TestTail(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	db := datas.NewDatabase(cs)
+	defer db.Close()
+	// Databases aren't safe to use from more than one goroutine, so Tail watches through another.
+	watcher := datas.NewDatabase(cs)
+	defer watcher.Close()
+
+	ds := db.GetDataset("ds")
+	ds = commit(assert, db, ds, types.String("one"))
+	after := ds.HeadRef().TargetHash()
+	ds = commit(assert, db, ds, types.String("two"))
+
+	sink := &countingSink{n: 3}
+	done := make(chan error)
+	go func() {
+		done <- Tail(watcher, "ds", Options{Interval: 10 * time.Millisecond, After: after}, sink)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ds = commit(assert, db, ds, types.String("three"))
+	ds = commit(assert, db, ds, types.String("four"))
+	assert.Equal(errEnough, <-done)
+
+	assert.Len(sink.events, 3)
+	assert.Equal(after.String(), sink.events[0].Parent)
+	news := []interface{}{}
+	for _, e := range sink.events {
+		news = append(news, e.Changes[0].New)
+	}
+	assert.Equal([]interface{}{"two", "three", "four"}, news)
+
+	assert.Error(Tail(watcher, "ds", Options{After: types.String("x").Hash()}, sink))
+}
+
+func TestWebhookSink(t *testing.T) {
+	assert := assert.New(t)
+	bodies := []Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var e Event
+		assert.NoError(json.Unmarshal(body, &e))
+		bodies = append(bodies, e)
+		if e.Commit == "bad" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL)
+	e := Event{Dataset: "ds", Commit: "good", Changes: []Change{{Op: "added", New: "x"}}}
+	assert.NoError(sink.Send(e))
+	assert.Error(sink.Send(Event{Dataset: "ds", Commit: "bad"}))
+	assert.Len(bodies, 2)
+	assert.Equal(e, bodies[0])
+}
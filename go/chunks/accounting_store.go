@@ -0,0 +1,118 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// StoreStats describes how much data a ChunkStore holds. Sizes are of uncompressed chunk data, so they don't depend on how a particular store encodes chunks.
+type StoreStats struct {
+	Chunks uint64
+	Bytes  uint64
+	// NovelBytes is the size of the chunks added to the store since the previous call to Stats().
+	NovelBytes uint64
+}
+
+// StatsReporter is implemented by ChunkStores which keep track of how much data they hold.
+type StatsReporter interface {
+	Stats() StoreStats
+}
+
+// QuotaExceededError is the cause of the panic when a Put to an AccountingStore would take it over its quota. Use d.Try(f, QuotaExceededError{}) to recover it.
+type QuotaExceededError struct {
+	Quota uint64
+	Bytes uint64
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("Storage quota exceeded: writing would use %d bytes, but the quota is %d bytes", e.Bytes, e.Quota)
+}
+
+// ComputeStats counts the chunks in |cs|, which must be a ChunkIterator. NovelBytes is always 0.
+func ComputeStats(cs ChunkStore) (stats StoreStats) {
+	iter, ok := cs.(ChunkIterator)
+	d.PanicIfFalse(ok, "ChunkStore %T can't enumerate its chunks", cs)
+	iter.IterAll(func(c Chunk) {
+		stats.Chunks++
+		stats.Bytes += uint64(len(c.Data()))
+	})
+	return
+}
+
+// AccountingStore wraps a ChunkStore, keeping track of how many chunks it holds and how big they are, and optionally limiting its total size. Only Puts of chunks that aren't already in the store are counted towards the quota.
+type AccountingStore struct {
+	ChunkStore
+	quota uint64
+	mu    sync.Mutex
+	stats StoreStats
+}
+
+// NewAccountingStore returns an AccountingStore wrapping |cs|, whose total size is limited to |quota| bytes, or unlimited if |quota| is 0. If |cs| is a ChunkIterator, the chunks already in it are counted first; otherwise only chunks written through the AccountingStore are counted. Closing it closes |cs|.
+func NewAccountingStore(cs ChunkStore, quota uint64) *AccountingStore {
+	as := &AccountingStore{ChunkStore: cs, quota: quota}
+	if _, ok := cs.(ChunkIterator); ok {
+		as.stats = ComputeStats(cs)
+	}
+	return as
+}
+
+// NewAccountingStoreWithStats returns an AccountingStore like NewAccountingStore() does, but which starts from |stats| rather than counting the chunks already in |cs|, e.g. those an earlier AccountingStore of cs reported when it was closed.
+func NewAccountingStoreWithStats(cs ChunkStore, quota uint64, stats StoreStats) *AccountingStore {
+	return &AccountingStore{ChunkStore: cs, quota: quota, stats: stats}
+}
+
+// Put writes |c| to the underlying store. It panics with a QuotaExceededError if |c| is new and would take the store over its quota.
+func (as *AccountingStore) Put(c Chunk) {
+	as.PutMany([]Chunk{c})
+}
+
+// PutMany writes |chunks| to the underlying store. If the new chunks among them would take the store over its quota, none of them are written, and PutMany panics with a QuotaExceededError.
+func (as *AccountingStore) PutMany(chunks []Chunk) BackpressureError {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	novel := make([]Chunk, 0, len(chunks))
+	novelBytes := uint64(0)
+	seen := hash.HashSet{}
+	for _, c := range chunks {
+		if seen.Has(c.Hash()) || as.ChunkStore.Has(c.Hash()) {
+			continue
+		}
+		seen.Insert(c.Hash())
+		novel = append(novel, c)
+		novelBytes += uint64(len(c.Data()))
+	}
+	if as.quota > 0 && as.stats.Bytes+novelBytes > as.quota {
+		panic(d.Wrap(QuotaExceededError{as.quota, as.stats.Bytes + novelBytes}))
+	}
+
+	bpe := as.ChunkStore.PutMany(chunks)
+	rejected := hash.HashSet{}
+	for _, h := range bpe {
+		rejected.Insert(h)
+	}
+	for _, c := range novel {
+		if !rejected.Has(c.Hash()) {
+			as.stats.Chunks++
+			as.stats.Bytes += uint64(len(c.Data()))
+			as.stats.NovelBytes += uint64(len(c.Data()))
+		}
+	}
+	return bpe
+}
+
+// Stats returns the size of the store, and resets the count of novel bytes.
+func (as *AccountingStore) Stats() StoreStats {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	stats := as.stats
+	as.stats.NovelBytes = 0
+	return stats
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/d"
+)
+
+func TestAccountingStoreTestSuite(t *testing.T) {
+	suite.Run(t, &AccountingStoreTestSuite{})
+}
+
+type AccountingStoreTestSuite struct {
+	ChunkStoreTestSuite
+}
+
+func (suite *AccountingStoreTestSuite) SetupTest() {
+	suite.Store = NewAccountingStore(NewMemoryStore(), 0)
+}
+
+func (suite *AccountingStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+}
+
+func TestAccountingStoreStats(t *testing.T) {
+	assert := assert.New(t)
+	ms := NewMemoryStore()
+	ms.Put(NewChunk([]byte("abc")))
+
+	// Existing chunks are counted, but aren't novel.
+	store := NewAccountingStore(ms, 0)
+	assert.Equal(StoreStats{1, 3, 0}, store.Stats())
+
+	store.Put(NewChunk([]byte("defg")))
+	store.PutMany([]Chunk{NewChunk([]byte("abc")), NewChunk([]byte("hi")), NewChunk([]byte("hi"))})
+	assert.Equal(StoreStats{3, 9, 6}, store.Stats())
+	assert.Equal(StoreStats{3, 9, 0}, store.Stats())
+
+	// A store given the stats of an earlier one doesn't count the chunks again.
+	store = NewAccountingStoreWithStats(ms, 0, StoreStats{3, 9, 0})
+	store.Put(NewChunk([]byte("jk")))
+	assert.Equal(StoreStats{4, 11, 2}, store.Stats())
+}
+
+func TestAccountingStoreQuota(t *testing.T) {
+	assert := assert.New(t)
+	store := NewAccountingStore(NewMemoryStore(), 10)
+
+	store.Put(NewChunk([]byte("abcdef")))
+	big := NewChunk([]byte("ghijk"))
+	err := d.Try(func() { store.Put(big) }, QuotaExceededError{})
+	assert.Equal(QuotaExceededError{10, 11}, err)
+	assert.False(store.Has(big.Hash()))
+
+	// Rewriting an existing chunk doesn't count towards the quota.
+	store.Put(NewChunk([]byte("abcdef")))
+	store.Put(NewChunk([]byte("ghij")))
+	assert.Equal(StoreStats{2, 10, 10}, store.Stats())
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureAPIVersion = "2016-05-31"
+
+// azureClient is a minimal Azure Blob Storage client implementing objectSvc on top of the REST API. Chunks are block blobs, and a blob's generation is its ETag, so conditional writes use If-Match, or If-None-Match: * when the blob must not exist yet.
+type azureClient struct {
+	endpoint  *url.URL
+	account   string
+	container string
+	key       []byte     // shared key, or nil if requests are authorized by sas
+	sas       url.Values // shared access signature, appended to every request
+	client    *http.Client
+}
+
+// newAzureClient returns an azureClient for |container| in |account|. Requests are signed with the account's shared key, from AZURE_STORAGE_KEY, or else authorized by the shared access signature in AZURE_STORAGE_SAS_TOKEN. AZURE_STORAGE_BLOB_ENDPOINT overrides the default endpoint of https://<account>.blob.core.windows.net, e.g. to use an emulator.
+func newAzureClient(account, container string) (*azureClient, error) {
+	endpoint := os.Getenv("AZURE_STORAGE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid AZURE_STORAGE_BLOB_ENDPOINT %s: %s", endpoint, err)
+	}
+
+	c := &azureClient{endpoint: u, account: account, container: container, client: http.DefaultClient}
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		c.key, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("AZURE_STORAGE_KEY must be base64 encoded: %s", err)
+		}
+	} else if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+		c.sas, err = url.ParseQuery(strings.TrimPrefix(sas, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid AZURE_STORAGE_SAS_TOKEN: %s", err)
+		}
+	} else {
+		return nil, fmt.Errorf("Azure credentials missing: set AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN")
+	}
+	return c, nil
+}
+
+func (a *azureClient) blobURL(key string) *url.URL {
+	u := *a.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + a.container + "/" + key
+	u.RawQuery = a.sas.Encode()
+	return &u
+}
+
+// sign adds a SharedKey Authorization header to |req|, as described at https://docs.microsoft.com/rest/api/storageservices/authorize-with-shared-key.
+func (a *azureClient) sign(req *http.Request) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	toSign := []string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		contentLength,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		"", // Date; x-ms-date is used instead
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	}
+
+	msHeaders := []string{}
+	for name := range h {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	for _, name := range msHeaders {
+		toSign = append(toSign, name+":"+strings.TrimSpace(h.Get(name)))
+	}
+	toSign = append(toSign, "/"+a.account+req.URL.EscapedPath())
+
+	mac := hmac.New(sha256.New, a.key)
+	io.WriteString(mac, strings.Join(toSign, "\n"))
+	h.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", a.account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+}
+
+func (a *azureClient) do(method, key string, body []byte, header http.Header) (*http.Response, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, a.blobURL(key).String(), r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	if body != nil {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if a.key != nil {
+		a.sign(req)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	return res, data, err
+}
+
+func (a *azureClient) GetObject(key string) ([]byte, string, error) {
+	res, data, err := a.do("GET", key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return data, res.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	}
+	return nil, "", fmt.Errorf("Azure GET of %s/%s failed: %s", a.container, key, res.Status)
+}
+
+func (a *azureClient) HeadObject(key string) (bool, error) {
+	res, _, err := a.do("HEAD", key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("Azure HEAD of %s/%s failed: %s", a.container, key, res.Status)
+}
+
+func (a *azureClient) PutObject(key string, data []byte) error {
+	res, _, err := a.do("PUT", key, data, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Azure PUT of %s/%s failed: %s", a.container, key, res.Status)
+	}
+	return nil
+}
+
+func (a *azureClient) PutObjectIfGeneration(key string, data []byte, generation string) (bool, error) {
+	header := http.Header{}
+	if generation == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", generation)
+	}
+	res, _, err := a.do("PUT", key, data, header)
+	if err != nil {
+		return false, err
+	}
+	switch res.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// Azure reports a blob which already exists despite If-None-Match: * as a conflict.
+		return false, nil
+	}
+	return false, fmt.Errorf("Azure conditional PUT of %s/%s failed: %s", a.container, key, res.Status)
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// badgerValueThreshold is the size below which Badger keeps values in its LSM tree rather than its value log.
+// Chunk data is nearly always bigger, so the LSM tree holds little more than keys, and compacting it doesn't stall writes for long.
+// The root is stored as a raw digest, which stays in the LSM tree, so updating it leaves no garbage in the value log.
+const badgerValueThreshold = 32
+
+// BadgerStore is a ChunkStore backed by a BadgerDB, which keeps values apart from keys, so unlike LevelDB it doesn't rewrite chunk data as it compacts.
+// It suits large databases better than LevelDBStore, and imports, which can write to it from many goroutines at once.
+//
+// The layout of keys is the same as LevelDBStore's, without namespaces.
+type BadgerStore struct {
+	db             *badger.DB
+	codec          Codec
+	rootMu         sync.Mutex
+	putCount       int64
+	versionSetOnce sync.Once
+}
+
+// NewBadgerStore opens the BadgerDB in |dir|, creating it if need be. Chunk data is compressed with the Codec recorded in the BadgerDB, or with |codec| if the BadgerDB is new.
+func NewBadgerStore(dir string, codec Codec) *BadgerStore {
+	d.PanicIfTrue(dir == "", "dir cannot be empty")
+	d.PanicIfError(os.MkdirAll(dir, 0700))
+	opts := badger.DefaultOptions(dir).WithValueThreshold(badgerValueThreshold).WithLogger(nil)
+	db, err := badger.Open(opts)
+	d.Chk.NoError(err, "opening BadgerStore in %s", dir)
+	b := &BadgerStore{db: db}
+	b.codec = b.negotiateCodec(codec)
+	return b
+}
+
+// NewBadgerStoreUseFlags is like NewBadgerStore(), but new BadgerDBs use the codec given by --ldb-codec.
+func NewBadgerStoreUseFlags(dir string) *BadgerStore {
+	return NewBadgerStore(dir, codecFromFlags())
+}
+
+// negotiateCodec returns the Codec recorded in b's BadgerDB, recording |preferred| if there isn't one.
+func (b *BadgerStore) negotiateCodec(preferred Codec) (codec Codec) {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		if val, ok := b.get(txn, []byte(codecKeyConst)); ok {
+			var err error
+			codec, err = ParseCodec(string(val))
+			return err
+		}
+		codec = preferred
+		return txn.Set([]byte(codecKeyConst), []byte(codec))
+	})
+	d.Chk.NoError(err)
+	return
+}
+
+func (b *BadgerStore) Get(h hash.Hash) Chunk {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	var c Chunk
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		c = b.getChunk(txn, h)
+		return nil
+	}))
+	return c
+}
+
+// GetMany reads all of |hashes| in one transaction, so they're read from the same version of the BadgerDB.
+func (b *BadgerStore) GetMany(hashes hash.HashSlice) []Chunk {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	var chunks []Chunk
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		chunks = getManySerially(func(h hash.Hash) Chunk { return b.getChunk(txn, h) }, hashes)
+		return nil
+	}))
+	return chunks
+}
+
+func (b *BadgerStore) getChunk(txn *badger.Txn, h hash.Hash) Chunk {
+	compressed, ok := b.get(txn, toBadgerChunkKey(h))
+	if !ok {
+		return EmptyChunk
+	}
+	data, err := b.codec.Decode(compressed)
+	d.Chk.NoError(err)
+	return NewChunkWithHash(h, data)
+}
+
+func (b *BadgerStore) Has(h hash.Hash) bool {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	var ok bool
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		ok = b.has(txn, toBadgerChunkKey(h))
+		return nil
+	}))
+	return ok
+}
+
+func (b *BadgerStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		absent = hasManySerially(func(h hash.Hash) bool { return b.has(txn, toBadgerChunkKey(h)) }, hashes)
+		return nil
+	}))
+	return
+}
+
+func (b *BadgerStore) Version() string {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	vers := constants.NomsVersion
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		if val, ok := b.get(txn, []byte(versionKeyConst)); ok {
+			vers = string(val)
+		}
+		return nil
+	}))
+	return vers
+}
+
+// Put is safe to call from many goroutines at once, and doesn't serialize them.
+func (b *BadgerStore) Put(c Chunk) {
+	b.PutMany([]Chunk{c})
+}
+
+// PutMany writes |chunks| in as few transactions as Badger allows, committing them concurrently. It never returns a BackpressureError.
+func (b *BadgerStore) PutMany(chunks []Chunk) (e BackpressureError) {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	b.versionSetOnce.Do(b.setVersIfUnset)
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, c := range chunks {
+		d.Chk.NoError(wb.Set(toBadgerChunkKey(c.Hash()), b.codec.Encode(c.Data())))
+	}
+	d.Chk.NoError(wb.Flush())
+	atomic.AddInt64(&b.putCount, int64(len(chunks)))
+	return
+}
+
+func (b *BadgerStore) Root() hash.Hash {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	var root hash.Hash
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		root = b.root(txn)
+		return nil
+	}))
+	return root
+}
+
+func (b *BadgerStore) UpdateRoot(current, last hash.Hash) bool {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	b.versionSetOnce.Do(b.setVersIfUnset)
+	// Badger would detect concurrent updates and fail all but one with ErrConflict, but then the others would have to retry to find out whether they lost because the root had changed.
+	b.rootMu.Lock()
+	defer b.rootMu.Unlock()
+	ok := false
+	err := b.db.Update(func(txn *badger.Txn) error {
+		if b.root(txn) != last {
+			return nil
+		}
+		ok = true
+		return txn.Set([]byte(rootKeyConst), current.DigestSlice())
+	})
+	d.Chk.NoError(err)
+	return ok
+}
+
+func (b *BadgerStore) root(txn *badger.Txn) hash.Hash {
+	val, ok := b.get(txn, []byte(rootKeyConst))
+	if !ok {
+		return hash.Hash{}
+	}
+	return hash.FromSlice(val)
+}
+
+func (b *BadgerStore) IterAll(cb func(c Chunk)) {
+	d.PanicIfFalse(b.db != nil, "Cannot use BadgerStore after Close().")
+	prefix := []byte(chunkPrefixConst)
+	d.Chk.NoError(b.db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+			key := item.Key()
+			h := hash.Hash{}
+			if len(key) == len(prefix)+hash.ByteLen {
+				h = hash.FromSlice(key[len(prefix):])
+			}
+			compressed, err := item.ValueCopy(nil)
+			d.Chk.NoError(err)
+			data, err := b.codec.Decode(compressed)
+			if err != nil {
+				data = nil
+			}
+			cb(NewChunkWithHash(h, data))
+		}
+		return nil
+	}))
+}
+
+func (b *BadgerStore) Close() error {
+	if b.db == nil {
+		return nil
+	}
+	err := b.db.Close()
+	b.db = nil
+	return err
+}
+
+// Codec returns the compression codec used for chunk data in b.
+func (b *BadgerStore) Codec() Codec {
+	return b.codec
+}
+
+func (b *BadgerStore) setVersIfUnset() {
+	d.Chk.NoError(b.db.Update(func(txn *badger.Txn) error {
+		if b.has(txn, []byte(versionKeyConst)) {
+			return nil
+		}
+		return txn.Set([]byte(versionKeyConst), []byte(constants.NomsVersion))
+	}))
+}
+
+// get returns a copy of the value of |key|, which outlives |txn|, or false if there isn't one.
+func (b *BadgerStore) get(txn *badger.Txn, key []byte) ([]byte, bool) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, false
+	}
+	d.Chk.NoError(err)
+	val, err := item.ValueCopy(nil)
+	d.Chk.NoError(err)
+	return val, true
+}
+
+func (b *BadgerStore) has(txn *badger.Txn, key []byte) bool {
+	_, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false
+	}
+	d.Chk.NoError(err)
+	return true
+}
+
+func toBadgerChunkKey(h hash.Hash) []byte {
+	digest := h.DigestSlice()
+	out := make([]byte, len(chunkPrefixConst), len(chunkPrefixConst)+len(digest))
+	copy(out, chunkPrefixConst)
+	return append(out, digest...)
+}
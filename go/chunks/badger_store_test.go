@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/hash"
+)
+
+func TestBadgerStoreTestSuite(t *testing.T) {
+	suite.Run(t, &BadgerStoreTestSuite{})
+}
+
+type BadgerStoreTestSuite struct {
+	ChunkStoreTestSuite
+	dir string
+}
+
+func (suite *BadgerStoreTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir(os.TempDir(), "")
+	suite.NoError(err)
+	store := NewBadgerStore(suite.dir, DefaultCodec)
+	suite.putCountFn = func() int {
+		return int(store.putCount)
+	}
+	suite.Store = store
+}
+
+func (suite *BadgerStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *BadgerStoreTestSuite) TestIterAll() {
+	store := suite.Store.(*BadgerStore)
+	expected := map[hash.Hash][]byte{}
+	for i := 0; i < 10; i++ {
+		c := NewChunk(bytes.Repeat([]byte{byte(i)}, 100))
+		store.Put(c)
+		expected[c.Hash()] = c.Data()
+	}
+	suite.True(store.UpdateRoot(hash.FromData([]byte("root")), hash.Hash{}))
+
+	actual := map[hash.Hash][]byte{}
+	store.IterAll(func(c Chunk) {
+		actual[c.Hash()] = c.Data()
+	})
+	suite.Equal(expected, actual)
+}
+
+func TestBadgerStoreReopen(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// A new store uses the codec it's asked to, and keeps using it when reopened.
+	c := NewChunk(bytes.Repeat([]byte("abc"), 100))
+	store := NewBadgerStore(dir, ZstdCodec)
+	assert.Equal(ZstdCodec, store.Codec())
+	store.Put(c)
+	assert.True(store.UpdateRoot(c.Hash(), hash.Hash{}))
+	assert.NoError(store.Close())
+	assert.Panics(func() { store.Get(c.Hash()) })
+
+	store = NewBadgerStore(dir, FlateCodec)
+	defer store.Close()
+	assert.Equal(ZstdCodec, store.Codec())
+	assert.Equal(c.Hash(), store.Root())
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+}
+
+func TestBadgerStoreConcurrentWrites(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	store := NewBadgerStore(dir, DefaultCodec)
+	defer store.Close()
+
+	const writers, puts = 8, 100
+	wg := &sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < puts; j++ {
+				store.PutMany([]Chunk{NewChunk([]byte(fmt.Sprintf("%d %d a", i, j))), NewChunk([]byte(fmt.Sprintf("%d %d b", i, j)))})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.EqualValues(2*writers*puts, store.putCount)
+	for i := 0; i < writers; i++ {
+		for j := 0; j < puts; j++ {
+			assert.True(store.Has(NewChunk([]byte(fmt.Sprintf("%d %d b", i, j))).Hash()))
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+const (
+	bloomFilterMagic       = "nomsbloom1"
+	bloomFilterFPRate      = 0.01
+	minBloomFilterCapacity = 1 << 20
+)
+
+// BloomFilter is a probabilistic set of hashes. MayContain() never returns false for a hash that was added, but returns true for one that wasn't with a probability that grows as the filter fills up beyond its capacity. Since hashes are already uniformly distributed, the bit positions for a hash are derived from its digest by double hashing, rather than by hashing it again.
+type BloomFilter struct {
+	bits  []uint64
+	k     uint32
+	count uint64
+}
+
+// NewBloomFilter returns a BloomFilter sized to hold |capacity| hashes with a false positive rate of |fpRate|.
+func NewBloomFilter(capacity uint64, fpRate float64) *BloomFilter {
+	d.PanicIfFalse(capacity > 0 && fpRate > 0 && fpRate < 1, "Invalid bloom filter parameters")
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := uint32(math.Max(1, math.Floor(m/float64(capacity)*math.Ln2+0.5)))
+	return &BloomFilter{make([]uint64, (uint64(m)+63)/64), k, 0}
+}
+
+func (bf *BloomFilter) positions(h hash.Hash, cb func(word int, mask uint64)) {
+	digest := h.Digest()
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	m := uint64(len(bf.bits)) * 64
+	for i := uint32(0); i < bf.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		cb(int(pos/64), 1<<(pos%64))
+	}
+}
+
+// Add inserts |h| into the filter.
+func (bf *BloomFilter) Add(h hash.Hash) {
+	bf.positions(h, func(word int, mask uint64) {
+		bf.bits[word] |= mask
+	})
+	bf.count++
+}
+
+// MayContain returns false if |h| definitely hasn't been added to the filter.
+func (bf *BloomFilter) MayContain(h hash.Hash) bool {
+	contains := true
+	bf.positions(h, func(word int, mask uint64) {
+		contains = contains && bf.bits[word]&mask != 0
+	})
+	return contains
+}
+
+// Count returns the number of times Add() has been called.
+func (bf *BloomFilter) Count() uint64 {
+	return bf.count
+}
+
+/*
+Bloom filter file:
+
+	Magic  // bloomFilterMagic
+	Root   // 20-byte root of the store when the filter was written
+	K      // 4-byte number of bit positions per hash
+	Count  // 8-byte number of hashes added
+	Words  // 8-byte number of words of bits
+	Bits   // 8 bytes per word
+
+All integers are big-endian.
+*/
+func (bf *BloomFilter) write(w io.Writer, root hash.Hash) {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(bloomFilterMagic)
+	digest := root.Digest()
+	bw.Write(digest[:])
+	binary.Write(bw, binary.BigEndian, bf.k)
+	binary.Write(bw, binary.BigEndian, bf.count)
+	binary.Write(bw, binary.BigEndian, uint64(len(bf.bits)))
+	d.PanicIfError(binary.Write(bw, binary.BigEndian, bf.bits))
+	d.PanicIfError(bw.Flush())
+}
+
+// readBloomFilter returns the filter in |r| and the root it was written with, or false if |r| doesn't hold a valid filter.
+func readBloomFilter(r io.Reader) (*BloomFilter, hash.Hash, bool) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(bloomFilterMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != bloomFilterMagic {
+		return nil, hash.Hash{}, false
+	}
+	digest := hash.Digest{}
+	bf := &BloomFilter{}
+	words := uint64(0)
+	if _, err := io.ReadFull(br, digest[:]); err != nil {
+		return nil, hash.Hash{}, false
+	}
+	for _, v := range []interface{}{&bf.k, &bf.count, &words} {
+		if err := binary.Read(br, binary.BigEndian, v); err != nil {
+			return nil, hash.Hash{}, false
+		}
+	}
+	if bf.k == 0 || words == 0 || words > 1<<32 {
+		return nil, hash.Hash{}, false
+	}
+	bf.bits = make([]uint64, words)
+	if err := binary.Read(br, binary.BigEndian, bf.bits); err != nil {
+		return nil, hash.Hash{}, false
+	}
+	return bf, hash.New(digest), true
+}
+
+// BloomStore wraps a ChunkStore, keeping a bloom filter of the hashes of all the chunks in it, so that Has and Get calls for chunks that definitely aren't in the store are answered without consulting it. When pushing or pulling into the store, most of the chunks checked are either new, and answered by the filter, or found early in the traversal, so far fewer lookups reach the store. Chunks that the filter says may be present are always confirmed with the wrapped store, because of false positives.
+//
+// The filter is persisted to a file when the store is closed, along with the store's root. It's only reused if the store's root hasn't changed by the time it's next opened; otherwise it's rebuilt from the store's chunks. Likewise, if another process changes the root while the BloomStore is open, the filter may be missing that process's chunks, so it's bypassed until the store is reopened.
+type BloomStore struct {
+	ChunkStore
+	path     string
+	mu       sync.RWMutex
+	filter   *BloomFilter
+	lastRoot hash.Hash
+	stale    bool
+}
+
+// NewBloomStore returns a BloomStore wrapping |cs|, which must be a ChunkIterator, whose filter is persisted in the file at |path|. Closing it closes |cs|.
+func NewBloomStore(cs ChunkStore, path string) *BloomStore {
+	bs := &BloomStore{ChunkStore: cs, path: path, lastRoot: cs.Root()}
+	if f, err := os.Open(path); err == nil {
+		filter, root, ok := readBloomFilter(f)
+		f.Close()
+		if ok && root == bs.lastRoot {
+			bs.filter = filter
+		}
+	}
+	if bs.filter == nil {
+		iter, ok := cs.(ChunkIterator)
+		d.PanicIfFalse(ok, "ChunkStore %T can't enumerate its chunks, so it can't have a bloom filter", cs)
+		count := uint64(0)
+		iter.IterAll(func(c Chunk) { count++ })
+		capacity := uint64(minBloomFilterCapacity)
+		if 2*count > capacity {
+			capacity = 2 * count
+		}
+		bs.filter = NewBloomFilter(capacity, bloomFilterFPRate)
+		iter.IterAll(func(c Chunk) { bs.filter.Add(c.Hash()) })
+	}
+	return bs
+}
+
+// mayHave returns false if the chunk with hash |h| is definitely not in the store.
+func (bs *BloomStore) mayHave(h hash.Hash) bool {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return bs.stale || bs.filter.MayContain(h)
+}
+
+func (bs *BloomStore) Get(h hash.Hash) Chunk {
+	if !bs.mayHave(h) {
+		return EmptyChunk
+	}
+	return bs.ChunkStore.Get(h)
+}
+
+func (bs *BloomStore) Has(h hash.Hash) bool {
+	return bs.mayHave(h) && bs.ChunkStore.Has(h)
+}
+
+func (bs *BloomStore) GetMany(hashes hash.HashSlice) []Chunk {
+	found := make([]Chunk, len(hashes))
+	maybe := hash.HashSlice{}
+	indices := []int{}
+	for i, h := range hashes {
+		if bs.mayHave(h) {
+			maybe = append(maybe, h)
+			indices = append(indices, i)
+		} else {
+			found[i] = EmptyChunk
+		}
+	}
+	if len(maybe) > 0 {
+		for i, c := range bs.ChunkStore.GetMany(maybe) {
+			found[indices[i]] = c
+		}
+	}
+	return found
+}
+
+func (bs *BloomStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	absent = hash.HashSet{}
+	maybe := hash.HashSet{}
+	for h := range hashes {
+		if bs.mayHave(h) {
+			maybe.Insert(h)
+		} else {
+			absent.Insert(h)
+		}
+	}
+	if len(maybe) > 0 {
+		for h := range bs.ChunkStore.HasMany(maybe) {
+			absent.Insert(h)
+		}
+	}
+	return
+}
+
+func (bs *BloomStore) Put(c Chunk) {
+	bs.PutMany([]Chunk{c})
+}
+
+func (bs *BloomStore) PutMany(chunks []Chunk) BackpressureError {
+	// Add to the filter first, so that the chunks are never reported as absent once they may have been written.
+	bs.mu.Lock()
+	for _, c := range chunks {
+		if !bs.filter.MayContain(c.Hash()) {
+			bs.filter.Add(c.Hash())
+		}
+	}
+	bs.mu.Unlock()
+	return bs.ChunkStore.PutMany(chunks)
+}
+
+func (bs *BloomStore) Root() hash.Hash {
+	root := bs.ChunkStore.Root()
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if root != bs.lastRoot {
+		bs.stale = true
+	}
+	return root
+}
+
+func (bs *BloomStore) RootLog(n int) []RootLogEntry {
+	if rl, ok := bs.ChunkStore.(RootLogger); ok {
+		return rl.RootLog(n)
+	}
+	return nil
+}
+
+func (bs *BloomStore) UpdateRoot(current, last hash.Hash) bool {
+	ok := bs.ChunkStore.UpdateRoot(current, last)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if ok && last == bs.lastRoot {
+		bs.lastRoot = current
+	} else {
+		bs.stale = true
+	}
+	return ok
+}
+
+// Close saves the filter, unless it's been bypassed because another process changed the store, and closes the wrapped store.
+func (bs *BloomStore) Close() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if !bs.stale {
+		// Write the filter atomically, so a crash never leaves a truncated one behind.
+		f, err := os.Create(bs.path + ".tmp")
+		if err == nil {
+			bs.filter.write(f, bs.lastRoot)
+			if err = f.Close(); err == nil {
+				err = os.Rename(f.Name(), bs.path)
+			}
+		}
+		d.PanicIfError(err)
+	}
+	return bs.ChunkStore.Close()
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/hash"
+)
+
+func TestBloomFilter(t *testing.T) {
+	assert := assert.New(t)
+	bf := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		bf.Add(hash.FromData([]byte(fmt.Sprintf("in%d", i))))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(bf.MayContain(hash.FromData([]byte(fmt.Sprintf("in%d", i)))))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bf.MayContain(hash.FromData([]byte(fmt.Sprintf("out%d", i)))) {
+			falsePositives++
+		}
+	}
+	assert.True(falsePositives < 300, "%d false positives", falsePositives)
+
+	buf := &bytes.Buffer{}
+	root := hash.FromData([]byte("root"))
+	bf.write(buf, root)
+	read, readRoot, ok := readBloomFilter(buf)
+	assert.True(ok)
+	assert.Equal(root, readRoot)
+	assert.Equal(bf, read)
+
+	_, _, ok = readBloomFilter(bytes.NewBufferString("nomsbloom1 but truncated"))
+	assert.False(ok)
+}
+
+func TestBloomStoreTestSuite(t *testing.T) {
+	suite.Run(t, &BloomStoreTestSuite{})
+}
+
+type BloomStoreTestSuite struct {
+	ChunkStoreTestSuite
+	dir string
+}
+
+func (suite *BloomStoreTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir(os.TempDir(), "")
+	suite.NoError(err)
+	suite.Store = NewBloomStore(NewMemoryStore(), filepath.Join(suite.dir, "bloom"))
+}
+
+func (suite *BloomStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *BloomStoreTestSuite) TestSkipsLookupsOfAbsentChunks() {
+	ts := NewTestStore()
+	present := NewChunk([]byte("present"))
+	ts.Put(present)
+	bs := NewBloomStore(ts, filepath.Join(suite.dir, "skip"))
+
+	absent := NewChunk([]byte("absent"))
+	suite.False(bs.Has(absent.Hash()))
+	suite.True(bs.Get(absent.Hash()).IsEmpty())
+	suite.Equal(hash.HashSet{absent.Hash(): struct{}{}}, bs.HasMany(hash.HashSet{present.Hash(): struct{}{}, absent.Hash(): struct{}{}}))
+	chunks := bs.GetMany(hash.HashSlice{absent.Hash(), present.Hash()})
+	suite.True(chunks[0].IsEmpty())
+	suite.Equal(present.Hash(), chunks[1].Hash())
+	suite.Equal(1, ts.Hases)
+	suite.Equal(1, ts.Reads)
+
+	// Chunks put through the store are added to the filter.
+	bs.Put(absent)
+	suite.True(bs.Has(absent.Hash()))
+}
+
+func (suite *BloomStoreTestSuite) TestPersistence() {
+	ts := NewTestStore()
+	path := filepath.Join(suite.dir, "persist")
+	bs := NewBloomStore(ts, path)
+	c := NewChunk([]byte("abc"))
+	bs.Put(c)
+	suite.True(bs.UpdateRoot(c.Hash(), hash.Hash{}))
+	suite.NoError(bs.Close())
+	_, err := os.Stat(path)
+	suite.NoError(err)
+
+	// A chunk that's in the store but was never put through a BloomStore is only found if the filter is rebuilt.
+	other := NewChunk([]byte("other"))
+	ts.Put(other)
+	bs = NewBloomStore(ts, path)
+	suite.True(bs.Has(c.Hash()))
+	suite.False(bs.Has(other.Hash()))
+	suite.NoError(bs.Close())
+
+	// Changing the root behind the filter's back makes it stale, so it's rebuilt.
+	ts.UpdateRoot(other.Hash(), c.Hash())
+	bs = NewBloomStore(ts, path)
+	suite.True(bs.Has(other.Hash()))
+	suite.NoError(bs.Close())
+}
+
+func (suite *BloomStoreTestSuite) TestBypassedWhenRootChangesUnderneath() {
+	ts := NewTestStore()
+	bs := NewBloomStore(ts, filepath.Join(suite.dir, "bypass"))
+
+	// Simulate another process writing to the store.
+	c := NewChunk([]byte("abc"))
+	ts.Put(c)
+	ts.UpdateRoot(c.Hash(), hash.Hash{})
+	suite.False(bs.Has(c.Hash()))
+
+	suite.Equal(c.Hash(), bs.Root())
+	suite.True(bs.Has(c.Hash()))
+	suite.Equal(c.Hash(), bs.Get(c.Hash()).Hash())
+}
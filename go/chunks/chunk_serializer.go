@@ -7,6 +7,7 @@ package chunks
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"sync"
 
@@ -25,6 +26,10 @@ import (
     Hash  // 20-byte hash
     Len   // 4-byte int
     Data  // len(Data) == Len
+
+  A stream of Chunks written with SerializeEnd after the last one ends with a
+  frame whose Hash and Len are all zeroes, so that DeserializeStream can tell
+  a complete stream from one that was cut off.
 */
 
 // Serialize a single Chunk to writer.
@@ -46,6 +51,12 @@ func Serialize(chunk Chunk, writer io.Writer) {
 	d.PanicIfFalse(uint32(n) == chunkSize)
 }
 
+// SerializeEnd writes the frame that ends a stream of Chunks written with Serialize, so that DeserializeStream knows it got all of them.
+func SerializeEnd(writer io.Writer) {
+	_, err := writer.Write(make([]byte, hash.ByteLen+4))
+	d.Chk.NoError(err)
+}
+
 // Deserialize reads off of |reader| until EOF, sending chunks to |cs|. If
 // |rateLimit| is non-nil, concurrency will be limited to the available
 // capacity of the channel.
@@ -76,39 +87,93 @@ func Deserialize(reader io.Reader, cs ChunkSink, rateLimit chan struct{}) {
 
 // DeserializeToChan reads off of |reader| until EOF, sending chunks to
 // chunkChan in the order they are read. Objects sent over chunkChan are
-// *Chunk.
+// *Chunk, except that if reader can't be read, or doesn't hold valid chunks,
+// the error is sent instead, and reading stops.
 // The type is `chan<- interface{}` so that this is compatible with
 // orderedparallel.New().
 func DeserializeToChan(reader io.Reader, chunkChan chan<- interface{}) {
+	defer close(chunkChan)
 	for {
-		c, success := deserializeChunk(reader)
-		if !success {
-			break
+		c, end, err := deserializeFrame(reader)
+		if err == io.EOF || end {
+			return
+		}
+		if err != nil {
+			chunkChan <- err
+			return
 		}
 		chunkChan <- &c
 	}
-	close(chunkChan)
+}
+
+// DeserializeStream reads Chunks off of |reader| until the frame written by SerializeEnd, sending each to |cs| as it's read, in order. Since it doesn't read the next Chunk until |cs| has taken the last one, a slow ChunkSink slows down the writer, rather than letting Chunks pile up in memory. It returns an error if |reader| ends before that frame, as when the writer failed part way through.
+func DeserializeStream(reader io.Reader, cs ChunkSink) error {
+	for {
+		c, end, err := deserializeFrame(reader)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+		cs.Put(c)
+	}
 }
 
 func deserializeChunk(reader io.Reader) (Chunk, bool) {
-	digest := hash.Digest{}
-	n, err := io.ReadFull(reader, digest[:])
-	if err == io.EOF {
+	c, end, err := deserializeFrame(reader)
+	if err == io.EOF || end {
 		return EmptyChunk, false
 	}
 	d.Chk.NoError(err)
-	d.PanicIfFalse(int(hash.ByteLen) == n)
-	h := hash.New(digest)
+	return c, true
+}
+
+// maxPreallocatedChunkSize is the largest chunk deserializeFrame makes room for before reading it. A frame's length comes from whoever wrote it, so bigger chunks are read into a buffer that grows as their data arrives, rather than letting a few bytes claiming a huge chunk allocate it.
+const maxPreallocatedChunkSize = 1 << 20
+
+// deserializeFrame reads the next Chunk off of |reader|. It returns io.EOF if |reader| is at its end, and |end| if the frame is the one written by SerializeEnd. It returns an error, rather than panicking, if the frame is corrupt, since it may come from a client or server that can't be trusted.
+func deserializeFrame(reader io.Reader) (c Chunk, end bool, err error) {
+	digest := hash.Digest{}
+	if _, err = io.ReadFull(reader, digest[:]); err != nil {
+		return
+	}
 
 	chunkSize := uint32(0)
-	err = binary.Read(reader, binary.BigEndian, &chunkSize)
-	d.Chk.NoError(err)
+	if err = binary.Read(reader, binary.BigEndian, &chunkSize); err != nil {
+		return c, false, unexpectedEOF(err)
+	}
+	if digest == (hash.Digest{}) && chunkSize == 0 {
+		return EmptyChunk, true, nil
+	}
 
-	data := make([]byte, int(chunkSize))
-	n, err = io.ReadFull(reader, data)
-	d.Chk.NoError(err)
-	d.PanicIfFalse(int(chunkSize) == n)
-	c := NewChunk(data)
-	d.PanicIfFalse(h == c.Hash(), "%s != %s", h, c.Hash())
-	return c, true
+	var data []byte
+	if chunkSize <= maxPreallocatedChunkSize {
+		data = make([]byte, int(chunkSize))
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return c, false, unexpectedEOF(err)
+		}
+	} else {
+		buf := &bytes.Buffer{}
+		if _, err = io.CopyN(buf, reader, int64(chunkSize)); err != nil {
+			return c, false, unexpectedEOF(err)
+		}
+		data = buf.Bytes()
+	}
+	h := hash.New(digest)
+	c = NewChunk(data)
+	if h != c.Hash() {
+		return EmptyChunk, false, fmt.Errorf("Chunk hash mismatch: %s != %s", h, c.Hash())
+	}
+	return c, false, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
@@ -0,0 +1,77 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func serializeChunks(end bool, chnx ...Chunk) []byte {
+	buf := &bytes.Buffer{}
+	for _, c := range chnx {
+		Serialize(c, buf)
+	}
+	if end {
+		SerializeEnd(buf)
+	}
+	return buf.Bytes()
+}
+
+func TestDeserializeStream(t *testing.T) {
+	assert := assert.New(t)
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+
+	ms := NewMemoryStore()
+	assert.NoError(DeserializeStream(bytes.NewReader(serializeChunks(true, c1, c2)), ms))
+	assert.True(ms.Has(c1.Hash()))
+	assert.True(ms.Has(c2.Hash()))
+
+	// A stream that stops before its end frame fails.
+	assert.Equal(io.ErrUnexpectedEOF, DeserializeStream(bytes.NewReader(serializeChunks(false, c1)), NewMemoryStore()))
+}
+
+func TestDeserializeCorrupt(t *testing.T) {
+	assert := assert.New(t)
+	c := NewChunk([]byte("abc"))
+
+	// A chunk whose data doesn't match its hash fails, rather than panicking.
+	data := serializeChunks(false, c)
+	data[len(data)-1] ^= 0xff
+	assert.Error(DeserializeStream(bytes.NewReader(data), NewMemoryStore()))
+
+	// A frame claiming a huge chunk fails once the data runs out, without first allocating room for all of it.
+	digest := c.Hash().Digest()
+	buf := bytes.NewBuffer(digest[:])
+	binary.Write(buf, binary.BigEndian, uint32(1<<31))
+	buf.WriteString("not nearly enough")
+	assert.Equal(io.ErrUnexpectedEOF, DeserializeStream(buf, NewMemoryStore()))
+
+	// DeserializeToChan sends the error, and stops.
+	chunkChan := make(chan interface{}, 2)
+	DeserializeToChan(bytes.NewReader(data), chunkChan)
+	assert.Error((<-chunkChan).(error))
+	_, ok := <-chunkChan
+	assert.False(ok)
+}
+
+// FuzzDeserialize checks that deserializing arbitrary bytes, as a server does the chunks it's sent, fails with an error rather than panicking.
+func FuzzDeserialize(f *testing.F) {
+	f.Add(serializeChunks(true, NewChunk([]byte("abc")), NewChunk([]byte("def"))))
+	f.Add(serializeChunks(false, NewChunk([]byte("abc"))))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DeserializeStream(bytes.NewReader(data), NewMemoryStore())
+		chunkChan := make(chan interface{})
+		go DeserializeToChan(bytes.NewReader(data), chunkChan)
+		for range chunkChan {
+		}
+	})
+}
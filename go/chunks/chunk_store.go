@@ -7,6 +7,7 @@ package chunks
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/stormasm/noms/go/hash"
 )
@@ -32,6 +33,18 @@ type RootTracker interface {
 	UpdateRoot(current, last hash.Hash) bool
 }
 
+// RootLogger is implemented by ChunkStores which keep a log of the roots they've had, so that a database can be rolled back after a bad update. ChunkStores which wrap another one implement it by passing the call on, and return nil if the wrapped store doesn't keep a log.
+type RootLogger interface {
+	// RootLog returns up to |n| of the most recent roots, most recent first, the first of which is the current root.
+	RootLog(n int) []RootLogEntry
+}
+
+// RootLogEntry records that the root of a ChunkStore was set to Root at Time.
+type RootLogEntry struct {
+	Root hash.Hash
+	Time time.Time
+}
+
 // ChunkSource is a place to get chunks from.
 type ChunkSource interface {
 	// Get the Chunk for the value of the hash in the store. If the hash is absent from the store nil is returned.
@@ -40,6 +53,12 @@ type ChunkSource interface {
 	// Returns true iff the value at the address |h| is contained in the source
 	Has(h hash.Hash) bool
 
+	// GetMany returns the Chunks for |hashes|, in the same order. Absent chunks are returned as EmptyChunk. Stores with high per-request latency fetch the chunks in as few requests as they can.
+	GetMany(hashes hash.HashSlice) []Chunk
+
+	// HasMany returns the subset of |hashes| which are absent from the source.
+	HasMany(hashes hash.HashSet) (absent hash.HashSet)
+
 	// Returns the NomsVersion with which this ChunkSource is compatible.
 	Version() string
 }
@@ -55,6 +74,12 @@ type ChunkSink interface {
 	io.Closer
 }
 
+// ChunkIterator is implemented by ChunkStores which can enumerate the chunks they contain.
+type ChunkIterator interface {
+	// IterAll calls |cb| with every chunk in the store, in no particular order. The Chunks passed to |cb| have the hash under which they're stored, which isn't verified against their data. Chunks whose data can't be read at all are passed with nil data. |cb| may not write to the store.
+	IterAll(cb func(c Chunk))
+}
+
 // BackpressureError is a slice of hash.Hash that indicates some chunks could not be Put(). Caller is free to try to Put them again later.
 type BackpressureError hash.HashSlice
 
@@ -91,3 +91,19 @@ func (suite *ChunkStoreTestSuite) TestChunkStoreVersion() {
 
 	suite.Equal(constants.NomsVersion, suite.Store.Version())
 }
+
+func (suite *ChunkStoreTestSuite) TestChunkStoreGetManyHasMany() {
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+	missing := hash.Parse("11111111111111111111111111111111")
+	suite.Store.PutMany([]Chunk{c1, c2})
+	suite.Store.UpdateRoot(c1.Hash(), suite.Store.Root()) // Commit writes
+
+	found := suite.Store.GetMany(hash.HashSlice{c2.Hash(), missing, c1.Hash()})
+	suite.Len(found, 3)
+	suite.Equal(c2.Data(), found[0].Data())
+	suite.True(found[1].IsEmpty())
+	suite.Equal(c1.Data(), found[2].Data())
+
+	absent := suite.Store.HasMany(hash.HashSet{c1.Hash(): struct{}{}, c2.Hash(): struct{}{}, missing: struct{}{}})
+	suite.Equal(hash.HashSet{missing: struct{}{}}, absent)
+}
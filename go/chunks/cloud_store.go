@@ -0,0 +1,181 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+const (
+	cloudWriteConcurrency = 32
+	cloudChunkDir         = "chunks/"
+	cloudRootKey          = "root"
+)
+
+// objectSvc is the subset of an object storage API used by CloudStore. Unlike S3, the services behind it support conditional writes, so no separate manifest is needed.
+type objectSvc interface {
+	// GetObject returns the contents of the object at |key| along with its generation, an opaque token which changes every time the object is written, or nil if there is no such object.
+	GetObject(key string) (data []byte, generation string, err error)
+	HeadObject(key string) (bool, error)
+	PutObject(key string, data []byte) error
+	// PutObjectIfGeneration writes |data| to |key| only if the object there is currently at |generation|, or if |generation| is empty, only if there's no object there. It returns false if that precondition doesn't hold.
+	PutObjectIfGeneration(key string, data []byte, generation string) (bool, error)
+}
+
+// CloudStore implements ChunkStore on an object storage service which supports conditional writes, such as Google Cloud Storage or Azure Blob Storage, by storing each chunk as an object under the given prefix. The root and version are kept together in a single root object, which UpdateRoot() replaces only if it hasn't changed since it was read, so no separate manifest is needed.
+// Chunks are written asynchronously; UpdateRoot() blocks until all pending writes are complete before updating the root.
+type CloudStore struct {
+	prefix        string
+	svc           objectSvc
+	writeQueue    chan Chunk
+	requestWg     *sync.WaitGroup
+	workerWg      *sync.WaitGroup
+	unwrittenPuts *unwrittenPutCache
+}
+
+// NewGCSStore returns a CloudStore which stores chunks in the Google Cloud Storage |bucket| under |prefix|. Credentials are taken from the environment, as described by newGCSClient().
+func NewGCSStore(bucket, prefix string) *CloudStore {
+	return newCloudStore(prefix, newGCSClient(bucket))
+}
+
+// NewAzureStore returns a CloudStore which stores chunks in |container| of the Azure storage |account| under |prefix|. Credentials are taken from the environment, as described by newAzureClient().
+func NewAzureStore(account, container, prefix string) *CloudStore {
+	client, err := newAzureClient(account, container)
+	d.PanicIfError(err)
+	return newCloudStore(prefix, client)
+}
+
+func newCloudStore(prefix string, svc objectSvc) *CloudStore {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	store := &CloudStore{
+		prefix:        prefix,
+		svc:           svc,
+		writeQueue:    make(chan Chunk, cloudWriteConcurrency),
+		requestWg:     &sync.WaitGroup{},
+		workerWg:      &sync.WaitGroup{},
+		unwrittenPuts: newUnwrittenPutCache(),
+	}
+	for i := 0; i < cloudWriteConcurrency; i++ {
+		store.workerWg.Add(1)
+		go func() {
+			defer store.workerWg.Done()
+			for c := range store.writeQueue {
+				d.Chk.NoError(store.svc.PutObject(store.chunkKey(c.Hash()), c.Data()))
+				store.unwrittenPuts.Clear([]Chunk{c})
+				store.requestWg.Done()
+			}
+		}()
+	}
+	return store
+}
+
+func (s *CloudStore) chunkKey(h hash.Hash) string {
+	return s.prefix + cloudChunkDir + h.String()
+}
+
+func (s *CloudStore) Get(h hash.Hash) Chunk {
+	if pending := s.unwrittenPuts.Get(h); !pending.IsEmpty() {
+		return pending
+	}
+
+	data, _, err := s.svc.GetObject(s.chunkKey(h))
+	d.Chk.NoError(err)
+	if data == nil {
+		return EmptyChunk
+	}
+	return NewChunkWithHash(h, data)
+}
+
+func (s *CloudStore) Has(h hash.Hash) bool {
+	if pending := s.unwrittenPuts.Get(h); !pending.IsEmpty() {
+		return true
+	}
+
+	has, err := s.svc.HeadObject(s.chunkKey(h))
+	d.Chk.NoError(err)
+	return has
+}
+
+// GetMany fetches the chunks with concurrent requests, since neither GCS nor Azure has a batch read.
+func (s *CloudStore) GetMany(hashes hash.HashSlice) []Chunk {
+	return getManyConcurrently(s.Get, hashes)
+}
+
+func (s *CloudStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return hasManyConcurrently(s.Has, hashes)
+}
+
+func (s *CloudStore) Put(c Chunk) {
+	if !s.unwrittenPuts.Add(c) {
+		return
+	}
+
+	s.requestWg.Add(1)
+	s.writeQueue <- c
+}
+
+func (s *CloudStore) PutMany(chunks []Chunk) (e BackpressureError) {
+	for _, c := range chunks {
+		s.Put(c)
+	}
+	return
+}
+
+/*
+Root object:
+
+	Version  // NomsVersion of the data
+	Root     // the root hash
+
+Each field is on its own line.
+*/
+func (s *CloudStore) readRoot() (vers string, root hash.Hash, generation string) {
+	data, generation, err := s.svc.GetObject(s.prefix + cloudRootKey)
+	d.Chk.NoError(err)
+	if data == nil {
+		return constants.NomsVersion, hash.Hash{}, ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	d.PanicIfFalse(len(lines) == 2, "%s%s is not a root object", s.prefix, cloudRootKey)
+	return lines[0], hash.Parse(lines[1]), generation
+}
+
+func (s *CloudStore) Version() string {
+	vers, _, _ := s.readRoot()
+	return vers
+}
+
+func (s *CloudStore) Root() hash.Hash {
+	_, root, _ := s.readRoot()
+	return root
+}
+
+func (s *CloudStore) UpdateRoot(current, last hash.Hash) bool {
+	s.requestWg.Wait()
+
+	_, root, generation := s.readRoot()
+	if root != last {
+		return false
+	}
+	data := fmt.Sprintf("%s\n%s\n", constants.NomsVersion, current)
+	ok, err := s.svc.PutObjectIfGeneration(s.prefix+cloudRootKey, []byte(data), generation)
+	d.Chk.NoError(err)
+	return ok
+}
+
+func (s *CloudStore) Close() error {
+	s.requestWg.Wait()
+	close(s.writeQueue)
+	s.workerWg.Wait()
+	return nil
+}
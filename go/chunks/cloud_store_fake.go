@@ -0,0 +1,69 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type fakeObject struct {
+	data       []byte
+	generation int
+}
+
+// fakeObjectSvc is an in-memory objectSvc, whose generations count the writes made to each object.
+type fakeObjectSvc struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	numPuts int // Number of chunks written; the root object isn't counted.
+}
+
+func createFakeObjectSvc() *fakeObjectSvc {
+	return &fakeObjectSvc{objects: map[string]fakeObject{}}
+}
+
+func (f *fakeObjectSvc) GetObject(key string) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o, ok := f.objects[key]
+	if !ok {
+		return nil, "", nil
+	}
+	return o.data, strconv.Itoa(o.generation), nil
+}
+
+func (f *fakeObjectSvc) HeadObject(key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.objects[key]
+	return ok, nil
+}
+
+func (f *fakeObjectSvc) PutObject(key string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.put(key, data)
+	return nil
+}
+
+func (f *fakeObjectSvc) PutObjectIfGeneration(key string, data []byte, generation string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o, ok := f.objects[key]
+	if (generation == "" && ok) || (generation != "" && (!ok || strconv.Itoa(o.generation) != generation)) {
+		return false, nil
+	}
+	f.put(key, data)
+	return true, nil
+}
+
+func (f *fakeObjectSvc) put(key string, data []byte) {
+	f.objects[key] = fakeObject{append([]byte{}, data...), f.objects[key].generation + 1}
+	if strings.Contains(key, cloudChunkDir) {
+		f.numPuts++
+	}
+}
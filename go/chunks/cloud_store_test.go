@@ -0,0 +1,276 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/hash"
+)
+
+func TestCloudStoreTestSuite(t *testing.T) {
+	suite.Run(t, &CloudStoreTestSuite{})
+}
+
+type CloudStoreTestSuite struct {
+	ChunkStoreTestSuite
+	svc *fakeObjectSvc
+}
+
+func (suite *CloudStoreTestSuite) SetupTest() {
+	suite.svc = createFakeObjectSvc()
+	suite.Store = newCloudStore("prefix", suite.svc)
+	suite.putCountFn = func() int {
+		suite.svc.mu.Lock()
+		defer suite.svc.mu.Unlock()
+		return suite.svc.numPuts
+	}
+}
+
+func (suite *CloudStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+}
+
+func (suite *CloudStoreTestSuite) TestReopen() {
+	c := NewChunk([]byte("abc"))
+	suite.Store.Put(c)
+	suite.True(suite.Store.UpdateRoot(c.Hash(), hash.Hash{}))
+	suite.Equal(constants.NomsVersion, suite.Store.Version())
+
+	store := newCloudStore("prefix/", suite.svc)
+	defer store.Close()
+	suite.Equal(c.Hash(), store.Root())
+	suite.True(store.Has(c.Hash()))
+	suite.Equal(c.Data(), store.Get(c.Hash()).Data())
+
+	other := newCloudStore("other", suite.svc)
+	defer other.Close()
+	suite.True(other.Root().IsEmpty())
+	suite.False(other.Has(c.Hash()))
+}
+
+func (suite *CloudStoreTestSuite) TestConcurrentUpdateRoot() {
+	// Every store tries to advance the root from the same starting point, so exactly one should win.
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	winners := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store := newCloudStore("prefix", suite.svc)
+			defer store.Close()
+			c := NewChunk([]byte{byte(i)})
+			store.Put(c)
+			if store.UpdateRoot(c.Hash(), hash.Hash{}) {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	suite.Equal(1, winners)
+	suite.False(suite.Store.Root().IsEmpty())
+}
+
+// newFakeGCSServer serves the parts of the GCS JSON API used by gcsClient, from |svc|.
+func newFakeGCSServer(bucket string, svc *fakeObjectSvc) *httptest.Server {
+	objectPrefix := "/storage/v1/b/" + bucket + "/o/"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		switch {
+		case r.Method == "GET" && strings.HasPrefix(r.URL.EscapedPath(), objectPrefix):
+			key, err := url.QueryUnescape(strings.TrimPrefix(r.URL.EscapedPath(), objectPrefix))
+			if err != nil || strings.Contains(key, "+") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, generation, _ := svc.GetObject(key)
+			if data == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("X-Goog-Generation", generation)
+			if query.Get("alt") == "media" {
+				w.Write(data)
+			} else {
+				w.Write([]byte(`{"generation":"` + generation + `"}`))
+			}
+		case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/"+bucket+"/o":
+			data, _ := ioutil.ReadAll(r.Body)
+			key := query.Get("name")
+			if generation, ok := query["ifGenerationMatch"]; ok {
+				if generation[0] == "0" {
+					generation[0] = ""
+				}
+				if ok, _ := svc.PutObjectIfGeneration(key, data, generation[0]); !ok {
+					w.WriteHeader(http.StatusPreconditionFailed)
+				}
+				return
+			}
+			svc.PutObject(key, data)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+// newFakeAzureServer serves the parts of the Azure Blob Storage REST API used by azureClient, from |svc|. Requests must be signed by |signer|.
+func newFakeAzureServer(container string, signer *azureClient, svc *fakeObjectSvc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		signer.sign(r)
+		if auth == "" || auth != r.Header.Get("Authorization") || r.Header.Get("x-ms-version") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/"+container+"/")
+		switch r.Method {
+		case "GET", "HEAD":
+			data, generation, _ := svc.GetObject(key)
+			if data == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("ETag", `"`+generation+`"`)
+			w.Write(data)
+		case "PUT":
+			if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			generation, conditional := strings.Trim(r.Header.Get("If-Match"), `"`), true
+			if r.Header.Get("If-None-Match") == "*" {
+				generation = ""
+			} else if generation == "" {
+				conditional = false
+			}
+			if !conditional {
+				svc.PutObject(key, data)
+			} else if ok, _ := svc.PutObjectIfGeneration(key, data, generation); !ok {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestGCSStoreTestSuite(t *testing.T) {
+	suite.Run(t, &GCSStoreTestSuite{})
+}
+
+type GCSStoreTestSuite struct {
+	ChunkStoreTestSuite
+	server *httptest.Server
+}
+
+func (suite *GCSStoreTestSuite) SetupTest() {
+	svc := createFakeObjectSvc()
+	suite.server = newFakeGCSServer("bucket", svc)
+	client := &gcsClient{suite.server.URL, "bucket", http.DefaultClient, func() (string, error) { return "token", nil }}
+	suite.Store = newCloudStore("some prefix", client)
+	suite.putCountFn = func() int {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		return svc.numPuts
+	}
+}
+
+func (suite *GCSStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	suite.server.Close()
+}
+
+func (suite *GCSStoreTestSuite) TestConditionalRootUpdate() {
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+	suite.True(suite.Store.UpdateRoot(c1.Hash(), hash.Hash{}))
+	suite.False(suite.Store.UpdateRoot(c2.Hash(), hash.Hash{}))
+	suite.True(suite.Store.UpdateRoot(c2.Hash(), c1.Hash()))
+	suite.Equal(c2.Hash(), suite.Store.Root())
+}
+
+func TestAzureStoreTestSuite(t *testing.T) {
+	suite.Run(t, &AzureStoreTestSuite{})
+}
+
+type AzureStoreTestSuite struct {
+	ChunkStoreTestSuite
+	server *httptest.Server
+}
+
+func (suite *AzureStoreTestSuite) SetupTest() {
+	svc := createFakeObjectSvc()
+	client := &azureClient{account: "account", container: "container", key: []byte("secret"), client: http.DefaultClient}
+	suite.server = newFakeAzureServer("container", client, svc)
+	client.endpoint, _ = url.Parse(suite.server.URL)
+	suite.Store = newCloudStore("prefix", client)
+	suite.putCountFn = func() int {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		return svc.numPuts
+	}
+}
+
+func (suite *AzureStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	suite.server.Close()
+}
+
+func (suite *AzureStoreTestSuite) TestConditionalRootUpdate() {
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+	suite.True(suite.Store.UpdateRoot(c1.Hash(), hash.Hash{}))
+	suite.False(suite.Store.UpdateRoot(c2.Hash(), hash.Hash{}))
+	suite.True(suite.Store.UpdateRoot(c2.Hash(), c1.Hash()))
+	suite.Equal(c2.Hash(), suite.Store.Root())
+}
+
+func TestAzureClientCredentials(t *testing.T) {
+	assert := assert.New(t)
+	setEnv := func(key, sas string) {
+		assert.NoError(os.Setenv("AZURE_STORAGE_KEY", key))
+		assert.NoError(os.Setenv("AZURE_STORAGE_SAS_TOKEN", sas))
+	}
+	defer setEnv("", "")
+
+	setEnv("", "")
+	_, err := newAzureClient("account", "container")
+	assert.Error(err)
+
+	setEnv("not base64!", "")
+	_, err = newAzureClient("account", "container")
+	assert.Error(err)
+
+	setEnv(base64.StdEncoding.EncodeToString([]byte("secret")), "")
+	c, err := newAzureClient("account", "container")
+	assert.NoError(err)
+	assert.Equal([]byte("secret"), c.key)
+	assert.Equal("https://account.blob.core.windows.net/container/chunks/x", c.blobURL("chunks/x").String())
+
+	setEnv("", "?sv=2016-05-31&sig=abc")
+	c, err = newAzureClient("account", "container")
+	assert.NoError(err)
+	assert.Nil(c.key)
+	assert.Equal("https://account.blob.core.windows.net/container/x?sig=abc&sv=2016-05-31", c.blobURL("x").String())
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stormasm/noms/go/d"
+)
+
+// Codec names the compression applied to chunk data at rest. The codec used by a store is recorded in the store itself, so data is always decoded with the codec it was encoded with.
+type Codec string
+
+const (
+	// NoCompression stores chunk data as is.
+	NoCompression Codec = "none"
+	// SnappyCodec is fast, but compresses less than FlateCodec. It's what LevelDBStore has always used, so it's the default.
+	SnappyCodec Codec = "snappy"
+	// FlateCodec trades CPU for size, typically shrinking serialized chunks by a further 30-50% over SnappyCodec.
+	FlateCodec Codec = "flate"
+	// ZstdCodec compresses about as well as FlateCodec, or better, and decompresses several times faster, so it's the best choice for stores that are mostly read.
+	ZstdCodec Codec = "zstd"
+
+	DefaultCodec = SnappyCodec
+)
+
+// ParseCodec returns the Codec named |name|.
+func ParseCodec(name string) (Codec, error) {
+	switch c := Codec(name); c {
+	case NoCompression, SnappyCodec, FlateCodec, ZstdCodec:
+		return c, nil
+	}
+	return "", fmt.Errorf("Unknown codec %q, must be one of %q, %q, %q or %q", name, NoCompression, SnappyCodec, FlateCodec, ZstdCodec)
+}
+
+// zstdEncoder and zstdDecoder are shared by all of ZstdCodec's calls, since they're safe to use concurrently through EncodeAll and DecodeAll, and costly to make.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// Encode returns |data| compressed with c.
+func (c Codec) Encode(data []byte) []byte {
+	switch c {
+	case NoCompression:
+		return data
+	case SnappyCodec:
+		return snappy.Encode(nil, data)
+	case FlateCodec:
+		buf := &bytes.Buffer{}
+		w, err := flate.NewWriter(buf, flate.BestCompression)
+		d.Chk.NoError(err)
+		_, err = w.Write(data)
+		d.Chk.NoError(err)
+		d.Chk.NoError(w.Close())
+		return buf.Bytes()
+	case ZstdCodec:
+		return zstdEncoder.EncodeAll(data, nil)
+	}
+	panic("Unknown codec: " + string(c))
+}
+
+// Decode returns |data|, which must have been returned by c.Encode(), uncompressed.
+func (c Codec) Decode(data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case SnappyCodec:
+		return snappy.Decode(nil, data)
+	case FlateCodec:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case ZstdCodec:
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	panic("Unknown codec: " + string(c))
+}
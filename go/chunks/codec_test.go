@@ -0,0 +1,39 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	data := bytes.Repeat([]byte("noms chunk data "), 1000)
+
+	for _, name := range []string{"none", "snappy", "flate", "zstd"} {
+		codec, err := ParseCodec(name)
+		assert.NoError(err)
+		encoded := codec.Encode(data)
+		if codec != NoCompression {
+			assert.True(len(encoded) < len(data), name)
+		}
+		decoded, err := codec.Decode(encoded)
+		assert.NoError(err)
+		assert.Equal(data, decoded, name)
+	}
+
+	assert.True(len(FlateCodec.Encode(data)) < len(SnappyCodec.Encode(data)))
+	assert.True(len(ZstdCodec.Encode(data)) < len(SnappyCodec.Encode(data)))
+
+	_, err := ParseCodec("zip")
+	assert.Error(err)
+	_, err = FlateCodec.Decode([]byte("not flate"))
+	assert.Error(err)
+	_, err = ZstdCodec.Decode([]byte("not zstd"))
+	assert.Error(err)
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"context"
+
+	"github.com/stormasm/noms/go/hash"
+)
+
+// runContext calls |f| on a goroutine of its own, and returns once it does, unless |ctx| is done first, in which case it returns ctx.Err(), leaving f to finish by itself. If f panics while it's still being waited for, runContext panics with the same value. ChunkStores are safe to use from more than one goroutine, so a store can be used again while an operation that's been given up on is still running, though the operation may yet take effect.
+func runContext(ctx context.Context, f func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Buffered, so that f can return after it's been given up on.
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		f()
+	}()
+	select {
+	case r := <-done:
+		if r != nil {
+			panic(r)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetContext is like cs.Get(), but gives up, returning ctx.Err(), if |ctx| is done first.
+func GetContext(ctx context.Context, cs ChunkSource, h hash.Hash) (c Chunk, err error) {
+	err = runContext(ctx, func() { c = cs.Get(h) })
+	return
+}
+
+// GetManyContext is like cs.GetMany(), but gives up, returning ctx.Err(), if |ctx| is done first.
+func GetManyContext(ctx context.Context, cs ChunkSource, hashes hash.HashSlice) (found []Chunk, err error) {
+	err = runContext(ctx, func() { found = cs.GetMany(hashes) })
+	return
+}
+
+// HasContext is like cs.Has(), but gives up, returning ctx.Err(), if |ctx| is done first.
+func HasContext(ctx context.Context, cs ChunkSource, h hash.Hash) (has bool, err error) {
+	err = runContext(ctx, func() { has = cs.Has(h) })
+	return
+}
+
+// HasManyContext is like cs.HasMany(), but gives up, returning ctx.Err(), if |ctx| is done first.
+func HasManyContext(ctx context.Context, cs ChunkSource, hashes hash.HashSet) (absent hash.HashSet, err error) {
+	err = runContext(ctx, func() { absent = cs.HasMany(hashes) })
+	return
+}
+
+// PutContext is like cs.Put(), but stops waiting, returning ctx.Err(), if |ctx| is done first. The Chunk may still be written.
+func PutContext(ctx context.Context, cs ChunkSink, c Chunk) error {
+	return runContext(ctx, func() { cs.Put(c) })
+}
+
+// RootContext is like rt.Root(), but gives up, returning ctx.Err(), if |ctx| is done first.
+func RootContext(ctx context.Context, rt RootTracker) (root hash.Hash, err error) {
+	err = runContext(ctx, func() { root = rt.Root() })
+	return
+}
+
+// UpdateRootContext is like rt.UpdateRoot(), but stops waiting, returning ctx.Err(), if |ctx| is done first, in which case the root may or may not be updated: rt.Root() says which.
+func UpdateRootContext(ctx context.Context, rt RootTracker, current, last hash.Hash) (ok bool, err error) {
+	err = runContext(ctx, func() { ok = rt.UpdateRoot(current, last) })
+	return
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// hungStore is a MemoryStore whose Gets and Roots don't return until release is closed.
+type hungStore struct {
+	*MemoryStore
+	release chan struct{}
+}
+
+func (s hungStore) Get(h hash.Hash) Chunk {
+	<-s.release
+	return s.MemoryStore.Get(h)
+}
+
+func (s hungStore) Root() hash.Hash {
+	<-s.release
+	return s.MemoryStore.Root()
+}
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+	s := hungStore{NewMemoryStore(), make(chan struct{})}
+	c := NewChunk([]byte("abc"))
+	assert.NoError(PutContext(context.Background(), s, c))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := GetContext(ctx, s, c.Hash())
+	assert.Equal(context.DeadlineExceeded, err)
+	_, err = RootContext(ctx, s)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// Operations that don't hang aren't started once ctx is done.
+	has, err := HasContext(ctx, s, c.Hash())
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.False(has)
+	has, err = HasContext(context.Background(), s, c.Hash())
+	assert.NoError(err)
+	assert.True(has)
+
+	close(s.release)
+	got, err := GetContext(context.Background(), s, c.Hash())
+	assert.NoError(err)
+	assert.Equal(c.Hash(), got.Hash())
+	ok, err := UpdateRootContext(context.Background(), s, c.Hash(), hash.Hash{})
+	assert.NoError(err)
+	assert.True(ok)
+	root, err := RootContext(context.Background(), s)
+	assert.NoError(err)
+	assert.Equal(c.Hash(), root)
+
+	assert.Panics(func() {
+		runContext(context.Background(), func() { panic("oops") })
+	})
+}
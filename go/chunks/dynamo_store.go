@@ -133,6 +133,47 @@ func (s *DynamoStore) Has(h hash.Hash) bool {
 	return <-ch
 }
 
+// GetMany enqueues all of the requests at once, so that they're sent in as few BatchGetItem calls as possible.
+func (s *DynamoStore) GetMany(hashes hash.HashSlice) []Chunk {
+	found := make([]Chunk, len(hashes))
+	chans := make([]chan Chunk, len(hashes))
+	for i, h := range hashes {
+		if pending := s.unwrittenPuts.Get(h); !pending.IsEmpty() {
+			found[i] = pending
+			continue
+		}
+		chans[i] = make(chan Chunk, 1)
+		s.requestWg.Add(1)
+		s.readQueue <- GetRequest{h, chans[i]}
+	}
+	for i, ch := range chans {
+		if ch != nil {
+			found[i] = <-ch
+		}
+	}
+	return found
+}
+
+func (s *DynamoStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	chans := map[hash.Hash]chan bool{}
+	for h := range hashes {
+		if pending := s.unwrittenPuts.Get(h); !pending.IsEmpty() {
+			continue
+		}
+		ch := make(chan bool, 1)
+		chans[h] = ch
+		s.requestWg.Add(1)
+		s.readQueue <- HasRequest{h, ch}
+	}
+	absent = hash.HashSet{}
+	for h, ch := range chans {
+		if !<-ch {
+			absent.Insert(h)
+		}
+	}
+	return
+}
+
 func (s *DynamoStore) PutMany(chunks []Chunk) (e BackpressureError) {
 	for i, c := range chunks {
 		if s.unwrittenPuts.Has(c) {
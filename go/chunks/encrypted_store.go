@@ -0,0 +1,200 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+const (
+	encryptedChunkVersion = byte(1)
+	encryptedHeaderSize   = 1 + 4 // version, key id
+)
+
+// KeyProvider supplies the keys used by an EncryptedStore. Keys are identified by a uint32 id, which is stored alongside each encrypted chunk, so keys can be rotated without re-encrypting existing chunks: new chunks are encrypted with the current key, and old chunks are decrypted with whichever key they were encrypted with.
+// Keys must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key with which new chunks should be encrypted, and its id.
+	CurrentKey() (id uint32, key []byte)
+	// Key returns the key with the given id, or an error if it's unknown.
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider with a fixed set of keys. The key with the highest id is the current key.
+type StaticKeyProvider map[uint32][]byte
+
+// NewStaticKeyProvider returns a KeyProvider which always uses |key|, with id 0.
+func NewStaticKeyProvider(key []byte) StaticKeyProvider {
+	return StaticKeyProvider{0: key}
+}
+
+// ReadKeyFile returns a KeyProvider for the key in the file at |path|, which must be 16, 24 or 32 bytes long, either raw or hex encoded.
+func ReadKeyFile(path string) (KeyProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := data
+	if decoded, err := hex.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		key = decoded
+	}
+	if l := len(key); l != 16 && l != 24 && l != 32 {
+		return nil, fmt.Errorf("Key in %s must be 16, 24 or 32 bytes long, not %d", path, l)
+	}
+	return NewStaticKeyProvider(key), nil
+}
+
+func (kp StaticKeyProvider) CurrentKey() (id uint32, key []byte) {
+	d.PanicIfTrue(len(kp) == 0, "StaticKeyProvider has no keys")
+	first := true
+	for i, k := range kp {
+		if first || i > id {
+			id, key, first = i, k, false
+		}
+	}
+	return
+}
+
+func (kp StaticKeyProvider) Key(id uint32) ([]byte, error) {
+	if key, ok := kp[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown key id %d", id)
+}
+
+// EncryptedStore is a ChunkStore which encrypts chunk data with AES-GCM before writing it to another ChunkStore, and decrypts and authenticates it on the way back out.
+//
+// Chunks remain addressed by the hash of their plaintext, because that's what Refs inside other chunks point to; hashing ciphertext would break addressability. The chunk's hash is bound to its ciphertext as additional authenticated data, so data can't be moved between chunks in the inner store without detection.
+//
+// There's no mode that hashes ciphertext instead: the inner store is keyed by the plaintext hashes, so anyone who can read it sees the hash of every chunk, and can tell whether it holds a chunk whose contents they can guess. The root and the size of each chunk are visible too; only chunk data is hidden.
+type EncryptedStore struct {
+	inner       ChunkStore
+	keyProvider KeyProvider
+}
+
+// NewEncryptedStore returns a ChunkStore which stores chunks in |inner|, encrypted with keys from |keyProvider|. Closing it closes |inner|.
+func NewEncryptedStore(inner ChunkStore, keyProvider KeyProvider) *EncryptedStore {
+	return &EncryptedStore{inner, keyProvider}
+}
+
+func newAEAD(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	d.Chk.NoError(err)
+	aead, err := cipher.NewGCM(block)
+	d.Chk.NoError(err)
+	return aead
+}
+
+// EncryptChunk returns |c|'s data sealed with the current key of |kp| as version | key id | nonce | ciphertext, in a Chunk with c's hash. This is the encryption used by EncryptedStore.
+func EncryptChunk(c Chunk, kp KeyProvider) Chunk {
+	id, key := kp.CurrentKey()
+	aead := newAEAD(key)
+
+	data := make([]byte, encryptedHeaderSize+aead.NonceSize(), encryptedHeaderSize+aead.NonceSize()+len(c.Data())+aead.Overhead())
+	data[0] = encryptedChunkVersion
+	binary.BigEndian.PutUint32(data[1:], id)
+	nonce := data[encryptedHeaderSize:]
+	_, err := io.ReadFull(rand.Reader, nonce)
+	d.Chk.NoError(err)
+
+	digest := c.Hash().Digest()
+	return NewChunkWithHash(c.Hash(), aead.Seal(data, nonce, c.Data(), digest[:]))
+}
+
+// DecryptChunk returns the plaintext of |c|, which must have been returned by EncryptChunk() with a key known to |kp|. It panics if |c| can't be decrypted or fails authentication.
+func DecryptChunk(c Chunk, kp KeyProvider) Chunk {
+	data := c.Data()
+	d.PanicIfFalse(len(data) > encryptedHeaderSize && data[0] == encryptedChunkVersion, "Chunk %s is not encrypted", c.Hash())
+	key, err := kp.Key(binary.BigEndian.Uint32(data[1:]))
+	d.PanicIfError(err)
+	aead := newAEAD(key)
+
+	d.PanicIfFalse(len(data) >= encryptedHeaderSize+aead.NonceSize(), "Chunk %s is truncated", c.Hash())
+	nonce := data[encryptedHeaderSize : encryptedHeaderSize+aead.NonceSize()]
+	digest := c.Hash().Digest()
+	plaintext, err := aead.Open(nil, nonce, data[encryptedHeaderSize+aead.NonceSize():], digest[:])
+	d.PanicIfTrue(err != nil, "Unable to decrypt chunk %s", c.Hash())
+	return NewChunkWithHash(c.Hash(), plaintext)
+}
+
+func (es *EncryptedStore) encrypt(c Chunk) Chunk {
+	return EncryptChunk(c, es.keyProvider)
+}
+
+func (es *EncryptedStore) decrypt(c Chunk) Chunk {
+	return DecryptChunk(c, es.keyProvider)
+}
+
+func (es *EncryptedStore) Get(h hash.Hash) Chunk {
+	c := es.inner.Get(h)
+	if c.IsEmpty() {
+		return c
+	}
+	return es.decrypt(c)
+}
+
+func (es *EncryptedStore) Has(h hash.Hash) bool {
+	return es.inner.Has(h)
+}
+
+func (es *EncryptedStore) GetMany(hashes hash.HashSlice) []Chunk {
+	found := es.inner.GetMany(hashes)
+	for i, c := range found {
+		if !c.IsEmpty() {
+			found[i] = es.decrypt(c)
+		}
+	}
+	return found
+}
+
+func (es *EncryptedStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return es.inner.HasMany(hashes)
+}
+
+func (es *EncryptedStore) Version() string {
+	return es.inner.Version()
+}
+
+func (es *EncryptedStore) Put(c Chunk) {
+	es.inner.Put(es.encrypt(c))
+}
+
+func (es *EncryptedStore) PutMany(chunks []Chunk) BackpressureError {
+	encrypted := make([]Chunk, len(chunks))
+	for i, c := range chunks {
+		encrypted[i] = es.encrypt(c)
+	}
+	return es.inner.PutMany(encrypted)
+}
+
+func (es *EncryptedStore) Root() hash.Hash {
+	return es.inner.Root()
+}
+
+func (es *EncryptedStore) RootLog(n int) []RootLogEntry {
+	if rl, ok := es.inner.(RootLogger); ok {
+		return rl.RootLog(n)
+	}
+	return nil
+}
+
+func (es *EncryptedStore) UpdateRoot(current, last hash.Hash) bool {
+	return es.inner.UpdateRoot(current, last)
+}
+
+func (es *EncryptedStore) Close() error {
+	return es.inner.Close()
+}
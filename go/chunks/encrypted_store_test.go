@@ -0,0 +1,75 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func TestEncryptedStoreTestSuite(t *testing.T) {
+	suite.Run(t, &EncryptedStoreTestSuite{})
+}
+
+type EncryptedStoreTestSuite struct {
+	ChunkStoreTestSuite
+}
+
+func (suite *EncryptedStoreTestSuite) SetupTest() {
+	suite.Store = NewEncryptedStore(NewMemoryStore(), NewStaticKeyProvider(testKey))
+}
+
+func (suite *EncryptedStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+}
+
+func TestEncryptedStoreCiphertext(t *testing.T) {
+	assert := assert.New(t)
+	inner := NewMemoryStore()
+	store := NewEncryptedStore(inner, NewStaticKeyProvider(testKey))
+
+	c := NewChunk([]byte("secret secret secret"))
+	store.Put(c)
+	stored := inner.Get(c.Hash())
+	assert.False(bytes.Contains(stored.Data(), []byte("secret")))
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+
+	// Chunk data can't be swapped between hashes.
+	other := NewChunk([]byte("other"))
+	inner.Put(NewChunkWithHash(other.Hash(), stored.Data()))
+	assert.Panics(func() { store.Get(other.Hash()) })
+
+	// Nor read with the wrong key.
+	wrongKey := NewEncryptedStore(inner, NewStaticKeyProvider(bytes.Repeat([]byte{0x43}, 32)))
+	assert.Panics(func() { wrongKey.Get(c.Hash()) })
+}
+
+func TestEncryptedStoreKeyRotation(t *testing.T) {
+	assert := assert.New(t)
+	inner := NewMemoryStore()
+	keys := StaticKeyProvider{1: testKey}
+	store := NewEncryptedStore(inner, keys)
+
+	c1 := NewChunk([]byte("abc"))
+	store.Put(c1)
+
+	keys[2] = bytes.Repeat([]byte{0x43}, 16)
+	id, _ := keys.CurrentKey()
+	assert.Equal(uint32(2), id)
+	c2 := NewChunk([]byte("def"))
+	store.Put(c2)
+
+	assert.Equal(c1.Data(), store.Get(c1.Hash()).Data())
+	assert.Equal(c2.Data(), store.Get(c2.Hash()).Data())
+
+	delete(keys, 1)
+	assert.Panics(func() { store.Get(c1.Hash()) })
+	assert.Equal(c2.Data(), store.Get(c2.Hash()).Data())
+}
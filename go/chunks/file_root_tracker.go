@@ -0,0 +1,75 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+const lockFileRetryInterval = 10 * time.Millisecond
+
+// FileRootTracker is a RootTracker which keeps the root hash in a local file. UpdateRoot() is atomic with respect to other FileRootTrackers for the same path, including those in other processes: it takes an exclusive lock file next to the root file for the duration of the compare-and-set, and writes the new root by renaming a temp file into place.
+type FileRootTracker struct {
+	path string
+}
+
+// NewFileRootTracker returns a FileRootTracker which keeps its root in the file at |path|, creating the containing directory if necessary.
+func NewFileRootTracker(path string) *FileRootTracker {
+	d.PanicIfError(os.MkdirAll(filepath.Dir(path), 0777))
+	return &FileRootTracker{path}
+}
+
+func (f *FileRootTracker) Root() hash.Hash {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return hash.Hash{}
+	}
+	d.PanicIfError(err)
+	return hash.Parse(strings.TrimSpace(string(data)))
+}
+
+func (f *FileRootTracker) UpdateRoot(current, last hash.Hash) bool {
+	unlock := lockFile(f.path)
+	defer unlock()
+
+	if last != f.Root() {
+		return false
+	}
+
+	writeFileAtomically(f.path, []byte(current.String()))
+	return true
+}
+
+// writeFileAtomically replaces the contents of the file at |path| with |data|, by writing a temp file and renaming it into place.
+func writeFileAtomically(path string, data []byte) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	d.PanicIfError(err)
+	_, err = tmp.Write(data)
+	d.PanicIfError(err)
+	d.PanicIfError(tmp.Sync())
+	d.PanicIfError(tmp.Close())
+	d.PanicIfError(os.Rename(tmp.Name(), path))
+}
+
+// lockFile takes an exclusive lock on |path|, which is shared with other processes, by creating a lock file next to it. It blocks until the lock is available.
+func lockFile(path string) (unlock func()) {
+	lockPath := path + ".lock"
+	for {
+		lf, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if err == nil {
+			d.PanicIfError(lf.Close())
+			return func() { d.PanicIfError(os.Remove(lockPath)) }
+		}
+		d.PanicIfFalse(os.IsExist(err), "Unable to lock %s: %s", path, err)
+		time.Sleep(lockFileRetryInterval)
+	}
+}
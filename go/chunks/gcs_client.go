@@ -0,0 +1,186 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsMetadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcsClient is a minimal Google Cloud Storage client implementing objectSvc on top of the JSON API. Conditional writes use the ifGenerationMatch precondition, where generation 0 means the object must not exist.
+type gcsClient struct {
+	endpoint string
+	bucket   string
+	client   *http.Client
+	token    func() (string, error)
+}
+
+// newGCSClient returns a gcsClient for |bucket|. If STORAGE_EMULATOR_HOST is set, requests go to the emulator there, unauthenticated. Otherwise the OAuth2 access token is taken from GOOGLE_OAUTH_ACCESS_TOKEN, or failing that, from the metadata server of the GCE instance noms is running on.
+func newGCSClient(bucket string) *gcsClient {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		return &gcsClient{host, bucket, http.DefaultClient, nil}
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token != "" {
+		return &gcsClient{gcsDefaultEndpoint, bucket, http.DefaultClient, func() (string, error) { return token, nil }}
+	}
+	return &gcsClient{gcsDefaultEndpoint, bucket, http.DefaultClient, newGCEMetadataTokenSource(gcsMetadataToken)}
+}
+
+// newGCEMetadataTokenSource returns a func which fetches access tokens from the GCE metadata server at |tokenURL|, caching each one until shortly before it expires.
+func newGCEMetadataTokenSource(tokenURL string) func() (string, error) {
+	mu := sync.Mutex{}
+	token, expiry := "", time.Time{}
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expiry) {
+			return token, nil
+		}
+
+		req, err := http.NewRequest("GET", tokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("Unable to get a GCS access token from the metadata server; set GOOGLE_OAUTH_ACCESS_TOKEN when not running on GCE: %s", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("Unable to get a GCS access token from the metadata server: %s", res.Status)
+		}
+		body := struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return "", err
+		}
+		token, expiry = body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn)*time.Second-time.Minute)
+		return token, nil
+	}
+}
+
+// gcsEscape escapes an object name for use as a single path segment, as the JSON API requires, e.g. "/" becomes "%2F".
+func gcsEscape(name string) string {
+	return strings.Replace(url.QueryEscape(name), "+", "%20", -1)
+}
+
+func (g *gcsClient) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", g.endpoint, gcsEscape(g.bucket), gcsEscape(key))
+}
+
+func (g *gcsClient) do(method, u string, body []byte) (*http.Response, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.token != nil {
+		token, err := g.token()
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	return res, data, err
+}
+
+func (g *gcsClient) GetObject(key string) ([]byte, string, error) {
+	res, data, err := g.do("GET", g.objectURL(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return data, res.Header.Get("X-Goog-Generation"), nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	}
+	return nil, "", fmt.Errorf("GCS GET of %s/%s failed: %s", g.bucket, key, res.Status)
+}
+
+func (g *gcsClient) HeadObject(key string) (bool, error) {
+	res, _, err := g.do("GET", g.objectURL(key)+"?fields=generation", nil)
+	if err != nil {
+		return false, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("GCS metadata GET of %s/%s failed: %s", g.bucket, key, res.Status)
+}
+
+func (g *gcsClient) upload(key string, data []byte, precondition string) (*http.Response, error) {
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s%s", g.endpoint, gcsEscape(g.bucket), url.QueryEscape(key), precondition)
+	res, _, err := g.do("POST", u, data)
+	return res, err
+}
+
+func (g *gcsClient) PutObject(key string, data []byte) error {
+	res, err := g.upload(key, data, "")
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GCS upload of %s/%s failed: %s", g.bucket, key, res.Status)
+	}
+	return nil
+}
+
+func (g *gcsClient) PutObjectIfGeneration(key string, data []byte, generation string) (bool, error) {
+	if generation == "" {
+		generation = "0"
+	}
+	if _, err := strconv.ParseInt(generation, 10, 64); err != nil {
+		return false, fmt.Errorf("Invalid GCS generation %s for %s/%s", generation, g.bucket, key)
+	}
+	res, err := g.upload(key, data, "&ifGenerationMatch="+generation)
+	if err != nil {
+		return false, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusPreconditionFailed:
+		return false, nil
+	}
+	return false, fmt.Errorf("GCS conditional upload of %s/%s failed: %s", g.bucket, key, res.Status)
+}
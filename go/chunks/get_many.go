@@ -0,0 +1,82 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"sync"
+
+	"github.com/stormasm/noms/go/hash"
+)
+
+const getManyConcurrency = 32
+
+// getManySerially implements GetMany() for stores whose Gets are cheap, by calling |get| for each hash in turn.
+func getManySerially(get func(h hash.Hash) Chunk, hashes hash.HashSlice) []Chunk {
+	found := make([]Chunk, len(hashes))
+	for i, h := range hashes {
+		found[i] = get(h)
+	}
+	return found
+}
+
+// hasManySerially implements HasMany() for stores whose Has calls are cheap, by calling |has| for each hash in turn.
+func hasManySerially(has func(h hash.Hash) bool, hashes hash.HashSet) (absent hash.HashSet) {
+	absent = hash.HashSet{}
+	for h := range hashes {
+		if !has(h) {
+			absent.Insert(h)
+		}
+	}
+	return
+}
+
+// getManyConcurrently implements GetMany() for stores with high latency but plenty of throughput, by calling |get| from getManyConcurrency goroutines.
+func getManyConcurrently(get func(h hash.Hash) Chunk, hashes hash.HashSlice) []Chunk {
+	found := make([]Chunk, len(hashes))
+	runConcurrently(len(hashes), func(i int) {
+		found[i] = get(hashes[i])
+	})
+	return found
+}
+
+// hasManyConcurrently implements HasMany() for stores with high latency but plenty of throughput, by calling |has| from getManyConcurrency goroutines.
+func hasManyConcurrently(has func(h hash.Hash) bool, hashes hash.HashSet) (absent hash.HashSet) {
+	slice := make(hash.HashSlice, 0, len(hashes))
+	for h := range hashes {
+		slice = append(slice, h)
+	}
+	present := make([]bool, len(slice))
+	runConcurrently(len(slice), func(i int) {
+		present[i] = has(slice[i])
+	})
+
+	absent = hash.HashSet{}
+	for i, h := range slice {
+		if !present[i] {
+			absent.Insert(h)
+		}
+	}
+	return
+}
+
+// runConcurrently calls |f| with each integer in [0, n), from up to getManyConcurrency goroutines.
+func runConcurrently(n int, f func(i int)) {
+	work := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < getManyConcurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const recompressBatchSize = 1 << 24 // 16MiB
+
+// RecompressLevelDBStore copies every store in the LevelDB in |srcDir| into a new LevelDB in |dstDir|, re-encoding all chunk data with |codec|. Roots and versions are copied unchanged. The source is only read, so an interrupted migration can simply be restarted with an empty |dstDir|. Returns the number of chunks copied.
+func RecompressLevelDBStore(srcDir, dstDir string, maxFileHandles int, codec Codec) (count int) {
+	src := newBackingStore(srcDir, LevelDBOptions{MaxOpenFiles: maxFileHandles}, false, DefaultCodec, false)
+	defer src.Close()
+	dst := newBackingStore(dstDir, LevelDBOptions{MaxOpenFiles: maxFileHandles}, false, codec, false)
+	defer dst.Close()
+	d.PanicIfFalse(dst.codec == codec, "%s already contains a store compressed with %s", dstDir, dst.codec)
+
+	b := new(leveldb.Batch)
+	numBytes := 0
+	flush := func() {
+		dst.putBatch(b, numBytes)
+		b.Reset()
+		numBytes = 0
+	}
+
+	iter := src.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, val := iter.Key(), iter.Value()
+		if bytes.Equal(key, []byte(codecKeyConst)) {
+			continue
+		}
+		if isChunkKey(key) {
+			data, err := src.codec.Decode(val)
+			d.Chk.NoError(err)
+			val = dst.codec.Encode(data)
+			count++
+		}
+		b.Put(key, val)
+		numBytes += len(val)
+		if numBytes >= recompressBatchSize {
+			flush()
+		}
+	}
+	d.Chk.NoError(iter.Error())
+	flush()
+	return
+}
+
+// isChunkKey returns true if |key| is of the form namespace + chunkPrefixConst + digest.
+func isChunkKey(key []byte) bool {
+	prefixEnd := len(key) - hash.ByteLen
+	return prefixEnd >= len(chunkPrefixConst) && bytes.Equal(key[prefixEnd-len(chunkPrefixConst):prefixEnd], []byte(chunkPrefixConst))
+}
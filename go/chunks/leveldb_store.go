@@ -5,36 +5,78 @@
 package chunks
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/stormasm/noms/go/constants"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
 	humanize "github.com/dustin/go-humanize"
-	"github.com/golang/snappy"
 	flag "github.com/juju/gnuflag"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
 	rootKeyConst     = "/root"
+	rootLogPrefix    = "/rootlog/"
 	versionKeyConst  = "/vers"
 	chunkPrefixConst = "/chunk/"
+
+	// codecKeyConst isn't namespaced: all the stores sharing a LevelDB use the same Codec.
+	codecKeyConst = "/codec"
+
+	// A shared LevelDB is closed once it's been idle for sharedLevelDBIdleTimeout, or as soon as it's idle once it's been open for sharedLevelDBMaxHold, so that other processes get a turn. Opening one gives up after sharedLevelDBLockTimeout.
+	sharedLevelDBIdleTimeout = 100 * time.Millisecond
+	sharedLevelDBMaxHold     = time.Second
+	sharedLevelDBLockTimeout = time.Minute
+
+	// rootLogLength is the number of roots a LevelDBStore keeps in its root log.
+	rootLogLength = 1 << 10
 )
 
+// LevelDBOptions tunes the LevelDB underlying a LevelDBStore. Zero fields get defaults, which suit databases of up to a few hundred megabytes; larger ones read and write much faster with a bigger block cache and write buffer.
+type LevelDBOptions struct {
+	// MaxOpenFiles is the number of table files kept open, which also limits the number of concurrent reads. Defaults to --ldb-max-file-handles.
+	MaxOpenFiles int
+	// BlockCacheSize is the number of bytes of table blocks cached in memory. Defaults to 8MiB.
+	BlockCacheSize int
+	// WriteBuffer is the number of bytes of writes buffered in memory before they're written out as a table file. Defaults to 16MiB.
+	WriteBuffer int
+	// BloomBits is the number of bits per key in the bloom filter kept for each table file, or a negative number to keep none. Defaults to 10.
+	BloomBits int
+}
+
+func (opts LevelDBOptions) withDefaults() LevelDBOptions {
+	if opts.MaxOpenFiles == 0 {
+		opts.MaxOpenFiles = ldbFlags.maxFileHandles
+	}
+	if opts.WriteBuffer == 0 {
+		opts.WriteBuffer = 1 << 24 // 16MiB
+	}
+	if opts.BloomBits == 0 {
+		opts.BloomBits = 10
+	}
+	return opts
+}
+
 type LevelDBStoreFlags struct {
 	maxFileHandles int
 	dumpStats      bool
+	codec          string
+	shared         bool
 }
 
 var (
-	ldbFlags        = LevelDBStoreFlags{24, false}
+	ldbFlags        = LevelDBStoreFlags{24, false, string(DefaultCodec), false}
 	flagsRegistered = false
 )
 
@@ -43,15 +85,45 @@ func RegisterLevelDBFlags(flags *flag.FlagSet) {
 		flagsRegistered = true
 		flags.IntVar(&ldbFlags.maxFileHandles, "ldb-max-file-handles", 24, "max number of open file handles")
 		flags.BoolVar(&ldbFlags.dumpStats, "ldb-dump-stats", false, "print get/has/put counts on close")
+		flags.StringVar(&ldbFlags.codec, "ldb-codec", string(DefaultCodec), "compression codec for newly created ldb and badger stores: none, snappy, flate or zstd. Existing stores keep the codec they were created with")
+		flags.BoolVar(&ldbFlags.shared, "ldb-shared", false, "only hold the LevelDB open while it's in use, so other processes can open it too")
 	}
 }
 
 func NewLevelDBStoreUseFlags(dir, ns string) *LevelDBStore {
-	return newLevelDBStore(newBackingStore(dir, ldbFlags.maxFileHandles, ldbFlags.dumpStats), []byte(ns), true)
+	return NewLevelDBStoreWithOptionsUseFlags(dir, ns, LevelDBOptions{})
+}
+
+// NewLevelDBStoreWithOptionsUseFlags is like NewLevelDBStoreUseFlags(), but tunes the LevelDB with |opts|. If the LevelDB is already open in this process, e.g. via a LevelDBStoreFactory, the options it was opened with apply instead.
+func NewLevelDBStoreWithOptionsUseFlags(dir, ns string, opts LevelDBOptions) *LevelDBStore {
+	return newLevelDBStore(newBackingStore(dir, opts, ldbFlags.dumpStats, codecFromFlags(), ldbFlags.shared), []byte(ns), true)
 }
 
 func NewLevelDBStore(dir, ns string, maxFileHandles int, dumpStats bool) *LevelDBStore {
-	return newLevelDBStore(newBackingStore(dir, maxFileHandles, dumpStats), []byte(ns), true)
+	return newLevelDBStore(newBackingStore(dir, LevelDBOptions{MaxOpenFiles: maxFileHandles}, dumpStats, DefaultCodec, false), []byte(ns), true)
+}
+
+// NewSharedLevelDBStore returns a LevelDBStore which can be used concurrently with LevelDBStores for the same |dir| in other processes, e.g. by a long-running writer and the noms CLI.
+//
+// LevelDB only allows one process at a time to open a database, so a shared LevelDBStore only holds its LevelDB open while it's in use, and waits its turn when another process has it open. The root is only read and compared-and-set while holding the LevelDB open, so UpdateRoot() is atomic across processes. Datasets are committed with an optimistic retry loop, so writers in different processes don't clobber each other's commits.
+func NewSharedLevelDBStore(dir, ns string, maxFileHandles int) *LevelDBStore {
+	return newLevelDBStore(newBackingStore(dir, LevelDBOptions{MaxOpenFiles: maxFileHandles}, false, DefaultCodec, true), []byte(ns), true)
+}
+
+// NewReadOnlyLevelDBStore returns a LevelDBStore for the existing LevelDB in |dir| which can only be read. It's shared, like a store returned by NewSharedLevelDBStore(), so it only holds the LevelDB's lock while reading from it, and never keeps a writer that's also using a shared store waiting for long. Writing to it panics.
+func NewReadOnlyLevelDBStore(dir, ns string, maxFileHandles int) *LevelDBStore {
+	return newLevelDBStore(newReadOnlyBackingStore(dir, LevelDBOptions{MaxOpenFiles: maxFileHandles}), []byte(ns), true)
+}
+
+// NewReadOnlyLevelDBStoreUseFlags is like NewReadOnlyLevelDBStore(), but tunes the LevelDB with |opts|, and defaults the number of open files to --ldb-max-file-handles.
+func NewReadOnlyLevelDBStoreUseFlags(dir, ns string, opts LevelDBOptions) *LevelDBStore {
+	return newLevelDBStore(newReadOnlyBackingStore(dir, opts), []byte(ns), true)
+}
+
+func codecFromFlags() Codec {
+	codec, err := ParseCodec(ldbFlags.codec)
+	d.PanicIfError(err)
+	return codec
 }
 
 func newLevelDBStore(store *internalLevelDBStore, ns []byte, closeBackingStore bool) *LevelDBStore {
@@ -63,6 +135,7 @@ func newLevelDBStore(store *internalLevelDBStore, ns []byte, closeBackingStore b
 	return &LevelDBStore{
 		internalLevelDBStore: store,
 		rootKey:              copyNsAndAppend(rootKeyConst),
+		rootLogPrefix:        copyNsAndAppend(rootLogPrefix),
 		versionKey:           copyNsAndAppend(versionKeyConst),
 		chunkPrefix:          copyNsAndAppend(chunkPrefixConst),
 		closeBackingStore:    closeBackingStore,
@@ -72,6 +145,7 @@ func newLevelDBStore(store *internalLevelDBStore, ns []byte, closeBackingStore b
 type LevelDBStore struct {
 	*internalLevelDBStore
 	rootKey           []byte
+	rootLogPrefix     []byte
 	versionKey        []byte
 	chunkPrefix       []byte
 	closeBackingStore bool
@@ -85,8 +159,28 @@ func (l *LevelDBStore) Root() hash.Hash {
 
 func (l *LevelDBStore) UpdateRoot(current, last hash.Hash) bool {
 	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	d.PanicIfTrue(l.readOnly, "Cannot write to a read-only LevelDBStore.")
 	l.versionSetOnce.Do(l.setVersIfUnset)
-	return l.updateRootByKey(l.rootKey, current, last)
+	return l.updateRootByKey(l.rootKey, l.rootLogPrefix, current, last)
+}
+
+// RootLog returns up to |n| of the most recent roots of l, which keeps the last 1024 of them.
+func (l *LevelDBStore) RootLog(n int) []RootLogEntry {
+	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	db := l.acquire()
+	defer l.release()
+	iter := db.NewIterator(util.BytesPrefix(l.rootLogPrefix), nil)
+	defer iter.Release()
+	entries := []RootLogEntry{}
+	for ok := iter.Last(); ok && len(entries) < n; ok = iter.Prev() {
+		var root string
+		var nanos int64
+		_, err := fmt.Sscanf(string(iter.Value()), "%s %d", &root, &nanos)
+		d.Chk.NoError(err)
+		entries = append(entries, RootLogEntry{hash.Parse(root), time.Unix(0, nanos)})
+	}
+	d.Chk.NoError(iter.Error())
+	return entries
 }
 
 func (l *LevelDBStore) Get(ref hash.Hash) Chunk {
@@ -99,6 +193,21 @@ func (l *LevelDBStore) Has(ref hash.Hash) bool {
 	return l.hasByKey(l.toChunkKey(ref))
 }
 
+// GetMany holds l's LevelDB open for the duration, so a shared LevelDBStore doesn't reopen it for each chunk.
+func (l *LevelDBStore) GetMany(hashes hash.HashSlice) []Chunk {
+	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	l.acquire()
+	defer l.release()
+	return getManySerially(l.Get, hashes)
+}
+
+func (l *LevelDBStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	l.acquire()
+	defer l.release()
+	return hasManySerially(l.Has, hashes)
+}
+
 func (l *LevelDBStore) Version() string {
 	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
 	return l.versByKey(l.versionKey)
@@ -106,17 +215,19 @@ func (l *LevelDBStore) Version() string {
 
 func (l *LevelDBStore) Put(c Chunk) {
 	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	d.PanicIfTrue(l.readOnly, "Cannot write to a read-only LevelDBStore.")
 	l.versionSetOnce.Do(l.setVersIfUnset)
 	l.putByKey(l.toChunkKey(c.Hash()), c)
 }
 
 func (l *LevelDBStore) PutMany(chunks []Chunk) (e BackpressureError) {
 	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	d.PanicIfTrue(l.readOnly, "Cannot write to a read-only LevelDBStore.")
 	l.versionSetOnce.Do(l.setVersIfUnset)
 	numBytes := 0
 	b := new(leveldb.Batch)
 	for _, c := range chunks {
-		data := snappy.Encode(nil, c.Data())
+		data := l.codec.Encode(c.Data())
 		numBytes += len(data)
 		b.Put(l.toChunkKey(c.Hash()), data)
 	}
@@ -124,6 +235,27 @@ func (l *LevelDBStore) PutMany(chunks []Chunk) (e BackpressureError) {
 	return
 }
 
+func (l *LevelDBStore) IterAll(cb func(c Chunk)) {
+	d.PanicIfFalse(l.internalLevelDBStore != nil, "Cannot use LevelDBStore after Close().")
+	db := l.acquire()
+	defer l.release()
+	iter := db.NewIterator(util.BytesPrefix(l.chunkPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		h := hash.Hash{}
+		if len(key) == len(l.chunkPrefix)+hash.ByteLen {
+			h = hash.FromSlice(key[len(l.chunkPrefix):])
+		}
+		data, err := l.codec.Decode(iter.Value())
+		if err != nil {
+			data = nil
+		}
+		cb(NewChunkWithHash(h, data))
+	}
+	d.Chk.NoError(iter.Error())
+}
+
 func (l *LevelDBStore) Close() error {
 	if l.closeBackingStore {
 		l.internalLevelDBStore.Close()
@@ -140,38 +272,221 @@ func (l *LevelDBStore) toChunkKey(r hash.Hash) []byte {
 }
 
 func (l *LevelDBStore) setVersIfUnset() {
-	exists, err := l.db.Has(l.versionKey, nil)
+	db := l.acquire()
+	defer l.release()
+	exists, err := db.Has(l.versionKey, nil)
 	d.Chk.NoError(err)
 	if !exists {
 		l.setVersByKey(l.versionKey)
 	}
 }
 
+// Codec returns the compression codec used for chunk data in l.
+func (l *LevelDBStore) Codec() Codec {
+	return l.codec
+}
+
 type internalLevelDBStore struct {
 	db                                     *rateLimitedLevelDB
+	codec                                  Codec
 	mu                                     sync.Mutex
 	getCount, hasCount, putCount, putBytes int64
 	dumpStats                              bool
-}
 
-func newBackingStore(dir string, maxFileHandles int, dumpStats bool) *internalLevelDBStore {
+	// The rest is only used by shared stores, whose db is nil while it's closed.
+	dir       string
+	opts      LevelDBOptions
+	shared    bool
+	readOnly  bool
+	dbMu      sync.Mutex
+	dbUsers   int
+	dbOpening chan struct{}
+	dbOpened  time.Time
+	dbClosed  time.Time
+	idleTimer *time.Timer
+}
+
+// newBackingStore opens the LevelDB in |dir|. Chunk data is compressed with the Codec recorded in the LevelDB, or with |codec| if the LevelDB is new. If |shared| is true, the LevelDB is closed whenever it's not in use; see NewSharedLevelDBStore().
+func newBackingStore(dir string, opts LevelDBOptions, dumpStats bool, codec Codec, shared bool) *internalLevelDBStore {
 	d.PanicIfTrue(dir == "", "dir cannot be empty")
 	d.PanicIfError(os.MkdirAll(dir, 0700))
-	db, err := leveldb.OpenFile(dir, &opt.Options{
+	l := &internalLevelDBStore{
+		dumpStats: dumpStats,
+		dir:       dir,
+		opts:      opts.withDefaults(),
+		shared:    shared,
+	}
+	if !shared {
+		db, err := openLevelDB(dir, l.opts, false)
+		d.Chk.NoError(err, "opening internalLevelDBStore in %s", dir)
+		l.db = &rateLimitedLevelDB{db, make(chan struct{}, l.opts.MaxOpenFiles)}
+	}
+	db := l.acquire()
+	defer l.release()
+	l.codec = negotiateCodec(db.DB, codec)
+	return l
+}
+
+// newReadOnlyBackingStore opens the existing LevelDB in |dir| as a shared store that can only be read; see NewReadOnlyLevelDBStore().
+func newReadOnlyBackingStore(dir string, opts LevelDBOptions) *internalLevelDBStore {
+	// A shared store retries opening until sharedLevelDBLockTimeout, so fail fast if there's nothing to open.
+	_, err := os.Stat(filepath.Join(dir, "CURRENT"))
+	d.PanicIfTrue(os.IsNotExist(err), "No LevelDB in %s", dir)
+	d.PanicIfError(err)
+	l := &internalLevelDBStore{
+		dir:      dir,
+		opts:     opts.withDefaults(),
+		shared:   true,
+		readOnly: true,
+	}
+	db := l.acquire()
+	defer l.release()
+	// LevelDBs that were written before the Codec was recorded use snappy, and the Codec of an empty one doesn't matter.
+	l.codec = SnappyCodec
+	if codec, ok := recordedCodec(db.DB); ok {
+		l.codec = codec
+	}
+	return l
+}
+
+// openLevelDB opens the LevelDB in |dir|, tuned with |opts|, which must have had defaults applied.
+func openLevelDB(dir string, opts LevelDBOptions, readOnly bool) (*leveldb.DB, error) {
+	var bloom filter.Filter
+	if opts.BloomBits > 0 {
+		bloom = filter.NewBloomFilter(opts.BloomBits)
+	}
+	return leveldb.OpenFile(dir, &opt.Options{
+		ReadOnly:               readOnly,
 		Compression:            opt.NoCompression,
-		Filter:                 filter.NewBloomFilter(10), // 10 bits/key
-		OpenFilesCacheCapacity: maxFileHandles,
-		WriteBuffer:            1 << 24, // 16MiB,
+		Filter:                 bloom,
+		BlockCacheCapacity:     opts.BlockCacheSize,
+		OpenFilesCacheCapacity: opts.MaxOpenFiles,
+		WriteBuffer:            opts.WriteBuffer,
 	})
-	d.Chk.NoError(err, "opening internalLevelDBStore in %s", dir)
-	return &internalLevelDBStore{
-		db:        &rateLimitedLevelDB{db, make(chan struct{}, maxFileHandles)},
-		dumpStats: dumpStats,
+}
+
+// acquire returns l's LevelDB. If l is shared, the LevelDB is opened first if necessary, waiting for any other process that has it open to close it, and it's kept open until every call to acquire() has been matched by a call to release().
+func (l *internalLevelDBStore) acquire() *rateLimitedLevelDB {
+	if !l.shared {
+		return l.db
+	}
+	l.dbMu.Lock()
+	defer l.dbMu.Unlock()
+	for l.db == nil {
+		// Opening can take as long as sharedLevelDBLockTimeout, so it's done without holding dbMu, by one goroutine while the others wait for it.
+		if opening := l.dbOpening; opening != nil {
+			l.dbMu.Unlock()
+			<-opening
+			l.dbMu.Lock()
+			continue
+		}
+		l.dbOpening = make(chan struct{})
+		closed := l.dbClosed
+		l.dbMu.Unlock()
+		db, err := l.openShared(closed)
+		l.dbMu.Lock()
+		close(l.dbOpening)
+		l.dbOpening = nil
+		d.Chk.True(err == nil, "Timed out opening shared LevelDB in %s: %s", l.dir, err)
+		l.db = db
+		l.dbOpened = time.Now()
+	}
+	if l.idleTimer != nil {
+		l.idleTimer.Stop()
+		l.idleTimer = nil
+	}
+	l.dbUsers++
+	return l.db
+}
+
+// openShared opens l's LevelDB, which was last closed at |closed|, retrying until sharedLevelDBLockTimeout while another process has it open.
+func (l *internalLevelDBStore) openShared(closed time.Time) (*rateLimitedLevelDB, error) {
+	// Give other processes that are waiting for the LevelDB a chance to grab it before reopening it.
+	if wait := lockFileRetryInterval - time.Since(closed); wait > 0 {
+		time.Sleep(wait)
+	}
+	deadline := time.Now().Add(sharedLevelDBLockTimeout)
+	for {
+		db, err := openLevelDB(l.dir, l.opts, l.readOnly)
+		if err == nil {
+			return &rateLimitedLevelDB{db, make(chan struct{}, l.opts.MaxOpenFiles)}, nil
+		}
+		// LevelDB doesn't distinguish a database that's locked by another process from other failures, so keep trying until the deadline.
+		if !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockFileRetryInterval)
 	}
 }
 
+// release undoes a call to acquire(). Once a shared LevelDB is no longer in use, it's closed after sharedLevelDBIdleTimeout, or immediately if it's been open for longer than sharedLevelDBMaxHold.
+func (l *internalLevelDBStore) release() {
+	if !l.shared {
+		return
+	}
+	l.dbMu.Lock()
+	defer l.dbMu.Unlock()
+	l.dbUsers--
+	if l.dbUsers > 0 {
+		return
+	}
+	if time.Since(l.dbOpened) >= sharedLevelDBMaxHold {
+		l.closeDB()
+		return
+	}
+	l.idleTimer = time.AfterFunc(sharedLevelDBIdleTimeout, func() {
+		l.dbMu.Lock()
+		defer l.dbMu.Unlock()
+		if l.dbUsers == 0 {
+			l.closeDB()
+		}
+	})
+}
+
+// closeDB closes l's LevelDB, if it's open. Callers must hold l.dbMu, unless l isn't shared.
+func (l *internalLevelDBStore) closeDB() {
+	if l.db != nil {
+		l.db.Close()
+		l.db = nil
+		l.dbClosed = time.Now()
+	}
+}
+
+// negotiateCodec returns the Codec recorded in |db|. If there isn't one, |db| is either new, in which case |preferred| is recorded and returned, or it was written before codecs were configurable, in which case its data is snappy-compressed.
+func negotiateCodec(db *leveldb.DB, preferred Codec) Codec {
+	if codec, ok := recordedCodec(db); ok {
+		return codec
+	}
+
+	iter := db.NewIterator(nil, nil)
+	empty := !iter.First()
+	iter.Release()
+	d.Chk.NoError(iter.Error())
+
+	codec := SnappyCodec
+	if empty {
+		codec = preferred
+	}
+	d.Chk.NoError(db.Put([]byte(codecKeyConst), []byte(codec), &opt.WriteOptions{Sync: true}))
+	return codec
+}
+
+// recordedCodec returns the Codec recorded in |db|, or false if there isn't one.
+func recordedCodec(db *leveldb.DB) (Codec, bool) {
+	val, err := db.Get([]byte(codecKeyConst), nil)
+	if err == nil {
+		codec, err := ParseCodec(string(val))
+		d.Chk.NoError(err)
+		return codec, true
+	}
+	d.PanicIfFalse(err == errors.ErrNotFound, "Unable to read codec: %s", err)
+	return "", false
+}
+
 func (l *internalLevelDBStore) rootByKey(key []byte) hash.Hash {
-	val, err := l.db.Get(key, nil)
+	db := l.acquire()
+	defer l.release()
+	val, err := db.Get(key, nil)
 	if err == errors.ErrNotFound {
 		return hash.Hash{}
 	}
@@ -180,40 +495,69 @@ func (l *internalLevelDBStore) rootByKey(key []byte) hash.Hash {
 	return hash.Parse(string(val))
 }
 
-func (l *internalLevelDBStore) updateRootByKey(key []byte, current, last hash.Hash) bool {
+// updateRootByKey sets the root at |key| to |current| if it's |last|, and logs the new root in the root log at |logPrefix|, dropping the oldest entry once it's rootLogLength long. Log entries are keyed by big-endian sequence numbers, so that they're in order.
+func (l *internalLevelDBStore) updateRootByKey(key, logPrefix []byte, current, last hash.Hash) bool {
+	// Holding the LevelDB open excludes other processes for the duration of the compare-and-set.
+	db := l.acquire()
+	defer l.release()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if last != l.rootByKey(key) {
 		return false
 	}
 
+	seq := uint64(0)
+	iter := db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	if iter.Last() {
+		seq = binary.BigEndian.Uint64(iter.Key()[len(logPrefix):]) + 1
+	}
+	iter.Release()
+	d.Chk.NoError(iter.Error())
+	logKey := func(seq uint64) []byte {
+		k := make([]byte, len(logPrefix)+8)
+		binary.BigEndian.PutUint64(k[copy(k, logPrefix):], seq)
+		return k
+	}
+
+	b := new(leveldb.Batch)
+	b.Put(key, []byte(current.String()))
+	b.Put(logKey(seq), []byte(fmt.Sprintf("%s %d", current, time.Now().UnixNano())))
+	if seq >= rootLogLength {
+		b.Delete(logKey(seq - rootLogLength))
+	}
 	// Sync: true write option should fsync memtable data to disk
-	err := l.db.Put(key, []byte(current.String()), &opt.WriteOptions{Sync: true})
+	err := db.Write(b, &opt.WriteOptions{Sync: true})
 	d.Chk.NoError(err)
 	return true
 }
 
 func (l *internalLevelDBStore) getByKey(key []byte, ref hash.Hash) Chunk {
-	compressed, err := l.db.Get(key, nil)
+	db := l.acquire()
+	defer l.release()
+	compressed, err := db.Get(key, nil)
 	l.getCount++
 	if err == errors.ErrNotFound {
 		return EmptyChunk
 	}
 	d.Chk.NoError(err)
-	data, err := snappy.Decode(nil, compressed)
+	data, err := l.codec.Decode(compressed)
 	d.Chk.NoError(err)
 	return NewChunkWithHash(ref, data)
 }
 
 func (l *internalLevelDBStore) hasByKey(key []byte) bool {
-	exists, err := l.db.Has(key, &opt.ReadOptions{DontFillCache: true}) // This isn't really a "read", so don't signal the cache to treat it as one.
+	db := l.acquire()
+	defer l.release()
+	exists, err := db.Has(key, &opt.ReadOptions{DontFillCache: true}) // This isn't really a "read", so don't signal the cache to treat it as one.
 	d.Chk.NoError(err)
 	l.hasCount++
 	return exists
 }
 
 func (l *internalLevelDBStore) versByKey(key []byte) string {
-	val, err := l.db.Get(key, nil)
+	db := l.acquire()
+	defer l.release()
+	val, err := db.Get(key, nil)
 	if err == errors.ErrNotFound {
 		return constants.NomsVersion
 	}
@@ -222,27 +566,38 @@ func (l *internalLevelDBStore) versByKey(key []byte) string {
 }
 
 func (l *internalLevelDBStore) setVersByKey(key []byte) {
-	err := l.db.Put(key, []byte(constants.NomsVersion), nil)
+	db := l.acquire()
+	defer l.release()
+	err := db.Put(key, []byte(constants.NomsVersion), nil)
 	d.Chk.NoError(err)
 }
 
 func (l *internalLevelDBStore) putByKey(key []byte, c Chunk) {
-	data := snappy.Encode(nil, c.Data())
-	err := l.db.Put(key, data, nil)
+	data := l.codec.Encode(c.Data())
+	db := l.acquire()
+	defer l.release()
+	err := db.Put(key, data, nil)
 	d.Chk.NoError(err)
 	l.putCount++
 	l.putBytes += int64(len(data))
 }
 
 func (l *internalLevelDBStore) putBatch(b *leveldb.Batch, numBytes int) {
-	err := l.db.Write(b, nil)
+	db := l.acquire()
+	defer l.release()
+	err := db.Write(b, nil)
 	d.Chk.NoError(err)
 	l.putCount += int64(b.Len())
 	l.putBytes += int64(numBytes)
 }
 
 func (l *internalLevelDBStore) Close() error {
-	l.db.Close()
+	l.dbMu.Lock()
+	if l.idleTimer != nil {
+		l.idleTimer.Stop()
+	}
+	l.closeDB()
+	l.dbMu.Unlock()
 	if l.dumpStats {
 		fmt.Println("--LevelDB Stats--")
 		fmt.Println("GetCount: ", l.getCount)
@@ -254,11 +609,11 @@ func (l *internalLevelDBStore) Close() error {
 }
 
 func NewLevelDBStoreFactory(dir string, maxHandles int, dumpStats bool) Factory {
-	return &LevelDBStoreFactory{dir, maxHandles, dumpStats, newBackingStore(dir, maxHandles, dumpStats)}
+	return &LevelDBStoreFactory{dir, maxHandles, dumpStats, newBackingStore(dir, LevelDBOptions{MaxOpenFiles: maxHandles}, dumpStats, DefaultCodec, false)}
 }
 
 func NewLevelDBStoreFactoryUseFlags(dir string) Factory {
-	return NewLevelDBStoreFactory(dir, ldbFlags.maxFileHandles, ldbFlags.dumpStats)
+	return &LevelDBStoreFactory{dir, ldbFlags.maxFileHandles, ldbFlags.dumpStats, newBackingStore(dir, LevelDBOptions{}, ldbFlags.dumpStats, codecFromFlags(), ldbFlags.shared)}
 }
 
 type LevelDBStoreFactory struct {
@@ -6,11 +6,18 @@ package chunks
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/attic-labs/testify/assert"
 	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/hash"
 )
 
 func TestLevelDBStoreTestSuite(t *testing.T) {
@@ -56,3 +63,282 @@ func (suite *LevelDBStoreTestSuite) TestReservedKeys() {
 	suite.True(bytes.HasSuffix(ldb.versionKey, []byte(versionKeyConst)))
 	suite.True(bytes.HasSuffix(ldb.chunkPrefix, []byte(chunkPrefixConst)))
 }
+
+func (suite *LevelDBStoreTestSuite) TestRootLog() {
+	store := suite.Store.(*LevelDBStore)
+	suite.Empty(store.RootLog(10))
+
+	before := time.Now()
+	roots := []hash.Hash{}
+	last := hash.Hash{}
+	for i := 0; i < 3; i++ {
+		root := hash.FromData([]byte(fmt.Sprintf("root %d", i)))
+		suite.True(store.UpdateRoot(root, last))
+		roots, last = append(roots, root), root
+	}
+	suite.False(store.UpdateRoot(hash.FromData([]byte("not logged")), hash.Hash{}))
+
+	log := store.RootLog(2)
+	suite.Len(log, 2)
+	suite.Equal(roots[2], log[0].Root)
+	suite.Equal(roots[1], log[1].Root)
+	suite.False(log[1].Time.Before(before.Truncate(time.Nanosecond)))
+	suite.False(log[0].Time.Before(log[1].Time))
+	suite.Len(store.RootLog(10), 3)
+}
+
+func TestLevelDBStoreRootLogLength(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	store := NewLevelDBStore(dir, "", 24, false)
+	defer store.Close()
+
+	last := hash.Hash{}
+	for i := 0; i < rootLogLength+5; i++ {
+		root := hash.FromData([]byte(fmt.Sprintf("root %d", i)))
+		assert.True(store.UpdateRoot(root, last))
+		last = root
+	}
+	log := store.RootLog(2 * rootLogLength)
+	assert.Len(log, rootLogLength)
+	assert.Equal(last, log[0].Root)
+	assert.Equal(hash.FromData([]byte("root 5")), log[rootLogLength-1].Root)
+}
+
+func TestLevelDBStoreCodec(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// A new store uses the codec it's asked to, and keeps using it when reopened.
+	c := NewChunk(bytes.Repeat([]byte("abc"), 100))
+	store := newLevelDBStore(newBackingStore(dir, LevelDBOptions{MaxOpenFiles: 24}, false, FlateCodec, false), []byte("ns"), true)
+	assert.Equal(FlateCodec, store.Codec())
+	store.Put(c)
+	store.Close()
+
+	store = NewLevelDBStore(dir, "ns", 24, false)
+	assert.Equal(FlateCodec, store.Codec())
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	store.Close()
+}
+
+func TestLevelDBStoreOptions(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLevelDBStoreWithOptionsUseFlags(dir, "", LevelDBOptions{BlockCacheSize: 1 << 20, WriteBuffer: 1 << 10, BloomBits: -1})
+	assert.Equal(LevelDBOptions{MaxOpenFiles: ldbFlags.maxFileHandles, BlockCacheSize: 1 << 20, WriteBuffer: 1 << 10, BloomBits: -1}, store.opts)
+	chunks := []Chunk{}
+	for i := 0; i < 100; i++ {
+		chunks = append(chunks, NewChunk(bytes.Repeat([]byte{byte(i)}, 100)))
+	}
+	store.PutMany(chunks)
+	store.Close()
+
+	store = NewLevelDBStore(dir, "", 24, false)
+	defer store.Close()
+	assert.Equal(10, store.opts.BloomBits)
+	for _, c := range chunks {
+		assert.True(store.Has(c.Hash()))
+	}
+}
+
+func TestLevelDBStoreLegacyCodec(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Simulate a store written before the codec was recorded.
+	c := NewChunk([]byte("abc"))
+	store := NewLevelDBStore(dir, "", 24, false)
+	store.Put(c)
+	assert.NoError(store.db.Delete([]byte(codecKeyConst), nil))
+	store.Close()
+
+	store = newLevelDBStore(newBackingStore(dir, LevelDBOptions{MaxOpenFiles: 24}, false, FlateCodec, false), nil, true)
+	assert.Equal(SnappyCodec, store.Codec())
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	store.Close()
+}
+
+func TestRecompressLevelDBStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	srcDir, dstDir := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	factory := NewLevelDBStoreFactory(srcDir, 24, false)
+	chunks := map[string][]Chunk{}
+	for _, ns := range []string{"one", "two"} {
+		store := factory.CreateStore(ns)
+		for i := 0; i < 10; i++ {
+			c := NewChunk(bytes.Repeat([]byte(ns), 100+i))
+			store.Put(c)
+			chunks[ns] = append(chunks[ns], c)
+		}
+		assert.True(store.UpdateRoot(chunks[ns][0].Hash(), hash.Hash{}))
+	}
+	factory.Shutter()
+
+	assert.Equal(20, RecompressLevelDBStore(srcDir, dstDir, 24, FlateCodec))
+	assert.Panics(func() { RecompressLevelDBStore(srcDir, dstDir, 24, NoCompression) })
+
+	factory = NewLevelDBStoreFactory(dstDir, 24, false)
+	defer factory.Shutter()
+	for ns, cs := range chunks {
+		store := factory.CreateStore(ns).(*LevelDBStore)
+		assert.Equal(FlateCodec, store.Codec())
+		assert.Equal(cs[0].Hash(), store.Root())
+		for _, c := range cs {
+			assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+		}
+	}
+}
+
+func TestSharedLevelDBStoreTestSuite(t *testing.T) {
+	suite.Run(t, &SharedLevelDBStoreTestSuite{})
+}
+
+type SharedLevelDBStoreTestSuite struct {
+	ChunkStoreTestSuite
+	dir string
+}
+
+func (suite *SharedLevelDBStoreTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir(os.TempDir(), "")
+	suite.NoError(err)
+	store := NewSharedLevelDBStore(suite.dir, "", 24)
+	suite.putCountFn = func() int {
+		return int(store.putCount)
+	}
+	suite.Store = store
+}
+
+func (suite *SharedLevelDBStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func TestSharedLevelDBStoreConcurrentUpdateRoot(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Each writer appends chunks to a chain, by pointing the root at a new chunk containing the previous root. If UpdateRoot() weren't atomic across the two stores, links would be lost.
+	const writers, commits = 2, 10
+	wg := &sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store := NewSharedLevelDBStore(dir, "", 24)
+			defer store.Close()
+			for j := 0; j < commits; j++ {
+				for {
+					last := store.Root()
+					c := NewChunk([]byte(fmt.Sprintf("%s %d %d", last, i, j)))
+					store.Put(c)
+					if store.UpdateRoot(c.Hash(), last) {
+						break
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	store := NewSharedLevelDBStore(dir, "", 24)
+	defer store.Close()
+	links := 0
+	for h := store.Root(); !h.IsEmpty(); links++ {
+		c := store.Get(h)
+		assert.False(c.IsEmpty())
+		h = hash.Parse(strings.Fields(string(c.Data()))[0])
+	}
+	assert.Equal(writers*commits, links)
+}
+
+func TestSharedLevelDBStoreClosesWhenIdle(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	shared := NewSharedLevelDBStore(dir, "", 24)
+	defer shared.Close()
+	c := NewChunk([]byte("abc"))
+	shared.Put(c)
+	assert.True(shared.UpdateRoot(c.Hash(), hash.Hash{}))
+	time.Sleep(2 * sharedLevelDBIdleTimeout)
+
+	// An exclusive store can open the LevelDB now, and the shared store waits until it's closed.
+	exclusive := NewLevelDBStore(dir, "", 24, false)
+	assert.Equal(c.Hash(), exclusive.Root())
+	done := make(chan hash.Hash)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- shared.Root()
+		}()
+	}
+	select {
+	case <-done:
+		assert.Fail("shared store opened a LevelDB that was in use")
+	case <-time.After(10 * lockFileRetryInterval):
+	}
+	// The store isn't locked while it waits, so it doesn't hold up other goroutines.
+	locked := make(chan struct{})
+	go func() {
+		shared.dbMu.Lock()
+		shared.dbMu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(lockFileRetryInterval):
+		assert.Fail("shared store locked while waiting for the LevelDB")
+	}
+	exclusive.Close()
+	assert.Equal(c.Hash(), <-done)
+	assert.Equal(c.Hash(), <-done)
+}
+
+func TestReadOnlyLevelDBStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	assert.Panics(func() { NewReadOnlyLevelDBStore(filepath.Join(dir, "missing"), "", 24) })
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+
+	writer := NewSharedLevelDBStore(dir, "", 24)
+	defer writer.Close()
+	c := NewChunk([]byte("abc"))
+	writer.Put(c)
+	assert.True(writer.UpdateRoot(c.Hash(), hash.Hash{}))
+
+	store := NewReadOnlyLevelDBStore(dir, "", 24)
+	defer store.Close()
+	assert.Equal(c.Hash(), store.Root())
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	assert.Panics(func() { store.Put(NewChunk([]byte("def"))) })
+	assert.Panics(func() { store.UpdateRoot(hash.Hash{}, c.Hash()) })
+
+	// The read-only store doesn't keep the writer out.
+	time.Sleep(2 * sharedLevelDBIdleTimeout)
+	d := NewChunk([]byte("def"))
+	writer.Put(d)
+	assert.True(writer.UpdateRoot(d.Hash(), c.Hash()))
+	assert.Equal(d.Hash(), store.Root())
+}
@@ -4,19 +4,37 @@
 
 package chunks
 
-import "github.com/stormasm/noms/go/hash"
+import (
+	"sync"
 
-type memoryRootTracker hash.Hash
+	"github.com/stormasm/noms/go/hash"
+)
+
+// memoryRootTracker is a RootTracker which is safe to share between goroutines, e.g. a writer and another watching for its commits.
+type memoryRootTracker struct {
+	mu   sync.Mutex
+	root hash.Hash
+}
 
 func (ms *memoryRootTracker) Root() hash.Hash {
-	return hash.Hash(*ms)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.root
 }
 
 func (ms *memoryRootTracker) UpdateRoot(current, last hash.Hash) bool {
-	if last != hash.Hash(*ms) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if last != ms.root {
 		return false
 	}
 
-	*ms = memoryRootTracker(current)
+	ms.root = current
 	return true
 }
+
+func (ms *memoryRootTracker) setRoot(root hash.Hash) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.root = root
+}
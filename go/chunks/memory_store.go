@@ -5,6 +5,8 @@
 package chunks
 
 import (
+	"bytes"
+	"io"
 	"sync"
 
 	"github.com/stormasm/noms/go/constants"
@@ -42,6 +44,14 @@ func (ms *MemoryStore) Has(r hash.Hash) bool {
 	return ok
 }
 
+func (ms *MemoryStore) GetMany(hashes hash.HashSlice) []Chunk {
+	return getManySerially(ms.Get, hashes)
+}
+
+func (ms *MemoryStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return hasManySerially(ms.Has, hashes)
+}
+
 func (ms *MemoryStore) Version() string {
 	return constants.NomsVersion
 }
@@ -68,6 +78,51 @@ func (ms *MemoryStore) Len() int {
 	return len(ms.data)
 }
 
+func (ms *MemoryStore) IterAll(cb func(c Chunk)) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	for h, c := range ms.data {
+		cb(NewChunkWithHash(h, c.Data()))
+	}
+}
+
+// Snapshot returns the contents of ms, including its root, in a form that can be written to disk or sent to another process and later passed to Restore().
+//
+// The snapshot is the 20-byte digest of the root followed by every chunk in ms, in the format written by Serialize().
+func (ms *MemoryStore) Snapshot() []byte {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	buf := &bytes.Buffer{}
+	digest := ms.Root().Digest()
+	buf.Write(digest[:])
+	for _, c := range ms.data {
+		Serialize(c, buf)
+	}
+	return buf.Bytes()
+}
+
+// Restore replaces the contents and root of ms with those of |snapshot|, which must have been produced by Snapshot(). It panics if |snapshot| is malformed, in which case ms is left unchanged.
+func (ms *MemoryStore) Restore(snapshot []byte) {
+	reader := bytes.NewReader(snapshot)
+	digest := hash.Digest{}
+	_, err := io.ReadFull(reader, digest[:])
+	d.Chk.NoError(err, "Snapshot too short")
+
+	data := map[hash.Hash]Chunk{}
+	for {
+		c, success := deserializeChunk(reader)
+		if !success {
+			break
+		}
+		data[c.Hash()] = c
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data = data
+	ms.setRoot(hash.New(digest))
+}
+
 func (ms *MemoryStore) Close() error {
 	return nil
 }
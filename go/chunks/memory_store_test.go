@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/hash"
 )
 
 func TestMemoryStoreTestSuite(t *testing.T) {
@@ -34,3 +35,33 @@ func (suite *MemoryStoreTestSuite) TestBadSerialization() {
 		Deserialize(bytes.NewReader(bad), ms, nil)
 	})
 }
+
+func (suite *MemoryStoreTestSuite) TestSnapshotRestore() {
+	ms := NewMemoryStore()
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+	ms.Put(c1)
+	ms.Put(c2)
+	suite.True(ms.UpdateRoot(c2.Hash(), hash.Hash{}))
+	snapshot := ms.Snapshot()
+
+	restored := NewMemoryStore()
+	restored.Put(NewChunk([]byte("stale")))
+	restored.Restore(snapshot)
+	suite.Equal(2, restored.Len())
+	suite.Equal(c2.Hash(), restored.Root())
+	suite.Equal(c1.Data(), restored.Get(c1.Hash()).Data())
+	suite.True(restored.Has(c2.Hash()))
+
+	// Later writes to the original don't affect the restored copy.
+	ms.Put(NewChunk([]byte("ghi")))
+	suite.Equal(2, restored.Len())
+
+	empty := NewMemoryStore()
+	empty.Restore(NewMemoryStore().Snapshot())
+	suite.Equal(0, empty.Len())
+	suite.True(empty.Root().IsEmpty())
+
+	suite.Panics(func() { restored.Restore(snapshot[:hash.ByteLen-1]) })
+	suite.Panics(func() { restored.Restore(snapshot[:len(snapshot)-1]) })
+	suite.Equal(2, restored.Len())
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// Metrics receives measurements of the work done by a ChunkStore. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Get records a Get() which took |elapsed|. If |hit| is true, the chunk was found, and its data was |bytes| long.
+	Get(hit bool, bytes int, elapsed time.Duration)
+	// Has records a Has() which took |elapsed|, and whether the chunk was found.
+	Has(hit bool, elapsed time.Duration)
+	// Put records the writing of |chunks| chunks totalling |bytes| bytes, by a single Put() or PutMany(), which took |elapsed|.
+	Put(chunks, bytes int, elapsed time.Duration)
+}
+
+// MeteredStore wraps a ChunkStore, reporting each Get, Has and Put to a Metrics. Wrapping the local store of a TieredStore, for example, reports how often the cache is hit.
+type MeteredStore struct {
+	ChunkStore
+	metrics Metrics
+}
+
+// NewMeteredStore returns a ChunkStore which reports the work done by |cs| to |metrics|. Closing it closes |cs|.
+func NewMeteredStore(cs ChunkStore, metrics Metrics) *MeteredStore {
+	return &MeteredStore{cs, metrics}
+}
+
+func (ms *MeteredStore) Get(h hash.Hash) Chunk {
+	start := time.Now()
+	c := ms.ChunkStore.Get(h)
+	ms.metrics.Get(!c.IsEmpty(), len(c.Data()), time.Since(start))
+	return c
+}
+
+func (ms *MeteredStore) Has(h hash.Hash) bool {
+	start := time.Now()
+	has := ms.ChunkStore.Has(h)
+	ms.metrics.Has(has, time.Since(start))
+	return has
+}
+
+// GetMany reports each chunk as a separate Get, with an equal share of the elapsed time.
+func (ms *MeteredStore) GetMany(hashes hash.HashSlice) []Chunk {
+	start := time.Now()
+	found := ms.ChunkStore.GetMany(hashes)
+	if len(found) > 0 {
+		elapsed := time.Since(start) / time.Duration(len(found))
+		for _, c := range found {
+			ms.metrics.Get(!c.IsEmpty(), len(c.Data()), elapsed)
+		}
+	}
+	return found
+}
+
+// HasMany reports each hash as a separate Has, with an equal share of the elapsed time.
+func (ms *MeteredStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	start := time.Now()
+	absent = ms.ChunkStore.HasMany(hashes)
+	if len(hashes) > 0 {
+		elapsed := time.Since(start) / time.Duration(len(hashes))
+		for h := range hashes {
+			ms.metrics.Has(!absent.Has(h), elapsed)
+		}
+	}
+	return
+}
+
+func (ms *MeteredStore) Put(c Chunk) {
+	start := time.Now()
+	ms.ChunkStore.Put(c)
+	ms.metrics.Put(1, len(c.Data()), time.Since(start))
+}
+
+// PutMany reports only the chunks that were accepted by the wrapped store.
+func (ms *MeteredStore) PutMany(chunks []Chunk) BackpressureError {
+	start := time.Now()
+	bpe := ms.ChunkStore.PutMany(chunks)
+	elapsed := time.Since(start)
+
+	rejected := make(map[hash.Hash]bool, len(bpe))
+	for _, h := range bpe {
+		rejected[h] = true
+	}
+	count, bytes := 0, 0
+	for _, c := range chunks {
+		if !rejected[c.Hash()] {
+			count++
+			bytes += len(c.Data())
+		}
+	}
+	ms.metrics.Put(count, bytes, elapsed)
+	return bpe
+}
+
+// ExpvarMetrics is a Metrics which publishes running totals through the expvar package, so they're served as JSON at /debug/vars by any process that serves http.DefaultServeMux, where they can be scraped by monitoring systems such as Prometheus. Latencies are published as total nanoseconds; dividing by the corresponding count gives the mean.
+type ExpvarMetrics struct {
+	vars *expvar.Map
+}
+
+// NewExpvarMetrics returns an ExpvarMetrics which publishes its totals in the expvar Map called |name|. Metrics with the same name share their totals.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &ExpvarMetrics{v}
+	}
+	return &ExpvarMetrics{expvar.NewMap(name)}
+}
+
+func (em *ExpvarMetrics) Get(hit bool, bytes int, elapsed time.Duration) {
+	em.vars.Add("gets", 1)
+	if hit {
+		em.vars.Add("getHits", 1)
+		em.vars.Add("getBytes", int64(bytes))
+	} else {
+		em.vars.Add("getMisses", 1)
+	}
+	em.vars.Add("getNanos", int64(elapsed))
+}
+
+func (em *ExpvarMetrics) Has(hit bool, elapsed time.Duration) {
+	em.vars.Add("has", 1)
+	if hit {
+		em.vars.Add("hasHits", 1)
+	} else {
+		em.vars.Add("hasMisses", 1)
+	}
+	em.vars.Add("hasNanos", int64(elapsed))
+}
+
+func (em *ExpvarMetrics) Put(chunks, bytes int, elapsed time.Duration) {
+	em.vars.Add("puts", int64(chunks))
+	em.vars.Add("putBytes", int64(bytes))
+	em.vars.Add("putNanos", int64(elapsed))
+}
+
+// Value returns the current total called |name|, e.g. "gets" or "putBytes".
+func (em *ExpvarMetrics) Value(name string) int64 {
+	v := em.vars.Get(name)
+	if v == nil {
+		return 0
+	}
+	i, err := strconv.ParseInt(v.String(), 10, 64)
+	d.Chk.NoError(err)
+	return i
+}
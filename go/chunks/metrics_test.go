@@ -0,0 +1,54 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestMeteredStoreTestSuite(t *testing.T) {
+	suite.Run(t, &MeteredStoreTestSuite{})
+}
+
+type MeteredStoreTestSuite struct {
+	ChunkStoreTestSuite
+}
+
+func (suite *MeteredStoreTestSuite) SetupTest() {
+	suite.Store = NewMeteredStore(NewMemoryStore(), NewExpvarMetrics("MeteredStoreTestSuite"))
+}
+
+func (suite *MeteredStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+}
+
+func TestMeteredStoreMetrics(t *testing.T) {
+	assert := assert.New(t)
+	metrics := NewExpvarMetrics("TestMeteredStoreMetrics")
+	store := NewMeteredStore(NewMemoryStore(), metrics)
+	defer store.Close()
+
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("defg"))
+	store.Put(c1)
+	store.PutMany([]Chunk{c2})
+	store.Get(c1.Hash())
+	store.Get(NewChunk([]byte("missing")).Hash())
+	store.Has(c2.Hash())
+
+	assert.EqualValues(2, metrics.Value("puts"))
+	assert.EqualValues(7, metrics.Value("putBytes"))
+	assert.EqualValues(2, metrics.Value("gets"))
+	assert.EqualValues(1, metrics.Value("getHits"))
+	assert.EqualValues(1, metrics.Value("getMisses"))
+	assert.EqualValues(3, metrics.Value("getBytes"))
+	assert.EqualValues(1, metrics.Value("hasHits"))
+	assert.EqualValues(0, metrics.Value("hasMisses"))
+
+	// Metrics with the same name share totals.
+	assert.EqualValues(2, NewExpvarMetrics("TestMeteredStoreMetrics").Value("gets"))
+}
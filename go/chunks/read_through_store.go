@@ -46,6 +46,38 @@ func (rts ReadThroughStore) Has(h hash.Hash) bool {
 	return rts.cachingStore.Has(h) || rts.backingStore.Has(h)
 }
 
+func (rts ReadThroughStore) GetMany(hashes hash.HashSlice) []Chunk {
+	found := rts.cachingStore.GetMany(hashes)
+	misses := hash.HashSlice{}
+	for i, c := range found {
+		if c.IsEmpty() {
+			misses = append(misses, hashes[i])
+		}
+	}
+	if len(misses) == 0 {
+		return found
+	}
+
+	fetched := rts.backingStore.GetMany(misses)
+	toCache := make([]Chunk, 0, len(fetched))
+	for i, j := 0, 0; i < len(found); i++ {
+		if !found[i].IsEmpty() {
+			continue
+		}
+		found[i] = fetched[j]
+		j++
+		if !found[i].IsEmpty() {
+			toCache = append(toCache, found[i])
+		}
+	}
+	rts.cachingStore.PutMany(toCache)
+	return found
+}
+
+func (rts ReadThroughStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return rts.backingStore.HasMany(rts.cachingStore.HasMany(hashes))
+}
+
 func (rts ReadThroughStore) Put(c Chunk) {
 	rts.backingStore.Put(c)
 	rts.cachingStore.Put(c)
@@ -0,0 +1,118 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/rest"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+const s3NotFoundCode = "NotFound"
+
+// s3Client is a minimal S3 client implementing s3svc on top of the core AWS SDK, which only vendors the DynamoDB service. Objects are addressed path-style, i.e. as /bucket/key.
+type s3Client struct {
+	*client.Client
+}
+
+type s3ObjectInput struct {
+	_      struct{} `type:"structure" payload:"Body"`
+	Bucket *string  `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+	Key    *string  `location:"uri" locationName:"Key" type:"string" required:"true"`
+	Range  *string  `location:"header" locationName:"Range" type:"string"`
+	Body   []byte   `type:"blob"`
+}
+
+type s3ObjectOutput struct {
+	_    struct{} `type:"structure" payload:"Body"`
+	Body []byte   `type:"blob"`
+}
+
+func newS3Client(config *aws.Config) *s3Client {
+	c := session.New(config).ClientConfig("s3")
+	svc := &s3Client{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   "s3",
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    "2006-03-01",
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBack(rest.Build)
+	svc.Handlers.Unmarshal.PushBack(rest.Unmarshal)
+	svc.Handlers.UnmarshalMeta.PushBack(rest.UnmarshalMeta)
+	svc.Handlers.UnmarshalError.PushBack(unmarshalS3Error)
+	return svc
+}
+
+// unmarshalS3Error turns failed responses into awserr.RequestFailures. S3 error bodies are XML, but the status code is all s3Client needs to tell a missing object from a real failure.
+func unmarshalS3Error(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	io.Copy(ioutil.Discard, r.HTTPResponse.Body)
+
+	code := http.StatusText(r.HTTPResponse.StatusCode)
+	if r.HTTPResponse.StatusCode == http.StatusNotFound {
+		code = s3NotFoundCode
+	}
+	r.Error = awserr.NewRequestFailure(awserr.New(code, r.HTTPResponse.Status, nil), r.HTTPResponse.StatusCode, r.RequestID)
+}
+
+func isS3NotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == s3NotFoundCode
+	}
+	return false
+}
+
+func (s *s3Client) send(method string, input *s3ObjectInput) (*s3ObjectOutput, error) {
+	op := &request.Operation{
+		Name:       method + "Object",
+		HTTPMethod: method,
+		HTTPPath:   "/{Bucket}/{Key+}",
+	}
+	output := &s3ObjectOutput{}
+	err := s.NewRequest(op, input, output).Send()
+	return output, err
+}
+
+func (s *s3Client) GetObject(bucket, key string) ([]byte, error) {
+	return s.get(&s3ObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+}
+
+func (s *s3Client) GetObjectRange(bucket, key, rng string) ([]byte, error) {
+	return s.get(&s3ObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Range: aws.String(rng)})
+}
+
+func (s *s3Client) get(input *s3ObjectInput) ([]byte, error) {
+	output, err := s.send("GET", input)
+	if isS3NotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if output.Body == nil {
+		return []byte{}, nil
+	}
+	return output.Body, nil
+}
+
+func (s *s3Client) PutObject(bucket, key string, data []byte) error {
+	_, err := s.send("PUT", &s3ObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: data})
+	return err
+}
@@ -0,0 +1,431 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/golang/snappy"
+	flag "github.com/juju/gnuflag"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/util/logging"
+)
+
+const (
+	defaultS3MemTableSize = 1 << 24 // 16MiB
+
+	s3TableDir    = "tables/"
+	s3ManifestDir = "manifests/"
+)
+
+// s3svc is the subset of the S3 API used by S3Store.
+type s3svc interface {
+	// GetObject returns the contents of the object at |key|, or nil if there is no such object.
+	GetObject(bucket, key string) ([]byte, error)
+	// GetObjectRange is like GetObject, but returns only the bytes of the object in |rng|, an HTTP byte range such as "bytes=0-99" or "bytes=-100".
+	GetObjectRange(bucket, key, rng string) ([]byte, error)
+	PutObject(bucket, key string, data []byte) error
+}
+
+// s3Table is a table file stored in S3. Its index is held in memory; chunk data is fetched with range requests.
+type s3Table struct {
+	name  string
+	index tableIndex
+}
+
+// s3MemTable holds chunks that haven't been uploaded to S3 yet.
+type s3MemTable struct {
+	chunks map[hash.Hash]Chunk
+	size   uint64
+}
+
+func newS3MemTable() *s3MemTable {
+	return &s3MemTable{chunks: map[hash.Hash]Chunk{}}
+}
+
+func (mt *s3MemTable) add(c Chunk) {
+	if _, ok := mt.chunks[c.Hash()]; !ok {
+		mt.chunks[c.Hash()] = c
+		mt.size += uint64(len(c.Data()))
+	}
+}
+
+// S3Store implements ChunkStore on top of an S3 bucket, keeping chunks in the same immutable table files as TableStore, under |prefix|/tables/. New chunks are buffered in memory, and uploaded as a new table file when enough of them accumulate, or when Flush() or UpdateRoot() is called. Only the index of each table is read into memory; chunks are fetched with range requests.
+// The set of tables and the root are recorded in a manifest, also stored in the bucket, under |prefix|/manifests/ and named after its hash. S3 has no atomic compare-and-set, so the hash of the current manifest is kept by a separate RootTracker, e.g. a DynamoStore or a FileRootTracker.
+// An upload that fails doesn't lose any chunks; they're kept in memory, and the error is returned, as a panic d.Try() recovers, from the next Flush() or UpdateRoot(), which can be retried.
+type S3Store struct {
+	bucket       string
+	prefix       string
+	s3svc        s3svc
+	manifest     RootTracker
+	memTableSize uint64
+
+	mu           sync.Mutex
+	uploaded     *sync.Cond // signaled, with mu held, when an upload finishes
+	mem          *s3MemTable
+	uploading    []*s3MemTable
+	uploadErr    error
+	tables       []*s3Table // newest first
+	pending      []string   // uploaded tables that aren't in the manifest yet, oldest first
+	manifestHash hash.Hash
+	lastManifest tableManifest
+	commitMu     sync.Mutex
+}
+
+// NewS3Store returns a new S3Store which stores chunks in |bucket| under |prefix|, and the hash of whose manifest is tracked by |manifest|. If |manifest| implements io.Closer, it's closed when the store is.
+func NewS3Store(bucket, prefix string, config *aws.Config, manifest RootTracker) *S3Store {
+	return newS3StoreFromS3svc(bucket, prefix, newS3Client(config), manifest)
+}
+
+func newS3StoreFromS3svc(bucket, prefix string, svc s3svc, manifest RootTracker) *S3Store {
+	return newS3Store(bucket, prefix, svc, manifest, defaultS3MemTableSize)
+}
+
+func newS3Store(bucket, prefix string, svc s3svc, manifest RootTracker, memTableSize uint64) *S3Store {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	s := &S3Store{
+		bucket:       bucket,
+		prefix:       prefix,
+		s3svc:        svc,
+		manifest:     manifest,
+		memTableSize: memTableSize,
+		mem:          newS3MemTable(),
+	}
+	s.uploaded = sync.NewCond(&s.mu)
+	s.refresh()
+	return s
+}
+
+func (s *S3Store) tableKey(name string) string {
+	return s.prefix + s3TableDir + name
+}
+
+func (s *S3Store) manifestKey(h hash.Hash) string {
+	return s.prefix + s3ManifestDir + h.String()
+}
+
+// readManifest returns the manifest named |h|, or an empty one if |h| is empty.
+func (s *S3Store) readManifest(h hash.Hash) tableManifest {
+	if h.IsEmpty() {
+		return tableManifest{vers: constants.NomsVersion}
+	}
+	s.mu.Lock()
+	if h == s.manifestHash {
+		defer s.mu.Unlock()
+		return s.lastManifest
+	}
+	s.mu.Unlock()
+
+	data, err := s.s3svc.GetObject(s.bucket, s.manifestKey(h))
+	d.PanicIfError(err)
+	d.PanicIfTrue(data == nil, "Manifest %s is missing from s3://%s/%s", h, s.bucket, s.prefix)
+	m := parseTableManifest(s.manifestKey(h), data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manifestHash, s.lastManifest = h, m
+	return m
+}
+
+// refresh reads the current manifest, and opens any tables it names that s doesn't have open yet.
+func (s *S3Store) refresh() tableManifest {
+	m := s.readManifest(s.manifest.Root())
+	s.mu.Lock()
+	open := s.openTables()
+	s.mu.Unlock()
+
+	opened := []*s3Table{}
+	for _, name := range m.tables {
+		if !open[name] {
+			opened = append(opened, s.openTable(name))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	open = s.openTables()
+	for _, t := range opened {
+		if !open[t.name] {
+			s.tables = append(s.tables, t)
+		}
+	}
+	return m
+}
+
+// openTables returns the names of the tables s has open. Callers must hold s.mu.
+func (s *S3Store) openTables() map[string]bool {
+	open := map[string]bool{}
+	for _, t := range s.tables {
+		open[t.name] = true
+	}
+	return open
+}
+
+// openTable reads the index of the table |name|, by fetching its footer and then the index that precedes it.
+func (s *S3Store) openTable(name string) *s3Table {
+	key := s.tableKey(name)
+	footer, err := s.s3svc.GetObjectRange(s.bucket, key, fmt.Sprintf("bytes=-%d", tableFooterLen))
+	d.PanicIfError(err)
+	d.PanicIfTrue(footer == nil, "Table %s is missing from s3://%s/%s", name, s.bucket, s.prefix)
+	count := parseTableFooter(name, footer)
+
+	tailLen := count*tableIndexEntryLen + tableFooterLen
+	tail, err := s.s3svc.GetObjectRange(s.bucket, key, fmt.Sprintf("bytes=-%d", tailLen))
+	d.PanicIfError(err)
+	d.PanicIfTrue(len(tail) != tailLen, "Table %s is truncated", name)
+	return &s3Table{name, parseTableIndex(tail, count)}
+}
+
+// find returns the chunk with hash |h| if it hasn't been uploaded yet, or else the table that contains it and its entry in the table's index.
+func (s *S3Store) find(h hash.Hash) (c Chunk, t *s3Table, e tableIndexEntry, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mt := range append([]*s3MemTable{s.mem}, s.uploading...) {
+		if c, ok := mt.chunks[h]; ok {
+			return c, nil, e, true
+		}
+	}
+	for _, t := range s.tables {
+		if e, ok := t.index.find(h); ok {
+			return EmptyChunk, t, e, true
+		}
+	}
+	return EmptyChunk, nil, e, false
+}
+
+func (s *S3Store) Get(h hash.Hash) Chunk {
+	c, t, e, ok := s.find(h)
+	if !ok || t == nil {
+		return c
+	}
+	compressed, err := s.s3svc.GetObjectRange(s.bucket, s.tableKey(t.name), fmt.Sprintf("bytes=%d-%d", e.offset, e.offset+uint64(e.length)-1))
+	d.PanicIfError(err)
+	data, err := snappy.Decode(nil, compressed)
+	d.PanicIfTrue(err != nil, "Chunk %s in table %s is corrupt", h, t.name)
+	return NewChunkWithHash(h, data)
+}
+
+func (s *S3Store) Has(h hash.Hash) bool {
+	_, _, _, ok := s.find(h)
+	return ok
+}
+
+// GetMany fetches the chunks with concurrent requests, since S3 has no batch read.
+func (s *S3Store) GetMany(hashes hash.HashSlice) []Chunk {
+	return getManyConcurrently(s.Get, hashes)
+}
+
+func (s *S3Store) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return hasManySerially(s.Has, hashes)
+}
+
+func (s *S3Store) Put(c Chunk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.add(c)
+	if s.mem.size >= s.memTableSize {
+		s.uploadMemTable()
+	}
+}
+
+func (s *S3Store) PutMany(chunks []Chunk) (e BackpressureError) {
+	for _, c := range chunks {
+		s.Put(c)
+	}
+	return
+}
+
+// uploadMemTable starts uploading the in-memory table as a new table file. Its chunks can still be read from memory until the upload finishes. If the upload fails, they're moved back into the in-memory table, to be uploaded again, and the error is kept for Flush() to return. Callers must hold s.mu.
+func (s *S3Store) uploadMemTable() {
+	if len(s.mem.chunks) == 0 {
+		return
+	}
+	mt := s.mem
+	s.mem = newS3MemTable()
+	s.uploading = append(s.uploading, mt)
+	go func() {
+		t, data := buildS3Table(mt)
+		err := s.s3svc.PutObject(s.bucket, s.tableKey(t.name), data)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, u := range s.uploading {
+			if u == mt {
+				s.uploading = append(s.uploading[:i], s.uploading[i+1:]...)
+				break
+			}
+		}
+		if err != nil {
+			logging.Debug("table upload failed", logging.F("bucket", s.bucket), logging.F("table", t.name), logging.F("error", err.Error()))
+			if s.uploadErr == nil {
+				s.uploadErr = err
+			}
+			for _, c := range mt.chunks {
+				s.mem.add(c)
+			}
+		} else {
+			s.tables = append([]*s3Table{t}, s.tables...)
+			s.pending = append(s.pending, t.name)
+		}
+		s.uploaded.Broadcast()
+	}()
+}
+
+// buildS3Table returns a table file containing the chunks in |mt|.
+func buildS3Table(mt *s3MemTable) (*s3Table, []byte) {
+	buf := &bytes.Buffer{}
+	index := make(tableIndex, 0, len(mt.chunks))
+	for h, c := range mt.chunks {
+		data := snappy.Encode(nil, c.Data())
+		index = append(index, tableIndexEntry{h, uint64(buf.Len()), uint32(len(data))})
+		buf.Write(data)
+	}
+	name, tail := encodeTableIndex(index)
+	buf.Write(tail)
+	return &s3Table{name, index}, buf.Bytes()
+}
+
+// waitForUploads blocks until no uploads are in progress, then returns, and clears, the first error any of them failed with since the last call. Callers must hold s.mu.
+func (s *S3Store) waitForUploads() (err error) {
+	for len(s.uploading) > 0 {
+		s.uploaded.Wait()
+	}
+	err, s.uploadErr = s.uploadErr, nil
+	return
+}
+
+// Flush uploads any chunks buffered in memory, and waits for all uploads to finish. If any of them failed, Flush panics with the error, which d.Try() recovers; the chunks stay buffered, so Flush can be called again to retry.
+func (s *S3Store) Flush() {
+	s.mu.Lock()
+	s.uploadMemTable()
+	err := s.waitForUploads()
+	s.mu.Unlock()
+	d.PanicIfError(err)
+}
+
+func (s *S3Store) Version() string {
+	return s.readManifest(s.manifest.Root()).vers
+}
+
+func (s *S3Store) Root() hash.Hash {
+	return s.refresh().root
+}
+
+// UpdateRoot flushes any buffered chunks, then writes a new manifest naming the tables uploaded since the last update, and makes it current if the root is still |last|.
+func (s *S3Store) UpdateRoot(current, last hash.Hash) bool {
+	s.Flush()
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	for {
+		mh := s.manifest.Root()
+		m := s.readManifest(mh)
+		if m.root != last {
+			logging.Debug("root changed, not updated", logging.F("bucket", s.bucket), logging.F("current", current.String()), logging.F("last", last.String()))
+			s.refresh()
+			return false
+		}
+
+		s.mu.Lock()
+		pending := s.pending
+		s.mu.Unlock()
+		nm := tableManifest{constants.NomsVersion, current, append([]string{}, m.tables...)}
+		named := map[string]bool{}
+		for _, name := range m.tables {
+			named[name] = true
+		}
+		for _, name := range pending {
+			if !named[name] {
+				nm.tables = append(nm.tables, name)
+				named[name] = true
+			}
+		}
+
+		data := nm.bytes()
+		nh := hash.FromData(data)
+		d.PanicIfError(s.s3svc.PutObject(s.bucket, s.manifestKey(nh), data))
+		// If another store changed the manifest without changing the root, e.g. to add its own tables, try again on top of that.
+		if s.manifest.UpdateRoot(nh, mh) {
+			s.mu.Lock()
+			s.pending = s.pending[len(pending):]
+			s.manifestHash, s.lastManifest = nh, nm
+			s.mu.Unlock()
+			return true
+		}
+	}
+}
+
+// Close waits for any uploads in progress, returning the error if one failed. Chunks that were never flushed are discarded, as they aren't part of the store until UpdateRoot() adds them to the manifest.
+func (s *S3Store) Close() (err error) {
+	s.mu.Lock()
+	err = s.waitForUploads()
+	s.mu.Unlock()
+	if c, ok := s.manifest.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
+
+type S3StoreFlags struct {
+	region        string
+	manifestTable string
+	manifestDir   string
+}
+
+var (
+	s3Flags           = S3StoreFlags{"us-west-2", "", defaultS3ManifestDir()}
+	s3FlagsRegistered = false
+)
+
+func defaultS3ManifestDir() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".noms", "s3")
+}
+
+func RegisterS3Flags(flags *flag.FlagSet) {
+	if !s3FlagsRegistered {
+		s3FlagsRegistered = true
+		flags.StringVar(&s3Flags.region, "s3-region", s3Flags.region, "aws region of the bucket used by s3: databases")
+		flags.StringVar(&s3Flags.manifestTable, "s3-manifest-table", s3Flags.manifestTable, "dynamodb table in which to keep the root of s3: databases. If empty, the root is kept in a local file under -s3-manifest-dir")
+		flags.StringVar(&s3Flags.manifestDir, "s3-manifest-dir", s3Flags.manifestDir, "directory in which to keep the roots of s3: databases when -s3-manifest-table isn't set")
+	}
+}
+
+// NewS3StoreUseFlags returns an S3Store for |bucket| and |prefix| configured by the flags registered with RegisterS3Flags(). AWS credentials are taken from the environment.
+func NewS3StoreUseFlags(bucket, prefix string) *S3Store {
+	return NewS3StoreWithProfileUseFlags(bucket, prefix, "")
+}
+
+// NewS3StoreWithProfileUseFlags is like NewS3StoreUseFlags(), but if |profile| isn't empty, AWS credentials are taken from that profile in the shared credentials file (~/.aws/credentials) instead.
+func NewS3StoreWithProfileUseFlags(bucket, prefix, profile string) *S3Store {
+	config := aws.NewConfig().WithRegion(s3Flags.region)
+	if profile != "" {
+		config = config.WithCredentials(credentials.NewSharedCredentials("", profile))
+	}
+	var manifest RootTracker
+	if s3Flags.manifestTable != "" {
+		manifest = NewDynamoStore(s3Flags.manifestTable, "s3:"+bucket+"/"+prefix, config, false)
+	} else {
+		d.PanicIfTrue(s3Flags.manifestDir == "", "-s3-manifest-dir must be set when -s3-manifest-table isn't")
+		manifest = NewFileRootTracker(filepath.Join(s3Flags.manifestDir, bucket, prefix, "manifest"))
+	}
+	return NewS3Store(bucket, prefix, config, manifest)
+}
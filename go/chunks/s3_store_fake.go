@@ -0,0 +1,66 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	numPuts int   // Number of chunks written in tables; manifests aren't counted.
+	putErr  error // If set, PutObject fails with putErr.
+}
+
+func createFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}}
+}
+
+func (m *fakeS3) GetObject(bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.objects[bucket+"/"+key], nil
+}
+
+// GetObjectRange supports the two forms of range S3Store uses: "bytes=first-last" and the suffix range "bytes=-length".
+func (m *fakeS3) GetObjectRange(bucket, key, rng string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, nil
+	}
+	var first, last int
+	if _, err := fmt.Sscanf(rng, "bytes=-%d", &last); err == nil {
+		if last > len(data) {
+			last = len(data)
+		}
+		return data[len(data)-last:], nil
+	}
+	if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &first, &last); err != nil {
+		return nil, err
+	}
+	if last >= len(data) {
+		last = len(data) - 1
+	}
+	return data[first : last+1], nil
+}
+
+func (m *fakeS3) PutObject(bucket, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.putErr != nil {
+		return m.putErr
+	}
+	m.objects[bucket+"/"+key] = append([]byte{}, data...)
+	if strings.Contains(key, s3TableDir) {
+		m.numPuts += int(binary.BigEndian.Uint32(data[len(data)-tableFooterLen:]))
+	}
+	return nil
+}
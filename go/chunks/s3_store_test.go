@@ -0,0 +1,140 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+func TestS3StoreTestSuite(t *testing.T) {
+	suite.Run(t, &S3StoreTestSuite{})
+}
+
+type S3StoreTestSuite struct {
+	ChunkStoreTestSuite
+	s3  *fakeS3
+	dir string
+}
+
+func (suite *S3StoreTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir(os.TempDir(), "")
+	suite.NoError(err)
+	suite.s3 = createFakeS3()
+	suite.Store = newS3StoreFromS3svc("bucket", "prefix", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "manifest")))
+	suite.putCountFn = func() int {
+		suite.s3.mu.Lock()
+		defer suite.s3.mu.Unlock()
+		return suite.s3.numPuts
+	}
+}
+
+func (suite *S3StoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *S3StoreTestSuite) TestReopen() {
+	c := NewChunk([]byte("abc"))
+	suite.Store.Put(c)
+	suite.True(suite.Store.UpdateRoot(c.Hash(), hash.Hash{}))
+	suite.Equal(constants.NomsVersion, suite.Store.Version())
+
+	store := newS3StoreFromS3svc("bucket", "prefix/", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "manifest")))
+	defer store.Close()
+	suite.Equal(c.Hash(), store.Root())
+	suite.True(store.Has(c.Hash()))
+	suite.Equal(c.Data(), store.Get(c.Hash()).Data())
+
+	other := newS3StoreFromS3svc("bucket", "other", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "other")))
+	defer other.Close()
+	suite.True(other.Root().IsEmpty())
+	suite.False(other.Has(c.Hash()))
+}
+
+func (suite *S3StoreTestSuite) TestTables() {
+	store := newS3Store("bucket", "tables", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "tables")), 1<<10)
+	defer store.Close()
+	chunks := []Chunk{}
+	for i := 0; i < 100; i++ {
+		c := NewChunk(bytes.Repeat([]byte{byte(i)}, 100))
+		chunks = append(chunks, c)
+		store.Put(c)
+	}
+	suite.True(store.UpdateRoot(chunks[0].Hash(), hash.Hash{}))
+	suite.True(len(store.tables) > 1)
+
+	reopened := newS3StoreFromS3svc("bucket", "tables", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "tables")))
+	defer reopened.Close()
+	suite.Len(reopened.tables, len(store.tables))
+	for _, c := range chunks {
+		suite.Equal(c.Data(), reopened.Get(c.Hash()).Data())
+	}
+}
+
+func (suite *S3StoreTestSuite) TestUploadFailure() {
+	c := NewChunk([]byte("abc"))
+	suite.Store.Put(c)
+	suite.s3.putErr = errors.New("S3 is down")
+	store := suite.Store.(*S3Store)
+	suite.Error(d.Try(store.Flush))
+	suite.Error(d.Try(func() { store.UpdateRoot(c.Hash(), hash.Hash{}) }))
+	suite.True(store.Has(c.Hash()))
+	suite.True(store.Root().IsEmpty())
+
+	suite.s3.putErr = nil
+	suite.True(store.UpdateRoot(c.Hash(), hash.Hash{}))
+	reopened := newS3StoreFromS3svc("bucket", "prefix", suite.s3, NewFileRootTracker(filepath.Join(suite.dir, "manifest")))
+	defer reopened.Close()
+	suite.Equal(c.Hash(), reopened.Root())
+	suite.Equal(c.Data(), reopened.Get(c.Hash()).Data())
+}
+
+func TestFileRootTrackerConcurrentUpdates(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sub", "manifest")
+	assert.True(NewFileRootTracker(path).Root().IsEmpty())
+
+	// Every tracker tries to advance the root from the same starting point, so exactly one should win.
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	winners := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if NewFileRootTracker(path).UpdateRoot(hash.FromData([]byte{byte(i)}), hash.Hash{}) {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(1, winners)
+
+	ft := NewFileRootTracker(path)
+	root := ft.Root()
+	assert.False(root.IsEmpty())
+	assert.False(ft.UpdateRoot(hash.FromData([]byte("x")), hash.Hash{}))
+	assert.True(ft.UpdateRoot(hash.FromData([]byte("x")), root))
+	assert.Equal(hash.FromData([]byte("x")), ft.Root())
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/snappy"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+/*
+  Table File:
+    Chunk Data 0   // snappy-compressed
+     ..
+    Chunk Data N-1
+    Index Entry 0  // sorted by Hash
+     ..
+    Index Entry N-1
+    Footer
+
+  Index Entry:
+    Hash    // 20-byte hash
+    Offset  // 8-byte offset of the chunk data in the file
+    Length  // 4-byte length of the compressed chunk data
+
+  Footer:
+    Count   // 4-byte number of chunks
+    Magic   // tableFileMagic
+
+  All integers are big-endian. Table files are immutable once written, and are named after the hash of their index, so a table file's name identifies its contents.
+*/
+
+const (
+	tableFileMagic     = "nomstbl1"
+	tableIndexEntryLen = hash.ByteLen + 8 + 4
+	tableFooterLen     = 4 + len(tableFileMagic)
+)
+
+type tableIndexEntry struct {
+	h      hash.Hash
+	offset uint64
+	length uint32
+}
+
+type tableIndex []tableIndexEntry
+
+func (ti tableIndex) Len() int           { return len(ti) }
+func (ti tableIndex) Less(i, j int) bool { return ti[i].h.Less(ti[j].h) }
+func (ti tableIndex) Swap(i, j int)      { ti[i], ti[j] = ti[j], ti[i] }
+
+type tableIndexByOffset tableIndex
+
+func (ti tableIndexByOffset) Len() int           { return len(ti) }
+func (ti tableIndexByOffset) Less(i, j int) bool { return ti[i].offset < ti[j].offset }
+func (ti tableIndexByOffset) Swap(i, j int)      { ti[i], ti[j] = ti[j], ti[i] }
+
+// tableWriter streams chunks into a new table file in |dir|.
+type tableWriter struct {
+	dir    string
+	f      *os.File
+	w      *bufio.Writer
+	offset uint64
+	index  tableIndex
+	seen   map[hash.Hash]bool
+}
+
+func newTableWriter(dir string) *tableWriter {
+	f, err := ioutil.TempFile(dir, "table")
+	d.PanicIfError(err)
+	return &tableWriter{dir, f, bufio.NewWriter(f), 0, tableIndex{}, map[hash.Hash]bool{}}
+}
+
+func (tw *tableWriter) add(c Chunk) {
+	if tw.seen[c.Hash()] {
+		return
+	}
+	tw.seen[c.Hash()] = true
+	data := snappy.Encode(nil, c.Data())
+	_, err := tw.w.Write(data)
+	d.PanicIfError(err)
+	tw.index = append(tw.index, tableIndexEntry{c.Hash(), tw.offset, uint32(len(data))})
+	tw.offset += uint64(len(data))
+}
+
+func (tw *tableWriter) count() int {
+	return len(tw.index)
+}
+
+// finish writes the index and footer, moves the file into place and returns its name.
+func (tw *tableWriter) finish() string {
+	name, tail := encodeTableIndex(tw.index)
+	_, err := tw.w.Write(tail)
+	d.PanicIfError(err)
+	d.PanicIfError(tw.w.Flush())
+	d.PanicIfError(tw.f.Sync())
+	d.PanicIfError(tw.f.Close())
+	d.PanicIfError(os.Rename(tw.f.Name(), filepath.Join(tw.dir, name)))
+	return name
+}
+
+// encodeTableIndex sorts |index| and returns the index and footer that end a table containing its chunks, along with the table's name.
+func encodeTableIndex(index tableIndex) (name string, tail []byte) {
+	sort.Sort(index)
+	buf := &bytes.Buffer{}
+	for _, e := range index {
+		digest := e.h.Digest()
+		buf.Write(digest[:])
+		binary.Write(buf, binary.BigEndian, e.offset)
+		binary.Write(buf, binary.BigEndian, e.length)
+	}
+	name = hash.FromData(buf.Bytes()).String()
+	binary.Write(buf, binary.BigEndian, uint32(len(index)))
+	buf.WriteString(tableFileMagic)
+	return name, buf.Bytes()
+}
+
+// parseTableFooter returns the number of chunks in the table |name|, whose footer is |footer|.
+func parseTableFooter(name string, footer []byte) int {
+	d.PanicIfFalse(len(footer) == tableFooterLen && string(footer[4:]) == tableFileMagic, "%s is not a table file", name)
+	return int(binary.BigEndian.Uint32(footer))
+}
+
+// parseTableIndex decodes the |count| index entries in |buf|.
+func parseTableIndex(buf []byte, count int) tableIndex {
+	index := make(tableIndex, count)
+	for i := range index {
+		e := buf[i*tableIndexEntryLen:]
+		index[i] = tableIndexEntry{
+			hash.FromSlice(e[:hash.ByteLen]),
+			binary.BigEndian.Uint64(e[hash.ByteLen:]),
+			binary.BigEndian.Uint32(e[hash.ByteLen+8:]),
+		}
+	}
+	return index
+}
+
+func (ti tableIndex) find(h hash.Hash) (tableIndexEntry, bool) {
+	i := sort.Search(len(ti), func(i int) bool {
+		return !ti[i].h.Less(h)
+	})
+	if i < len(ti) && ti[i].h == h {
+		return ti[i], true
+	}
+	return tableIndexEntry{}, false
+}
+
+// abort discards the table being written.
+func (tw *tableWriter) abort() {
+	tw.f.Close()
+	os.Remove(tw.f.Name())
+}
+
+// tableReader provides access to the chunks in a table file. The index is held in memory; chunk data is read from the file on demand.
+type tableReader struct {
+	name  string
+	f     *os.File
+	index tableIndex
+	size  uint64
+}
+
+func openTable(dir, name string) *tableReader {
+	f, err := os.Open(filepath.Join(dir, name))
+	d.PanicIfError(err)
+	fi, err := f.Stat()
+	d.PanicIfError(err)
+	size := fi.Size()
+	d.PanicIfTrue(size < int64(tableFooterLen), "Table file %s is truncated", name)
+
+	footer := make([]byte, tableFooterLen)
+	_, err = f.ReadAt(footer, size-int64(tableFooterLen))
+	d.PanicIfError(err)
+	count := parseTableFooter(name, footer)
+
+	indexStart := size - int64(tableFooterLen) - int64(count*tableIndexEntryLen)
+	d.PanicIfTrue(indexStart < 0, "Table file %s is truncated", name)
+	buf := make([]byte, count*tableIndexEntryLen)
+	_, err = f.ReadAt(buf, indexStart)
+	d.PanicIfError(err)
+	return &tableReader{name, f, parseTableIndex(buf, count), uint64(size)}
+}
+
+func (tr *tableReader) find(h hash.Hash) (tableIndexEntry, bool) {
+	return tr.index.find(h)
+}
+
+func (tr *tableReader) has(h hash.Hash) bool {
+	_, ok := tr.find(h)
+	return ok
+}
+
+func (tr *tableReader) read(e tableIndexEntry) []byte {
+	compressed := make([]byte, e.length)
+	_, err := tr.f.ReadAt(compressed, int64(e.offset))
+	if err == io.EOF {
+		return nil
+	}
+	d.PanicIfError(err)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (tr *tableReader) get(h hash.Hash) (Chunk, bool) {
+	e, ok := tr.find(h)
+	if !ok {
+		return EmptyChunk, false
+	}
+	data := tr.read(e)
+	d.PanicIfTrue(data == nil, "Chunk %s in table %s is corrupt", h, tr.name)
+	return NewChunkWithHash(h, data), true
+}
+
+// iter calls |cb| with each chunk in the table, in the order in which they were written. Chunks whose data can't be decoded are passed with nil data.
+func (tr *tableReader) iter(cb func(c Chunk)) {
+	byOffset := make(tableIndex, len(tr.index))
+	copy(byOffset, tr.index)
+	sort.Sort(tableIndexByOffset(byOffset))
+	for _, e := range byOffset {
+		cb(NewChunkWithHash(e.h, tr.read(e)))
+	}
+}
+
+func (tr *tableReader) close() {
+	tr.f.Close()
+}
@@ -0,0 +1,416 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/util/logging"
+	"github.com/stormasm/noms/go/util/progress"
+)
+
+const (
+	defaultMemTableSize = 1 << 26 // 64MiB
+	defaultMaxTables    = 64
+
+	tableManifestName  = "manifest"
+	tableManifestMagic = "nomsmanifest1"
+)
+
+/*
+Manifest:
+
+	Magic    // tableManifestMagic
+	Version  // NomsVersion of the data
+	Root     // the root hash
+	Table 0  // the name of a table file
+	 ..
+	Table N-1
+
+Each field is on its own line. The manifest is the only mutable file in a TableStore; it's always replaced atomically, while holding the manifest lock.
+*/
+type tableManifest struct {
+	vers   string
+	root   hash.Hash
+	tables []string
+}
+
+func readTableManifest(dir string) tableManifest {
+	path := filepath.Join(dir, tableManifestName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tableManifest{vers: constants.NomsVersion}
+	}
+	d.PanicIfError(err)
+	return parseTableManifest(path, data)
+}
+
+// parseTableManifest decodes the manifest |name|, whose contents are |data|.
+func parseTableManifest(name string, data []byte) tableManifest {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	d.PanicIfError(scanner.Err())
+	d.PanicIfFalse(len(lines) >= 3 && lines[0] == tableManifestMagic, "%s is not a table manifest", name)
+	return tableManifest{lines[1], hash.Parse(lines[2]), lines[3:]}
+}
+
+func (m tableManifest) bytes() []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, tableManifestMagic)
+	fmt.Fprintln(buf, m.vers)
+	fmt.Fprintln(buf, m.root.String())
+	for _, t := range m.tables {
+		fmt.Fprintln(buf, t)
+	}
+	return buf.Bytes()
+}
+
+func (m tableManifest) write(dir string) {
+	writeFileAtomically(filepath.Join(dir, tableManifestName), m.bytes())
+}
+
+// TableStore is a ChunkStore which keeps chunks in immutable, append-only table files, instead of in LevelDB. New chunks are buffered in an in-memory table, which is written out as a new table file when it fills up, or when the root is updated. The set of table files that make up the store, and its root, are recorded in a manifest, which is updated atomically under a lock file, so multiple processes can safely share a TableStore.
+//
+// Since table files never change, a consistent backup of a TableStore is simply a copy of its manifest followed by a copy of the table files it names. To keep reads fast, TableStore conjoins its tables into one in the background once there are more than a configurable number of them.
+type TableStore struct {
+	dir          string
+	memTableSize uint64
+	maxTables    int
+
+	mu         sync.RWMutex
+	mem        map[hash.Hash]Chunk
+	memSize    uint64
+	tables     []*tableReader // newest first
+	pending    map[string]bool
+	retired    []*tableReader
+	conjoining bool
+	conjoinWg  *sync.WaitGroup
+	manifestMu sync.Mutex
+}
+
+// NewTableStore returns a TableStore which keeps its files in |dir|, creating it if needed.
+func NewTableStore(dir string) *TableStore {
+	return newTableStore(dir, defaultMemTableSize, defaultMaxTables)
+}
+
+func newTableStore(dir string, memTableSize uint64, maxTables int) *TableStore {
+	d.PanicIfError(os.MkdirAll(dir, 0777))
+	ts := &TableStore{
+		dir:          dir,
+		memTableSize: memTableSize,
+		maxTables:    maxTables,
+		mem:          map[hash.Hash]Chunk{},
+		pending:      map[string]bool{},
+		conjoinWg:    &sync.WaitGroup{},
+	}
+	ts.refresh(readTableManifest(dir))
+	return ts
+}
+
+func (ts *TableStore) manifestPath() string {
+	return filepath.Join(ts.dir, tableManifestName)
+}
+
+// refresh opens any tables named in |m| that ts doesn't have open yet, and retires those that are no longer named there, e.g. because another TableStore conjoined them. Tables that ts wrote, but hasn't yet added to the manifest, are kept. Callers must hold ts.mu, or be the constructor.
+func (ts *TableStore) refresh(m tableManifest) {
+	inManifest := map[string]bool{}
+	for _, name := range m.tables {
+		inManifest[name] = true
+	}
+
+	tables := []*tableReader{}
+	open := map[string]bool{}
+	for _, tr := range ts.tables {
+		if inManifest[tr.name] || ts.pending[tr.name] {
+			tables = append(tables, tr)
+			open[tr.name] = true
+		} else {
+			ts.retired = append(ts.retired, tr)
+		}
+	}
+	for i := len(m.tables) - 1; i >= 0; i-- {
+		if name := m.tables[i]; !open[name] {
+			tables = append(tables, openTable(ts.dir, name))
+		}
+	}
+	ts.tables = tables
+}
+
+func (ts *TableStore) Get(h hash.Hash) Chunk {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if c, ok := ts.mem[h]; ok {
+		return c
+	}
+	for _, tr := range ts.tables {
+		if c, ok := tr.get(h); ok {
+			return c
+		}
+	}
+	return EmptyChunk
+}
+
+func (ts *TableStore) Has(h hash.Hash) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if _, ok := ts.mem[h]; ok {
+		return true
+	}
+	for _, tr := range ts.tables {
+		if tr.has(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *TableStore) GetMany(hashes hash.HashSlice) []Chunk {
+	return getManySerially(ts.Get, hashes)
+}
+
+func (ts *TableStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return hasManySerially(ts.Has, hashes)
+}
+
+func (ts *TableStore) Version() string {
+	return readTableManifest(ts.dir).vers
+}
+
+func (ts *TableStore) Put(c Chunk) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.mem[c.Hash()]; ok {
+		return
+	}
+	ts.mem[c.Hash()] = c
+	ts.memSize += uint64(len(c.Data()))
+	if ts.memSize >= ts.memTableSize {
+		ts.flushMemTable()
+	}
+}
+
+func (ts *TableStore) PutMany(chunks []Chunk) (e BackpressureError) {
+	for _, c := range chunks {
+		ts.Put(c)
+	}
+	return
+}
+
+// flushMemTable writes the in-memory table out as a new table file. The new table isn't part of the store until it's added to the manifest, by UpdateRoot() or Close(). Callers must hold ts.mu.
+func (ts *TableStore) flushMemTable() {
+	if len(ts.mem) == 0 {
+		return
+	}
+	tw := newTableWriter(ts.dir)
+	for _, c := range ts.mem {
+		tw.add(c)
+	}
+	name := tw.finish()
+	logging.Debug("wrote table", logging.F("table", name), logging.F("chunks", len(ts.mem)), logging.F("bytes", ts.memSize))
+	ts.tables = append([]*tableReader{openTable(ts.dir, name)}, ts.tables...)
+	ts.pending[name] = true
+	ts.mem = map[hash.Hash]Chunk{}
+	ts.memSize = 0
+}
+
+// lockManifest serializes access to the manifest both within this process and with other processes.
+func (ts *TableStore) lockManifest() (unlock func()) {
+	ts.manifestMu.Lock()
+	unlockFile := lockFile(ts.manifestPath())
+	return func() {
+		unlockFile()
+		ts.manifestMu.Unlock()
+	}
+}
+
+// commitPending adds the tables ts has written to |m|. Callers must hold ts.mu and the manifest lock.
+func (ts *TableStore) commitPending(m tableManifest) tableManifest {
+	for _, tr := range ts.tables {
+		if ts.pending[tr.name] {
+			m.tables = append(m.tables, tr.name)
+		}
+	}
+	ts.pending = map[string]bool{}
+	return m
+}
+
+func (ts *TableStore) Root() hash.Hash {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	m := readTableManifest(ts.dir)
+	ts.refresh(m)
+	return m.root
+}
+
+func (ts *TableStore) UpdateRoot(current, last hash.Hash) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.flushMemTable()
+
+	unlock := ts.lockManifest()
+	defer unlock()
+	m := readTableManifest(ts.dir)
+	if m.root != last {
+		logging.Debug("root changed, not updated", logging.F("dir", ts.dir), logging.F("current", current.String()), logging.F("last", last.String()))
+		ts.refresh(m)
+		return false
+	}
+
+	m = ts.commitPending(m)
+	m.root = current
+	m.vers = constants.NomsVersion
+	m.write(ts.dir)
+	ts.refresh(m)
+
+	if len(ts.tables) > ts.maxTables && !ts.conjoining {
+		ts.conjoining = true
+		ts.conjoinWg.Add(1)
+		go func() {
+			defer ts.conjoinWg.Done()
+			ts.conjoin(context.Background())
+		}()
+	}
+	return true
+}
+
+// Compact conjoins all of the tables in ts into one, waiting for any background conjoin to finish first. Chunks that haven't yet been added to the manifest aren't affected.
+func (ts *TableStore) Compact() {
+	ts.CompactContext(context.Background())
+}
+
+// CompactContext is like Compact, but reports its progress to |ctx|, in chunks copied of those in the tables, and the bytes of their data, and stops, returning ctx.Err() and leaving the tables as they were, if |ctx| is canceled.
+func (ts *TableStore) CompactContext(ctx context.Context) error {
+	ts.conjoinWg.Wait()
+	ts.mu.Lock()
+	ts.conjoining = true
+	ts.mu.Unlock()
+	return ts.conjoin(ctx)
+}
+
+// conjoin replaces the tables currently named in the manifest with a single table containing all of their chunks. If another TableStore changes the set of tables in the meantime, the new table is discarded. So is the new table if |ctx| is canceled, in which case conjoin returns ctx.Err().
+func (ts *TableStore) conjoin(ctx context.Context) error {
+	defer func() {
+		ts.mu.Lock()
+		ts.conjoining = false
+		ts.mu.Unlock()
+	}()
+
+	ts.mu.RLock()
+	sources := []*tableReader{}
+	for _, tr := range ts.tables {
+		if !ts.pending[tr.name] {
+			sources = append(sources, tr)
+		}
+	}
+	ts.mu.RUnlock()
+	if len(sources) < 2 {
+		return nil
+	}
+
+	total := 0
+	for _, tr := range sources {
+		total += len(tr.index)
+	}
+	defer logging.Slow(time.Now(), "slow conjoin", logging.F("dir", ts.dir), logging.F("tables", len(sources)), logging.F("chunks", total))
+	progress.Add(ctx, progress.Progress{TotalChunks: uint64(total)})
+	tw := newTableWriter(ts.dir)
+	for _, tr := range sources {
+		if err := ctx.Err(); err != nil {
+			tw.abort()
+			return err
+		}
+		tr.iter(func(c Chunk) {
+			if ctx.Err() != nil {
+				// iter can't be stopped, so skip the rest of the table.
+				return
+			}
+			d.PanicIfTrue(c.Data() == nil, "Chunk %s in table %s is corrupt", c.Hash(), tr.name)
+			tw.add(c)
+			progress.Add(ctx, progress.Progress{Chunks: 1, Bytes: uint64(len(c.Data()))})
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		tw.abort()
+		return err
+	}
+	name := tw.finish()
+
+	unlock := ts.lockManifest()
+	m := readTableManifest(ts.dir)
+	conjoined := map[string]bool{}
+	for _, tr := range sources {
+		conjoined[tr.name] = true
+	}
+	tables := []string{}
+	for _, t := range m.tables {
+		if conjoined[t] {
+			delete(conjoined, t)
+		} else {
+			tables = append(tables, t)
+		}
+	}
+	if len(conjoined) > 0 {
+		// Some of the sources have already been conjoined elsewhere.
+		unlock()
+		os.Remove(filepath.Join(ts.dir, name))
+		return nil
+	}
+	m.tables = append([]string{name}, tables...)
+	m.write(ts.dir)
+	unlock()
+
+	// ts.mu must never be acquired while holding the manifest lock, because UpdateRoot() acquires them in the opposite order.
+	ts.mu.Lock()
+	ts.refresh(readTableManifest(ts.dir))
+	ts.mu.Unlock()
+	for _, tr := range sources {
+		os.Remove(filepath.Join(ts.dir, tr.name))
+	}
+	logging.Info("conjoined tables", logging.F("dir", ts.dir), logging.F("table", name), logging.F("tables", len(sources)), logging.F("chunks", total))
+	return nil
+}
+
+func (ts *TableStore) IterAll(cb func(c Chunk)) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, c := range ts.mem {
+		cb(c)
+	}
+	for _, tr := range ts.tables {
+		tr.iter(cb)
+	}
+}
+
+// Close writes out any buffered chunks and adds them to the store, then releases ts's resources.
+func (ts *TableStore) Close() error {
+	ts.conjoinWg.Wait()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.flushMemTable()
+	if len(ts.pending) > 0 {
+		unlock := ts.lockManifest()
+		ts.commitPending(readTableManifest(ts.dir)).write(ts.dir)
+		unlock()
+	}
+	for _, tr := range append(ts.tables, ts.retired...) {
+		tr.close()
+	}
+	ts.tables, ts.retired = nil, nil
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/util/progress"
+)
+
+func TestTableStoreTestSuite(t *testing.T) {
+	suite.Run(t, &TableStoreTestSuite{})
+}
+
+type TableStoreTestSuite struct {
+	ChunkStoreTestSuite
+	dir string
+}
+
+func (suite *TableStoreTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir(os.TempDir(), "")
+	suite.NoError(err)
+	suite.Store = NewTableStore(suite.dir)
+}
+
+func (suite *TableStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func makeTestChunks(n int) []Chunk {
+	chunks := make([]Chunk, n)
+	for i := range chunks {
+		chunks[i] = NewChunk([]byte(fmt.Sprintf("chunk %d", i)))
+	}
+	return chunks
+}
+
+func TestTableStorePersistence(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chunks := makeTestChunks(100)
+	store := newTableStore(dir, 256, defaultMaxTables)
+	store.PutMany(chunks[:50])
+	assert.NotEmpty(store.tables, "small memtable should have been flushed")
+	assert.True(store.UpdateRoot(chunks[0].Hash(), hash.Hash{}))
+	store.PutMany(chunks[50:])
+	store.Close() // Commits the remaining chunks without changing the root.
+
+	store = NewTableStore(dir)
+	defer store.Close()
+	assert.Equal(chunks[0].Hash(), store.Root())
+	assert.Equal(constants.NomsVersion, store.Version())
+	for _, c := range chunks {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+	assert.Empty(Verify(store, nil))
+}
+
+func TestTableStoreConcurrentStores(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chunks := makeTestChunks(2)
+	s1, s2 := NewTableStore(dir), NewTableStore(dir)
+	defer s1.Close()
+	defer s2.Close()
+
+	s1.Put(chunks[0])
+	assert.True(s1.UpdateRoot(chunks[0].Hash(), hash.Hash{}))
+
+	// s2 lost the race, but then sees s1's chunks and can retry.
+	s2.Put(chunks[1])
+	assert.False(s2.UpdateRoot(chunks[1].Hash(), hash.Hash{}))
+	assert.True(s2.Has(chunks[0].Hash()))
+	assert.True(s2.UpdateRoot(chunks[1].Hash(), chunks[0].Hash()))
+
+	assert.Equal(chunks[1].Hash(), s1.Root())
+	assert.True(s1.Has(chunks[1].Hash()))
+}
+
+func TestTableStoreConjoin(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chunks := makeTestChunks(20)
+	store := newTableStore(dir, defaultMemTableSize, 4)
+	last := hash.Hash{}
+	for _, c := range chunks {
+		store.Put(c)
+		assert.True(store.UpdateRoot(c.Hash(), last))
+		last = c.Hash()
+	}
+	store.Compact()
+	assert.Len(store.tables, 1)
+	assert.Len(readTableManifest(dir).tables, 1)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 2) // The manifest and the conjoined table.
+	for _, c := range chunks {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+	store.Close()
+
+	store = NewTableStore(dir)
+	defer store.Close()
+	assert.Equal(last, store.Root())
+	assert.True(store.Has(chunks[7].Hash()))
+}
+
+func TestTableStoreCompactContext(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chunks := makeTestChunks(20)
+	store := newTableStore(dir, defaultMemTableSize, 100)
+	defer store.Close()
+	last := hash.Hash{}
+	for _, c := range chunks {
+		store.Put(c)
+		assert.True(store.UpdateRoot(c.Hash(), last))
+		last = c.Hash()
+	}
+
+	// Canceling part way through leaves the tables as they were.
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(p progress.Progress) {
+		if p.Chunks == 5 {
+			cancel()
+		}
+	}))
+	assert.Equal(context.Canceled, store.CompactContext(ctx))
+	assert.Len(store.tables, 20)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 21)
+
+	var reported progress.Progress
+	ctx = progress.WithReporter(context.Background(), progress.ReporterFunc(func(p progress.Progress) {
+		reported = p
+	}))
+	assert.NoError(store.CompactContext(ctx))
+	assert.Len(store.tables, 1)
+	assert.Equal(uint64(20), reported.Chunks)
+	assert.Equal(uint64(20), reported.TotalChunks)
+	for _, c := range chunks {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+}
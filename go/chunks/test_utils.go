@@ -41,6 +41,14 @@ func (s *TestStore) Has(h hash.Hash) bool {
 	return s.MemoryStore.Has(h)
 }
 
+func (s *TestStore) GetMany(hashes hash.HashSlice) []Chunk {
+	return getManySerially(s.Get, hashes)
+}
+
+func (s *TestStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return hasManySerially(s.Has, hashes)
+}
+
 func (s *TestStore) Put(c Chunk) {
 	s.Writes++
 	s.MemoryStore.Put(c)
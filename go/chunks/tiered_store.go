@@ -0,0 +1,135 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"sync"
+
+	"github.com/stormasm/noms/go/hash"
+)
+
+const tieredStoreFillQueueSize = 1024
+
+// TieredStore layers a local ChunkStore, typically a LevelDBStore, over a slower remote one, such as an S3Store. Gets are served from the local store when possible; chunks that have to be fetched from the remote store are returned immediately and copied into the local store in the background. Puts go to both stores. The root and version are always those of the remote store.
+//
+// Unlike ReadThroughStore, a Get that misses the local store never waits for the local write, and the background copy is best effort: if the local store falls too far behind, chunks are simply not cached.
+type TieredStore struct {
+	local  ChunkStore
+	remote ChunkStore
+	fillCh chan Chunk
+	wg     *sync.WaitGroup
+}
+
+// NewTieredStore returns a TieredStore caching |remote| in |local|. It takes ownership of both stores, and closes them when it's closed.
+func NewTieredStore(local, remote ChunkStore) *TieredStore {
+	ts := &TieredStore{local, remote, make(chan Chunk, tieredStoreFillQueueSize), &sync.WaitGroup{}}
+	ts.wg.Add(1)
+	go func() {
+		defer ts.wg.Done()
+		for c := range ts.fillCh {
+			ts.local.Put(c)
+		}
+	}()
+	return ts
+}
+
+func (ts *TieredStore) Get(h hash.Hash) Chunk {
+	if c := ts.local.Get(h); !c.IsEmpty() {
+		return c
+	}
+	c := ts.remote.Get(h)
+	if !c.IsEmpty() {
+		select {
+		case ts.fillCh <- c:
+		default:
+		}
+	}
+	return c
+}
+
+func (ts *TieredStore) Has(h hash.Hash) bool {
+	return ts.local.Has(h) || ts.remote.Has(h)
+}
+
+// GetMany fetches whichever chunks are missing from the local store from the remote store in a single GetMany().
+func (ts *TieredStore) GetMany(hashes hash.HashSlice) []Chunk {
+	found := ts.local.GetMany(hashes)
+	misses := hash.HashSlice{}
+	for i, c := range found {
+		if c.IsEmpty() {
+			misses = append(misses, hashes[i])
+		}
+	}
+	if len(misses) == 0 {
+		return found
+	}
+
+	fetched := ts.remote.GetMany(misses)
+	for i, j := 0, 0; i < len(found); i++ {
+		if !found[i].IsEmpty() {
+			continue
+		}
+		found[i] = fetched[j]
+		j++
+		if !found[i].IsEmpty() {
+			select {
+			case ts.fillCh <- found[i]:
+			default:
+			}
+		}
+	}
+	return found
+}
+
+func (ts *TieredStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return ts.remote.HasMany(ts.local.HasMany(hashes))
+}
+
+func (ts *TieredStore) Put(c Chunk) {
+	ts.remote.Put(c)
+	ts.local.Put(c)
+}
+
+// PutMany writes |chunks| to the remote store, and those that the remote store accepted to the local store.
+func (ts *TieredStore) PutMany(chunks []Chunk) BackpressureError {
+	bpe := ts.remote.PutMany(chunks)
+	if len(bpe) == 0 {
+		ts.local.PutMany(chunks)
+		return nil
+	}
+
+	rejected := make(map[hash.Hash]bool, len(bpe))
+	for _, h := range bpe {
+		rejected[h] = true
+	}
+	accepted := make([]Chunk, 0, len(chunks)-len(bpe))
+	for _, c := range chunks {
+		if !rejected[c.Hash()] {
+			accepted = append(accepted, c)
+		}
+	}
+	ts.local.PutMany(accepted)
+	return bpe
+}
+
+func (ts *TieredStore) Root() hash.Hash {
+	return ts.remote.Root()
+}
+
+func (ts *TieredStore) UpdateRoot(current, last hash.Hash) bool {
+	return ts.remote.UpdateRoot(current, last)
+}
+
+func (ts *TieredStore) Version() string {
+	return ts.remote.Version()
+}
+
+// Close waits for any background copies into the local store to finish, then closes both stores.
+func (ts *TieredStore) Close() error {
+	close(ts.fillCh)
+	ts.wg.Wait()
+	ts.local.Close()
+	return ts.remote.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestTieredStoreTestSuite(t *testing.T) {
+	suite.Run(t, &TieredStoreTestSuite{})
+}
+
+type TieredStoreTestSuite struct {
+	ChunkStoreTestSuite
+}
+
+func (suite *TieredStoreTestSuite) SetupTest() {
+	suite.Store = NewTieredStore(NewMemoryStore(), NewTestStore())
+}
+
+func (suite *TieredStoreTestSuite) TearDownTest() {
+	suite.Store.Close()
+}
+
+func TestTieredStoreGet(t *testing.T) {
+	assert := assert.New(t)
+	local, remote := NewMemoryStore(), NewTestStore()
+
+	c := NewChunk([]byte("abc"))
+	remote.Put(c)
+	ts := NewTieredStore(local, remote)
+
+	// The first Get misses the local store, so it's served by the remote store.
+	assertInputInStore("abc", c.Hash(), ts, assert)
+	assert.Equal(1, remote.Reads)
+
+	// Once the background copy is done, the chunk is served locally.
+	ts.Close()
+	assert.True(local.Has(c.Hash()))
+	ts = NewTieredStore(local, remote)
+	defer ts.Close()
+	assertInputInStore("abc", c.Hash(), ts, assert)
+	assert.Equal(1, remote.Reads)
+
+	// Puts go to both stores.
+	c2 := NewChunk([]byte("def"))
+	ts.Put(c2)
+	assert.True(local.Has(c2.Hash()))
+	assert.True(remote.Has(c2.Hash()))
+}
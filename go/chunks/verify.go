@@ -0,0 +1,47 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// verifyProgressInterval is the number of chunks scanned between calls to Verify's progress callback.
+const verifyProgressInterval = 1000
+
+// Verify re-hashes every chunk in |store|, which must implement ChunkIterator, and returns the hashes of those whose data doesn't match the hash under which they're stored. If |progress| is non-nil, it's called periodically with the number of chunks scanned and found to be corrupt so far, and once more when the scan is complete.
+func Verify(store ChunkStore, progress func(scanned, corrupt int)) (corrupt hash.HashSlice) {
+	iter, ok := store.(ChunkIterator)
+	d.PanicIfFalse(ok, "%T can't enumerate its chunks, so can't be verified", store)
+
+	scanned := 0
+	iter.IterAll(func(c Chunk) {
+		if c.Data() == nil || hash.FromData(c.Data()) != c.Hash() {
+			corrupt = append(corrupt, c.Hash())
+		}
+		scanned++
+		if progress != nil && scanned%verifyProgressInterval == 0 {
+			progress(scanned, len(corrupt))
+		}
+	})
+	if progress != nil {
+		progress(scanned, len(corrupt))
+	}
+	return
+}
+
+// Repair overwrites the chunks in |store| named by |hashes|, typically the result of Verify(), with good copies from |source|. It returns the hashes of the chunks for which |source| had no good copy.
+func Repair(store ChunkStore, source ChunkSource, hashes hash.HashSlice) (unrepaired hash.HashSlice) {
+	for _, h := range hashes {
+		c := source.Get(h)
+		if c.IsEmpty() || hash.FromData(c.Data()) != h {
+			unrepaired = append(unrepaired, h)
+			continue
+		}
+		store.Put(c)
+	}
+	return
+}
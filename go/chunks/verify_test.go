@@ -0,0 +1,67 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package chunks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/hash"
+)
+
+func TestVerifyAndRepair(t *testing.T) {
+	assert := assert.New(t)
+	store, backup := NewMemoryStore(), NewMemoryStore()
+
+	var good []Chunk
+	for i := 0; i < 2500; i++ {
+		c := NewChunk([]byte(fmt.Sprintf("chunk %d", i)))
+		store.Put(c)
+		good = append(good, c)
+	}
+	backup.Put(good[7])
+
+	// Flip the data under two hashes.
+	store.Put(NewChunkWithHash(good[7].Hash(), []byte("bit rot")))
+	store.Put(NewChunkWithHash(good[42].Hash(), []byte("more bit rot")))
+
+	calls, lastScanned := 0, 0
+	corrupt := Verify(store, func(scanned, corrupt int) {
+		calls++
+		lastScanned = scanned
+	})
+	assert.Equal(3, calls)
+	assert.Equal(2500, lastScanned)
+	assert.Len(corrupt, 2)
+	assert.Contains(corrupt, good[7].Hash())
+	assert.Contains(corrupt, good[42].Hash())
+
+	unrepaired := Repair(store, backup, corrupt)
+	assert.Equal(hash.HashSlice{good[42].Hash()}, unrepaired)
+	assert.Equal(good[7].Data(), store.Get(good[7].Hash()).Data())
+	assert.Len(Verify(store, nil), 1)
+
+	assert.Panics(func() { Verify(NewTieredStore(NewMemoryStore(), NewMemoryStore()), nil) })
+}
+
+func TestVerifyLevelDBStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLevelDBStore(dir, "ns", 24, false)
+	defer store.Close()
+	c1, c2 := NewChunk([]byte("abc")), NewChunk([]byte("def"))
+	store.PutMany([]Chunk{c1, c2})
+	assert.Empty(Verify(store, nil))
+
+	// Data that can't be decompressed is corrupt too.
+	assert.NoError(store.db.Put(store.toChunkKey(c2.Hash()), []byte("not snappy"), nil))
+	assert.Equal(hash.HashSlice{c2.Hash()}, Verify(store, nil))
+}
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"sort"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/stormasm/noms/go/spec"
 	"github.com/BurntSushi/toml"
@@ -19,7 +23,87 @@ type Config struct {
 }
 
 type DbConfig struct {
+	// Url is the alias's database spec. It may instead be a dataset spec, making the alias a workspace: paths relative to the alias, like "alias::.value", resolve against its dataset.
 	Url string
+	// Urls, if given instead of Url, is an ordered list of specs for the same database, e.g. a primary and its replicas. The Resolver probes them in turn, waiting up to ProbeTimeout (default DefaultProbeTimeout) for each, and uses the first that's reachable.
+	Urls         []string
+	ProbeTimeout string `toml:"probe_timeout"`
+	// Options are spec parameters, e.g. block_cache = "1GiB" for an ldb database, which are added to Url when it's resolved. They're kept separately so that tuning a database doesn't mean editing its spec.
+	Options map[string]string
+	// AuthToken, AWSProfile, KeyFile and AccessFile are the alias's spec.Credentials, which the Resolver gives to specs that use the alias. A relative KeyFile or AccessFile is relative to the config file.
+	AuthToken  string `toml:"auth_token"`
+	AWSProfile string `toml:"aws_profile"`
+	KeyFile    string `toml:"key_file"`
+	AccessFile string `toml:"access_file"`
+}
+
+// DefaultProbeTimeout is how long the Resolver waits for each of an alias's Urls to respond, unless the alias sets ProbeTimeout.
+const DefaultProbeTimeout = 2 * time.Second
+
+// Credentials returns dc's credentials.
+func (dc DbConfig) Credentials() spec.Credentials {
+	return spec.Credentials{AuthToken: dc.AuthToken, AWSProfile: dc.AWSProfile, KeyFile: dc.KeyFile, AccessFile: dc.AccessFile}
+}
+
+// urls returns dc's Urls, or just its Url if it only has one.
+func (dc DbConfig) urls() []string {
+	if len(dc.Urls) > 0 {
+		return dc.Urls
+	}
+	return []string{dc.Url}
+}
+
+// splitUrl returns the database spec and, if |u| is a dataset spec, the dataset name in it.
+func splitUrl(u string) (dbUrl, dataset string) {
+	split := strings.SplitN(u, spec.Separator, 2)
+	if len(split) == 1 {
+		return split[0], ""
+	}
+	return split[0], split[1]
+}
+
+// Dataset returns the name of dc's dataset if it's a workspace, or "" if it's just a database. If dc has several Urls, the dataset is taken from the first.
+func (dc DbConfig) Dataset() string {
+	_, dataset := splitUrl(dc.urls()[0])
+	return dataset
+}
+
+// Spec returns the database spec for dc, with its Options added to the query of its Url. If dc has several Urls, it's the first of Specs().
+func (dc DbConfig) Spec() string {
+	return dc.Specs()[0]
+}
+
+// Specs returns the database spec for each of dc's Urls, with its Options added.
+func (dc DbConfig) Specs() []string {
+	params := url.Values{}
+	for k, v := range dc.Options {
+		params.Set(k, v)
+	}
+	specs := []string{}
+	for _, u := range dc.urls() {
+		dbUrl, _ := splitUrl(u)
+		if len(params) > 0 {
+			sep := "?"
+			if strings.Contains(dbUrl, "?") {
+				sep = "&"
+			}
+			dbUrl += sep + params.Encode()
+		}
+		specs = append(specs, dbUrl)
+	}
+	return specs
+}
+
+// probeTimeout returns dc's ProbeTimeout, or DefaultProbeTimeout if it isn't set.
+func (dc DbConfig) probeTimeout() (time.Duration, error) {
+	if dc.ProbeTimeout == "" {
+		return DefaultProbeTimeout, nil
+	}
+	timeout, err := time.ParseDuration(dc.ProbeTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("Invalid probe_timeout %s", dc.ProbeTimeout)
+	}
+	return timeout, nil
 }
 
 const (
@@ -29,52 +113,215 @@ const (
 
 var NoConfig = errors.New(fmt.Sprintf("no %s found", NomsConfigFile))
 
+// SystemConfigFile is the system-wide config file, which has the lowest precedence of the files FindNomsConfig() reads.
+var SystemConfigFile = "/etc/nomsconfig"
+
 // Find the closest directory containing .nomsconfig starting
 // in cwd and then searching up ancestor tree.
 // Look first looking in cwd and then up through its ancestors
+//
+// The config found is merged with the user's, $HOME/.nomsconfig, and then
+// with the system-wide SystemConfigFile, where they exist. An alias defined
+// in more than one of them is taken entirely from the first, so a project
+// can override the user's default database, say. File is set to the first
+// of them that exists.
 func FindNomsConfig() (*Config, error) {
-	curDir, err := os.Getwd()
+	files, err := configFiles()
 	if err != nil {
 		return nil, err
 	}
+	if len(files) == 0 {
+		return nil, NoConfig
+	}
+	var merged *Config
+	for _, file := range files {
+		c, err := ReadConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = c
+			continue
+		}
+		for k, r := range c.Db {
+			if _, ok := merged.Db[k]; !ok {
+				merged.Db[k] = r
+			}
+		}
+	}
+	return merged, nil
+}
+
+// configFiles returns the config files that exist, in order of precedence: the closest .nomsconfig, the user's and the system-wide one. The user's is only included once, if it's also the closest.
+func configFiles() ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	add := func(file string) error {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, abs)
+		}
+		return nil
+	}
+
+	nearest, err := FindNomsConfigFile()
+	if err == nil {
+		err = add(nearest)
+	}
+	if err != nil && err != NoConfig {
+		return nil, err
+	}
+	candidates := []string{SystemConfigFile}
+	if home := os.Getenv("HOME"); home != "" {
+		candidates = []string{filepath.Join(home, NomsConfigFile), SystemConfigFile}
+	}
+	for _, file := range candidates {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+			continue
+		}
+		if err == nil {
+			err = add(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// FindNomsConfigFile returns the path of the .nomsconfig file that FindNomsConfig() would read, or NoConfig if there isn't one.
+func FindNomsConfigFile() (string, error) {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
 	for {
 		nomsConfig := filepath.Join(curDir, NomsConfigFile)
 		info, err := os.Stat(nomsConfig)
 		if err == nil && !info.IsDir() {
 			// found
-			return ReadConfig(nomsConfig)
+			return nomsConfig, nil
 		} else if err != nil && !os.IsNotExist(err) {
 			// can't read
-			return nil, err
+			return "", err
 		}
 		nextDir := filepath.Dir(curDir)
 		if nextDir == curDir {
 			// stop at root
-			return nil, NoConfig
+			return "", NoConfig
 		}
 		curDir = nextDir
 	}
 }
 
+// ReadConfig reads the config file |name| and any files it includes.
 func ReadConfig(name string) (*Config, error) {
+	return readConfig(name, map[string]bool{})
+}
+
+// readConfig reads |name| and its includes, where |reading| holds the files being read higher up the chain of includes, to catch cycles.
+func readConfig(name string, reading map[string]bool) (*Config, error) {
+	file, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	if reading[file] {
+		return nil, fmt.Errorf("%s includes itself", file)
+	}
+	reading[file] = true
+	defer delete(reading, file)
+
 	data, err := ioutil.ReadFile(name)
 	if err != nil {
 		return nil, err
 	}
-	c, err := NewConfig(string(data))
+	c, includes, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	qc, err := qualifyPaths(name, c)
 	if err != nil {
 		return nil, err
 	}
-	c.File = name
-	return qualifyPaths(name, c)
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(file), inc)
+		}
+		ic, err := readConfig(inc, reading)
+		if err != nil {
+			return nil, err
+		}
+		for k, r := range ic.Db {
+			if _, ok := qc.Db[k]; !ok {
+				qc.Db[k] = r
+			}
+		}
+	}
+	return qc, nil
 }
 
+// NewConfig parses the config in |data|, expanding references to environment variables. Includes are ignored, since there's no file for them to be relative to; use ReadConfig() to follow them.
 func NewConfig(data string) (*Config, error) {
-	c := new(Config)
-	if _, err := toml.Decode(data, c); err != nil {
-		return nil, err
+	c, _, err := parseConfig(data)
+	return c, err
+}
+
+func parseConfig(data string) (*Config, []string, error) {
+	cf := ConfigFile{}
+	if _, err := toml.Decode(data, &cf); err != nil {
+		return nil, nil, err
+	}
+	c := &Config{Db: map[string]DbConfig{}}
+	for k, r := range cf.Db {
+		var err error
+		fields := []*string{&r.Url, &r.ProbeTimeout, &r.AuthToken, &r.AWSProfile, &r.KeyFile, &r.AccessFile}
+		for i := range r.Urls {
+			fields = append(fields, &r.Urls[i])
+		}
+		for _, f := range fields {
+			if *f, err = expandEnv(*f); err != nil {
+				return nil, nil, fmt.Errorf("db.%s: %s", k, err)
+			}
+		}
+		if _, err = r.probeTimeout(); err != nil {
+			return nil, nil, fmt.Errorf("db.%s: %s", k, err)
+		}
+		for opt, v := range r.Options {
+			if r.Options[opt], err = expandEnv(v); err != nil {
+				return nil, nil, fmt.Errorf("db.%s.options: %s", k, err)
+			}
+		}
+		c.Db[k] = r
+	}
+	includes := make([]string, len(cf.Include))
+	for i, inc := range cf.Include {
+		var err error
+		if includes[i], err = expandEnv(inc); err != nil {
+			return nil, nil, fmt.Errorf("include: %s", err)
+		}
 	}
-	return c, nil
+	return c, includes, nil
+}
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces each ${VAR} in |s| with the value of the environment variable VAR, which must be set, though it may be empty. Other uses of $ are left alone, since they're common in tokens and paths.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVarPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envVarPattern.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return val
+	})
+	return expanded, err
 }
 
 func (c *Config) WriteTo(configHome string) (string, error) {
@@ -98,11 +345,21 @@ func absDbSpec(configHome string, url string) string {
 	if dbSpec.Protocol != "ldb" {
 		return url
 	}
-	path := dbSpec.Path
-	if !strings.HasPrefix(path, "/") {
-		path = filepath.Join(configHome, path)
+	if !strings.HasPrefix(dbSpec.Path, "/") {
+		dbSpec.Path = filepath.Join(configHome, dbSpec.Path)
 	}
-	return "ldb:" + path
+	return dbSpec.String()
+}
+
+// qualifyUrl qualifies the database spec in |u|, which may be a dataset spec, like absDbSpec.
+func qualifyUrl(configHome string, u string) string {
+	if u == "" {
+		return u
+	}
+	if dbUrl, dataset := splitUrl(u); dataset != "" {
+		return absDbSpec(configHome, dbUrl) + spec.Separator + dataset
+	}
+	return absDbSpec(configHome, u)
 }
 
 func qualifyPaths(configPath string, c *Config) (*Config, error) {
@@ -114,7 +371,20 @@ func qualifyPaths(configPath string, c *Config) (*Config, error) {
 	qc := *c
 	qc.File = file
 	for k, r := range c.Db {
-		qc.Db[k] = DbConfig{ absDbSpec(dir, r.Url) }
+		r.Url = qualifyUrl(dir, r.Url)
+		urls := make([]string, len(r.Urls))
+		for i, u := range r.Urls {
+			urls[i] = qualifyUrl(dir, u)
+		}
+		if len(urls) > 0 {
+			r.Urls = urls
+		}
+		for _, f := range []*string{&r.KeyFile, &r.AccessFile} {
+			if *f != "" && !filepath.IsAbs(*f) {
+				*f = filepath.Join(dir, *f)
+			}
+		}
+		qc.Db[k] = r
 	}
 	return &qc, nil
 }
@@ -130,9 +400,50 @@ func (c *Config) String() string {
 
 func (c *Config) writeableString() string {
 	var buffer bytes.Buffer
-	for k, r := range c.Db {
+	writeDbs(&buffer, c.Db)
+	return buffer.String()
+}
+
+// writeDbs writes the [db.*] tables for |dbs|, sorted by alias so that rewriting a file doesn't reorder it.
+func writeDbs(buffer *bytes.Buffer, dbs map[string]DbConfig) {
+	aliases := []string{}
+	for k := range dbs {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+	for _, k := range aliases {
+		r := dbs[k]
 		buffer.WriteString(fmt.Sprintf("[db.%s]\n", k))
-		buffer.WriteString(fmt.Sprintf("\t" + `url = "%s"`+"\n", r.Url))
+		if r.Url != "" || len(r.Urls) == 0 {
+			buffer.WriteString(fmt.Sprintf("\t" + `url = "%s"`+"\n", r.Url))
+		}
+		if len(r.Urls) > 0 {
+			buffer.WriteString(fmt.Sprintf("\turls = %s\n", tomlStrings(r.Urls)))
+		}
+		for _, kv := range [][2]string{{"probe_timeout", r.ProbeTimeout}, {"auth_token", r.AuthToken}, {"aws_profile", r.AWSProfile}, {"key_file", r.KeyFile}, {"access_file", r.AccessFile}} {
+			if kv[1] != "" {
+				buffer.WriteString(fmt.Sprintf("\t%s = %q\n", kv[0], kv[1]))
+			}
+		}
+		if len(r.Options) > 0 {
+			buffer.WriteString(fmt.Sprintf("[db.%s.options]\n", k))
+			keys := []string{}
+			for opt := range r.Options {
+				keys = append(keys, opt)
+			}
+			sort.Strings(keys)
+			for _, opt := range keys {
+				buffer.WriteString(fmt.Sprintf("\t%s = %q\n", opt, r.Options[opt]))
+			}
+		}
 	}
-	return buffer.String()
+}
+
+// tomlStrings returns |strs| as a TOML array.
+func tomlStrings(strs []string) string {
+	quoted := make([]string, len(strs))
+	for i, str := range strs {
+		quoted[i] = fmt.Sprintf("%q", str)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
 }
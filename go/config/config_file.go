@@ -0,0 +1,234 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stormasm/noms/go/spec"
+)
+
+// ConfigFile is the contents of a single config file as written, before environment variables are expanded, relative paths qualified and includes followed, so that it can be edited and saved without baking any of those in. Include lists other config files, relative to this one, whose databases are added to this one's; an alias defined here overrides the same alias in an included file.
+type ConfigFile struct {
+	Path    string `toml:"-"`
+	Include []string
+	Db      map[string]DbConfig
+}
+
+// LoadConfigFile reads the config file at |path| for editing. If there's no such file, the ConfigFile is empty, and Save() creates it.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	cf := &ConfigFile{Path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		cf.Db = map[string]DbConfig{}
+		return cf, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(string(data), cf); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if cf.Db == nil {
+		cf.Db = map[string]DbConfig{}
+	}
+	return cf, nil
+}
+
+// Save writes cf back to its file. Comments in the file aren't preserved.
+func (cf *ConfigFile) Save() error {
+	return ioutil.WriteFile(cf.Path, []byte(cf.String()), 0644)
+}
+
+func (cf *ConfigFile) String() string {
+	var buffer bytes.Buffer
+	if len(cf.Include) > 0 {
+		buffer.WriteString(fmt.Sprintf("include = %s\n", tomlStrings(cf.Include)))
+	}
+	writeDbs(&buffer, cf.Db)
+	return buffer.String()
+}
+
+// Aliases returns the aliases defined in cf, sorted.
+func (cf *ConfigFile) Aliases() []string {
+	aliases := []string{}
+	for k := range cf.Db {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Keys returns the keys that are set in cf, ordered by alias.
+func (cf *ConfigFile) Keys() []string {
+	keys := []string{}
+	for _, alias := range cf.Aliases() {
+		dc := cf.Db[alias]
+		for _, name := range fieldNames {
+			if val, _ := cf.Get(fmt.Sprintf("db.%s.%s", alias, name)); val != "" {
+				keys = append(keys, fmt.Sprintf("db.%s.%s", alias, name))
+			}
+		}
+		opts := []string{}
+		for opt := range dc.Options {
+			opts = append(opts, opt)
+		}
+		sort.Strings(opts)
+		for _, opt := range opts {
+			keys = append(keys, fmt.Sprintf("db.%s.options.%s", alias, opt))
+		}
+	}
+	return keys
+}
+
+// AddAlias defines |alias| as the database or workspace |url|. It's an error if the alias is already defined.
+func (cf *ConfigFile) AddAlias(alias, url string) error {
+	if _, ok := cf.Db[alias]; ok {
+		return fmt.Errorf("Alias %s already exists", alias)
+	}
+	return cf.Set("db."+alias+".url", url)
+}
+
+// RemoveAlias removes the definition of |alias|, which must exist.
+func (cf *ConfigFile) RemoveAlias(alias string) error {
+	if _, ok := cf.Db[alias]; !ok {
+		return fmt.Errorf("No alias %s", alias)
+	}
+	delete(cf.Db, alias)
+	return nil
+}
+
+// fieldNames are the names of the fields of a DbConfig, other than its options, in keys.
+var fieldNames = []string{"url", "urls", "probe_timeout", "auth_token", "aws_profile", "key_file", "access_file"}
+
+// field returns a pointer to the field of |dc| named by the last part of a key, or nil if there's no such field. Urls and Options are handled separately.
+func field(dc *DbConfig, name string) *string {
+	switch name {
+	case "url":
+		return &dc.Url
+	case "probe_timeout":
+		return &dc.ProbeTimeout
+	case "auth_token":
+		return &dc.AuthToken
+	case "aws_profile":
+		return &dc.AWSProfile
+	case "key_file":
+		return &dc.KeyFile
+	case "access_file":
+		return &dc.AccessFile
+	}
+	return nil
+}
+
+// parseKey splits a key like "db.origin.url" or "db.origin.options.block_cache" into the alias, the field and, for options, the option's name.
+func parseKey(key string) (alias, name, opt string, err error) {
+	parts := strings.Split(key, ".")
+	if len(parts) == 3 && parts[0] == "db" && (parts[2] == "urls" || field(&DbConfig{}, parts[2]) != nil) {
+		return parts[1], parts[2], "", nil
+	}
+	if len(parts) == 4 && parts[0] == "db" && parts[2] == "options" {
+		return parts[1], parts[2], parts[3], nil
+	}
+	return "", "", "", fmt.Errorf("Invalid key %s; keys are db.<alias>.<field>, where field is one of %s, or db.<alias>.options.<option>", key, strings.Join(fieldNames, ", "))
+}
+
+// Get returns the value of |key|, e.g. "db.origin.url", as written in the file. Urls are separated by commas. It's an error if the value isn't set.
+func (cf *ConfigFile) Get(key string) (string, error) {
+	alias, name, opt, err := parseKey(key)
+	if err != nil {
+		return "", err
+	}
+	dc, ok := cf.Db[alias]
+	if !ok {
+		return "", fmt.Errorf("No alias %s", alias)
+	}
+	val := ""
+	if opt != "" {
+		val = dc.Options[opt]
+	} else if name == "urls" {
+		val = strings.Join(dc.Urls, ",")
+	} else {
+		val = *field(&dc, name)
+	}
+	if val == "" {
+		return "", fmt.Errorf("%s is not set", key)
+	}
+	return val, nil
+}
+
+// Set sets |key| to |val|, or clears it if |val| is "". Urls are separated by commas. Setting the url or urls of an alias that doesn't exist adds it; other keys require the alias to exist. An alias must keep either a url or urls, which are checked to be valid specs, unless they refer to environment variables.
+func (cf *ConfigFile) Set(key, val string) error {
+	alias, name, opt, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	dc, ok := cf.Db[alias]
+	if !ok && name != "url" && name != "urls" {
+		return fmt.Errorf("No alias %s", alias)
+	}
+	switch {
+	case opt != "":
+		options := map[string]string{}
+		for k, v := range dc.Options {
+			options[k] = v
+		}
+		if val == "" {
+			delete(options, opt)
+		} else {
+			options[opt] = val
+		}
+		dc.Options = options
+	case name == "url":
+		if val != "" || len(dc.Urls) == 0 {
+			if err := checkUrl(val); err != nil {
+				return err
+			}
+		}
+		dc.Url = val
+	case name == "urls":
+		urls := []string{}
+		if val != "" {
+			urls = strings.Split(val, ",")
+		} else if dc.Url == "" {
+			return fmt.Errorf("An alias needs a url or urls; remove the alias instead")
+		}
+		for _, u := range urls {
+			if err := checkUrl(u); err != nil {
+				return err
+			}
+		}
+		dc.Urls = urls
+	case name == "probe_timeout" && val != "":
+		dc.ProbeTimeout = val
+		if _, err := dc.probeTimeout(); err != nil {
+			return err
+		}
+	default:
+		*field(&dc, name) = val
+	}
+	cf.Db[alias] = dc
+	return nil
+}
+
+// checkUrl returns an error if |url| isn't a valid database or dataset spec.
+func checkUrl(url string) error {
+	if url == "" {
+		return fmt.Errorf("An alias needs a url or urls; remove the alias instead")
+	}
+	if envVarPattern.MatchString(url) {
+		return nil
+	}
+	if strings.Contains(url, spec.Separator) {
+		_, err := spec.ParseDatasetSpec(url)
+		return err
+	}
+	_, err := spec.ParseDatabaseSpec(url)
+	return err
+}
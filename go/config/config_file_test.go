@@ -0,0 +1,63 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestConfigFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(ctestRoot, "config-file")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, NomsConfigFile)
+
+	cf, err := LoadConfigFile(path)
+	assert.NoError(err)
+	assert.Empty(cf.Keys())
+	cf.Include = []string{"${TEAM_DIR}/shared.toml"}
+	assert.NoError(cf.AddAlias(DefaultDbAlias, "ldb:./local"))
+	assert.Error(cf.AddAlias(DefaultDbAlias, "mem"))
+	assert.NoError(cf.Set("db.work.url", "mem::ds"))
+	assert.NoError(cf.Set("db.work.options.mode", "ro"))
+	assert.Error(cf.Set("db.nope.auth_token", "x"))
+	assert.Error(cf.Set("db.work.bogus", "x"))
+	assert.Error(cf.Set("db.work.url", ""))
+	assert.NoError(cf.Save())
+
+	cf, err = LoadConfigFile(path)
+	assert.NoError(err)
+	assert.Equal([]string{"${TEAM_DIR}/shared.toml"}, cf.Include)
+	assert.Equal([]string{"db.default.url", "db.work.url", "db.work.options.mode"}, cf.Keys())
+	val, err := cf.Get("db.default.url")
+	assert.NoError(err)
+	assert.Equal("ldb:./local", val)
+	_, err = cf.Get("db.default.key_file")
+	assert.Error(err)
+
+	assert.NoError(cf.Set("db.work.urls", "mem::ds,ldb:./replica::ds"))
+	assert.NoError(cf.Set("db.work.url", ""))
+	assert.Error(cf.Set("db.work.urls", ""))
+	assert.Error(cf.Set("db.work.probe_timeout", "soon"))
+	assert.NoError(cf.Set("db.work.probe_timeout", "500ms"))
+	val, err = cf.Get("db.work.urls")
+	assert.NoError(err)
+	assert.Equal("mem::ds,ldb:./replica::ds", val)
+	assert.Equal([]string{"db.default.url", "db.work.urls", "db.work.probe_timeout", "db.work.options.mode"}, cf.Keys())
+	assert.NoError(cf.Set("db.work.url", "mem::ds"))
+	assert.NoError(cf.Set("db.work.urls", ""))
+	assert.NoError(cf.Set("db.work.probe_timeout", ""))
+
+	assert.NoError(cf.Set("db.work.options.mode", ""))
+	assert.NoError(cf.RemoveAlias(DefaultDbAlias))
+	assert.Error(cf.RemoveAlias(DefaultDbAlias))
+	assert.Equal([]string{"db.work.url"}, cf.Keys())
+}
@@ -25,32 +25,32 @@ var (
 	ldbConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: { ldbSpec },
-			remoteAlias: { httpSpec },
+			DefaultDbAlias: { Url: ldbSpec },
+			remoteAlias: { Url: httpSpec },
 		},
 	}
 
 	httpConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: { httpSpec },
-			remoteAlias: { ldbSpec },
+			DefaultDbAlias: { Url: httpSpec },
+			remoteAlias: { Url: ldbSpec },
 		},
 	}
 
 	memConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: { memSpec },
-			remoteAlias: { httpSpec },
+			DefaultDbAlias: { Url: memSpec },
+			remoteAlias: { Url: httpSpec },
 		},
 	}
 
 	ldbAbsConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: { ldbAbsSpec },
-			remoteAlias: { httpSpec },
+			DefaultDbAlias: { Url: ldbAbsSpec },
+			remoteAlias: { Url: httpSpec },
 		},
 	}
 )
@@ -196,3 +196,121 @@ func TestCwd(t *testing.T) {
 
 	assert.Equal(cwd, abs)
 }
+
+func TestConfigOptions(t *testing.T) {
+	assert := assert.New(t)
+	path := getPaths(assert, "home.options")
+	c := &Config{
+		"",
+		map[string]DbConfig{
+			DefaultDbAlias: {Url: ldbSpec + "?mode=ro", Options: map[string]string{"block_cache": "1GiB", "write_buffer": "64MB"}},
+		},
+	}
+	writeConfig(assert, c, path.home)
+	assert.NoError(os.Chdir(path.home))
+	ac, err := FindNomsConfig()
+	assert.NoError(err)
+	dc := ac.Db[DefaultDbAlias]
+	assert.Equal(c.Db[DefaultDbAlias].Options, dc.Options)
+
+	// Relative paths are still qualified, keeping the spec's parameters.
+	sp, err := spec.ParseDatabaseSpec(dc.Spec())
+	assert.NoError(err)
+	assert.Equal(filepath.Join(path.home, "local"), sp.Path)
+	assert.True(sp.ReadOnly)
+	assert.Equal(1<<30, sp.LevelDBOptions.BlockCacheSize)
+	assert.Equal(64000000, sp.LevelDBOptions.WriteBuffer)
+
+	r := NewResolver()
+	assert.Equal(dc.Spec(), r.ResolveDbSpec(""))
+}
+
+func TestConfigEnvAndIncludes(t *testing.T) {
+	assert := assert.New(t)
+	path := getPaths(assert, "home.include")
+	team := filepath.Join(path.home, "team")
+	assert.NoError(os.MkdirAll(team, os.ModePerm))
+	os.Setenv("NOMS_TEST_HOST", "test.com:8080")
+	os.Setenv("NOMS_TEST_TOKEN", "s3cret")
+	defer os.Unsetenv("NOMS_TEST_HOST")
+	defer os.Unsetenv("NOMS_TEST_TOKEN")
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(team, "shared.toml"), []byte(`
+[db.origin]
+	url = "http://${NOMS_TEST_HOST}/foo"
+	auth_token = "${NOMS_TEST_TOKEN}"
+[db.default]
+	url = "ldb:./shared"
+`), os.ModePerm))
+	assert.NoError(ioutil.WriteFile(path.config, []byte(`
+include = ["team/shared.toml"]
+[db.default]
+	url = "ldb:./local"
+`), os.ModePerm))
+	assert.NoError(os.Chdir(path.home))
+	c, err := FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal("http://test.com:8080/foo", c.Db[remoteAlias].Url)
+	assert.Equal("s3cret", c.Db[remoteAlias].AuthToken)
+	// The including file wins, and relative paths are relative to the file they're in.
+	assert.Equal("ldb:"+filepath.Join(path.home, "local"), c.Db[DefaultDbAlias].Url)
+
+	// Unset variables are errors, rather than silently becoming empty.
+	os.Unsetenv("NOMS_TEST_HOST")
+	_, err = FindNomsConfig()
+	assert.Error(err)
+	assert.Contains(err.Error(), "NOMS_TEST_HOST")
+
+	// So are cycles.
+	assert.NoError(ioutil.WriteFile(filepath.Join(team, "shared.toml"), []byte(`include = ["../.nomsconfig"]`), os.ModePerm))
+	_, err = FindNomsConfig()
+	assert.Error(err)
+	assert.Contains(err.Error(), "includes itself")
+}
+
+func TestHierarchicalConfig(t *testing.T) {
+	assert := assert.New(t)
+	root, err := ioutil.TempDir(ctestRoot, "hierarchy")
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	assert.NoError(err)
+	home := filepath.Join(root, "home")
+	project := filepath.Join(root, "project")
+	system := filepath.Join(root, "etc", "nomsconfig")
+
+	oldHome, oldSystem := os.Getenv("HOME"), SystemConfigFile
+	defer func() {
+		os.Setenv("HOME", oldHome)
+		SystemConfigFile = oldSystem
+	}()
+	os.Setenv("HOME", home)
+	SystemConfigFile = system
+
+	assert.NoError(os.MkdirAll(project, os.ModePerm))
+	assert.NoError(os.Chdir(project))
+	_, err = FindNomsConfig()
+	assert.Equal(NoConfig, err)
+
+	assert.NoError(os.MkdirAll(filepath.Dir(system), os.ModePerm))
+	assert.NoError(ioutil.WriteFile(system, []byte("[db.shared]\n\turl = \"http://shared.com/db\"\n[db.origin]\n\turl = \"http://system.com/db\"\n"), os.ModePerm))
+	writeConfig(assert, &Config{"", map[string]DbConfig{DefaultDbAlias: {Url: "ldb:./mine"}, remoteAlias: {Url: httpSpec}}}, home)
+	writeConfig(assert, &Config{"", map[string]DbConfig{DefaultDbAlias: {Url: "ldb:./local"}}}, project)
+
+	c, err := FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal(filepath.Join(project, NomsConfigFile), c.File)
+	assert.Equal(3, len(c.Db))
+	// Relative paths are relative to the file that defines them, and the closest file wins.
+	assert.Equal("ldb:"+filepath.Join(project, "local"), c.Db[DefaultDbAlias].Url)
+	assert.Equal(httpSpec, c.Db[remoteAlias].Url)
+	assert.Equal("http://shared.com/db", c.Db["shared"].Url)
+
+	// From within $HOME, the user's config is the closest, and isn't read twice.
+	assert.NoError(os.Chdir(home))
+	c, err = FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal(filepath.Join(home, NomsConfigFile), c.File)
+	assert.Equal("ldb:"+filepath.Join(home, "mine"), c.Db[DefaultDbAlias].Url)
+	assert.Equal(3, len(c.Db))
+}
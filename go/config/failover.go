@@ -0,0 +1,49 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/spec"
+)
+
+// probe returns true if the database |dbSpec| seems to be reachable within |timeout|. An http(s) database must answer a request for its root without a server error; an ldb, nbs or badger database's directory must exist. Other databases can't be probed cheaply, so they're assumed to be reachable.
+func probe(dbSpec string, creds spec.Credentials, timeout time.Duration) bool {
+	sp, err := spec.ParseDatabaseSpec(dbSpec)
+	if err != nil {
+		return false
+	}
+	switch sp.Protocol {
+	case "http", "https":
+		u, err := url.Parse(dbSpec)
+		if err != nil {
+			return false
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + constants.RootPath
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return false
+		}
+		if creds.AuthToken != "" {
+			req.Header.Set("Authorization", "Bearer "+creds.AuthToken)
+		}
+		res, err := (&http.Client{Timeout: timeout}).Do(req)
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode < http.StatusInternalServerError
+	case "ldb", "nbs", "badger":
+		info, err := os.Stat(sp.Path)
+		return err == nil && info.IsDir()
+	}
+	return true
+}
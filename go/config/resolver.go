@@ -17,7 +17,8 @@ import (
 
 type Resolver struct {
 	config      *Config
-	dotDatapath string // set to the first datapath that was resolved
+	dotDatapath string            // set to the first datapath that was resolved
+	reachable   map[string]string // the spec chosen for each alias with several urls
 }
 
 // A Resolver enables using db defaults, db aliases and dataset '.' replacement in command
@@ -32,7 +33,7 @@ func NewResolver() *Resolver {
 		}
 		return &Resolver{}
 	}
-	return &Resolver{c, ""}
+	return &Resolver{config: c}
 }
 
 // Print replacement if one occurred
@@ -48,21 +49,68 @@ func (r *Resolver) verbose(orig string, replacement string) string {
 
 // Resolve string to database name. If config is defined:
 //   - replace the empty string with the default db url
-//   - replace any db alias with it's url
+//   - replace any db alias with it's url, plus any options configured for it
+//   - if the alias has several urls, use the first that's reachable
 func (r *Resolver) ResolveDbSpec(str string) string {
 	if r.config != nil {
 		if str == "" {
-			return r.config.Db[DefaultDbAlias].Url
+			return r.aliasSpec(DefaultDbAlias)
 		}
-		if val, ok := r.config.Db[str]; ok {
-			return val.Url
+		if _, ok := r.config.Db[str]; ok {
+			return r.aliasSpec(str)
 		}
 	}
 	return str
 }
 
+// aliasSpec returns the spec for |alias|. If it has several, they're probed in order, and the first that's reachable is used, or the first of all if none are. The choice is remembered, so each is probed at most once.
+func (r *Resolver) aliasSpec(alias string) string {
+	dc := r.config.Db[alias]
+	specs := dc.Specs()
+	if len(specs) == 1 {
+		return specs[0]
+	}
+	if chosen, ok := r.reachable[alias]; ok {
+		return chosen
+	}
+	timeout, err := dc.probeTimeout()
+	if err != nil {
+		timeout = DefaultProbeTimeout
+	}
+	chosen := specs[0]
+	for _, sp := range specs {
+		if probe(sp, dc.Credentials(), timeout) {
+			chosen = sp
+			break
+		}
+		if verbose.Verbose() {
+			fmt.Printf("\t%s is unreachable\n", sp)
+		}
+	}
+	if r.reachable == nil {
+		r.reachable = map[string]string{}
+	}
+	r.reachable[alias] = chosen
+	return chosen
+}
+
+// workspace returns the dataset of the database alias |db|, or of the default database if |db| is "", if the alias is a workspace.
+func (r *Resolver) workspace(db string) string {
+	if db == "" {
+		db = DefaultDbAlias
+	}
+	return r.config.Db[db].Dataset()
+}
+
+// isWorkspaceRelative returns true if |rest|, the part of a path spec after the database, is relative to a workspace's dataset: empty, or a path like ".value" or "[0]" or "~1.value". "." by itself is still the first datapath.
+func isWorkspaceRelative(rest string) bool {
+	return rest == "" || (rest != "." && strings.IndexAny(rest[:1], ".[@~") == 0)
+}
+
 // Resolve string to dataset or path name.
 //   - replace database name as described in ResolveDatabase
+//   - if the database is a workspace alias and the rest is empty or a
+//     path like ".value", prefix it with the workspace's dataset.
 //   - if this is the first call to ResolvePath, remember the
 //     datapath part for subsequent calls.
 //   - if this is not the first call and a "." is used, replace
@@ -74,6 +122,9 @@ func (r *Resolver) ResolvePathSpec(str string) string {
 		if len(split) > 1 {
 			db, rest = split[0], split[1]
 		}
+		if ws := r.workspace(db); ws != "" && isWorkspaceRelative(rest) {
+			rest = ws + rest
+		}
 		if r.dotDatapath == "" {
 			r.dotDatapath = rest
 		} else if rest == "." {
@@ -84,28 +135,86 @@ func (r *Resolver) ResolvePathSpec(str string) string {
 	return str
 }
 
+// credentials returns the credentials configured for the database alias |db|, or for the default database if |db| is "".
+func (r *Resolver) credentials(db string) spec.Credentials {
+	if r.config != nil {
+		if db == "" {
+			db = DefaultDbAlias
+		}
+		if val, ok := r.config.Db[db]; ok {
+			return val.Credentials()
+		}
+	}
+	return spec.Credentials{}
+}
+
+// pathCredentials returns the credentials for the database of the dataset or path spec |str|.
+func (r *Resolver) pathCredentials(str string) spec.Credentials {
+	split := strings.SplitN(str, spec.Separator, 2)
+	if len(split) == 1 {
+		return r.credentials("")
+	}
+	return r.credentials(split[0])
+}
+
 // Resolve string to database spec. If a config is present,
 //   - resolve a db alias to its db spec
 //   - resolve "" to the default db spec
+//   - use the credentials configured for the db
 func (r *Resolver) GetDatabase(str string) (datas.Database, error) {
-	return spec.GetDatabase(r.verbose(str, r.ResolveDbSpec(str)))
+	sp, err := spec.ParseDatabaseSpec(r.verbose(str, r.ResolveDbSpec(str)))
+	if err != nil {
+		return nil, err
+	}
+	sp.Credentials = r.credentials(str)
+	return sp.Database()
 }
 
 // Resolve string to a chunkstore. Like ResolveDatabase, but returns the underlying ChunkStore
 func (r *Resolver) GetChunkStore(str string) (chunks.ChunkStore, error) {
-	return spec.GetChunkStore(r.verbose(str, r.ResolveDbSpec(str)))
+	sp, err := spec.ParseDatabaseSpec(r.verbose(str, r.ResolveDbSpec(str)))
+	if err != nil {
+		return nil, err
+	}
+	sp.Credentials = r.credentials(str)
+	return sp.ChunkStore()
 }
 
 // Resolve string to a dataset. If a config is present,
 //  - if no db prefix is present, assume the default db
 //  - if the db prefix is an alias, replace it
+//  - use the credentials configured for the db
 func (r *Resolver) GetDataset(str string) (datas.Database, datas.Dataset, error) {
-	return spec.GetDataset(r.verbose(str, r.ResolvePathSpec(str)))
+	sp, err := spec.ParseDatasetSpec(r.verbose(str, r.ResolvePathSpec(str)))
+	if err != nil {
+		return nil, datas.Dataset{}, err
+	}
+	sp.DbSpec.Credentials = r.pathCredentials(str)
+	ds, err := sp.Dataset()
+	if err != nil {
+		return nil, datas.Dataset{}, err
+	}
+	return ds.Database(), ds, nil
 }
 
 // Resolve string to a value path. If a config is present,
 //  - if no db spec is present, assume the default db
 //  - if the db spec is an alias, replace it
+//  - use the credentials configured for the db
 func (r *Resolver) GetPath(str string) (datas.Database, types.Value, error) {
-	return spec.GetPath(r.verbose(str, r.ResolvePathSpec(str)))
+	sp, err := r.GetPathSpec(str)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp.Value()
+}
+
+// GetPathSpec resolves |str| the way GetPath does, but returns the spec rather than the value it refers to, for commands which write to the path.
+func (r *Resolver) GetPathSpec(str string) (spec.PathSpec, error) {
+	sp, err := spec.ParsePathSpec(r.verbose(str, r.ResolvePathSpec(str)))
+	if err != nil {
+		return spec.PathSpec{}, err
+	}
+	sp.DbSpec.Credentials = r.pathCredentials(str)
+	return sp, nil
 }
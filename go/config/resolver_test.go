@@ -5,12 +5,17 @@
 package config
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/attic-labs/testify/assert"
 	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
 )
 
 const (
@@ -31,8 +36,8 @@ var (
 	rtestConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: { localSpec },
-			remoteAlias: { remoteSpec },
+			DefaultDbAlias: { Url: localSpec },
+			remoteAlias: { Url: remoteSpec },
 		},
 	}
 
@@ -149,3 +154,134 @@ func TestResolveDestPathWithDot(t *testing.T) {
 	}
 
 }
+
+func TestResolveCredentials(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(rtestRoot, "credentials")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "key"), []byte("000102030405060708090a0b0c0d0e0f"), 0600))
+	c := &Config{
+		"",
+		map[string]DbConfig{
+			DefaultDbAlias: {Url: "nbs:./store", KeyFile: "key"},
+			remoteAlias:    {Url: remoteSpec, AuthToken: "secret", AWSProfile: "profile", AccessFile: "access.toml"},
+		},
+	}
+	_, err = c.WriteTo(dir)
+	assert.NoError(err)
+	assert.NoError(os.Chdir(dir))
+	r := NewResolver()
+	remoteCreds := spec.Credentials{AuthToken: "secret", AWSProfile: "profile", AccessFile: filepath.Join(dir, "access.toml")}
+	assert.Equal(remoteCreds, r.credentials(remoteAlias))
+	assert.Equal(remoteCreds, r.pathCredentials(remoteAlias+"::ds"))
+	assert.Equal(spec.Credentials{KeyFile: filepath.Join(dir, "key")}, r.pathCredentials("ds"))
+	assert.Equal(spec.Credentials{}, r.pathCredentials("mem::ds"))
+	// Credentials aren't added to the resolved spec string.
+	assert.Equal(remoteSpec, r.ResolveDbSpec(remoteAlias))
+
+	db, ds, err := r.GetDataset("ds")
+	assert.NoError(err)
+	_, err = db.CommitValue(ds, types.String("secret"))
+	assert.NoError(err)
+	db.Close()
+	_, val, err := r.GetPath("ds.value")
+	assert.NoError(err)
+	assert.True(types.String("secret").Equals(val))
+
+	// Without the key, the chunks can't be read.
+	cs, err := spec.GetChunkStore(r.ResolveDbSpec(""))
+	assert.NoError(err)
+	assert.False(bytes.Contains(cs.Get(cs.Root()).Data(), []byte("ds")))
+	cs.Close()
+}
+
+func TestResolveWorkspaces(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(rtestRoot, "workspaces")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	c := &Config{
+		"",
+		map[string]DbConfig{
+			DefaultDbAlias: {Url: memSpec},
+			"mywork":       {Url: "ldb:./work::" + testDs, Options: map[string]string{"block_cache": "1GiB"}},
+		},
+	}
+	_, err = c.WriteTo(dir)
+	assert.NoError(err)
+	assert.NoError(os.Chdir(dir))
+	r := NewResolver()
+	workSpec := "ldb:" + filepath.Join(dir, "work")
+
+	// The alias by itself is still its database.
+	assert.Equal(workSpec+"?block_cache=1GiB", r.ResolveDbSpec("mywork"))
+	assert.Equal(testDs, r.config.Db["mywork"].Dataset())
+	assert.Equal("", r.config.Db[DefaultDbAlias].Dataset())
+
+	for _, d := range []testData{
+		{"mywork::", workSpec + "?block_cache=1GiB::" + testDs},
+		{"mywork::.value", workSpec + "?block_cache=1GiB::" + testDs + ".value"},
+		{"mywork::.value[0]", workSpec + "?block_cache=1GiB::" + testDs + ".value[0]"},
+		{"mywork::~1.value", workSpec + "?block_cache=1GiB::" + testDs + "~1.value"},
+		{"mywork::other.value", workSpec + "?block_cache=1GiB::other.value"},
+		{"mywork::" + testObject, workSpec + "?block_cache=1GiB::" + testObject},
+		{".value", memSpec + "::.value"},
+	} {
+		assert.Equal(d.expected, r.ResolvePathSpec(d.input), d.input)
+	}
+
+	db, ds, err := r.GetDataset("mywork::")
+	assert.NoError(err)
+	assert.Equal(testDs, ds.ID())
+	_, err = db.CommitValue(ds, types.NewList(types.String("work")))
+	assert.NoError(err)
+	db.Close()
+	_, val, err := r.GetPath("mywork::.value[0]")
+	assert.NoError(err)
+	assert.True(types.String("work").Equals(val))
+}
+
+func TestResolveFailover(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(rtestRoot, "failover")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	tokens := []string{}
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal("/db/root/", req.URL.Path)
+		tokens = append(tokens, req.Header.Get("Authorization"))
+	}))
+	defer replica.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "replica"), os.ModePerm))
+	c := &Config{
+		"",
+		map[string]DbConfig{
+			DefaultDbAlias: {Urls: []string{"ldb:./primary::" + testDs, "ldb:./replica::" + testDs}},
+			remoteAlias:    {Urls: []string{down.URL + "/db", broken.URL + "/db", replica.URL + "/db"}, ProbeTimeout: "1s", AuthToken: "secret"},
+			"none":         {Urls: []string{down.URL + "/a", down.URL + "/b"}},
+		},
+	}
+	_, err = c.WriteTo(dir)
+	assert.NoError(err)
+	assert.NoError(os.Chdir(dir))
+	r := NewResolver()
+
+	assert.Equal(replica.URL+"/db", r.ResolveDbSpec(remoteAlias))
+	assert.Equal([]string{"Bearer secret"}, tokens)
+	// The choice is remembered.
+	assert.Equal(replica.URL+"/db", r.ResolveDbSpec(remoteAlias))
+	assert.Equal(1, len(tokens))
+
+	assert.Equal("ldb:"+filepath.Join(dir, "replica")+"::"+testDs+".value", r.ResolvePathSpec(".value"))
+	// If none are reachable, the first is used, so that opening it reports the error.
+	assert.Equal(down.URL+"/a", r.ResolveDbSpec("none"))
+}
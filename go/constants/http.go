@@ -7,7 +7,12 @@ package constants
 const (
 	RootPath       = "/root/"
 	GetRefsPath    = "/getRefs/"
+	GetRefPath     = "/getRef/"
 	HasRefsPath    = "/hasRefs/"
+	WantRefsPath   = "/wantRefs/"
+	PullRefsPath   = "/pullRefs/"
+	NotifyPath     = "/notify/"
 	WriteValuePath = "/writeValue/"
+	GraphQLPath    = "/graphql/"
 	BasePath       = "/"
 )
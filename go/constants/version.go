@@ -5,7 +5,14 @@
 // Package constants collects common constants used in Noms, such as the Noms data format version.
 package constants
 
+// NomsVersion is bumped whenever the format of chunks changes, e.g. when a kind is added, so that readers of one version refuse data of another rather than fail to decode it.
+// 7.1 adds the Tuple, Counter, LWWRegister and Encrypted kinds to 7. Data of version 7 is still valid, so a database of version 7 can be upgraded by backing it up with noms backup, and restoring the archive into a new database with noms restore; see CanUpgrade.
 // TODO: generate this from some central thing with go generate, so that JS and Go can be easily kept in sync
-const NomsVersion = "7"
+const NomsVersion = "7.1"
+
+// CanUpgrade returns true if data of version |vers| is also data of NomsVersion, so that it can be copied as is into a database of NomsVersion.
+func CanUpgrade(vers string) bool {
+	return vers == "7"
+}
 
 var NomsGitSHA = "<developer build>"
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
 
 	"github.com/attic-labs/testify/assert"
 )
@@ -80,6 +81,31 @@ func TryCatch(f func(), catch func(err error) error) (err error) {
 	return
 }
 
+// PanicError is the error TryAll returns when its function panics with something other than a WrappedError, e.g. a failed d.Chk assertion or a runtime error. Value is what the function panicked with, and Stack is the stack of the goroutine that panicked, as it was then.
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("%v", e.Value)
+}
+
+// TryAll calls |f| and returns nil if it returns, or an error if it panics instead: the cause of a WrappedError, as Unwrap(Try(f)) would return, or a PanicError for anything else. It's for callers that have to turn any failure of f into an error, such as servers, which can't let one request crash them.
+func TryAll(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if we, ok := r.(WrappedError); ok {
+				err = Unwrap(we)
+			} else {
+				err = PanicError{r, string(debug.Stack())}
+			}
+		}
+	}()
+	f()
+	return
+}
+
 type WrappedError interface {
 	Error() string
 	Cause() error
@@ -112,6 +112,28 @@ func TestTryCatch(t *testing.T) {
 	}())
 }
 
+func TestTryAll(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(TryAll(func() {}))
+	assert.Equal(te, TryAll(func() {
+		PanicIfError(te)
+	}))
+
+	err := TryAll(func() {
+		Chk.Fail("oops")
+	})
+	assert.IsType(PanicError{}, err)
+	assert.Contains(err.Error(), "oops")
+
+	err = TryAll(func() {
+		var m map[string]int
+		m["a"] = 1
+	})
+	assert.IsType(PanicError{}, err)
+	assert.Contains(err.(PanicError).Stack, "TestTryAll")
+}
+
 func TestUnwrap(t *testing.T) {
 	assert := assert.New(t)
 
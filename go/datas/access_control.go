@@ -0,0 +1,180 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Grant lists the datasets that requests may read and write. Each entry is a dataset name, or a pattern as understood by path.Match, e.g. "photos-*"; "*" matches every dataset. Being able to write a dataset implies being able to read it. An AccessControl only grants reads of every dataset, "*", but an application can give NewAuthorizedDatabase a Grant that reads only some.
+type Grant struct {
+	Read  []string
+	Write []string
+}
+
+// TokenGrant is a Grant to the requests which carry Token as their bearer token.
+type TokenGrant struct {
+	Token string
+	Grant
+}
+
+// AccessControl decides which requests a RemoteDatabaseServer allows, based on the bearer token in their Authorization header. Requests without one get the Anonymous grant, which allows nothing unless it's configured to.
+//
+// Chunks are addressed by hash, not by dataset, so read grants can't hide individual datasets: any request that may read some dataset may read the root and fetch any chunk. Reads are therefore only granted to every dataset, as read = ["*"], and LoadAccessControl rejects read grants of particular datasets rather than seeming to enforce them. Writes, on the other hand, are checked dataset by dataset, when the root is updated.
+type AccessControl struct {
+	// Token maps a name for each token, which is only used in the config file, to its grant.
+	Token     map[string]TokenGrant
+	Anonymous Grant
+	// Database, on a server hosting many databases, maps the names of databases to the AccessControl used for them instead of this one.
+	Database map[string]*AccessControl
+}
+
+// LoadAccessControl reads an AccessControl from the TOML file at |path|, e.g.
+//
+//   [anonymous]
+//   read = ["*"]
+//
+//   [token.alice]
+//   token = "7e3f1c..."
+//   write = ["*"]
+//
+//   [database.team1.token.bob]
+//   token = "b0b5ec..."
+//   write = ["*"]
+func LoadAccessControl(path string) (*AccessControl, error) {
+	ac := &AccessControl{}
+	if _, err := toml.DecodeFile(path, ac); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if err := ac.check(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return ac, nil
+}
+
+func (ac *AccessControl) check() error {
+	if err := ac.Anonymous.checkReads(); err != nil {
+		return fmt.Errorf("anonymous: %s", err)
+	}
+	for name, tg := range ac.Token {
+		if tg.Token == "" {
+			return fmt.Errorf("token %s has no token", name)
+		}
+		if err := tg.checkReads(); err != nil {
+			return fmt.Errorf("token %s: %s", name, err)
+		}
+	}
+	for name, dbAC := range ac.Database {
+		if err := dbAC.check(); err != nil {
+			return fmt.Errorf("database %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// grant returns the Grant for |req|. ok is false if req has a bearer token which isn't known.
+func (ac *AccessControl) grant(req *http.Request) (g Grant, ok bool) {
+	return ac.GrantFor(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+}
+
+// GrantFor returns the Grant for |token|, or the Anonymous grant if token is empty. ok is false if token isn't known. Applications that open databases themselves can limit each user to their grant with NewAuthorizedDatabase, so that the same config governs them as governs a server.
+func (ac *AccessControl) GrantFor(token string) (g Grant, ok bool) {
+	if token == "" {
+		return ac.Anonymous, true
+	}
+	for _, tg := range ac.Token {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(tg.Token)) == 1 {
+			g, ok = tg.Grant, true
+		}
+	}
+	return
+}
+
+func matchesAny(patterns []string, datasetID string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, datasetID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer decides which datasets may be read and written. A Grant is an Authorizer, and is what's used unless an application has a policy of its own; see NewAuthorizedDatabase.
+type Authorizer interface {
+	// CanRead returns true if |datasetID| may be read.
+	CanRead(datasetID string) bool
+	// CanWrite returns true if |datasetID| may be written, i.e. committed to, deleted, or have its head set.
+	CanWrite(datasetID string) bool
+}
+
+// CanRead returns true if g allows |datasetID| to be read.
+func (g Grant) CanRead(datasetID string) bool {
+	return matchesAny(g.Read, datasetID) || matchesAny(g.Write, datasetID)
+}
+
+// CanWrite returns true if g allows |datasetID| to be written.
+func (g Grant) CanWrite(datasetID string) bool {
+	return matchesAny(g.Write, datasetID)
+}
+
+// checkReads returns an error if g grants reads of particular datasets, which a server can't enforce.
+func (g Grant) checkReads() error {
+	for _, p := range g.Read {
+		if p != "*" {
+			return fmt.Errorf("can't grant reads of %q: chunks are addressed by hash, not by dataset, so reads can only be granted to every dataset, \"*\"", p)
+		}
+	}
+	return nil
+}
+
+func (g Grant) readsAnything() bool {
+	return len(g.Read) > 0 || len(g.Write) > 0
+}
+
+func (g Grant) writesAnything() bool {
+	return len(g.Write) > 0
+}
+
+// readRootMap returns the map of datasets in the root |h| of |cs|, which is empty if there's no such root.
+func readRootMap(cs chunks.ChunkStore, h hash.Hash) types.Map {
+	if h.IsEmpty() {
+		return types.NewMap()
+	}
+	c := cs.Get(h)
+	if c.IsEmpty() {
+		return types.NewMap()
+	}
+	if m, ok := types.DecodeValue(c, types.NewValueStore(types.NewBatchStoreAdaptor(cs))).(types.Map); ok {
+		return m
+	}
+	return types.NewMap()
+}
+
+// changedDatasets returns the IDs of the datasets which were added, removed or moved when the root of |cs| changes from |last| to |current|.
+func changedDatasets(cs chunks.ChunkStore, last, current hash.Hash) []string {
+	lastRoot, currentRoot := readRootMap(cs, last), readRootMap(cs, current)
+
+	changed := []string{}
+	currentRoot.IterAll(func(k, v types.Value) {
+		if old, ok := lastRoot.MaybeGet(k); !ok || !old.Equals(v) {
+			changed = append(changed, string(k.(types.String)))
+		}
+	})
+	lastRoot.IterAll(func(k, v types.Value) {
+		if !currentRoot.Has(k) {
+			changed = append(changed, string(k.(types.String)))
+		}
+	})
+	return changed
+}
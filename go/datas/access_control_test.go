@@ -0,0 +1,237 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/types"
+)
+
+const testAccessConfig = `
+[anonymous]
+read = ["*"]
+
+[token.alice]
+token = "alice-secret"
+write = ["photos-*"]
+
+[token.bob]
+token = "bob-secret"
+read = ["*"]
+`
+
+func loadTestAccessControl(assert *assert.Assertions, config string) (*AccessControl, error) {
+	dir, err := ioutil.TempDir("", "access")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.toml")
+	assert.NoError(ioutil.WriteFile(path, []byte(config), 0644))
+	return LoadAccessControl(path)
+}
+
+func TestLoadAccessControl(t *testing.T) {
+	assert := assert.New(t)
+	ac, err := loadTestAccessControl(assert, testAccessConfig)
+	assert.NoError(err)
+	assert.Equal(&AccessControl{
+		Token: map[string]TokenGrant{
+			"alice": {"alice-secret", Grant{Write: []string{"photos-*"}}},
+			"bob":   {"bob-secret", Grant{Read: []string{"*"}}},
+		},
+		Anonymous: Grant{Read: []string{"*"}},
+	}, ac)
+
+	alice := ac.Token["alice"].Grant
+	assert.True(alice.CanRead("photos-2016"))
+	assert.True(alice.CanWrite("photos-2016"))
+	assert.False(alice.CanRead("photos"))
+	assert.True(ac.Token["bob"].CanRead("anything"))
+	assert.False(ac.Token["bob"].CanWrite("anything"))
+
+	_, err = loadTestAccessControl(assert, "[token.carol]\nwrite = [\"*\"]\n")
+	assert.Error(err)
+	// A server can't keep some datasets from readers, so it isn't asked to.
+	_, err = loadTestAccessControl(assert, "[anonymous]\nread = [\"public\"]\n")
+	assert.Error(err)
+	_, err = loadTestAccessControl(assert, "[token.dave]\ntoken = \"dave-secret\"\nread = [\"photos-*\"]\n")
+	assert.Error(err)
+}
+
+func TestServerAccessControl(t *testing.T) {
+	assert := assert.New(t)
+	ac, err := loadTestAccessControl(assert, testAccessConfig)
+	assert.NoError(err)
+
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	server.Access = ac
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	status := func(method, path, auth string) int {
+		req := newRequest(method, auth, url+path, nil, nil)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(http.StatusOK, status("GET", constants.RootPath, ""))
+	assert.Equal(http.StatusUnauthorized, status("GET", constants.RootPath, "Bearer mallory"))
+	assert.Equal(http.StatusForbidden, status("POST", constants.WriteValuePath, ""))
+	assert.Equal(http.StatusForbidden, status("POST", constants.WriteValuePath, "Bearer bob-secret"))
+
+	alice := NewRemoteDatabase(url, "Bearer alice-secret")
+	_, err = alice.CommitValue(alice.GetDataset("photos-2016"), types.String("sunset"))
+	assert.NoError(err)
+	assert.Panics(func() {
+		alice.CommitValue(alice.GetDataset("public"), types.String("hello"))
+	})
+	alice.Close()
+
+	bob := NewRemoteDatabase(url, "Bearer bob-secret")
+	head := bob.GetDataset("photos-2016").HeadRef().TargetHash()
+	assert.Equal(types.String("sunset"), bob.GetDataset("photos-2016").HeadValue())
+	bob.Close()
+
+	// Chunks are only readable with a token the server grants access to, so caches shared with other clients mustn't keep them.
+	res, err := http.DefaultClient.Do(newRequest("GET", "Bearer bob-secret", url+constants.GetRefPath+head.String(), nil, nil))
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("private, max-age=31536000, immutable", res.Header.Get("Cache-Control"))
+}
+
+func TestAuthorizedDatabase(t *testing.T) {
+	assert := assert.New(t)
+	ac, err := loadTestAccessControl(assert, testAccessConfig)
+	assert.NoError(err)
+	_, ok := ac.GrantFor("mallory")
+	assert.False(ok)
+	anonymous, ok := ac.GrantFor("")
+	assert.True(ok)
+	assert.Equal(ac.Anonymous, anonymous)
+
+	test := func(db Database) {
+		for _, id := range []string{"photos-2016", "public", "private"} {
+			_, err := db.CommitValue(db.GetDataset(id), types.String(id))
+			assert.NoError(err)
+		}
+		g, ok := ac.GrantFor("alice-secret")
+		assert.True(ok)
+		alice := NewAuthorizedDatabase(db, g)
+
+		// Datasets alice can't read are hidden.
+		assert.Equal(uint64(1), alice.Datasets().Len())
+		ds := alice.GetDataset("photos-2016")
+		assert.Equal(alice, ds.Database())
+		assert.Equal(types.String("photos-2016"), ds.HeadValue())
+		_, ok = alice.GetDataset("private").MaybeHead()
+		assert.False(ok)
+
+		ds, err = alice.CommitValue(ds, types.String("sunset"))
+		assert.NoError(err)
+		assert.Equal(types.String("sunset"), ds.HeadValue())
+		head := ds.HeadRef()
+
+		// A commit to a dataset whose head has changed since it was gotten needs a merge, as it would without alice.
+		stale := alice.GetDataset("photos-2016")
+		ds, err = alice.CommitValue(ds, types.String("sunrise"))
+		assert.NoError(err)
+		_, err = alice.CommitValue(stale, types.String("dusk"))
+		assert.Equal(ErrMergeNeeded, err)
+		assert.Equal(types.String("sunrise"), alice.GetDataset("photos-2016").HeadValue())
+		ds = alice.GetDataset("photos-2016")
+
+		_, err = alice.CommitValue(alice.GetDataset("public"), types.String("hello"))
+		assert.True(IsAccessDeniedError(err))
+		assert.Equal(AccessDeniedError{"commit to", "public"}, err)
+		_, err = alice.Delete(alice.GetDataset("private"))
+		assert.True(IsAccessDeniedError(err))
+		_, err = alice.SetHead(alice.GetDataset("private"), head)
+		assert.True(IsAccessDeniedError(err))
+		_, err = alice.FastForward(alice.GetDataset("public"), head)
+		assert.True(IsAccessDeniedError(err))
+		db.Rebase()
+		assert.Equal(types.String("public"), db.GetDataset("public").HeadValue())
+		assert.Equal(types.String("private"), db.GetDataset("private").HeadValue())
+
+		ds, err = alice.Delete(ds)
+		assert.NoError(err)
+		_, ok = ds.MaybeHeadRef()
+		assert.False(ok)
+	}
+
+	db := NewDatabase(chunks.NewMemoryStore())
+	test(db)
+	db.Close()
+
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	rdb := NewRemoteDatabase(fmt.Sprintf("http://localhost:%d", <-portChan), "")
+	test(rdb)
+	rdb.Close()
+}
+
+func TestServerTLS(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	server.TLSCertFile, server.TLSKeyFile = certFile, keyFile
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	port := <-portChan
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	req := newRequest("GET", "", fmt.Sprintf("https://localhost:%d%s", port, constants.RootPath), nil, nil)
+	res, err := client.Do(req)
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.NotNil(res.TLS)
+}
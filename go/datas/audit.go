@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"time"
+
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// AuditDatasetID is the ID of the dataset in which an audited Database records each change it makes to the heads of the others. Each change is a commit whose value is an AuditEntry struct, and whose parent is the commit of the change before it, so that the log can't be rewritten without the hashes of all the changes after the rewritten one changing too.
+const AuditDatasetID = "__audit"
+
+// ErrAuditDataset is returned when an audited Database is asked to change the audit dataset itself.
+var ErrAuditDataset = errors.New("The audit dataset can only be changed by auditing")
+
+// The ops recorded in the audit dataset.
+const (
+	auditCommit      = "commit"
+	auditDelete      = "delete"
+	auditFastForward = "fast-forward"
+	auditSetHead     = "set-head"
+)
+
+// AuditEntry is a change to the head of a dataset recorded in the audit dataset: Who made it, and when, Dataset, the ID of the dataset changed, Op, which is one of "commit", "delete", "fast-forward" and "set-head", and From and To, the hashes of the head before and after, which are empty if there was none.
+type AuditEntry struct {
+	Who, Dataset, Op string
+	Date             time.Time
+	From, To         hash.Hash
+}
+
+type auditor struct {
+	who string
+}
+
+// EnableAudit makes |db| record each change it makes to the head of a dataset in the dataset AuditDatasetID, as made by |who|, e.g. a user name. Each change is recorded in the same update of the root as the change itself, so none are made without being recorded, and db refuses to change the audit dataset otherwise, with ErrAuditDataset. Only changes made through audited Databases are recorded, so every client of a database that's to be audited should enable it.
+func EnableAudit(db Database, who string) {
+	db.setAuditor(&auditor{who})
+}
+
+func (dbc *databaseCommon) setAuditor(a *auditor) {
+	dbc.audit = a
+}
+
+// checkNotAudit returns ErrAuditDataset if dbc is audited and |datasetID| is the audit dataset.
+func (dbc *databaseCommon) checkNotAudit(datasetID string) error {
+	if dbc.audit != nil && datasetID == AuditDatasetID {
+		return ErrAuditDataset
+	}
+	return nil
+}
+
+// record returns |datasets|, the root that makes the change |op| to the dataset |datasetID| of the root |rootHash|, with a commit recording the change added to the audit dataset.
+func (a *auditor) record(dbc *databaseCommon, datasets types.Map, rootHash hash.Hash, datasetID, op string) types.Map {
+	id := types.String(datasetID)
+	from, to := types.String(""), types.String("")
+	if !rootHash.IsEmpty() {
+		if r, ok := dbc.datasetsFromRef(rootHash).MaybeGet(id); ok {
+			from = types.String(r.(types.Ref).TargetHash().String())
+		}
+	}
+	if r, ok := datasets.MaybeGet(id); ok {
+		to = types.String(r.(types.Ref).TargetHash().String())
+	}
+	entry := types.NewStruct("AuditEntry", types.StructData{
+		"who":     types.String(a.who),
+		"date":    types.String(time.Now().UTC().Format(time.RFC3339Nano)),
+		"dataset": id,
+		"op":      types.String(op),
+		"from":    from,
+		"to":      to,
+	})
+	parents := types.NewSet()
+	if head, ok := datasets.MaybeGet(types.String(AuditDatasetID)); ok {
+		parents = parents.Insert(head)
+	}
+	return datasets.Set(types.String(AuditDatasetID), dbc.WriteValue(NewCommit(entry, parents, types.EmptyStruct)))
+}
+
+// ReadAudit calls |cb| with each change recorded in the audit dataset of |db|, newest first, until it returns true.
+func ReadAudit(db Database, cb func(e AuditEntry) (stop bool)) {
+	r, ok := db.GetDataset(AuditDatasetID).MaybeHeadRef()
+	for ok {
+		commit := r.TargetValue(db).(types.Struct)
+		s := commit.Get(ValueField).(types.Struct)
+		e := AuditEntry{
+			Who:     string(s.Get("who").(types.String)),
+			Dataset: string(s.Get("dataset").(types.String)),
+			Op:      string(s.Get("op").(types.String)),
+		}
+		e.Date, _ = time.Parse(time.RFC3339Nano, string(s.Get("date").(types.String)))
+		e.From, _ = hash.MaybeParse(string(s.Get("from").(types.String)))
+		e.To, _ = hash.MaybeParse(string(s.Get("to").(types.String)))
+		if cb(e) {
+			return
+		}
+		parents := commit.Get(ParentsField).(types.Set)
+		if ok = !parents.Empty(); ok {
+			r = parents.First().(types.Ref)
+		}
+	}
+}
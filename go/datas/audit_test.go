@@ -0,0 +1,97 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	db := NewDatabase(cs)
+	defer db.Close()
+
+	// Changes made before auditing is enabled aren't recorded.
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	a := ds.HeadRef()
+	start := time.Now().Add(-time.Second)
+	EnableAudit(db, "alice")
+
+	ds, err = db.CommitValue(ds, types.String("b"))
+	assert.NoError(err)
+	b := ds.HeadRef()
+	ds, err = db.SetHead(ds, a)
+	assert.NoError(err)
+	ds, err = db.FastForward(ds, b)
+	assert.NoError(err)
+	_, err = db.Delete(ds)
+	assert.NoError(err)
+	// Changes that don't change anything aren't recorded either.
+	_, err = db.Delete(db.GetDataset("ds"))
+	assert.NoError(err)
+
+	entries := []AuditEntry{}
+	ReadAudit(db, func(e AuditEntry) bool {
+		assert.Equal("alice", e.Who)
+		assert.Equal("ds", e.Dataset)
+		assert.True(e.Date.After(start))
+		e.Who, e.Dataset, e.Date = "", "", time.Time{}
+		entries = append(entries, e)
+		return false
+	})
+	assert.Equal([]AuditEntry{
+		{Op: "delete", From: b.TargetHash()},
+		{Op: "fast-forward", From: a.TargetHash(), To: b.TargetHash()},
+		{Op: "set-head", From: b.TargetHash(), To: a.TargetHash()},
+		{Op: "commit", From: a.TargetHash(), To: b.TargetHash()},
+	}, entries)
+
+	n := 0
+	ReadAudit(db, func(e AuditEntry) bool {
+		n++
+		return true
+	})
+	assert.Equal(1, n)
+
+	// The audit dataset can only be changed by auditing.
+	audit := db.GetDataset(AuditDatasetID)
+	_, err = db.CommitValue(audit, types.String("nothing happened"))
+	assert.Equal(ErrAuditDataset, err)
+	_, err = db.Delete(audit)
+	assert.Equal(ErrAuditDataset, err)
+	_, err = db.SetHead(audit, a)
+	assert.Equal(ErrAuditDataset, err)
+	_, err = db.FastForward(audit, a)
+	assert.Equal(ErrAuditDataset, err)
+	// Even setting it to the head it already has.
+	_, err = db.SetHead(audit, audit.HeadRef())
+	assert.Equal(ErrAuditDataset, err)
+
+	// Auditing works through wrappers, and for Databases that started out behind.
+	other := NewDatabase(cs)
+	g := Grant{Write: []string{"*"}}
+	authorized := NewAuthorizedDatabase(other, g)
+	EnableAudit(authorized, "bob")
+	_, err = authorized.CommitValue(authorized.GetDataset("other"), types.Number(1))
+	assert.NoError(err)
+	db.Rebase()
+	var latest AuditEntry
+	ReadAudit(db, func(e AuditEntry) bool {
+		latest = e
+		return true
+	})
+	assert.Equal("bob", latest.Who)
+	assert.Equal("other", latest.Dataset)
+	assert.Equal(hash.Hash{}, latest.From)
+	assert.Equal(uint64(5), db.GetDataset(AuditDatasetID).HeadRef().Height())
+}
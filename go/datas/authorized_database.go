@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/go/types"
+)
+
+// AccessDeniedError is returned when an authorized Database is asked to change a dataset its Authorizer doesn't allow to be written. Op describes what was asked, and Dataset is the ID of the Dataset it was asked of.
+type AccessDeniedError struct {
+	Op      string
+	Dataset string
+}
+
+func (e AccessDeniedError) Error() string {
+	return fmt.Sprintf("Cannot %s dataset %s: access denied", e.Op, e.Dataset)
+}
+
+// IsAccessDeniedError returns true if |err| was returned because an Authorizer didn't allow a change.
+func IsAccessDeniedError(err error) bool {
+	_, ok := err.(AccessDeniedError)
+	return ok
+}
+
+type authorizedDatabase struct {
+	Database
+	auth Authorizer
+}
+
+// NewAuthorizedDatabase returns a Database that consults |auth| before each read or change of a dataset of |db|, whether db is local or remote. Datasets that auth doesn't allow to be read are left out of Datasets(), and have no head when gotten with GetDataset(); changes to datasets it doesn't allow to be written fail with an AccessDeniedError. As with the access control of a server, values are addressed by hash, not by dataset, so reading a value whose hash is known isn't checked.
+func NewAuthorizedDatabase(db Database, auth Authorizer) Database {
+	return authorizedDatabase{db, auth}
+}
+
+func (adb authorizedDatabase) Datasets() types.Map {
+	datasets := adb.Database.Datasets()
+	datasets.IterAll(func(k, v types.Value) {
+		if !adb.auth.CanRead(string(k.(types.String))) {
+			datasets = datasets.Remove(k)
+		}
+	})
+	return datasets
+}
+
+func (adb authorizedDatabase) GetDataset(datasetID string) Dataset {
+	return getDataset(adb, datasetID)
+}
+
+// update calls |f| to change |ds| unless |op| isn't allowed, and returns ds as adb sees it afterwards.
+func (adb authorizedDatabase) update(op string, ds Dataset, f func(ds Dataset) (Dataset, error)) (Dataset, error) {
+	if !adb.auth.CanWrite(ds.ID()) {
+		return adb.GetDataset(ds.ID()), AccessDeniedError{op, ds.ID()}
+	}
+	_, err := f(ds)
+	return adb.GetDataset(ds.ID()), err
+}
+
+func (adb authorizedDatabase) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return adb.update("commit to", ds, func(ds Dataset) (Dataset, error) {
+		return adb.Database.Commit(ds, v, opts)
+	})
+}
+
+func (adb authorizedDatabase) CommitValue(ds Dataset, v types.Value) (Dataset, error) {
+	return adb.Commit(ds, v, CommitOptions{})
+}
+
+func (adb authorizedDatabase) Delete(ds Dataset) (Dataset, error) {
+	return adb.update("delete", ds, adb.Database.Delete)
+}
+
+func (adb authorizedDatabase) SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return adb.update("set the head of", ds, func(ds Dataset) (Dataset, error) {
+		return adb.Database.SetHead(ds, newHeadRef)
+	})
+}
+
+func (adb authorizedDatabase) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return adb.update("fast-forward", ds, func(ds Dataset) (Dataset, error) {
+		return adb.Database.FastForward(ds, newHeadRef)
+	})
+}
+
+func (adb authorizedDatabase) CommitE(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return adb.Commit(ds, v, opts) })
+}
+
+func (adb authorizedDatabase) CommitValueE(ds Dataset, v types.Value) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return adb.CommitValue(ds, v) })
+}
+
+func (adb authorizedDatabase) DeleteE(ds Dataset) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return adb.Delete(ds) })
+}
+
+func (adb authorizedDatabase) SetHeadE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return adb.SetHead(ds, newHeadRef) })
+}
+
+func (adb authorizedDatabase) FastForwardE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return adb.FastForward(ds, newHeadRef) })
+}
@@ -12,6 +12,7 @@ import (
 
 type chunkHaver interface {
 	Has(h hash.Hash) bool
+	HasMany(hashes hash.HashSet) (absent hash.HashSet)
 }
 
 type cachingChunkHaver struct {
@@ -33,6 +34,33 @@ func (ccs *cachingChunkHaver) Has(r hash.Hash) bool {
 	return has
 }
 
+// HasMany returns the subset of |hashes| that are absent, asking the backing chunkHaver about those that aren't cached in a single call.
+func (ccs *cachingChunkHaver) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	absent, uncached := hash.HashSet{}, hash.HashSet{}
+	for h := range hashes {
+		if has, ok := checkCache(ccs, h); !ok {
+			uncached.Insert(h)
+		} else if !has {
+			absent.Insert(h)
+		}
+	}
+	if len(uncached) == 0 {
+		return
+	}
+
+	backingAbsent := ccs.backing.HasMany(uncached)
+	ccs.mu.Lock()
+	defer ccs.mu.Unlock()
+	for h := range uncached {
+		has := !backingAbsent.Has(h)
+		ccs.hasCache[h] = has
+		if !has {
+			absent.Insert(h)
+		}
+	}
+	return
+}
+
 func checkCache(ccs *cachingChunkHaver, r hash.Hash) (has, ok bool) {
 	ccs.mu.RLock()
 	defer ccs.mu.RUnlock()
@@ -8,7 +8,6 @@ import (
 	"sort"
 
 	"github.com/stormasm/noms/go/d"
-	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
 )
 
@@ -20,6 +19,10 @@ const (
 
 var valueCommitType = makeCommitType(types.ValueType, nil, types.EmptyStructType, nil)
 
+// ancestorCacheSize bounds the memory used to cache Commits while walking
+// history in FindCommonAncestor().
+const ancestorCacheSize = 1 << 23 // 8MB
+
 // NewCommit creates a new commit object. The type of Commit is computed based on the type of the value, the type of the meta info as well as the type of the parents.
 //
 // For the first commit we get:
@@ -58,15 +61,33 @@ func NewCommit(value types.Value, parents types.Set, meta types.Struct) types.St
 
 // CommitDescendsFrom returns true if commit descends from ancestor
 func CommitDescendsFrom(commit types.Struct, ancestor types.Ref, vr types.ValueReader) bool {
-	// BFS because the common case is that the ancestor is only a step or two away
-	ancestors := commit.Get(ParentsField).(types.Set)
-	for !ancestors.Has(ancestor) {
-		if ancestors.Empty() {
-			return false
+	// Walk back from the tallest commits, since a commit's parents are always shorter than it, so that each commit is only visited once without having to remember which have been. Only commits at least as tall as ancestor can lead to it.
+	q := types.GetRefByHeight()
+	defer types.PutRefByHeight(q)
+	pushParents := func(c types.Struct) {
+		c.Get(ParentsField).(types.Set).IterAll(func(v types.Value) {
+			if r := v.(types.Ref); r.Height() >= ancestor.Height() {
+				q.PushBack(r)
+			}
+		})
+		sort.Sort(q)
+	}
+
+	pushParents(commit)
+	for !q.Empty() {
+		r := q.PopBack()
+		if r.TargetHash() == ancestor.TargetHash() {
+			return true
+		}
+		// Commits that more than one walked commit has as a parent are next to each other in q.
+		for !q.Empty() && q.PeekEnd().TargetHash() == r.TargetHash() {
+			q.PopBack()
+		}
+		if r.Height() > ancestor.Height() {
+			pushParents(r.TargetValue(vr).(types.Struct))
 		}
-		ancestors = getAncestors(ancestors, ancestor.Height(), vr)
 	}
-	return true
+	return false
 }
 
 // FindCommonAncestor returns the most recent common ancestor of c1 and c2, if
@@ -76,25 +97,80 @@ func FindCommonAncestor(c1, c2 types.Struct, vr types.ValueReader) (a types.Stru
 	d.PanicIfFalse(IsCommitType(c1.Type()), "FindCommonAncestor() called on %s", c1.Type().Describe())
 	d.PanicIfFalse(IsCommitType(c2.Type()), "FindCommonAncestor() called on %s", c2.Type().Describe())
 
-	c1Q, c2Q := &types.RefByHeight{types.NewRef(c1)}, &types.RefByHeight{types.NewRef(c2)}
+	// Both queues may walk over the same Commits, so avoid decoding them more than once.
+	vr = types.NewCachingValueReader(vr, ancestorCacheSize)
+	// The queues, and the slices of refs popped off them, are reused, so that services that look for common ancestors over and over don't make garbage of them each time.
+	c1Q, c2Q := types.GetRefByHeight(), types.GetRefByHeight()
+	defer types.PutRefByHeight(c1Q)
+	defer types.PutRefByHeight(c2Q)
+	c1Q.PushBack(types.NewRef(c1))
+	c2Q.PushBack(types.NewRef(c2))
+	var c1Parents, c2Parents types.RefSlice
 	for !c1Q.Empty() && !c2Q.Empty() {
 		c1Ht, c2Ht := c1Q.MaxHeight(), c2Q.MaxHeight()
 		if c1Ht == c2Ht {
-			c1Parents, c2Parents := c1Q.PopRefsOfHeight(c1Ht), c2Q.PopRefsOfHeight(c2Ht)
+			c1Parents, c2Parents = c1Q.AppendRefsOfHeight(c1Parents[:0], c1Ht), c2Q.AppendRefsOfHeight(c2Parents[:0], c2Ht)
 			if common := findCommonRef(c1Parents, c2Parents); (common != types.Ref{}) {
 				return common.TargetValue(vr).(types.Struct), true
 			}
 			parentsToQueue(c1Parents, c1Q, vr)
 			parentsToQueue(c2Parents, c2Q, vr)
 		} else if c1Ht > c2Ht {
-			parentsToQueue(c1Q.PopRefsOfHeight(c1Ht), c1Q, vr)
+			c1Parents = c1Q.AppendRefsOfHeight(c1Parents[:0], c1Ht)
+			parentsToQueue(c1Parents, c1Q, vr)
 		} else {
-			parentsToQueue(c2Q.PopRefsOfHeight(c2Ht), c2Q, vr)
+			c2Parents = c2Q.AppendRefsOfHeight(c2Parents[:0], c2Ht)
+			parentsToQueue(c2Parents, c2Q, vr)
 		}
 	}
 	return
 }
 
+// DiffCommitsAtPath returns the differences between the values at |p| in commits |c1| and |c2|, as types.DiffStream finds them, with Paths starting with |p|, such as .value.users["bob"].age for |p| .value.users. Only the values at |p| are diffed, so asking what changed in a small part of a big value is as cheap as the change. Refs on the way to |p|, and at it, are followed by reading their targets from |vr|. If there's no value at |p| in one of the commits, the whole value at |p| in the other is reported as added or removed.
+func DiffCommitsAtPath(c1, c2 types.Struct, p types.Path, vr types.ValueReader) []types.Difference {
+	d.PanicIfFalse(IsCommitType(c1.Type()), "DiffCommitsAtPath() called on %s", c1.Type().Describe())
+	d.PanicIfFalse(IsCommitType(c2.Type()), "DiffCommitsAtPath() called on %s", c2.Type().Describe())
+
+	v1, v2 := resolveThroughRefs(c1, p, vr), resolveThroughRefs(c2, p, vr)
+	ch := make(chan types.Difference)
+	go func() {
+		types.DiffStream(v1, v2, ch, nil)
+		close(ch)
+	}()
+
+	diffs := []types.Difference{}
+	for diff := range ch {
+		full := make(types.Path, 0, len(p)+len(diff.Path))
+		diff.Path = append(append(full, p...), diff.Path...)
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// resolveThroughRefs is like p.Resolve(v), but reads the targets of the Refs it comes across from |vr|.
+func resolveThroughRefs(v types.Value, p types.Path, vr types.ValueReader) types.Value {
+	deref := func(v types.Value) types.Value {
+		for {
+			r, ok := v.(types.Ref)
+			if !ok {
+				return v
+			}
+			if v = r.TargetValue(vr); v == nil {
+				return nil
+			}
+		}
+	}
+	for _, part := range p {
+		if v = deref(v); v == nil {
+			return nil
+		}
+		if v = part.Resolve(v); v == nil {
+			return nil
+		}
+	}
+	return deref(v)
+}
+
 func parentsToQueue(refs types.RefSlice, q *types.RefByHeight, vr types.ValueReader) {
 	for _, r := range refs {
 		c := r.TargetValue(vr).(types.Struct)
@@ -106,19 +182,19 @@ func parentsToQueue(refs types.RefSlice, q *types.RefByHeight, vr types.ValueRea
 	sort.Sort(q)
 }
 
+// findCommonRef returns a Ref that's in both |a| and |b|, or the empty Ref if there isn't one. It sorts a and b by target hash, so that it can find one without building sets of them.
 func findCommonRef(a, b types.RefSlice) types.Ref {
-	toRefSet := func(s types.RefSlice) map[hash.Hash]types.Ref {
-		out := map[hash.Hash]types.Ref{}
-		for _, r := range s {
-			out[r.TargetHash()] = r
-		}
-		return out
-	}
-
-	aSet, bSet := toRefSet(a), toRefSet(b)
-	for s, r := range aSet {
-		if _, present := bSet[s]; present {
-			return r
+	sort.Sort(a)
+	sort.Sort(b)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		ah, bh := a[i].TargetHash(), b[j].TargetHash()
+		switch {
+		case ah == bh:
+			return a[i]
+		case ah.Less(bh):
+			i++
+		default:
+			j++
 		}
 	}
 	return types.Ref{}
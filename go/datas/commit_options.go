@@ -4,11 +4,21 @@
 
 package datas
 
-import "github.com/stormasm/noms/go/types"
+import (
+	"github.com/stormasm/noms/go/merge"
+	"github.com/stormasm/noms/go/types"
+)
+
+// DefaultCommitRetries is how many times Commit rebases a commit with a MergePolicy, if CommitOptions doesn't say.
+const DefaultCommitRetries = 5
 
 // CommitOptions is used to pass options into Commit.
 type CommitOptions struct {
 	// Parents, if provided is the parent commits of the commit we are creating.
 	Parents types.Set
 	Meta    types.Struct
+	// MergePolicy, if set, makes Commit rebase the commit, rather than fail with ErrMergeNeeded, if the head of the Dataset has moved on, e.g. because another client committed to it since it was gotten. The value being committed is merged with the new head's by merge.ThreeWay(), which resolves conflicts with MergePolicy, and committed on top of it, keeping the Meta. merge.Fail only rebases changes that don't conflict.
+	MergePolicy merge.Policy
+	// MaxRetries is how many times a commit with a MergePolicy is rebased before giving up with ErrMergeNeeded. Defaults to DefaultCommitRetries.
+	MaxRetries int
 }
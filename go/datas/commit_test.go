@@ -259,3 +259,64 @@ func TestCommitDescendsFrom(t *testing.T) {
 	assertAncestors([]types.Struct{a5}, 5, []types.Struct{})       // prune child b/c child.Height <= minHeight
 	assertAncestors([]types.Struct{a4, b2}, 3, []types.Struct{a3}) // prune 1 child b/c child.Height <= minHeight
 }
+
+func TestDiffCommitsAtPath(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	mustPath := func(str string) types.Path {
+		p, err := types.ParsePath(str)
+		assert.NoError(err)
+		return p
+	}
+	users := func(kv ...interface{}) types.Map {
+		m := types.NewMap()
+		for i := 0; i < len(kv); i += 2 {
+			m = m.Set(types.String(kv[i].(string)), types.Number(kv[i+1].(int)))
+		}
+		return m
+	}
+	commit := func(ds Dataset, users, other types.Value) Dataset {
+		// The users are kept behind a Ref, which DiffCommitsAtPath follows.
+		v := types.NewStruct("Root", types.StructData{"users": db.WriteValue(users), "other": other})
+		ds, err := db.CommitValue(ds, v)
+		assert.NoError(err)
+		return ds
+	}
+
+	ds := db.GetDataset("ds")
+	ds = commit(ds, users("alice", 1, "bob", 2), types.Number(1))
+	c1 := ds.Head()
+	ds = commit(ds, users("bob", 3, "carol", 4), types.Number(2))
+	c2 := ds.Head()
+
+	diffs := DiffCommitsAtPath(c1, c2, mustPath(".value.users"), db)
+	assert.Len(diffs, 3)
+	expected := []types.Difference{
+		{mustPath(`.value.users["alice"]`), types.DiffChangeRemoved, types.Number(1), nil},
+		{mustPath(`.value.users["bob"]`), types.DiffChangeModified, types.Number(2), types.Number(3)},
+		{mustPath(`.value.users["carol"]`), types.DiffChangeAdded, nil, types.Number(4)},
+	}
+	for i, diff := range diffs {
+		assert.Equal(expected[i].Path.String(), diff.Path.String())
+		assert.Equal(expected[i].ChangeType, diff.ChangeType)
+		assert.True(expected[i].OldValue == nil && diff.OldValue == nil || expected[i].OldValue.Equals(diff.OldValue))
+		assert.True(expected[i].NewValue == nil && diff.NewValue == nil || expected[i].NewValue.Equals(diff.NewValue))
+	}
+
+	diffs = DiffCommitsAtPath(c1, c2, mustPath(`.value.users["bob"]`), db)
+	assert.Len(diffs, 1)
+	assert.Equal(`.value.users["bob"]`, diffs[0].Path.String())
+
+	// Nothing changed under a path that's the same in both, or in neither.
+	assert.Empty(DiffCommitsAtPath(c1, c1, mustPath(".value"), db))
+	assert.Empty(DiffCommitsAtPath(c1, c2, mustPath(".value.missing"), db))
+
+	diffs = DiffCommitsAtPath(c1, c2, mustPath(`.value.users["carol"]`), db)
+	assert.Len(diffs, 1)
+	assert.Equal(types.DiffChangeAdded, diffs[0].ChangeType)
+	assert.Equal(`.value.users["carol"]`, diffs[0].Path.String())
+
+	assert.Panics(func() { DiffCommitsAtPath(types.EmptyStruct, c2, types.Path{}, db) })
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// runContext runs |f|, an operation on |db|, so that if db is a remote Database, the requests f makes of its server, and f's waits for them, give up once |ctx| is done. If they do, or ctx is done before f is run, runContext returns ctx.Err(). A request that's given up on may still be carried out by the server, and writes that f flushed are left to finish in the background, but db's view of its datasets isn't changed. Operations on a local Database aren't interrupted once they've started.
+func runContext(ctx context.Context, db Database, f func()) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	defer db.useContext(ctx)()
+	defer func() {
+		if ctx.Err() != nil {
+			if r := recover(); r != nil {
+				err = ctx.Err()
+			}
+		}
+	}()
+	f()
+	return
+}
+
+// updateContext runs |f|, which changes the head of |ds|, with runContext, returning what f does, or |ds| as it was along with ctx.Err() if |ctx| is done first.
+func updateContext(ctx context.Context, db Database, ds Dataset, f func() (Dataset, error)) (Dataset, error) {
+	var err error
+	if cerr := runContext(ctx, db, func() { ds, err = f() }); cerr != nil {
+		return ds, cerr
+	}
+	return ds, err
+}
+
+// ReadValueContext is like db.ReadValue(), but gives up, returning ctx.Err(), if |ctx| is done before the value is read.
+func ReadValueContext(ctx context.Context, db Database, h hash.Hash) (v types.Value, err error) {
+	err = runContext(ctx, db, func() { v = db.ReadValue(h) })
+	return
+}
+
+// GetDatasetContext is like db.GetDataset(), but gives up, returning ctx.Err(), if |ctx| is done before the datasets of db are read.
+func GetDatasetContext(ctx context.Context, db Database, datasetID string) (ds Dataset, err error) {
+	err = runContext(ctx, db, func() { ds = db.GetDataset(datasetID) })
+	return
+}
+
+// CommitContext is like db.Commit(), but gives up, returning |ds| and ctx.Err(), if |ctx| is done before the commit is. The commit may still be made by the server if the request to make it was already sent, which Rebase() shows. A merge, which is done when opts.MergePolicy is set and the head of ds has moved, isn't interrupted.
+func CommitContext(ctx context.Context, db Database, ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return updateContext(ctx, db, ds, func() (Dataset, error) { return db.Commit(ds, v, opts) })
+}
+
+// DeleteContext is like db.Delete(), but gives up, returning |ds| and ctx.Err(), if |ctx| is done first, as CommitContext does.
+func DeleteContext(ctx context.Context, db Database, ds Dataset) (Dataset, error) {
+	return updateContext(ctx, db, ds, func() (Dataset, error) { return db.Delete(ds) })
+}
+
+// SetHeadContext is like db.SetHead(), but gives up, returning |ds| and ctx.Err(), if |ctx| is done first, as CommitContext does.
+func SetHeadContext(ctx context.Context, db Database, ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateContext(ctx, db, ds, func() (Dataset, error) { return db.SetHead(ds, newHeadRef) })
+}
+
+// FastForwardContext is like db.FastForward(), but gives up, returning |ds| and ctx.Err(), if |ctx| is done first, as CommitContext does.
+func FastForwardContext(ctx context.Context, db Database, ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateContext(ctx, db, ds, func() (Dataset, error) { return db.FastForward(ds, newHeadRef) })
+}
+
+// RebaseContext is like db.Rebase(), but gives up, returning ctx.Err() and leaving db's view of its datasets as it was, if |ctx| is done first.
+func RebaseContext(ctx context.Context, db Database) error {
+	return runContext(ctx, db, db.Rebase)
+}
+
+// FlushContext is like db.Flush(), but stops waiting, returning ctx.Err(), if |ctx| is done before the values written to db are persistent. They're still sent to the server in the background.
+func FlushContext(ctx context.Context, db Database) error {
+	return runContext(ctx, db, db.Flush)
+}
+
+// MaybeHeadContext is like ds.MaybeHead(), but gives up, returning ctx.Err(), if |ctx| is done before the head is read.
+func (ds Dataset) MaybeHeadContext(ctx context.Context) (head types.Struct, ok bool, err error) {
+	err = runContext(ctx, ds.Database(), func() { head, ok = ds.MaybeHead() })
+	return
+}
+
+// MaybeHeadValueContext is like ds.MaybeHeadValue(), but gives up, returning ctx.Err(), if |ctx| is done before the head is read.
+func (ds Dataset) MaybeHeadValueContext(ctx context.Context) (v types.Value, ok bool, err error) {
+	err = runContext(ctx, ds.Database(), func() { v, ok = ds.MaybeHeadValue() })
+	return
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestContextRemote(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	u, err := url.Parse(fmt.Sprintf("http://localhost:%d", <-portChan))
+	assert.NoError(err)
+
+	// The server hangs, other than to say what the root is, until gate is closed.
+	gate := make(chan struct{})
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != constants.RootPath {
+			<-gate
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer hung.Close()
+
+	db := NewRemoteDatabase(hung.URL, "")
+	defer db.Close()
+	ds := db.GetDataset("ds")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ReadValueContext(ctx, db, hash.FromData([]byte("absent")))
+	assert.Equal(context.DeadlineExceeded, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ds, err = CommitContext(ctx, db, ds, types.String("hung"), CommitOptions{})
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal("ds", ds.ID())
+	_, ok := ds.MaybeHeadRef()
+	assert.False(ok)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(context.Canceled, FlushContext(ctx, db))
+
+	close(gate)
+	ds, err = CommitContext(context.Background(), db, ds, types.String("unhung"), CommitOptions{})
+	assert.NoError(err)
+	v, ok, err := ds.MaybeHeadValueContext(context.Background())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(types.String("unhung"), v)
+}
+
+func TestContextLocal(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	ds, err := CommitContext(context.Background(), db, db.GetDataset("ds"), types.String("a"), CommitOptions{})
+	assert.NoError(err)
+	head, ok, err := ds.MaybeHeadContext(context.Background())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.True(head.Equals(ds.Head()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ReadValueContext(ctx, db, ds.HeadRef().TargetHash())
+	assert.Equal(context.Canceled, err)
+	_, err = CommitContext(ctx, db, ds, types.String("b"), CommitOptions{})
+	assert.Equal(context.Canceled, err)
+	assert.Equal(types.String("a"), db.GetDataset("ds").HeadValue())
+}
@@ -6,6 +6,7 @@
 package datas
 
 import (
+	"context"
 	"io"
 
 	"github.com/stormasm/noms/go/chunks"
@@ -49,7 +50,9 @@ type Database interface {
 	// The returned Dataset is always the newest snapshot, regardless of
 	// success or failure, and Datasets() is updated to match backing storage
 	// upon return as well. If the update cannot be performed, e.g., because
-	// of a conflict, Commit returns an 'ErrMergeNeeded' error.
+	// of a conflict, Commit returns an 'ErrMergeNeeded' error, unless
+	// opts.MergePolicy is set, in which case the commit is rebased onto the
+	// new head and tried again.
 	Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error)
 
 	// CommitValue updates the Commit that ds.ID() in this database points at.
@@ -94,8 +97,44 @@ type Database interface {
 	// Regardless, Datasets() is updated to match backing storage upon return.
 	FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error)
 
+	// CommitE is like Commit, but returns ds and an error rather than
+	// panicking, e.g. if one of opts.Parents isn't a Commit, or if this
+	// Database can't be written to, so that programs that embed Noms, such
+	// as servers, can handle failures without recovering panics themselves.
+	// Errors that Commit returns are returned as they are.
+	CommitE(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error)
+
+	// CommitValueE is like CommitValue, but returns errors as CommitE does.
+	CommitValueE(ds Dataset, v types.Value) (Dataset, error)
+
+	// DeleteE is like Delete, but returns errors as CommitE does.
+	DeleteE(ds Dataset) (Dataset, error)
+
+	// SetHeadE is like SetHead, but returns errors as CommitE does,
+	// including if newHeadRef doesn't refer to a Commit.
+	SetHeadE(ds Dataset, newHeadRef types.Ref) (Dataset, error)
+
+	// FastForwardE is like FastForward, but returns errors as SetHeadE does.
+	FastForwardE(ds Dataset, newHeadRef types.Ref) (Dataset, error)
+
+	// Rebase brings this Database's view of its datasets up to date with its
+	// backing storage, picking up any changes made by other clients since it
+	// was opened or last modified through this Database.
+	Rebase()
+
+	// Flush makes all Values that have been written to this Database
+	// persistent, without committing them, and returns once they are. A
+	// Database of a remote server buffers the Values written to it, sending
+	// them when enough have built up, after a while, or when flushed or
+	// committed, so it's seldom necessary to call this, except to get a
+	// large write to the server before doing something slow.
+	Flush()
+
 	has(h hash.Hash) bool
+	setAuditor(a *auditor)
+	hasMany(hashes hash.HashSet) (absent hash.HashSet)
 	validatingBatchStore() types.BatchStore
+	useContext(ctx context.Context) (restore func())
 }
 
 func NewDatabase(cs chunks.ChunkStore) Database {
@@ -5,12 +5,17 @@
 package datas
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/merge"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/logging"
+	"github.com/stormasm/noms/go/util/tracing"
 )
 
 type databaseCommon struct {
@@ -19,6 +24,8 @@ type databaseCommon struct {
 	rt       chunks.RootTracker
 	rootHash hash.Hash
 	datasets *types.Map
+	// audit, if not nil, records each change to the head of a dataset in the audit dataset; see EnableAudit.
+	audit *auditor
 }
 
 var (
@@ -63,15 +70,48 @@ func getDataset(db Database, datasetID string) Dataset {
 	return Dataset{store: db, id: datasetID}
 }
 
+func (dbc *databaseCommon) Rebase() {
+	dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil
+}
+
 func (dbc *databaseCommon) has(h hash.Hash) bool {
 	return dbc.cch.Has(h)
 }
 
+func (dbc *databaseCommon) hasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	return dbc.cch.HasMany(hashes)
+}
+
+// useContext makes the requests dbc sends to its server, if it has one, give up once |ctx| is done, until |restore| is called; see runContext.
+func (dbc *databaseCommon) useContext(ctx context.Context) (restore func()) {
+	switch bs := dbc.rt.(type) {
+	case *httpBatchStore:
+		return bs.useContext(ctx)
+	case *tieredBatchStore:
+		return bs.useContext(ctx)
+	}
+	return func() {}
+}
+
+// context returns the context that the requests dbc sends to its server, if it has one, are made with, as set by useContext.
+func (dbc *databaseCommon) context() context.Context {
+	switch bs := dbc.rt.(type) {
+	case *httpBatchStore:
+		return bs.context()
+	case *tieredBatchStore:
+		return bs.context()
+	}
+	return context.Background()
+}
+
 func (dbc *databaseCommon) Close() error {
 	return dbc.ValueStore.Close()
 }
 
 func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref) error {
+	if err := dbc.checkNotAudit(ds.ID()); err != nil {
+		return err
+	}
 	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
 		return nil
 	}
@@ -82,10 +122,13 @@ func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref) error {
 	commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
 
 	currentDatasets = currentDatasets.Set(types.String(ds.ID()), commitRef)
-	return dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+	return dbc.tryUpdateRoot(currentDatasets, currentRootHash, ds.ID(), auditSetHead)
 }
 
 func (dbc *databaseCommon) doFastForward(ds Dataset, newHeadRef types.Ref) error {
+	if err := dbc.checkNotAudit(ds.ID()); err != nil {
+		return err
+	}
 	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
 		return nil
 	} else if newHeadRef.Height() <= currentHeadRef.Height() {
@@ -93,12 +136,15 @@ func (dbc *databaseCommon) doFastForward(ds Dataset, newHeadRef types.Ref) error
 	}
 
 	commit := dbc.validateRefAsCommit(newHeadRef)
-	return dbc.doCommit(ds.ID(), commit)
+	return dbc.doCommit(ds.ID(), auditFastForward, commit)
 }
 
 // doCommit manages concurrent access the single logical piece of mutable state: the current Root. doCommit is optimistic in that it is attempting to update head making the assumption that currentRootHash is the hash of the current head. The call to UpdateRoot below will return an 'ErrOptimisticLockFailed' error if that assumption fails (e.g. because of a race with another writer) and the entire algorithm must be tried again. This method will also fail and return an 'ErrMergeNeeded' error if the |commit| is not a descendent of the current dataset head
-func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct) error {
+func (dbc *databaseCommon) doCommit(datasetID, op string, commit types.Struct) error {
 	d.PanicIfTrue(!IsCommitType(commit.Type()), "Can't commit a non-Commit struct to dataset %s", datasetID)
+	if err := dbc.checkNotAudit(datasetID); err != nil {
+		return err
+	}
 	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
 
 	// This could loop forever, given enough simultaneous committers. BUG 2565
@@ -125,13 +171,75 @@ func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct) error
 			}
 		}
 		currentDatasets = currentDatasets.Set(types.String(datasetID), commitRef)
-		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash, datasetID, op)
+		if err == ErrOptimisticLockFailed {
+			logging.Debug("root changed while committing, retrying", logging.F("dataset", datasetID), logging.F("op", op))
+		}
+	}
+	return err
+}
+
+// doCommitWithRebase commits |v| to |ds| as doCommit does. If that fails with ErrMergeNeeded, and |opts| has a MergePolicy, the commit is rebased onto the new head of ds and tried again, up to opts.MaxRetries times. A merge conflict that the policy can't resolve is returned as a *merge.ErrMergeConflict. The commit is traced as a span, the parent of those of the requests it makes.
+func (dbc *databaseCommon) doCommitWithRebase(ds Dataset, v types.Value, opts CommitOptions) (err error) {
+	defer logging.Slow(time.Now(), "slow commit", logging.F("dataset", ds.ID()))
+	ctx, span := tracing.Start(dbc.context(), "noms.commit")
+	defer dbc.useContext(ctx)()
+	merges := 0
+	defer func() {
+		span.SetTag("dataset", ds.ID())
+		span.SetTag("merges", merges)
+		if err != nil {
+			span.SetTag("error", err.Error())
+		}
+		span.Finish()
+	}()
+	commit := buildNewCommit(ds, v, opts)
+	err = dbc.doCommit(ds.ID(), auditCommit, commit)
+	if opts.MergePolicy == nil {
+		return err
+	}
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = DefaultCommitRetries
+	}
+	// base is the head that commit was built on, which the head that got in first replaces among its parents.
+	base, _ := ds.MaybeHeadRef()
+	for i := 0; err == ErrMergeNeeded && i < retries; i++ {
+		merges++
+		logging.Debug("head changed while committing, merging", logging.F("dataset", ds.ID()), logging.F("retry", i+1))
+		// doCommit has already caught up with the root, so this is the head that got in first.
+		headRef, ok := dbc.maybeHeadRef(ds.ID())
+		if !ok {
+			return err
+		}
+		head := headRef.TargetValue(dbc).(types.Struct)
+		ancestor, ok := FindCommonAncestor(commit, head, dbc)
+		if !ok {
+			return err
+		}
+		// Merging reads values on goroutines of its own, where giving up on a request would panic with nothing to recover, so a merge isn't canceled, even by CommitContext.
+		restore := dbc.useContext(context.WithoutCancel(ctx))
+		merged, mergeErr := merge.ThreeWay(commit.Get(ValueField), head.Get(ValueField), ancestor.Get(ValueField), dbc, opts.MergePolicy, nil)
+		restore()
+		if mergeErr != nil {
+			return mergeErr
+		}
+		parents := commit.Get(ParentsField).(types.Set)
+		if (base != types.Ref{}) {
+			parents = parents.Remove(base)
+		}
+		commit = NewCommit(merged, parents.Insert(headRef), commit.Get(MetaField).(types.Struct))
+		base = headRef
+		err = dbc.doCommit(ds.ID(), auditCommit, commit)
 	}
 	return err
 }
 
 // doDelete manages concurrent access the single logical piece of mutable state: the current Root. doDelete is optimistic in that it is attempting to update head making the assumption that currentRootHash is the hash of the current head. The call to UpdateRoot below will return an 'ErrOptimisticLockFailed' error if that assumption fails (e.g. because of a race with another writer) and the entire algorithm must be tried again.
 func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
+	if err := dbc.checkNotAudit(datasetIDstr); err != nil {
+		return err
+	}
 	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
 
 	datasetID := types.String(datasetIDstr)
@@ -146,10 +254,11 @@ func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
 	var err error
 	for {
 		currentDatasets = currentDatasets.Remove(datasetID)
-		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash, datasetIDstr, auditDelete)
 		if err != ErrOptimisticLockFailed {
 			break
 		}
+		logging.Debug("root changed while deleting, retrying", logging.F("dataset", datasetIDstr))
 		// If the optimistic lock failed because someone changed the Head of datasetID, then return ErrMergeNeeded. If it failed because someone changed a different Dataset, we should try again.
 		currentRootHash, currentDatasets = dbc.getRootAndDatasets()
 		if r, hasHead := currentDatasets.MaybeGet(datasetID); !hasHead || (hasHead && !initialHead.Equals(r)) {
@@ -171,7 +280,11 @@ func (dbc *databaseCommon) getRootAndDatasets() (currentRootHash hash.Hash, curr
 	return
 }
 
-func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash) (err error) {
+// tryUpdateRoot makes |currentDatasets| the root, provided it's still |currentRootHash|. |op| is the change to the dataset |datasetID| that currentDatasets makes, which is recorded along with it if dbc is audited.
+func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash, datasetID, op string) (err error) {
+	if dbc.audit != nil {
+		currentDatasets = dbc.audit.record(dbc, currentDatasets, currentRootHash, datasetID, op)
+	}
 	// TODO: This Map will be orphaned if the UpdateRoot below fails
 	newRootRef := dbc.WriteValue(currentDatasets).TargetHash()
 	// If the root has been updated by another process in the short window since we read it, this call will fail. See issue #404
@@ -181,6 +294,16 @@ func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootH
 	return
 }
 
+// readParents reads the parents given in |opts|, if any, so that they're known to exist when the commit that refers to them is written, even if they were only just pulled into dbc.
+func (dbc *databaseCommon) readParents(opts CommitOptions) {
+	if (opts.Parents == types.Set{}) {
+		return
+	}
+	opts.Parents.IterAll(func(v types.Value) {
+		dbc.validateRefAsCommit(v.(types.Ref))
+	})
+}
+
 func (dbc *databaseCommon) validateRefAsCommit(r types.Ref) types.Struct {
 	v := dbc.ReadValue(r.TargetHash())
 
@@ -5,14 +5,22 @@
 package datas
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/constants"
 	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/util/logging"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -22,20 +30,46 @@ type connectionState struct {
 }
 
 type RemoteDatabaseServer struct {
-	cs      chunks.ChunkStore
+	cs chunks.ChunkStore
+	// stores is set instead of cs if the server hosts many databases.
+	stores  *storePool
+	done    chan struct{}
 	port    int
 	l       *net.Listener
 	csChan  chan *connectionState
 	closing bool
 	// Called just before the server is started.
 	Ready func()
+	// If TLSCertFile and TLSKeyFile are set, the server only accepts HTTPS connections, using the certificate and key in those files.
+	TLSCertFile, TLSKeyFile string
+	// If Access is set, requests are only allowed if it grants them access; otherwise, anyone may read and write. A server hosting many databases uses Access.Database[name] for the database |name|, if it's set.
+	Access *AccessControl
+	// If ReadOnly is set, requests to write chunks or update the root are refused with 403 Forbidden, whatever Access allows.
+	ReadOnly bool
+	// If Log is set, a RequestLog is written to it, as a line of JSON, for each request the server serves.
+	Log io.Writer
+	// If Metrics is set, it keeps totals of the requests the server serves.
+	Metrics *ServerMetrics
 }
 
+// DefaultIdleTimeout is how long a server hosting many databases keeps each open after the last request for it.
+const DefaultIdleTimeout = 5 * time.Minute
+
 func NewRemoteDatabaseServer(cs chunks.ChunkStore, port int) *RemoteDatabaseServer {
 	dataVersion := cs.Version()
 	d.PanicIfTrue(constants.NomsVersion != dataVersion, "SDK version %s is incompatible with data of version %s", constants.NomsVersion, dataVersion)
 	return &RemoteDatabaseServer{
-		cs, port, nil, make(chan *connectionState, 16), false, func() {},
+		cs: cs, port: port, csChan: make(chan *connectionState, 16), Ready: func() {},
+	}
+}
+
+// NewMultiDatabaseServer returns a server which hosts many databases, serving the database |name| at /<name>/, e.g. its root at /<name>/root/. Each is opened with |open| when a request first needs it, and closed again once no request has needed it for |idleTimeout|, or DefaultIdleTimeout if that's 0.
+func NewMultiDatabaseServer(open StoreOpener, idleTimeout time.Duration, port int) *RemoteDatabaseServer {
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &RemoteDatabaseServer{
+		stores: newStorePool(open, idleTimeout), done: make(chan struct{}), port: port, csChan: make(chan *connectionState, 16), Ready: func() {},
 	}
 }
 
@@ -49,6 +83,11 @@ func (s *RemoteDatabaseServer) Run() {
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	d.Chk.NoError(err)
+	if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		d.PanicIfError(err)
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
 	s.l = &l
 	_, port, err := net.SplitHostPort(l.Addr().String())
 	d.Chk.NoError(err)
@@ -57,22 +96,38 @@ func (s *RemoteDatabaseServer) Run() {
 	fmt.Printf("Listening on port %d...\n", s.port)
 
 	router := httprouter.New()
+	prefix := ""
+	if s.stores != nil {
+		prefix = "/:" + dbParam
+		go s.stores.closeIdleEvery(s.stores.idleTimeout/2, s.done)
+	}
 
-	router.POST(constants.GetRefsPath, s.corsHandle(s.makeHandle(HandleGetRefs)))
-	router.OPTIONS(constants.GetRefsPath, s.corsHandle(noopHandle))
-	router.POST(constants.HasRefsPath, s.corsHandle(s.makeHandle(HandleHasRefs)))
-	router.OPTIONS(constants.HasRefsPath, s.corsHandle(noopHandle))
-	router.GET(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootGet)))
-	router.POST(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootPost)))
-	router.OPTIONS(constants.RootPath, s.corsHandle(noopHandle))
-	router.POST(constants.WriteValuePath, s.corsHandle(s.makeHandle(HandleWriteValue)))
-	router.OPTIONS(constants.WriteValuePath, s.corsHandle(noopHandle))
-	router.GET(constants.BasePath, s.corsHandle(s.makeHandle(HandleBaseGet)))
+	router.POST(prefix+constants.GetRefsPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleGetRefs))))
+	router.OPTIONS(prefix+constants.GetRefsPath, s.corsHandle(noopHandle))
+	router.GET(prefix+constants.GetRefPath+":hash", s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleGetRef))))
+	router.OPTIONS(prefix+constants.GetRefPath+":hash", s.corsHandle(noopHandle))
+	router.POST(prefix+constants.HasRefsPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleHasRefs))))
+	router.OPTIONS(prefix+constants.HasRefsPath, s.corsHandle(noopHandle))
+	router.POST(prefix+constants.WantRefsPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleWantRefs))))
+	router.OPTIONS(prefix+constants.WantRefsPath, s.corsHandle(noopHandle))
+	router.POST(prefix+constants.PullRefsPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandlePullRefs))))
+	router.OPTIONS(prefix+constants.PullRefsPath, s.corsHandle(noopHandle))
+	router.GET(prefix+constants.NotifyPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleNotify))))
+	router.OPTIONS(prefix+constants.NotifyPath, s.corsHandle(noopHandle))
+	router.GET(prefix+constants.RootPath, s.corsHandle(s.authorize(readAccess, s.makeHandle(HandleRootGet))))
+	router.POST(prefix+constants.RootPath, s.corsHandle(s.authorize(rootUpdateAccess, s.makeHandle(HandleRootPost))))
+	router.OPTIONS(prefix+constants.RootPath, s.corsHandle(noopHandle))
+	router.POST(prefix+constants.WriteValuePath, s.corsHandle(s.authorize(writeAccess, s.makeHandle(HandleWriteValue))))
+	router.OPTIONS(prefix+constants.WriteValuePath, s.corsHandle(noopHandle))
+	router.GET(prefix+constants.GraphQLPath, s.corsHandle(s.authorize(datasetReadAccess, s.makeHandle(HandleGraphQL))))
+	router.POST(prefix+constants.GraphQLPath, s.corsHandle(s.authorize(datasetReadAccess, s.makeHandle(HandleGraphQL))))
+	router.OPTIONS(prefix+constants.GraphQLPath, s.corsHandle(noopHandle))
+	router.GET(constants.BasePath, s.corsHandle(func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		HandleBaseGet(w, req, ps, s.cs)
+	}))
 
 	srv := &http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			router.ServeHTTP(w, req)
-		}),
+		Handler:   observe(router, s.Log, &sync.Mutex{}, s.Metrics, s.stores != nil),
 		ConnState: s.connState,
 	}
 
@@ -95,9 +150,112 @@ func (s *RemoteDatabaseServer) Run() {
 	srv.Serve(l)
 }
 
+// dbParam is the route parameter naming the database a request is for, on a server hosting many.
+const dbParam = "db"
+
 func (s *RemoteDatabaseServer) makeHandle(hndlr Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-		hndlr(w, req, ps, s.cs)
+		// Notifications are streamed for as long as the client wants them, so they're never slow.
+		if !strings.HasSuffix(req.URL.Path, constants.NotifyPath) {
+			defer logging.Slow(time.Now(), "slow request", logging.F("method", req.Method), logging.F("path", req.URL.Path))
+		}
+		cs, release, err := s.store(ps)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusNotFound)
+			return
+		}
+		defer release()
+		hndlr(w, req, ps, meterStore(req.Context(), cs))
+	}
+}
+
+// store returns the ChunkStore of the database a request with |ps| is for, and a func to call once the request is done with it.
+func (s *RemoteDatabaseServer) store(ps httprouter.Params) (chunks.ChunkStore, func(), error) {
+	if s.stores == nil {
+		return s.cs, func() {}, nil
+	}
+	name := ps.ByName(dbParam)
+	cs, err := s.stores.acquire(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cs, func() { s.stores.release(name) }, nil
+}
+
+// access returns the AccessControl for the database a request with |ps| is for, or nil if anyone may read and write it.
+func (s *RemoteDatabaseServer) access(ps httprouter.Params) *AccessControl {
+	if s.Access == nil || s.stores == nil {
+		return s.Access
+	}
+	if ac, ok := s.Access.Database[ps.ByName(dbParam)]; ok {
+		return ac
+	}
+	return s.Access
+}
+
+type accessKind int
+
+const (
+	// readAccess is needed to read the root or any chunks.
+	readAccess accessKind = iota
+	// writeAccess is needed to write chunks.
+	writeAccess
+	// rootUpdateAccess is needed to update the root, and requires write access to every dataset the update changes.
+	rootUpdateAccess
+	// datasetReadAccess is needed to read the dataset named by the ds parameter.
+	datasetReadAccess
+)
+
+// authorize wraps |f| so that, if s has an AccessControl, requests are only passed on to f if they're allowed |kind| of access. Otherwise, they fail with 401 Unauthorized if their token is unknown, or 403 Forbidden. If s is read-only, requests for anything but readAccess or datasetReadAccess fail with 403 Forbidden.
+func (s *RemoteDatabaseServer) authorize(kind accessKind, f httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if s.ReadOnly && kind != readAccess && kind != datasetReadAccess {
+			http.Error(w, "Error: server is read-only", http.StatusForbidden)
+			return
+		}
+		ac := s.access(ps)
+		if ac == nil {
+			f(w, req, ps)
+			return
+		}
+		g, ok := ac.grant(req)
+		if !ok {
+			http.Error(w, "Error: unknown auth token", http.StatusUnauthorized)
+			return
+		}
+		switch kind {
+		case readAccess:
+			ok = g.readsAnything()
+		case datasetReadAccess:
+			ok = g.CanRead(req.URL.Query().Get("ds"))
+		case writeAccess:
+			ok = g.writesAnything()
+		case rootUpdateAccess:
+			// If the hashes are malformed, f rejects the request anyway.
+			params := req.URL.Query()
+			last, lastOk := hash.MaybeParse(params.Get("last"))
+			current, currentOk := hash.MaybeParse(params.Get("current"))
+			if !lastOk || !currentOk {
+				break
+			}
+			cs, release, err := s.store(ps)
+			if err != nil {
+				break
+			}
+			changed := changedDatasets(cs, last, current)
+			release()
+			for _, id := range changed {
+				if !g.CanWrite(id) {
+					http.Error(w, fmt.Sprintf("Error: not allowed to write dataset %s", id), http.StatusForbidden)
+					return
+				}
+			}
+		}
+		if !ok {
+			http.Error(w, "Error: access denied", http.StatusForbidden)
+			return
+		}
+		f(w, req.WithContext(context.WithValue(req.Context(), privateResponsesKey{}, true)), ps)
 	}
 }
 
@@ -111,7 +269,7 @@ func (s *RemoteDatabaseServer) corsHandle(f httprouter.Handle) httprouter.Handle
 		// Can't use * when clients are using cookies.
 		w.Header().Add("Access-Control-Allow-Origin", r.Header.Get("Origin"))
 		w.Header().Add("Access-Control-Allow-Methods", "GET, POST")
-		w.Header().Add("Access-Control-Allow-Headers", NomsVersionHeader)
+		w.Header().Add("Access-Control-Allow-Headers", NomsVersionHeader+", Authorization, Content-Type")
 		w.Header().Add("Access-Control-Expose-Headers", NomsVersionHeader)
 		w.Header().Add(NomsVersionHeader, constants.NomsVersion)
 		f(w, r, ps)
@@ -130,6 +288,11 @@ func (s *RemoteDatabaseServer) connState(c net.Conn, cs http.ConnState) {
 func (s *RemoteDatabaseServer) Stop() {
 	s.closing = true
 	(*s.l).Close()
-	(s.cs).Close()
+	if s.stores != nil {
+		close(s.done)
+		s.stores.closeAll()
+	} else {
+		(s.cs).Close()
+	}
 	close(s.csChan)
 }
@@ -9,7 +9,9 @@ import (
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/merge"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/logging"
 	"github.com/attic-labs/testify/assert"
 	"github.com/attic-labs/testify/suite"
 )
@@ -265,12 +267,23 @@ func (suite *DatabaseSuite) TestCommitWithConcurrentChunkStoreUse() {
 		w.preUpdateRootHook = nil
 	}
 
-	// Attempted Concurrent change, which should proceed without a problem
+	// Attempted Concurrent change, which should proceed without a problem, once it's been retried
+	retries := 0
 	ds1 = db.GetDataset(datasetID)
 	c := types.String("c")
-	ds1, err = db.CommitValue(ds1, c)
+	func() {
+		// The logger is restored even if CommitValue panics. Only the retries of this commit are counted, in case other tests are logging too.
+		logging.SetLogger(logging.LoggerFunc(func(level logging.Level, msg string, fields []logging.Field) {
+			if msg == "root changed while committing, retrying" && fields[0].Value == datasetID {
+				retries++
+			}
+		}), logging.LevelDebug)
+		defer logging.SetLogger(nil, logging.LevelDebug)
+		ds1, err = db.CommitValue(ds1, c)
+	}()
 	suite.NoError(err)
 	suite.True(ds1.HeadValue().Equals(c))
+	suite.Equal(1, retries)
 
 	// Concurrent change, to move root out from under my feet:
 	// ds1: |a| <- |b| <- |c| <- |e|
@@ -342,6 +355,76 @@ func (suite *DatabaseSuite) TestDeleteWithConcurrentChunkStoreUse() {
 	suite.False(present, "Dataset %s should not be present", datasetID)
 }
 
+func (suite *DatabaseSuite) TestRebase() {
+	other := suite.makeDb(suite.cs)
+	defer other.Close()
+	suite.True(other.Datasets().Empty())
+
+	_, err := suite.db.CommitValue(suite.db.GetDataset("ds1"), types.String("a"))
+	suite.NoError(err)
+	suite.True(other.Datasets().Empty())
+
+	other.Rebase()
+	suite.True(other.GetDataset("ds1").HeadValue().Equals(types.String("a")))
+}
+
+func (suite *DatabaseSuite) TestCommitRebase() {
+	m := func(kv ...interface{}) types.Map {
+		vals := make([]types.Value, len(kv))
+		for i, v := range kv {
+			if s, ok := v.(string); ok {
+				vals[i] = types.String(s)
+			} else {
+				vals[i] = types.Number(v.(int))
+			}
+		}
+		return types.NewMap(vals...)
+	}
+	ds, err := suite.db.CommitValue(suite.db.GetDataset("ds"), m("a", 1))
+	suite.NoError(err)
+
+	// Another client commits first, so committing on top of ds needs a merge.
+	other := suite.makeDb(suite.cs)
+	defer other.Close()
+	_, err = other.CommitValue(other.GetDataset("ds"), m("a", 1, "b", 2))
+	suite.NoError(err)
+	theirs := other.GetDataset("ds").HeadRef()
+
+	_, err = suite.db.CommitValue(ds, m("a", 1, "c", 3))
+	suite.Equal(ErrMergeNeeded, err)
+	meta := types.NewStruct("Meta", types.StructData{"author": types.String("me")})
+	rebased, err := suite.db.Commit(ds, m("a", 1, "c", 3), CommitOptions{Meta: meta, MergePolicy: merge.Fail})
+	suite.NoError(err)
+	suite.True(m("a", 1, "b", 2, "c", 3).Equals(rebased.HeadValue()))
+	suite.True(types.NewSet(theirs).Equals(rebased.Head().Get(ParentsField)))
+	suite.True(meta.Equals(rebased.Head().Get(MetaField)))
+
+	// Conflicting changes are only rebased if the policy can resolve them.
+	ds = rebased
+	other.Rebase()
+	_, err = other.CommitValue(other.GetDataset("ds"), m("a", 5, "b", 2, "c", 3))
+	suite.NoError(err)
+	_, err = suite.db.Commit(ds, m("a", 6, "b", 2, "c", 3), CommitOptions{MergePolicy: merge.Fail})
+	suite.IsType(&merge.ErrMergeConflict{}, err)
+	rebased, err = suite.db.Commit(ds, m("a", 6, "b", 2, "c", 3), CommitOptions{MergePolicy: merge.Ours})
+	suite.NoError(err)
+	suite.True(m("a", 6, "b", 2, "c", 3).Equals(rebased.HeadValue()))
+
+	// Parents other than the head that the commit was built on, such as those of a merge, are kept.
+	ds = rebased
+	side, err := suite.db.CommitValue(suite.db.GetDataset("side"), m("d", 4))
+	suite.NoError(err)
+	other.Rebase()
+	_, err = other.CommitValue(other.GetDataset("ds"), m("a", 6, "b", 7, "c", 3))
+	suite.NoError(err)
+	theirs = other.GetDataset("ds").HeadRef()
+	parents := types.NewSet(ds.HeadRef(), side.HeadRef())
+	rebased, err = suite.db.Commit(ds, m("a", 6, "b", 2, "c", 3, "d", 4), CommitOptions{Parents: parents, MergePolicy: merge.Fail})
+	suite.NoError(err)
+	suite.True(m("a", 6, "b", 7, "c", 3, "d", 4).Equals(rebased.HeadValue()))
+	suite.True(types.NewSet(theirs, side.HeadRef()).Equals(rebased.Head().Get(ParentsField)))
+}
+
 func (suite *DatabaseSuite) TestSetHead() {
 	var err error
 	datasetID := "ds1"
@@ -473,3 +556,61 @@ func (suite *DatabaseSuite) TestMetaOption() {
 	c := ds.Head()
 	suite.Equal(types.String("arv"), c.Get("meta").(types.Struct).Get("author"))
 }
+
+func TestLocalDatabaseStatsAndQuota(t *testing.T) {
+	assert := assert.New(t)
+	db := newLocalDatabase(chunks.NewAccountingStore(chunks.NewMemoryStore(), 1<<10))
+	defer db.Close()
+
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("small"))
+	assert.NoError(err)
+	stats := db.Stats()
+	assert.True(stats.Chunks > 0)
+	assert.Equal(stats.Bytes, stats.NovelBytes)
+	assert.Equal(uint64(0), db.Stats().NovelBytes)
+
+	big := types.String(string(make([]byte, 1<<10)))
+	_, err = db.CommitValue(ds, big)
+	assert.IsType(chunks.QuotaExceededError{}, err)
+	assert.Equal(stats.Bytes, db.Stats().Bytes)
+
+	// Stores that don't keep track are counted.
+	db2 := newLocalDatabase(chunks.NewMemoryStore())
+	defer db2.Close()
+	db2.CommitValue(db2.GetDataset("ds"), types.String("small"))
+	assert.Equal(stats.Chunks, db2.Stats().Chunks)
+}
+
+func TestReadOnlyDatabase(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	head := ds.HeadRef()
+
+	ro := NewReadOnlyDatabase(db)
+	assert.Equal(ro, NewReadOnlyDatabase(ro))
+	ds = ro.GetDataset("ds")
+	assert.Equal(ro, ds.Database())
+	assert.True(types.String("a").Equals(ds.HeadValue()))
+
+	ds, err = ds.Database().CommitValue(ds, types.String("b"))
+	assert.True(IsReadOnlyError(err))
+	assert.Equal(ReadOnlyError{"commit to", "ds"}, err)
+	assert.Equal(head, ds.HeadRef())
+	_, err = ro.Delete(ds)
+	assert.True(IsReadOnlyError(err))
+	_, err = ro.SetHead(ds, head)
+	assert.True(IsReadOnlyError(err))
+	_, err = ro.FastForward(ds, head)
+	assert.True(IsReadOnlyError(err))
+	assert.Panics(func() { ro.WriteValue(types.String("c")) })
+	assert.Equal(head, db.GetDataset("ds").HeadRef())
+
+	// A read-only Database still sees changes made through other Databases once rebased.
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("c"))
+	assert.NoError(err)
+	ro.Rebase()
+	assert.True(types.String("c").Equals(ro.GetDataset("ds").HeadValue()))
+}
@@ -5,6 +5,7 @@
 package datas
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/stormasm/noms/go/d"
@@ -19,6 +20,21 @@ var DatasetRe = regexp.MustCompile(`[a-zA-Z0-9\-_/]+`)
 // entirely legal Dataset name.
 var DatasetFullRe = regexp.MustCompile("^" + DatasetRe.String() + "$")
 
+// DatasetNotFoundError is returned, or by Head() and the like panicked with, when a Dataset that has no head is asked for it. ID is the ID of the Dataset.
+type DatasetNotFoundError struct {
+	ID string
+}
+
+func (e DatasetNotFoundError) Error() string {
+	return fmt.Sprintf("Dataset \"%s\" does not exist", e.ID)
+}
+
+// IsDatasetNotFoundError returns true if |err| was returned because a Dataset has no head.
+func IsDatasetNotFoundError(err error) bool {
+	_, ok := err.(DatasetNotFoundError)
+	return ok
+}
+
 // Dataset is a named Commit within a Database.
 type Dataset struct {
 	store   Database
@@ -51,10 +67,22 @@ func (ds Dataset) MaybeHead() (types.Struct, bool) {
 // the Dataset's value tree.
 func (ds Dataset) Head() types.Struct {
 	c, ok := ds.MaybeHead()
-	d.PanicIfFalse(ok, "Dataset \"%s\" does not exist", ds.id)
+	if !ok {
+		d.PanicIfError(DatasetNotFoundError{ds.id})
+	}
 	return c
 }
 
+// HeadE is like Head, but returns a DatasetNotFoundError if ds has no head, and any failure to read it as an error, rather than panicking.
+func (ds Dataset) HeadE() (head types.Struct, err error) {
+	r, ok := ds.MaybeHeadRef()
+	if !ok {
+		return types.Struct{}, DatasetNotFoundError{ds.id}
+	}
+	err = d.TryAll(func() { head = r.TargetValue(ds.Database()).(types.Struct) })
+	return
+}
+
 // MaybeHeadRef returns the Ref of the current Head Commit of this Dataset,
 // which contains the current root of the Dataset's value tree, if available.
 // If not, it returns an empty Ref and 'false'.
@@ -66,7 +94,9 @@ func (ds Dataset) MaybeHeadRef() (types.Ref, bool) {
 // current root of the Dataset's value tree.
 func (ds Dataset) HeadRef() types.Ref {
 	r, ok := ds.MaybeHeadRef()
-	d.PanicIfFalse(ok, "Dataset \"%s\" does not exist", ds.id)
+	if !ok {
+		d.PanicIfError(DatasetNotFoundError{ds.id})
+	}
 	return r
 }
 
@@ -85,6 +115,15 @@ func (ds Dataset) HeadValue() types.Value {
 	return c.Get(ValueField)
 }
 
+// HeadValueE is like HeadValue, but returns errors as HeadE does.
+func (ds Dataset) HeadValueE() (types.Value, error) {
+	c, err := ds.HeadE()
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ValueField), nil
+}
+
 func IsValidDatasetName(name string) bool {
 	return DatasetFullRe.MatchString(name)
 }
@@ -0,0 +1,113 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sort"
+
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// DatasetStats describes the storage used by the chunks reachable from the head of a dataset.
+type DatasetStats struct {
+	ID string
+	// Commits is the number of commits in the dataset's history, including the head.
+	Commits int
+	// HeadHeight is the height of the ref to the head.
+	HeadHeight uint64
+	// Chunks is the number of chunks reachable from the head, and TotalBytes how big they are.
+	Chunks     int
+	TotalBytes uint64
+	// UniqueBytes is how big those of the chunks are that aren't reachable from any other dataset, i.e. how much space deleting the dataset would free.
+	UniqueBytes uint64
+	// Largest are the largest of the chunks, biggest first.
+	Largest []ChunkSize
+}
+
+// ChunkSize is the size of a chunk, along with a description of the value it holds, e.g. "List" or "struct Photo".
+type ChunkSize struct {
+	Hash  hash.Hash
+	Desc  string
+	Bytes uint64
+}
+
+// ComputeDatasetStats traverses the history of every dataset in db, and returns a DatasetStats for each, ordered by ID. Each chunk is read once per dataset it's reachable from, however many times it's referred to, and chunks reachable from more than one dataset count towards each one's Chunks and TotalBytes, but not towards its UniqueBytes. Up to |largest| of the largest chunks of each dataset are reported.
+func ComputeDatasetStats(db Database, largest int) []DatasetStats {
+	stats := []DatasetStats{}
+	reached := []hash.HashSet{}
+	sizes := map[hash.Hash]uint64{}
+	owners := map[hash.Hash]int{}
+
+	db.Datasets().IterAll(func(k, v types.Value) {
+		headRef := v.(types.Ref)
+		st := DatasetStats{ID: string(k.(types.String)), HeadHeight: headRef.Height()}
+		visited := hash.HashSet{}
+		refs := types.RefSlice{headRef}
+		for len(refs) > 0 {
+			toGet := hash.HashSlice{}
+			for _, r := range refs {
+				if h := r.TargetHash(); !visited.Has(h) {
+					visited.Insert(h)
+					toGet = append(toGet, h)
+				}
+			}
+			refs = nil
+			for _, c := range db.validatingBatchStore().GetMany(toGet) {
+				if c.IsEmpty() {
+					continue
+				}
+				size := uint64(len(c.Data()))
+				v := types.DecodeValue(c, db)
+				sizes[c.Hash()] = size
+				owners[c.Hash()]++
+				st.Chunks++
+				st.TotalBytes += size
+				if IsCommitType(v.Type()) {
+					st.Commits++
+				}
+				st.Largest = addLargest(st.Largest, ChunkSize{c.Hash(), describeChunk(v), size}, largest)
+				refs = append(refs, getChunks(v)...)
+			}
+		}
+		stats = append(stats, st)
+		reached = append(reached, visited)
+	})
+
+	for i, visited := range reached {
+		for h := range visited {
+			if owners[h] == 1 {
+				stats[i].UniqueBytes += sizes[h]
+			}
+		}
+	}
+	return stats
+}
+
+// addLargest adds |cs| to |largest|, which is sorted biggest first, if it's one of the |n| biggest.
+func addLargest(largest []ChunkSize, cs ChunkSize, n int) []ChunkSize {
+	if n == 0 || (len(largest) == n && largest[n-1].Bytes >= cs.Bytes) {
+		return largest
+	}
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Bytes < cs.Bytes })
+	largest = append(largest, ChunkSize{})
+	copy(largest[i+1:], largest[i:])
+	largest[i] = cs
+	if len(largest) > n {
+		largest = largest[:n]
+	}
+	return largest
+}
+
+func describeChunk(v types.Value) string {
+	t := v.Type()
+	if IsCommitType(t) {
+		return "Commit"
+	}
+	if t.Kind() == types.StructKind {
+		return "struct " + t.Desc.(types.StructDesc).Name
+	}
+	return types.KindToString[t.Kind()]
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestComputeDatasetStats(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	sharedVal, bigVal := types.String("shared"), types.String(strings.Repeat("big", 1000))
+	shared, big := db.WriteValue(sharedVal), db.WriteValue(bigVal)
+	ds1, err := db.CommitValue(db.GetDataset("ds1"), shared)
+	assert.NoError(err)
+	ds1, err = db.CommitValue(ds1, types.NewStruct("", types.StructData{"shared": shared}))
+	assert.NoError(err)
+	ds2, err := db.CommitValue(db.GetDataset("ds2"), types.NewStruct("Thing", types.StructData{"shared": shared, "big": big}))
+	assert.NoError(err)
+
+	stats := ComputeDatasetStats(db, 1)
+	assert.Len(stats, 2)
+	sharedSize := uint64(len(types.EncodeValue(sharedVal, nil).Data()))
+
+	st1 := stats[0]
+	assert.Equal("ds1", st1.ID)
+	assert.Equal(2, st1.Commits)
+	assert.Equal(ds1.HeadRef().Height(), st1.HeadHeight)
+	assert.Equal(3, st1.Chunks)
+	assert.Equal(sharedSize, st1.TotalBytes-st1.UniqueBytes)
+	assert.Len(st1.Largest, 1)
+	assert.Equal("Commit", st1.Largest[0].Desc)
+
+	st2 := stats[1]
+	assert.Equal("ds2", st2.ID)
+	assert.Equal(1, st2.Commits)
+	assert.Equal(ds2.HeadRef().Height(), st2.HeadHeight)
+	assert.Equal(3, st2.Chunks)
+	assert.Equal(sharedSize, st2.TotalBytes-st2.UniqueBytes)
+	assert.Equal([]ChunkSize{{big.TargetHash(), "String", uint64(len(types.EncodeValue(bigVal, nil).Data()))}}, st2.Largest)
+}
+
+func TestAddLargest(t *testing.T) {
+	assert := assert.New(t)
+	largest := []ChunkSize{}
+	for _, size := range []uint64{3, 1, 4, 1, 5, 9, 2, 6} {
+		largest = addLargest(largest, ChunkSize{Bytes: size}, 3)
+	}
+	assert.Equal([]ChunkSize{{Bytes: 9}, {Bytes: 6}, {Bytes: 5}}, largest)
+	assert.Empty(addLargest(nil, ChunkSize{Bytes: 1}, 0))
+}
@@ -161,12 +161,23 @@ func TestHeadValueFunctions(t *testing.T) {
 	assert.True(ok)
 	assert.Equal(a, hv)
 
+	head, err := ds1.HeadE()
+	assert.NoError(err)
+	assert.True(head.Equals(ds1.Head()))
+	hv, err = ds1.HeadValueE()
+	assert.NoError(err)
+	assert.Equal(a, hv)
+
 	ds2 := store.GetDataset(id2)
 	assert.Panics(func() {
 		ds2.HeadValue()
 	})
 	_, ok = ds2.MaybeHeadValue()
 	assert.False(ok)
+	_, err = ds2.HeadE()
+	assert.Equal(DatasetNotFoundError{id2}, err)
+	_, err = ds2.HeadValueE()
+	assert.True(IsDatasetNotFoundError(err))
 }
 
 func TestIsValidDatasetName(t *testing.T) {
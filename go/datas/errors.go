@@ -0,0 +1,34 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// The functions in this file, and the Database methods ending in E, are like those of the same names without the E, but return the errors those would panic with, as d.TryAll does, so that programs that embed Noms, such as servers, can handle them without recovering panics themselves. Errors that the originals already return are returned as they are.
+
+// updateE runs |f|, which changes the head of |ds|, returning what it does, or |ds| as it was along with the error f panicked with.
+func updateE(ds Dataset, f func() (Dataset, error)) (Dataset, error) {
+	var err error
+	if perr := d.TryAll(func() { ds, err = f() }); perr != nil {
+		return ds, perr
+	}
+	return ds, err
+}
+
+// GetDatasetE is like db.GetDataset(), but returns an error rather than panicking, including if |datasetID| isn't a valid dataset name.
+func GetDatasetE(db Database, datasetID string) (ds Dataset, err error) {
+	err = d.TryAll(func() { ds = db.GetDataset(datasetID) })
+	return
+}
+
+// ReadValueE is like db.ReadValue(), but returns an error rather than panicking. A value that db doesn't have is returned as nil, without an error, as ReadValue does.
+func ReadValueE(db Database, h hash.Hash) (v types.Value, err error) {
+	err = d.TryAll(func() { v = db.ReadValue(h) })
+	return
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestErrorReturningFunctions(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	_, err := GetDatasetE(db, "not a dataset")
+	assert.Error(err)
+	ds, err := GetDatasetE(db, "ds")
+	assert.NoError(err)
+
+	ds, err = db.CommitValueE(ds, types.String("a"))
+	assert.NoError(err)
+	v, err := ReadValueE(db, ds.HeadRef().TargetHash())
+	assert.NoError(err)
+	assert.True(v.Equals(ds.Head()))
+
+	// A parent that isn't a Commit makes Commit panic, and CommitE return an error, leaving ds as it was.
+	notCommit := db.WriteValue(types.String("not a commit"))
+	ds2, err := db.CommitE(ds, types.String("b"), CommitOptions{Parents: types.NewSet(notCommit)})
+	assert.IsType(d.PanicError{}, err)
+	assert.Equal(ds.HeadRef(), ds2.HeadRef())
+	_, err = db.SetHeadE(ds, notCommit)
+	assert.Error(err)
+
+	// Errors Commit returns are returned as they are.
+	_, err = NewReadOnlyDatabase(db).CommitValueE(ds, types.String("c"))
+	assert.True(IsReadOnlyError(err))
+
+	ds, err = db.DeleteE(ds)
+	assert.NoError(err)
+	_, err = ds.HeadE()
+	assert.True(IsDatasetNotFoundError(err))
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// fsckBatchSize is the number of chunks Fsck() reads at a time.
+const fsckBatchSize = 1 << 10
+
+// FsckProblem is something wrong with a chunk that Fsck() found.
+type FsckProblem struct {
+	// Hash is the hash of the chunk with the problem.
+	Hash hash.Hash
+	// Dataset is the dataset the chunk was first reached from, or "" if it's part of the root.
+	Dataset string
+	// Head is true if the chunk is the head of Dataset, in which case deleting Dataset gets rid of the problem.
+	Head bool
+	Msg  string
+}
+
+func (p FsckProblem) String() string {
+	switch {
+	case p.Dataset == "":
+		return fmt.Sprintf("root: chunk %s %s", p.Hash, p.Msg)
+	case p.Head:
+		return fmt.Sprintf("%s: head %s %s", p.Dataset, p.Hash, p.Msg)
+	}
+	return fmt.Sprintf("%s: chunk %s %s", p.Dataset, p.Hash, p.Msg)
+}
+
+type fsckRef struct {
+	ref     types.Ref
+	dataset string
+	head    bool
+}
+
+// Fsck checks the integrity of db. It reads every chunk reachable from the root, starting with the head of each dataset, and checks that each one is present, that its data matches its hash, and that every head, and every parent of a commit, is a well formed commit. It returns the number of chunks it checked and the problems it found. If |progress| isn't nil, it's called with the number of chunks checked so far after each batch of them.
+func Fsck(db Database, progress func(checked int)) (checked int, problems []FsckProblem) {
+	root := db.Datasets()
+	queue := []fsckRef{}
+	root.IterAll(func(k, v types.Value) {
+		r, ok := v.(types.Ref)
+		if !ok || !IsRefOfCommitType(r.Type()) {
+			problems = append(problems, FsckProblem{v.Hash(), string(k.(types.String)), true, fmt.Sprintf("is a %s, not a Ref<Commit>", v.Type().Describe())})
+			return
+		}
+		queue = append(queue, fsckRef{r, string(k.(types.String)), true})
+	})
+	root.WalkRefs(func(r types.Ref) {
+		queue = append(queue, fsckRef{r, "", false})
+	})
+
+	visited := hash.HashSet{}
+	for len(queue) > 0 {
+		batch := []fsckRef{}
+		for len(queue) > 0 && len(batch) < fsckBatchSize {
+			fr := queue[0]
+			queue = queue[1:]
+			if h := fr.ref.TargetHash(); !visited.Has(h) {
+				visited.Insert(h)
+				batch = append(batch, fr)
+			}
+		}
+		hashes := make(hash.HashSlice, len(batch))
+		for i, fr := range batch {
+			hashes[i] = fr.ref.TargetHash()
+		}
+
+		for i, v := range db.ReadManyValues(hashes) {
+			fr := batch[i]
+			problem := func(format string, args ...interface{}) {
+				problems = append(problems, FsckProblem{hashes[i], fr.dataset, fr.head, fmt.Sprintf(format, args...)})
+			}
+			checked++
+			if v == nil {
+				problem("is missing")
+				continue
+			}
+			if v.Hash() != hashes[i] {
+				problem("is corrupt: its data hashes to %s", v.Hash())
+				continue
+			}
+			if IsRefOfCommitType(fr.ref.Type()) && !IsCommitType(v.Type()) {
+				problem("should be a commit, but is a %s", v.Type().Describe())
+				continue
+			}
+			v.WalkRefs(func(r types.Ref) {
+				queue = append(queue, fsckRef{r, fr.dataset, false})
+			})
+		}
+		if progress != nil {
+			progress(checked)
+		}
+	}
+	return
+}
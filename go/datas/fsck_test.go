@@ -0,0 +1,84 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// hidingStore pretends not to have the chunks in |hidden|.
+type hidingStore struct {
+	*chunks.MemoryStore
+	hidden hash.HashSet
+}
+
+func (s hidingStore) Get(h hash.Hash) chunks.Chunk {
+	if s.hidden.Has(h) {
+		return chunks.EmptyChunk
+	}
+	return s.MemoryStore.Get(h)
+}
+
+func (s hidingStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	cs := make([]chunks.Chunk, len(hashes))
+	for i, h := range hashes {
+		cs[i] = s.Get(h)
+	}
+	return cs
+}
+
+func (s hidingStore) Has(h hash.Hash) bool {
+	return !s.hidden.Has(h) && s.MemoryStore.Has(h)
+}
+
+func TestFsck(t *testing.T) {
+	assert := assert.New(t)
+	ms := chunks.NewMemoryStore()
+	db := NewDatabase(ms)
+	str := db.WriteValue(types.String("a string of its own"))
+	num := db.WriteValue(types.Number(42))
+	ds1, err := db.CommitValue(db.GetDataset("ds1"), types.NewStruct("", types.StructData{"str": str, "num": num}))
+	assert.NoError(err)
+	ds1, err = db.CommitValue(ds1, types.NewStruct("", types.StructData{"str": str}))
+	assert.NoError(err)
+	ds2, err := db.CommitValue(db.GetDataset("ds2"), types.NewList(types.Number(1)))
+	assert.NoError(err)
+	db.Close()
+
+	checked, problems := Fsck(NewDatabase(ms), nil)
+	assert.Equal(5, checked) // 3 commits, str and num
+	assert.Empty(problems)
+
+	// num is only referred to by the first commit of ds1, so it's reached through its parents.
+	ms.Put(chunks.NewChunkWithHash(num.TargetHash(), types.EncodeValue(types.Number(43), nil).Data()))
+	hidden := hash.HashSet{}
+	hidden.Insert(ds2.HeadRef().TargetHash())
+	progress := 0
+	_, problems = Fsck(NewDatabase(hidingStore{ms, hidden}), func(checked int) { progress = checked })
+	assert.True(progress > 0)
+	assert.Equal([]FsckProblem{
+		{ds2.HeadRef().TargetHash(), "ds2", true, "is missing"},
+		{num.TargetHash(), "ds1", false, "is corrupt: its data hashes to " + types.Number(43).Hash().String()},
+	}, sortProblems(problems))
+	assert.Equal("ds2: head "+ds2.HeadRef().TargetHash().String()+" is missing", problems[0].String())
+}
+
+// sortProblems puts head problems first, since the order of the others depends on the order the chunks are visited in.
+func sortProblems(problems []FsckProblem) []FsckProblem {
+	sorted := []FsckProblem{}
+	for _, head := range []bool{true, false} {
+		for _, p := range problems {
+			if p.Head == head {
+				sorted = append(sorted, p)
+			}
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer serves a database over gRPC, as the service described by grpc.proto, which GRPCStore is a client of. It offers what a RemoteDatabaseServer does for a single database, except GraphQL queries, but the calls of many clients share each connection, and they carry deadlines, which the server stops work at.
+type GRPCServer struct {
+	cs   chunks.ChunkStore
+	port int
+	srv  *grpc.Server
+	// Called just before the server is started.
+	Ready func()
+	// If TLSCertFile and TLSKeyFile are set, the server only accepts TLS connections, using the certificate and key in those files.
+	TLSCertFile, TLSKeyFile string
+	// If Access is set, calls are only allowed if it grants the token in their "authorization" metadata access; otherwise, anyone may read and write.
+	Access *AccessControl
+	// If ReadOnly is set, calls which would write chunks or update the root fail with PERMISSION_DENIED, whatever Access allows.
+	ReadOnly bool
+}
+
+func NewGRPCServer(cs chunks.ChunkStore, port int) *GRPCServer {
+	dataVersion := cs.Version()
+	d.PanicIfTrue(constants.NomsVersion != dataVersion, "SDK version %s is incompatible with data of version %s", constants.NomsVersion, dataVersion)
+	return &GRPCServer{cs: cs, port: port, Ready: func() {}}
+}
+
+// Port is the actual port used. This may be different than the port passed in to NewGRPCServer.
+func (s *GRPCServer) Port() int {
+	return s.port
+}
+
+// Run blocks while the GRPCServer is listening. Running on a separate go routine is supported.
+func (s *GRPCServer) Run() {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	d.Chk.NoError(err)
+	opts := []grpc.ServerOption{grpc.ForceServerCodec(grpcCodec{}), grpc.MaxRecvMsgSize(grpcMaxMessageSize), grpc.MaxSendMsgSize(grpcMaxMessageSize)}
+	if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.TLSCertFile, s.TLSKeyFile)
+		d.PanicIfError(err)
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s.srv = grpc.NewServer(opts...)
+	s.srv.RegisterService(&grpcServiceDesc, s)
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	d.Chk.NoError(err)
+	s.port, err = strconv.Atoi(port)
+	d.Chk.NoError(err)
+	fmt.Printf("Listening on port %d...\n", s.port)
+
+	go s.Ready()
+	s.srv.Serve(l)
+}
+
+// Will cause the GRPCServer to stop listening, end the calls in progress, and an existing call to Run() to continue.
+func (s *GRPCServer) Stop() {
+	s.srv.Stop()
+	s.cs.Close()
+}
+
+// authorize returns the Grant for the call with |ctx|, or an error if the call isn't allowed |kind| of access. The writes of a rootUpdateAccess call are checked dataset by dataset by the caller.
+func (s *GRPCServer) authorize(ctx context.Context, kind accessKind) (g Grant, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vers := md.Get(NomsVersionHeader); len(vers) > 0 && vers[0] != constants.NomsVersion {
+		return Grant{}, status.Errorf(codes.FailedPrecondition, "SDK version %s is incompatible with data of version %s", vers[0], constants.NomsVersion)
+	}
+	if s.ReadOnly && kind != readAccess {
+		return Grant{}, status.Error(codes.PermissionDenied, "server is read-only")
+	}
+	if s.Access == nil {
+		return Grant{Write: []string{"*"}}, nil
+	}
+	token := ""
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		token = strings.TrimPrefix(auth[0], "Bearer ")
+	}
+	g, ok := s.Access.GrantFor(token)
+	if !ok {
+		return Grant{}, status.Error(codes.Unauthenticated, "unknown auth token")
+	}
+	if (kind == readAccess && !g.readsAnything()) || (kind != readAccess && !g.writesAnything()) {
+		return Grant{}, status.Error(codes.PermissionDenied, "not allowed")
+	}
+	return g, nil
+}
+
+// recoverGRPCError recovers from a panic in a handler, and sets |err| to a gRPC error describing it, so that the server isn't brought down.
+func recoverGRPCError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	code, cause := codes.Internal, r
+	if e, ok := r.(error); ok {
+		cause = d.Unwrap(e)
+		if _, ok := cause.(chunks.QuotaExceededError); ok {
+			code = codes.ResourceExhausted
+		} else if _, ok := e.(d.WrappedError); ok {
+			code = codes.InvalidArgument
+		}
+	}
+	logging.Debug("gRPC call failed", logging.F("error", fmt.Sprint(cause)))
+	*err = status.Errorf(code, "%v", cause)
+}
+
+func checkHashCount(hashes hash.HashSlice) error {
+	if len(hashes) > maxHashStreamLen {
+		return status.Errorf(codes.InvalidArgument, "Request has more than %d hashes", maxHashStreamLen)
+	}
+	return nil
+}
+
+func (s *GRPCServer) hasChunks(ctx context.Context, req grpcMessage) (grpcMessage, error) {
+	if _, err := s.authorize(ctx, readAccess); err != nil {
+		return nil, err
+	}
+	hashes := req.(*grpcHashes).hashes
+	if err := checkHashCount(hashes); err != nil {
+		return nil, err
+	}
+	set := hash.HashSet{}
+	for _, h := range hashes {
+		set.Insert(h)
+	}
+	absent := s.cs.HasMany(set)
+	res := &grpcHashes{}
+	for _, h := range hashes {
+		if absent.Has(h) {
+			res.hashes = append(res.hashes, h)
+		}
+	}
+	return res, nil
+}
+
+func (s *GRPCServer) getRoot(ctx context.Context, req grpcMessage) (grpcMessage, error) {
+	if _, err := s.authorize(ctx, readAccess); err != nil {
+		return nil, err
+	}
+	return &grpcRoot{s.cs.Root(), s.cs.Version()}, nil
+}
+
+func (s *GRPCServer) updateRoot(ctx context.Context, req grpcMessage) (grpcMessage, error) {
+	g, err := s.authorize(ctx, rootUpdateAccess)
+	if err != nil {
+		return nil, err
+	}
+	r := req.(*grpcUpdateRootRequest)
+	checkNewRoot(s.cs, r.current)
+	for _, id := range changedDatasets(s.cs, r.last, r.current) {
+		if !g.CanWrite(id) {
+			return nil, status.Errorf(codes.PermissionDenied, "not allowed to write dataset %s", id)
+		}
+	}
+	if !s.cs.UpdateRoot(r.current, r.last) {
+		logging.Debug("root changed, not updated", logging.F("current", r.current.String()), logging.F("last", r.last.String()))
+		return &grpcUpdateRootResponse{false}, nil
+	}
+	return &grpcUpdateRootResponse{true}, nil
+}
+
+func (s *GRPCServer) getChunks(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if _, err := s.authorize(ctx, readAccess); err != nil {
+		return err
+	}
+	req := &grpcHashes{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if err := checkHashCount(req.hashes); err != nil {
+		return err
+	}
+	batch, size := &grpcChunks{}, 0
+	send := func() error {
+		err := stream.SendMsg(batch)
+		batch, size = &grpcChunks{}, 0
+		return err
+	}
+	// The chunks are read a buffer's worth at a time, so that a big request isn't held in memory all at once.
+	for hashes := req.hashes; len(hashes) > 0; {
+		n := readBufferSize
+		if n > len(hashes) {
+			n = len(hashes)
+		}
+		for _, c := range s.cs.GetMany(hashes[:n]) {
+			if c.IsEmpty() {
+				continue
+			}
+			if size > 0 && size+len(c.Data()) > grpcBatchSize {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+			batch.data = append(batch.data, c.Data())
+			size += len(c.Data())
+		}
+		hashes = hashes[n:]
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+	if size > 0 {
+		return send()
+	}
+	return nil
+}
+
+// putChunks writes the chunks it's sent as handleWriteValue does, checking that they can be decoded, and that the chunks they refer to are present.
+func (s *GRPCServer) putChunks(stream grpc.ServerStream) error {
+	if _, err := s.authorize(stream.Context(), writeAccess); err != nil {
+		return err
+	}
+	vbs := types.NewValidatingBatchingSink(s.cs)
+	var bpe chunks.BackpressureError
+	count := 0
+	for {
+		batch := &grpcChunks{}
+		err := stream.RecvMsg(batch)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, data := range batch.data {
+			c := chunks.NewChunk(data)
+			var dc types.DecodedChunk
+			if err := d.TryAll(func() { dc = vbs.DecodeUnqueued(&c) }); err != nil {
+				return status.Errorf(codes.InvalidArgument, "Can't decode chunk %s: %v", c.Hash(), d.Unwrap(err))
+			}
+			if dc.Chunk != nil && dc.Value != nil && bpe == nil {
+				bpe = vbs.Enqueue(*dc.Chunk, *dc.Value)
+				count++
+			}
+		}
+	}
+	if bpe == nil {
+		bpe = vbs.Flush()
+	}
+	if bpe != nil {
+		logging.Debug("pushing back on write", logging.F("chunks", count), logging.F("pushedBack", len(bpe)))
+		return status.Errorf(codes.Unavailable, "Pushed back on %d chunks", len(bpe))
+	}
+	logging.Debug("wrote chunks", logging.F("chunks", count))
+	return stream.SendMsg(&grpcEmpty{})
+}
+
+// watch streams changes to the heads of datasets as handleNotify does.
+func (s *GRPCServer) watch(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if _, err := s.authorize(ctx, readAccess); err != nil {
+		return err
+	}
+	req := &grpcWatchRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	watched := map[string]bool{}
+	for _, id := range req.datasets {
+		watched[id] = true
+	}
+
+	root := s.cs.Root()
+	if err := stream.SendMsg(&grpcWatchEvent{root: root}); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current := s.cs.Root()
+		if current == root {
+			continue
+		}
+		heads := readRootMap(s.cs, current)
+		for _, id := range changedDatasets(s.cs, root, current) {
+			if len(watched) > 0 && !watched[id] {
+				continue
+			}
+			event := &grpcWatchEvent{root: current, dataset: id}
+			if r, ok := heads.MaybeGet(types.String(id)); ok {
+				event.head = r.(types.Ref).TargetHash()
+			}
+			if err := stream.SendMsg(event); err != nil {
+				return err
+			}
+		}
+		root = current
+	}
+}
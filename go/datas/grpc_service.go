@@ -0,0 +1,347 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stormasm/noms/go/hash"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The gRPC service served by a GRPCServer is described by grpc.proto. Its messages are encoded by hand, rather than by code generated from grpc.proto, but in the protobuf wire format, so that clients in other languages can use code generated from it.
+const (
+	grpcServiceName = "noms.Database"
+
+	grpcGetChunks  = "GetChunks"
+	grpcHasChunks  = "HasChunks"
+	grpcPutChunks  = "PutChunks"
+	grpcGetRoot    = "GetRoot"
+	grpcUpdateRoot = "UpdateRoot"
+	grpcWatch      = "Watch"
+
+	// grpcMaxMessageSize is the largest message either end of a gRPC connection accepts. Chunks are sent in batches of up to grpcBatchSize bytes, but a single chunk can be bigger than that.
+	grpcMaxMessageSize = 1 << 26 // 64MiB
+	grpcBatchSize      = 1 << 20 // 1MiB
+)
+
+// grpcMethod returns the full name of the method |name| of the service, as gRPC calls it.
+func grpcMethod(name string) string {
+	return "/" + grpcServiceName + "/" + name
+}
+
+// grpcServiceDesc describes the service to gRPC. Its handlers are methods of GRPCServer.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcUnaryMethod(grpcHasChunks, func() grpcMessage { return &grpcHashes{} }, (*GRPCServer).hasChunks),
+		grpcUnaryMethod(grpcGetRoot, func() grpcMessage { return &grpcEmpty{} }, (*GRPCServer).getRoot),
+		grpcUnaryMethod(grpcUpdateRoot, func() grpcMessage { return &grpcUpdateRootRequest{} }, (*GRPCServer).updateRoot),
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: grpcGetChunks, Handler: grpcStreamHandler((*GRPCServer).getChunks), ServerStreams: true},
+		{StreamName: grpcPutChunks, Handler: grpcStreamHandler((*GRPCServer).putChunks), ClientStreams: true},
+		{StreamName: grpcWatch, Handler: grpcStreamHandler((*GRPCServer).watch), ServerStreams: true},
+	},
+	Metadata: "grpc.proto",
+}
+
+func grpcStreamDesc(name string) *grpc.StreamDesc {
+	for i, sd := range grpcServiceDesc.Streams {
+		if sd.StreamName == name {
+			return &grpcServiceDesc.Streams[i]
+		}
+	}
+	panic("unreachable")
+}
+
+// grpcUnaryMethod returns the description of the unary method |name|, whose requests are decoded into the messages |newReq| returns, and handled by |handle|.
+func grpcUnaryMethod(name string, newReq func() grpcMessage, handle func(s *GRPCServer, ctx context.Context, req grpcMessage) (grpcMessage, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			h := func(ctx context.Context, req interface{}) (res interface{}, err error) {
+				defer recoverGRPCError(&err)
+				return handle(srv.(*GRPCServer), ctx, req.(grpcMessage))
+			}
+			if interceptor == nil {
+				return h(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: grpcMethod(name)}, h)
+		},
+	}
+}
+
+func grpcStreamHandler(handle func(s *GRPCServer, stream grpc.ServerStream) error) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) (err error) {
+		defer recoverGRPCError(&err)
+		return handle(srv.(*GRPCServer), stream)
+	}
+}
+
+// grpcCodec encodes grpcMessages. It's named "proto", since that's what they're encoded as, but it's only used by the connections a GRPCServer or GRPCStore makes, not registered for every connection in the process.
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	return v.(grpcMessage).marshal(), nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	return v.(grpcMessage).unmarshal(data)
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// grpcMessage is a message of the service, which encodes itself in the protobuf wire format.
+type grpcMessage interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+type grpcEmpty struct{}
+
+func (m *grpcEmpty) marshal() []byte {
+	return nil
+}
+
+func (m *grpcEmpty) unmarshal(b []byte) error {
+	return consumeFields(b, nil, nil)
+}
+
+// grpcHashes is a list of hashes, each encoded as its 20 byte digest.
+type grpcHashes struct {
+	hashes hash.HashSlice
+}
+
+func (m *grpcHashes) marshal() (b []byte) {
+	for _, h := range m.hashes {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, h.DigestSlice())
+	}
+	return
+}
+
+func (m *grpcHashes) unmarshal(b []byte) error {
+	m.hashes = hash.HashSlice{}
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		h, err := hashFromDigest(v)
+		if err == nil && h.IsEmpty() {
+			err = fmt.Errorf("Empty hash")
+		}
+		m.hashes = append(m.hashes, h)
+		return err
+	}, nil)
+}
+
+// grpcChunks is a batch of chunks. Only their data is sent, so that the receiver computes their hashes for itself.
+type grpcChunks struct {
+	data [][]byte
+}
+
+func (m *grpcChunks) marshal() (b []byte) {
+	for _, data := range m.data {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, data)
+	}
+	return
+}
+
+func (m *grpcChunks) unmarshal(b []byte) error {
+	m.data = nil
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num == 1 {
+			m.data = append(m.data, append([]byte(nil), v...))
+		}
+		return nil
+	}, nil)
+}
+
+type grpcRoot struct {
+	root    hash.Hash
+	version string
+}
+
+func (m *grpcRoot) marshal() (b []byte) {
+	b = appendHashField(b, 1, m.root)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, m.version)
+}
+
+func (m *grpcRoot) unmarshal(b []byte) error {
+	*m = grpcRoot{}
+	return consumeFields(b, func(num protowire.Number, v []byte) (err error) {
+		switch num {
+		case 1:
+			m.root, err = hashFromDigest(v)
+		case 2:
+			m.version = string(v)
+		}
+		return
+	}, nil)
+}
+
+type grpcUpdateRootRequest struct {
+	current, last hash.Hash
+}
+
+func (m *grpcUpdateRootRequest) marshal() (b []byte) {
+	b = appendHashField(b, 1, m.current)
+	return appendHashField(b, 2, m.last)
+}
+
+func (m *grpcUpdateRootRequest) unmarshal(b []byte) error {
+	*m = grpcUpdateRootRequest{}
+	return consumeFields(b, func(num protowire.Number, v []byte) (err error) {
+		switch num {
+		case 1:
+			m.current, err = hashFromDigest(v)
+		case 2:
+			m.last, err = hashFromDigest(v)
+		}
+		return
+	}, nil)
+}
+
+type grpcUpdateRootResponse struct {
+	updated bool
+}
+
+func (m *grpcUpdateRootResponse) marshal() (b []byte) {
+	if m.updated {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	return
+}
+
+func (m *grpcUpdateRootResponse) unmarshal(b []byte) error {
+	*m = grpcUpdateRootResponse{}
+	return consumeFields(b, nil, func(num protowire.Number, v uint64) error {
+		if num == 1 {
+			m.updated = v != 0
+		}
+		return nil
+	})
+}
+
+type grpcWatchRequest struct {
+	datasets []string
+}
+
+func (m *grpcWatchRequest) marshal() (b []byte) {
+	for _, id := range m.datasets {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	return
+}
+
+func (m *grpcWatchRequest) unmarshal(b []byte) error {
+	m.datasets = nil
+	return consumeFields(b, func(num protowire.Number, v []byte) error {
+		if num == 1 {
+			m.datasets = append(m.datasets, string(v))
+		}
+		return nil
+	}, nil)
+}
+
+// grpcWatchEvent says that the root is now |root|. If |dataset| is set, its head changed to |head|, which is empty if it was deleted; otherwise, this is the first event of the stream.
+type grpcWatchEvent struct {
+	root    hash.Hash
+	dataset string
+	head    hash.Hash
+}
+
+func (m *grpcWatchEvent) marshal() (b []byte) {
+	b = appendHashField(b, 1, m.root)
+	if m.dataset != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, m.dataset)
+		b = appendHashField(b, 3, m.head)
+	}
+	return
+}
+
+func (m *grpcWatchEvent) unmarshal(b []byte) error {
+	*m = grpcWatchEvent{}
+	return consumeFields(b, func(num protowire.Number, v []byte) (err error) {
+		switch num {
+		case 1:
+			m.root, err = hashFromDigest(v)
+		case 2:
+			m.dataset = string(v)
+		case 3:
+			m.head, err = hashFromDigest(v)
+		}
+		return
+	}, nil)
+}
+
+// appendHashField appends the field |num| holding the digest of |h| to |b|. An empty hash is left out, which protobuf readers take to be an empty digest.
+func appendHashField(b []byte, num protowire.Number, h hash.Hash) []byte {
+	if h.IsEmpty() {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, h.DigestSlice())
+}
+
+// hashFromDigest returns the hash whose digest is |b|, or the empty hash if b is empty.
+func hashFromDigest(b []byte) (hash.Hash, error) {
+	switch len(b) {
+	case 0:
+		return hash.Hash{}, nil
+	case hash.ByteLen:
+		return hash.FromSlice(b), nil
+	}
+	return hash.Hash{}, fmt.Errorf("Invalid hash of %d bytes", len(b))
+}
+
+// consumeFields calls |bytesField| with the number and value of each length-delimited field of the protobuf message |b|, and |varintField| with those of each varint field, stopping at the first error. Other fields, and those there's no func for, are skipped.
+func consumeFields(b []byte, bytesField func(num protowire.Number, v []byte) error, varintField func(num protowire.Number, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var err error
+		switch {
+		case typ == protowire.BytesType && bytesField != nil:
+			var v []byte
+			if v, n = protowire.ConsumeBytes(b); n >= 0 {
+				err = bytesField(num, v)
+			}
+		case typ == protowire.VarintType && varintField != nil:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(b); n >= 0 {
+				err = varintField(num, v)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcCallTimeout is the deadline of each call a GRPCStore makes, except to watch datasets. The server gives up on calls that miss it, too.
+	grpcCallTimeout = 5 * time.Minute
+	// grpcPutBufferSize is the number of bytes of chunks a GRPCStore buffers before it writes them to the server, which it also does before updating the root.
+	grpcPutBufferSize = 1 << 24 // 16MiB
+)
+
+// GRPCStore is a ChunkStore for a database served by a GRPCServer. Chunks that are put are buffered, and sent to the server in one stream, before the root is updated or once there are enough of them. Reads of many chunks are streamed back in batches. All the calls share one connection.
+type GRPCStore struct {
+	conn    *grpc.ClientConn
+	token   string
+	version string
+
+	mu           sync.Mutex
+	pending      []chunks.Chunk
+	pendingIdx   map[hash.Hash]int
+	pendingBytes int
+}
+
+// NewGRPCStore returns a GRPCStore for the server at |target|, e.g. "host:port", which it connects to with TLS if |useTLS| is true. If |token| isn't empty, it's sent to the server as a bearer token with each call. An error is returned if the server can't be reached, or serves data of another version.
+func NewGRPCStore(target string, useTLS bool, token string) (*GRPCStore, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{}), grpc.MaxCallRecvMsgSize(grpcMaxMessageSize), grpc.MaxCallSendMsgSize(grpcMaxMessageSize)))
+	if err != nil {
+		return nil, err
+	}
+	s := &GRPCStore{conn: conn, token: token, pendingIdx: map[hash.Hash]int{}}
+	ctx, cancel := s.callContext()
+	defer cancel()
+	res := &grpcRoot{}
+	// The error is returned as is, so that callers can tell from its gRPC status why the call failed.
+	if err = conn.Invoke(ctx, grpcMethod(grpcGetRoot), &grpcEmpty{}, res); err == nil && res.version != constants.NomsVersion {
+		err = fmt.Errorf("%s: SDK version %s is incompatible with data of version %s", target, constants.NomsVersion, res.version)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.version = res.version
+	return s, nil
+}
+
+// callContext returns a Context for a call to the server, carrying s's token and the version of the SDK, with the deadline grpcCallTimeout from now.
+func (s *GRPCStore) callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.withMetadata(context.Background()), grpcCallTimeout)
+}
+
+// withMetadata returns |ctx| carrying s's token and the version of the SDK.
+func (s *GRPCStore) withMetadata(ctx context.Context) context.Context {
+	ctx = metadata.AppendToOutgoingContext(ctx, NomsVersionHeader, constants.NomsVersion)
+	if s.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.token)
+	}
+	return ctx
+}
+
+func (s *GRPCStore) invoke(method string, req, res grpcMessage) {
+	ctx, cancel := s.callContext()
+	defer cancel()
+	d.PanicIfError(s.conn.Invoke(ctx, grpcMethod(method), req, res))
+}
+
+func (s *GRPCStore) Get(h hash.Hash) chunks.Chunk {
+	return s.GetMany(hash.HashSlice{h})[0]
+}
+
+// GetMany reads the chunks that haven't just been put in batches of up to maxHashStreamLen, each in a stream of its own.
+func (s *GRPCStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	d.PanicIfFalse(s.conn != nil, "Cannot use GRPCStore after Close().")
+	found := map[hash.Hash]chunks.Chunk{}
+	remaining := hash.HashSlice{}
+	s.mu.Lock()
+	for _, h := range hashes {
+		if i, ok := s.pendingIdx[h]; ok {
+			found[h] = s.pending[i]
+		} else {
+			remaining = append(remaining, h)
+		}
+	}
+	s.mu.Unlock()
+
+	for len(remaining) > 0 {
+		n := maxHashStreamLen
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		s.getChunks(remaining[:n], found)
+		remaining = remaining[n:]
+	}
+
+	result := make([]chunks.Chunk, len(hashes))
+	for i, h := range hashes {
+		if c, ok := found[h]; ok {
+			result[i] = c
+		} else {
+			result[i] = chunks.EmptyChunk
+		}
+	}
+	return result
+}
+
+func (s *GRPCStore) getChunks(hashes hash.HashSlice, found map[hash.Hash]chunks.Chunk) {
+	ctx, cancel := s.callContext()
+	defer cancel()
+	stream, err := s.conn.NewStream(ctx, grpcStreamDesc(grpcGetChunks), grpcMethod(grpcGetChunks))
+	d.PanicIfError(err)
+	d.PanicIfError(stream.SendMsg(&grpcHashes{hashes}))
+	d.PanicIfError(stream.CloseSend())
+	for {
+		batch := &grpcChunks{}
+		err := stream.RecvMsg(batch)
+		if err == io.EOF {
+			return
+		}
+		d.PanicIfError(err)
+		for _, data := range batch.data {
+			c := chunks.NewChunk(data)
+			found[c.Hash()] = c
+		}
+	}
+}
+
+func (s *GRPCStore) Has(h hash.Hash) bool {
+	return len(s.HasMany(hash.HashSet{h: struct{}{}})) == 0
+}
+
+func (s *GRPCStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	d.PanicIfFalse(s.conn != nil, "Cannot use GRPCStore after Close().")
+	remaining := hash.HashSlice{}
+	s.mu.Lock()
+	for h := range hashes {
+		if _, ok := s.pendingIdx[h]; !ok {
+			remaining = append(remaining, h)
+		}
+	}
+	s.mu.Unlock()
+
+	absent = hash.HashSet{}
+	for len(remaining) > 0 {
+		n := maxHashStreamLen
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		res := &grpcHashes{}
+		s.invoke(grpcHasChunks, &grpcHashes{remaining[:n]}, res)
+		for _, h := range res.hashes {
+			absent.Insert(h)
+		}
+		remaining = remaining[n:]
+	}
+	return
+}
+
+func (s *GRPCStore) Version() string {
+	return s.version
+}
+
+func (s *GRPCStore) Put(c chunks.Chunk) {
+	s.PutMany([]chunks.Chunk{c})
+}
+
+// PutMany buffers |chnx|, writing them to the server once there are grpcPutBufferSize bytes of them. It never returns a BackpressureError, since the server's pushback fails the write.
+func (s *GRPCStore) PutMany(chnx []chunks.Chunk) (e chunks.BackpressureError) {
+	d.PanicIfFalse(s.conn != nil, "Cannot use GRPCStore after Close().")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range chnx {
+		if _, ok := s.pendingIdx[c.Hash()]; ok {
+			continue
+		}
+		s.pendingIdx[c.Hash()] = len(s.pending)
+		s.pending = append(s.pending, c)
+		s.pendingBytes += len(c.Data())
+	}
+	if s.pendingBytes >= grpcPutBufferSize {
+		s.flush()
+	}
+	return
+}
+
+// Flush writes the buffered chunks to the server.
+func (s *GRPCStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+// flush writes the buffered chunks to the server, in the order they were put, so that each comes after the chunks it refers to. Callers must hold s.mu, which keeps the chunks readable from the buffer until the server has them.
+func (s *GRPCStore) flush() {
+	if len(s.pending) == 0 {
+		return
+	}
+	// If the write fails, the chunks are dropped along with it, so that they don't fail every write after it.
+	defer func() {
+		s.pending, s.pendingIdx, s.pendingBytes = nil, map[hash.Hash]int{}, 0
+	}()
+	ctx, cancel := s.callContext()
+	defer cancel()
+	stream, err := s.conn.NewStream(ctx, grpcStreamDesc(grpcPutChunks), grpcMethod(grpcPutChunks))
+	d.PanicIfError(err)
+	batch, size := &grpcChunks{}, 0
+	for i, c := range s.pending {
+		batch.data = append(batch.data, c.Data())
+		size += len(c.Data())
+		if size >= grpcBatchSize || i == len(s.pending)-1 {
+			if err := stream.SendMsg(batch); err != nil {
+				// The server ended the call; its error is returned by RecvMsg().
+				break
+			}
+			batch, size = &grpcChunks{}, 0
+		}
+	}
+	d.PanicIfError(stream.CloseSend())
+	d.PanicIfError(stream.RecvMsg(&grpcEmpty{}))
+}
+
+func (s *GRPCStore) Root() hash.Hash {
+	d.PanicIfFalse(s.conn != nil, "Cannot use GRPCStore after Close().")
+	res := &grpcRoot{}
+	s.invoke(grpcGetRoot, &grpcEmpty{}, res)
+	return res.root
+}
+
+// UpdateRoot writes the buffered chunks to the server before asking it to update the root.
+func (s *GRPCStore) UpdateRoot(current, last hash.Hash) bool {
+	d.PanicIfFalse(s.conn != nil, "Cannot use GRPCStore after Close().")
+	s.Flush()
+	res := &grpcUpdateRootResponse{}
+	s.invoke(grpcUpdateRoot, &grpcUpdateRootRequest{current, last}, res)
+	return res.updated
+}
+
+// Close writes the buffered chunks to the server, and closes the connection.
+func (s *GRPCStore) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	s.Flush()
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// watch asks the server to say whenever the head of one of |datasets| changes, and calls |f| each time it does, and once to start with, until f returns false or the connection is lost. Like httpBatchStore.notify(), it returns false if the server doesn't support that.
+func (s *GRPCStore) watch(datasets []string, f func() bool) bool {
+	ctx, cancel := context.WithCancel(s.withMetadata(context.Background()))
+	defer cancel()
+	stream, err := s.conn.NewStream(ctx, grpcStreamDesc(grpcWatch), grpcMethod(grpcWatch))
+	if err != nil {
+		return true
+	}
+	if stream.SendMsg(&grpcWatchRequest{datasets}) != nil || stream.CloseSend() != nil {
+		return true
+	}
+	for {
+		err := stream.RecvMsg(&grpcWatchEvent{})
+		if status.Code(err) == codes.Unimplemented {
+			return false
+		}
+		if err != nil || !f() {
+			return true
+		}
+	}
+}
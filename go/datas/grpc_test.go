@@ -0,0 +1,215 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runGRPCServer runs |server| until the returned func is called, and returns the target its clients connect to.
+func runGRPCServer(server *GRPCServer) (string, func()) {
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	return fmt.Sprintf("localhost:%d", <-portChan), server.Stop
+}
+
+func grpcErrorCode(f func()) codes.Code {
+	return status.Code(d.Unwrap(d.Try(f)))
+}
+
+func TestGRPCDatabase(t *testing.T) {
+	assert := assert.New(t)
+	target, stop := runGRPCServer(NewGRPCServer(chunks.NewMemoryStore(), 0))
+	defer stop()
+
+	cs, err := NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	db := NewDatabase(cs)
+	// The blob is big enough to be sent in several batches.
+	data := make([]byte, 3*grpcBatchSize)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	blob := types.NewBlob(bytes.NewReader(data))
+	_, err = db.CommitValue(db.GetDataset("ds"), blob)
+	assert.NoError(err)
+	db.Close()
+
+	cs, err = NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	db = NewDatabase(cs)
+	defer db.Close()
+	head := db.GetDataset("ds").HeadRef().TargetHash()
+	assert.True(blob.Equals(db.GetDataset("ds").HeadValue()))
+
+	absent := hash.FromData([]byte("absent"))
+	assert.True(cs.Get(absent).IsEmpty())
+	assert.False(cs.Has(absent))
+	assert.True(cs.Has(head))
+	assert.Equal(hash.HashSet{absent: struct{}{}}, cs.HasMany(hash.HashSet{absent: struct{}{}, head: struct{}{}}))
+	assert.False(cs.UpdateRoot(cs.Root(), absent))
+}
+
+func TestGRPCStoreVersion(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewGRPCStore("localhost:1", false, "")
+	assert.Error(err)
+
+	target, stop := runGRPCServer(NewGRPCServer(chunks.NewMemoryStore(), 0))
+	defer stop()
+	cs, err := NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	defer cs.Close()
+	assert.Equal(chunks.NewMemoryStore().Version(), cs.Version())
+}
+
+func TestGRPCServerValidatesWrites(t *testing.T) {
+	assert := assert.New(t)
+	target, stop := runGRPCServer(NewGRPCServer(chunks.NewMemoryStore(), 0))
+	defer stop()
+	cs, err := NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	defer cs.Close()
+
+	// The chunks are only written once the root is updated, and the server checks them then.
+	bad := chunks.NewChunk([]byte("not a value"))
+	cs.Put(bad)
+	assert.Equal(codes.InvalidArgument, grpcErrorCode(func() { cs.UpdateRoot(bad.Hash(), hash.Hash{}) }))
+	assert.False(cs.Has(bad.Hash()))
+
+	// A value the server has, which isn't a map of datasets, can't be the root.
+	s := types.EncodeValue(types.String("not a root"), nil)
+	cs.Put(s)
+	assert.Equal(codes.InvalidArgument, grpcErrorCode(func() { cs.UpdateRoot(s.Hash(), hash.Hash{}) }))
+	assert.True(cs.Has(s.Hash()))
+	assert.True(cs.Root().IsEmpty())
+}
+
+func TestGRPCServerAccessControl(t *testing.T) {
+	assert := assert.New(t)
+	ac, err := loadTestAccessControl(assert, testAccessConfig)
+	assert.NoError(err)
+	server := NewGRPCServer(chunks.NewMemoryStore(), 0)
+	server.Access = ac
+	target, stop := runGRPCServer(server)
+	defer stop()
+
+	_, err = NewGRPCStore(target, false, "mallory")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	anon, err := NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	defer anon.Close()
+	anon.Put(types.EncodeValue(types.NewMap(), nil))
+	assert.Equal(codes.PermissionDenied, grpcErrorCode(func() { anon.UpdateRoot(hash.Hash{}, hash.Hash{}) }))
+
+	aliceCS, err := NewGRPCStore(target, false, "alice-secret")
+	assert.NoError(err)
+	alice := NewDatabase(aliceCS)
+	defer alice.Close()
+	_, err = alice.CommitValue(alice.GetDataset("photos-2016"), types.String("sunset"))
+	assert.NoError(err)
+	assert.Equal(codes.PermissionDenied, grpcErrorCode(func() {
+		alice.CommitValue(alice.GetDataset("public"), types.String("hello"))
+	}))
+
+	bobCS, err := NewGRPCStore(target, false, "bob-secret")
+	assert.NoError(err)
+	bob := NewDatabase(bobCS)
+	defer bob.Close()
+	assert.Equal(types.String("sunset"), bob.GetDataset("photos-2016").HeadValue())
+}
+
+func TestGRPCServerReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	server := NewGRPCServer(chunks.NewMemoryStore(), 0)
+	server.ReadOnly = true
+	target, stop := runGRPCServer(server)
+	defer stop()
+
+	cs, err := NewGRPCStore(target, false, "")
+	assert.NoError(err)
+	db := NewDatabase(cs)
+	assert.Equal(codes.PermissionDenied, grpcErrorCode(func() {
+		db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	}))
+}
+
+func TestWatchHeadGRPC(t *testing.T) {
+	assert := assert.New(t)
+	target, stop := runGRPCServer(NewGRPCServer(chunks.NewMemoryStore(), 0))
+	defer stop()
+	open := func() Database {
+		cs, err := NewGRPCStore(target, false, "")
+		assert.NoError(err)
+		return NewDatabase(cs)
+	}
+
+	writer := open()
+	defer writer.Close()
+	ds, err := writer.CommitValue(writer.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	watcher := open()
+	defer watcher.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, err := writer.CommitValue(writer.GetDataset("other"), types.String("ignored"))
+		assert.NoError(err)
+		_, err = writer.CommitValue(ds, types.String("b"))
+		assert.NoError(err)
+	}()
+
+	// The interval is long enough that only an event from the server could be noticed in time.
+	changes := 0
+	WatchHead(watcher, "ds", time.Hour, func(old, new Dataset) bool {
+		changes++
+		assert.Equal(types.String("a"), old.HeadValue())
+		assert.Equal(types.String("b"), new.HeadValue())
+		return false
+	})
+	assert.Equal(1, changes)
+}
+
+func TestGRPCMessages(t *testing.T) {
+	assert := assert.New(t)
+	h1, h2 := hash.FromData([]byte("one")), hash.FromData([]byte("two"))
+	for _, m := range []grpcMessage{
+		&grpcHashes{hash.HashSlice{h1, h2}},
+		&grpcChunks{[][]byte{[]byte("abc"), []byte("def")}},
+		&grpcRoot{h1, "7.1"},
+		&grpcRoot{hash.Hash{}, "7.1"},
+		&grpcUpdateRootRequest{h1, hash.Hash{}},
+		&grpcUpdateRootResponse{true},
+		&grpcWatchRequest{[]string{"a", "b"}},
+		&grpcWatchEvent{h1, "ds", h2},
+	} {
+		b := m.marshal()
+		decoded := map[string]grpcMessage{
+			"*datas.grpcHashes": &grpcHashes{}, "*datas.grpcChunks": &grpcChunks{}, "*datas.grpcRoot": &grpcRoot{},
+			"*datas.grpcUpdateRootRequest": &grpcUpdateRootRequest{}, "*datas.grpcUpdateRootResponse": &grpcUpdateRootResponse{},
+			"*datas.grpcWatchRequest": &grpcWatchRequest{}, "*datas.grpcWatchEvent": &grpcWatchEvent{},
+		}[fmt.Sprintf("%T", m)]
+		assert.NoError(decoded.unmarshal(b))
+		assert.Equal(m, decoded)
+	}
+
+	// Fields the message doesn't have are skipped, and bad hashes are rejected.
+	assert.NoError((&grpcEmpty{}).unmarshal((&grpcWatchEvent{h1, "ds", h2}).marshal()))
+	assert.Error((&grpcRoot{}).unmarshal((&grpcWatchRequest{[]string{"abc"}}).marshal()))
+	assert.Error((&grpcHashes{}).unmarshal([]byte{0x0a, 0x05}))
+}
@@ -8,13 +8,16 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stormasm/noms/go/chunks"
@@ -22,6 +25,8 @@ import (
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/logging"
+	"github.com/stormasm/noms/go/util/tracing"
 	"github.com/golang/snappy"
 	"github.com/julienschmidt/httprouter"
 )
@@ -29,7 +34,11 @@ import (
 const (
 	httpChunkSinkConcurrency = 6
 	writeBufferSize          = 1 << 12 // 4K
-	readBufferSize           = 1 << 12 // 4K
+	readBufferSize           = 1 << 12 // 4K, which is also the most hashes a single read request asks the server about
+
+	// Chunks are written to the server in batches of up to writeBatchSize chunks, or of about writeBatchBytes, so that a push that fails part way through only has to send the last batch again.
+	writeBatchSize  = 1 << 12
+	writeBatchBytes = 1 << 24
 
 	httpStatusTooManyRequests = 429 // This is new in Go 1.6. Once the builders have that, use it.
 )
@@ -42,31 +51,84 @@ type httpBatchStore struct {
 	getQueue      chan chunks.ReadRequest
 	hasQueue      chan chunks.ReadRequest
 	writeQueue    chan writeRequest
-	flushChan     chan struct{}
+	flushChan     chan chan struct{} // a flush may send a channel to be closed once its writes, and those before them, are done
 	finishedChan  chan struct{}
 	rateLimit     chan struct{}
 	requestWg     *sync.WaitGroup
 	workerWg      *sync.WaitGroup
 	unwrittenPuts *orderedChunkCache
+	journal       *PushJournal
+	opts          HTTPClientOptions
+	// writeMu is held while a flush is being written, so that flushes are written one after another, since the Chunks of one may refer to those of the one before.
+	writeMu *sync.Mutex
+	// bufferedBytes is the size of the Chunks that have been put but not yet written, and bufferCond is signalled when it goes down.
+	bufferedBytes int
+	bufferCond    *sync.Cond
+	// ctx is the context requests are made with, and that waits for their responses give up on, as set by useContext. ctxMu guards it.
+	ctx   context.Context
+	ctxMu *sync.Mutex
+	// formGetRefs is set once the server is found not to stream getRefs/ responses, as servers from before it did don't, after which Chunks are asked for as a form, which they understand.
+	formGetRefs int32
+}
+
+// HTTPClientOptions configures the HTTP client a remote database talks to its server with. Zero fields get defaults.
+type HTTPClientOptions struct {
+	// MaxIdleConns is the number of idle connections kept open to the server. Defaults to the number of requests that may be in flight at once, so that each keeps its connection.
+	MaxIdleConns int
+	// Timeout limits how long a request may take, including reading its response, which for a large pull can be a long time. Defaults to no limit, but a server that takes more than two minutes to start responding is always given up on.
+	Timeout time.Duration
+	// Retries is the number of times a request that fails with a connection error or a 5xx status is sent again, or a negative number to never send one again. Defaults to 3.
+	Retries int
+	// RetryBackoff is how long to wait before the first retry. Each retry waits twice as long as the one before, plus a random jitter of up to as long again, so that clients that failed together don't all retry together. Defaults to 100ms.
+	RetryBackoff time.Duration
+	// WriteBufferBytes is how many bytes of Chunks may be put before they're flushed to the server. Putting more waits for the flush to be written, so that building a large Value over HTTP neither buffers it all nor floods the server. Defaults to 64MiB, or a negative number to only flush when asked to, or on Commit.
+	WriteBufferBytes int
+	// FlushInterval is how often Chunks that have been put are flushed to the server, however few there are. Defaults to 10s, or a negative number to never flush on a timer.
+	FlushInterval time.Duration
 }
 
-func newHTTPBatchStore(baseURL, auth string) *httpBatchStore {
+func (opts HTTPClientOptions) withDefaults() HTTPClientOptions {
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = httpChunkSinkConcurrency
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = 100 * time.Millisecond
+	}
+	if opts.WriteBufferBytes == 0 {
+		opts.WriteBufferBytes = 4 * writeBatchBytes
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	return opts
+}
+
+func newHTTPBatchStore(baseURL, auth string, opts HTTPClientOptions) *httpBatchStore {
 	u, err := url.Parse(baseURL)
 	d.PanicIfError(err)
 	d.PanicIfTrue(u.Scheme != "http" && u.Scheme != "https", "Unrecognized scheme: %s", u.Scheme)
+	opts = opts.withDefaults()
 	buffSink := &httpBatchStore{
 		host:          u,
-		httpClient:    makeHTTPClient(httpChunkSinkConcurrency),
+		httpClient:    makeHTTPClient(opts),
 		auth:          auth,
 		getQueue:      make(chan chunks.ReadRequest, readBufferSize),
 		hasQueue:      make(chan chunks.ReadRequest, readBufferSize),
 		writeQueue:    make(chan writeRequest, writeBufferSize),
-		flushChan:     make(chan struct{}),
+		flushChan:     make(chan chan struct{}),
 		finishedChan:  make(chan struct{}),
 		rateLimit:     make(chan struct{}, httpChunkSinkConcurrency),
 		requestWg:     &sync.WaitGroup{},
 		workerWg:      &sync.WaitGroup{},
 		unwrittenPuts: newOrderedChunkCache(),
+		opts:          opts,
+		writeMu:       &sync.Mutex{},
+		bufferCond:    sync.NewCond(&sync.Mutex{}),
+		ctx:           context.Background(),
+		ctxMu:         &sync.Mutex{},
 	}
 	buffSink.batchGetRequests()
 	buffSink.batchHasRequests()
@@ -84,20 +146,97 @@ type writeRequest struct {
 	justHints bool
 }
 
-// Use a custom http client rather than http.DefaultClient. We limit ourselves to a maximum of |requestLimit| concurrent http requests, the custom httpClient ups the maxIdleConnsPerHost value so that one connection stays open for each concurrent request.
-func makeHTTPClient(requestLimit int) *http.Client {
-	t := http.Transport(*http.DefaultTransport.(*http.Transport))
-	t.MaxIdleConnsPerHost = requestLimit
+// Use a custom http client rather than http.DefaultClient. We limit ourselves to a maximum of httpChunkSinkConcurrency concurrent http requests, and by default the custom httpClient ups the maxIdleConnsPerHost value so that one connection stays open for each concurrent request.
+func makeHTTPClient(opts HTTPClientOptions) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = opts.MaxIdleConns
+	t.MaxIdleConnsPerHost = opts.MaxIdleConns
 	// This sets, essentially, an idle-timeout. The timer starts counting AFTER the client has finished sending the entire request to the server. As soon as the client receives the server's response headers, the timeout is canceled.
 	t.ResponseHeaderTimeout = time.Duration(2) * time.Minute
 
-	return &http.Client{Transport: &t}
+	return &http.Client{Transport: t, Timeout: opts.Timeout}
+}
+
+// do sends the request made by |makeRequest|, and if it fails with a connection error or a 5xx status, makes and sends it again, backing off as bhcs.opts says, up to bhcs.opts.Retries times. It returns the last response or error. |makeRequest| is called for each try because a request's body can only be sent once. Each try is traced as a span of its own, which is sent to the server in the request's headers.
+func (bhcs *httpBatchStore) do(makeRequest func() *http.Request) (res *http.Response, err error) {
+	backoff := bhcs.opts.RetryBackoff
+	for try := 0; ; try++ {
+		req := makeRequest()
+		ctx, span := tracing.Start(req.Context(), "noms.request")
+		tracing.Inject(ctx, req.Header)
+		start := time.Now()
+		res, err = bhcs.httpClient.Do(req.WithContext(ctx))
+		logging.Slow(start, "slow request", logging.F("method", req.Method), logging.F("path", req.URL.Path))
+		span.SetTag("method", req.Method)
+		span.SetTag("path", req.URL.Path)
+		span.SetTag("try", try)
+		if err != nil {
+			span.SetTag("error", err.Error())
+		} else {
+			span.SetTag("status", res.StatusCode)
+		}
+		span.Finish()
+		if try >= bhcs.opts.Retries || req.Context().Err() != nil || !shouldRetry(res, err) {
+			return
+		}
+		if res != nil {
+			logging.Debug("request failed, retrying", logging.F("method", req.Method), logging.F("path", req.URL.Path), logging.F("status", res.StatusCode), logging.F("retry", try+1))
+			closeResponse(res.Body)
+		} else {
+			logging.Debug("request failed, retrying", logging.F("method", req.Method), logging.F("path", req.URL.Path), logging.F("error", err), logging.F("retry", try+1))
+		}
+		select {
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)+1))):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// shouldRetry returns true if a request that got |res| or |err| may succeed if it's sent again.
+func shouldRetry(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode >= 500
+}
+
+// useContext makes the requests bhcs makes on behalf of its caller, and the caller's waits for them, give up once |ctx| is done, panicking with ctx.Err(), until |restore| is called, which puts back the context that was in use before. Requests that batch those of several callers together, and writes, which are shared by everything written since the last flush, aren't canceled: a caller that gives up on them leaves them to finish by themselves.
+func (bhcs *httpBatchStore) useContext(ctx context.Context) (restore func()) {
+	bhcs.ctxMu.Lock()
+	defer bhcs.ctxMu.Unlock()
+	prev := bhcs.ctx
+	bhcs.ctx = ctx
+	return func() {
+		bhcs.ctxMu.Lock()
+		defer bhcs.ctxMu.Unlock()
+		bhcs.ctx = prev
+	}
+}
+
+func (bhcs *httpBatchStore) context() context.Context {
+	bhcs.ctxMu.Lock()
+	defer bhcs.ctxMu.Unlock()
+	return bhcs.ctx
 }
 
 func (bhcs *httpBatchStore) Flush() {
-	bhcs.flushChan <- struct{}{}
-	bhcs.requestWg.Wait()
-	return
+	ctx := bhcs.context()
+	if ctx.Done() == nil {
+		bhcs.flushChan <- nil
+		bhcs.requestWg.Wait()
+		return
+	}
+	// A WaitGroup can't be waited on by a goroutine that might be left waiting, so this waits for just the writes instead.
+	flushed := make(chan struct{})
+	select {
+	case bhcs.flushChan <- flushed:
+	case <-ctx.Done():
+		d.PanicIfError(ctx.Err())
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		d.PanicIfError(ctx.Err())
+	}
 }
 
 func (bhcs *httpBatchStore) Close() (e error) {
@@ -119,10 +258,78 @@ func (bhcs *httpBatchStore) Get(h hash.Hash) chunks.Chunk {
 		return pending
 	}
 
-	ch := make(chan chunks.Chunk)
+	// Buffered, so that the request can still be satisfied once the caller has given up on it.
+	ch := make(chan chunks.Chunk, 1)
 	bhcs.requestWg.Add(1)
 	bhcs.getQueue <- chunks.NewGetRequest(h, ch)
-	return <-ch
+	ctx := bhcs.context()
+	select {
+	case c := <-ch:
+		return c
+	case <-ctx.Done():
+		d.PanicIfError(ctx.Err())
+		return chunks.EmptyChunk
+	}
+}
+
+// GetMany sends the requests for all of |hashes| that haven't been written yet straight to the server, in a single request whose response streams the chunks back as the server fetches them, rather than queueing them individually.
+func (bhcs *httpBatchStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	found := make([]chunks.Chunk, len(hashes))
+	chans := make([]chan chunks.Chunk, len(hashes))
+	batch, batchHashes := chunks.ReadBatch{}, hash.HashSet{}
+	for i, h := range hashes {
+		if found[i] = bhcs.unwrittenPuts.Get(h); !found[i].IsEmpty() {
+			continue
+		}
+		// Buffered, so that satisfying one request never waits on the caller to receive another.
+		chans[i] = make(chan chunks.Chunk, 1)
+		batch[h] = append(batch[h], chunks.OutstandingGet(chans[i]))
+		batchHashes.Insert(h)
+	}
+	if len(batchHashes) > 0 {
+		bhcs.sendReadBatch(batchHashes, batch, bhcs.getRefs)
+	}
+
+	for i, ch := range chans {
+		if ch != nil {
+			found[i] = <-ch
+		}
+	}
+	return found
+}
+
+// sendReadBatch sends |batch| to the server with |getter|, in requests of up to readBufferSize hashes, in the context bhcs is using, and fails any requests that weren't satisfied.
+func (bhcs *httpBatchStore) sendReadBatch(hashes hash.HashSet, batch chunks.ReadBatch, getter batchGetter) {
+	for len(hashes) > readBufferSize {
+		part, partBatch := hash.HashSet{}, chunks.ReadBatch{}
+		for h := range hashes {
+			part.Insert(h)
+			partBatch[h] = batch[h]
+			hashes.Remove(h)
+			delete(batch, h)
+			if len(part) == readBufferSize {
+				break
+			}
+		}
+		bhcs.sendReadRequest(part, partBatch, getter)
+	}
+	bhcs.sendReadRequest(hashes, batch, getter)
+}
+
+// sendReadRequest sends |batch| to the server with |getter|, in a single request, and fails any requests that weren't satisfied.
+func (bhcs *httpBatchStore) sendReadRequest(hashes hash.HashSet, batch chunks.ReadBatch, getter batchGetter) {
+	ctx := bhcs.context()
+	select {
+	case bhcs.rateLimit <- struct{}{}:
+	case <-ctx.Done():
+		batch.Close()
+		d.PanicIfError(ctx.Err())
+	}
+	defer func() {
+		<-bhcs.rateLimit
+		batch.Close()
+	}()
+	getter(ctx, hashes, batch)
 }
 
 func (bhcs *httpBatchStore) batchGetRequests() {
@@ -130,21 +337,55 @@ func (bhcs *httpBatchStore) batchGetRequests() {
 }
 
 func (bhcs *httpBatchStore) Has(h hash.Hash) bool {
-	if bhcs.unwrittenPuts.has(h) {
+	if bhcs.unwrittenPuts.has(h) || bhcs.journal.has(h) {
 		return true
 	}
 
-	ch := make(chan bool)
+	// Buffered, as in Get.
+	ch := make(chan bool, 1)
 	bhcs.requestWg.Add(1)
 	bhcs.hasQueue <- chunks.NewHasRequest(h, ch)
-	return <-ch
+	ctx := bhcs.context()
+	select {
+	case has := <-ch:
+		return has
+	case <-ctx.Done():
+		d.PanicIfError(ctx.Err())
+		return false
+	}
+}
+
+// HasMany asks the server, in a single request, which of |hashes| it wants, of those that haven't been written yet and that the PushJournal, if there is one, doesn't say it has.
+func (bhcs *httpBatchStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	chans := map[hash.Hash]chan bool{}
+	batch, batchHashes := chunks.ReadBatch{}, hash.HashSet{}
+	for h := range hashes {
+		if bhcs.unwrittenPuts.has(h) || bhcs.journal.has(h) {
+			continue
+		}
+		ch := make(chan bool, 1)
+		chans[h] = ch
+		batch[h] = append(batch[h], chunks.OutstandingHas(ch))
+		batchHashes.Insert(h)
+	}
+	if len(batchHashes) > 0 {
+		bhcs.sendReadBatch(batchHashes, batch, bhcs.wantRefs)
+	}
+
+	absent = hash.HashSet{}
+	for h, ch := range chans {
+		if !<-ch {
+			absent.Insert(h)
+		}
+	}
+	return
 }
 
 func (bhcs *httpBatchStore) batchHasRequests() {
-	bhcs.batchReadRequests(bhcs.hasQueue, bhcs.hasRefs)
+	bhcs.batchReadRequests(bhcs.hasQueue, bhcs.wantRefs)
 }
 
-type batchGetter func(hashes hash.HashSet, batch chunks.ReadBatch)
+type batchGetter func(ctx context.Context, hashes hash.HashSet, batch chunks.ReadBatch)
 
 func (bhcs *httpBatchStore) batchReadRequests(queue <-chan chunks.ReadRequest, getter batchGetter) {
 	bhcs.workerWg.Add(1)
@@ -198,22 +439,65 @@ func (bhcs *httpBatchStore) sendReadRequests(req chunks.ReadRequest, queue <-cha
 			batch.Close()
 		}()
 
-		getter(hashes, batch)
+		getter(context.Background(), hashes, batch)
 		<-bhcs.rateLimit
 	}()
 }
 
-func (bhcs *httpBatchStore) getRefs(hashes hash.HashSet, batch chunks.ReadBatch) {
-	// POST http://<host>/getRefs/. Post body: ref=hash0&ref=hash1& Response will be chunk data if present, 404 if absent.
+func (bhcs *httpBatchStore) getRefs(ctx context.Context, hashes hash.HashSet, batch chunks.ReadBatch) {
+	logging.Debug("getting chunks", logging.F("chunks", len(hashes)))
+	ctx, span := tracing.Start(ctx, "noms.getRefs")
+	defer span.Finish()
+	span.SetTag("chunks", len(hashes))
+	if atomic.LoadInt32(&bhcs.formGetRefs) != 0 {
+		bhcs.getRefsForm(ctx, hashes, batch)
+		return
+	}
+	// POST http://<host>/getRefs/. Post body: the digests of hash0, hash1, ... one after another. Response will be a stream of the chunks that are present, ending with an end frame.
 	u := *bhcs.host
 	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.GetRefsPath)
 
-	req := newRequest("POST", bhcs.auth, u.String(), buildHashesRequest(hashes), http.Header{
-		"Accept-Encoding": {"x-snappy-framed"},
-		"Content-Type":    {"application/x-www-form-urlencoded"},
+	res, err := bhcs.do(func() *http.Request {
+		return newRequest("POST", bhcs.auth, u.String(), buildHashStreamRequest(hashes), http.Header{
+			"Accept-Encoding": {"x-snappy-framed"},
+			"Content-Type":    {hashStreamContentType},
+		}).WithContext(ctx)
 	})
+	d.Chk.NoError(err)
+	expectVersion(res)
+	reader := resBodyReader(res)
+	defer closeResponse(reader)
+
+	d.PanicIfFalse(http.StatusOK == res.StatusCode, "Unexpected response: %s", http.StatusText(res.StatusCode))
+	if res.Header.Get("Content-Type") != chunkStreamContentType {
+		// The server doesn't know the hash stream, so it found no hashes in the request, and answered with no Chunks.
+		logging.Debug("server doesn't stream chunks, asking for them as a form")
+		atomic.StoreInt32(&bhcs.formGetRefs, 1)
+		bhcs.getRefsForm(ctx, hashes, batch)
+		return
+	}
 
-	res, err := bhcs.httpClient.Do(req)
+	// Chunks are handed out as they arrive, and the next isn't read until the last has been, so a slow reader slows the server down rather than buffering the response.
+	counter := &countingReader{ReadCloser: reader}
+	err = chunks.DeserializeStream(counter, &readBatchChunkSink{&batch, &sync.RWMutex{}})
+	span.SetTag("bytes", counter.bytes)
+	d.PanicIfError(err)
+	// readBatchChunkSink takes the chunks it's given out of batch, so what's left is what the server doesn't have.
+	span.SetTag("found", len(hashes)-len(batch))
+}
+
+// getRefsForm asks the server for |hashes| as getRefs does, but in a form of ref=<hash> values, to which the server responds with all the Chunks it has at once, without an end frame, as servers did before they streamed them.
+func (bhcs *httpBatchStore) getRefsForm(ctx context.Context, hashes hash.HashSet, batch chunks.ReadBatch) {
+	// POST http://<host>/getRefs/. Post body: ref=hash0&ref=hash1& Response will be chunk data if present.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.GetRefsPath)
+
+	res, err := bhcs.do(func() *http.Request {
+		return newRequest("POST", bhcs.auth, u.String(), buildHashesRequest(hashes), http.Header{
+			"Accept-Encoding": {"x-snappy-framed"},
+			"Content-Type":    {"application/x-www-form-urlencoded"},
+		}).WithContext(ctx)
+	})
 	d.Chk.NoError(err)
 	expectVersion(res)
 	reader := resBodyReader(res)
@@ -222,7 +506,102 @@ func (bhcs *httpBatchStore) getRefs(hashes hash.HashSet, batch chunks.ReadBatch)
 	d.PanicIfFalse(http.StatusOK == res.StatusCode, "Unexpected response: %s", http.StatusText(res.StatusCode))
 
 	rl := make(chan struct{}, 16)
-	chunks.Deserialize(reader, &readBatchChunkSink{&batch, &sync.RWMutex{}}, rl)
+	chunks.Deserialize(ctxReader{ctx, reader}, &readBatchChunkSink{&batch, &sync.RWMutex{}}, rl)
+}
+
+// pullRefs asks the server for the chunks reachable from |wants| but not from |haves|, passing each to |sink| as it arrives. It returns false if the server doesn't support that, and the error if the chunks stop coming, as when |ctx| is canceled.
+func (bhcs *httpBatchStore) pullRefs(ctx context.Context, wants, haves hash.HashSlice, sink chunks.ChunkSink) (bool, error) {
+	// POST http://<host>/pullRefs/. Post body: want=hash0&have=hash1& Response will be a stream of the chunks reachable from the wants but not the haves, ending with an end frame.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.PullRefsPath)
+
+	values := &url.Values{}
+	for _, h := range wants {
+		values.Add("want", h.String())
+	}
+	for _, h := range haves {
+		values.Add("have", h.String())
+	}
+	res, err := bhcs.do(func() *http.Request {
+		return newRequest("POST", bhcs.auth, u.String(), strings.NewReader(values.Encode()), http.Header{
+			"Accept-Encoding": {"x-snappy-framed"},
+			"Content-Type":    {"application/x-www-form-urlencoded"},
+		}).WithContext(ctx)
+	})
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+	d.Chk.NoError(err)
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed {
+		closeResponse(res.Body)
+		return false, nil
+	}
+	expectVersion(res)
+	if res.StatusCode != http.StatusOK {
+		d.Chk.Fail(fmt.Sprintf("Unexpected response: %s", formatErrorResponse(res)))
+	}
+	reader := resBodyReader(res)
+	defer closeResponse(reader)
+
+	return true, chunks.DeserializeStream(ctxReader{ctx, reader}, sink)
+}
+
+// notify asks the server to say whenever the head of one of |datasets| changes, and calls |f| each time it does, and once to start with, until f returns false or the connection is lost. It returns false if the server doesn't support that.
+func (bhcs *httpBatchStore) notify(datasets []string, f func() bool) bool {
+	// GET http://<host>/notify/?ds=<id>. Response will be a stream of Server-Sent Events, starting with the root, then one for each change.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.NotifyPath)
+	params := u.Query()
+	for _, id := range datasets {
+		params.Add("ds", id)
+	}
+	u.RawQuery = params.Encode()
+
+	res, err := bhcs.do(func() *http.Request {
+		return newRequest("GET", bhcs.auth, u.String(), nil, http.Header{"Accept": {eventStreamContentType}})
+	})
+	if err != nil {
+		return true
+	}
+	// The stream doesn't end, so it isn't read to EOF before it's closed.
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed {
+		return false
+	}
+	expectVersion(res)
+	if res.StatusCode != http.StatusOK {
+		d.Chk.Fail(fmt.Sprintf("Unexpected response: %s", formatErrorResponse(res)))
+	}
+
+	// Events end with a blank line. Their fields don't matter, since f checks for itself what changed.
+	scanner := bufio.NewScanner(res.Body)
+	event := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event && !f() {
+				return true
+			}
+			event = false
+		case !strings.HasPrefix(line, ":"):
+			event = true
+		}
+	}
+	return true
+}
+
+// ctxReader reads from a Reader until its Context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
 }
 
 type readBatchChunkSink struct {
@@ -255,17 +634,23 @@ func (rb *readBatchChunkSink) Close() error {
 	return rb.batch.Close()
 }
 
-func (bhcs *httpBatchStore) hasRefs(hashes hash.HashSet, batch chunks.ReadBatch) {
-	// POST http://<host>/hasRefs/. Post body: ref=sha1---&ref=sha1---& Response will be text of lines containing "|ref| |bool|".
+func (bhcs *httpBatchStore) wantRefs(ctx context.Context, hashes hash.HashSet, batch chunks.ReadBatch) {
+	logging.Debug("asking which chunks are wanted", logging.F("chunks", len(hashes)))
+	ctx, span := tracing.Start(ctx, "noms.wantRefs")
+	defer span.Finish()
+	span.SetTag("chunks", len(hashes))
+	wanted := 0
+	defer func() { span.SetTag("wanted", wanted) }()
+	// POST http://<host>/wantRefs/. Post body: the digests of hash0, hash1, ... one after another. Response will be the digests of the ones the server doesn't have, followed by an all-zero digest.
 	u := *bhcs.host
-	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.HasRefsPath)
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.WantRefsPath)
 
-	req := newRequest("POST", bhcs.auth, u.String(), buildHashesRequest(hashes), http.Header{
-		"Accept-Encoding": {"x-snappy-framed"},
-		"Content-Type":    {"application/x-www-form-urlencoded"},
+	res, err := bhcs.do(func() *http.Request {
+		return newRequest("POST", bhcs.auth, u.String(), buildHashStreamRequest(hashes), http.Header{
+			"Accept-Encoding": {"x-snappy-framed"},
+			"Content-Type":    {hashStreamContentType},
+		}).WithContext(ctx)
 	})
-
-	res, err := bhcs.httpClient.Do(req)
 	d.Chk.NoError(err)
 	expectVersion(res)
 	reader := resBodyReader(res)
@@ -273,20 +658,28 @@ func (bhcs *httpBatchStore) hasRefs(hashes hash.HashSet, batch chunks.ReadBatch)
 
 	d.PanicIfFalse(http.StatusOK == res.StatusCode, "Unexpected response: %s", http.StatusText(res.StatusCode))
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanWords)
-	for scanner.Scan() {
-		h := hash.Parse(scanner.Text())
-		d.PanicIfFalse(scanner.Scan())
-		if scanner.Text() == "true" {
-			for _, outstanding := range batch[h] {
-				// This is a little gross, but OutstandingHas.Satisfy() expects a chunk. It ignores it, though, and just sends 'true' over the channel it's holding.
-				outstanding.Satisfy(chunks.EmptyChunk)
-			}
-		} else {
-			for _, outstanding := range batch[h] {
-				outstanding.Fail()
-			}
+	for {
+		digest := hash.Digest{}
+		_, err := io.ReadFull(reader, digest[:])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		d.PanicIfError(err)
+		if digest == (hash.Digest{}) {
+			break
+		}
+		h := hash.New(digest)
+		for _, outstanding := range batch[h] {
+			outstanding.Fail()
+		}
+		delete(batch, h)
+		wanted++
+	}
+	// The server has everything it didn't ask for.
+	for h, outstanding := range batch {
+		for _, o := range outstanding {
+			// This is a little gross, but OutstandingHas.Satisfy() expects a chunk. It ignores it, though, and just sends 'true' over the channel it's holding.
+			o.Satisfy(chunks.EmptyChunk)
 		}
 		delete(batch, h)
 	}
@@ -305,6 +698,7 @@ func resBodyReader(res *http.Response) (reader io.ReadCloser) {
 	return
 }
 
+// SchedulePut buffers |c| to be written to the server on the next flush. If that makes the buffer full, it flushes it, and waits for there to be room in it again.
 func (bhcs *httpBatchStore) SchedulePut(c chunks.Chunk, refHeight uint64, hints types.Hints) {
 	if !bhcs.unwrittenPuts.Insert(c, refHeight) {
 		return
@@ -312,6 +706,33 @@ func (bhcs *httpBatchStore) SchedulePut(c chunks.Chunk, refHeight uint64, hints
 
 	bhcs.requestWg.Add(1)
 	bhcs.writeQueue <- writeRequest{c.Hash(), hints, false}
+
+	if bhcs.opts.WriteBufferBytes < 0 {
+		return
+	}
+	bhcs.bufferCond.L.Lock()
+	bhcs.bufferedBytes += len(c.Data())
+	full := bhcs.bufferedBytes >= bhcs.opts.WriteBufferBytes
+	bhcs.bufferCond.L.Unlock()
+	if full {
+		bhcs.flushChan <- nil
+		bhcs.bufferCond.L.Lock()
+		for bhcs.bufferedBytes >= bhcs.opts.WriteBufferBytes {
+			bhcs.bufferCond.Wait()
+		}
+		bhcs.bufferCond.L.Unlock()
+	}
+}
+
+// written takes |bytes| of written Chunks off bufferedBytes.
+func (bhcs *httpBatchStore) written(bytes int) {
+	if bhcs.opts.WriteBufferBytes < 0 {
+		return
+	}
+	bhcs.bufferCond.L.Lock()
+	bhcs.bufferedBytes -= bytes
+	bhcs.bufferCond.L.Unlock()
+	bhcs.bufferCond.Broadcast()
 }
 
 func (bhcs *httpBatchStore) AddHints(hints types.Hints) {
@@ -337,12 +758,21 @@ func (bhcs *httpBatchStore) batchPutRequests() {
 				hints[hint] = struct{}{}
 			}
 		}
+		var tick <-chan time.Time
+		if bhcs.opts.FlushInterval > 0 {
+			ticker := time.NewTicker(bhcs.opts.FlushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
 		for done := false; !done; {
 			drainAndSend := false
+			var flushed chan struct{}
 			select {
 			case wr := <-bhcs.writeQueue:
 				handleRequest(wr)
-			case <-bhcs.flushChan:
+			case flushed = <-bhcs.flushChan:
+				drainAndSend = true
+			case <-tick:
 				drainAndSend = true
 			case <-bhcs.finishedChan:
 				drainAndSend = true
@@ -356,7 +786,7 @@ func (bhcs *httpBatchStore) batchPutRequests() {
 						handleRequest(wr)
 					default:
 						drained = true
-						bhcs.sendWriteRequests(hashes, hints) // Takes ownership of hashes, hints
+						bhcs.sendWriteRequests(hashes, hints, flushed) // Takes ownership of hashes, hints
 						hints = types.Hints{}
 						hashes = hash.HashSet{}
 					}
@@ -366,57 +796,126 @@ func (bhcs *httpBatchStore) batchPutRequests() {
 	}()
 }
 
-func (bhcs *httpBatchStore) sendWriteRequests(hashes hash.HashSet, hints types.Hints) {
+// sendWriteRequests writes the Chunks for |hashes| to the server lowest first, in batches of up to writeBatchSize, so that every batch the server has stored has all the Chunks its Chunks refer to, and records them in the PushJournal, if there is one, as each is. It waits for the Chunks of the last call to be written before starting, since these may refer to them. If |flushed| isn't nil, it's closed once the Chunks are written.
+func (bhcs *httpBatchStore) sendWriteRequests(hashes hash.HashSet, hints types.Hints, flushed chan struct{}) {
 	if len(hashes) == 0 {
+		if flushed != nil {
+			go func() {
+				bhcs.writeMu.Lock()
+				bhcs.writeMu.Unlock()
+				close(flushed)
+			}()
+		}
 		return
 	}
+	bhcs.writeMu.Lock()
 	bhcs.rateLimit <- struct{}{}
+	// The writes are traced as part of the operation that flushed them, if there was one, but aren't canceled with it.
+	ctx, span := tracing.Start(context.WithoutCancel(bhcs.context()), "noms.write")
 	go func() {
+		totalBytes := 0
 		defer func() {
+			span.SetTag("chunks", len(hashes))
+			span.SetTag("bytes", totalBytes)
+			span.Finish()
 			<-bhcs.rateLimit
 			bhcs.unwrittenPuts.Clear(hashes)
+			bhcs.written(totalBytes)
 			bhcs.requestWg.Add(-len(hashes))
+			bhcs.writeMu.Unlock()
+			if flushed != nil {
+				close(flushed)
+			}
 		}()
 
-		var res *http.Response
-		var err error
-		for tryAgain := true; tryAgain; {
-			chunkChan := make(chan *chunks.Chunk, 1024)
-			go func() {
-				bhcs.unwrittenPuts.ExtractChunks(hashes, chunkChan)
-				close(chunkChan)
-			}()
+		chunkChan := make(chan *chunks.Chunk, 1024)
+		go func() {
+			bhcs.unwrittenPuts.ExtractChunks(hashes, chunkChan)
+			close(chunkChan)
+		}()
 
-			body := buildWriteValueRequest(chunkChan, hints)
-			url := *bhcs.host
-			url.Path = httprouter.CleanPath(bhcs.host.Path + constants.WriteValuePath)
+		batch, batchBytes := []chunks.Chunk{}, 0
+		for c := range chunkChan {
+			batch = append(batch, *c)
+			batchBytes += len(c.Data())
+			totalBytes += len(c.Data())
+			if len(batch) == writeBatchSize || batchBytes >= writeBatchBytes {
+				bhcs.writeValue(ctx, batch, hints)
+				batch, batchBytes = []chunks.Chunk{}, 0
+			}
+		}
+		if len(batch) > 0 {
+			bhcs.writeValue(ctx, batch, hints)
+		}
+	}()
+}
+
+// writeValue sends |batch| to the server, sending it again for as long as the server pushes back, tracing it as a child of the span in |ctx|.
+func (bhcs *httpBatchStore) writeValue(ctx context.Context, batch []chunks.Chunk, hints types.Hints) {
+	ctx, span := tracing.Start(ctx, "noms.writeValue")
+	defer span.Finish()
+	chunkChan := make(chan *chunks.Chunk, len(batch))
+	for i := range batch {
+		chunkChan <- &batch[i]
+	}
+	close(chunkChan)
+	// The body is built up front, rather than streamed, so that it can be sent again.
+	body := &bytes.Buffer{}
+	_, err := io.Copy(body, buildWriteValueRequest(chunkChan, hints))
+	d.PanicIfError(err)
+	logging.Debug("writing chunks", logging.F("chunks", len(batch)), logging.F("bytes", body.Len()))
+	span.SetTag("chunks", len(batch))
+	span.SetTag("bytes", body.Len())
+	pushbacks := 0
+	defer func() { span.SetTag("pushbacks", pushbacks) }()
+
+	var res *http.Response
+	for tryAgain := true; tryAgain; {
+		url := *bhcs.host
+		url.Path = httprouter.CleanPath(bhcs.host.Path + constants.WriteValuePath)
+		res, err = bhcs.do(func() *http.Request {
 			// TODO: Make this accept snappy encoding
-			req := newRequest("POST", bhcs.auth, url.String(), body, http.Header{
+			return newRequest("POST", bhcs.auth, url.String(), bytes.NewReader(body.Bytes()), http.Header{
 				"Accept-Encoding":  {"gzip"},
 				"Content-Encoding": {"x-snappy-framed"},
 				"Content-Type":     {"application/octet-stream"},
-			})
-
-			res, err = bhcs.httpClient.Do(req)
-			d.PanicIfError(err)
-			expectVersion(res)
-			defer closeResponse(res.Body)
-
-			if tryAgain = res.StatusCode == httpStatusTooManyRequests; tryAgain {
-				reader := res.Body
-				if strings.Contains(res.Header.Get("Content-Encoding"), "gzip") {
-					gr, err := gzip.NewReader(reader)
-					d.PanicIfError(err)
-					defer gr.Close()
-					reader = gr
-				}
-				/*hashes :=*/ deserializeHashes(reader)
-				// TODO: BUG 1259 Since the client must currently send all chunks in one batch, the only thing to do in response to backpressure is send EVERYTHING again. Once batching is again possible, this code should figure out how to resend the chunks indicated by hashes.
+			}).WithContext(ctx)
+		})
+		d.PanicIfError(err)
+		expectVersion(res)
+		defer closeResponse(res.Body)
+
+		if tryAgain = res.StatusCode == httpStatusTooManyRequests; tryAgain {
+			reader := res.Body
+			if strings.Contains(res.Header.Get("Content-Encoding"), "gzip") {
+				gr, err := gzip.NewReader(reader)
+				d.PanicIfError(err)
+				defer gr.Close()
+				reader = gr
 			}
+			hashes := deserializeHashes(reader)
+			pushbacks++
+			logging.Debug("server pushed back, writing chunks again", logging.F("chunks", len(batch)), logging.F("pushedBack", len(hashes)))
+			// TODO: BUG 1259 The only thing to do in response to backpressure is to send the whole batch again. This code should figure out how to resend just the chunks indicated by hashes.
 		}
+	}
 
-		d.PanicIfTrue(http.StatusCreated != res.StatusCode, "Unexpected response: %s", formatErrorResponse(res))
-	}()
+	d.PanicIfTrue(http.StatusCreated != res.StatusCode, "Unexpected response: %s", formatErrorResponse(res))
+
+	written := make(hash.HashSlice, len(batch))
+	for i, c := range batch {
+		written[i] = c.Hash()
+	}
+	bhcs.journal.record(written)
+}
+
+// setPushJournal makes bhcs record the Chunks the server stores in |j|, and take it from |j| that the server has the Chunks it's recorded, without asking. First, though, it asks the server which of them it wants, in case some were lost, and drops those from |j|.
+func (bhcs *httpBatchStore) setPushJournal(j *PushJournal) {
+	bhcs.journal = nil
+	if j != nil && j.Len() > 0 {
+		j.forget(bhcs.HasMany(j.all()))
+	}
+	bhcs.journal = j
 }
 
 func (bhcs *httpBatchStore) Root() hash.Hash {
@@ -444,6 +943,7 @@ func (bhcs *httpBatchStore) UpdateRoot(current, last hash.Hash) bool {
 	case http.StatusOK:
 		return true
 	case http.StatusConflict:
+		logging.Debug("root changed on server, not updated", logging.F("current", current.String()), logging.F("last", last.String()))
 		return false
 	default:
 		buf := bytes.Buffer{}
@@ -468,9 +968,18 @@ func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash)
 		u.RawQuery = params.Encode()
 	}
 
-	req := newRequest(method, bhcs.auth, u.String(), nil, nil)
-
-	res, err := bhcs.httpClient.Do(req)
+	ctx := bhcs.context()
+	makeRequest := func() *http.Request {
+		return newRequest(method, bhcs.auth, u.String(), nil, nil).WithContext(ctx)
+	}
+	var res *http.Response
+	var err error
+	if method == "POST" {
+		// Moving the root isn't sent again: if the server moved it before failing, it'd then report a conflict with itself.
+		res, err = bhcs.httpClient.Do(makeRequest())
+	} else {
+		res, err = bhcs.do(makeRequest)
+	}
 	d.PanicIfError(err)
 
 	return res
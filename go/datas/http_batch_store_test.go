@@ -5,11 +5,16 @@
 package datas
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/constants"
@@ -72,6 +77,18 @@ func newHTTPBatchStoreForTest(cs chunks.ChunkStore) *httpBatchStore {
 			HandleHasRefs(w, req, ps, cs)
 		},
 	)
+	serv.POST(
+		constants.PullRefsPath,
+		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			HandlePullRefs(w, req, ps, cs)
+		},
+	)
+	serv.POST(
+		constants.WantRefsPath,
+		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			HandleWantRefs(w, req, ps, cs)
+		},
+	)
 	serv.POST(
 		constants.RootPath,
 		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -84,7 +101,7 @@ func newHTTPBatchStoreForTest(cs chunks.ChunkStore) *httpBatchStore {
 			HandleRootGet(w, req, ps, cs)
 		},
 	)
-	hcs := newHTTPBatchStore("http://localhost:9000", "")
+	hcs := newHTTPBatchStore("http://localhost:9000", "", HTTPClientOptions{})
 	hcs.httpClient = serv
 	return hcs
 }
@@ -102,7 +119,7 @@ func newAuthenticatingHTTPBatchStoreForTest(suite *HTTPBatchStoreSuite, hostUrl
 			HandleRootPost(w, req, ps, suite.cs)
 		},
 	)
-	hcs := newHTTPBatchStore(hostUrl, "")
+	hcs := newHTTPBatchStore(hostUrl, "", HTTPClientOptions{})
 	hcs.httpClient = serv
 	return hcs
 }
@@ -116,7 +133,7 @@ func newBadVersionHTTPBatchStoreForTest(suite *HTTPBatchStoreSuite) *httpBatchSt
 			w.Header().Set(NomsVersionHeader, "BAD")
 		},
 	)
-	hcs := newHTTPBatchStore("http://localhost", "")
+	hcs := newHTTPBatchStore("http://localhost", "", HTTPClientOptions{})
 	hcs.httpClient = serv
 	return hcs
 }
@@ -150,6 +167,90 @@ func (suite *HTTPBatchStoreSuite) TestPutChunksInOrder() {
 	suite.Equal(3, suite.cs.Writes)
 }
 
+func (suite *HTTPBatchStoreSuite) TestPutChunksInBatches() {
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+	dir, err := ioutil.TempDir("", "journal")
+	suite.NoError(err)
+	defer os.RemoveAll(dir)
+	j, err := OpenPushJournal(filepath.Join(dir, "journal"))
+	suite.NoError(err)
+	suite.store.setPushJournal(j)
+
+	vals := make([]types.Value, writeBatchSize+1)
+	for i := range vals {
+		vals[i] = types.String(fmt.Sprintf("value %d", i))
+		suite.store.SchedulePut(types.EncodeValue(vals[i], nil), 1, types.Hints{})
+	}
+	suite.store.Flush()
+
+	suite.Equal(len(vals), suite.cs.Writes)
+	suite.Equal(2, counter.requests)
+	suite.Equal(len(vals), j.Len())
+	suite.True(j.has(vals[writeBatchSize].Hash()))
+}
+
+func (suite *HTTPBatchStoreSuite) TestPutChunksAutoFlush() {
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+	suite.store.opts.WriteBufferBytes = 1
+
+	// Each put fills the buffer, so it's flushed, and SchedulePut waits for it to be written.
+	for i, val := range []types.Value{types.String("abc"), types.String("def"), types.String("ghi")} {
+		suite.store.SchedulePut(types.EncodeValue(val, nil), 1, types.Hints{})
+		suite.Equal(i+1, suite.cs.Writes)
+		suite.Equal(i+1, counter.requests)
+	}
+}
+
+func (suite *HTTPBatchStoreSuite) TestFlushInterval() {
+	store := newHTTPBatchStore("http://localhost:9000", "", HTTPClientOptions{FlushInterval: 10 * time.Millisecond})
+	store.httpClient = suite.store.httpClient
+	defer store.Close()
+
+	c := types.EncodeValue(types.String("abc"), nil)
+	store.SchedulePut(c, 1, types.Hints{})
+	deadline := time.Now().Add(5 * time.Second)
+	for store.unwrittenPuts.has(c.Hash()) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.True(suite.cs.Has(c.Hash()))
+}
+
+func (suite *HTTPBatchStoreSuite) TestPushJournal() {
+	dir, err := ioutil.TempDir("", "journal")
+	suite.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	stored := types.EncodeValue(types.String("abc"), nil)
+	suite.NoError(suite.cs.PutMany([]chunks.Chunk{stored}))
+	lost := types.EncodeValue(types.String("def"), nil).Hash()
+	j, err := OpenPushJournal(path)
+	suite.NoError(err)
+	j.record(hash.HashSlice{stored.Hash(), lost})
+	suite.NoError(j.f.Close())
+
+	// The journal still has both after being reopened, but the server only has one of them, so the other is forgotten.
+	j, err = OpenPushJournal(path)
+	suite.NoError(err)
+	suite.Equal(2, j.Len())
+	suite.store.setPushJournal(j)
+	suite.Equal(1, j.Len())
+
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+	suite.True(suite.store.Has(stored.Hash()))
+	suite.Empty(suite.store.HasMany(hash.HashSet{stored.Hash(): struct{}{}}))
+	suite.Equal(0, counter.requests)
+	suite.Equal(hash.HashSet{lost: struct{}{}}, suite.store.HasMany(hash.HashSet{lost: struct{}{}}))
+	suite.Equal(1, counter.requests)
+
+	suite.NoError(j.Remove())
+	_, err = os.Stat(path)
+	suite.True(os.IsNotExist(err))
+}
+
 func (suite *HTTPBatchStoreSuite) TestPutChunkWithHints() {
 	vals := []types.Value{
 		types.String("abc"),
@@ -280,3 +381,173 @@ func (suite *HTTPBatchStoreSuite) TestHas() {
 	suite.True(suite.store.Has(chnx[0].Hash()))
 	suite.True(suite.store.Has(chnx[1].Hash()))
 }
+
+type countingDoer struct {
+	httpDoer
+	requests int
+}
+
+func (c *countingDoer) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.httpDoer.Do(req)
+}
+
+func (suite *HTTPBatchStoreSuite) TestGetMany() {
+	chnx := []chunks.Chunk{
+		chunks.NewChunk([]byte("abc")),
+		chunks.NewChunk([]byte("def")),
+	}
+	suite.NoError(suite.cs.PutMany(chnx))
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+
+	missing := chunks.NewChunk([]byte("ghi")).Hash()
+	got := suite.store.GetMany(hash.HashSlice{chnx[1].Hash(), missing, chnx[0].Hash()})
+	suite.Len(got, 3)
+	suite.Equal(chnx[1].Data(), got[0].Data())
+	suite.True(got[1].IsEmpty())
+	suite.Equal(chnx[0].Data(), got[2].Data())
+	suite.Equal(1, counter.requests)
+}
+
+func (suite *HTTPBatchStoreSuite) TestGetManyInBatches() {
+	chnx := make([]chunks.Chunk, readBufferSize+1)
+	hashes := make(hash.HashSlice, len(chnx))
+	for i := range chnx {
+		chnx[i] = chunks.NewChunk([]byte(fmt.Sprintf("chunk %d", i)))
+		hashes[i] = chnx[i].Hash()
+	}
+	suite.NoError(suite.cs.PutMany(chnx))
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+
+	got := suite.store.GetMany(hashes)
+	for i, c := range got {
+		suite.Equal(chnx[i].Data(), c.Data())
+	}
+	suite.Equal(2, counter.requests)
+}
+
+func (suite *HTTPBatchStoreSuite) TestGetManyFromFormServer() {
+	chnx := []chunks.Chunk{
+		chunks.NewChunk([]byte("abc")),
+		chunks.NewChunk([]byte("def")),
+	}
+	suite.NoError(suite.cs.PutMany(chnx))
+
+	// This server only understands getRefs/ requests that are forms, as servers did before they streamed chunks.
+	serv := inlineServer{httprouter.New()}
+	serv.POST(
+		constants.GetRefsPath,
+		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			if req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+				w.Header().Set(NomsVersionHeader, constants.NomsVersion)
+				w.Header().Set("Content-Type", "application/octet-stream")
+				return
+			}
+			HandleGetRefs(w, req, ps, suite.cs)
+		},
+	)
+	store := newHTTPBatchStore("http://localhost", "", HTTPClientOptions{})
+	defer store.Close()
+	counter := &countingDoer{httpDoer: serv}
+	store.httpClient = counter
+
+	missing := chunks.NewChunk([]byte("ghi")).Hash()
+	got := store.GetMany(hash.HashSlice{chnx[1].Hash(), missing})
+	suite.Equal(chnx[1].Data(), got[0].Data())
+	suite.True(got[1].IsEmpty())
+	suite.Equal(2, counter.requests)
+
+	// Once the server's known not to stream, it's only asked with forms.
+	suite.Equal(chnx[0].Data(), store.Get(chnx[0].Hash()).Data())
+	suite.Equal(3, counter.requests)
+}
+
+func (suite *HTTPBatchStoreSuite) TestPullRefsUnsupported() {
+	// This server has no pullRefs/ endpoint.
+	store := newAuthenticatingHTTPBatchStoreForTest(suite, "http://localhost")
+	defer store.Close()
+	ok, err := store.pullRefs(context.Background(), hash.HashSlice{chunks.NewChunk([]byte("abc")).Hash()}, nil, chunks.NewTestStore())
+	suite.False(ok)
+	suite.NoError(err)
+}
+
+func (suite *HTTPBatchStoreSuite) TestNotifyUnsupported() {
+	// This server has no notify/ endpoint.
+	store := newAuthenticatingHTTPBatchStoreForTest(suite, "http://localhost")
+	defer store.Close()
+	suite.False(store.notify([]string{"ds"}, func() bool { return true }))
+}
+
+func (suite *HTTPBatchStoreSuite) TestHasMany() {
+	chnx := []chunks.Chunk{
+		chunks.NewChunk([]byte("abc")),
+		chunks.NewChunk([]byte("def")),
+	}
+	suite.NoError(suite.cs.PutMany(chnx))
+	counter := &countingDoer{httpDoer: suite.store.httpClient}
+	suite.store.httpClient = counter
+
+	missing := chunks.NewChunk([]byte("ghi")).Hash()
+	absent := suite.store.HasMany(hash.HashSet{chnx[0].Hash(): struct{}{}, chnx[1].Hash(): struct{}{}, missing: struct{}{}})
+	suite.Equal(hash.HashSet{missing: struct{}{}}, absent)
+	suite.Equal(1, counter.requests)
+}
+
+// flakyDoer fails its first |failures| requests, alternately with a connection error and a 503.
+type flakyDoer struct {
+	httpDoer
+	failures int
+	requests int
+}
+
+func (f *flakyDoer) Do(req *http.Request) (*http.Response, error) {
+	f.requests++
+	if f.requests > f.failures {
+		return f.httpDoer.Do(req)
+	}
+	if f.requests%2 == 1 {
+		return nil, fmt.Errorf("connection reset")
+	}
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Status:     http.StatusText(http.StatusServiceUnavailable),
+		Header:     http.Header{NomsVersionHeader: {constants.NomsVersion}},
+		Body:       ioutil.NopCloser(&bytes.Buffer{}),
+	}, nil
+}
+
+func (suite *HTTPBatchStoreSuite) TestRetries() {
+	suite.store.opts.RetryBackoff = time.Millisecond
+	flaky := &flakyDoer{httpDoer: suite.store.httpClient, failures: 2}
+	suite.store.httpClient = flaky
+
+	c := types.EncodeValue(types.String("abc"), nil)
+	suite.store.SchedulePut(c, 1, types.Hints{})
+	suite.store.Flush()
+	suite.Equal(1, suite.cs.Writes)
+	suite.Equal(3, flaky.requests)
+
+	flaky.requests, flaky.failures = 0, 3
+	suite.Equal(c.Data(), suite.store.GetMany(hash.HashSlice{c.Hash()})[0].Data())
+	suite.Equal(4, flaky.requests)
+
+	// Giving up after opts.Retries.
+	flaky.requests, flaky.failures = 0, 4
+	suite.Panics(func() { suite.store.Root() })
+	suite.Equal(4, flaky.requests)
+
+	// Moving the root is never sent again.
+	flaky.requests, flaky.failures = 0, 1
+	suite.Panics(func() { suite.store.UpdateRoot(c.Hash(), hash.Hash{}) })
+	suite.Equal(1, flaky.requests)
+}
+
+func (suite *HTTPBatchStoreSuite) TestNoRetries() {
+	suite.store.opts.Retries = -1
+	flaky := &flakyDoer{httpDoer: suite.store.httpClient, failures: 1}
+	suite.store.httpClient = flaky
+	suite.Panics(func() { suite.store.Root() })
+	suite.Equal(1, flaky.requests)
+}
@@ -44,6 +44,25 @@ func (lbs *localBatchStore) Get(h hash.Hash) chunks.Chunk {
 	return lbs.cs.Get(h)
 }
 
+// GetMany checks the internal Chunk cache, proxying to the backing ChunkStore for those that aren't present.
+func (lbs *localBatchStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	lbs.once.Do(lbs.expectVersion)
+	found := make([]chunks.Chunk, len(hashes))
+	misses, missIdx := hash.HashSlice{}, []int{}
+	for i, h := range hashes {
+		if found[i] = lbs.unwrittenPuts.Get(h); found[i].IsEmpty() {
+			misses = append(misses, h)
+			missIdx = append(missIdx, i)
+		}
+	}
+	if len(misses) > 0 {
+		for i, c := range lbs.cs.GetMany(misses) {
+			found[missIdx[i]] = c
+		}
+	}
+	return found
+}
+
 // Has checks the internal Chunk cache, proxying to the backing ChunkStore if not present.
 func (lbs *localBatchStore) Has(h hash.Hash) bool {
 	lbs.once.Do(lbs.expectVersion)
@@ -53,6 +72,18 @@ func (lbs *localBatchStore) Has(h hash.Hash) bool {
 	return lbs.cs.Has(h)
 }
 
+// HasMany checks the internal Chunk cache, proxying to the backing ChunkStore for those that aren't present.
+func (lbs *localBatchStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	lbs.once.Do(lbs.expectVersion)
+	notPending := hash.HashSet{}
+	for h := range hashes {
+		if !lbs.unwrittenPuts.has(h) {
+			notPending.Insert(h)
+		}
+	}
+	return lbs.cs.HasMany(notPending)
+}
+
 // SchedulePut simply calls Put on the underlying ChunkStore, and ignores hints.
 func (lbs *localBatchStore) SchedulePut(c chunks.Chunk, refHeight uint64, hints types.Hints) {
 	lbs.once.Do(lbs.expectVersion)
@@ -66,6 +97,7 @@ func (lbs *localBatchStore) SchedulePut(c chunks.Chunk, refHeight uint64, hints
 
 func (lbs *localBatchStore) expectVersion() {
 	dataVersion := lbs.cs.Version()
+	d.PanicIfTrue(constants.CanUpgrade(dataVersion), "SDK version %s incompatible with data of version %s; upgrade the database with noms backup and noms restore", constants.NomsVersion, dataVersion)
 	d.PanicIfTrue(constants.NomsVersion != dataVersion, "SDK version %s incompatible with data of version %s", constants.NomsVersion, dataVersion)
 }
 
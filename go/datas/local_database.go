@@ -6,6 +6,7 @@ package datas
 
 import (
 	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/types"
 )
 
@@ -32,7 +33,10 @@ func (ldb *LocalDatabase) GetDataset(datasetID string) Dataset {
 func (ldb *LocalDatabase) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
 	return ldb.doHeadUpdate(
 		ds,
-		func(ds Dataset) error { return ldb.doCommit(ds.ID(), buildNewCommit(ds, v, opts)) },
+		func(ds Dataset) error {
+			ldb.readParents(opts)
+			return ldb.doCommitWithRebase(ds, v, opts)
+		},
 	)
 }
 
@@ -52,15 +56,46 @@ func (ldb *LocalDatabase) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset
 	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doFastForward(ds, newHeadRef) })
 }
 
+func (ldb *LocalDatabase) CommitE(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ldb.Commit(ds, v, opts) })
+}
+
+func (ldb *LocalDatabase) CommitValueE(ds Dataset, v types.Value) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ldb.CommitValue(ds, v) })
+}
+
+func (ldb *LocalDatabase) DeleteE(ds Dataset) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ldb.Delete(ds) })
+}
+
+func (ldb *LocalDatabase) SetHeadE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ldb.SetHead(ds, newHeadRef) })
+}
+
+func (ldb *LocalDatabase) FastForwardE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ldb.FastForward(ds, newHeadRef) })
+}
+
 func (ldb *LocalDatabase) doHeadUpdate(ds Dataset, updateFunc func(ds Dataset) error) (Dataset, error) {
 	if ldb.vbs != nil {
 		ldb.vbs.FlushAndDestroyWithoutClose()
 		ldb.vbs = nil
 	}
-	err := updateFunc(ds)
+	var err error
+	if qerr := d.Try(func() { err = updateFunc(ds) }, chunks.QuotaExceededError{}); qerr != nil {
+		err = qerr
+	}
 	return ldb.GetDataset(ds.ID()), err
 }
 
+// Stats reports how much data ldb's ChunkStore holds. If the ChunkStore keeps track of that itself, e.g. because it's an AccountingStore, its figures are used; otherwise the ChunkStore's chunks are counted, which requires it to be a ChunkIterator. Only chunks which have been flushed to the ChunkStore are included.
+func (ldb *LocalDatabase) Stats() chunks.StoreStats {
+	if sr, ok := ldb.cs.(chunks.StatsReporter); ok {
+		return sr.Stats()
+	}
+	return chunks.ComputeStats(ldb.cs)
+}
+
 func (ldb *LocalDatabase) validatingBatchStore() types.BatchStore {
 	if ldb.vbs == nil {
 		ldb.vbs = newLocalBatchStore(ldb.cs)
@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sync"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// publishedStore is a read-only ChunkStore whose root only has the datasets of the store it wraps that match its patterns.
+type publishedStore struct {
+	chunks.ChunkStore
+	patterns []string
+	mu       *sync.Mutex
+	// root is the root of the wrapped store that published was made from, and published is the root with only the matching datasets, whose chunks are kept in roots.
+	root, published hash.Hash
+	roots           *chunks.MemoryStore
+}
+
+// NewPublishedStore returns a read-only ChunkStore for publishing some of the datasets in |cs|. Its root only has the datasets whose names match |patterns|, as understood by path.Match, e.g. "public-*", so a Database of it, or a RemoteDatabaseServer serving it, only shows those. The rest of cs's chunks can still be read, though, by anyone who knows their hashes. Writing to it panics with a ReadOnlyError.
+func NewPublishedStore(cs chunks.ChunkStore, patterns []string) chunks.ChunkStore {
+	return &publishedStore{ChunkStore: cs, patterns: patterns, mu: &sync.Mutex{}, roots: chunks.NewMemoryStore()}
+}
+
+// Root returns the hash of a map of the matching datasets in the root of the wrapped store, which is made again whenever that root changes.
+func (ps *publishedStore) Root() hash.Hash {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	root := ps.ChunkStore.Root()
+	if root == ps.root && !ps.published.IsEmpty() {
+		return ps.published
+	}
+	published := types.NewMap()
+	readRootMap(ps.ChunkStore, root).IterAll(func(k, v types.Value) {
+		if matchesAny(ps.patterns, string(k.(types.String))) {
+			published = published.Set(k, v)
+		}
+	})
+	ps.roots = chunks.NewMemoryStore()
+	ps.root, ps.published = root, rootWriter{ps.roots}.WriteValue(published).TargetHash()
+	return ps.published
+}
+
+// rootWriter writes the chunks of the published root to a store without checking that the commits they refer to are there, as a ValueStore would, since those are in the wrapped store.
+type rootWriter struct {
+	cs chunks.ChunkStore
+}
+
+func (w rootWriter) WriteValue(v types.Value) types.Ref {
+	w.cs.Put(types.EncodeValue(v, w))
+	return types.NewRef(v)
+}
+
+func (ps *publishedStore) Get(h hash.Hash) chunks.Chunk {
+	if c := ps.rootChunk(h); !c.IsEmpty() {
+		return c
+	}
+	return ps.ChunkStore.Get(h)
+}
+
+func (ps *publishedStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	found := ps.ChunkStore.GetMany(hashes)
+	for i, h := range hashes {
+		if c := ps.rootChunk(h); !c.IsEmpty() {
+			found[i] = c
+		}
+	}
+	return found
+}
+
+func (ps *publishedStore) Has(h hash.Hash) bool {
+	return !ps.rootChunk(h).IsEmpty() || ps.ChunkStore.Has(h)
+}
+
+func (ps *publishedStore) HasMany(hashes hash.HashSet) (absent hash.HashSet) {
+	absent = ps.ChunkStore.HasMany(hashes)
+	for h := range absent {
+		if !ps.rootChunk(h).IsEmpty() {
+			absent.Remove(h)
+		}
+	}
+	return
+}
+
+// rootChunk returns the chunk of the published root with the hash |h|, or the empty chunk if there isn't one.
+func (ps *publishedStore) rootChunk(h hash.Hash) chunks.Chunk {
+	ps.mu.Lock()
+	roots := ps.roots
+	ps.mu.Unlock()
+	return roots.Get(h)
+}
+
+func (ps *publishedStore) Put(c chunks.Chunk) {
+	d.PanicIfError(ReadOnlyError{Op: "write chunks"})
+}
+
+func (ps *publishedStore) PutMany(chnx []chunks.Chunk) chunks.BackpressureError {
+	d.PanicIfError(ReadOnlyError{Op: "write chunks"})
+	return nil
+}
+
+func (ps *publishedStore) UpdateRoot(current, last hash.Hash) bool {
+	d.PanicIfError(ReadOnlyError{Op: "update the root"})
+	return false
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestPublishedStore(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	writer := NewDatabase(cs)
+	_, err := writer.CommitValue(writer.GetDataset("public-a"), types.String("a"))
+	assert.NoError(err)
+	_, err = writer.CommitValue(writer.GetDataset("private"), types.String("secret"))
+	assert.NoError(err)
+
+	ps := NewPublishedStore(cs, []string{"public-*"})
+	db := NewDatabase(ps)
+	assert.Equal(uint64(1), db.Datasets().Len())
+	assert.Equal(types.String("a"), db.GetDataset("public-a").HeadValue())
+	_, ok := db.GetDataset("private").MaybeHead()
+	assert.False(ok)
+
+	// The published root follows the wrapped store's.
+	_, err = writer.CommitValue(writer.GetDataset("public-b"), types.String("b"))
+	assert.NoError(err)
+	db.Rebase()
+	assert.Equal(uint64(2), db.Datasets().Len())
+	assert.Equal(types.String("b"), db.GetDataset("public-b").HeadValue())
+	assert.True(ps.Has(ps.Root()))
+
+	assert.Panics(func() { ps.Put(chunks.NewChunk([]byte("abc"))) })
+	assert.Panics(func() { ps.UpdateRoot(cs.Root(), ps.Root()) })
+}
+
+func TestReadOnlyServer(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	writer := NewDatabase(cs)
+	_, err := writer.CommitValue(writer.GetDataset("public"), types.String("hello"))
+	assert.NoError(err)
+	_, err = writer.CommitValue(writer.GetDataset("private"), types.String("secret"))
+	assert.NoError(err)
+
+	server := NewRemoteDatabaseServer(NewPublishedStore(cs, []string{"public"}), 0)
+	server.ReadOnly = true
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	client := NewRemoteDatabase(url, "")
+	defer client.Close()
+	assert.Equal(uint64(1), client.Datasets().Len())
+	assert.Equal(types.String("hello"), client.GetDataset("public").HeadValue())
+
+	for _, path := range []string{constants.WriteValuePath, constants.RootPath} {
+		res, err := http.DefaultClient.Do(newRequest("POST", "", url+path, nil, nil))
+		assert.NoError(err)
+		res.Body.Close()
+		assert.Equal(http.StatusForbidden, res.StatusCode, path)
+	}
+}
@@ -5,14 +5,18 @@
 package datas
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"sort"
 	"sync"
 
+	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
+	"github.com/stormasm/noms/go/util/tracing"
 	"github.com/golang/snappy"
 )
 
@@ -20,18 +24,52 @@ type PullProgress struct {
 	DoneCount, KnownCount, ApproxWrittenBytes uint64
 }
 
-const bytesWrittenSampleRate = .10
+const (
+	bytesWrittenSampleRate = .10
+
+	// The refs to be pulled from the source are checked against the sink, and fetched from the source, in batches of this size.
+	pullPrefetchBatchSize = 1 << 10
+)
 
 // Pull objects that descend from sourceRef from srcDB to sinkDB. sinkHeadRef
 // should point to a Commit (in sinkDB) that's an ancestor of sourceRef. This
 // allows the algorithm to figure out which portions of data are already
 // present in sinkDB and skip copying them.
 func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency int, progressCh chan PullProgress) {
+	ctx := context.Background()
+	if progressCh != nil {
+		ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(p progress.Progress) {
+			progressCh <- PullProgress{p.Chunks, p.TotalChunks, p.Bytes}
+		}))
+	}
+	d.PanicIfError(PullContext(ctx, srcDB, sinkDB, sourceRef, sinkHeadRef, concurrency))
+}
+
+// PullContext is like Pull, but reports its progress to |ctx|, in chunks pulled of those known to need pulling, and approximately how many bytes they've taken to write, and stops, returning ctx.Err(), if |ctx| is canceled. The chunks pulled by then are left in sinkDB, but its datasets aren't changed. The pull is traced as a span tagged with the chunks and bytes pulled.
+func PullContext(ctx context.Context, srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency int) (err error) {
+	ctx, span := tracing.Start(ctx, "noms.pull")
+	pulled := progress.NewCounter(nil)
+	defer func() {
+		p := pulled.Progress()
+		span.SetTag("chunks", p.Chunks)
+		span.SetTag("bytes", p.Bytes)
+		if err != nil {
+			span.SetTag("error", err.Error())
+		}
+		span.Finish()
+	}()
 	srcQ, sinkQ := &types.RefByHeight{sourceRef}, &types.RefByHeight{sinkHeadRef}
 
 	// If the sourceRef points to an object already in sinkDB, there's nothing to do.
 	if sinkDB.has(sourceRef.TargetHash()) {
-		return
+		return nil
+	}
+
+	if rdb, ok := srcDB.(*RemoteDatabaseClient); ok {
+		if ok, err := pullFromServer(ctx, rdb, sinkDB, sourceRef, sinkHeadRef, pulled); ok {
+			span.SetTag("server", true)
+			return err
+		}
 	}
 
 	// We generally expect that sourceRef descends from sinkHeadRef, so that walking down from sinkHeadRef yields useful hints. If it's not even in the srcDB, then just clear out sinkQ right now and don't bother.
@@ -45,8 +83,8 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		mostLocalDB = sinkDB
 	}
 	// traverseWorker below takes refs off of {src,sink,com}Chan, processes them to figure out what reachable refs should be traversed, and then sends the results to {srcRes,sinkRes,comRes}Chan.
-	// sending to (or closing) the 'done' channel causes traverseWorkers to exit.
-	srcChan := make(chan types.Ref)
+	// Closing the 'done' channel causes traverseWorkers, and the goroutines sending them work, to exit, even if they're in the middle of sending, as they are if the pull is canceled.
+	srcChan := make(chan prefetchedRef)
 	sinkChan := make(chan types.Ref)
 	comChan := make(chan types.Ref)
 	srcResChan := make(chan traverseSourceResult)
@@ -54,10 +92,11 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 	comResChan := make(chan traverseResult)
 	done := make(chan struct{})
 
-	workerWg := &sync.WaitGroup{}
+	workerWg, senderWg := &sync.WaitGroup{}, &sync.WaitGroup{}
 	defer func() {
 		close(done)
 		workerWg.Wait()
+		senderWg.Wait()
 
 		close(srcChan)
 		close(sinkChan)
@@ -71,18 +110,27 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		go func() {
 			for {
 				select {
-				case srcRef := <-srcChan:
+				case src := <-srcChan:
 					// Hook in here to estimate the bytes written to disk during pull (since
 					// srcChan contains all chunks to be written to the sink). Rather than measuring
 					// the serialized, compressed bytes of each chunk, we take a 10% sample.
 					// There's no immediately observable performance benefit to sampling here, but there's
 					// also no appreciable loss in accuracy, so we'll keep it around.
 					takeSample := rand.Float64() < bytesWrittenSampleRate
-					srcResChan <- traverseSource(srcRef, srcDB, sinkDB, takeSample)
+					select {
+					case srcResChan <- traverseSource(src, srcDB, sinkDB, takeSample):
+					case <-done:
+					}
 				case sinkRef := <-sinkChan:
-					sinkResChan <- traverseSink(sinkRef, mostLocalDB)
+					select {
+					case sinkResChan <- traverseSink(sinkRef, mostLocalDB):
+					case <-done:
+					}
 				case comRef := <-comChan:
-					comResChan <- traverseCommon(comRef, sinkHeadRef, mostLocalDB)
+					select {
+					case comResChan <- traverseCommon(comRef, sinkHeadRef, mostLocalDB):
+					case <-done:
+					}
 				case <-done:
 					workerWg.Done()
 					return
@@ -94,13 +142,10 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		traverseWorker()
 	}
 
-	var doneCount, knownCount, approxBytesWritten uint64
-	updateProgress := func(moreDone, moreKnown, moreBytesRead, moreApproxBytesWritten uint64) {
-		if progressCh == nil {
-			return
-		}
-		doneCount, knownCount, approxBytesWritten = doneCount+moreDone, knownCount+moreKnown, approxBytesWritten+moreApproxBytesWritten
-		progressCh <- PullProgress{doneCount, knownCount + uint64(srcQ.Len()), approxBytesWritten}
+	updateProgress := func(moreDone, moreKnown, moreApproxBytesWritten uint64) {
+		p := progress.Progress{Chunks: moreDone, TotalChunks: moreKnown, Bytes: moreApproxBytesWritten}
+		pulled.Add(p)
+		progress.Add(ctx, p)
 	}
 
 	// hc and reachableChunks aren't goroutine-safe, so only write them here.
@@ -109,20 +154,35 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 	sampleSize := uint64(0)
 	sampleCount := uint64(0)
 	for !srcQ.Empty() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		srcRefs, sinkRefs, comRefs := planWork(srcQ, sinkQ)
 		srcWork, sinkWork, comWork := len(srcRefs), len(sinkRefs), len(comRefs)
 		if srcWork+comWork > 0 {
-			updateProgress(0, uint64(srcWork+comWork), 0, 0)
+			updateProgress(0, uint64(srcWork+comWork), 0)
 		}
 
-		// These goroutines send work to traverseWorkers, blocking when all are busy. They self-terminate when they've sent all they have.
-		go sendWork(srcChan, srcRefs)
-		go sendWork(sinkChan, sinkRefs)
-		go sendWork(comChan, comRefs)
+		// These goroutines send work to traverseWorkers, blocking when all are busy. They self-terminate when they've sent all they have, or when done is closed.
+		senderWg.Add(3)
+		go func() {
+			defer senderWg.Done()
+			prefetchAndSendWork(srcChan, srcRefs, srcDB, sinkDB, done)
+		}()
+		go func() {
+			defer senderWg.Done()
+			sendWork(sinkChan, sinkRefs, done)
+		}()
+		go func() {
+			defer senderWg.Done()
+			sendWork(comChan, comRefs, done)
+		}()
 		//  Don't use srcRefs, sinkRefs, or comRefs after this point. The goroutines above own them.
 
 		for srcWork+sinkWork+comWork > 0 {
 			select {
+			case <-ctx.Done():
+				return ctx.Err()
 			case res := <-srcResChan:
 				for _, reachable := range res.reachables {
 					srcQ.PushBack(reachable)
@@ -137,7 +197,7 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 				}
 				srcWork--
 
-				updateProgress(1, 0, uint64(res.readBytes), sampleSize/uint64(math.Max(1, float64(sampleCount))))
+				updateProgress(1, 0, sampleSize/uint64(math.Max(1, float64(sampleCount))))
 			case res := <-sinkResChan:
 				for _, reachable := range res.reachables {
 					sinkQ.PushBack(reachable)
@@ -154,7 +214,7 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 					hc[reachable.TargetHash()] = res.readHash
 				}
 				comWork--
-				updateProgress(1, 0, uint64(res.readBytes), 0)
+				updateProgress(1, 0, 0)
 			}
 		}
 		sort.Sort(sinkQ)
@@ -170,6 +230,106 @@ func Pull(srcDB, sinkDB Database, sourceRef, sinkHeadRef types.Ref, concurrency
 		}
 	}
 	sinkDB.validatingBatchStore().AddHints(hints)
+	return nil
+}
+
+// pullFromServer has the server |srcDB| is a client of work out which chunks are reachable from sourceRef but not from sinkHeadRef, and stream them back, so that the pull takes one round trip, rather than one per level of the graph. The chunks, and their bytes, are added to |pulled|. It returns false if the server can't, so that the pull has to be done here.
+func pullFromServer(ctx context.Context, srcDB *RemoteDatabaseClient, sinkDB Database, sourceRef, sinkHeadRef types.Ref, pulled *progress.Counter) (bool, error) {
+	haves := hash.HashSlice{}
+	if !sinkHeadRef.TargetHash().IsEmpty() {
+		haves = append(haves, sinkHeadRef.TargetHash())
+	}
+	sink := &pulledChunkSink{ctx, srcDB, sinkDB.validatingBatchStore(), pulled}
+	return srcDB.httpBatchStore().pullRefs(ctx, hash.HashSlice{sourceRef.TargetHash()}, haves, sink)
+}
+
+// pulledChunkSink schedules the chunks a server sends for a pull to be written to the sink, and reports them to the pull's Context and to pulled.
+type pulledChunkSink struct {
+	ctx    context.Context
+	srcDB  Database
+	sink   types.BatchStore
+	pulled *progress.Counter
+}
+
+func (s *pulledChunkSink) Put(c chunks.Chunk) {
+	v := types.DecodeValue(c, s.srcDB)
+	d.PanicIfFalse(v != nil, "Expected decoded chunk to be non-nil.")
+	progress.Add(s.ctx, progress.Progress{TotalChunks: 1})
+	s.sink.SchedulePut(c, types.NewRef(v).Height(), types.Hints{})
+	p := progress.Progress{Chunks: 1, Bytes: uint64(len(snappy.Encode(nil, c.Data())))}
+	s.pulled.Add(p)
+	progress.Add(s.ctx, p)
+}
+
+func (s *pulledChunkSink) PutMany(chnx []chunks.Chunk) (e chunks.BackpressureError) {
+	for _, c := range chnx {
+		s.Put(c)
+	}
+	return
+}
+
+func (s *pulledChunkSink) Close() error {
+	return nil
+}
+
+// novelChunks calls |send| with each of the Chunks in |cs| that are reachable from |wants| but not from |haves|. It walks the two graphs a height at a time, tallest first, as Pull does, so that the parts they have in common are only walked from the haves side, and only as far down as the wants need.
+func novelChunks(cs chunks.ChunkStore, wants, haves types.RefSlice, send func(c chunks.Chunk)) {
+	srcQ, sinkQ := &types.RefByHeight{}, &types.RefByHeight{}
+	for _, r := range wants {
+		srcQ.PushBack(r)
+	}
+	for _, r := range haves {
+		sinkQ.PushBack(r)
+	}
+	sort.Sort(srcQ)
+	sort.Sort(sinkQ)
+	srcQ.Unique()
+	sinkQ.Unique()
+
+	for !srcQ.Empty() {
+		srcRefs, sinkRefs, comRefs := planWork(srcQ, sinkQ)
+		readChunks(cs, srcRefs, func(c chunks.Chunk) {
+			send(c)
+			for _, r := range getChunks(types.DecodeValue(c, nil)) {
+				srcQ.PushBack(r)
+			}
+		})
+		// Everything reachable from a common ref is reachable from the haves, so it's only walked from there. Leaves refer to nothing, so they needn't be read.
+		toWalk := types.RefSlice{}
+		for _, r := range append(sinkRefs, comRefs...) {
+			if r.Height() > 1 {
+				toWalk = append(toWalk, r)
+			}
+		}
+		readChunks(cs, toWalk, func(c chunks.Chunk) {
+			for _, r := range getChunks(types.DecodeValue(c, nil)) {
+				sinkQ.PushBack(r)
+			}
+		})
+		sort.Sort(sinkQ)
+		sort.Sort(srcQ)
+		sinkQ.Unique()
+		srcQ.Unique()
+	}
+}
+
+// readChunks calls |cb| with the Chunk for each of |refs|, reading them in batches of pullPrefetchBatchSize.
+func readChunks(cs chunks.ChunkStore, refs types.RefSlice, cb func(c chunks.Chunk)) {
+	hashes := hash.HashSlice{}
+	for _, r := range refs {
+		hashes = append(hashes, r.TargetHash())
+	}
+	for len(hashes) > 0 {
+		n := pullPrefetchBatchSize
+		if n > len(hashes) {
+			n = len(hashes)
+		}
+		for i, c := range cs.GetMany(hashes[:n]) {
+			d.PanicIfTrue(c.IsEmpty(), "Chunk %s not found", hashes[i])
+			cb(c)
+		}
+		hashes = hashes[n:]
+	}
 }
 
 type traverseResult struct {
@@ -229,9 +389,57 @@ func findCommon(taller, shorter *types.RefByHeight, height uint64) (tallRefs, co
 	return
 }
 
-func sendWork(ch chan<- types.Ref, refs types.RefSlice) {
+// sendWork sends each of |refs| to |ch|, giving up if |done| is closed.
+func sendWork(ch chan<- types.Ref, refs types.RefSlice, done <-chan struct{}) {
 	for _, r := range refs {
-		ch <- r
+		select {
+		case ch <- r:
+		case <-done:
+			return
+		}
+	}
+}
+
+// prefetchedRef is a ref to be pulled from the source, along with whether the sink already has the chunk it points to and, if not, the chunk.
+type prefetchedRef struct {
+	ref    types.Ref
+	inSink bool
+	chunk  chunks.Chunk
+}
+
+// prefetchAndSendWork works through |refs| in batches, finding out which ones |sinkDB| is missing and fetching them from |srcDB| with one HasMany() and one GetMany() per batch, rather than a round trip per ref. Like sendWork, it gives up if |done| is closed.
+func prefetchAndSendWork(ch chan<- prefetchedRef, refs types.RefSlice, srcDB, sinkDB Database, done <-chan struct{}) {
+	for len(refs) > 0 {
+		n := pullPrefetchBatchSize
+		if n > len(refs) {
+			n = len(refs)
+		}
+		batch := refs[:n]
+		refs = refs[n:]
+
+		hashes := hash.HashSet{}
+		for _, r := range batch {
+			hashes.Insert(r.TargetHash())
+		}
+		absent := sinkDB.hasMany(hashes)
+		toGet := make(hash.HashSlice, 0, len(absent))
+		for _, r := range batch {
+			if absent.Has(r.TargetHash()) {
+				toGet = append(toGet, r.TargetHash())
+			}
+		}
+		fetched := map[hash.Hash]chunks.Chunk{}
+		for i, c := range srcDB.validatingBatchStore().GetMany(toGet) {
+			fetched[toGet[i]] = c
+		}
+
+		for _, r := range batch {
+			select {
+			case ch <- prefetchedRef{r, !absent.Has(r.TargetHash()), fetched[r.TargetHash()]}:
+			case <-done:
+				return
+			}
+		}
 	}
 }
 
@@ -244,11 +452,10 @@ func getChunks(v types.Value) (chunks []types.Ref) {
 	return
 }
 
-func traverseSource(srcRef types.Ref, srcDB, sinkDB Database, estimateBytesWritten bool) traverseSourceResult {
+func traverseSource(src prefetchedRef, srcDB, sinkDB Database, estimateBytesWritten bool) traverseSourceResult {
+	srcRef, c := src.ref, src.chunk
 	h := srcRef.TargetHash()
-	if !sinkDB.has(h) {
-		srcBS := srcDB.validatingBatchStore()
-		c := srcBS.Get(h)
+	if !src.inSink {
 		v := types.DecodeValue(c, srcDB)
 		d.PanicIfFalse(v != nil, "Expected decoded chunk to be non-nil.")
 		sinkDB.validatingBatchStore().SchedulePut(c, srcRef.Height(), types.Hints{})
@@ -293,3 +500,30 @@ func traverseCommon(comRef, sinkHead types.Ref, db Database) traverseResult {
 	}
 	return traverseResult{}
 }
+
+// EstimatePull returns the number of chunks that Pull() would copy from srcDB to sinkDB to pull sourceRef, and approximately how many bytes they'd take up once written, without writing anything. Like Pull(), it assumes that if sinkDB has a chunk, it has every chunk reachable from it, so it only visits the chunks that sinkDB is missing.
+func EstimatePull(srcDB, sinkDB Database, sourceRef types.Ref) (chunkCount, approxBytes uint64) {
+	visited := hash.HashSet{}
+	refs := types.RefSlice{sourceRef}
+	for len(refs) > 0 {
+		hashes := hash.HashSet{}
+		for _, r := range refs {
+			hashes.Insert(r.TargetHash())
+		}
+		absent := sinkDB.hasMany(hashes)
+		toGet := hash.HashSlice{}
+		for h := range absent {
+			if !visited.Has(h) {
+				visited.Insert(h)
+				toGet = append(toGet, h)
+			}
+		}
+		refs = nil
+		for _, c := range srcDB.validatingBatchStore().GetMany(toGet) {
+			chunkCount++
+			approxBytes += uint64(len(snappy.Encode(nil, c.Data())))
+			refs = append(refs, getChunks(types.DecodeValue(c, srcDB))...)
+		}
+	}
+	return
+}
@@ -5,11 +5,14 @@
 package datas
 
 import (
+	"context"
 	"sort"
 	"testing"
 
 	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/attic-labs/testify/assert"
 	"github.com/attic-labs/testify/suite"
 )
@@ -94,6 +97,12 @@ func (suite *PullSuite) sinkIsLocal() bool {
 	return isLocal
 }
 
+// sourceIsRemote is true if the source is a server, which works out what to pull itself, without reading anything from the sink.
+func (suite *PullSuite) sourceIsRemote() bool {
+	_, isRemote := suite.source.(*RemoteDatabaseClient)
+	return isRemote
+}
+
 func (suite *PullSuite) TearDownTest() {
 	suite.sink.Close()
 	suite.source.Close()
@@ -164,6 +173,31 @@ func (suite *PullSuite) TestPullEverything() {
 	suite.True(l.Equals(v.Get(ValueField)))
 }
 
+func (suite *PullSuite) TestPullContextCanceled() {
+	l := buildListOfHeight(5, suite.source)
+	sourceRef := suite.commitToSource(l, types.NewSet())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.Equal(context.Canceled, PullContext(ctx, suite.source, suite.sink, sourceRef, types.Ref{}, 2))
+
+	// Canceling part way through stops the pull, and its goroutines, even while they're busy.
+	ctx, cancel = context.WithCancel(context.Background())
+	reported := progress.Progress{}
+	ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(p progress.Progress) {
+		reported = p
+		if p.Chunks == 2 {
+			cancel()
+		}
+	}))
+	suite.Equal(context.Canceled, PullContext(ctx, suite.source, suite.sink, sourceRef, types.Ref{}, 2))
+	suite.True(reported.Chunks >= 2)
+
+	suite.NoError(PullContext(context.Background(), suite.source, suite.sink, sourceRef, types.Ref{}, 2))
+	suite.sink.validatingBatchStore().Flush()
+	suite.True(l.Equals(suite.sink.ReadValue(sourceRef.TargetHash()).(types.Struct).Get(ValueField)))
+}
+
 // Source: -6-> C3(L5) -1-> N
 //               .  \  -5-> L4 -1-> N
 //                .          \ -4-> L3 -1-> N
@@ -198,7 +232,7 @@ func (suite *PullSuite) TestPullMultiGeneration() {
 	pt := startProgressTracker()
 
 	Pull(suite.source, suite.sink, sourceRef, sinkRef, 2, pt.Ch)
-	if suite.sinkIsLocal() {
+	if suite.sinkIsLocal() && !suite.sourceIsRemote() {
 		// C1 gets read from most-local DB
 		expectedReads++
 	}
@@ -293,7 +327,7 @@ func (suite *PullSuite) TestPullUpdates() {
 
 	Pull(suite.source, suite.sink, sourceRef, sinkRef, 2, pt.Ch)
 
-	if suite.sinkIsLocal() {
+	if suite.sinkIsLocal() && !suite.sourceIsRemote() {
 		// 3 objects read from sink: L3, L2 and C1 (when considering the shared commit).
 		expectedReads += 3
 	}
@@ -306,6 +340,37 @@ func (suite *PullSuite) TestPullUpdates() {
 	suite.True(srcL.Equals(v.Get(ValueField)))
 }
 
+// EstimatePull() counts exactly the chunks that Pull() then writes, without writing any itself.
+func (suite *PullSuite) TestEstimatePull() {
+	sinkL := buildListOfHeight(2, suite.sink)
+	sinkRef := suite.commitToSink(sinkL, types.NewSet())
+
+	srcL := buildListOfHeight(2, suite.source)
+	sourceRef := suite.commitToSource(srcL, types.NewSet())
+	srcL = buildListOfHeight(4, suite.source)
+	sourceRef = suite.commitToSource(srcL, types.NewSet(sourceRef))
+
+	preWrites := suite.sinkCS.Writes
+	count, bytes := EstimatePull(suite.source, suite.sink, sourceRef)
+	suite.Equal(preWrites, suite.sinkCS.Writes)
+	suite.True(count > 0)
+	suite.True(bytes > 0)
+
+	Pull(suite.source, suite.sink, sourceRef, sinkRef, 2, nil)
+	suite.sink.validatingBatchStore().Flush()
+	suite.Equal(int(count), suite.sinkCS.Writes-preWrites)
+}
+
+// A commit in the sink can have a parent that was just pulled into it.
+func (suite *PullSuite) TestCommitPulledParent() {
+	sinkRef := suite.commitToSink(types.String("sink"), types.NewSet())
+	sourceRef := suite.commitToSource(types.String("source"), types.NewSet())
+
+	Pull(suite.source, suite.sink, sourceRef, sinkRef, 2, nil)
+	mergeRef := suite.commitToSink(types.String("merged"), types.NewSet(sinkRef, sourceRef))
+	suite.True(CommitDescendsFrom(suite.sink.ReadValue(mergeRef.TargetHash()).(types.Struct), sourceRef, suite.sink))
+}
+
 func (suite *PullSuite) commitToSource(v types.Value, p types.Set) types.Ref {
 	ds := suite.source.GetDataset(datasetID)
 	ds, err := suite.source.Commit(ds, v, CommitOptions{Parents: p})
@@ -360,3 +425,50 @@ func TestFindCommon(t *testing.T) {
 	assert.Equal(t, 0, len(*taller))
 	assert.Equal(t, 50, len(*shorter))
 }
+
+// novelChunks finds exactly the chunks reachable from the wants, and not from the haves, as walking everything reachable from both would.
+func TestNovelChunks(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	defer db.Close()
+
+	ds, err := db.CommitValue(db.GetDataset(datasetID), buildListOfHeight(3, db))
+	assert.NoError(err)
+	have := ds.HeadRef()
+	l := ds.HeadValue().(types.List)
+	l = l.Append(db.WriteValue(types.String("oy!")))
+	ds, err = db.CommitValue(ds, l.Set(1, db.WriteValue(buildListOfHeight(5, db))))
+	assert.NoError(err)
+	want := ds.HeadRef()
+
+	var reachable func(r types.Ref, found hash.HashSet)
+	reachable = func(r types.Ref, found hash.HashSet) {
+		if found.Has(r.TargetHash()) {
+			return
+		}
+		found.Insert(r.TargetHash())
+		r.TargetValue(db).WalkRefs(func(r types.Ref) {
+			reachable(r, found)
+		})
+	}
+	expected, haves := hash.HashSet{}, hash.HashSet{}
+	reachable(want, expected)
+	reachable(have, haves)
+	for h := range haves {
+		expected.Remove(h)
+	}
+
+	sent := hash.HashSet{}
+	novelChunks(cs, types.RefSlice{want}, types.RefSlice{have}, func(c chunks.Chunk) {
+		assert.False(sent.Has(c.Hash()), "%s sent twice", c.Hash())
+		sent.Insert(c.Hash())
+	})
+	assert.Equal(expected, sent)
+
+	sent = hash.HashSet{}
+	novelChunks(cs, types.RefSlice{want}, types.RefSlice{want}, func(c chunks.Chunk) {
+		sent.Insert(c.Hash())
+	})
+	assert.Empty(sent)
+}
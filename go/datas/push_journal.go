@@ -0,0 +1,125 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// PushJournal records the hashes of the Chunks a server has acknowledged storing during a push, in a file, so that a push that's interrupted, even by the client crashing, can pick up where it left off rather than starting over. Chunks are sent lowest first, so every Chunk in the journal has all the Chunks it refers to on the server too.
+type PushJournal struct {
+	path   string
+	f      *os.File
+	hashes hash.HashSet
+	mu     *sync.RWMutex
+}
+
+// OpenPushJournal opens the journal at |path|, creating it, and the directory it's in, if they don't exist.
+func OpenPushJournal(path string) (*PushJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// A crash part way through recording a hash leaves a partial one at the end, which is dropped.
+	data = data[:len(data)-len(data)%hash.ByteLen]
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := hash.HashSet{}
+	for ; len(data) > 0; data = data[hash.ByteLen:] {
+		digest := hash.Digest{}
+		copy(digest[:], data)
+		hashes.Insert(hash.New(digest))
+	}
+	return &PushJournal{path, f, hashes, &sync.RWMutex{}}, nil
+}
+
+// Len returns how many Chunks j has recorded.
+func (j *PushJournal) Len() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.hashes)
+}
+
+// Remove closes j and deletes its file, as once the push it was for is done.
+func (j *PushJournal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.f.Close()
+	return os.Remove(j.path)
+}
+
+func (j *PushJournal) has(h hash.Hash) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.hashes.Has(h)
+}
+
+// all returns the hashes in j.
+func (j *PushJournal) all() hash.HashSet {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	hashes := hash.HashSet{}
+	for h := range j.hashes {
+		hashes.Insert(h)
+	}
+	return hashes
+}
+
+// record adds |hashes| to j, once the server has acknowledged storing their Chunks. The file is synced, so that they're still there if the client crashes.
+func (j *PushJournal) record(hashes hash.HashSlice) {
+	if j == nil || len(hashes) == 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data := make([]byte, 0, len(hashes)*hash.ByteLen)
+	for _, h := range hashes {
+		digest := h.Digest()
+		data = append(data, digest[:]...)
+		j.hashes.Insert(h)
+	}
+	_, err := j.f.Write(data)
+	d.PanicIfError(err)
+	d.PanicIfError(j.f.Sync())
+}
+
+// forget rewrites j without |hashes|, as when the server turns out not to have their Chunks after all.
+func (j *PushJournal) forget(hashes hash.HashSet) {
+	if len(hashes) == 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data := make([]byte, 0, len(j.hashes)*hash.ByteLen)
+	for h := range hashes {
+		j.hashes.Remove(h)
+	}
+	for h := range j.hashes {
+		digest := h.Digest()
+		data = append(data, digest[:]...)
+	}
+	d.PanicIfError(j.f.Truncate(0))
+	_, err := j.f.Write(data)
+	d.PanicIfError(err)
+	d.PanicIfError(j.f.Sync())
+}
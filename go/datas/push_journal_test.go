@@ -0,0 +1,50 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stormasm/noms/go/hash"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestPushJournal(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "push", "journal")
+
+	j, err := OpenPushJournal(path)
+	assert.NoError(err)
+	assert.Equal(0, j.Len())
+	h1, h2, h3 := hash.FromData([]byte("a")), hash.FromData([]byte("b")), hash.FromData([]byte("c"))
+	j.record(hash.HashSlice{h1, h2})
+	j.record(hash.HashSlice{h3})
+	j.forget(hash.HashSet{h2: struct{}{}})
+	assert.NoError(j.f.Close())
+
+	// A hash that was only partly written, as when the client crashed while recording it, is dropped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	assert.NoError(err)
+	_, err = f.Write([]byte{1, 2, 3})
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	j, err = OpenPushJournal(path)
+	assert.NoError(err)
+	assert.Equal(hash.HashSet{h1: struct{}{}, h3: struct{}{}}, j.all())
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(int64(2*hash.ByteLen), info.Size())
+
+	assert.NoError(j.Remove())
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// ReadOnlyError is returned, or for WriteValue() panicked with, when a read-only Database is asked to change. Op describes what was asked, and Dataset is the ID of the Dataset it was asked of, if any.
+type ReadOnlyError struct {
+	Op      string
+	Dataset string
+}
+
+func (e ReadOnlyError) Error() string {
+	if e.Dataset == "" {
+		return fmt.Sprintf("Cannot %s: database is read-only", e.Op)
+	}
+	return fmt.Sprintf("Cannot %s dataset %s: database is read-only", e.Op, e.Dataset)
+}
+
+// IsReadOnlyError returns true if |err| was returned because a Database is read-only.
+func IsReadOnlyError(err error) bool {
+	_, ok := err.(ReadOnlyError)
+	return ok
+}
+
+type readOnlyDatabase struct {
+	Database
+}
+
+// NewReadOnlyDatabase returns a Database that reads from |db|, but whose methods that would change it fail with a ReadOnlyError instead. Datasets gotten from it refer back to it, rather than to |db|, so they can't be used to change |db| either.
+func NewReadOnlyDatabase(db Database) Database {
+	if _, ok := db.(readOnlyDatabase); ok {
+		return db
+	}
+	return readOnlyDatabase{db}
+}
+
+func (ro readOnlyDatabase) GetDataset(datasetID string) Dataset {
+	return getDataset(ro, datasetID)
+}
+
+func (ro readOnlyDatabase) WriteValue(v types.Value) types.Ref {
+	d.PanicIfError(ReadOnlyError{Op: "write values"})
+	return types.Ref{}
+}
+
+func (ro readOnlyDatabase) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return ro.GetDataset(ds.ID()), ReadOnlyError{"commit to", ds.ID()}
+}
+
+func (ro readOnlyDatabase) CommitValue(ds Dataset, v types.Value) (Dataset, error) {
+	return ro.Commit(ds, v, CommitOptions{})
+}
+
+func (ro readOnlyDatabase) Delete(ds Dataset) (Dataset, error) {
+	return ro.GetDataset(ds.ID()), ReadOnlyError{"delete", ds.ID()}
+}
+
+func (ro readOnlyDatabase) SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return ro.GetDataset(ds.ID()), ReadOnlyError{"set the head of", ds.ID()}
+}
+
+func (ro readOnlyDatabase) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return ro.GetDataset(ds.ID()), ReadOnlyError{"fast-forward", ds.ID()}
+}
+
+func (ro readOnlyDatabase) CommitE(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ro.Commit(ds, v, opts) })
+}
+
+func (ro readOnlyDatabase) CommitValueE(ds Dataset, v types.Value) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ro.CommitValue(ds, v) })
+}
+
+func (ro readOnlyDatabase) DeleteE(ds Dataset) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ro.Delete(ds) })
+}
+
+func (ro readOnlyDatabase) SetHeadE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ro.SetHead(ds, newHeadRef) })
+}
+
+func (ro readOnlyDatabase) FastForwardE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return ro.FastForward(ds, newHeadRef) })
+}
@@ -5,6 +5,7 @@
 package datas
 
 import (
+	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/types"
 	"github.com/julienschmidt/httprouter"
 )
@@ -15,8 +16,22 @@ type RemoteDatabaseClient struct {
 }
 
 func NewRemoteDatabase(baseURL, auth string) *RemoteDatabaseClient {
-	httpBS := newHTTPBatchStore(baseURL, auth)
-	return &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(httpBS), types.NewValueStore(httpBS), httpBS)}
+	return NewRemoteDatabaseWithOptions(baseURL, auth, HTTPClientOptions{}, nil)
+}
+
+// NewRemoteDatabaseWithCache returns a Database for the server at |baseURL| which keeps a copy of every chunk it reads or writes in |cache|, so they don't need to be fetched over the network again. The Database takes ownership of |cache|, and closes it when it's closed.
+func NewRemoteDatabaseWithCache(baseURL, auth string, cache chunks.ChunkStore) *RemoteDatabaseClient {
+	return NewRemoteDatabaseWithOptions(baseURL, auth, HTTPClientOptions{}, cache)
+}
+
+// NewRemoteDatabaseWithOptions returns a Database for the server at |baseURL| whose HTTP client is configured by |opts|. If |cache| isn't nil, the Database keeps copies of chunks in it, as with NewRemoteDatabaseWithCache().
+func NewRemoteDatabaseWithOptions(baseURL, auth string, opts HTTPClientOptions, cache chunks.ChunkStore) *RemoteDatabaseClient {
+	httpBS := newHTTPBatchStore(baseURL, auth, opts)
+	if cache == nil {
+		return &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(httpBS), types.NewValueStore(httpBS), httpBS)}
+	}
+	tieredBS := newTieredBatchStore(httpBS, cache)
+	return &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(tieredBS), types.NewValueStore(tieredBS), tieredBS)}
 }
 
 func (rdb *RemoteDatabaseClient) validatingBatchStore() (bs types.BatchStore) {
@@ -24,12 +39,33 @@ func (rdb *RemoteDatabaseClient) validatingBatchStore() (bs types.BatchStore) {
 	return
 }
 
+// URL returns the URL of the server rdb is a client of.
+func (rdb *RemoteDatabaseClient) URL() string {
+	return rdb.httpBatchStore().host.String()
+}
+
+// SetPushJournal makes rdb record in |j| the chunks the server acknowledges storing, and take it from |j| that the server has them, rather than asking, so that pushing the same data again, after a push was interrupted, only sends what didn't make it. The server is first asked which of the chunks in |j| it wants, in case it's lost any, and those are dropped from |j|. A nil |j| stops rdb using a journal.
+func (rdb *RemoteDatabaseClient) SetPushJournal(j *PushJournal) {
+	rdb.httpBatchStore().setPushJournal(j)
+}
+
+func (rdb *RemoteDatabaseClient) httpBatchStore() *httpBatchStore {
+	switch bs := rdb.validatingBatchStore().(type) {
+	case *httpBatchStore:
+		return bs
+	case *tieredBatchStore:
+		return bs.httpBatchStore
+	}
+	panic("unreachable")
+}
+
 func (rdb *RemoteDatabaseClient) GetDataset(datasetID string) Dataset {
 	return getDataset(rdb, datasetID)
 }
 
 func (rdb *RemoteDatabaseClient) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
-	err := rdb.doCommit(ds.ID(), buildNewCommit(ds, v, opts))
+	rdb.readParents(opts)
+	err := rdb.doCommitWithRebase(ds, v, opts)
 	return rdb.GetDataset(ds.ID()), err
 }
 
@@ -52,6 +88,26 @@ func (rdb *RemoteDatabaseClient) FastForward(ds Dataset, newHeadRef types.Ref) (
 	return rdb.GetDataset(ds.ID()), err
 }
 
+func (rdb *RemoteDatabaseClient) CommitE(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return rdb.Commit(ds, v, opts) })
+}
+
+func (rdb *RemoteDatabaseClient) CommitValueE(ds Dataset, v types.Value) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return rdb.CommitValue(ds, v) })
+}
+
+func (rdb *RemoteDatabaseClient) DeleteE(ds Dataset) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return rdb.Delete(ds) })
+}
+
+func (rdb *RemoteDatabaseClient) SetHeadE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return rdb.SetHead(ds, newHeadRef) })
+}
+
+func (rdb *RemoteDatabaseClient) FastForwardE(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return updateE(ds, func() (Dataset, error) { return rdb.FastForward(ds, newHeadRef) })
+}
+
 func (f RemoteStoreFactory) CreateStore(ns string) Database {
 	return NewRemoteDatabase(f.host+httprouter.CleanPath(ns), f.auth)
 }
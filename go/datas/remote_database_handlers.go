@@ -5,19 +5,24 @@
 package datas
 
 import (
+	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/constants"
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/ngql"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/logging"
 	"github.com/stormasm/noms/go/util/orderedparallel"
 	"github.com/golang/snappy"
 )
@@ -38,15 +43,38 @@ var (
 	HandleWriteValue = versionCheck(handleWriteValue)
 
 	// HandleGetRefs is meant to handle HTTP POST requests to the getRefs/ server endpoint. Given a sequence of Chunk hashes, the server will fetch and return them.
-	// TODO: Nice comment about what headers it expects/honors, payload format, and responses.
+	// If the request's Content-Type is hashStreamContentType, its body is the 20-byte digests of the hashes, one after another, and the response, of type chunkStreamContentType, streams back the Chunks that are present as they're fetched, a batch at a time, ending with the frame written by chunks.SerializeEnd. Otherwise, the body is a form of ref=<hash> values, and the Chunks are all fetched before any are returned.
 	HandleGetRefs = versionCheck(handleGetRefs)
 
+	// HandleGetRef is meant to handle HTTP GET requests to the getRef/<hash> server endpoint. The server returns the data of the Chunk with that hash, or 404 Not Found if it doesn't have it. Since a Chunk never changes, the response can be cached forever, by CDNs and proxies as well as by clients unless the server has access control, and the hash is its ETag, so a request whose If-None-Match has it gets 304 Not Modified.
+	HandleGetRef = versionCheck(handleGetRef)
+
 	// HandleWriteValue is meant to handle HTTP POST requests to the hasRefs/ server endpoint. Given a sequence of Chunk hashes, the server check for their presence and return a list of true/false responses.
 	// TODO: Nice comment about what headers it expects/honors, payload format, and responses.
 	HandleHasRefs = versionCheck(handleHasRefs)
 
+	// HandleWantRefs is meant to handle HTTP POST requests to the wantRefs/ server endpoint. Given the hashes of Chunks a client means to send, as a body of type hashStreamContentType, the server returns the digests of the ones it doesn't have, which are the ones it wants, one after another, followed by an all-zero digest, so that the client can tell the answer wasn't cut off. It's what clients ask instead of hasRefs/, since the request and response are smaller, and can be streamed.
+	HandleWantRefs = versionCheck(handleWantRefs)
+
+	// HandlePullRefs is meant to handle HTTP POST requests to the pullRefs/ server endpoint.
+	// The body is a form of want=<hash> and have=<hash> values; haves the server doesn't have are ignored.
+	// The response, of type chunkStreamContentType, streams the Chunks reachable from the wants but not from the haves, tallest first.
+	// It ends with the frame written by chunks.SerializeEnd.
+	HandlePullRefs = versionCheck(handlePullRefs)
+
+	// HandleNotify is meant to handle HTTP GET requests to the notify/ server endpoint.
+	// The response is a stream of Server-Sent Events, of type text/event-stream, which stays open until the client goes away.
+	// The first event is "root", whose data is the hash of the Root.
+	// Each change to a dataset's head then sends a "head" event, whose data is the dataset's ID and new head, or just the ID if it was deleted.
+	// Each event's ID is the Root it was seen in.
+	// If the request has ds=<id> values, only those datasets are reported on.
+	HandleNotify = versionCheck(handleNotify)
+
+	// HandleGraphQL is meant to handle HTTP GET and POST requests to the graphql/ server endpoint. It runs a GraphQL query, as package ngql describes, against the value at the head of the dataset named by the request's ds=<id> parameter, and returns the result as JSON. The query, and its variables and operationName, if any, are the query, variables and operationName parameters of a GET, or the fields of the JSON body of a POST whose Content-Type is application/json, as GraphQL clients send them. It doesn't check the Noms version header, since it's meant for browsers and GraphQL clients, which don't send it.
+	HandleGraphQL = handleGraphQL
+
 	// HandleRootGet is meant to handle HTTP GET requests to the root/ server endpoint. The server returns the hash of the Root as a string.
-	// TODO: Nice comment about what headers it expects/honors, payload format, and responses.
+	// The hash is also the response's ETag, so a request whose If-None-Match has it gets 304 Not Modified, and caches are told to check it with the server every time, since the Root changes.
 	HandleRootGet = versionCheck(handleRootGet)
 
 	// HandleWriteValue is meant to handle HTTP POST requests to the root/ server endpoint. This is used to update the Root to point to a new Chunk.
@@ -60,6 +88,23 @@ var (
 
 const writeValueConcurrency = 16
 
+const (
+	// hashStreamContentType is the Content-Type of getRefs/ requests whose bodies are a stream of hash digests.
+	hashStreamContentType = "application/x-noms-hashes"
+	// chunkStreamContentType is the Content-Type of getRefs/ responses that stream Chunks back as they're fetched.
+	chunkStreamContentType = "application/x-noms-chunk-stream"
+	// getRefsStreamBatchSize is how many Chunks at a time handleGetRefs fetches, and flushes to the client, when streaming them.
+	getRefsStreamBatchSize = 1 << 10
+	// maxHashStreamLen is the most hashes readHashStream reads from a request, so that a client can't make the server hold an unbounded number of them. Clients send at most readBufferSize at a time.
+	maxHashStreamLen = 1 << 16
+	// eventStreamContentType is the Content-Type of notify/ responses.
+	eventStreamContentType = "text/event-stream"
+	// notifyInterval is how often handleNotify checks for a new Root.
+	notifyInterval = 100 * time.Millisecond
+	// notifyKeepAlive is how long handleNotify goes without writing anything before it writes a comment, so that connections the client has gone from are noticed, and proxies don't close quiet ones.
+	notifyKeepAlive = 15 * time.Second
+)
+
 func versionCheck(hndlr Handler) Handler {
 	return func(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
 		w.Header().Set(NomsVersionHeader, constants.NomsVersion)
@@ -74,6 +119,10 @@ func versionCheck(hndlr Handler) Handler {
 		}
 
 		err := d.Try(func() { hndlr(w, req, ps, cs) })
+		if _, ok := d.Unwrap(err).(chunks.QuotaExceededError); ok {
+			http.Error(w, fmt.Sprintf("Error: %v", d.Unwrap(err)), http.StatusInsufficientStorage)
+			return
+		}
 		if err != nil {
 			fmt.Printf("Returning bad request:\n%v\n", err)
 			http.Error(w, fmt.Sprintf("Error: %v", d.Unwrap(err)), http.StatusBadRequest)
@@ -96,17 +145,34 @@ func handleWriteValue(w http.ResponseWriter, req *http.Request, ps URLParams, cs
 
 	chunkChan := make(chan interface{}, writeValueConcurrency)
 	go chunks.DeserializeToChan(reader, chunkChan)
+	// Chunks are decoded on goroutines of their own, where a panic would bring the server down, so a chunk that can't be read or decoded is passed on as an error instead.
 	decoded := orderedparallel.New(
 		chunkChan,
 		func(c interface{}) interface{} {
-			return vbs.DecodeUnqueued(c.(*chunks.Chunk))
+			if err, ok := c.(error); ok {
+				return err
+			}
+			var dc types.DecodedChunk
+			if err := d.TryAll(func() { dc = vbs.DecodeUnqueued(c.(*chunks.Chunk)) }); err != nil {
+				return err
+			}
+			return dc
 		},
 		writeValueConcurrency)
 
 	var bpe chunks.BackpressureError
+	var decodeErr error
+	count := 0
 	for dci := range decoded {
+		if err, ok := dci.(error); ok {
+			if decodeErr == nil {
+				decodeErr = err
+			}
+			continue
+		}
 		dc := dci.(types.DecodedChunk)
-		if dc.Chunk != nil && dc.Value != nil {
+		if decodeErr == nil && dc.Chunk != nil && dc.Value != nil {
+			count++
 			if bpe == nil {
 				bpe = vbs.Enqueue(*dc.Chunk, *dc.Value)
 			} else {
@@ -116,10 +182,13 @@ func handleWriteValue(w http.ResponseWriter, req *http.Request, ps URLParams, cs
 			// TODO: what about having DeserializeToChan take a 'done' channel to stop it?
 		}
 	}
+	// The chunks after a bad one, which may refer to it, aren't written, and the request fails.
+	d.PanicIfError(decodeErr)
 	if bpe == nil {
 		bpe = vbs.Flush()
 	}
 	if bpe != nil {
+		logging.Debug("pushing back on write", logging.F("chunks", count), logging.F("pushedBack", len(bpe)))
 		w.WriteHeader(httpStatusTooManyRequests)
 		w.Header().Add("Content-Type", "application/octet-stream")
 		writer := respWriter(req, w)
@@ -127,6 +196,7 @@ func handleWriteValue(w http.ResponseWriter, req *http.Request, ps URLParams, cs
 		serializeHashes(writer, bpe.AsHashes())
 		return
 	}
+	logging.Debug("wrote chunks", logging.F("chunks", count))
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -162,6 +232,8 @@ func bodyReader(req *http.Request) (reader io.ReadCloser) {
 
 func respWriter(req *http.Request, w http.ResponseWriter) (writer io.WriteCloser) {
 	writer = wc{w.(io.Writer)}
+	// The encoding of the response depends on the request's Accept-Encoding, so caches mustn't give it to requests that don't accept it.
+	w.Header().Add("Vary", "Accept-Encoding")
 	if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
 		w.Header().Add("Content-Encoding", "gzip")
 		gw := gzip.NewWriter(w)
@@ -185,20 +257,138 @@ func (wc wc) Close() error {
 func handleGetRefs(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
 	d.PanicIfTrue(req.Method != "POST", "Expected post method.")
 
+	if req.Header.Get("Content-Type") == hashStreamContentType {
+		streamRefs(w, req, cs)
+		return
+	}
+
 	hashes := extractHashes(req)
 
 	w.Header().Add("Content-Type", "application/octet-stream")
 	writer := respWriter(req, w)
 	defer writer.Close()
 
-	for _, h := range hashes {
-		c := cs.Get(h)
+	for _, c := range cs.GetMany(hashes) {
 		if !c.IsEmpty() {
 			chunks.Serialize(c, writer)
 		}
 	}
 }
 
+// streamRefs writes the Chunks for the hashes in the body of |req| to |w| a batch at a time, flushing each batch as it's written, so that neither end has to hold all of them at once, and the client can use the first ones while the rest are fetched. Writes block while the client isn't reading, which keeps the server from getting ahead of it.
+func streamRefs(w http.ResponseWriter, req *http.Request, cs chunks.ChunkStore) {
+	hashes := readHashStream(req.Body)
+
+	w.Header().Add("Content-Type", chunkStreamContentType)
+	writer := respWriter(req, w)
+	defer writer.Close()
+
+	for len(hashes) > 0 {
+		batch := hashes
+		if len(batch) > getRefsStreamBatchSize {
+			batch = batch[:getRefsStreamBatchSize]
+		}
+		hashes = hashes[len(batch):]
+
+		for _, c := range cs.GetMany(batch) {
+			if !c.IsEmpty() {
+				chunks.Serialize(c, writer)
+			}
+		}
+		flushResponse(writer, w)
+	}
+	chunks.SerializeEnd(writer)
+}
+
+// readHashStream reads the hash digests written one after another to |reader| by buildHashStreamRequest. It panics if there are more than maxHashStreamLen of them.
+func readHashStream(reader io.Reader) hash.HashSlice {
+	hashes := hash.HashSlice{}
+	for {
+		d.PanicIfTrue(len(hashes) == maxHashStreamLen, "Request has more than %d hashes", maxHashStreamLen)
+		digest := hash.Digest{}
+		_, err := io.ReadFull(reader, digest[:])
+		if err == io.EOF {
+			break
+		}
+		d.PanicIfError(err)
+		hashes = append(hashes, hash.New(digest))
+	}
+	d.PanicIfTrue(len(hashes) == 0, "Request has no hashes")
+	return hashes
+}
+
+func buildHashStreamRequest(hashes hash.HashSet) io.Reader {
+	buf := bytes.NewBuffer(make([]byte, 0, len(hashes)*hash.ByteLen))
+	for h := range hashes {
+		digest := h.Digest()
+		buf.Write(digest[:])
+	}
+	return buf
+}
+
+// flushResponse sends what's been written to |writer|, which compresses what's written to |w|, on to the client.
+func flushResponse(writer io.Writer, w http.ResponseWriter) {
+	if f, ok := writer.(interface {
+		Flush() error
+	}); ok {
+		d.Chk.NoError(f.Flush())
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// privateResponsesKey is the key of a request's Context which, if set, means the server checks who may read its responses, so shared caches mustn't store them.
+type privateResponsesKey struct{}
+
+// immutableCacheControl returns the Cache-Control of responses to |req| that never change, because they're named by the hash of their contents.
+func immutableCacheControl(req *http.Request) string {
+	if private, _ := req.Context().Value(privateResponsesKey{}).(bool); private {
+		return "private, max-age=31536000, immutable"
+	}
+	return "public, max-age=31536000, immutable"
+}
+
+func handleGetRef(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	d.PanicIfTrue(req.Method != "GET", "Expected get method.")
+
+	h, ok := hash.MaybeParse(ps.ByName("hash"))
+	d.PanicIfFalse(ok, "Invalid hash: %s", ps.ByName("hash"))
+
+	etag := `"` + h.String() + `"`
+	if etagMatches(req, etag) && cs.Has(h) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", immutableCacheControl(req))
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c := cs.Get(h)
+	if c.IsEmpty() {
+		http.Error(w, fmt.Sprintf("Chunk %s not found", h), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", immutableCacheControl(req))
+	w.Header().Add("Content-Type", "application/octet-stream")
+	writer := respWriter(req, w)
+	defer writer.Close()
+	_, err := writer.Write(c.Data())
+	d.Chk.NoError(err)
+}
+
+// etagMatches returns true if the If-None-Match header of |req| lists |etag|, or is "*". Weak ETags match, since the responses they're compared with don't change.
+func etagMatches(req *http.Request, etag string) bool {
+	for _, tag := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 func extractHashes(req *http.Request) hash.HashSlice {
 	err := req.ParseForm()
 	d.PanicIfError(err)
@@ -229,8 +419,124 @@ func handleHasRefs(w http.ResponseWriter, req *http.Request, ps URLParams, cs ch
 	writer := respWriter(req, w)
 	defer writer.Close()
 
+	set := hash.HashSet{}
+	for _, h := range hashes {
+		set.Insert(h)
+	}
+	absent := cs.HasMany(set)
+	for _, h := range hashes {
+		fmt.Fprintf(writer, "%s %t\n", h, !absent.Has(h))
+	}
+}
+
+func handleWantRefs(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	d.PanicIfTrue(req.Method != "POST", "Expected post method.")
+
+	hashes := readHashStream(req.Body)
+
+	w.Header().Add("Content-Type", hashStreamContentType)
+	writer := respWriter(req, w)
+	defer writer.Close()
+
+	set := hash.HashSet{}
 	for _, h := range hashes {
-		fmt.Fprintf(writer, "%s %t\n", h, cs.Has(h))
+		set.Insert(h)
+	}
+	absent := cs.HasMany(set)
+	for _, h := range hashes {
+		if absent.Has(h) {
+			digest := h.Digest()
+			_, err := writer.Write(digest[:])
+			d.Chk.NoError(err)
+			absent.Remove(h)
+		}
+	}
+	_, err := writer.Write(make([]byte, hash.ByteLen))
+	d.Chk.NoError(err)
+}
+
+func handlePullRefs(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	d.PanicIfTrue(req.Method != "POST", "Expected post method.")
+
+	err := req.ParseForm()
+	d.PanicIfError(err)
+	refsOf := func(hashStrs []string, mustHave bool) (refs types.RefSlice) {
+		for _, s := range hashStrs {
+			h, ok := hash.MaybeParse(s)
+			d.PanicIfFalse(ok, "Invalid hash: %s", s)
+			c := cs.Get(h)
+			if c.IsEmpty() {
+				d.PanicIfTrue(mustHave, "Chunk %s not found", h)
+				continue
+			}
+			refs = append(refs, types.NewRef(types.DecodeValue(c, nil)))
+		}
+		return
+	}
+	wants, haves := refsOf(req.PostForm["want"], true), refsOf(req.PostForm["have"], false)
+	d.PanicIfTrue(len(wants) == 0, "Expected want values")
+
+	w.Header().Add("Content-Type", chunkStreamContentType)
+	writer := respWriter(req, w)
+	defer writer.Close()
+
+	count := 0
+	novelChunks(cs, wants, haves, func(c chunks.Chunk) {
+		chunks.Serialize(c, writer)
+		if count++; count%getRefsStreamBatchSize == 0 {
+			flushResponse(writer, w)
+		}
+	})
+	chunks.SerializeEnd(writer)
+}
+
+func handleNotify(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	d.PanicIfTrue(req.Method != "GET", "Expected get method.")
+
+	watched := map[string]bool{}
+	for _, id := range req.URL.Query()["ds"] {
+		watched[id] = true
+	}
+	w.Header().Set("Content-Type", eventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	flush := func() bool {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return req.Context().Err() == nil
+	}
+
+	root := cs.Root()
+	fmt.Fprintf(w, "id: %s\nevent: root\ndata: %s\n\n", root, root)
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for lastWrite := time.Now(); flush(); {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		current := cs.Root()
+		if current == root {
+			if time.Since(lastWrite) >= notifyKeepAlive {
+				fmt.Fprint(w, ": keep-alive\n\n")
+				lastWrite = time.Now()
+			}
+			continue
+		}
+		heads := readRootMap(cs, current)
+		for _, id := range changedDatasets(cs, root, current) {
+			if len(watched) > 0 && !watched[id] {
+				continue
+			}
+			data := id
+			if r, ok := heads.MaybeGet(types.String(id)); ok {
+				data += " " + r.(types.Ref).TargetHash().String()
+			}
+			fmt.Fprintf(w, "id: %s\nevent: head\ndata: %s\n\n", current, data)
+			lastWrite = time.Now()
+		}
+		root = current
 	}
 }
 
@@ -238,8 +544,15 @@ func handleRootGet(w http.ResponseWriter, req *http.Request, ps URLParams, rt ch
 	d.PanicIfTrue(req.Method != "GET", "Expected get method.")
 
 	rootRef := rt.Root()
-	fmt.Fprintf(w, "%v", rootRef.String())
+	etag := `"` + rootRef.String() + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(req, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Add("content-type", "text/plain")
+	fmt.Fprintf(w, "%v", rootRef.String())
 }
 
 func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
@@ -253,6 +566,16 @@ func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs c
 	d.PanicIfTrue(len(tokens) != 1, `Expected "current" query param value`)
 	current := hash.Parse(tokens[0])
 
+	checkNewRoot(cs, current)
+	if !cs.UpdateRoot(current, last) {
+		logging.Debug("root changed, not updated", logging.F("current", current.String()), logging.F("last", last.String()))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+}
+
+// checkNewRoot panics unless |current| can be made the root of |cs|, i.e. it's present in cs and it's a Map<String, Ref<Commit>>, or an empty Map.
+func checkNewRoot(cs chunks.ChunkStore, current hash.Hash) {
 	// Ensure that proposed new Root is present in cs
 	c := cs.Get(current)
 	d.PanicIfTrue(c.IsEmpty(), "Can't set Root to a non-present Chunk")
@@ -264,11 +587,49 @@ func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs c
 	if !m.Empty() && !isMapOfStringToRefOfCommit(m) {
 		panic(d.Wrap(fmt.Errorf("Root of a Database must be a Map<String, Ref<Commit>>, not %s", m.Type().Describe())))
 	}
+}
 
-	if !cs.UpdateRoot(current, last) {
-		w.WriteHeader(http.StatusConflict)
+// graphQLRequest is the body of a POST to the graphql/ endpoint.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func handleGraphQL(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	gr := graphQLRequest{}
+	if req.Method == "POST" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(&gr); err != nil {
+			http.Error(w, fmt.Sprintf("Error: invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		gr.Query, gr.OperationName = req.FormValue("query"), req.FormValue("operationName")
+		if vars := req.FormValue("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &gr.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("Error: invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if gr.Query == "" {
+		http.Error(w, "Error: no query", http.StatusBadRequest)
 		return
 	}
+
+	id := req.URL.Query().Get("ds")
+	r, ok := readRootMap(cs, cs.Root()).MaybeGet(types.String(id))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Error: no dataset %s", id), http.StatusNotFound)
+		return
+	}
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+	head := vs.ReadValue(r.(types.Ref).TargetHash()).(types.Struct)
+
+	res := ngql.Query(req.Context(), head.Get(ValueField), vs, gr.Query, gr.Variables, gr.OperationName)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(res)
 }
 
 func handleBaseGet(w http.ResponseWriter, req *http.Request, ps URLParams, rt chunks.ChunkStore) {
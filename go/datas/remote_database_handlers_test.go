@@ -7,6 +7,7 @@ package datas
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -83,6 +84,37 @@ func TestHandleWriteValueDupChunks(t *testing.T) {
 	}
 }
 
+func TestHandleWriteValueBadChunk(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+
+	good := types.EncodeValue(types.String("good"), nil)
+	for _, bad := range [][]byte{
+		// Chunks that aren't encodings of values, which are decoded on goroutines of their own, fail the request rather than crashing the server.
+		{0xff},
+		{byte(types.ListKind), byte(types.NumberKind), 0, 0x7f, 0xff, 0xff, 0xff},
+	} {
+		body := &bytes.Buffer{}
+		serializeHints(body, map[hash.Hash]struct{}{})
+		chunks.Serialize(good, body)
+		chunks.Serialize(chunks.NewChunk(bad), body)
+
+		w := httptest.NewRecorder()
+		HandleWriteValue(w, newRequest("POST", "", "", body, nil), params{}, cs)
+		assert.Equal(http.StatusBadRequest, w.Code)
+	}
+
+	// So does a chunk whose data doesn't match its hash.
+	body := &bytes.Buffer{}
+	serializeHints(body, map[hash.Hash]struct{}{})
+	chunks.Serialize(good, body)
+	data := body.Bytes()
+	data[len(data)-1] ^= 0xff
+	w := httptest.NewRecorder()
+	HandleWriteValue(w, newRequest("POST", "", "", bytes.NewReader(data), nil), params{}, cs)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
+
 func TestHandleWriteValueBackpressure(t *testing.T) {
 	assert := assert.New(t)
 	cs := &backpressureCS{ChunkStore: chunks.NewMemoryStore()}
@@ -218,6 +250,63 @@ func TestHandleGetRefs(t *testing.T) {
 	}
 }
 
+func TestHandleGetRefsStream(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	chnx := make([]chunks.Chunk, 2*getRefsStreamBatchSize+1)
+	hashes := hash.HashSet{}
+	for i := range chnx {
+		chnx[i] = chunks.NewChunk([]byte(fmt.Sprintf("chunk %d", i)))
+		hashes.Insert(chnx[i].Hash())
+	}
+	assert.NoError(cs.PutMany(chnx))
+	hashes.Insert(chunks.NewChunk([]byte("missing")).Hash())
+
+	w := httptest.NewRecorder()
+	HandleGetRefs(
+		w,
+		newRequest("POST", "", "", buildHashStreamRequest(hashes), http.Header{
+			"Content-Type": {hashStreamContentType},
+		}),
+		params{},
+		cs,
+	)
+
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		assert.Equal(chunkStreamContentType, w.Header().Get("Content-Type"))
+		body := w.Body.Bytes()
+		got := chunks.NewTestStore()
+		assert.NoError(chunks.DeserializeStream(bytes.NewReader(body), got))
+		for _, c := range chnx {
+			assert.True(got.Has(c.Hash()))
+		}
+		assert.Equal(len(chnx), got.Writes)
+
+		// A response that's cut off, even between chunks, is an error.
+		assert.Equal(io.ErrUnexpectedEOF, chunks.DeserializeStream(bytes.NewReader(body[:len(body)-1]), chunks.NewTestStore()))
+		assert.Equal(io.ErrUnexpectedEOF, chunks.DeserializeStream(bytes.NewReader(body[:len(body)-hash.ByteLen-4]), chunks.NewTestStore()))
+	}
+}
+
+func TestHandleGetRefsStreamTooLong(t *testing.T) {
+	assert := assert.New(t)
+	hashes := hash.HashSet{}
+	for i := 0; i <= maxHashStreamLen; i++ {
+		hashes.Insert(hash.FromData([]byte(fmt.Sprintf("chunk %d", i))))
+	}
+
+	w := httptest.NewRecorder()
+	HandleGetRefs(
+		w,
+		newRequest("POST", "", "", buildHashStreamRequest(hashes), http.Header{
+			"Content-Type": {hashStreamContentType},
+		}),
+		params{},
+		chunks.NewTestStore(),
+	)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
+
 func TestHandleHasRefs(t *testing.T) {
 	assert := assert.New(t)
 	cs := chunks.NewTestStore()
@@ -259,6 +348,79 @@ func TestHandleHasRefs(t *testing.T) {
 	}
 }
 
+func TestHandleWantRefs(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	present := chunks.NewChunk([]byte("abc"))
+	cs.Put(present)
+	absent1, absent2 := chunks.NewChunk([]byte("def")).Hash(), chunks.NewChunk([]byte("ghi")).Hash()
+
+	w := httptest.NewRecorder()
+	HandleWantRefs(
+		w,
+		newRequest("POST", "", "", buildHashStreamRequest(hash.HashSet{present.Hash(): struct{}{}, absent1: struct{}{}, absent2: struct{}{}}), http.Header{
+			"Content-Type": {hashStreamContentType},
+		}),
+		params{},
+		cs,
+	)
+
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		wanted := readHashStream(w.Body)
+		if assert.Len(wanted, 3) {
+			assert.Equal(hash.Hash{}, wanted[2], "should end with an all-zero digest")
+			assert.Equal(hash.HashSet{absent1: struct{}{}, absent2: struct{}{}}, hash.HashSet{wanted[0]: struct{}{}, wanted[1]: struct{}{}})
+		}
+	}
+}
+
+func TestHandlePullRefs(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	defer db.Close()
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("have"))
+	assert.NoError(err)
+	have := ds.HeadRef().TargetHash()
+	ds, err = db.CommitValue(ds, types.String("want"))
+	assert.NoError(err)
+	want := ds.HeadRef().TargetHash()
+	unknown := chunks.NewChunk([]byte("unknown")).Hash()
+
+	pullRefs := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandlePullRefs(
+			w,
+			newRequest("POST", "", "", strings.NewReader(body), http.Header{
+				"Content-Type": {"application/x-www-form-urlencoded"},
+			}),
+			params{},
+			cs,
+		)
+		return w
+	}
+
+	// Only the new commit is sent, since its parent is had. Haves the server doesn't have are ignored.
+	w := pullRefs(fmt.Sprintf("want=%s&have=%s&have=%s", want, have, unknown))
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		assert.Equal(chunkStreamContentType, w.Header().Get("Content-Type"))
+		got := chunks.NewTestStore()
+		assert.NoError(chunks.DeserializeStream(w.Body, got))
+		assert.Equal(1, got.Writes)
+		assert.True(got.Has(want))
+	}
+
+	w = pullRefs(fmt.Sprintf("want=%s", want))
+	if assert.Equal(http.StatusOK, w.Code) {
+		got := chunks.NewTestStore()
+		assert.NoError(chunks.DeserializeStream(w.Body, got))
+		assert.Equal(2, got.Writes)
+	}
+
+	assert.Equal(http.StatusBadRequest, pullRefs(fmt.Sprintf("want=%s", unknown)).Code)
+	assert.Equal(http.StatusBadRequest, pullRefs(fmt.Sprintf("have=%s", have)).Code)
+}
+
 func TestHandleGetRoot(t *testing.T) {
 	assert := assert.New(t)
 	cs := chunks.NewTestStore()
@@ -272,9 +434,67 @@ func TestHandleGetRoot(t *testing.T) {
 	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
 		root := hash.Parse(string(w.Body.Bytes()))
 		assert.Equal(c.Hash(), root)
+		assert.Equal(`"`+c.Hash().String()+`"`, w.Header().Get("ETag"))
+		assert.Equal("no-cache", w.Header().Get("Cache-Control"))
+	}
+
+	w = httptest.NewRecorder()
+	HandleRootGet(w, newRequest("GET", "", "", nil, http.Header{"If-None-Match": {`"` + c.Hash().String() + `"`}}), params{}, cs)
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Empty(w.Body.Bytes())
+
+	// Once the root moves, the old ETag no longer matches.
+	c2 := chunks.NewChunk([]byte("def"))
+	cs.Put(c2)
+	assert.True(cs.UpdateRoot(c2.Hash(), c.Hash()))
+	w = httptest.NewRecorder()
+	HandleRootGet(w, newRequest("GET", "", "", nil, http.Header{"If-None-Match": {`"` + c.Hash().String() + `"`}}), params{}, cs)
+	if assert.Equal(http.StatusOK, w.Code) {
+		assert.Equal(c2.Hash().String(), string(w.Body.Bytes()))
 	}
 }
 
+func TestHandleGetRef(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	c := chunks.NewChunk([]byte("abc"))
+	cs.Put(c)
+	etag := `"` + c.Hash().String() + `"`
+
+	w := httptest.NewRecorder()
+	HandleGetRef(w, newRequest("GET", "", "", nil, nil), params{"hash": c.Hash().String()}, cs)
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		assert.Equal(c.Data(), w.Body.Bytes())
+		assert.Equal(etag, w.Header().Get("ETag"))
+		assert.Equal("public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+		assert.Equal("Accept-Encoding", w.Header().Get("Vary"))
+	}
+
+	// Shared caches mustn't store the chunks of a server that checks who reads them.
+	w = httptest.NewRecorder()
+	req := newRequest("GET", "", "", nil, nil)
+	HandleGetRef(w, req.WithContext(context.WithValue(req.Context(), privateResponsesKey{}, true)), params{"hash": c.Hash().String()}, cs)
+	assert.Equal("private, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = httptest.NewRecorder()
+		HandleGetRef(w, newRequest("GET", "", "", nil, http.Header{"If-None-Match": {inm}}), params{"hash": c.Hash().String()}, cs)
+		assert.Equal(http.StatusNotModified, w.Code, inm)
+		assert.Equal("Accept-Encoding", w.Header().Get("Vary"))
+		assert.Empty(w.Body.Bytes())
+	}
+
+	missing := chunks.NewChunk([]byte("def")).Hash()
+	w = httptest.NewRecorder()
+	HandleGetRef(w, newRequest("GET", "", "", nil, http.Header{"If-None-Match": {"*"}}), params{"hash": missing.String()}, cs)
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.Empty(w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	HandleGetRef(w, newRequest("GET", "", "", nil, nil), params{"hash": "nope"}, cs)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
+
 func TestHandleGetBase(t *testing.T) {
 	assert := assert.New(t)
 	cs := chunks.NewTestStore()
@@ -349,3 +569,72 @@ type params map[string]string
 func (p params) ByName(k string) string {
 	return p[k]
 }
+
+func TestHandleNotify(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		HandleNotify(w, req, params{}, cs)
+	}))
+	defer server.Close()
+
+	res, err := http.DefaultClient.Do(newRequest("GET", "", server.URL+"?ds=ds", nil, nil))
+	assert.NoError(err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(eventStreamContentType, res.Header.Get("Content-Type"))
+	reader := bufio.NewReader(res.Body)
+	readEvent := func() []string {
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(err)
+			if line == "\n" {
+				return lines
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	root := cs.Root().String()
+	assert.Equal([]string{"id: " + root, "event: root", "data: " + root}, readEvent())
+
+	// Only the watched dataset is reported on.
+	db := NewDatabase(cs)
+	_, err = db.CommitValue(db.GetDataset("other"), types.String("ignored"))
+	assert.NoError(err)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	event := readEvent()
+	assert.Equal([]string{"event: head", "data: ds " + ds.HeadRef().TargetHash().String()}, event[1:])
+
+	_, err = db.Delete(ds)
+	assert.NoError(err)
+	assert.Equal([]string{"id: " + cs.Root().String(), "event: head", "data: ds"}, readEvent())
+}
+
+func TestHandleGraphQL(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	db := NewDatabase(cs)
+	_, err := db.CommitValue(db.GetDataset("ds"), types.NewStruct("Person", types.StructData{"name": types.String("Alice")}))
+	assert.NoError(err)
+
+	query := func(req *http.Request) (int, string) {
+		w := httptest.NewRecorder()
+		HandleGraphQL(w, req, params{}, cs)
+		return w.Code, w.Body.String()
+	}
+
+	code, body := query(newRequest("GET", "", "/graphql/?ds=ds&query="+url.QueryEscape("{value {name}}"), nil, nil))
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(`{"data":{"value":{"name":"Alice"}}}`+"\n", body)
+
+	code, body = query(newRequest("POST", "", "/graphql/?ds=ds", strings.NewReader(`{"query": "query q($show: Boolean!) {value {name @include(if: $show)}}", "variables": {"show": true}}`), http.Header{"Content-Type": {"application/json"}}))
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(`{"data":{"value":{"name":"Alice"}}}`+"\n", body)
+
+	code, _ = query(newRequest("GET", "", "/graphql/?ds=nope&query="+url.QueryEscape("{value}"), nil, nil))
+	assert.Equal(http.StatusNotFound, code)
+	code, _ = query(newRequest("GET", "", "/graphql/?ds=ds", nil, nil))
+	assert.Equal(http.StatusBadRequest, code)
+}
@@ -0,0 +1,294 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/util/tracing"
+)
+
+// RequestLog describes a request served by a RemoteDatabaseServer. A server with a Log writes one for each request, as a line of JSON, once it's done.
+type RequestLog struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"`
+	// Database is the name of the database the request was for, on a server hosting many.
+	Database string `json:"database,omitempty"`
+	Status   int    `json:"status"`
+	// ChunksRead and BytesRead count the chunks the request found in the ChunkStore, and their bytes. ChunksWritten and BytesWritten count those it put there.
+	ChunksRead    int64 `json:"chunks_read"`
+	BytesRead     int64 `json:"bytes_read"`
+	ChunksWritten int64 `json:"chunks_written"`
+	BytesWritten  int64 `json:"bytes_written"`
+	// RequestBytes and ResponseBytes count the bytes of the request and response bodies, as sent, so compressed if they were.
+	RequestBytes  int64   `json:"request_bytes"`
+	ResponseBytes int64   `json:"response_bytes"`
+	DurationMs    float64 `json:"duration_ms"`
+}
+
+// requestStats is a chunks.Metrics which counts the work done for a single request.
+type requestStats struct {
+	chunksRead, bytesRead, chunksWritten, bytesWritten int64
+}
+
+func (rs *requestStats) Get(hit bool, bytes int, elapsed time.Duration) {
+	if hit {
+		atomic.AddInt64(&rs.chunksRead, 1)
+		atomic.AddInt64(&rs.bytesRead, int64(bytes))
+	}
+}
+
+func (rs *requestStats) Has(hit bool, elapsed time.Duration) {
+}
+
+func (rs *requestStats) Put(chunks, bytes int, elapsed time.Duration) {
+	atomic.AddInt64(&rs.chunksWritten, int64(chunks))
+	atomic.AddInt64(&rs.bytesWritten, int64(bytes))
+}
+
+type requestStatsKey struct{}
+
+// meterStore returns |cs| wrapped so that the work done with it is counted in the requestStats of |ctx|, if it has any.
+func meterStore(ctx context.Context, cs chunks.ChunkStore) chunks.ChunkStore {
+	if rs, ok := ctx.Value(requestStatsKey{}).(*requestStats); ok {
+		return chunks.NewMeteredStore(cs, rs)
+	}
+	return cs
+}
+
+// countingResponseWriter records the status and the number of bytes of a response.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *countingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the countingResponseWriter.
+func (w *countingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// endpoints are the paths of the server endpoints, as they're reported in logs and metrics.
+var endpoints = []string{constants.RootPath, constants.GetRefsPath, constants.GetRefPath, constants.HasRefsPath, constants.WantRefsPath, constants.PullRefsPath, constants.NotifyPath, constants.WriteValuePath}
+
+// endpointOf returns the endpoint that |path| is a request for, and on a server hosting many databases, the database it's for. The endpoint is "other" if path isn't for one.
+func endpointOf(path string, multi bool) (endpoint, database string) {
+	if multi {
+		path = strings.TrimPrefix(path, "/")
+		if i := strings.Index(path, "/"); i >= 0 {
+			database, path = path[:i], path[i:]
+		} else {
+			database, path = path, "/"
+		}
+	}
+	if path == constants.BasePath {
+		return constants.BasePath, database
+	}
+	for _, ep := range endpoints {
+		if path == ep || (ep == constants.GetRefPath && strings.HasPrefix(path, ep)) {
+			return ep, database
+		}
+	}
+	return "other", database
+}
+
+// ServerMetrics keeps totals of the requests served by a RemoteDatabaseServer, by method, endpoint and status, and serves them over HTTP in the Prometheus text format.
+type ServerMetrics struct {
+	mu       *sync.Mutex
+	inFlight int64
+	totals   map[metricsKey]*metricsTotals
+}
+
+type metricsKey struct {
+	method, endpoint string
+	status           int
+}
+
+type metricsTotals struct {
+	requests                                           int64
+	seconds                                            float64
+	chunksRead, bytesRead, chunksWritten, bytesWritten int64
+	requestBytes, responseBytes                        int64
+}
+
+func NewServerMetrics() *ServerMetrics {
+	return &ServerMetrics{&sync.Mutex{}, 0, map[metricsKey]*metricsTotals{}}
+}
+
+func (sm *ServerMetrics) record(rl RequestLog) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	key := metricsKey{rl.Method, rl.Endpoint, rl.Status}
+	t, ok := sm.totals[key]
+	if !ok {
+		t = &metricsTotals{}
+		sm.totals[key] = t
+	}
+	t.requests++
+	t.seconds += rl.DurationMs / 1000
+	t.chunksRead += rl.ChunksRead
+	t.bytesRead += rl.BytesRead
+	t.chunksWritten += rl.ChunksWritten
+	t.bytesWritten += rl.BytesWritten
+	t.requestBytes += rl.RequestBytes
+	t.responseBytes += rl.ResponseBytes
+}
+
+// ServeHTTP writes the totals in the Prometheus text format, e.g. noms_requests_total{method="POST",endpoint="/getRefs/",status="200"} 12.
+func (sm *ServerMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	keys := make([]metricsKey, 0, len(sm.totals))
+	for k := range sm.totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics := []struct {
+		name, kind, help string
+		value            func(t *metricsTotals) interface{}
+	}{
+		{"noms_requests_total", "counter", "Requests served.", func(t *metricsTotals) interface{} { return t.requests }},
+		{"noms_request_duration_seconds_total", "counter", "Time spent serving requests.", func(t *metricsTotals) interface{} { return t.seconds }},
+		{"noms_chunks_read_total", "counter", "Chunks read from the store.", func(t *metricsTotals) interface{} { return t.chunksRead }},
+		{"noms_chunk_bytes_read_total", "counter", "Bytes of chunks read from the store.", func(t *metricsTotals) interface{} { return t.bytesRead }},
+		{"noms_chunks_written_total", "counter", "Chunks written to the store.", func(t *metricsTotals) interface{} { return t.chunksWritten }},
+		{"noms_chunk_bytes_written_total", "counter", "Bytes of chunks written to the store.", func(t *metricsTotals) interface{} { return t.bytesWritten }},
+		{"noms_request_bytes_total", "counter", "Bytes of request bodies received.", func(t *metricsTotals) interface{} { return t.requestBytes }},
+		{"noms_response_bytes_total", "counter", "Bytes of response bodies sent.", func(t *metricsTotals) interface{} { return t.responseBytes }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s{method=%q,endpoint=%q,status=\"%d\"} %v\n", m.name, k.method, k.endpoint, k.status, m.value(sm.totals[k]))
+		}
+	}
+	fmt.Fprintf(w, "# HELP noms_requests_in_flight Requests being served.\n# TYPE noms_requests_in_flight gauge\nnoms_requests_in_flight %d\n", atomic.LoadInt64(&sm.inFlight))
+}
+
+// observe wraps |f| so that each request it serves is written to |log|, if it isn't nil, recorded in |metrics|, if it isn't nil, and traced, if there's a tracing.Tracer, as a child of the client's span, if the request carries one.
+func observe(f http.Handler, log io.Writer, logMu *sync.Mutex, metrics *ServerMetrics, multi bool) http.Handler {
+	traced := tracing.Enabled()
+	if log == nil && metrics == nil && !traced {
+		return f
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		endpoint, database := endpointOf(req.URL.Path, multi)
+		ctx := req.Context()
+		var span tracing.Span
+		if traced {
+			ctx, span = tracing.Start(tracing.Extract(ctx, req.Header), "noms.serve "+endpoint)
+		}
+		if metrics != nil {
+			atomic.AddInt64(&metrics.inFlight, 1)
+			defer atomic.AddInt64(&metrics.inFlight, -1)
+		}
+		rs := &requestStats{}
+		cw := &countingResponseWriter{ResponseWriter: w}
+		var body *countingReader
+		if req.Body != nil {
+			body = &countingReader{ReadCloser: req.Body}
+			req.Body = body
+		}
+		f.ServeHTTP(cw, req.WithContext(context.WithValue(ctx, requestStatsKey{}, rs)))
+
+		rl := RequestLog{
+			Time:          start.UTC(),
+			Method:        req.Method,
+			Status:        cw.status,
+			ChunksRead:    atomic.LoadInt64(&rs.chunksRead),
+			BytesRead:     atomic.LoadInt64(&rs.bytesRead),
+			ChunksWritten: atomic.LoadInt64(&rs.chunksWritten),
+			BytesWritten:  atomic.LoadInt64(&rs.bytesWritten),
+			ResponseBytes: cw.bytes,
+			DurationMs:    float64(time.Since(start)) / float64(time.Millisecond),
+		}
+		if rl.Status == 0 {
+			rl.Status = http.StatusOK
+		}
+		if body != nil {
+			rl.RequestBytes = body.bytes
+		}
+		rl.Endpoint, rl.Database = endpoint, database
+		if span != nil {
+			span.SetTag("method", rl.Method)
+			span.SetTag("status", rl.Status)
+			if rl.Database != "" {
+				span.SetTag("database", rl.Database)
+			}
+			span.SetTag("chunks_read", rl.ChunksRead)
+			span.SetTag("bytes_read", rl.BytesRead)
+			span.SetTag("chunks_written", rl.ChunksWritten)
+			span.SetTag("bytes_written", rl.BytesWritten)
+			span.SetTag("request_bytes", rl.RequestBytes)
+			span.SetTag("response_bytes", rl.ResponseBytes)
+			span.Finish()
+		}
+		if metrics != nil {
+			metrics.record(rl)
+		}
+		if log != nil {
+			data, err := json.Marshal(rl)
+			if err == nil {
+				logMu.Lock()
+				log.Write(append(data, '\n'))
+				logMu.Unlock()
+			}
+		}
+	})
+}
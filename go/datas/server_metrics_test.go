@@ -0,0 +1,87 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// logLines passes on each line written to it.
+type logLines chan []byte
+
+func (l logLines) Write(p []byte) (int, error) {
+	l <- append([]byte{}, p...)
+	return len(p), nil
+}
+
+func TestEndpointOf(t *testing.T) {
+	assert := assert.New(t)
+	for _, c := range []struct{ path, endpoint, database string }{
+		{"/root/", constants.RootPath, ""},
+		{"/getRef/sha1-0123", constants.GetRefPath, ""},
+		{"/", constants.BasePath, ""},
+		{"/favicon.ico", "other", ""},
+	} {
+		endpoint, database := endpointOf(c.path, false)
+		assert.Equal(c.endpoint, endpoint, c.path)
+		assert.Equal(c.database, database, c.path)
+	}
+	endpoint, database := endpointOf("/team1/writeValue/", true)
+	assert.Equal(constants.WriteValuePath, endpoint)
+	assert.Equal("team1", database)
+}
+
+func TestServerLogAndMetrics(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	log := make(logLines, 64)
+	server.Log = log
+	server.Metrics = NewServerMetrics()
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	db := NewRemoteDatabase(url, "")
+	_, err := db.CommitValue(db.GetDataset("ds"), types.String("logged"))
+	assert.NoError(err)
+	db.Close()
+
+	// The requests are logged once they're done, so the commit may return first.
+	logs := map[string]RequestLog{}
+	for logs["POST "+constants.RootPath].Status == 0 {
+		select {
+		case line := <-log:
+			rl := RequestLog{}
+			assert.NoError(json.Unmarshal(line, &rl))
+			logs[rl.Method+" "+rl.Endpoint] = rl
+		case <-time.After(5 * time.Second):
+			assert.FailNow("Timed out waiting for the root to be updated")
+		}
+	}
+	written := logs["POST "+constants.WriteValuePath]
+	assert.Equal(http.StatusCreated, written.Status)
+	assert.Equal(int64(2), written.ChunksWritten)
+	assert.True(written.BytesWritten > 0)
+	assert.True(written.RequestBytes > 0)
+	assert.Equal(http.StatusOK, logs["POST "+constants.RootPath].Status)
+
+	w := httptest.NewRecorder()
+	server.Metrics.ServeHTTP(w, nil)
+	assert.Contains(w.Body.String(), `noms_requests_total{method="POST",endpoint="/writeValue/",status="201"} 1`)
+	assert.Contains(w.Body.String(), `noms_chunks_written_total{method="POST",endpoint="/writeValue/",status="201"} 2`)
+	assert.Contains(w.Body.String(), "noms_requests_in_flight 0")
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Spill is a Database in a temporary directory on local disk, in which to build values that are bigger than memory, e.g. by imports, before committing them to another Database. Collections built in a Spill, by passing it to types.NewStreamingList, NewStreamingMap or NewGraphBuilder, or edited once they're read back from it, have their chunks written out to disk as they're made, rather than kept in memory, so a Spill bounds the memory it takes to build a value whatever the Database it's destined for, including one whose server is remote, and so that abandoning a build leaves nothing behind in the destination. Values in a Spill can only refer to values in the same Spill. CommitTo streams the chunks of a value into its destination and commits it there. A Spill should be closed once it's done with, which deletes its directory.
+type Spill struct {
+	Database
+	dir string
+}
+
+// NewSpill returns a Spill in a new temporary directory.
+func NewSpill() (*Spill, error) {
+	dir, err := ioutil.TempDir("", "noms-spill")
+	if err != nil {
+		return nil, err
+	}
+	return &Spill{NewDatabase(chunks.NewLevelDBStore(dir, "", 24, false)), dir}, nil
+}
+
+// CommitTo copies |v|, which was built in s, and the chunks it refers to into |db|, skipping those db already has, and then commits it to |ds| in db with |opts|, as db.Commit does.
+func (s *Spill) CommitTo(db Database, ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
+	r := s.WriteValue(v)
+	s.Flush()
+	headRef, _ := ds.MaybeHeadRef()
+	Pull(s, db, r, headRef, 4, nil)
+	// db only writes values whose chunks it's read or written itself, so it has to read the pulled value back.
+	db.validatingBatchStore().Flush()
+	return db.Commit(ds, db.ReadValue(r.TargetHash()), opts)
+}
+
+// Close closes s and deletes its directory.
+func (s *Spill) Close() error {
+	err := s.Database.Close()
+	if rerr := os.RemoveAll(s.dir); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"os"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestSpill(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	defer db.Close()
+
+	spill, err := NewSpill()
+	assert.NoError(err)
+	values := make(chan types.Value)
+	listChan := types.NewStreamingList(spill, values)
+	for i := 0; i < 50000; i++ {
+		values <- types.Number(i)
+	}
+	close(values)
+	list := <-listChan
+	// The chunks of the list were written to the Spill as it was built, not to db.
+	assert.True(list.Len() > 0 && cs.Writes == 0)
+
+	ds, err := spill.CommitTo(db, db.GetDataset("ds"), list, CommitOptions{})
+	assert.NoError(err)
+	assert.True(list.Equals(ds.HeadValue()))
+	assert.Equal(types.Number(49999), ds.HeadValue().(types.List).Get(49999))
+	writes := cs.Writes
+
+	// Committing an edit of the list only copies the chunks that changed.
+	list = spill.ReadValue(spill.WriteValue(list).TargetHash()).(types.List).Set(25000, types.String("x"))
+	ds, err = spill.CommitTo(db, ds, list, CommitOptions{})
+	assert.NoError(err)
+	assert.True(list.Equals(ds.HeadValue()))
+	assert.Equal(uint64(1), ds.Head().Get(ParentsField).(types.Set).Len())
+	assert.True(cs.Writes-writes < 10)
+
+	assert.NoError(spill.Close())
+	_, err = os.Stat(spill.dir)
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+)
+
+// StoreOpener opens the ChunkStore of the database named |name|, for a RemoteDatabaseServer which hosts many. It returns an error if there's no such database.
+type StoreOpener func(name string) (chunks.ChunkStore, error)
+
+// storePool keeps the ChunkStores of the databases a RemoteDatabaseServer hosts, opening each when a request first needs it, and closing it again once no request has needed it for idleTimeout.
+type storePool struct {
+	open        StoreOpener
+	idleTimeout time.Duration
+	mu          *sync.Mutex
+	stores      map[string]*pooledStore
+}
+
+type pooledStore struct {
+	cs    chunks.ChunkStore
+	err   error
+	users int
+	// opened is closed once cs has been opened, or err says why it couldn't be.
+	opened   chan struct{}
+	lastUsed time.Time
+}
+
+func newStorePool(open StoreOpener, idleTimeout time.Duration) *storePool {
+	return &storePool{open, idleTimeout, &sync.Mutex{}, map[string]*pooledStore{}}
+}
+
+// acquire returns the ChunkStore of the database |name|, opening it if it isn't open. It isn't closed until release() has been called as many times as acquire(). The store is opened without holding the pool's lock, so that a slow open doesn't hold up requests for other databases; requests for the same one wait for it.
+func (p *storePool) acquire(name string) (chunks.ChunkStore, error) {
+	p.mu.Lock()
+	ps, ok := p.stores[name]
+	if !ok {
+		ps = &pooledStore{opened: make(chan struct{})}
+		p.stores[name] = ps
+	}
+	ps.users++
+	p.mu.Unlock()
+
+	if !ok {
+		cs, err := p.openStore(name)
+		p.mu.Lock()
+		ps.cs, ps.err = cs, err
+		if err != nil {
+			delete(p.stores, name)
+		}
+		p.mu.Unlock()
+		close(ps.opened)
+	}
+	<-ps.opened
+	if ps.err != nil {
+		return nil, ps.err
+	}
+	return ps.cs, nil
+}
+
+// openStore opens the ChunkStore of the database |name|, checking that its data is of the SDK's version.
+func (p *storePool) openStore(name string) (chunks.ChunkStore, error) {
+	cs, err := p.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if dataVersion := cs.Version(); dataVersion != constants.NomsVersion {
+		cs.Close()
+		return nil, fmt.Errorf("SDK version %s is incompatible with data of version %s", constants.NomsVersion, dataVersion)
+	}
+	return cs, nil
+}
+
+func (p *storePool) release(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps := p.stores[name]
+	ps.users--
+	ps.lastUsed = time.Now()
+}
+
+// closeIdle closes the ChunkStores that no request is using, and none has for idleTimeout.
+func (p *storePool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, ps := range p.stores {
+		if ps.users == 0 && time.Since(ps.lastUsed) >= p.idleTimeout {
+			ps.cs.Close()
+			delete(p.stores, name)
+		}
+	}
+}
+
+// closeIdleEvery calls closeIdle() every |interval| until |done| is closed.
+func (p *storePool) closeIdleEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.closeIdle()
+		case <-done:
+			return
+		}
+	}
+}
+
+// openNames returns the names of the databases whose ChunkStores are open.
+func (p *storePool) openNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := []string{}
+	for name, ps := range p.stores {
+		if ps.cs != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (p *storePool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, ps := range p.stores {
+		if ps.cs != nil {
+			ps.cs.Close()
+			delete(p.stores, name)
+		}
+	}
+}
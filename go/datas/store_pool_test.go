@@ -0,0 +1,114 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// unclosableStore doesn't close the store it wraps, so that it can be opened again.
+type unclosableStore struct {
+	chunks.ChunkStore
+}
+
+func (s unclosableStore) Close() error {
+	return nil
+}
+
+func TestMultiDatabaseServer(t *testing.T) {
+	assert := assert.New(t)
+	stores := map[string]chunks.ChunkStore{"team1": chunks.NewMemoryStore(), "team2": chunks.NewMemoryStore()}
+	opens := int32(0)
+	server := NewMultiDatabaseServer(func(name string) (chunks.ChunkStore, error) {
+		cs, ok := stores[name]
+		if !ok {
+			return nil, fmt.Errorf("No database %s", name)
+		}
+		atomic.AddInt32(&opens, 1)
+		return unclosableStore{cs}, nil
+	}, 50*time.Millisecond, 0)
+	ac, err := loadTestAccessControl(assert, "[anonymous]\nwrite = [\"*\"]\n\n[database.team2.token.bob]\ntoken = \"bob-secret\"\nwrite = [\"*\"]\n")
+	assert.NoError(err)
+	server.Access = ac
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	db1 := NewRemoteDatabase(url+"/team1", "")
+	_, err = db1.CommitValue(db1.GetDataset("ds"), types.String("one"))
+	assert.NoError(err)
+	db1.Close()
+	db2 := NewRemoteDatabase(url+"/team2", "Bearer bob-secret")
+	_, err = db2.CommitValue(db2.GetDataset("ds"), types.String("two"))
+	assert.NoError(err)
+	db2.Close()
+	assert.Equal(types.String("one"), NewDatabase(stores["team1"]).GetDataset("ds").HeadValue())
+	assert.Equal(types.String("two"), NewDatabase(stores["team2"]).GetDataset("ds").HeadValue())
+
+	status := func(path, auth string) int {
+		res, err := http.DefaultClient.Do(newRequest("GET", auth, url+path, nil, nil))
+		assert.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(http.StatusNotFound, status("/team3"+constants.RootPath, ""))
+	// team2 has its own access control, which doesn't let anonymous requests in.
+	assert.Equal(http.StatusOK, status("/team1"+constants.RootPath, ""))
+	assert.Equal(http.StatusForbidden, status("/team2"+constants.RootPath, ""))
+
+	// Once they've been idle, the stores are closed, and opened again when they're next needed.
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(server.stores.openNames())
+	before := atomic.LoadInt32(&opens)
+	assert.Equal(http.StatusOK, status("/team1"+constants.RootPath, ""))
+	assert.Equal(before+1, atomic.LoadInt32(&opens))
+}
+
+func TestStorePoolOpensConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	slow := make(chan struct{})
+	opens := int32(0)
+	pool := newStorePool(func(name string) (chunks.ChunkStore, error) {
+		if name == "slow" {
+			atomic.AddInt32(&opens, 1)
+			<-slow
+		}
+		return chunks.NewMemoryStore(), nil
+	}, time.Hour)
+	defer pool.closeAll()
+
+	// While one database is being opened, others can be, and requests for it wait for the same store.
+	stores := make(chan chunks.ChunkStore)
+	for i := 0; i < 2; i++ {
+		go func() {
+			cs, err := pool.acquire("slow")
+			assert.NoError(err)
+			stores <- cs
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err := pool.acquire("fast")
+	assert.NoError(err)
+	assert.Equal([]string{"fast"}, pool.openNames())
+
+	close(slow)
+	cs1, cs2 := <-stores, <-stores
+	assert.True(cs1 == cs2)
+	assert.Equal(int32(1), atomic.LoadInt32(&opens))
+	pool.release("fast")
+	pool.release("slow")
+	pool.release("slow")
+}
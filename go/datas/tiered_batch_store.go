@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sync"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+const tieredBatchStoreFillQueueSize = 1024
+
+// tieredBatchStore caches the chunks of a remote database in a local ChunkStore. It works like chunks.TieredStore, but on top of an httpBatchStore: Gets are served locally when possible, and chunks fetched from the server are copied into the local store in the background. Scheduled Puts are written to the local store immediately, and sent to the server as usual.
+// Has() always asks the server: a chunk in the local store may be one whose write to the server never completed.
+type tieredBatchStore struct {
+	*httpBatchStore
+	local  chunks.ChunkStore
+	fillCh chan chunks.Chunk
+	wg     *sync.WaitGroup
+}
+
+func newTieredBatchStore(remote *httpBatchStore, local chunks.ChunkStore) *tieredBatchStore {
+	tbs := &tieredBatchStore{remote, local, make(chan chunks.Chunk, tieredBatchStoreFillQueueSize), &sync.WaitGroup{}}
+	tbs.wg.Add(1)
+	go func() {
+		defer tbs.wg.Done()
+		for c := range tbs.fillCh {
+			tbs.local.Put(c)
+		}
+	}()
+	return tbs
+}
+
+func (tbs *tieredBatchStore) Get(h hash.Hash) chunks.Chunk {
+	if c := tbs.local.Get(h); !c.IsEmpty() {
+		return c
+	}
+	c := tbs.httpBatchStore.Get(h)
+	if !c.IsEmpty() {
+		select {
+		case tbs.fillCh <- c:
+		default:
+		}
+	}
+	return c
+}
+
+func (tbs *tieredBatchStore) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	found := tbs.local.GetMany(hashes)
+	misses := hash.HashSlice{}
+	for i, c := range found {
+		if c.IsEmpty() {
+			misses = append(misses, hashes[i])
+		}
+	}
+	if len(misses) == 0 {
+		return found
+	}
+
+	fetched := tbs.httpBatchStore.GetMany(misses)
+	for i, j := 0, 0; i < len(found); i++ {
+		if !found[i].IsEmpty() {
+			continue
+		}
+		found[i] = fetched[j]
+		j++
+		if !found[i].IsEmpty() {
+			select {
+			case tbs.fillCh <- found[i]:
+			default:
+			}
+		}
+	}
+	return found
+}
+
+func (tbs *tieredBatchStore) SchedulePut(c chunks.Chunk, refHeight uint64, hints types.Hints) {
+	tbs.local.Put(c)
+	tbs.httpBatchStore.SchedulePut(c, refHeight, hints)
+}
+
+func (tbs *tieredBatchStore) Close() error {
+	close(tbs.fillCh)
+	tbs.wg.Wait()
+	tbs.local.Close()
+	return tbs.httpBatchStore.Close()
+}
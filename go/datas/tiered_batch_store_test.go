@@ -0,0 +1,40 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestTieredBatchStore(t *testing.T) {
+	assert := assert.New(t)
+	remote, local := chunks.NewTestStore(), chunks.NewMemoryStore()
+
+	c := chunks.NewChunk([]byte("abc"))
+	remote.Put(c)
+
+	tbs := newTieredBatchStore(newHTTPBatchStoreForTest(remote), local)
+	assert.Equal(c.Hash(), tbs.Get(c.Hash()).Hash())
+	assert.Equal(1, remote.Reads)
+	tbs.Close()
+
+	// The chunk was copied to the local store, so the server isn't asked for it again.
+	assert.True(local.Has(c.Hash()))
+	tbs = newTieredBatchStore(newHTTPBatchStoreForTest(remote), local)
+	defer tbs.Close()
+	assert.Equal(c.Hash(), tbs.Get(c.Hash()).Hash())
+	assert.Equal(1, remote.Reads)
+
+	// Scheduled Puts go to both stores.
+	c2 := types.EncodeValue(types.String("def"), nil)
+	tbs.SchedulePut(c2, 1, types.Hints{})
+	tbs.Flush()
+	assert.True(local.Has(c2.Hash()))
+	assert.True(remote.Has(c2.Hash()))
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/tracing"
+)
+
+type recordedSpanKey struct{}
+
+type recordedSpan struct {
+	t        *recordingTracer
+	id       int
+	name     string
+	parent   *recordedSpan
+	tags     map[string]interface{}
+	finished bool
+}
+
+func (s *recordedSpan) SetTag(key string, value interface{}) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.tags[key] = value
+}
+
+func (s *recordedSpan) Finish() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.finished = true
+}
+
+// recordingTracer is a tracing.HeaderTracer which keeps the spans it starts, passing the id of a span in the X-Span header.
+type recordingTracer struct {
+	mu    *sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, tracing.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &recordedSpan{t: t, id: len(t.spans), name: name, tags: map[string]interface{}{}}
+	s.parent, _ = ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, recordedSpanKey{}, s), s
+}
+
+func (t *recordingTracer) Inject(ctx context.Context, h http.Header) {
+	if s, ok := ctx.Value(recordedSpanKey{}).(*recordedSpan); ok {
+		h.Set("X-Span", strconv.Itoa(s.id))
+	}
+}
+
+func (t *recordingTracer) Extract(ctx context.Context, h http.Header) context.Context {
+	id, err := strconv.Atoi(h.Get("X-Span"))
+	if err != nil {
+		return ctx
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, t.spans[id])
+}
+
+// finished returns the finished spans named |name|, waiting a little for there to be one, since a server may finish its span after the client has its response.
+func (t *recordingTracer) finished(name string) (spans []*recordedSpan) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		t.mu.Lock()
+		for _, s := range t.spans {
+			if s.name == name && s.finished {
+				spans = append(spans, s)
+			}
+		}
+		t.mu.Unlock()
+		if len(spans) > 0 {
+			return
+		}
+	}
+	return
+}
+
+func (t *recordingTracer) tag(s *recordedSpan, key string) interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return s.tags[key]
+}
+
+func TestTracingRemote(t *testing.T) {
+	assert := assert.New(t)
+	tr := &recordingTracer{mu: &sync.Mutex{}}
+	tracing.SetTracer(tr)
+	defer tracing.SetTracer(nil)
+
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	db := NewRemoteDatabase(fmt.Sprintf("http://localhost:%d", <-portChan), "")
+	defer db.Close()
+
+	l := types.NewList(types.Number(1), types.Number(2), types.String("three"))
+	ds, err := db.CommitValue(db.GetDataset("ds"), l)
+	assert.NoError(err)
+
+	commits := tr.finished("noms.commit")
+	assert.Len(commits, 1)
+	assert.Equal("ds", tr.tag(commits[0], "dataset"))
+
+	// The chunks written by the commit are traced as part of it, down to the server's handling of them.
+	writes := tr.finished("noms.writeValue")
+	assert.NotEmpty(writes)
+	assert.Equal("noms.write", writes[0].parent.name)
+	assert.Equal(commits[0], writes[0].parent.parent)
+	assert.True(tr.tag(writes[0], "chunks").(int) > 0)
+	serves := tr.finished("noms.serve /writeValue/")
+	assert.Len(serves, 1)
+	assert.Equal("noms.request", serves[0].parent.name)
+	assert.Equal(writes[0], serves[0].parent.parent)
+	assert.Equal(http.StatusCreated, tr.tag(serves[0].parent, "status"))
+	assert.Equal(tr.tag(writes[0], "chunks"), int(tr.tag(serves[0], "chunks_written").(int64)))
+
+	// Pulling from the server traces the pull, and the server's side of it.
+	sink := NewDatabase(chunks.NewMemoryStore())
+	defer sink.Close()
+	assert.NoError(PullContext(context.Background(), db, sink, ds.HeadRef(), types.Ref{}, 2))
+	pulls := tr.finished("noms.pull")
+	assert.Len(pulls, 1)
+	assert.Equal(true, tr.tag(pulls[0], "server"))
+	assert.True(tr.tag(pulls[0], "chunks").(uint64) > 0)
+	assert.True(tr.tag(pulls[0], "bytes").(uint64) > 0)
+	serves = tr.finished("noms.serve /pullRefs/")
+	assert.Len(serves, 1)
+	assert.Equal(pulls[0], serves[0].parent.parent)
+	assert.True(uint64(tr.tag(serves[0], "chunks_read").(int64)) >= tr.tag(pulls[0], "chunks").(uint64))
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"time"
+
+	"github.com/stormasm/noms/go/hash"
+)
+
+// WatchHead calls |f| each time the head of the dataset |datasetID| in |db| changes, with the dataset as it was before the change and as it is after it, until f returns false. A dataset which doesn't exist, or has been deleted, has no head. The head is checked by rebasing db, so other datasets seen through db are brought up to date as well. If db is a client of a server with a notify/ endpoint, or of a GRPCServer, that's whenever the server says the head's changed; otherwise, it's every |interval|.
+func WatchHead(db Database, datasetID string, interval time.Duration, f func(old, new Dataset) bool) {
+	old := db.GetDataset(datasetID)
+	check := func() bool {
+		db.Rebase()
+		new := db.GetDataset(datasetID)
+		if headHash(new) == headHash(old) {
+			return true
+		}
+		if !f(old, new) {
+			return false
+		}
+		old = new
+		return true
+	}
+
+	if notify := notifier(db); notify != nil {
+		for {
+			done := false
+			supported := notify([]string{datasetID}, func() bool {
+				done = !check()
+				return !done
+			})
+			if done {
+				return
+			}
+			if !supported {
+				break
+			}
+			// The connection was lost. Changes made before it's made again are still seen, since the server starts by sending the root.
+			time.Sleep(interval)
+		}
+	}
+	for {
+		time.Sleep(interval)
+		if !check() {
+			return
+		}
+	}
+}
+
+// notifier returns the func with which the server |db| is a client of says when datasets change, or nil if db isn't a client of a server.
+func notifier(db Database) func(datasets []string, f func() bool) bool {
+	switch db := db.(type) {
+	case *RemoteDatabaseClient:
+		return db.httpBatchStore().notify
+	case *LocalDatabase:
+		if gs, ok := db.cs.(*GRPCStore); ok {
+			return gs.watch
+		}
+	}
+	return nil
+}
+
+func headHash(ds Dataset) hash.Hash {
+	if r, ok := ds.MaybeHeadRef(); ok {
+		return r.TargetHash()
+	}
+	return hash.Hash{}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestWatchHead(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	writer := NewDatabase(cs)
+	ds, err := writer.CommitValue(writer.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	first := ds.HeadRef()
+	watcher := NewDatabase(cs)
+	defer watcher.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(10 * time.Millisecond)
+		_, err := writer.CommitValue(writer.GetDataset("other"), types.String("ignored"))
+		assert.NoError(err)
+		_, err = writer.CommitValue(ds, types.String("b"))
+		assert.NoError(err)
+	}()
+
+	changes := 0
+	WatchHead(watcher, "ds", time.Millisecond, func(old, new Dataset) bool {
+		changes++
+		switch changes {
+		case 1:
+			assert.True(first.Equals(old.HeadRef()))
+			assert.Equal(types.String("b"), new.HeadValue())
+			// The writer deletes the dataset in response.
+			<-done
+			_, err := writer.Delete(writer.GetDataset("ds"))
+			assert.NoError(err)
+			return true
+		default:
+			assert.Equal(types.String("b"), old.HeadValue())
+			_, ok := new.MaybeHeadRef()
+			assert.False(ok)
+			return false
+		}
+	})
+	assert.Equal(2, changes)
+	assert.Equal(types.String("ignored"), watcher.GetDataset("other").HeadValue())
+}
+
+func TestWatchHeadRemote(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	url := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	writer := NewRemoteDatabase(url, "")
+	ds, err := writer.CommitValue(writer.GetDataset("ds"), types.String("a"))
+	assert.NoError(err)
+	watcher := NewRemoteDatabase(url, "")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, err := writer.CommitValue(writer.GetDataset("other"), types.String("ignored"))
+		assert.NoError(err)
+		_, err = writer.CommitValue(ds, types.String("b"))
+		assert.NoError(err)
+	}()
+
+	// The interval is long enough that only a notification from the server could be noticed in time.
+	changes := 0
+	WatchHead(watcher, "ds", time.Hour, func(old, new Dataset) bool {
+		changes++
+		assert.Equal(types.String("a"), old.HeadValue())
+		assert.Equal(types.String("b"), new.HeadValue())
+		return false
+	})
+	assert.Equal(1, changes)
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package index maintains secondary indexes of the Maps at the heads of datasets, e.g. of a Map of users by their email addresses. Each index is kept in a dataset of its own, next to the one it indexes, and is brought up to date by diffing the Map it was last made from with the new head, so only the entries that changed are reindexed. A TextIndex is a full-text index of the strings in the value at a head, which can be searched by word.
+package index
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+const (
+	// indexesDir is the part of the dataset ID of an index between the indexed dataset's ID and the index's name. Dataset IDs can't have dots in them, so it can't be hidden as ".indexes".
+	indexesDir = "_indexes"
+
+	sourceField  = "source"
+	entriesField = "entries"
+)
+
+// Index describes a secondary index of the Map at the head of a dataset.
+type Index struct {
+	// Name identifies the index among those of the dataset. It's part of the ID of the dataset the index is kept in, so it may only have the characters that dataset IDs may.
+	Name string
+	// Keys returns the keys that the entry |k|, |v| of the indexed Map is indexed under, e.g. the email field of a user struct. An entry with no keys isn't indexed. It must always return the same keys for the same entry, since they're how the entry is found again to be reindexed.
+	Keys func(k, v types.Value) []types.Value
+}
+
+// Indexer is an index that Commit can keep up to date: an Index or a TextIndex.
+type Indexer interface {
+	indexName() string
+	update(db datas.Database, datasetID string) (datas.Dataset, error)
+}
+
+func (idx Index) indexName() string {
+	return idx.Name
+}
+
+func (idx Index) update(db datas.Database, datasetID string) (datas.Dataset, error) {
+	return Update(db, datasetID, idx)
+}
+
+// ByField returns an Index named |name| of the struct values of a Map by their field |field|. Values that aren't structs, or that don't have the field, aren't indexed.
+func ByField(name, field string) Index {
+	return Index{name, func(k, v types.Value) []types.Value {
+		if s, ok := v.(types.Struct); ok {
+			if fv, ok := s.MaybeGet(field); ok {
+				return []types.Value{fv}
+			}
+		}
+		return nil
+	}}
+}
+
+// DatasetID returns the ID of the dataset that the index |name| of the dataset |datasetID| is kept in, <datasetID>/_indexes/<name>.
+func DatasetID(datasetID, name string) string {
+	return datasetID + "/" + indexesDir + "/" + name
+}
+
+// Update brings |idx| up to date with the head of the dataset |datasetID|, whose value must be a Map, and returns the dataset the index is kept in. If the index was made from an earlier head, only the entries that have changed since are reindexed; otherwise it's made from scratch.
+//
+// The index is a struct with the commit it was made from, as source, and a Map from each index key to the Set of the keys of the entries that are indexed under it, as entries.
+func Update(db datas.Database, datasetID string, idx Index) (datas.Dataset, error) {
+	ids := db.GetDataset(DatasetID(datasetID, idx.Name))
+	head, ok := db.GetDataset(datasetID).MaybeHead()
+	if !ok {
+		return ids, fmt.Errorf("Dataset %s has no head to index", datasetID)
+	}
+	m, ok := head.Get(datas.ValueField).(types.Map)
+	if !ok {
+		return ids, fmt.Errorf("Dataset %s can't be indexed, because its value is a %s, not a Map", datasetID, head.Get(datas.ValueField).Type().Describe())
+	}
+
+	last, entries := types.NewMap(), types.NewMap()
+	if v, ok := ids.MaybeHeadValue(); ok {
+		indexed := v.(types.Struct)
+		source := indexed.Get(sourceField).(types.Ref)
+		if source.TargetHash() == head.Hash() {
+			return ids, nil
+		}
+		// If the last head wasn't a Map, there's nothing to diff with, so the index is made again.
+		if lastMap, ok := source.TargetValue(db).(types.Struct).Get(datas.ValueField).(types.Map); ok {
+			last, entries = lastMap, indexed.Get(entriesField).(types.Map)
+		}
+	}
+
+	changes := make(chan types.ValueChanged)
+	go func() {
+		m.Diff(last, changes, nil)
+		close(changes)
+	}()
+	for c := range changes {
+		if c.ChangeType != types.DiffChangeAdded {
+			for _, key := range idx.Keys(c.V, last.Get(c.V)) {
+				entries = remove(entries, key, c.V)
+			}
+		}
+		if c.ChangeType != types.DiffChangeRemoved {
+			for _, key := range idx.Keys(c.V, m.Get(c.V)) {
+				entries = add(entries, key, c.V)
+			}
+		}
+	}
+
+	return db.CommitValue(ids, types.NewStruct("Index", types.StructData{
+		sourceField:  types.NewRef(head),
+		entriesField: entries,
+	}))
+}
+
+func add(entries types.Map, key, k types.Value) types.Map {
+	keys := types.NewSet()
+	if v, ok := entries.MaybeGet(key); ok {
+		keys = v.(types.Set)
+	}
+	return entries.Set(key, keys.Insert(k))
+}
+
+func remove(entries types.Map, key, k types.Value) types.Map {
+	v, ok := entries.MaybeGet(key)
+	if !ok {
+		return entries
+	}
+	if keys := v.(types.Set).Remove(k); !keys.Empty() {
+		return entries.Set(key, keys)
+	}
+	return entries.Remove(key)
+}
+
+// Commit commits |v| to |ds| with |opts|, as db.Commit does, and then updates each of |indexes| of ds. The returned Dataset is ds after the commit; if an index can't be updated, the error says which.
+func Commit(db datas.Database, ds datas.Dataset, v types.Value, opts datas.CommitOptions, indexes ...Indexer) (datas.Dataset, error) {
+	ds, err := db.Commit(ds, v, opts)
+	if err != nil {
+		return ds, err
+	}
+	for _, idx := range indexes {
+		if _, err := idx.update(db, ds.ID()); err != nil {
+			return ds, fmt.Errorf("Updating index %s: %s", idx.indexName(), err)
+		}
+	}
+	return ds, nil
+}
+
+// IsCurrent returns true if the index |name| of the dataset |datasetID| exists and was last updated with the dataset's current head, so that what Lookup or Search find in it is up to date.
+func IsCurrent(db datas.Database, datasetID, name string) bool {
+	v, ok := db.GetDataset(DatasetID(datasetID, name)).MaybeHeadValue()
+	if !ok {
+		return false
+	}
+	headRef, ok := db.GetDataset(datasetID).MaybeHeadRef()
+	return ok && headRef.TargetHash() == v.(types.Struct).Get(sourceField).(types.Ref).TargetHash()
+}
+
+// Lookup returns the entries indexed under |key| by the index |name| of the dataset |datasetID|, as a Map from their keys to their values. They're read from the head the index was last updated with, which may be behind the dataset's head if the index hasn't been updated since.
+func Lookup(db datas.Database, datasetID, name string, key types.Value) (types.Map, error) {
+	v, ok := db.GetDataset(DatasetID(datasetID, name)).MaybeHeadValue()
+	if !ok {
+		return types.NewMap(), fmt.Errorf("Dataset %s has no index %s", datasetID, name)
+	}
+	indexed := v.(types.Struct)
+	source := indexed.Get(sourceField).(types.Ref).TargetValue(db).(types.Struct).Get(datas.ValueField).(types.Map)
+	found := types.NewMap()
+	if keys, ok := indexed.Get(entriesField).(types.Map).MaybeGet(key); ok {
+		keys.(types.Set).IterAll(func(k types.Value) {
+			found = found.Set(k, source.Get(k))
+		})
+	}
+	return found, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+func user(email string) types.Struct {
+	return types.NewStruct("User", types.StructData{"email": types.String(email)})
+}
+
+func TestIndex(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+	byEmail := ByField("by_email", "email")
+
+	users := types.NewMap(
+		types.String("alice"), user("a@example.com"),
+		types.String("bob"), user("b@example.com"),
+		types.String("carol"), user("shared@example.com"),
+		types.String("dave"), user("shared@example.com"),
+		types.String("eve"), types.Number(42),
+	)
+	ds, err := Commit(db, db.GetDataset("users"), users, datas.CommitOptions{}, byEmail)
+	assert.NoError(err)
+
+	found, err := Lookup(db, "users", "by_email", types.String("b@example.com"))
+	assert.NoError(err)
+	assert.True(types.NewMap(types.String("bob"), user("b@example.com")).Equals(found))
+	found, err = Lookup(db, "users", "by_email", types.String("shared@example.com"))
+	assert.NoError(err)
+	assert.Equal(uint64(2), found.Len())
+	found, err = Lookup(db, "users", "by_email", types.String("nobody@example.com"))
+	assert.NoError(err)
+	assert.True(found.Empty())
+
+	// Changed, added and removed entries are reindexed.
+	users = users.Set(types.String("alice"), user("alice@example.com")).Set(types.String("frank"), user("b@example.com")).Remove(types.String("carol"))
+	_, err = Commit(db, ds, users, datas.CommitOptions{}, byEmail)
+	assert.NoError(err)
+	found, err = Lookup(db, "users", "by_email", types.String("a@example.com"))
+	assert.NoError(err)
+	assert.True(found.Empty())
+	found, err = Lookup(db, "users", "by_email", types.String("alice@example.com"))
+	assert.NoError(err)
+	assert.True(found.Has(types.String("alice")))
+	found, err = Lookup(db, "users", "by_email", types.String("b@example.com"))
+	assert.NoError(err)
+	assert.Equal(uint64(2), found.Len())
+	found, err = Lookup(db, "users", "by_email", types.String("shared@example.com"))
+	assert.NoError(err)
+	assert.True(types.NewMap(types.String("dave"), user("shared@example.com")).Equals(found))
+
+	// The incrementally updated index is the same as one made from scratch.
+	_, err = Update(db, "users", ByField("by_email_again", "email"))
+	assert.NoError(err)
+	incremental := db.GetDataset(DatasetID("users", "by_email")).HeadValue().(types.Struct).Get(entriesField)
+	scratch := db.GetDataset(DatasetID("users", "by_email_again")).HeadValue().(types.Struct).Get(entriesField)
+	assert.True(incremental.Equals(scratch))
+
+	assert.True(IsCurrent(db, "users", "by_email"))
+	assert.False(IsCurrent(db, "users", "by_name"))
+	_, err = db.CommitValue(db.GetDataset("users"), types.NewMap())
+	assert.NoError(err)
+	assert.False(IsCurrent(db, "users", "by_email"))
+
+	_, err = Lookup(db, "users", "by_name", types.String("bob"))
+	assert.Error(err)
+	_, err = db.CommitValue(db.GetDataset("list"), types.NewList())
+	assert.NoError(err)
+	_, err = Update(db, "list", byEmail)
+	assert.Error(err)
+}
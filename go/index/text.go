@@ -0,0 +1,226 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+const postingsField = "postings"
+
+// TextIndex describes a full-text index of the strings in the value at the head of a dataset. Each string is split into words by Tokenize, and the index maps each word to the Paths of the strings it's in, so Search can find them.
+type TextIndex struct {
+	// Name identifies the index among those of the dataset, as Index.Name does.
+	Name string
+	// Path is where the strings to index are in the dataset's value, e.g. .docs, or nothing to index all of them. Every string in Lists, Maps, Sets and Structs under it is indexed, but Map keys aren't, and Refs aren't followed.
+	Path types.Path
+}
+
+func (idx TextIndex) indexName() string {
+	return idx.Name
+}
+
+func (idx TextIndex) update(db datas.Database, datasetID string) (datas.Dataset, error) {
+	return UpdateText(db, datasetID, idx)
+}
+
+// Tokenize splits |s| into the words a TextIndex indexes it under: its runs of letters and digits, lower-cased.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// UpdateText brings |idx| up to date with the head of the dataset |datasetID|, and returns the dataset the index is kept in. If the index was made from an earlier head, only the strings that have changed since are reindexed, as found by types.DiffStream; otherwise it's made from scratch. Inserting into or removing from a List moves the elements after, though, so a List that has had that done to it is reindexed whole.
+//
+// The index is a struct with the commit it was made from, as source, and a Map from each word to the Set of the Paths, from the dataset's value, of the strings that have it, as postings.
+func UpdateText(db datas.Database, datasetID string, idx TextIndex) (datas.Dataset, error) {
+	ids := db.GetDataset(DatasetID(datasetID, idx.Name))
+	head, ok := db.GetDataset(datasetID).MaybeHead()
+	if !ok {
+		return ids, fmt.Errorf("Dataset %s has no head to index", datasetID)
+	}
+	value := idx.Path.Resolve(head.Get(datas.ValueField))
+
+	var last types.Value
+	postings := types.NewMap()
+	if v, ok := ids.MaybeHeadValue(); ok {
+		indexed := v.(types.Struct)
+		source := indexed.Get(sourceField).(types.Ref)
+		if source.TargetHash() == head.Hash() {
+			return ids, nil
+		}
+		last = idx.Path.Resolve(source.TargetValue(db).(types.Struct).Get(datas.ValueField))
+		postings = indexed.Get(postingsField).(types.Map)
+	}
+
+	ch := make(chan types.Difference)
+	go func() {
+		types.DiffStream(last, value, ch, nil)
+		close(ch)
+	}()
+	diffs := []types.Difference{}
+	relisted := []types.Path{}
+	for diff := range ch {
+		diffs = append(diffs, diff)
+		if diff.ChangeType == types.DiffChangeModified || len(diff.Path) == 0 {
+			continue
+		}
+		parent, in := diff.Path[:len(diff.Path)-1], value
+		if diff.ChangeType == types.DiffChangeRemoved {
+			in = last
+		}
+		if _, ok := parent.Resolve(in).(types.List); ok && !isUnder(parent, relisted) {
+			relisted = append(relisted, parent)
+		}
+	}
+	// A List may have been found to need reindexing after one inside it was, so drop those inside others.
+	outer := []types.Path{}
+	for i, p := range relisted {
+		others := append(append([]types.Path{}, relisted[:i]...), relisted[i+1:]...)
+		if !isUnder(p, others) {
+			outer = append(outer, p)
+		}
+	}
+	relisted = outer
+
+	full := func(p types.Path) types.Path {
+		return append(append(types.Path{}, idx.Path...), p...)
+	}
+	for _, diff := range diffs {
+		if isUnder(diff.Path, relisted) {
+			continue
+		}
+		walkStrings(full(diff.Path), diff.OldValue, func(p types.Path, s string) {
+			postings = unpost(postings, p, s)
+		})
+		walkStrings(full(diff.Path), diff.NewValue, func(p types.Path, s string) {
+			postings = post(postings, p, s)
+		})
+	}
+	for _, p := range relisted {
+		walkStrings(full(p), p.Resolve(last), func(p types.Path, s string) {
+			postings = unpost(postings, p, s)
+		})
+		walkStrings(full(p), p.Resolve(value), func(p types.Path, s string) {
+			postings = post(postings, p, s)
+		})
+	}
+
+	return db.CommitValue(ids, types.NewStruct("TextIndex", types.StructData{
+		sourceField:   types.NewRef(head),
+		postingsField: postings,
+	}))
+}
+
+// isUnder returns true if |p| is one of |prefixes|, or a Path into one.
+func isUnder(p types.Path, prefixes []types.Path) bool {
+	for _, prefix := range prefixes {
+		if len(prefix) <= len(p) && prefix.String() == p[:len(prefix)].String() {
+			return true
+		}
+	}
+	return false
+}
+
+// walkStrings calls |cb| with each string in |v|, which is at |p|, and its Path.
+func walkStrings(p types.Path, v types.Value, cb func(p types.Path, s string)) {
+	child := func(part types.PathPart) types.Path {
+		return append(append(types.Path{}, p...), part)
+	}
+	switch v := v.(type) {
+	case types.String:
+		cb(p, string(v))
+	case types.List:
+		v.IterAll(func(elem types.Value, i uint64) {
+			walkStrings(child(types.NewIndexPath(types.Number(i))), elem, cb)
+		})
+	case types.Map:
+		v.IterAll(func(k, elem types.Value) {
+			walkStrings(child(indexPathPart(k)), elem, cb)
+		})
+	case types.Set:
+		v.IterAll(func(elem types.Value) {
+			walkStrings(child(indexPathPart(elem)), elem, cb)
+		})
+	case types.Struct:
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, t *types.Type) {
+			walkStrings(child(types.NewFieldPath(name)), v.Get(name), cb)
+		})
+	}
+}
+
+// indexPathPart returns the PathPart for the key or element |k| of a Map or Set, addressing it by hash if it can't be spelled in a Path, as types.DiffStream does.
+func indexPathPart(k types.Value) types.PathPart {
+	switch k.Type().Kind() {
+	case types.BoolKind, types.NumberKind, types.StringKind:
+		return types.NewIndexPath(k)
+	}
+	return types.NewHashIndexPath(k.Hash())
+}
+
+func post(postings types.Map, p types.Path, s string) types.Map {
+	path := types.String(p.String())
+	for _, word := range Tokenize(s) {
+		paths := types.NewSet()
+		if v, ok := postings.MaybeGet(types.String(word)); ok {
+			paths = v.(types.Set)
+		}
+		postings = postings.Set(types.String(word), paths.Insert(path))
+	}
+	return postings
+}
+
+func unpost(postings types.Map, p types.Path, s string) types.Map {
+	path := types.String(p.String())
+	for _, word := range Tokenize(s) {
+		postings = remove(postings, types.String(word), path)
+	}
+	return postings
+}
+
+// Search returns the Paths, from the value at the head the text index |name| of the dataset |datasetID| was last updated with, of the strings that have every word in |query|, as Tokenize splits it. A query without words finds nothing.
+func Search(db datas.Database, datasetID, name, query string) ([]types.Path, error) {
+	v, ok := db.GetDataset(DatasetID(datasetID, name)).MaybeHeadValue()
+	if !ok {
+		return nil, fmt.Errorf("Dataset %s has no index %s", datasetID, name)
+	}
+	postings := v.(types.Struct).Get(postingsField).(types.Map)
+	var found types.Set
+	for i, word := range Tokenize(query) {
+		paths, ok := postings.MaybeGet(types.String(word))
+		if !ok {
+			return []types.Path{}, nil
+		}
+		if i == 0 {
+			found = paths.(types.Set)
+			continue
+		}
+		found.IterAll(func(p types.Value) {
+			if !paths.(types.Set).Has(p) {
+				found = found.Remove(p)
+			}
+		})
+	}
+
+	res := []types.Path{}
+	if (found == types.Set{}) {
+		return res, nil
+	}
+	var err error
+	found.IterAll(func(v types.Value) {
+		p, perr := types.ParsePath(string(v.(types.String)))
+		if perr != nil && err == nil {
+			err = perr
+		}
+		res = append(res, p)
+	})
+	return res, err
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+func doc(title string, tags ...string) types.Struct {
+	tagValues := make([]types.Value, len(tags))
+	for i, tag := range tags {
+		tagValues[i] = types.String(tag)
+	}
+	return types.NewStruct("Doc", types.StructData{"title": types.String(title), "tags": types.NewList(tagValues...)})
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "wörld", "42"}, Tokenize("Hello, Wörld! -- 42"))
+	assert.Empty(t, Tokenize(" ... "))
+}
+
+func TestTextIndex(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+	docsPath, err := types.ParsePath(".docs")
+	assert.NoError(err)
+	text := TextIndex{"text", docsPath}
+
+	search := func(query string) []string {
+		paths, err := Search(db, "site", "text", query)
+		assert.NoError(err)
+		strs := make([]string, len(paths))
+		for i, p := range paths {
+			strs[i] = p.String()
+		}
+		return strs
+	}
+
+	docs := types.NewMap(
+		types.String("a"), doc("The quick brown fox", "animals", "quick"),
+		types.String("b"), doc("A lazy dog", "animals"),
+	)
+	site := func(docs types.Map) types.Struct {
+		return types.NewStruct("Site", types.StructData{"docs": docs, "name": types.String("not indexed")})
+	}
+	ds, err := Commit(db, db.GetDataset("site"), site(docs), datas.CommitOptions{}, text)
+	assert.NoError(err)
+	assert.Equal([]string{`.docs["a"].title`}, search("QUICK fox"))
+	assert.Equal([]string{`.docs["a"].tags[0]`, `.docs["b"].tags[0]`}, search("animals"))
+	assert.Empty(search("quick dog"))
+	assert.Empty(search("indexed"))
+	assert.Empty(search(""))
+
+	// Inserting a tag at the front moves the others along.
+	docs = docs.Set(types.String("a"), doc("The slow brown fox", "new", "animals", "quick")).Remove(types.String("b"))
+	_, err = Commit(db, ds, site(docs), datas.CommitOptions{}, text)
+	assert.NoError(err)
+	assert.Empty(search("quick fox"))
+	assert.Equal([]string{`.docs["a"].title`}, search("slow fox"))
+	assert.Equal([]string{`.docs["a"].tags[1]`}, search("animals"))
+	assert.Equal([]string{`.docs["a"].tags[2]`}, search("quick"))
+	assert.Empty(search("dog"))
+
+	// The incrementally updated index is the same as one made from scratch.
+	_, err = UpdateText(db, "site", TextIndex{"text_again", docsPath})
+	assert.NoError(err)
+	incremental := db.GetDataset(DatasetID("site", "text")).HeadValue().(types.Struct).Get(postingsField)
+	scratch := db.GetDataset(DatasetID("site", "text_again")).HeadValue().(types.Struct).Get(postingsField)
+	assert.True(incremental.Equals(scratch))
+
+	_, err = Search(db, "site", "nothing", "fox")
+	assert.Error(err)
+}
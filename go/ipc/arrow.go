@@ -0,0 +1,566 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// See https://arrow.apache.org/docs/format/Columnar.html#serialization-and-interprocess-communication-ipc for the format, and Schema.fbs, Message.fbs and File.fbs in the Arrow repository for the metadata.
+
+const (
+	arrowContinuation = 0xffffffff
+
+	arrowVersionV4 = 3
+	arrowVersionV5 = 4
+
+	arrowHeaderSchema          = 1
+	arrowHeaderDictionaryBatch = 2
+	arrowHeaderRecordBatch     = 3
+
+	arrowTypeNull          = 1
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeBinary        = 4
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeLargeBinary   = 19
+	arrowTypeLargeUtf8     = 20
+
+	arrowPrecisionHalf   = 0
+	arrowPrecisionSingle = 1
+	arrowPrecisionDouble = 2
+)
+
+// arrowMagic starts and ends Arrow files, as opposed to streams.
+var arrowMagic = []byte("ARROW1")
+
+// arrowWriter writes an Arrow IPC stream or file: the schema, then a record batch for every batchSize rows, and for files, a footer with where the batches are.
+type arrowWriter struct {
+	w         io.Writer
+	schema    Schema
+	batchSize int
+	file      bool
+	pos       int64
+	blocks    [][3]int64
+	cols      []*arrowColumn
+	rows      int
+}
+
+// NewArrowWriter returns a Writer which writes an Arrow IPC stream of the rows to |w|, in record batches of |batchSize| rows.
+func NewArrowWriter(w io.Writer, schema Schema, batchSize int) (Writer, error) {
+	return newArrowWriter(w, schema, batchSize, false)
+}
+
+// NewArrowFileWriter is like NewArrowWriter, but writes an Arrow file, also known as Feather version 2, which tools can read the batches of out of order.
+func NewArrowFileWriter(w io.Writer, schema Schema, batchSize int) (Writer, error) {
+	return newArrowWriter(w, schema, batchSize, true)
+}
+
+func newArrowWriter(w io.Writer, schema Schema, batchSize int, file bool) (*arrowWriter, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("Invalid batch size %d", batchSize)
+	}
+	aw := &arrowWriter{w: w, schema: schema, batchSize: batchSize, file: file}
+	for _, c := range schema {
+		aw.cols = append(aw.cols, &arrowColumn{kind: c.Kind})
+	}
+	if file {
+		if err := aw.write([]byte("ARROW1\x00\x00")); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := aw.writeMessage(arrowHeaderSchema, arrowSchemaTable(schema), nil); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *arrowWriter) write(b []byte) error {
+	n, err := aw.w.Write(b)
+	aw.pos += int64(n)
+	return err
+}
+
+// writeMessage writes an encapsulated message, and returns the length of its metadata, including the prefix before it.
+func (aw *arrowWriter) writeMessage(headerType uint8, header *fbTable, body []byte) (int64, error) {
+	meta := fbEncode((&fbTable{}).
+		int16(0, arrowVersionV5).
+		uint8(1, headerType).
+		ref(2, header).
+		int64(3, int64(len(body))))
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint32(prefix, arrowContinuation)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, b := range [][]byte{prefix, meta, body} {
+		if err := aw.write(b); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(prefix) + len(meta)), nil
+}
+
+func arrowSchemaTable(schema Schema) *fbTable {
+	fields := make(fbTables, len(schema))
+	for i, c := range schema {
+		f := (&fbTable{}).ref(0, fbString(c.Name)).bool(1, c.Nullable)
+		switch c.Kind {
+		case types.BoolKind:
+			f.uint8(2, arrowTypeBool).ref(3, &fbTable{})
+		case types.NumberKind:
+			f.uint8(2, arrowTypeFloatingPoint).ref(3, (&fbTable{}).int16(0, arrowPrecisionDouble))
+		case types.StringKind:
+			f.uint8(2, arrowTypeUtf8).ref(3, &fbTable{})
+		}
+		// Readers insist on children, even if there aren't any.
+		fields[i] = f.ref(5, fbTables{})
+	}
+	return (&fbTable{}).int16(0, 0).ref(1, fields)
+}
+
+func (aw *arrowWriter) Write(row types.Struct) error {
+	values, err := columnValues(row, aw.schema)
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		aw.cols[i].append(v, aw.rows)
+	}
+	aw.rows++
+	if aw.rows == aw.batchSize {
+		return aw.flush()
+	}
+	return nil
+}
+
+// columnValues returns the values of the columns of |schema| in |row|, with nil for nulls.
+func columnValues(row types.Struct, schema Schema) ([]types.Value, error) {
+	values := make([]types.Value, len(schema))
+	for i, c := range schema {
+		v, ok := row.MaybeGet(c.Name)
+		if !ok {
+			if !c.Nullable {
+				return nil, fmt.Errorf("Struct %s has no field %s", row.Type().Describe(), c.Name)
+			}
+			continue
+		}
+		if v.Type().Kind() != c.Kind {
+			return nil, fmt.Errorf("Field %s is a %s, but the column is a %s", c.Name, v.Type().Describe(), types.KindToString[c.Kind])
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (aw *arrowWriter) flush() error {
+	if aw.rows == 0 {
+		return nil
+	}
+	body := &bytes.Buffer{}
+	nodes := make([][2]int64, len(aw.cols))
+	buffers := [][2]int64{}
+	addBuffer := func(b []byte) {
+		buffers = append(buffers, [2]int64{int64(body.Len()), int64(len(b))})
+		body.Write(b)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	for i, col := range aw.cols {
+		nodes[i] = [2]int64{int64(aw.rows), int64(col.nulls)}
+		if col.nulls > 0 {
+			addBuffer(col.validity)
+		} else {
+			addBuffer(nil)
+		}
+		if col.kind == types.StringKind {
+			addBuffer(col.offsets)
+		}
+		addBuffer(col.values)
+		*col = arrowColumn{kind: col.kind}
+	}
+
+	start := aw.pos
+	metaLen, err := aw.writeMessage(arrowHeaderRecordBatch, (&fbTable{}).
+		int64(0, int64(aw.rows)).
+		ref(1, int64Pairs(nodes)).
+		ref(2, int64Pairs(buffers)), body.Bytes())
+	aw.blocks = append(aw.blocks, [3]int64{start, metaLen, int64(body.Len())})
+	aw.rows = 0
+	return err
+}
+
+func (aw *arrowWriter) Close() error {
+	if err := aw.flush(); err != nil {
+		return err
+	}
+	eos := make([]byte, 8)
+	binary.LittleEndian.PutUint32(eos, arrowContinuation)
+	if err := aw.write(eos); err != nil || !aw.file {
+		return err
+	}
+
+	// Blocks are structs of the offset of a message, the length of its metadata, padded to 8 bytes, and the length of its body.
+	blocks := make([]byte, 24*len(aw.blocks))
+	for i, b := range aw.blocks {
+		binary.LittleEndian.PutUint64(blocks[24*i:], uint64(b[0]))
+		binary.LittleEndian.PutUint32(blocks[24*i+8:], uint32(b[1]))
+		binary.LittleEndian.PutUint64(blocks[24*i+16:], uint64(b[2]))
+	}
+	footer := fbEncode((&fbTable{}).
+		int16(0, arrowVersionV5).
+		ref(1, arrowSchemaTable(aw.schema)).
+		ref(2, fbStructs{24, 8, nil}).
+		ref(3, fbStructs{24, 8, blocks}))
+	footerLen := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footerLen, uint32(len(footer)))
+	for _, b := range [][]byte{footer, footerLen, arrowMagic} {
+		if err := aw.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arrowColumn accumulates the buffers of a column of a record batch.
+type arrowColumn struct {
+	kind     types.NomsKind
+	validity []byte
+	nulls    int
+	values   []byte
+	offsets  []byte
+}
+
+func (col *arrowColumn) append(v types.Value, row int) {
+	if row%8 == 0 {
+		col.validity = append(col.validity, 0)
+		if col.kind == types.BoolKind {
+			col.values = append(col.values, 0)
+		}
+	}
+	if col.kind == types.StringKind && row == 0 {
+		col.offsets = make([]byte, 4)
+	}
+	if v == nil {
+		col.nulls++
+	} else {
+		col.validity[row/8] |= 1 << uint(row%8)
+	}
+
+	switch col.kind {
+	case types.BoolKind:
+		if v != nil && bool(v.(types.Bool)) {
+			col.values[row/8] |= 1 << uint(row%8)
+		}
+	case types.NumberKind:
+		var f float64
+		if v != nil {
+			f = float64(v.(types.Number))
+		}
+		col.values = append(col.values, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(col.values[len(col.values)-8:], math.Float64bits(f))
+	case types.StringKind:
+		if v != nil {
+			col.values = append(col.values, string(v.(types.String))...)
+		}
+		col.offsets = append(col.offsets, make([]byte, 4)...)
+		binary.LittleEndian.PutUint32(col.offsets[len(col.offsets)-4:], uint32(len(col.values)))
+	}
+}
+
+// arrowField is a field of an Arrow schema, and how to read its values.
+type arrowField struct {
+	name      string
+	arrowType uint8
+	bitWidth  int
+	signed    bool
+	precision int16
+	nullable  bool
+	skip      bool
+}
+
+// buffers returns the number of buffers the field has in a record batch.
+func (f arrowField) buffers() int {
+	switch f.arrowType {
+	case arrowTypeNull:
+		return 0
+	case arrowTypeUtf8, arrowTypeLargeUtf8, arrowTypeBinary, arrowTypeLargeBinary:
+		return 3
+	}
+	return 2
+}
+
+// arrowArray is the buffers of a column of the current record batch.
+type arrowArray struct {
+	validity, offsets, values []byte
+}
+
+// arrowReader reads an Arrow IPC stream or file.
+type arrowReader struct {
+	r       *bufio.Reader
+	fields  []arrowField
+	schema  Schema
+	rb      *rowBuilder
+	arrays  []arrowArray
+	length  int
+	row     int
+	done    bool
+	scratch []types.Value
+}
+
+// NewArrowReader returns a Reader of the rows in the Arrow IPC stream or file |r|, as structs named |structName|. Columns of the Null type are left out. Other columns must be of a primitive type: Bool, an integer or floating point number, which are read as Numbers, or Utf8 or Binary, which are read as Strings. Columns are Nullable if their fields are, and their names are escaped with types.EscapeStructField.
+func NewArrowReader(r io.Reader, structName string) (Reader, error) {
+	ar := &arrowReader{r: bufio.NewReader(r)}
+	if magic, err := ar.r.Peek(len(arrowMagic)); err == nil && bytes.Equal(magic, arrowMagic) {
+		// A file is the magic, padded to 8 bytes, then a stream, and a footer which isn't needed to read the stream.
+		ar.r.Discard(8)
+	}
+
+	msg, _, err := ar.readMessage()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Invalid Arrow stream, there's no schema")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.uint8(1, 0) != arrowHeaderSchema {
+		return nil, fmt.Errorf("Invalid Arrow stream, it doesn't start with a schema")
+	}
+	err = d.Try(func() {
+		schema, _ := msg.table(2)
+		for _, f := range schema.tables(1) {
+			ar.fields = append(ar.fields, readArrowField(f))
+		}
+	})
+	if err != nil {
+		return nil, d.Unwrap(err)
+	}
+
+	for _, f := range ar.fields {
+		if f.skip {
+			continue
+		}
+		c := Column{Name: f.name, Kind: types.NumberKind, Nullable: f.nullable}
+		switch f.arrowType {
+		case arrowTypeBool:
+			c.Kind = types.BoolKind
+		case arrowTypeUtf8, arrowTypeLargeUtf8, arrowTypeBinary, arrowTypeLargeBinary:
+			c.Kind = types.StringKind
+		}
+		ar.schema = append(ar.schema, c)
+	}
+	if err := escapeColumnNames(ar.schema); err != nil {
+		return nil, err
+	}
+	ar.rb = newRowBuilder(structName, ar.schema)
+	return ar, nil
+}
+
+func readArrowField(f fbRef) arrowField {
+	af := arrowField{name: f.string(0), nullable: f.bool(1), arrowType: f.uint8(2, 0)}
+	_, hasDictionary := f.table(4)
+	d.PanicIfTrue(hasDictionary, "Column %s is dictionary encoded, which isn't supported", af.name)
+	t, _ := f.table(3)
+	switch af.arrowType {
+	case arrowTypeNull:
+		af.skip = true
+	case arrowTypeInt:
+		af.bitWidth, af.signed = int(t.int32(0, 0)), t.bool(1)
+		d.PanicIfTrue(af.bitWidth != 8 && af.bitWidth != 16 && af.bitWidth != 32 && af.bitWidth != 64, "Column %s has an invalid bit width %d", af.name, af.bitWidth)
+	case arrowTypeFloatingPoint:
+		af.precision = t.int16(0, 0)
+		d.PanicIfTrue(af.precision != arrowPrecisionSingle && af.precision != arrowPrecisionDouble, "Column %s is a half precision float, which isn't supported", af.name)
+	case arrowTypeBool, arrowTypeUtf8, arrowTypeLargeUtf8, arrowTypeBinary, arrowTypeLargeBinary:
+	default:
+		d.PanicIfTrue(true, "Column %s is of Arrow type %d, which isn't supported", af.name, af.arrowType)
+	}
+	return af
+}
+
+// readMessage reads the next encapsulated message, returning io.EOF at the end of the stream.
+func (ar *arrowReader) readMessage() (msg fbRef, body []byte, err error) {
+	prefix := make([]byte, 4)
+	if _, err = io.ReadFull(ar.r, prefix); err != nil {
+		return
+	}
+	length := binary.LittleEndian.Uint32(prefix)
+	if length == arrowContinuation {
+		if _, err = io.ReadFull(ar.r, prefix); err != nil {
+			return
+		}
+		length = binary.LittleEndian.Uint32(prefix)
+	}
+	if length == 0 {
+		err = io.EOF
+		return
+	}
+	meta := make([]byte, length)
+	if _, err = io.ReadFull(ar.r, meta); err != nil {
+		return
+	}
+
+	var bodyLength int64
+	err = d.Try(func() {
+		msg = fbRoot(meta)
+		version := msg.int16(0, 0)
+		d.PanicIfTrue(version != arrowVersionV4 && version != arrowVersionV5, "Unsupported Arrow metadata version %d", version)
+		bodyLength = msg.int64(3, 0)
+		d.PanicIfTrue(bodyLength < 0, "Invalid Arrow message body length %d", bodyLength)
+	})
+	if err != nil {
+		err = d.Unwrap(err)
+		return
+	}
+	body = make([]byte, bodyLength)
+	_, err = io.ReadFull(ar.r, body)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func (ar *arrowReader) Schema() Schema {
+	return ar.schema
+}
+
+func (ar *arrowReader) Read() (types.Struct, error) {
+	for ar.row == ar.length {
+		if ar.done {
+			return types.Struct{}, io.EOF
+		}
+		if err := ar.nextBatch(); err != nil {
+			return types.Struct{}, err
+		}
+	}
+
+	if ar.scratch == nil {
+		ar.scratch = make([]types.Value, len(ar.schema))
+	}
+	var row types.Struct
+	err := d.Try(func() {
+		i := 0
+		for j, f := range ar.fields {
+			if !f.skip {
+				ar.scratch[i] = f.value(ar.arrays[j], ar.row)
+				i++
+			}
+		}
+		row = ar.rb.build(ar.scratch)
+	})
+	ar.row++
+	return row, d.Unwrap(err)
+}
+
+func (ar *arrowReader) nextBatch() error {
+	for {
+		msg, body, err := ar.readMessage()
+		if err == io.EOF {
+			ar.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch msg.uint8(1, 0) {
+		case arrowHeaderRecordBatch:
+			return d.Unwrap(d.Try(func() { ar.readBatch(msg, body) }))
+		case arrowHeaderDictionaryBatch:
+			return fmt.Errorf("Dictionary batches aren't supported")
+		default:
+			return fmt.Errorf("Unexpected Arrow message type %d", msg.uint8(1, 0))
+		}
+	}
+}
+
+func (ar *arrowReader) readBatch(msg fbRef, body []byte) {
+	batch, ok := msg.table(2)
+	d.PanicIfTrue(!ok, "Invalid Arrow record batch")
+	_, compressed := batch.table(3)
+	d.PanicIfTrue(compressed, "Compressed record batches aren't supported")
+	length := batch.int64(0, 0)
+	nodes, buffers := batch.int64Pairs(1), batch.int64Pairs(2)
+
+	buffer := func() []byte {
+		d.PanicIfTrue(len(buffers) == 0, "Invalid Arrow record batch, there are too few buffers")
+		b := buffers[0]
+		buffers = buffers[1:]
+		d.PanicIfTrue(b[0] < 0 || b[1] < 0 || b[0]+b[1] > int64(len(body)), "Invalid Arrow record batch, a buffer is out of range")
+		return body[b[0] : b[0]+b[1]]
+	}
+	ar.arrays = make([]arrowArray, len(ar.fields))
+	for i, f := range ar.fields {
+		d.PanicIfTrue(len(nodes) == 0, "Invalid Arrow record batch, there are too few field nodes")
+		d.PanicIfTrue(nodes[0][0] != length, "Invalid Arrow record batch, column %s has %d values rather than %d", f.name, nodes[0][0], length)
+		nulls := nodes[0][1]
+		nodes = nodes[1:]
+
+		a := arrowArray{}
+		switch f.buffers() {
+		case 2:
+			a.validity, a.values = buffer(), buffer()
+		case 3:
+			a.validity, a.offsets, a.values = buffer(), buffer(), buffer()
+		}
+		if nulls == 0 {
+			a.validity = nil
+		}
+		ar.arrays[i] = a
+	}
+	ar.length, ar.row = int(length), 0
+}
+
+// value returns the value of row |i| of |a|, or nil if it's null.
+func (f arrowField) value(a arrowArray, i int) types.Value {
+	if a.validity != nil {
+		d.PanicIfTrue(i/8 >= len(a.validity), "Invalid Arrow record batch, column %s's validity buffer is too short", f.name)
+		if a.validity[i/8]&(1<<uint(i%8)) == 0 {
+			return nil
+		}
+	}
+	fixed := func(size int) []byte {
+		d.PanicIfTrue((i+1)*size > len(a.values), "Invalid Arrow record batch, column %s's values are too short", f.name)
+		return a.values[i*size : (i+1)*size]
+	}
+	switch f.arrowType {
+	case arrowTypeBool:
+		d.PanicIfTrue(i/8 >= len(a.values), "Invalid Arrow record batch, column %s's values are too short", f.name)
+		return types.Bool(a.values[i/8]&(1<<uint(i%8)) != 0)
+	case arrowTypeInt:
+		b := fixed(f.bitWidth / 8)
+		var u uint64
+		for j := len(b) - 1; j >= 0; j-- {
+			u = u<<8 | uint64(b[j])
+		}
+		if f.signed {
+			shift := uint(64 - f.bitWidth)
+			return types.Number(int64(u<<shift) >> shift)
+		}
+		return types.Number(u)
+	case arrowTypeFloatingPoint:
+		if f.precision == arrowPrecisionSingle {
+			return types.Number(math.Float32frombits(binary.LittleEndian.Uint32(fixed(4))))
+		}
+		return types.Number(math.Float64frombits(binary.LittleEndian.Uint64(fixed(8))))
+	}
+
+	var start, end int64
+	if f.arrowType == arrowTypeLargeUtf8 || f.arrowType == arrowTypeLargeBinary {
+		d.PanicIfTrue((i+2)*8 > len(a.offsets), "Invalid Arrow record batch, column %s's offsets are too short", f.name)
+		start, end = int64(binary.LittleEndian.Uint64(a.offsets[i*8:])), int64(binary.LittleEndian.Uint64(a.offsets[i*8+8:]))
+	} else {
+		d.PanicIfTrue((i+2)*4 > len(a.offsets), "Invalid Arrow record batch, column %s's offsets are too short", f.name)
+		start, end = int64(int32(binary.LittleEndian.Uint32(a.offsets[i*4:]))), int64(int32(binary.LittleEndian.Uint32(a.offsets[i*4+4:])))
+	}
+	d.PanicIfTrue(start < 0 || start > end || end > int64(len(a.values)), "Invalid Arrow record batch, column %s has an offset out of range", f.name)
+	return types.String(a.values[start:end])
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestArrowRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	l := types.NewList(testRows(100)...)
+	schema, err := SchemaOf(l)
+	assert.NoError(err)
+	for _, newWriter := range []func(io.Writer, Schema, int) (Writer, error){NewArrowWriter, NewArrowFileWriter} {
+		buf := &bytes.Buffer{}
+		w, err := newWriter(buf, schema, 30)
+		assert.NoError(err)
+		assert.NoError(WriteValue(w, l))
+
+		r, err := NewArrowReader(bytes.NewReader(buf.Bytes()), "Row")
+		assert.NoError(err)
+		assert.Equal(schema, r.Schema())
+		l2, err := ReadToList(r, vs)
+		assert.NoError(err)
+		assert.True(l.Equals(l2))
+	}
+}
+
+func TestArrowFileMagic(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	w, err := NewArrowFileWriter(buf, Schema{{"x", types.NumberKind, false}}, 10)
+	assert.NoError(err)
+	assert.NoError(w.Close())
+	assert.True(bytes.HasPrefix(buf.Bytes(), arrowMagic))
+	assert.True(bytes.HasSuffix(buf.Bytes(), arrowMagic))
+}
+
+func TestArrowReaderErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewArrowReader(bytes.NewReader(nil), "Row")
+	assert.Error(err)
+	_, err = NewArrowReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 10, 0, 0, 0, 1, 2}), "Row")
+	assert.Error(err)
+
+	buf := &bytes.Buffer{}
+	w, err := NewArrowWriter(buf, Schema{{"x", types.NumberKind, false}}, 10)
+	assert.NoError(err)
+	assert.NoError(w.Write(types.NewStruct("Row", types.StructData{"x": types.Number(1)})))
+	assert.Error(w.Write(types.NewStruct("Row", types.StructData{"x": types.String("1")})))
+	assert.Error(w.Write(types.NewStruct("Row", types.StructData{})))
+	assert.NoError(w.Close())
+
+	// Truncating the stream leaves the record batch incomplete.
+	r, err := NewArrowReader(bytes.NewReader(buf.Bytes()[:buf.Len()-20]), "Row")
+	assert.NoError(err)
+	_, err = r.Read()
+	assert.Error(err)
+}
@@ -0,0 +1,313 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"encoding/binary"
+
+	"github.com/stormasm/noms/go/d"
+)
+
+// The metadata of Arrow messages is encoded as FlatBuffers. This file has just enough of a FlatBuffers encoder and decoder for that, which saves depending on the FlatBuffers compiler and the generated code for Arrow's schemas. See https://google.github.io/flatbuffers/flatbuffers_internals.html for the format.
+
+// fbTable is a table to encode. Its fields are set by their ids, and default to absent.
+type fbTable struct {
+	fields []fbField
+}
+
+// fbField is a field of a table: either a scalar of size bytes, or if ref is non-nil, an offset to a table, string or vector.
+type fbField struct {
+	size   int
+	scalar uint64
+	ref    interface{}
+}
+
+// fbString is a string to encode.
+type fbString string
+
+// fbTables is a vector of tables to encode.
+type fbTables []*fbTable
+
+// fbStructs is a vector of structs to encode, already laid out in data, each of size bytes and aligned to align bytes.
+type fbStructs struct {
+	size, align int
+	data        []byte
+}
+
+func (t *fbTable) set(id int, f fbField) *fbTable {
+	for len(t.fields) <= id {
+		t.fields = append(t.fields, fbField{})
+	}
+	t.fields[id] = f
+	return t
+}
+
+func (t *fbTable) bool(id int, v bool) *fbTable {
+	if v {
+		return t.set(id, fbField{size: 1, scalar: 1})
+	}
+	return t.set(id, fbField{size: 1})
+}
+
+func (t *fbTable) uint8(id int, v uint8) *fbTable {
+	return t.set(id, fbField{size: 1, scalar: uint64(v)})
+}
+
+func (t *fbTable) int16(id int, v int16) *fbTable {
+	return t.set(id, fbField{size: 2, scalar: uint64(uint16(v))})
+}
+
+func (t *fbTable) int32(id int, v int32) *fbTable {
+	return t.set(id, fbField{size: 4, scalar: uint64(uint32(v))})
+}
+
+func (t *fbTable) int64(id int, v int64) *fbTable {
+	return t.set(id, fbField{size: 8, scalar: uint64(v)})
+}
+
+func (t *fbTable) ref(id int, v interface{}) *fbTable {
+	return t.set(id, fbField{size: 4, ref: v})
+}
+
+// fbEncode returns the encoding of the flatbuffer whose root is |root|. Unlike the usual builders, which work back to front, it writes each object before the ones it refers to, so that offsets, which have to point forwards, can be patched in as the objects are placed.
+func fbEncode(root *fbTable) []byte {
+	e := &fbEncoder{buf: make([]byte, 4)}
+	e.patch(0, e.place(root))
+	e.align(8)
+	return e.buf
+}
+
+type fbEncoder struct {
+	buf []byte
+}
+
+func (e *fbEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *fbEncoder) put(size int, v uint64) {
+	for i := 0; i < size; i++ {
+		e.buf = append(e.buf, byte(v>>uint(8*i)))
+	}
+}
+
+// patch sets the offset at |pos| to point to |target|.
+func (e *fbEncoder) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(e.buf[pos:], uint32(target-pos))
+}
+
+// place writes |obj|, and everything it refers to, and returns where it starts.
+func (e *fbEncoder) place(obj interface{}) int {
+	switch obj := obj.(type) {
+	case *fbTable:
+		return e.placeTable(obj)
+	case fbString:
+		e.align(4)
+		pos := len(e.buf)
+		e.put(4, uint64(len(obj)))
+		e.buf = append(e.buf, obj...)
+		e.buf = append(e.buf, 0)
+		return pos
+	case fbTables:
+		e.align(4)
+		pos := len(e.buf)
+		e.put(4, uint64(len(obj)))
+		for range obj {
+			e.put(4, 0)
+		}
+		for i, t := range obj {
+			e.patch(pos+4+4*i, e.place(t))
+		}
+		return pos
+	case fbStructs:
+		// The structs, rather than the length before them, have to be aligned.
+		for (len(e.buf)+4)%obj.align != 0 {
+			e.buf = append(e.buf, 0)
+		}
+		pos := len(e.buf)
+		e.put(4, uint64(len(obj.data)/obj.size))
+		e.buf = append(e.buf, obj.data...)
+		return pos
+	}
+	panic("unreachable")
+}
+
+func (e *fbEncoder) placeTable(t *fbTable) int {
+	e.align(2)
+	vtable := len(e.buf)
+	e.put(2, uint64(4+2*len(t.fields)))
+	e.put(2, 0)
+	for range t.fields {
+		e.put(2, 0)
+	}
+
+	e.align(8)
+	table := len(e.buf)
+	e.put(4, uint64(table-vtable))
+
+	// Laying the fields out biggest first keeps the padding between them to a minimum.
+	refs := map[int]int{}
+	for _, size := range []int{8, 4, 2, 1} {
+		for id, f := range t.fields {
+			if f.size != size {
+				continue
+			}
+			e.align(size)
+			binary.LittleEndian.PutUint16(e.buf[vtable+4+2*id:], uint16(len(e.buf)-table))
+			if f.ref != nil {
+				refs[id] = len(e.buf)
+			}
+			e.put(size, f.scalar)
+		}
+	}
+	binary.LittleEndian.PutUint16(e.buf[vtable+2:], uint16(len(e.buf)-table))
+
+	for id, f := range t.fields {
+		if pos, ok := refs[id]; ok {
+			e.patch(pos, e.place(f.ref))
+		}
+	}
+	return table
+}
+
+// fbRef is a table in an encoded flatbuffer. Reading past the end of the buffer panics with a wrapped error, which callers recover with d.Try.
+type fbRef struct {
+	buf []byte
+	pos int
+}
+
+func fbRoot(buf []byte) fbRef {
+	return fbRef{buf, 0}.offset(0)
+}
+
+func (r fbRef) check(pos, size int) {
+	d.PanicIfTrue(pos < 0 || pos+size > len(r.buf), "Invalid flatbuffer, %d is out of range", pos)
+}
+
+func (r fbRef) u16(pos int) int {
+	r.check(pos, 2)
+	return int(binary.LittleEndian.Uint16(r.buf[pos:]))
+}
+
+func (r fbRef) u32(pos int) uint32 {
+	r.check(pos, 4)
+	return binary.LittleEndian.Uint32(r.buf[pos:])
+}
+
+func (r fbRef) u64(pos int) uint64 {
+	r.check(pos, 8)
+	return binary.LittleEndian.Uint64(r.buf[pos:])
+}
+
+// offset returns the object that the offset at |pos| points to.
+func (r fbRef) offset(pos int) fbRef {
+	return fbRef{r.buf, pos + int(r.u32(pos))}
+}
+
+// field returns the position of the field |id| of the table, or 0 if it's absent.
+func (r fbRef) field(id int) int {
+	vtable := r.pos - int(int32(r.u32(r.pos)))
+	if 4+2*id >= r.u16(vtable) {
+		return 0
+	}
+	if o := r.u16(vtable + 4 + 2*id); o != 0 {
+		return r.pos + o
+	}
+	return 0
+}
+
+func (r fbRef) uint8(id int, def uint8) uint8 {
+	if p := r.field(id); p != 0 {
+		r.check(p, 1)
+		return r.buf[p]
+	}
+	return def
+}
+
+func (r fbRef) bool(id int) bool {
+	return r.uint8(id, 0) != 0
+}
+
+func (r fbRef) int16(id int, def int16) int16 {
+	if p := r.field(id); p != 0 {
+		return int16(r.u16(p))
+	}
+	return def
+}
+
+func (r fbRef) int32(id int, def int32) int32 {
+	if p := r.field(id); p != 0 {
+		return int32(r.u32(p))
+	}
+	return def
+}
+
+func (r fbRef) int64(id int, def int64) int64 {
+	if p := r.field(id); p != 0 {
+		return int64(r.u64(p))
+	}
+	return def
+}
+
+// table returns the table that field |id| refers to, if it's present.
+func (r fbRef) table(id int) (fbRef, bool) {
+	if p := r.field(id); p != 0 {
+		return r.offset(p), true
+	}
+	return fbRef{}, false
+}
+
+// vector returns the vector that field |id| refers to, as the position of its first element and its length, which is 0 if it's absent.
+func (r fbRef) vector(id int) (start, n int) {
+	if p := r.field(id); p != 0 {
+		v := r.offset(p).pos
+		n := int(r.u32(v))
+		d.PanicIfTrue(n > len(r.buf), "Invalid flatbuffer, vector of %d elements", n)
+		return v + 4, n
+	}
+	return 0, 0
+}
+
+func (r fbRef) string(id int) string {
+	start, n := r.vector(id)
+	if n == 0 {
+		return ""
+	}
+	r.check(start, n)
+	return string(r.buf[start : start+n])
+}
+
+// tables returns the tables in the vector of tables that field |id| refers to.
+func (r fbRef) tables(id int) []fbRef {
+	start, n := r.vector(id)
+	tables := make([]fbRef, n)
+	for i := range tables {
+		tables[i] = r.offset(start + 4*i)
+	}
+	return tables
+}
+
+// int64Pairs returns the structs of two int64s, e.g. Arrow's FieldNodes and Buffers, in the vector of them that field |id| refers to.
+func (r fbRef) int64Pairs(id int) [][2]int64 {
+	start, n := r.vector(id)
+	r.check(start, 16*n)
+	pairs := make([][2]int64, n)
+	for i := range pairs {
+		pairs[i] = [2]int64{int64(r.u64(start + 16*i)), int64(r.u64(start + 16*i + 8))}
+	}
+	return pairs
+}
+
+// int64Pairs lays out |pairs| as a vector of structs of two int64s.
+func int64Pairs(pairs [][2]int64) fbStructs {
+	data := make([]byte, 16*len(pairs))
+	for i, p := range pairs {
+		binary.LittleEndian.PutUint64(data[16*i:], uint64(p[0]))
+		binary.LittleEndian.PutUint64(data[16*i+8:], uint64(p[1]))
+	}
+	return fbStructs{16, 8, data}
+}
@@ -0,0 +1,242 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package ipc converts Lists and Maps of structs to and from the columnar formats used by analytics tools: Apache Parquet files, and Apache Arrow IPC streams of record batches. Each field of the structs is a column, which must be a Bool, Number or String.
+package ipc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Column is a column of a table of structs: a field of the structs, and its kind, which is Bool, Number or String. A Nullable column is missing from some of the structs.
+type Column struct {
+	Name     string
+	Kind     types.NomsKind
+	Nullable bool
+}
+
+// Schema is the columns of a table, in the order they're stored.
+type Schema []Column
+
+// Index returns the index of the column named |name|, or -1 if there isn't one.
+func (s Schema) Index(name string) int {
+	for i, c := range s {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Writer writes a table of structs to a file. Close must be called after the last row is written to finish the file; it doesn't close the underlying io.Writer.
+type Writer interface {
+	Write(row types.Struct) error
+	Close() error
+}
+
+// Reader reads the rows of a table as structs, returning io.EOF after the last one.
+type Reader interface {
+	Schema() Schema
+	Read() (types.Struct, error)
+}
+
+// SchemaOf returns the Schema of |v|, a List of structs or a Map whose values are structs, with a column for each field of the structs, in name order. The structs don't all need to have the same fields, but a field must have the same kind in every struct that has it.
+func SchemaOf(v types.Value) (Schema, error) {
+	var elemType *types.Type
+	switch v := v.(type) {
+	case types.List:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[0]
+	case types.Map:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[1]
+	default:
+		return nil, fmt.Errorf("Expected a List or Map of structs, found %s", v.Type().Describe())
+	}
+
+	structTypes := []*types.Type{elemType}
+	if elemType.Kind() == types.UnionKind {
+		structTypes = elemType.Desc.(types.CompoundDesc).ElemTypes
+	}
+	if len(structTypes) == 0 {
+		return nil, fmt.Errorf("Can't find the columns of an empty %s", types.KindToString[v.Type().Kind()])
+	}
+
+	kinds := map[string]types.NomsKind{}
+	counts := map[string]int{}
+	for _, t := range structTypes {
+		if t.Kind() != types.StructKind {
+			return nil, fmt.Errorf("Expected structs, found %s", t.Describe())
+		}
+		var err error
+		t.Desc.(types.StructDesc).IterFields(func(name string, ft *types.Type) {
+			k := ft.Kind()
+			if k != types.BoolKind && k != types.NumberKind && k != types.StringKind {
+				err = fmt.Errorf("Field %s is a %s, but columns must be Bool, Number or String", name, ft.Describe())
+			} else if prev, ok := kinds[name]; ok && prev != k {
+				err = fmt.Errorf("Field %s is a %s in some structs and a %s in others", name, types.KindToString[prev], types.KindToString[k])
+			}
+			kinds[name] = k
+			counts[name]++
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schema := make(Schema, 0, len(kinds))
+	for name, k := range kinds {
+		schema = append(schema, Column{name, k, counts[name] < len(structTypes)})
+	}
+	sort.Sort(schemaByName(schema))
+	return schema, nil
+}
+
+type schemaByName Schema
+
+func (s schemaByName) Len() int           { return len(s) }
+func (s schemaByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s schemaByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// WriteValue writes each struct in |v|, a List, or the values of a Map, to |w|, and closes it.
+func WriteValue(w Writer, v types.Value) error {
+	err := d.Try(func() {
+		write := func(row types.Value) {
+			s, ok := row.(types.Struct)
+			d.PanicIfTrue(!ok, "Expected a struct, found %s", row.Type().Describe())
+			d.PanicIfError(w.Write(s))
+		}
+		switch v := v.(type) {
+		case types.List:
+			v.IterAll(func(row types.Value, _ uint64) { write(row) })
+		case types.Map:
+			v.IterAll(func(_, row types.Value) { write(row) })
+		default:
+			d.PanicIfTrue(true, "Expected a List or Map of structs, found %s", v.Type().Describe())
+		}
+	})
+	if err != nil {
+		return d.Unwrap(err)
+	}
+	return w.Close()
+}
+
+// ReadToList reads the rows of |r| into a List, as they're read.
+func ReadToList(r Reader, vrw types.ValueReadWriter) (types.List, error) {
+	values := make(chan types.Value, 128)
+	listChan := types.NewStreamingList(vrw, values)
+	for {
+		row, err := r.Read()
+		if err != nil {
+			close(values)
+			l := <-listChan
+			if err == io.EOF {
+				return l, nil
+			}
+			return types.List{}, err
+		}
+		values <- row
+	}
+}
+
+// ReadToMap reads the rows of |r| into a Map keyed by the values of the column named primaryKeys[0], or if there are several primary keys, by structs named keyName with a field for each of them. The rows are kept on disk, rather than in memory, until the Map is built. The primary key columns can't be Nullable.
+func ReadToMap(r Reader, primaryKeys []string, keyName string, vrw types.ValueReadWriter) (types.Map, error) {
+	if len(primaryKeys) == 0 {
+		return types.Map{}, fmt.Errorf("No primary key given")
+	}
+	schema := r.Schema()
+	for _, pk := range primaryKeys {
+		i := schema.Index(pk)
+		if i < 0 {
+			return types.Map{}, fmt.Errorf("Invalid primary key %s, there's no such column", pk)
+		}
+		if schema[i].Nullable {
+			return types.Map{}, fmt.Errorf("Invalid primary key %s, the column has nulls", pk)
+		}
+	}
+
+	gb := types.NewGraphBuilder(vrw, types.MapKind, false)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return gb.Build().(types.Map), nil
+		}
+		if err != nil {
+			// The builder has to be built to stop its goroutines.
+			gb.Build()
+			return types.Map{}, err
+		}
+		var key types.Value
+		if len(primaryKeys) == 1 {
+			key = row.Get(primaryKeys[0])
+		} else {
+			fields := make(types.StructData, len(primaryKeys))
+			for _, pk := range primaryKeys {
+				fields[pk] = row.Get(pk)
+			}
+			key = types.NewStruct(keyName, fields)
+		}
+		gb.MapSet(nil, key, row)
+	}
+}
+
+// rowBuilder makes the structs for the rows of a table. Rows with no nulls share a type, which saves computing it for each of them.
+type rowBuilder struct {
+	name   string
+	schema Schema
+	t      *types.Type
+	order  []int
+}
+
+func newRowBuilder(name string, schema Schema) *rowBuilder {
+	fields := make(types.FieldMap, len(schema))
+	names := make([]string, len(schema))
+	for i, c := range schema {
+		fields[c.Name] = types.MakePrimitiveType(c.Kind)
+		names[i] = c.Name
+	}
+
+	// NewStructWithType takes the fields in name order.
+	sort.Strings(names)
+	order := make([]int, len(schema))
+	for i, c := range schema {
+		order[i] = sort.SearchStrings(names, c.Name)
+	}
+	return &rowBuilder{name, schema, types.MakeStructTypeFromFields(name, fields), order}
+}
+
+// build returns the struct for a row whose columns have |values|, where a nil value is a null.
+func (b *rowBuilder) build(values []types.Value) types.Struct {
+	fields := make(types.ValueSlice, len(values))
+	for i, v := range values {
+		if v == nil {
+			data := types.StructData{}
+			for i, v := range values {
+				if v != nil {
+					data[b.schema[i].Name] = v
+				}
+			}
+			return types.NewStruct(b.name, data)
+		}
+		fields[b.order[i]] = v
+	}
+	return types.NewStructWithType(b.t, fields)
+}
+
+// escapeColumnNames escapes the names of the columns of |schema| with types.EscapeStructField, so that they can be the names of struct fields, and checks that they're still unique.
+func escapeColumnNames(schema Schema) error {
+	seen := map[string]bool{}
+	for i, c := range schema {
+		name := types.EscapeStructField(c.Name)
+		if seen[name] {
+			return fmt.Errorf("Column %s appears more than once", c.Name)
+		}
+		seen[name] = true
+		schema[i].Name = name
+	}
+	return nil
+}
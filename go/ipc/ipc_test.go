@@ -0,0 +1,94 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// testRows returns |n| rows with a Bool, Number and String column, where every third row has no b.
+func testRows(n int) []types.Value {
+	rows := make([]types.Value, n)
+	for i := range rows {
+		data := types.StructData{
+			"n": types.Number(float64(i) / 2),
+			"s": types.String(string(rune('a' + i%26))),
+		}
+		if i%3 != 0 {
+			data["b"] = types.Bool(i%2 == 0)
+		}
+		rows[i] = types.NewStruct("Row", data)
+	}
+	return rows
+}
+
+func TestSchemaOf(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := SchemaOf(types.NewList(testRows(4)...))
+	assert.NoError(err)
+	assert.Equal(Schema{
+		{"b", types.BoolKind, true},
+		{"n", types.NumberKind, false},
+		{"s", types.StringKind, false},
+	}, schema)
+	assert.Equal(1, schema.Index("n"))
+	assert.Equal(-1, schema.Index("x"))
+
+	m := types.NewMap(types.String("k"), types.NewStruct("Row", types.StructData{"x": types.Number(1)}))
+	schema, err = SchemaOf(m)
+	assert.NoError(err)
+	assert.Equal(Schema{{"x", types.NumberKind, false}}, schema)
+}
+
+func TestSchemaOfErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := SchemaOf(types.Number(1))
+	assert.Error(err)
+	_, err = SchemaOf(types.NewList())
+	assert.Error(err)
+	_, err = SchemaOf(types.NewList(types.Number(1)))
+	assert.Error(err)
+	_, err = SchemaOf(types.NewList(types.NewStruct("Row", types.StructData{"l": types.NewList()})))
+	assert.Error(err)
+	_, err = SchemaOf(types.NewList(
+		types.NewStruct("Row", types.StructData{"x": types.Number(1)}),
+		types.NewStruct("Row", types.StructData{"x": types.String("1")}),
+	))
+	assert.Error(err)
+}
+
+func TestReadToMap(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	l := types.NewList(testRows(10)...)
+	schema, err := SchemaOf(l)
+	assert.NoError(err)
+	buf := &bytes.Buffer{}
+	w, err := NewArrowWriter(buf, schema, 4)
+	assert.NoError(err)
+	assert.NoError(WriteValue(w, l))
+
+	r, err := NewArrowReader(bytes.NewReader(buf.Bytes()), "Row")
+	assert.NoError(err)
+	m, err := ReadToMap(r, []string{"n", "s"}, "Key", vs)
+	assert.NoError(err)
+	assert.Equal(uint64(10), m.Len())
+	row := m.Get(types.NewStruct("Key", types.StructData{"n": types.Number(1.5), "s": types.String("d")}))
+	assert.True(l.Get(3).Equals(row))
+
+	r, err = NewArrowReader(bytes.NewReader(buf.Bytes()), "Row")
+	assert.NoError(err)
+	_, err = ReadToMap(r, []string{"b"}, "Key", vs)
+	assert.Error(err)
+	_, err = ReadToMap(r, []string{"x"}, "Key", vs)
+	assert.Error(err)
+}
@@ -0,0 +1,698 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/stormasm/noms/go/constants"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// See https://github.com/apache/parquet-format for the format, and parquet.thrift there for the metadata.
+
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetFloat     = 4
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetConvertedUTF8   = 0
+	parquetConvertedUint8  = 11
+	parquetConvertedUint64 = 14
+
+	parquetPlain           = 0
+	parquetPlainDictionary = 2
+	parquetRLE             = 3
+	parquetRLEDictionary   = 8
+
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+	parquetDataPageV2     = 3
+)
+
+// parquetMagic starts and ends Parquet files.
+var parquetMagic = []byte("PAR1")
+
+// IsParquet returns whether |b|, the start of a file, is the start of a Parquet file.
+func IsParquet(b []byte) bool {
+	return bytes.HasPrefix(b, parquetMagic)
+}
+
+// Codec is how the pages of a Parquet file are compressed.
+type Codec int32
+
+const (
+	Uncompressed Codec = 0
+	Snappy       Codec = 1
+	Gzip         Codec = 2
+)
+
+// CodecNames maps the names of the codecs that Parquet files can be written with to them.
+var CodecNames = map[string]Codec{
+	"none":   Uncompressed,
+	"snappy": Snappy,
+	"gzip":   Gzip,
+}
+
+func (c Codec) compress(b []byte) []byte {
+	switch c {
+	case Snappy:
+		return snappy.Encode(nil, b)
+	case Gzip:
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		gw.Write(b)
+		gw.Close()
+		return buf.Bytes()
+	}
+	return b
+}
+
+func (c Codec) decompress(b []byte) ([]byte, error) {
+	switch c {
+	case Uncompressed:
+		return b, nil
+	case Snappy:
+		return snappy.Decode(nil, b)
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(gr)
+	}
+	return nil, fmt.Errorf("Pages compressed with Parquet codec %d aren't supported", c)
+}
+
+// parquetWriter writes a Parquet file: a row group for every rowGroupSize rows, each with a single page for each column, and then the metadata.
+type parquetWriter struct {
+	w            io.Writer
+	schema       Schema
+	rowGroupSize int
+	codec        Codec
+	pos          int64
+	cols         []*parquetColumn
+	rows         int
+	numRows      int64
+	rowGroups    []tStruct
+}
+
+// NewParquetWriter returns a Writer which writes a Parquet file of the rows to |w|, in row groups of |rowGroupSize| rows, compressed with |codec|. Bool columns are written as BOOLEANs, Number columns as DOUBLEs, and String columns as UTF8 BYTE_ARRAYs. Nullable columns are OPTIONAL, and the rest are REQUIRED.
+func NewParquetWriter(w io.Writer, schema Schema, rowGroupSize int, codec Codec) (Writer, error) {
+	if rowGroupSize <= 0 {
+		return nil, fmt.Errorf("Invalid row group size %d", rowGroupSize)
+	}
+	pw := &parquetWriter{w: w, schema: schema, rowGroupSize: rowGroupSize, codec: codec}
+	for _, c := range schema {
+		pw.cols = append(pw.cols, &parquetColumn{kind: c.Kind, nullable: c.Nullable})
+	}
+	if err := pw.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.pos += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) Write(row types.Struct) error {
+	values, err := columnValues(row, pw.schema)
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		pw.cols[i].append(v, pw.rows)
+	}
+	pw.rows++
+	if pw.rows == pw.rowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+func (pw *parquetWriter) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	chunks := make([]tStruct, len(pw.cols))
+	total := int64(0)
+	for i, col := range pw.cols {
+		page := col.page()
+		compressed := pw.codec.compress(page)
+		header := thriftEncode(tStruct{
+			{1, int32(parquetDataPage)},
+			{2, int32(len(page))},
+			{3, int32(len(compressed))},
+			{5, tStruct{
+				{1, int32(pw.rows)},
+				{2, int32(parquetPlain)},
+				{3, int32(parquetRLE)},
+				{4, int32(parquetRLE)},
+			}},
+		})
+
+		start := pw.pos
+		for _, b := range [][]byte{header, compressed} {
+			if err := pw.write(b); err != nil {
+				return err
+			}
+		}
+		c := pw.schema[i]
+		chunks[i] = tStruct{
+			{2, start},
+			{3, tStruct{
+				{1, int32(parquetType(c.Kind))},
+				{2, []int32{parquetPlain, parquetRLE}},
+				{3, []string{c.Name}},
+				{4, int32(pw.codec)},
+				{5, int64(pw.rows)},
+				{6, int64(len(header) + len(page))},
+				{7, int64(len(header) + len(compressed))},
+				{9, start},
+			}},
+		}
+		total += int64(len(header) + len(page))
+		*col = parquetColumn{kind: col.kind, nullable: col.nullable}
+	}
+	pw.rowGroups = append(pw.rowGroups, tStruct{
+		{1, chunks},
+		{2, total},
+		{3, int64(pw.rows)},
+	})
+	pw.numRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+func (pw *parquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	elements := []tStruct{{
+		{4, "schema"},
+		{5, int32(len(pw.schema))},
+	}}
+	for _, c := range pw.schema {
+		repetition := parquetRequired
+		if c.Nullable {
+			repetition = parquetOptional
+		}
+		e := tStruct{
+			{1, int32(parquetType(c.Kind))},
+			{3, int32(repetition)},
+			{4, c.Name},
+		}
+		if c.Kind == types.StringKind {
+			// Both the legacy converted type and the logical type, so that old and new readers know it's a string rather than bytes.
+			e = append(e, tField{6, int32(parquetConvertedUTF8)}, tField{10, tStruct{{1, tStruct{}}}})
+		}
+		elements = append(elements, e)
+	}
+	meta := thriftEncode(tStruct{
+		{1, int32(1)},
+		{2, elements},
+		{3, pw.numRows},
+		{4, pw.rowGroups},
+		{6, fmt.Sprintf("noms version %s", constants.NomsVersion)},
+	})
+	metaLen := make([]byte, 4)
+	binary.LittleEndian.PutUint32(metaLen, uint32(len(meta)))
+	for _, b := range [][]byte{meta, metaLen, parquetMagic} {
+		if err := pw.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parquetType(k types.NomsKind) int {
+	switch k {
+	case types.BoolKind:
+		return parquetBoolean
+	case types.NumberKind:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// parquetColumn accumulates the definition levels and values of a column of a row group.
+type parquetColumn struct {
+	kind     types.NomsKind
+	nullable bool
+	defined  []byte
+	values   []byte
+	count    int
+}
+
+func (col *parquetColumn) append(v types.Value, row int) {
+	if row%8 == 0 {
+		col.defined = append(col.defined, 0)
+	}
+	if v == nil {
+		return
+	}
+	col.defined[row/8] |= 1 << uint(row%8)
+
+	switch col.kind {
+	case types.BoolKind:
+		if col.count%8 == 0 {
+			col.values = append(col.values, 0)
+		}
+		if bool(v.(types.Bool)) {
+			col.values[col.count/8] |= 1 << uint(col.count%8)
+		}
+	case types.NumberKind:
+		col.values = append(col.values, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(col.values[len(col.values)-8:], math.Float64bits(float64(v.(types.Number))))
+	case types.StringKind:
+		s := string(v.(types.String))
+		col.values = append(col.values, make([]byte, 4)...)
+		binary.LittleEndian.PutUint32(col.values[len(col.values)-4:], uint32(len(s)))
+		col.values = append(col.values, s...)
+	}
+	col.count++
+}
+
+// page returns the uncompressed contents of a data page of the column. The definition levels of a nullable column, which are 1 for values and 0 for nulls, come first, bit packed. Since a run can be at most 63 groups of 8 levels in some readers, there's a run for every 504 rows.
+func (col *parquetColumn) page() []byte {
+	if !col.nullable {
+		return col.values
+	}
+	levels := &bytes.Buffer{}
+	for start := 0; start < len(col.defined); start += 63 {
+		end := start + 63
+		if end > len(col.defined) {
+			end = len(col.defined)
+		}
+		thriftPutVarint(levels, uint64(end-start)<<1|1)
+		levels.Write(col.defined[start:end])
+	}
+	page := make([]byte, 4, 4+levels.Len()+len(col.values))
+	binary.LittleEndian.PutUint32(page, uint32(levels.Len()))
+	page = append(page, levels.Bytes()...)
+	return append(page, col.values...)
+}
+
+// parquetField is a column of a Parquet file, and how to read its values.
+type parquetField struct {
+	name       string
+	parquetTyp int64
+	unsigned   bool
+	optional   bool
+}
+
+// parquetReader reads a Parquet file a row group at a time.
+type parquetReader struct {
+	r         io.ReaderAt
+	fields    []parquetField
+	schema    Schema
+	rb        *rowBuilder
+	rowGroups []interface{}
+	group     int
+	columns   [][]types.Value
+	length    int
+	row       int
+	scratch   []types.Value
+}
+
+// NewParquetReader returns a Reader of the rows in the Parquet file |r| of |size| bytes, as structs named |structName|. The file's schema must be flat, with columns of a primitive type: BOOLEAN, which is read as Bools, INT32, INT64, FLOAT or DOUBLE, which are read as Numbers, or BYTE_ARRAY, which is read as Strings. OPTIONAL columns are Nullable. Pages can be PLAIN or dictionary encoded, and uncompressed or compressed with Snappy or gzip. Column names are escaped with types.EscapeStructField.
+func NewParquetReader(r io.ReaderAt, size int64, structName string) (Reader, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("Invalid Parquet file, it's too short")
+	}
+	head, tail := make([]byte, 4), make([]byte, 8)
+	if err := readAt(r, head, 0); err != nil {
+		return nil, err
+	}
+	if err := readAt(r, tail, size-8); err != nil {
+		return nil, err
+	}
+	if !IsParquet(head) || !bytes.Equal(tail[4:], parquetMagic) {
+		return nil, fmt.Errorf("Invalid Parquet file, it doesn't start and end with %s", parquetMagic)
+	}
+	metaLen := int64(binary.LittleEndian.Uint32(tail))
+	if metaLen > size-12 {
+		return nil, fmt.Errorf("Invalid Parquet file, its metadata is out of range")
+	}
+	buf := make([]byte, metaLen)
+	if err := readAt(r, buf, size-8-metaLen); err != nil {
+		return nil, err
+	}
+
+	pr := &parquetReader{r: r}
+	err := d.Try(func() {
+		meta := (&thriftDecoder{buf: buf}).readStruct()
+		elements := meta.list(2)
+		d.PanicIfTrue(len(elements) == 0, "Invalid Parquet file, it has no schema")
+		root, _ := elements[0].(tValues)
+		children, _ := root.int(5)
+		d.PanicIfTrue(int(children) != len(elements)-1, "Nested Parquet schemas aren't supported")
+		for _, e := range elements[1:] {
+			pr.fields = append(pr.fields, readParquetField(e.(tValues)))
+		}
+		pr.rowGroups = meta.list(4)
+	})
+	if err != nil {
+		return nil, d.Unwrap(err)
+	}
+
+	for _, f := range pr.fields {
+		c := Column{Name: f.name, Kind: types.NumberKind, Nullable: f.optional}
+		switch f.parquetTyp {
+		case parquetBoolean:
+			c.Kind = types.BoolKind
+		case parquetByteArray:
+			c.Kind = types.StringKind
+		}
+		pr.schema = append(pr.schema, c)
+	}
+	if err := escapeColumnNames(pr.schema); err != nil {
+		return nil, err
+	}
+	pr.rb = newRowBuilder(structName, pr.schema)
+	return pr, nil
+}
+
+// readAt reads len(b) bytes at |off|, which unlike io.ReaderAt, isn't an error if they're the last bytes of |r|.
+func readAt(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if err == io.EOF && n == len(b) {
+		return nil
+	}
+	return err
+}
+
+func readParquetField(e tValues) parquetField {
+	f := parquetField{name: e.string(4)}
+	children, _ := e.int(5)
+	d.PanicIfTrue(children > 0, "Column %s is a group, but nested Parquet schemas aren't supported", f.name)
+	repetition, _ := e.int(3)
+	d.PanicIfTrue(repetition == parquetRepeated, "Column %s is repeated, which isn't supported", f.name)
+	f.optional = repetition == parquetOptional
+
+	typ, ok := e.int(1)
+	d.PanicIfTrue(!ok, "Invalid Parquet schema, column %s has no type", f.name)
+	switch typ {
+	case parquetBoolean, parquetInt32, parquetInt64, parquetFloat, parquetDouble, parquetByteArray:
+	default:
+		d.PanicIfTrue(true, "Column %s is of Parquet type %d, which isn't supported", f.name, typ)
+	}
+	f.parquetTyp = typ
+	converted, _ := e.int(6)
+	f.unsigned = converted >= parquetConvertedUint8 && converted <= parquetConvertedUint64
+	return f
+}
+
+func (pr *parquetReader) Schema() Schema {
+	return pr.schema
+}
+
+func (pr *parquetReader) Read() (types.Struct, error) {
+	for pr.row == pr.length {
+		if pr.group == len(pr.rowGroups) {
+			return types.Struct{}, io.EOF
+		}
+		if err := pr.nextGroup(); err != nil {
+			return types.Struct{}, err
+		}
+	}
+
+	if pr.scratch == nil {
+		pr.scratch = make([]types.Value, len(pr.schema))
+	}
+	for i, col := range pr.columns {
+		pr.scratch[i] = col[pr.row]
+	}
+	pr.row++
+	return pr.rb.build(pr.scratch), nil
+}
+
+func (pr *parquetReader) nextGroup() error {
+	group, _ := pr.rowGroups[pr.group].(tValues)
+	pr.group++
+	length, _ := group.int(3)
+	chunks := group.list(1)
+	if len(chunks) != len(pr.fields) {
+		return fmt.Errorf("Invalid Parquet row group, it has %d columns rather than %d", len(chunks), len(pr.fields))
+	}
+
+	pr.columns = make([][]types.Value, len(pr.fields))
+	for i, f := range pr.fields {
+		chunk, _ := chunks[i].(tValues)
+		meta, ok := chunk.strct(3)
+		if !ok {
+			return fmt.Errorf("Invalid Parquet row group, column %s has no metadata", f.name)
+		}
+		start, _ := meta.int(9)
+		if dict, ok := meta.int(11); ok && dict > 0 && dict < start {
+			start = dict
+		}
+		size, _ := meta.int(7)
+		if start < 0 || size < 0 || size > math.MaxInt32 {
+			return fmt.Errorf("Invalid Parquet row group, column %s is out of range", f.name)
+		}
+		buf := make([]byte, size)
+		if err := readAt(pr.r, buf, start); err != nil {
+			return err
+		}
+		codec, _ := meta.int(4)
+		var values []types.Value
+		err := d.Try(func() {
+			values = f.readChunk(buf, Codec(codec), int(length))
+		})
+		if err != nil {
+			return d.Unwrap(err)
+		}
+		if len(values) != int(length) {
+			return fmt.Errorf("Invalid Parquet row group, column %s has %d values rather than %d", f.name, len(values), length)
+		}
+		pr.columns[i] = values
+	}
+	pr.length, pr.row = int(length), 0
+	return nil
+}
+
+// readChunk reads the |n| values of the pages of a column chunk, with nil for nulls.
+func (f parquetField) readChunk(buf []byte, codec Codec, n int) []types.Value {
+	values := make([]types.Value, 0, n)
+	var dict []types.Value
+	dec := &thriftDecoder{buf: buf}
+	for len(values) < n {
+		header := dec.readStruct()
+		typ, _ := header.int(1)
+		size, _ := header.int(2)
+		compressedSize, _ := header.int(3)
+		d.PanicIfTrue(compressedSize < 0 || size < 0, "Invalid Parquet page size")
+		data := dec.bytes(uint64(compressedSize))
+
+		switch typ {
+		case parquetDictionaryPage:
+			dh, _ := header.strct(7)
+			count, _ := dh.int(1)
+			raw, err := codec.decompress(data)
+			d.PanicIfError(err)
+			dict = f.decodePlain(raw, int(count))
+		case parquetDataPage:
+			dh, _ := header.strct(5)
+			count, _ := dh.int(1)
+			encoding, _ := dh.int(2)
+			raw, err := codec.decompress(data)
+			d.PanicIfError(err)
+			var defined []uint32
+			if f.optional {
+				d.PanicIfTrue(len(raw) < 4, "Invalid Parquet page, column %s's definition levels are truncated", f.name)
+				l := binary.LittleEndian.Uint32(raw)
+				d.PanicIfTrue(uint64(l) > uint64(len(raw)-4), "Invalid Parquet page, column %s's definition levels are truncated", f.name)
+				defined = decodeHybrid(raw[4:4+l], 1, int(count))
+				raw = raw[4+l:]
+			}
+			values = f.appendPage(values, defined, int(count), encoding, raw, dict)
+		case parquetDataPageV2:
+			dh, _ := header.strct(8)
+			count, _ := dh.int(1)
+			encoding, _ := dh.int(4)
+			defLen, _ := dh.int(5)
+			repLen, _ := dh.int(6)
+			d.PanicIfTrue(defLen < 0 || repLen < 0 || defLen+repLen > int64(len(data)), "Invalid Parquet page, column %s's levels are out of range", f.name)
+			var defined []uint32
+			if f.optional {
+				defined = decodeHybrid(data[repLen:repLen+defLen], 1, int(count))
+			}
+			raw := data[repLen+defLen:]
+			if compressed, ok := dh.bool(7); !ok || compressed {
+				var err error
+				raw, err = codec.decompress(raw)
+				d.PanicIfError(err)
+			}
+			values = f.appendPage(values, defined, int(count), encoding, raw, dict)
+		}
+	}
+	return values
+}
+
+// appendPage appends the |count| values of a data page, whose non-null values are in |raw|, to |values|. |defined| is the page's definition levels, or nil if the column isn't optional.
+func (f parquetField) appendPage(values []types.Value, defined []uint32, count int, encoding int64, raw []byte, dict []types.Value) []types.Value {
+	nonNull := count
+	if defined != nil {
+		nonNull = 0
+		for _, l := range defined {
+			if l != 0 {
+				nonNull++
+			}
+		}
+	}
+
+	var page []types.Value
+	switch encoding {
+	case parquetPlain:
+		page = f.decodePlain(raw, nonNull)
+	case parquetPlainDictionary, parquetRLEDictionary:
+		d.PanicIfTrue(dict == nil, "Invalid Parquet page, column %s is dictionary encoded, but there's no dictionary", f.name)
+		d.PanicIfTrue(len(raw) == 0, "Invalid Parquet page, column %s's values are truncated", f.name)
+		page = make([]types.Value, nonNull)
+		for i, idx := range decodeHybrid(raw[1:], int(raw[0]), nonNull) {
+			d.PanicIfTrue(int(idx) >= len(dict), "Invalid Parquet page, column %s has a dictionary index out of range", f.name)
+			page[i] = dict[idx]
+		}
+	case parquetRLE:
+		d.PanicIfTrue(f.parquetTyp != parquetBoolean, "Column %s is RLE encoded, which is only supported for booleans", f.name)
+		d.PanicIfTrue(len(raw) < 4, "Invalid Parquet page, column %s's values are truncated", f.name)
+		page = make([]types.Value, nonNull)
+		for i, b := range decodeHybrid(raw[4:], 1, nonNull) {
+			page[i] = types.Bool(b != 0)
+		}
+	default:
+		d.PanicIfTrue(true, "Column %s has Parquet encoding %d, which isn't supported", f.name, encoding)
+	}
+
+	if defined == nil {
+		return append(values, page...)
+	}
+	for _, l := range defined {
+		if l == 0 {
+			values = append(values, nil)
+		} else {
+			values = append(values, page[0])
+			page = page[1:]
+		}
+	}
+	return values
+}
+
+// decodePlain decodes |n| PLAIN encoded values from |raw|.
+func (f parquetField) decodePlain(raw []byte, n int) []types.Value {
+	values := make([]types.Value, n)
+	fixed := func(size int) {
+		d.PanicIfTrue(n*size > len(raw), "Invalid Parquet page, column %s's values are truncated", f.name)
+	}
+	switch f.parquetTyp {
+	case parquetBoolean:
+		d.PanicIfTrue((n+7)/8 > len(raw), "Invalid Parquet page, column %s's values are truncated", f.name)
+		for i := range values {
+			values[i] = types.Bool(raw[i/8]&(1<<uint(i%8)) != 0)
+		}
+	case parquetInt32:
+		fixed(4)
+		for i := range values {
+			u := binary.LittleEndian.Uint32(raw[4*i:])
+			if f.unsigned {
+				values[i] = types.Number(u)
+			} else {
+				values[i] = types.Number(int32(u))
+			}
+		}
+	case parquetInt64:
+		fixed(8)
+		for i := range values {
+			u := binary.LittleEndian.Uint64(raw[8*i:])
+			if f.unsigned {
+				values[i] = types.Number(u)
+			} else {
+				values[i] = types.Number(int64(u))
+			}
+		}
+	case parquetFloat:
+		fixed(4)
+		for i := range values {
+			values[i] = types.Number(math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:])))
+		}
+	case parquetDouble:
+		fixed(8)
+		for i := range values {
+			values[i] = types.Number(math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:])))
+		}
+	case parquetByteArray:
+		for i := range values {
+			d.PanicIfTrue(len(raw) < 4, "Invalid Parquet page, column %s's values are truncated", f.name)
+			l := binary.LittleEndian.Uint32(raw)
+			d.PanicIfTrue(uint64(l) > uint64(len(raw)-4), "Invalid Parquet page, column %s's values are truncated", f.name)
+			values[i] = types.String(raw[4 : 4+l])
+			raw = raw[4+l:]
+		}
+	}
+	return values
+}
+
+// decodeHybrid decodes |n| values of |bitWidth| bits from |buf|, which is in Parquet's hybrid of run length encoding and bit packing.
+func decodeHybrid(buf []byte, bitWidth, n int) []uint32 {
+	d.PanicIfTrue(bitWidth > 32, "Invalid Parquet bit width %d", bitWidth)
+	values := make([]uint32, 0, n)
+	for len(values) < n {
+		header, l := binary.Uvarint(buf)
+		d.PanicIfTrue(l <= 0, "Invalid Parquet run, bad varint")
+		buf = buf[l:]
+
+		if header&1 == 0 {
+			// A run of one value, in as few bytes as hold it.
+			width := (bitWidth + 7) / 8
+			d.PanicIfTrue(width > len(buf), "Invalid Parquet run, it's truncated")
+			v := uint32(0)
+			for i := width - 1; i >= 0; i-- {
+				v = v<<8 | uint32(buf[i])
+			}
+			buf = buf[width:]
+			for run := header >> 1; run > 0 && len(values) < n; run-- {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// Groups of 8 values, bit packed from the least significant bit of each byte.
+		groups := header >> 1
+		if bitWidth == 0 && groups > uint64(n) {
+			groups = uint64(n)
+		}
+		d.PanicIfTrue(groups*uint64(bitWidth) > uint64(len(buf)) || groups > uint64(len(buf)+n), "Invalid Parquet run, it's truncated")
+		size := int(groups) * bitWidth
+		for i := 0; i < int(groups)*8 && len(values) < n; i++ {
+			v := uint32(0)
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				v |= uint32(buf[bit/8]>>uint(bit%8)&1) << uint(b)
+			}
+			values = append(values, v)
+		}
+		buf = buf[size:]
+	}
+	return values
+}
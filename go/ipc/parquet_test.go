@@ -0,0 +1,89 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	// More than 504 rows in a row group, so that the definition levels take several runs.
+	l := types.NewList(testRows(1200)...)
+	schema, err := SchemaOf(l)
+	assert.NoError(err)
+	for _, codec := range CodecNames {
+		buf := &bytes.Buffer{}
+		w, err := NewParquetWriter(buf, schema, 1000, codec)
+		assert.NoError(err)
+		assert.NoError(WriteValue(w, l))
+		assert.True(IsParquet(buf.Bytes()))
+
+		r, err := NewParquetReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "Row")
+		assert.NoError(err)
+		assert.Equal(schema, r.Schema())
+		l2, err := ReadToList(r, vs)
+		assert.NoError(err)
+		assert.True(l.Equals(l2))
+	}
+}
+
+func TestParquetReaderErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, b := range [][]byte{nil, []byte("PAR1....PAR1"), []byte("PAR1\x00\x00\x00\x00\x00\x00\x00\x00")} {
+		_, err := NewParquetReader(bytes.NewReader(b), int64(len(b)), "Row")
+		assert.Error(err)
+	}
+	meta := thriftEncode(tStruct{{2, []tStruct{{{4, "schema"}, {5, int32(1)}}, {{3, int32(parquetRepeated)}, {4, "x"}, {1, int32(parquetInt32)}}}}})
+	b := append(append([]byte("PAR1"), meta...), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(len(meta)))
+	b = append(b, parquetMagic...)
+	_, err := NewParquetReader(bytes.NewReader(b), int64(len(b)), "Row")
+	assert.Error(err)
+}
+
+func TestParquetDictionaryPages(t *testing.T) {
+	assert := assert.New(t)
+
+	// A dictionary of "a" and "b", and a page of 5 values, the second null, which are indices bit packed 1 bit wide.
+	dict := []byte{1, 0, 0, 0, 'a', 1, 0, 0, 0, 'b'}
+	data := []byte{2, 0, 0, 0, 3, 0x1d, 1, 3, 0x0a}
+	chunk := thriftEncode(tStruct{
+		{1, int32(parquetDictionaryPage)},
+		{2, int32(len(dict))},
+		{3, int32(len(dict))},
+		{7, tStruct{{1, int32(2)}, {2, int32(parquetPlain)}}},
+	})
+	chunk = append(chunk, dict...)
+	chunk = append(chunk, thriftEncode(tStruct{
+		{1, int32(parquetDataPage)},
+		{2, int32(len(data))},
+		{3, int32(len(data))},
+		{5, tStruct{{1, int32(5)}, {2, int32(parquetRLEDictionary)}, {3, int32(parquetRLE)}, {4, int32(parquetRLE)}}},
+	})...)
+	chunk = append(chunk, data...)
+
+	f := parquetField{name: "x", parquetTyp: parquetByteArray, optional: true}
+	values := f.readChunk(chunk, Uncompressed, 5)
+	assert.Equal([]types.Value{types.String("a"), nil, types.String("b"), types.String("a"), types.String("b")}, values)
+}
+
+func TestDecodeHybrid(t *testing.T) {
+	assert := assert.New(t)
+
+	// A run of 3 7s, 3 bits wide, then a group of 8 bit packed values.
+	buf := []byte{6, 7, 3, 0x88, 0xc6, 0xfa}
+	assert.Equal([]uint32{7, 7, 7, 0, 1, 2, 3, 4, 5, 6, 7}, decodeHybrid(buf, 3, 11))
+	assert.Equal([]uint32{7, 7}, decodeHybrid(buf, 3, 2))
+	assert.Equal([]uint32{0, 0, 0}, decodeHybrid([]byte{3}, 0, 3))
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/stormasm/noms/go/d"
+)
+
+// Parquet's metadata is encoded with Thrift's compact protocol. This file has just enough of an encoder and decoder for that, which saves depending on Thrift and the code it generates for parquet.thrift. See https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md for the protocol.
+
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+	thriftUUID   = 13
+)
+
+// tStruct is a struct to encode, as its fields in order of id.
+type tStruct []tField
+
+// tField is a field of a struct to encode. Its value is a bool, int32, int64, string, tStruct, or a list of int32s, strings or tStructs.
+type tField struct {
+	id    int16
+	value interface{}
+}
+
+func thriftEncode(s tStruct) []byte {
+	buf := &bytes.Buffer{}
+	thriftEncodeStruct(buf, s)
+	return buf.Bytes()
+}
+
+func thriftEncodeStruct(buf *bytes.Buffer, s tStruct) {
+	last := int16(0)
+	for _, f := range s {
+		var typ byte
+		switch v := f.value.(type) {
+		case bool:
+			typ = thriftFalse
+			if v {
+				typ = thriftTrue
+			}
+		case int32:
+			typ = thriftI32
+		case int64:
+			typ = thriftI64
+		case string:
+			typ = thriftBinary
+		case tStruct:
+			typ = thriftStruct
+		case []int32, []string, []tStruct:
+			typ = thriftList
+		default:
+			panic("unreachable")
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | typ)
+		} else {
+			buf.WriteByte(typ)
+			thriftPutVarint(buf, zigzag(int64(f.id)))
+		}
+		last = f.id
+		thriftEncodeValue(buf, f.value)
+	}
+	buf.WriteByte(0)
+}
+
+func thriftEncodeValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case int32:
+		thriftPutVarint(buf, zigzag(int64(v)))
+	case int64:
+		thriftPutVarint(buf, zigzag(v))
+	case string:
+		thriftPutVarint(buf, uint64(len(v)))
+		buf.WriteString(v)
+	case tStruct:
+		thriftEncodeStruct(buf, v)
+	case []int32:
+		thriftListHeader(buf, len(v), thriftI32)
+		for _, e := range v {
+			thriftEncodeValue(buf, e)
+		}
+	case []string:
+		thriftListHeader(buf, len(v), thriftBinary)
+		for _, e := range v {
+			thriftEncodeValue(buf, e)
+		}
+	case []tStruct:
+		thriftListHeader(buf, len(v), thriftStruct)
+		for _, e := range v {
+			thriftEncodeStruct(buf, e)
+		}
+	}
+}
+
+func thriftListHeader(buf *bytes.Buffer, n int, elemType byte) {
+	if n < 15 {
+		buf.WriteByte(byte(n)<<4 | elemType)
+		return
+	}
+	buf.WriteByte(0xf0 | elemType)
+	thriftPutVarint(buf, uint64(n))
+}
+
+func thriftPutVarint(buf *bytes.Buffer, v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	buf.Write(b[:binary.PutUvarint(b, v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// tValues is a decoded struct, from field ids to their values: bools, int64s for all sizes of integer, float64s, []byte for binary, tValues for structs, and []interface{} for lists and sets. Maps are skipped.
+type tValues map[int16]interface{}
+
+func (v tValues) int(id int16) (int64, bool) {
+	i, ok := v[id].(int64)
+	return i, ok
+}
+
+func (v tValues) bool(id int16) (bool, bool) {
+	b, ok := v[id].(bool)
+	return b, ok
+}
+
+func (v tValues) string(id int16) string {
+	b, _ := v[id].([]byte)
+	return string(b)
+}
+
+func (v tValues) strct(id int16) (tValues, bool) {
+	s, ok := v[id].(tValues)
+	return s, ok
+}
+
+func (v tValues) list(id int16) []interface{} {
+	l, _ := v[id].([]interface{})
+	return l
+}
+
+// thriftDecoder decodes structs from buf. Running out of input panics with a wrapped error, which callers recover with d.Try.
+type thriftDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (dec *thriftDecoder) byte() byte {
+	d.PanicIfTrue(dec.pos >= len(dec.buf), "Invalid Thrift struct, it's truncated")
+	dec.pos++
+	return dec.buf[dec.pos-1]
+}
+
+func (dec *thriftDecoder) bytes(n uint64) []byte {
+	d.PanicIfTrue(n > uint64(len(dec.buf)-dec.pos), "Invalid Thrift struct, it's truncated")
+	b := dec.buf[dec.pos : dec.pos+int(n)]
+	dec.pos += int(n)
+	return b
+}
+
+func (dec *thriftDecoder) varint() uint64 {
+	v, n := binary.Uvarint(dec.buf[dec.pos:])
+	d.PanicIfTrue(n <= 0, "Invalid Thrift struct, bad varint")
+	dec.pos += n
+	return v
+}
+
+func (dec *thriftDecoder) zigzag() int64 {
+	v := dec.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (dec *thriftDecoder) readStruct() tValues {
+	values := tValues{}
+	id := int16(0)
+	for {
+		b := dec.byte()
+		if b == 0 {
+			return values
+		}
+		typ := b & 0x0f
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(dec.zigzag())
+		}
+		switch typ {
+		case thriftTrue:
+			values[id] = true
+		case thriftFalse:
+			values[id] = false
+		default:
+			if v := dec.readValue(typ); v != nil {
+				values[id] = v
+			}
+		}
+	}
+}
+
+func (dec *thriftDecoder) readValue(typ byte) interface{} {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		// Bools in lists are a byte each.
+		return dec.byte() == thriftTrue
+	case thriftByte:
+		return int64(int8(dec.byte()))
+	case thriftI16, thriftI32, thriftI64:
+		return dec.zigzag()
+	case thriftDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(dec.bytes(8)))
+	case thriftBinary:
+		return dec.bytes(dec.varint())
+	case thriftUUID:
+		return dec.bytes(16)
+	case thriftStruct:
+		return dec.readStruct()
+	case thriftList, thriftSet:
+		b := dec.byte()
+		n := uint64(b >> 4)
+		if n == 15 {
+			n = dec.varint()
+		}
+		d.PanicIfTrue(n > uint64(len(dec.buf)), "Invalid Thrift list of %d elements", n)
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = dec.readValue(b & 0x0f)
+		}
+		return list
+	case thriftMap:
+		n := dec.varint()
+		if n > 0 {
+			b := dec.byte()
+			for i := uint64(0); i < n; i++ {
+				dec.readValue(b >> 4)
+				dec.readValue(b & 0x0f)
+			}
+		}
+		return nil
+	}
+	d.PanicIfTrue(true, "Invalid Thrift type %d", typ)
+	return nil
+}
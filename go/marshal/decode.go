@@ -10,6 +10,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/hash"
 	"github.com/stormasm/noms/go/types"
 )
 
@@ -22,9 +24,12 @@ import (
 // fields to the fields used by Marshal (either the struct field name or its tag).
 // Unmarshal will only set exported fields of the struct.
 // The name of the Go struct must match (ignoring case) the name of the Noms struct.
+// Every field must be in the Noms struct, unless it's tagged "omitempty", in which case it's set to its zero value if it isn't. A field tagged "original" is set to the Noms struct itself. A field tagged "encrypted" must be a types.Encrypted, which is decrypted with the Keys of UnmarshalOpt's Options.
 //
 // To unmarshal a Noms list into a slice, Unmarshal resets the slice length to zero and then appends each element to the slice. If the Go slice was nil a new slice is created.
 //
+// To unmarshal a Noms value into a Go pointer, Unmarshal unmarshals it into a new value, which the pointer is set to. If the Noms value is a Ref, its target is read from the VRW of UnmarshalOpt's Options and unmarshaled instead, and every Ref to the same target is unmarshaled into the same pointer, so values that pointers shared when they were marshaled are shared again.
+//
 // To unmarshal a Noms list into a Go array, Unmarshal decodes Noms list elements into corresponding Go array elements.
 //
 // To unmarshal a Noms map into a Go map, Unmarshal decodes Noms key and values into corresponding Go array elements. If the Go map was nil a new map is created.
@@ -36,18 +41,26 @@ import (
 //  - `types.Number` -> `float64`
 //  - `types.String` -> `string`
 //  - `types.Union` -> `interface`
+//  - `types.Struct` -> the type registered for its name with Register
 //  - Everything else an error
 //
+// When unmarshalling onto any other interface, which isn't a types.Value, Noms structs are unmarshaled as the types registered for their names with Register, which must implement it, and everything else is an error.
+//
 // Unmarshal returns an UnmarshalTypeMismatchError if:
 //  - a Noms value is not appropriate for a given target type
 //  - a Noms number overflows the target type
 //  - a Noms list is decoded into a Go array of a different length
 //
-func Unmarshal(v types.Value, out interface{}) (err error) {
+func Unmarshal(v types.Value, out interface{}) error {
+	return UnmarshalOpt(v, out, Options{})
+}
+
+// UnmarshalOpt is like Unmarshal, but maps Noms values to Go values as |opt| says. Unmarshal can fail having unmarshaled part of |v| into |out|, but with opt.Validate, the type of |v| is checked first, and a TypeMismatchError is returned, leaving |out| unchanged, if it doesn't match.
+func UnmarshalOpt(v types.Value, out interface{}, opt Options) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			switch r.(type) {
-			case *UnmarshalTypeMismatchError, *UnsupportedTypeError, *InvalidTagError:
+			case *UnmarshalTypeMismatchError, *UnsupportedTypeError, *InvalidTagError, *EncryptionError:
 				err = r.(error)
 				return
 			}
@@ -60,8 +73,13 @@ func Unmarshal(v types.Value, out interface{}) (err error) {
 		return &InvalidUnmarshalError{reflect.TypeOf(out)}
 	}
 	rv = rv.Elem()
-	d := typeDecoder(rv.Type())
-	d(v, rv)
+	d := typeDecoder(rv.Type(), opt.typeOptions())
+	if opt.Validate {
+		if err := validateType(v.Type(), rv.Type(), "", opt, map[typePair]bool{}); err != nil {
+			return err
+		}
+	}
+	d(v, rv, newDecodeState(opt))
 	return
 }
 
@@ -102,9 +120,26 @@ func overflowError(v types.Number, t reflect.Type) *UnmarshalTypeMismatchError {
 	return &UnmarshalTypeMismatchError{v, t, fmt.Sprintf(" (%g does not fit in %s)", v, t)}
 }
 
-type decoderFunc func(v types.Value, rv reflect.Value)
+// decodeState is the state of a call to UnmarshalOpt, which is needed to decode Refs into pointers.
+type decodeState struct {
+	vr   types.ValueReader
+	keys chunks.KeyProvider
+	// pointers maps the targets of the Refs that have been decoded into pointers, and the types of those pointers, to the pointers they were decoded into.
+	pointers map[refKey]reflect.Value
+}
 
-func typeDecoder(t reflect.Type) decoderFunc {
+type refKey struct {
+	h hash.Hash
+	t reflect.Type
+}
+
+func newDecodeState(opt Options) *decodeState {
+	return &decodeState{opt.VRW, opt.Keys, map[refKey]reflect.Value{}}
+}
+
+type decoderFunc func(v types.Value, rv reflect.Value, state *decodeState)
+
+func typeDecoder(t reflect.Type, opt Options) decoderFunc {
 	switch t.Kind() {
 	case reflect.Bool:
 		return boolDecoder
@@ -117,20 +152,22 @@ func typeDecoder(t reflect.Type) decoderFunc {
 	case reflect.String:
 		return stringDecoder
 	case reflect.Struct:
-		return structDecoder(t)
+		return structDecoder(t, opt)
 	case reflect.Interface:
-		return interfaceDecoder(t)
+		return interfaceDecoder(t, opt)
 	case reflect.Slice:
-		return sliceDecoder(t)
+		return sliceDecoder(t, opt)
 	case reflect.Array:
-		return arrayDecoder(t)
+		return arrayDecoder(t, opt)
 	case reflect.Map:
-		return mapDecoder(t)
+		return mapDecoder(t, opt)
+	case reflect.Ptr:
+		return ptrDecoder(t, opt)
 	default:
 		panic(&UnsupportedTypeError{Type: t})
 	}
 }
-func boolDecoder(v types.Value, rv reflect.Value) {
+func boolDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if b, ok := v.(types.Bool); ok {
 		rv.SetBool(bool(b))
 	} else {
@@ -138,7 +175,7 @@ func boolDecoder(v types.Value, rv reflect.Value) {
 	}
 }
 
-func stringDecoder(v types.Value, rv reflect.Value) {
+func stringDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if s, ok := v.(types.String); ok {
 		rv.SetString(string(s))
 	} else {
@@ -146,7 +183,7 @@ func stringDecoder(v types.Value, rv reflect.Value) {
 	}
 }
 
-func floatDecoder(v types.Value, rv reflect.Value) {
+func floatDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if n, ok := v.(types.Number); ok {
 		rv.SetFloat(float64(n))
 	} else {
@@ -154,7 +191,7 @@ func floatDecoder(v types.Value, rv reflect.Value) {
 	}
 }
 
-func intDecoder(v types.Value, rv reflect.Value) {
+func intDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if n, ok := v.(types.Number); ok {
 		i := int64(n)
 		if rv.OverflowInt(i) {
@@ -166,7 +203,7 @@ func intDecoder(v types.Value, rv reflect.Value) {
 	}
 }
 
-func uintDecoder(v types.Value, rv reflect.Value) {
+func uintDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if n, ok := v.(types.Number); ok {
 		u := uint64(n)
 		if rv.OverflowUint(u) {
@@ -180,61 +217,76 @@ func uintDecoder(v types.Value, rv reflect.Value) {
 
 type decoderCacheT struct {
 	sync.RWMutex
-	m map[reflect.Type]decoderFunc
+	m map[cacheKey]decoderFunc
 }
 
 var decoderCache = &decoderCacheT{}
 
-func (c *decoderCacheT) get(t reflect.Type) decoderFunc {
+func (c *decoderCacheT) get(t reflect.Type, opt Options) decoderFunc {
 	c.RLock()
 	defer c.RUnlock()
-	return c.m[t]
+	return c.m[cacheKey{t, opt}]
 }
 
-func (c *decoderCacheT) set(t reflect.Type, d decoderFunc) {
+func (c *decoderCacheT) set(t reflect.Type, opt Options, d decoderFunc) {
 	c.Lock()
 	defer c.Unlock()
 	if c.m == nil {
-		c.m = map[reflect.Type]decoderFunc{}
+		c.m = map[cacheKey]decoderFunc{}
 	}
-	c.m[t] = d
+	c.m[cacheKey{t, opt}] = d
 }
 
 type decField struct {
-	name    string
-	decoder decoderFunc
-	index   int
+	name      string
+	decoder   decoderFunc
+	index     int
+	omitEmpty bool
 }
 
-func structDecoder(t reflect.Type) decoderFunc {
+func structDecoder(t reflect.Type, opt Options) decoderFunc {
 	if t.Implements(nomsValueInterface) {
 		return nomsValueDecoder
 	}
 
-	d := decoderCache.get(t)
+	d := decoderCache.get(t, opt)
 	if d != nil {
 		return d
 	}
 
 	name := t.Name()
 	fields := make([]decField, 0, t.NumField())
+	originalIndex := -1
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		validateField(f, t)
 
-		tags := f.Tag.Get("noms")
-		if tags == "-" {
+		tags := getTags(f)
+		if tags.skip {
+			continue
+		}
+		if tags.original {
+			if originalIndex >= 0 {
+				panic(&InvalidTagError{"Only one field of " + t.Name() + " can be its original"})
+			}
+			originalIndex = i
 			continue
 		}
 
+		name := getFieldName(tags.name, f, opt.FieldCase)
+		decoder := typeDecoder(f.Type, opt)
+		if tags.encrypted {
+			decoder = decryptedDecoder(name, decoder)
+		}
 		fields = append(fields, decField{
-			name:    getFieldName(tags, f),
-			decoder: typeDecoder(f.Type),
-			index:   i,
+			name:      name,
+			decoder:   decoder,
+			index:     i,
+			omitEmpty: tags.omitEmpty,
 		})
 	}
 
-	d = func(v types.Value, rv reflect.Value) {
+	d = func(v types.Value, rv reflect.Value, state *decodeState) {
 		s, ok := v.(types.Struct)
 		if !ok {
 			panic(&UnmarshalTypeMismatchError{v, rv.Type(), ", expected struct"})
@@ -248,32 +300,57 @@ func structDecoder(t reflect.Type) decoderFunc {
 			sf := rv.Field(f.index)
 			fv, ok := s.MaybeGet(f.name)
 			if !ok {
+				if f.omitEmpty {
+					sf.Set(reflect.Zero(sf.Type()))
+					continue
+				}
 				panic(&UnmarshalTypeMismatchError{v, rv.Type(), ", missing field \"" + f.name + "\""})
 			}
-			f.decoder(fv, sf)
+			f.decoder(fv, sf, state)
+		}
+		if originalIndex >= 0 {
+			rv.Field(originalIndex).Set(reflect.ValueOf(s))
 		}
 	}
 
-	decoderCache.set(t, d)
+	decoderCache.set(t, opt, d)
 	return d
 }
 
-func nomsValueDecoder(v types.Value, rv reflect.Value) {
+// decryptedDecoder returns a decoder of the field |name| that decrypts the Encrypted it's given, and decodes what that's the encryption of with |d|.
+func decryptedDecoder(name string, d decoderFunc) decoderFunc {
+	return func(v types.Value, rv reflect.Value, state *decodeState) {
+		e, ok := v.(types.Encrypted)
+		if !ok {
+			panic(&UnmarshalTypeMismatchError{v, rv.Type(), ", expected Encrypted"})
+		}
+		if state.keys == nil {
+			panic(&EncryptionError{name, errNoKeys})
+		}
+		decrypted, err := e.Decrypt(state.keys)
+		if err != nil {
+			panic(&EncryptionError{name, err})
+		}
+		d(decrypted, rv, state)
+	}
+}
+
+func nomsValueDecoder(v types.Value, rv reflect.Value, state *decodeState) {
 	if !reflect.TypeOf(v).AssignableTo(rv.Type()) {
 		panic(&UnmarshalTypeMismatchError{v, rv.Type(), ""})
 	}
 	rv.Set(reflect.ValueOf(v))
 }
 
-func sliceDecoder(t reflect.Type) decoderFunc {
-	d := decoderCache.get(t)
+func sliceDecoder(t reflect.Type, opt Options) decoderFunc {
+	d := decoderCache.get(t, opt)
 	if d != nil {
 		return d
 	}
 
 	var decoder decoderFunc
 
-	d = func(v types.Value, rv reflect.Value) {
+	d = func(v types.Value, rv reflect.Value, state *decodeState) {
 		list, ok := v.(types.List)
 		if !ok {
 			panic(&UnmarshalTypeMismatchError{v, t, ""})
@@ -286,26 +363,26 @@ func sliceDecoder(t reflect.Type) decoderFunc {
 		}
 		list.IterAll(func(v types.Value, i uint64) {
 			elemRv := reflect.New(t.Elem()).Elem()
-			decoder(v, elemRv)
+			decoder(v, elemRv, state)
 			slice = reflect.Append(slice, elemRv)
 		})
 		rv.Set(slice)
 	}
 
-	decoderCache.set(t, d)
-	decoder = typeDecoder(t.Elem())
+	decoderCache.set(t, opt, d)
+	decoder = typeDecoder(t.Elem(), opt)
 	return d
 }
 
-func arrayDecoder(t reflect.Type) decoderFunc {
-	d := decoderCache.get(t)
+func arrayDecoder(t reflect.Type, opt Options) decoderFunc {
+	d := decoderCache.get(t, opt)
 	if d != nil {
 		return d
 	}
 
 	var decoder decoderFunc
 
-	d = func(v types.Value, rv reflect.Value) {
+	d = func(v types.Value, rv reflect.Value, state *decodeState) {
 		size := t.Len()
 		list, ok := v.(types.List)
 		if !ok {
@@ -317,17 +394,17 @@ func arrayDecoder(t reflect.Type) decoderFunc {
 			panic(&UnmarshalTypeMismatchError{v, t, ", length does not match"})
 		}
 		list.IterAll(func(v types.Value, i uint64) {
-			decoder(v, rv.Index(int(i)))
+			decoder(v, rv.Index(int(i)), state)
 		})
 	}
 
-	decoderCache.set(t, d)
-	decoder = typeDecoder(t.Elem())
+	decoderCache.set(t, opt, d)
+	decoder = typeDecoder(t.Elem(), opt)
 	return d
 }
 
-func mapDecoder(t reflect.Type) decoderFunc {
-	d := decoderCache.get(t)
+func mapDecoder(t reflect.Type, opt Options) decoderFunc {
+	d := decoderCache.get(t, opt)
 	if d != nil {
 		return d
 	}
@@ -335,7 +412,7 @@ func mapDecoder(t reflect.Type) decoderFunc {
 	var keyDecoder decoderFunc
 	var valueDecoder decoderFunc
 
-	d = func(v types.Value, rv reflect.Value) {
+	d = func(v types.Value, rv reflect.Value, state *decodeState) {
 		m := rv
 		if m.IsNil() {
 			m = reflect.MakeMap(t)
@@ -348,33 +425,41 @@ func mapDecoder(t reflect.Type) decoderFunc {
 
 		nomsMap.IterAll(func(k, v types.Value) {
 			keyRv := reflect.New(t.Key()).Elem()
-			keyDecoder(k, keyRv)
+			keyDecoder(k, keyRv, state)
 			valueRv := reflect.New(t.Elem()).Elem()
-			valueDecoder(v, valueRv)
+			valueDecoder(v, valueRv, state)
 			m.SetMapIndex(keyRv, valueRv)
 		})
 		rv.Set(m)
 	}
 
-	decoderCache.set(t, d)
-	keyDecoder = typeDecoder(t.Key())
-	valueDecoder = typeDecoder(t.Elem())
+	decoderCache.set(t, opt, d)
+	keyDecoder = typeDecoder(t.Key(), opt)
+	valueDecoder = typeDecoder(t.Elem(), opt)
 	return d
 }
 
-func interfaceDecoder(t reflect.Type) decoderFunc {
+func interfaceDecoder(t reflect.Type, opt Options) decoderFunc {
 	if t.Implements(nomsValueInterface) {
 		return nomsValueDecoder
 	}
 
-	if t != emptyInterface {
-		panic(&UnsupportedTypeError{Type: t})
-	}
-
-	return func(v types.Value, rv reflect.Value) {
-		t := getGoTypeForNomsType(v.Type(), rv.Type(), v)
+	return func(v types.Value, rv reflect.Value, state *decodeState) {
+		var t reflect.Type
+		if s, ok := v.(types.Struct); ok {
+			t = registeredType(s.Type().Desc.(types.StructDesc).Name)
+		}
+		if t != nil {
+			if !t.AssignableTo(rv.Type()) {
+				panic(&UnmarshalTypeMismatchError{v, rv.Type(), ", registered type " + t.String() + " does not implement it"})
+			}
+		} else if rv.Type() == emptyInterface {
+			t = getGoTypeForNomsType(v.Type(), rv.Type(), v)
+		} else {
+			panic(&UnmarshalTypeMismatchError{v, rv.Type(), ""})
+		}
 		i := reflect.New(t).Elem()
-		typeDecoder(t)(v, i)
+		typeDecoder(t, opt)(v, i, state)
 		rv.Set(i)
 	}
 }
@@ -394,6 +479,12 @@ func getGoTypeForNomsType(nt *types.Type, rt reflect.Type, v types.Value) reflec
 		kt := getGoTypeForNomsType(nt.Desc.(types.CompoundDesc).ElemTypes[0], rt, v)
 		vt := getGoTypeForNomsType(nt.Desc.(types.CompoundDesc).ElemTypes[1], rt, v)
 		return reflect.MapOf(kt, vt)
+	case types.StructKind:
+		// Structs of registered types are unmarshaled onto interface{} as those types.
+		if registeredType(nt.Desc.(types.StructDesc).Name) != nil {
+			return emptyInterface
+		}
+		panic(&UnmarshalTypeMismatchError{Value: v, Type: rt})
 	case types.UnionKind:
 		// Visit union types to raise potential errors
 		for _, ut := range nt.Desc.(types.CompoundDesc).ElemTypes {
@@ -406,3 +497,43 @@ func getGoTypeForNomsType(nt *types.Type, rt reflect.Type, v types.Value) reflec
 		panic(&UnmarshalTypeMismatchError{Value: v, Type: rt})
 	}
 }
+
+func ptrDecoder(t reflect.Type, opt Options) decoderFunc {
+	d := decoderCache.get(t, opt)
+	if d != nil {
+		return d
+	}
+
+	var decoder decoderFunc
+
+	d = func(v types.Value, rv reflect.Value, state *decodeState) {
+		r, ok := v.(types.Ref)
+		if !ok || reflect.TypeOf(v).AssignableTo(t.Elem()) {
+			p := reflect.New(t.Elem())
+			decoder(v, p.Elem(), state)
+			rv.Set(p)
+			return
+		}
+
+		key := refKey{r.TargetHash(), t}
+		if p, ok := state.pointers[key]; ok {
+			rv.Set(p)
+			return
+		}
+		if state.vr == nil {
+			panic(&UnmarshalTypeMismatchError{v, t, ", there's no VRW in the Options to read its target from"})
+		}
+		target := state.vr.ReadValue(r.TargetHash())
+		if target == nil {
+			panic(&UnmarshalTypeMismatchError{v, t, ", its target is missing"})
+		}
+		p := reflect.New(t.Elem())
+		decoder(target, p.Elem(), state)
+		state.pointers[key] = p
+		rv.Set(p)
+	}
+
+	decoderCache.set(t, opt, d)
+	decoder = typeDecoder(t.Elem(), opt)
+	return d
+}
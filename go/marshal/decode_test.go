@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/types"
 	"github.com/attic-labs/testify/assert"
 )
@@ -243,17 +244,17 @@ func TestDecodeInvalidTypes(tt *testing.T) {
 		assertDecodeErrorMessage(tt, types.Number(42), p, "Type is not supported, type: "+ts)
 	}
 
-	var ptr *bool
-	t(&ptr, "*bool")
+	var ptr *complex64
+	t(&ptr, "complex64")
 
 	var c chan bool
 	t(&c, "chan bool")
 
 	type Nested struct {
-		X *bool
+		X *complex128
 	}
 	var n Nested
-	t(&n, "*bool")
+	t(&n, "complex128")
 }
 
 func TestDecodeOverflows(tt *testing.T) {
@@ -605,7 +606,7 @@ func TestDecodeOntoNonSupportedInterface(t *testing.T) {
 		M() int
 	}
 	var i I
-	assertDecodeErrorMessage(t, types.Number(1), &i, "Type is not supported, type: marshal.I")
+	assertDecodeErrorMessage(t, types.Number(1), &i, "Cannot unmarshal Number into Go value of type marshal.I")
 }
 
 func TestDecodeOntoInterfaceStruct(t *testing.T) {
@@ -613,3 +614,118 @@ func TestDecodeOntoInterfaceStruct(t *testing.T) {
 	var i interface{}
 	assertDecodeErrorMessage(t, types.NewStruct("", types.StructData{}), &i, "Cannot unmarshal struct {} into Go value of type interface {}")
 }
+
+func TestDecodeOmitEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	type S struct {
+		A int    `noms:",omitempty"`
+		B string `noms:"bee,omitempty"`
+		C []int  `noms:",omitempty"`
+	}
+	// Fields that can be omitted are zeroed if they're missing.
+	s := S{1, "b", []int{1}}
+	assert.NoError(Unmarshal(types.NewStruct("S", types.StructData{"a": types.Number(2)}), &s))
+	assert.Equal(S{A: 2}, s)
+
+	assert.NoError(Unmarshal(types.NewStruct("S", types.StructData{"bee": types.String("x"), "c": types.NewList(types.Number(3))}), &s))
+	assert.Equal(S{0, "x", []int{3}}, s)
+}
+
+func TestDecodeOriginal(t *testing.T) {
+	assert := assert.New(t)
+
+	type S struct {
+		A        int
+		Original types.Struct `noms:",original"`
+	}
+	v := types.NewStruct("S", types.StructData{"a": types.Number(1), "b": types.String("extra")})
+	var s S
+	assert.NoError(Unmarshal(v, &s))
+	assert.Equal(1, s.A)
+	assert.True(v.Equals(s.Original))
+
+	// Values round trip, even with fields the Go struct doesn't have.
+	v2, err := Marshal(s)
+	assert.NoError(err)
+	assert.True(v.Equals(v2))
+}
+
+func TestDecodePointers(t *testing.T) {
+	assert := assert.New(t)
+
+	type Node struct {
+		Value string
+		Left  *Node `noms:",omitempty"`
+		Right *Node `noms:",omitempty"`
+	}
+	vs := types.NewTestValueStore()
+	shared := &Node{Value: "shared"}
+	root := &Node{"root", &Node{"left", shared, nil}, shared}
+	v, err := MarshalOpt(root, Options{VRW: vs})
+	assert.NoError(err)
+
+	var out *Node
+	assert.NoError(UnmarshalOpt(v, &out, Options{VRW: vs}))
+	assert.Equal(root, out)
+	// What was shared is shared again.
+	assert.True(out.Left.Left == out.Right)
+
+	// Without a VRW, the targets of Refs can't be read.
+	assertDecodeErrorMessage(t, v, &out, fmt.Sprintf("Cannot unmarshal %s into Go value of type *marshal.Node, there's no VRW in the Options to read its target from", v.Type().Describe()))
+
+	// Values that aren't Refs are unmarshaled into new values.
+	var n *int
+	assert.NoError(Unmarshal(types.Number(42), &n))
+	assert.Equal(42, *n)
+
+	// Refs can still be unmarshaled into pointers to Refs.
+	r := types.NewRef(types.Number(42))
+	var pr *types.Ref
+	assert.NoError(Unmarshal(r, &pr))
+	assert.True(r.Equals(*pr))
+}
+
+func TestDecodeEncrypted(t *testing.T) {
+	assert := assert.New(t)
+
+	type Card struct {
+		Number string
+		Expiry string
+	}
+	type Customer struct {
+		Name  string
+		Card  Card     `noms:",encrypted"`
+		Notes []string `noms:",encrypted,omitempty"`
+	}
+	keys := chunks.StaticKeyProvider{7: bytes.Repeat([]byte{7}, 32)}
+	c := Customer{"Alice", Card{"4111 1111 1111 1111", "12/20"}, []string{"VIP"}}
+	v, err := MarshalOpt(c, Options{Keys: keys})
+	assert.NoError(err)
+	s := v.(types.Struct)
+	assert.Equal(types.String("Alice"), s.Get("name"))
+	card, ok := s.Get("card").(types.Encrypted)
+	assert.True(ok)
+	assert.Equal(uint32(7), card.KeyID())
+	assert.False(bytes.Contains(types.EncodeValue(v, nil).Data(), []byte("4111")))
+	nt, err := MarshalType(reflect.TypeOf(c))
+	assert.NoError(err)
+	assert.True(types.EncryptedType.Equals(nt.Desc.(types.StructDesc).Field("card")))
+
+	var out Customer
+	assert.NoError(UnmarshalOpt(v, &out, Options{Keys: keys, Validate: true}))
+	assert.Equal(c, out)
+
+	// Without the key, encrypted fields can't be marshaled or unmarshaled.
+	_, err = Marshal(c)
+	assert.Equal("Field card can't be encrypted or decrypted: there are no Keys in the Options", err.Error())
+	err = UnmarshalOpt(v, &out, Options{Keys: chunks.StaticKeyProvider{8: bytes.Repeat([]byte{8}, 32)}})
+	assert.IsType(&EncryptionError{}, err)
+
+	// Fields that aren't encrypted don't match encrypted ones.
+	plain, err := Marshal(Card{})
+	assert.NoError(err)
+	assertDecodeErrorMessage(t, types.NewStruct("Customer", types.StructData{"name": types.String("Bob"), "card": plain}), &out, "Cannot unmarshal struct Card {\n  expiry: String,\n  number: String,\n} into Go value of type marshal.Card, expected Encrypted")
+	err = UnmarshalOpt(types.NewStruct("Customer", types.StructData{"name": types.String("Bob"), "card": plain}), &out, Options{Keys: keys, Validate: true})
+	assert.IsType(&TypeMismatchError{}, err)
+}
@@ -6,12 +6,14 @@
 package marshal
 
 import (
+	"errors"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
 	"unicode"
 
+	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/types"
 )
 
@@ -32,7 +34,7 @@ import (
 // Struct values are encoded as Noms structs (types.Struct). Each exported Go struct field becomes a member of the Noms struct unless
 //   - the field's tag is "-"
 // The Noms struct default field name is the Go struct field name where the first character is lower cased,
-// but can be specified in the Go struct field's tag value. The "noms" key in
+// or as the FieldCase of MarshalOpt says, but can be specified in the Go struct field's tag value. The "noms" key in
 // the Go struct field's tag value is the field name. Examples:
 //
 //   // Field is ignored.
@@ -44,7 +46,27 @@ import (
 //   // Field appears in a Noms struct as key "myName".
 //   Field int `noms:"myName"`
 //
-// Unlike encoding/json Marshal, this does not support "omitempty".
+// The tag's value can be followed by options, separated by commas. With "omitempty", the field is left out of the Noms struct if it has an empty value: false, 0, "", or a nil or empty slice, map or interface. Examples:
+//
+//   // Field appears in a Noms struct as field "myName", unless it's 0.
+//   MyName int `noms:",omitempty"`
+//
+//   // Field appears in a Noms struct as field "name", unless it's "".
+//   Field string `noms:"name,omitempty"`
+//
+// A field of type types.Struct tagged with "original" isn't encoded as a field. Instead, it's the Noms struct the Go struct was unmarshaled from, if it was, and the fields of the Go struct are written over it, so the Noms struct keeps any fields the Go struct doesn't have. This lets Go code read, change and write back structs without losing fields that newer versions of it, or other programs, have added. Example:
+//
+//   type Person struct {
+//     Name     string
+//     Original types.Struct `noms:",original"`
+//   }
+//
+// A field tagged with "encrypted" is encoded as a types.Encrypted of what it would otherwise be encoded as, encrypted with the current key of the Keys in MarshalOpt's Options, so that sensitive fields can be kept in a database that others can read. Unmarshal decrypts it with the same Keys. The field's value can't refer to other values. Example:
+//
+//   type Customer struct {
+//     Name string
+//     Card string `noms:",encrypted"`
+//   }
 //
 // The name of the Noms struct is the name of the Go struct where the first character is changed to upper case.
 //
@@ -56,13 +78,20 @@ import (
 //
 // When marshalling `interface{}` the dynamic type is used.
 //
-// Go pointers, complex, function are not supported. Attempting to encode such a value causes Marshal to return an UnsupportedTypeError.
+// Go pointers are encoded as the values they point to, unless MarshalOpt is given a VRW in its Options, in which case those values are written to it and the pointers are encoded as Refs to them, so that pointers let a Go struct refer to others of its own type, and values that several pointers share aren't encoded more than once. Nil pointers aren't supported, unless they're in fields tagged "omitempty", and nor are cycles of pointers, since a Noms value can't refer to itself.
+//
+// Go complex and function values are not supported. Attempting to encode such a value causes Marshal to return an UnsupportedTypeError.
 //
-func Marshal(v interface{}) (nomsValue types.Value, err error) {
+func Marshal(v interface{}) (types.Value, error) {
+	return MarshalOpt(v, Options{})
+}
+
+// MarshalOpt is like Marshal, but maps Go values to Noms values as |opt| says.
+func MarshalOpt(v interface{}, opt Options) (nomsValue types.Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			switch r.(type) {
-			case *UnsupportedTypeError, *InvalidTagError:
+			case *UnsupportedTypeError, *InvalidTagError, *EncryptionError:
 				err = r.(error)
 				return
 			}
@@ -70,11 +99,42 @@ func Marshal(v interface{}) (nomsValue types.Value, err error) {
 		}
 	}()
 	rv := reflect.ValueOf(v)
-	encoder := typeEncoder(rv.Type(), nil)
-	nomsValue = encoder(rv)
+	encoder := typeEncoder(rv.Type(), nil, opt.typeOptions())
+	nomsValue = encoder(rv, newEncodeState(opt))
 	return
 }
 
+// Options change how MarshalOpt and UnmarshalOpt map between Go and Noms values. Values should be unmarshaled with the Options they were marshaled with.
+type Options struct {
+	// FieldCase is how the names of Go struct fields become the names of Noms struct fields, unless their tags name them.
+	FieldCase FieldCase
+	// VRW is where MarshalOpt writes the values that Go pointers point to, encoding the pointers as Refs to them, and where UnmarshalOpt reads the targets of the Refs it unmarshals into Go pointers. Without it, pointers are encoded as the values they point to.
+	VRW types.ValueReadWriter
+	// MaxInlineBytes is how big the values that Go pointers point to can be, once encoded, and still be encoded in place of the pointers rather than as Refs, since small values take less space than Refs to them would. With the default of 0, every pointer is encoded as a Ref. It only matters if there's a VRW.
+	MaxInlineBytes uint64
+	// Validate makes UnmarshalOpt check that the type of the Noms value matches the Go value before it unmarshals any of it, so that it unmarshals all of the value or, returning a TypeMismatchError saying where the types differ, none of it.
+	Validate bool
+	// Keys are what fields tagged "encrypted" are encrypted with by MarshalOpt, with the current key, and decrypted with by UnmarshalOpt, with the key they were encrypted with.
+	Keys chunks.KeyProvider
+}
+
+// typeOptions returns the Options that decide how Go types map to Noms types, leaving out those that only matter to the values being marshaled, so that encoders and decoders can be cached by them.
+func (opt Options) typeOptions() Options {
+	return Options{FieldCase: opt.FieldCase}
+}
+
+// FieldCase is a way of naming Noms struct fields after Go struct fields.
+type FieldCase int
+
+const (
+	// LowerCamelCase lower cases the first character of the Go name, so MyName becomes myName. It's the default.
+	LowerCamelCase FieldCase = iota
+	// UpperCamelCase uses the Go name as it is, so MyName stays MyName.
+	UpperCamelCase
+	// SnakeCase lower cases the Go name, separating its words with underscores, so MyName becomes my_name, and HTTPServer becomes http_server.
+	SnakeCase
+)
+
 // UnsupportedTypeError is returned by encode when attempting to encode a type that isn't supported.
 type UnsupportedTypeError struct {
 	Type    reflect.Type
@@ -98,36 +158,82 @@ func (e *InvalidTagError) Error() string {
 	return e.message
 }
 
+// EncryptionError is returned by encode and decode when a field tagged "encrypted" can't be encrypted or decrypted, e.g. because there are no Keys in the Options, or they don't have the key it was encrypted with.
+type EncryptionError struct {
+	Field string
+	Err   error
+}
+
+func (e *EncryptionError) Error() string {
+	return "Field " + e.Field + " can't be encrypted or decrypted: " + e.Err.Error()
+}
+
+var errNoKeys = errors.New("there are no Keys in the Options")
+
 var nomsValueInterface = reflect.TypeOf((*types.Value)(nil)).Elem()
 var emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+var nomsStructType = reflect.TypeOf(types.Struct{})
+
+// encodeState is the state of a call to MarshalOpt, which is needed to encode pointers.
+type encodeState struct {
+	vrw            types.ValueReadWriter
+	maxInlineBytes uint64
+	keys           chunks.KeyProvider
+	// pointers maps the pointers that have been encoded to what they were encoded as, or to nil while they're being encoded, so that cycles are found.
+	pointers map[pointerKey]types.Value
+}
+
+// pointerKey identifies a Go pointer. The type is needed because a struct and its first field have the same address.
+type pointerKey struct {
+	p uintptr
+	t reflect.Type
+}
 
-type encoderFunc func(v reflect.Value) types.Value
+func newEncodeState(opt Options) *encodeState {
+	return &encodeState{opt.VRW, opt.MaxInlineBytes, opt.Keys, map[pointerKey]types.Value{}}
+}
+
+type encoderFunc func(v reflect.Value, state *encodeState) types.Value
 
-func boolEncoder(v reflect.Value) types.Value {
+func boolEncoder(v reflect.Value, state *encodeState) types.Value {
 	return types.Bool(v.Bool())
 }
 
-func float64Encoder(v reflect.Value) types.Value {
+func float64Encoder(v reflect.Value, state *encodeState) types.Value {
 	return types.Number(v.Float())
 }
 
-func intEncoder(v reflect.Value) types.Value {
+func intEncoder(v reflect.Value, state *encodeState) types.Value {
 
 	return types.Number(float64(v.Int()))
 }
-func uintEncoder(v reflect.Value) types.Value {
+func uintEncoder(v reflect.Value, state *encodeState) types.Value {
 	return types.Number(float64(v.Uint()))
 }
 
-func stringEncoder(v reflect.Value) types.Value {
+func stringEncoder(v reflect.Value, state *encodeState) types.Value {
 	return types.String(v.String())
 }
 
-func nomsValueEncoder(v reflect.Value) types.Value {
+func nomsValueEncoder(v reflect.Value, state *encodeState) types.Value {
 	return v.Interface().(types.Value)
 }
 
-func typeEncoder(t reflect.Type, parentStructTypes []reflect.Type) encoderFunc {
+// encryptedEncoder returns an encoder of the field |name| that encrypts what |e| encodes it as.
+func encryptedEncoder(name string, e encoderFunc) encoderFunc {
+	return func(v reflect.Value, state *encodeState) types.Value {
+		if state.keys == nil {
+			panic(&EncryptionError{name, errNoKeys})
+		}
+		encrypted, err := types.Encrypt(e(v, state), state.keys)
+		if err != nil {
+			panic(&EncryptionError{name, err})
+		}
+		return encrypted
+	}
+}
+
+func typeEncoder(t reflect.Type, parentStructTypes []reflect.Type, opt Options) encoderFunc {
 	switch t.Kind() {
 	case reflect.Bool:
 		return boolEncoder
@@ -140,63 +246,99 @@ func typeEncoder(t reflect.Type, parentStructTypes []reflect.Type) encoderFunc {
 	case reflect.String:
 		return stringEncoder
 	case reflect.Struct:
-		return structEncoder(t, parentStructTypes)
+		return structEncoder(t, parentStructTypes, opt)
 	case reflect.Slice, reflect.Array:
-		return listEncoder(t, parentStructTypes)
+		return listEncoder(t, parentStructTypes, opt)
 	case reflect.Map:
-		return mapEncoder(t, parentStructTypes)
+		return mapEncoder(t, parentStructTypes, opt)
+	case reflect.Ptr:
+		return ptrEncoder(t, parentStructTypes, opt)
 	case reflect.Interface:
-		return func(v reflect.Value) types.Value {
+		return func(v reflect.Value, state *encodeState) types.Value {
 			// Get the dynamic type.
 			v2 := reflect.ValueOf(v.Interface())
-			return typeEncoder(v2.Type(), parentStructTypes)(v2)
+			return typeEncoder(v2.Type(), parentStructTypes, opt)(v2, state)
 		}
 	default:
 		panic(&UnsupportedTypeError{Type: t})
 	}
 }
 
-func structEncoder(t reflect.Type, parentStructTypes []reflect.Type) encoderFunc {
+func structEncoder(t reflect.Type, parentStructTypes []reflect.Type, opt Options) encoderFunc {
 	if t.Implements(nomsValueInterface) {
 		return nomsValueEncoder
 	}
 
-	e := encoderCache.get(t)
+	e := encoderCache.get(t, opt)
 	if e != nil {
 		return e
 	}
 
 	parentStructTypes = append(parentStructTypes, t)
-	fields, structType := typeFields(t, parentStructTypes)
+	fields, structType, originalIndex := typeFields(t, parentStructTypes, opt)
 	if structType != nil {
-		e = func(v reflect.Value) types.Value {
+		e = func(v reflect.Value, state *encodeState) types.Value {
 			values := make([]types.Value, len(fields))
 			for i, f := range fields {
-				values[i] = f.encoder(v.Field(f.index))
+				values[i] = f.encoder(v.Field(f.index), state)
 			}
 			return types.NewStructWithType(structType, values)
 		}
 	} else {
-		// Cannot precompute the Noms type since there are Noms collections.
+		// Cannot precompute the Noms type since there are Noms collections, fields that can be omitted, or an original struct.
 		name := strings.Title(t.Name())
-		e = func(v reflect.Value) types.Value {
+		e = func(v reflect.Value, state *encodeState) types.Value {
 			data := make(types.StructData, len(fields))
+			structName := name
+			if originalIndex >= 0 {
+				if original := v.Field(originalIndex).Interface().(types.Struct); original.Type() != nil {
+					desc := original.Type().Desc.(types.StructDesc)
+					structName = desc.Name
+					desc.IterFields(func(name string, _ *types.Type) {
+						data[name] = original.Get(name)
+					})
+				}
+			}
 			for _, f := range fields {
-				data[f.name] = f.encoder(v.Field(f.index))
+				fv := v.Field(f.index)
+				if f.omitEmpty && isEmptyValue(fv) {
+					delete(data, f.name)
+					continue
+				}
+				data[f.name] = f.encoder(fv, state)
 			}
-			return types.NewStruct(name, data)
+			return types.NewStruct(structName, data)
 		}
 	}
 
-	encoderCache.set(t, e)
+	encoderCache.set(t, opt, e)
 	return e
 }
 
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
 type field struct {
-	name     string
-	encoder  encoderFunc
-	index    int
-	nomsType *types.Type
+	name      string
+	encoder   encoderFunc
+	index     int
+	nomsType  *types.Type
+	omitEmpty bool
 }
 
 type fieldSlice []field
@@ -205,31 +347,79 @@ func (fs fieldSlice) Len() int           { return len(fs) }
 func (fs fieldSlice) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
 func (fs fieldSlice) Less(i, j int) bool { return fs[i].name < fs[j].name }
 
+// cacheKey is what encoders and decoders are cached by, since how a type is encoded and decoded depends on the Options.
+type cacheKey struct {
+	t   reflect.Type
+	opt Options
+}
+
 type encoderCacheT struct {
 	sync.RWMutex
-	m map[reflect.Type]encoderFunc
+	m map[cacheKey]encoderFunc
 }
 
 var encoderCache = &encoderCacheT{}
 
-func (c *encoderCacheT) get(t reflect.Type) encoderFunc {
+func (c *encoderCacheT) get(t reflect.Type, opt Options) encoderFunc {
 	c.RLock()
 	defer c.RUnlock()
-	return c.m[t]
+	return c.m[cacheKey{t, opt}]
 }
 
-func (c *encoderCacheT) set(t reflect.Type, e encoderFunc) {
+func (c *encoderCacheT) set(t reflect.Type, opt Options, e encoderFunc) {
 	c.Lock()
 	defer c.Unlock()
 	if c.m == nil {
-		c.m = map[reflect.Type]encoderFunc{}
+		c.m = map[cacheKey]encoderFunc{}
 	}
-	c.m[t] = e
+	c.m[cacheKey{t, opt}] = e
 }
 
-func getFieldName(fieldName string, f reflect.StructField) string {
+// nomsTags is what the "noms" tag of a struct field says.
+type nomsTags struct {
+	name      string
+	omitEmpty bool
+	original  bool
+	encrypted bool
+	skip      bool
+}
+
+func getTags(f reflect.StructField) (tags nomsTags) {
+	reflectTags := f.Tag.Get("noms")
+	if reflectTags == "-" {
+		tags.skip = true
+		return
+	}
+	tagsSlice := strings.Split(reflectTags, ",")
+	tags.name = tagsSlice[0]
+	for _, tag := range tagsSlice[1:] {
+		switch tag {
+		case "omitempty":
+			tags.omitEmpty = true
+		case "original":
+			if f.Type != nomsStructType {
+				panic(&InvalidTagError{"Original field " + f.Name + " must be a types.Struct"})
+			}
+			tags.original = true
+		case "encrypted":
+			tags.encrypted = true
+		default:
+			panic(&InvalidTagError{"Unrecognized tag: " + tag})
+		}
+	}
+	return
+}
+
+func getFieldName(fieldName string, f reflect.StructField, fc FieldCase) string {
 	if fieldName == "" {
-		fieldName = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		switch fc {
+		case UpperCamelCase:
+			fieldName = f.Name
+		case SnakeCase:
+			fieldName = snakeCase(f.Name)
+		default:
+			fieldName = strings.ToLower(f.Name[:1]) + f.Name[1:]
+		}
 	}
 	if !types.IsValidStructFieldName(fieldName) {
 		panic(&InvalidTagError{"Invalid struct field name: " + fieldName})
@@ -237,6 +427,26 @@ func getFieldName(fieldName string, f reflect.StructField) string {
 	return fieldName
 }
 
+// snakeCase lower cases |name|, putting underscores between its words, which start with upper case letters, or are acronyms, e.g. UserID becomes user_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	snake := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextIsLower {
+					snake = append(snake, '_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		snake = append(snake, r)
+	}
+	return string(snake)
+}
+
 func validateField(f reflect.StructField, t reflect.Type) {
 	if f.Anonymous {
 		panic(&UnsupportedTypeError{t, "Embedded structs are not supported"})
@@ -246,25 +456,42 @@ func validateField(f reflect.StructField, t reflect.Type) {
 	}
 }
 
-func typeFields(t reflect.Type, parentStructTypes []reflect.Type) (fields fieldSlice, structType *types.Type) {
+// typeFields returns the fields of |t| that are encoded, and if it can be worked out from |t|, the Noms type they're encoded as, and the index of its original field, or -1 if it doesn't have one.
+func typeFields(t reflect.Type, parentStructTypes []reflect.Type, opt Options) (fields fieldSlice, structType *types.Type, originalIndex int) {
 	canComputeStructType := true
+	originalIndex = -1
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		validateField(f, t)
-		nt := nomsType(f.Type, parentStructTypes)
-		if nt == nil {
-			canComputeStructType = false
+		tags := getTags(f)
+		if tags.skip {
+			continue
 		}
-		tags := f.Tag.Get("noms")
-		if tags == "-" {
+		if tags.original {
+			if originalIndex >= 0 {
+				panic(&InvalidTagError{"Only one field of " + t.Name() + " can be its original"})
+			}
+			originalIndex = i
+			canComputeStructType = false
 			continue
 		}
+		name := getFieldName(tags.name, f, opt.FieldCase)
+		nt := nomsType(f.Type, parentStructTypes, opt)
+		encoder := typeEncoder(f.Type, parentStructTypes, opt)
+		if tags.encrypted {
+			nt = types.EncryptedType
+			encoder = encryptedEncoder(name, encoder)
+		}
+		if nt == nil || tags.omitEmpty {
+			canComputeStructType = false
+		}
 
 		fields = append(fields, field{
-			name:     getFieldName(tags, f),
-			encoder:  typeEncoder(f.Type, parentStructTypes),
-			index:    i,
-			nomsType: nt,
+			name:      name,
+			encoder:   encoder,
+			index:     i,
+			nomsType:  nt,
+			omitEmpty: tags.omitEmpty,
 		})
 	}
 	sort.Sort(fields)
@@ -280,7 +507,7 @@ func typeFields(t reflect.Type, parentStructTypes []reflect.Type) (fields fieldS
 	return
 }
 
-func nomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Type {
+func nomsType(t reflect.Type, parentStructTypes []reflect.Type, opt Options) *types.Type {
 	switch t.Kind() {
 	case reflect.Bool:
 		return types.BoolType
@@ -289,9 +516,9 @@ func nomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Type {
 	case reflect.String:
 		return types.StringType
 	case reflect.Struct:
-		return structNomsType(t, parentStructTypes)
+		return structNomsType(t, parentStructTypes, opt)
 	case reflect.Array, reflect.Slice:
-		elemType := nomsType(t.Elem(), parentStructTypes)
+		elemType := nomsType(t.Elem(), parentStructTypes, opt)
 		if elemType != nil {
 			return types.MakeListType(elemType)
 		}
@@ -301,7 +528,7 @@ func nomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Type {
 }
 
 // structNomsType returns the Noms types.Type if it can be determined from the reflect.Type. Note that we can only determine the type for a subset of Noms types since the Go type does not fully reflect it. In this cases this returns nil and we have to wait until we have a value to be able to determine the type.
-func structNomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Type {
+func structNomsType(t reflect.Type, parentStructTypes []reflect.Type, opt Options) *types.Type {
 	if t.Implements(nomsValueInterface) {
 		// Use Name because List and Blob are convertible to each other on Go.
 		switch t.Name() {
@@ -309,6 +536,8 @@ func structNomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Typ
 			return types.BlobType
 		case "Bool":
 			return types.BoolType
+		case "Encrypted":
+			return types.EncryptedType
 		case "Number":
 			return types.NumberType
 		case "String":
@@ -324,50 +553,82 @@ func structNomsType(t reflect.Type, parentStructTypes []reflect.Type) *types.Typ
 		}
 	}
 
-	_, structType := typeFields(t, parentStructTypes)
+	_, structType, _ := typeFields(t, parentStructTypes, opt)
 	return structType
 }
 
-func listEncoder(t reflect.Type, parentStructTypes []reflect.Type) encoderFunc {
-	e := encoderCache.get(t)
+func listEncoder(t reflect.Type, parentStructTypes []reflect.Type, opt Options) encoderFunc {
+	e := encoderCache.get(t, opt)
 	if e != nil {
 		return e
 	}
 
 	var elemEncoder encoderFunc
-	e = func(v reflect.Value) types.Value {
+	e = func(v reflect.Value, state *encodeState) types.Value {
 		values := make([]types.Value, v.Len(), v.Len())
 		for i := 0; i < v.Len(); i++ {
-			values[i] = elemEncoder(v.Index(i))
+			values[i] = elemEncoder(v.Index(i), state)
 		}
 		return types.NewList(values...)
 	}
 
-	encoderCache.set(t, e)
-	elemEncoder = typeEncoder(t.Elem(), parentStructTypes)
+	encoderCache.set(t, opt, e)
+	elemEncoder = typeEncoder(t.Elem(), parentStructTypes, opt)
 	return e
 }
 
-func mapEncoder(t reflect.Type, parentStructTypes []reflect.Type) encoderFunc {
-	e := encoderCache.get(t)
+func mapEncoder(t reflect.Type, parentStructTypes []reflect.Type, opt Options) encoderFunc {
+	e := encoderCache.get(t, opt)
 	if e != nil {
 		return e
 	}
 
 	var keyEncoder encoderFunc
 	var valueEncoder encoderFunc
-	e = func(v reflect.Value) types.Value {
+	e = func(v reflect.Value, state *encodeState) types.Value {
 		keys := v.MapKeys()
 		kvs := make([]types.Value, 2*len(keys))
 		for i, k := range keys {
-			kvs[2*i] = keyEncoder(k)
-			kvs[2*i+1] = valueEncoder(v.MapIndex(k))
+			kvs[2*i] = keyEncoder(k, state)
+			kvs[2*i+1] = valueEncoder(v.MapIndex(k), state)
 		}
 		return types.NewMap(kvs...)
 	}
 
-	encoderCache.set(t, e)
-	keyEncoder = typeEncoder(t.Key(), parentStructTypes)
-	valueEncoder = typeEncoder(t.Elem(), parentStructTypes)
+	encoderCache.set(t, opt, e)
+	keyEncoder = typeEncoder(t.Key(), parentStructTypes, opt)
+	valueEncoder = typeEncoder(t.Elem(), parentStructTypes, opt)
+	return e
+}
+
+func ptrEncoder(t reflect.Type, parentStructTypes []reflect.Type, opt Options) encoderFunc {
+	e := encoderCache.get(t, opt)
+	if e != nil {
+		return e
+	}
+
+	var elemEncoder encoderFunc
+	e = func(v reflect.Value, state *encodeState) types.Value {
+		if v.IsNil() {
+			panic(&UnsupportedTypeError{t, "Nil pointers are not supported"})
+		}
+		key := pointerKey{v.Pointer(), t}
+		if nv, ok := state.pointers[key]; ok {
+			if nv == nil {
+				panic(&UnsupportedTypeError{t, "Cyclic pointers are not supported"})
+			}
+			return nv
+		}
+		state.pointers[key] = nil
+		nv := elemEncoder(v.Elem(), state)
+		if state.vrw != nil && (state.maxInlineBytes == 0 || uint64(len(types.EncodeValue(nv, nil).Data())) > state.maxInlineBytes) {
+			nv = state.vrw.WriteValue(nv)
+		}
+		state.pointers[key] = nv
+		return nv
+	}
+
+	encoderCache.set(t, opt, e)
+	elemEncoder = typeEncoder(t.Elem(), parentStructTypes, opt)
 	return e
 }
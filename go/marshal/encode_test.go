@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/stormasm/noms/go/types"
@@ -157,8 +158,8 @@ func assertEncodeErrorMessage(t *testing.T, v interface{}, expectedMessage strin
 
 func TestInvalidTypes(t *testing.T) {
 	assertEncodeErrorMessage(t, make(chan int), "Type is not supported, type: chan int")
-	x := 42
-	assertEncodeErrorMessage(t, &x, "Type is not supported, type: *int")
+	x := complex(1, 2)
+	assertEncodeErrorMessage(t, &x, "Type is not supported, type: complex128")
 }
 
 func TestEncodeEmbeddedStruct(t *testing.T) {
@@ -359,3 +360,188 @@ type TestInterface interface {
 type TestImpl int
 
 func (impl TestImpl) M() {}
+
+func TestEncodeOmitEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	type S struct {
+		String string            `noms:",omitempty"`
+		Bool   bool              `noms:",omitempty"`
+		Number float64           `noms:"n,omitempty"`
+		Int    int               `noms:",omitempty"`
+		Slice  []int             `noms:",omitempty"`
+		Map    map[string]string `noms:",omitempty"`
+		Value  types.Value       `noms:",omitempty"`
+		Always int
+	}
+	v, err := Marshal(S{})
+	assert.NoError(err)
+	assert.True(types.NewStruct("S", types.StructData{
+		"always": types.Number(0),
+	}).Equals(v))
+
+	v, err = Marshal(S{"a", true, 1.5, 2, []int{3}, map[string]string{"k": "v"}, types.String("x"), 4})
+	assert.NoError(err)
+	assert.True(types.NewStruct("S", types.StructData{
+		"string": types.String("a"),
+		"bool":   types.Bool(true),
+		"n":      types.Number(1.5),
+		"int":    types.Number(2),
+		"slice":  types.NewList(types.Number(3)),
+		"map":    types.NewMap(types.String("k"), types.String("v")),
+		"value":  types.String("x"),
+		"always": types.Number(4),
+	}).Equals(v))
+}
+
+func TestEncodeOriginal(t *testing.T) {
+	assert := assert.New(t)
+
+	type Person struct {
+		Name     string
+		Age      int          `noms:",omitempty"`
+		Original types.Struct `noms:",original"`
+	}
+	v, err := Marshal(Person{Name: "alice"})
+	assert.NoError(err)
+	assert.True(types.NewStruct("Person", types.StructData{"name": types.String("alice")}).Equals(v))
+
+	// The fields of the original struct that the Go struct doesn't have are kept, as is its name, and the Go struct's fields are written over it.
+	original := types.NewStruct("person", types.StructData{
+		"name":  types.String("bob"),
+		"age":   types.Number(30),
+		"email": types.String("bob@example.com"),
+	})
+	var p Person
+	assert.NoError(Unmarshal(original, &p))
+	assert.True(original.Equals(p.Original))
+	p.Name = "robert"
+	v, err = Marshal(p)
+	assert.NoError(err)
+	assert.True(original.Set("name", types.String("robert")).Equals(v))
+
+	// Fields that are empty and omitted are removed from it.
+	p.Age = 0
+	v, err = Marshal(p)
+	assert.NoError(err)
+	assert.True(types.NewStruct("person", types.StructData{
+		"name":  types.String("robert"),
+		"email": types.String("bob@example.com"),
+	}).Equals(v))
+}
+
+func TestEncodeFieldCase(t *testing.T) {
+	assert := assert.New(t)
+
+	type S struct {
+		MyName     string
+		HTTPServer string
+		UserID     int
+		Named      bool `noms:"named"`
+	}
+	s := S{"a", "b", 1, true}
+	for fc, names := range map[FieldCase][]string{
+		LowerCamelCase: {"myName", "hTTPServer", "userID"},
+		UpperCamelCase: {"MyName", "HTTPServer", "UserID"},
+		SnakeCase:      {"my_name", "http_server", "user_id"},
+	} {
+		exp := types.NewStruct("S", types.StructData{
+			names[0]: types.String("a"),
+			names[1]: types.String("b"),
+			names[2]: types.Number(1),
+			"named":  types.Bool(true),
+		})
+		v, err := MarshalOpt(s, Options{FieldCase: fc})
+		assert.NoError(err)
+		assert.True(exp.Equals(v))
+
+		var s2 S
+		assert.NoError(UnmarshalOpt(v, &s2, Options{FieldCase: fc}))
+		assert.Equal(s, s2)
+	}
+}
+
+func TestEncodeInvalidTags(t *testing.T) {
+	type S struct {
+		A int `noms:"a,omitempty,nope"`
+	}
+	assertEncodeErrorMessage(t, S{42}, "Unrecognized tag: nope")
+
+	type S2 struct {
+		A int `noms:",original"`
+	}
+	assertEncodeErrorMessage(t, S2{42}, "Original field A must be a types.Struct")
+
+	type S3 struct {
+		A types.Struct `noms:",original"`
+		B types.Struct `noms:",original"`
+	}
+	assertEncodeErrorMessage(t, S3{}, "Only one field of S3 can be its original")
+}
+
+func TestEncodePointers(t *testing.T) {
+	assert := assert.New(t)
+
+	type Inner struct {
+		N int
+	}
+	type S struct {
+		A *Inner
+		B *Inner
+		C *string `noms:",omitempty"`
+	}
+	// Without a VRW, pointers are encoded as what they point to.
+	in := &Inner{1}
+	v, err := Marshal(S{A: in, B: in})
+	assert.NoError(err)
+	inner := types.NewStruct("Inner", types.StructData{"n": types.Number(1)})
+	assert.True(types.NewStruct("S", types.StructData{"a": inner, "b": inner}).Equals(v))
+
+	str := "s"
+	v, err = Marshal(S{A: in, B: &Inner{2}, C: &str})
+	assert.NoError(err)
+	assert.True(types.NewStruct("S", types.StructData{
+		"a": inner,
+		"b": types.NewStruct("Inner", types.StructData{"n": types.Number(2)}),
+		"c": types.String("s"),
+	}).Equals(v))
+
+	assertEncodeErrorMessage(t, S{A: in}, "Nil pointers are not supported, type: *marshal.Inner")
+}
+
+func TestEncodePointersAsRefs(t *testing.T) {
+	assert := assert.New(t)
+
+	type Node struct {
+		Value string
+		Next  *Node `noms:",omitempty"`
+	}
+	vs := types.NewTestValueStore()
+	v, err := MarshalOpt(&Node{"a", &Node{"b", nil}}, Options{VRW: vs})
+	assert.NoError(err)
+
+	// Every pointer becomes a Ref, even the one Marshal is given.
+	r, ok := v.(types.Ref)
+	assert.True(ok)
+	a := vs.ReadValue(r.TargetHash()).(types.Struct)
+	assert.Equal(types.String("a"), a.Get("value"))
+	b := vs.ReadValue(a.Get("next").(types.Ref).TargetHash()).(types.Struct)
+	assert.True(types.NewStruct("Node", types.StructData{"value": types.String("b")}).Equals(b))
+
+	// With MaxInlineBytes, small values are encoded in place of the pointers to them.
+	v, err = MarshalOpt(Node{"a", &Node{"b", &Node{strings.Repeat("c", 200), nil}}}, Options{VRW: vs, MaxInlineBytes: 128})
+	assert.NoError(err)
+	b = v.(types.Struct).Get("next").(types.Struct)
+	assert.Equal(types.String("b"), b.Get("value"))
+	c := vs.ReadValue(b.Get("next").(types.Ref).TargetHash()).(types.Struct)
+	assert.Equal(types.String(strings.Repeat("c", 200)), c.Get("value"))
+}
+
+func TestEncodePointerCycle(t *testing.T) {
+	type Node struct {
+		Next *Node
+	}
+	n := &Node{}
+	n.Next = &Node{n}
+	assertEncodeErrorMessage(t, n, "Cyclic pointers are not supported, type: *marshal.Node")
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/stormasm/noms/go/d"
+)
+
+type registryT struct {
+	sync.RWMutex
+	m map[string]reflect.Type
+}
+
+var registry = &registryT{m: map[string]reflect.Type{}}
+
+// Register records the type of |value|, a Go struct or a pointer to one, so that Unmarshal can unmarshal Noms structs with the name Marshal gives it into interface values, such as the fields of Go structs whose types are interfaces, by making values of that type. This lets Go code unmarshal Noms values of union types, such as a List<Circle | Square>, into interfaces, such as a []Shape, which the types of the Go structs registered as Circle and Square implement. Register a pointer if it's the pointer that implements the interface.
+// Register is meant to be called when the program starts, as from an init function. It panics if another type is registered with the same name.
+func Register(value interface{}) {
+	t := reflect.TypeOf(value)
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	d.PanicIfFalse(st.Kind() == reflect.Struct, "Only structs and pointers to them can be registered, not %s", t)
+	RegisterName(strings.Title(st.Name()), value)
+}
+
+// RegisterName is like Register, but for Noms structs named |name|.
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	registry.Lock()
+	defer registry.Unlock()
+	if rt, ok := registry.m[name]; ok {
+		d.PanicIfFalse(rt == t, "Cannot register %s as %s, since %s is", t, name, rt)
+		return
+	}
+	registry.m[name] = t
+}
+
+// registeredType returns the Go type registered for Noms structs named |name|, or nil if there isn't one.
+func registeredType(name string) reflect.Type {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.m[name]
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+type shape interface {
+	area() float64
+}
+
+type circle struct {
+	R float64
+}
+
+func (c circle) area() float64 {
+	return 3 * c.R * c.R
+}
+
+type square struct {
+	Side float64
+}
+
+func (s *square) area() float64 {
+	return s.Side * s.Side
+}
+
+type drawing struct {
+	Shapes []shape
+	Main   shape
+}
+
+func init() {
+	Register(circle{})
+	Register(&square{})
+	RegisterName("NotAShape", drawing{})
+}
+
+func TestDecodeRegisteredTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	in := drawing{[]shape{circle{1}, &square{2}}, circle{3}}
+	v, err := Marshal(in)
+	assert.NoError(err)
+
+	var out drawing
+	assert.NoError(Unmarshal(v, &out))
+	assert.Equal(in, out)
+
+	assert.NoError(UnmarshalOpt(v, &out, Options{Validate: true}))
+	assert.Equal(in, out)
+
+	// Registered structs are unmarshaled onto interface{} too.
+	var i interface{}
+	assert.NoError(Unmarshal(v.(types.Struct).Get("shapes"), &i))
+	assert.Equal([]interface{}{circle{1}, &square{2}}, i)
+}
+
+func TestDecodeRegisteredTypesErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var s shape
+	assertDecodeErrorMessage(t, types.NewStruct("Hexagon", types.StructData{}), &s, "Cannot unmarshal struct Hexagon {} into Go value of type marshal.shape")
+	assertDecodeErrorMessage(t, types.NewStruct("NotAShape", types.StructData{}), &s, "Cannot unmarshal struct NotAShape {} into Go value of type marshal.shape, registered type marshal.drawing does not implement it")
+
+	err := UnmarshalOpt(types.NewList(types.NewStruct("Hexagon", types.StructData{})), &[]shape{}, Options{Validate: true})
+	assert.Equal("Cannot unmarshal struct Hexagon {} at [] into Go value of type marshal.shape", err.Error())
+
+	assert.Panics(func() {
+		Register(circle{})
+		RegisterName("Circle", square{})
+	})
+}
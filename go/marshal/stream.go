@@ -0,0 +1,93 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"reflect"
+
+	"github.com/stormasm/noms/go/types"
+)
+
+// MarshalStream marshals each Go value received from |ch| as Marshal does, and appends it to a Noms List, until |ch| is closed. As the List grows, its chunks are written to |vrw|, so only the chunks it's building are held in memory, however many values there are. This makes it suitable for converting millions of records, where the values are read from a file or another database by a goroutine sending them on |ch|.
+// If a value can't be marshaled, MarshalStream returns the error Marshal would, after receiving and throwing away the rest of the values, so the goroutine sending them isn't left blocked.
+func MarshalStream(ch <-chan interface{}, vrw types.ValueReadWriter) (types.List, error) {
+	values := make(chan types.Value, 128)
+	listChan := types.NewStreamingList(vrw, values)
+
+	var err error
+	for v := range ch {
+		if err != nil {
+			continue
+		}
+		var nv types.Value
+		if nv, err = Marshal(v); err == nil {
+			values <- nv
+		}
+	}
+	close(values)
+	l := <-listChan
+	if err != nil {
+		return types.List{}, err
+	}
+	return l, nil
+}
+
+// UnmarshalStream unmarshals each value of the Noms List |l| as Unmarshal does, into a new Go value of the element type of |ch|, and sends it on |ch|. The List is read a chunk at a time, so it needn't fit in memory. |ch| must be a channel that can be sent on, such as a chan T or a chan<- T, which UnmarshalStream closes once it's done, even if it fails. It's meant to be called from its own goroutine, while another ranges over |ch|:
+//
+//   people := make(chan Person, 16)
+//   go func() {
+//     err = marshal.UnmarshalStream(list, people)
+//   }()
+//   for p := range people {
+//     ...
+//   }
+//
+// If a value can't be unmarshaled, UnmarshalStream stops and returns the error Unmarshal would. The values sent before it are unaffected.
+func UnmarshalStream(l types.List, ch interface{}) (err error) {
+	rv := reflect.ValueOf(ch)
+	if rv.Kind() != reflect.Chan || rv.IsNil() || rv.Type().ChanDir()&reflect.SendDir == 0 {
+		return &InvalidUnmarshalStreamError{reflect.TypeOf(ch)}
+	}
+	defer rv.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case *UnmarshalTypeMismatchError, *UnsupportedTypeError, *InvalidTagError:
+				err = r.(error)
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	t := rv.Type().Elem()
+	d := typeDecoder(t, Options{})
+	state := newDecodeState(Options{})
+	it := l.Iterator()
+	for v := it.Next(); v != nil; v = it.Next() {
+		out := reflect.New(t).Elem()
+		d(v, out, state)
+		rv.Send(out)
+	}
+	return
+}
+
+// InvalidUnmarshalStreamError describes an invalid argument passed to UnmarshalStream. (The argument to UnmarshalStream must be a non-nil channel that can be sent on.)
+type InvalidUnmarshalStreamError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalStreamError) Error() string {
+	if e.Type == nil {
+		return "Cannot unmarshal stream into Go nil value"
+	}
+	if e.Type.Kind() != reflect.Chan {
+		return "Cannot unmarshal stream into Go non channel of type " + e.Type.String()
+	}
+	if e.Type.ChanDir()&reflect.SendDir == 0 {
+		return "Cannot unmarshal stream into Go receive-only channel of type " + e.Type.String()
+	}
+	return "Cannot unmarshal stream into Go nil channel of type " + e.Type.String()
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+type streamRecord struct {
+	ID   int
+	Name string
+}
+
+func TestMarshalStream(t *testing.T) {
+	assert := assert.New(t)
+
+	const n = 10000
+	vs := types.NewTestValueStore()
+	ch := make(chan interface{})
+	go func() {
+		for i := 0; i < n; i++ {
+			ch <- streamRecord{i, "r"}
+		}
+		close(ch)
+	}()
+	l, err := MarshalStream(ch, vs)
+	assert.NoError(err)
+	assert.Equal(uint64(n), l.Len())
+	// The List was written as it was built.
+	assert.True(l.Equals(vs.ReadValue(l.Hash())))
+
+	out := make(chan streamRecord, 16)
+	errChan := make(chan error)
+	go func() {
+		errChan <- UnmarshalStream(l, out)
+	}()
+	i := 0
+	for r := range out {
+		assert.Equal(streamRecord{i, "r"}, r)
+		i++
+	}
+	assert.NoError(<-errChan)
+	assert.Equal(n, i)
+}
+
+func TestMarshalStreamError(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan interface{})
+	go func() {
+		ch <- 1
+		ch <- func() {}
+		// The rest of the values are received, even though they're not marshaled.
+		ch <- 2
+		close(ch)
+	}()
+	_, err := MarshalStream(ch, types.NewTestValueStore())
+	assert.Error(err)
+	assert.Equal("Type is not supported, type: func()", err.Error())
+}
+
+func TestUnmarshalStreamError(t *testing.T) {
+	assert := assert.New(t)
+
+	l := types.NewList(types.Number(1), types.String("two"), types.Number(3))
+	out := make(chan int, 3)
+	err := UnmarshalStream(l, out)
+	assert.Equal("Cannot unmarshal String into Go value of type int", err.Error())
+	// Values before the one that failed are sent, and the channel is closed.
+	assert.Equal(1, <-out)
+	_, ok := <-out
+	assert.False(ok)
+
+	var i int
+	assert.Equal("Cannot unmarshal stream into Go non channel of type *int", UnmarshalStream(l, &i).Error())
+	assert.Equal("Cannot unmarshal stream into Go receive-only channel of type <-chan int", UnmarshalStream(l, (<-chan int)(out)).Error())
+	var nilChan chan int
+	assert.Equal("Cannot unmarshal stream into Go nil channel of type chan int", UnmarshalStream(l, nilChan).Error())
+	assert.Equal("Cannot unmarshal stream into Go nil value", UnmarshalStream(l, nil).Error())
+}
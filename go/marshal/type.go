@@ -0,0 +1,277 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/stormasm/noms/go/types"
+)
+
+// MarshalType returns the Noms type of the values Marshal encodes Go values of type |t| as. Where |t| doesn't say what that is, as for an interface{}, or for a types.Value field, it's the type of any value, Value, or of a collection of any values, such as List<Value> for a types.List, so the types of the values Marshal encodes are subtypes of the type MarshalType returns, as types.IsSubtype sees it.
+// Noms struct types can't have fields that are only sometimes there, so the fields of Go structs tagged "omitempty" are left out of their types, and the struct types of Go structs with an "original" field have no name, since the Noms structs they're encoded as keep the name of the original.
+// MarshalType returns an UnsupportedTypeError or an InvalidTagError for the Go types Marshal would.
+func MarshalType(t reflect.Type) (*types.Type, error) {
+	return MarshalTypeOpt(t, Options{})
+}
+
+// MarshalTypeOpt is like MarshalType, but returns the type of the values MarshalOpt encodes with |opt|. Go pointers are Refs if there's a VRW, or either Refs or the values they point to if there's also a MaxInlineBytes.
+func MarshalTypeOpt(t reflect.Type, opt Options) (nt *types.Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case *UnsupportedTypeError, *InvalidTagError:
+				err = r.(error)
+				return
+			}
+			panic(r)
+		}
+	}()
+	nt = marshalType(t, nil, opt)
+	return
+}
+
+// nomsValueKinds are the kinds of the Noms values that are Go structs.
+var nomsValueKinds = map[reflect.Type]types.NomsKind{
+	reflect.TypeOf(types.Blob{}):      types.BlobKind,
+	reflect.TypeOf(types.Encrypted{}): types.EncryptedKind,
+	reflect.TypeOf(types.List{}):      types.ListKind,
+	reflect.TypeOf(types.Map{}):       types.MapKind,
+	reflect.TypeOf(types.Ref{}):       types.RefKind,
+	reflect.TypeOf(types.Set{}):       types.SetKind,
+	reflect.TypeOf(types.Struct{}):    types.StructKind,
+}
+
+var nomsRefType = reflect.TypeOf(types.Ref{})
+
+func marshalType(t reflect.Type, parentStructTypes []reflect.Type, opt Options) *types.Type {
+	switch t.Kind() {
+	case reflect.Bool:
+		return types.BoolType
+	case reflect.Float64, reflect.Float32, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.NumberType
+	case reflect.String:
+		return types.StringType
+	case reflect.Struct:
+		if t.Implements(nomsValueInterface) {
+			switch nomsValueKinds[t] {
+			case types.BlobKind:
+				return types.BlobType
+			case types.EncryptedKind:
+				return types.EncryptedType
+			case types.ListKind:
+				return types.MakeListType(types.ValueType)
+			case types.MapKind:
+				return types.MakeMapType(types.ValueType, types.ValueType)
+			case types.RefKind:
+				return types.MakeRefType(types.ValueType)
+			case types.SetKind:
+				return types.MakeSetType(types.ValueType)
+			}
+			return types.ValueType
+		}
+		return marshalStructType(t, parentStructTypes, opt)
+	case reflect.Slice, reflect.Array:
+		return types.MakeListType(marshalType(t.Elem(), parentStructTypes, opt))
+	case reflect.Map:
+		return types.MakeMapType(marshalType(t.Key(), parentStructTypes, opt), marshalType(t.Elem(), parentStructTypes, opt))
+	case reflect.Interface:
+		return types.ValueType
+	case reflect.Ptr:
+		elemType := marshalType(t.Elem(), parentStructTypes, opt)
+		if opt.VRW == nil {
+			return elemType
+		}
+		if opt.MaxInlineBytes == 0 {
+			return types.MakeRefType(elemType)
+		}
+		return types.MakeUnionType(elemType, types.MakeRefType(elemType))
+	default:
+		panic(&UnsupportedTypeError{Type: t})
+	}
+}
+
+func marshalStructType(t reflect.Type, parentStructTypes []reflect.Type, opt Options) *types.Type {
+	for i, pst := range parentStructTypes {
+		if pst == t {
+			return types.MakeCycleType(uint32(i))
+		}
+	}
+
+	parentStructTypes = append(parentStructTypes, t)
+	name := strings.Title(t.Name())
+	fields := types.FieldMap{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		validateField(f, t)
+		tags := getTags(f)
+		if tags.original {
+			name = ""
+		}
+		if tags.skip || tags.original || tags.omitEmpty {
+			continue
+		}
+		if tags.encrypted {
+			fields[getFieldName(tags.name, f, opt.FieldCase)] = types.EncryptedType
+			continue
+		}
+		fields[getFieldName(tags.name, f, opt.FieldCase)] = marshalType(f.Type, parentStructTypes, opt)
+	}
+	return types.MakeStructTypeFromFields(name, fields)
+}
+
+// TypeMismatchError is returned by UnmarshalOpt, if its Options say to Validate, when the type of a Noms value doesn't match the Go value it's to be unmarshaled into. Path says where in the Noms type the mismatch is, as in ".people[].name", where [] is the elements of a List or the values of a Map, []@key the keys of a Map, and @target the target of a Ref.
+type TypeMismatchError struct {
+	Path    string
+	Type    *types.Type  // Noms type at Path
+	GoType  reflect.Type // type of Go value it could not be assigned to
+	details string
+}
+
+func (e *TypeMismatchError) Error() string {
+	at := ""
+	if e.Path != "" {
+		at = " at " + e.Path
+	}
+	return fmt.Sprintf("Cannot unmarshal %s%s into Go value of type %s%s", e.Type.Describe(), at, e.GoType, e.details)
+}
+
+// typePair is a Noms type being validated against a Go type. Since Noms struct types can refer to themselves, the pairs being validated are kept track of, so that validating them ends.
+type typePair struct {
+	nt *types.Type
+	t  reflect.Type
+}
+
+// validateType returns a TypeMismatchError if Unmarshal can't unmarshal values of type |nt| into Go values of type |t|, going by what the types say. Values can still fail to unmarshal for reasons their types don't show, such as a Number overflowing an int8, or a List being longer than an array.
+func validateType(nt *types.Type, t reflect.Type, path string, opt Options, visiting map[typePair]bool) *TypeMismatchError {
+	if nt.Kind() == types.UnionKind {
+		for _, et := range nt.Desc.(types.CompoundDesc).ElemTypes {
+			if err := validateType(et, t, path, opt, visiting); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	key := typePair{nt, t}
+	if visiting[key] {
+		return nil
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	mismatch := func(details string) *TypeMismatchError {
+		return &TypeMismatchError{path, nt, t, details}
+	}
+	expectKind := func(k types.NomsKind) *TypeMismatchError {
+		if nt.Kind() != k {
+			return mismatch("")
+		}
+		return nil
+	}
+	elemTypes := func() []*types.Type {
+		return nt.Desc.(types.CompoundDesc).ElemTypes
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return expectKind(types.BoolKind)
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return expectKind(types.NumberKind)
+	case reflect.String:
+		return expectKind(types.StringKind)
+	case reflect.Slice, reflect.Array:
+		if err := expectKind(types.ListKind); err != nil {
+			return err
+		}
+		return validateType(elemTypes()[0], t.Elem(), path+"[]", opt, visiting)
+	case reflect.Map:
+		if err := expectKind(types.MapKind); err != nil {
+			return err
+		}
+		if err := validateType(elemTypes()[0], t.Key(), path+"[]@key", opt, visiting); err != nil {
+			return err
+		}
+		return validateType(elemTypes()[1], t.Elem(), path+"[]", opt, visiting)
+	case reflect.Ptr:
+		if nt.Kind() == types.RefKind && !nomsRefType.AssignableTo(t.Elem()) {
+			return validateType(elemTypes()[0], t.Elem(), path+"@target", opt, visiting)
+		}
+		return validateType(nt, t.Elem(), path, opt, visiting)
+	case reflect.Interface:
+		if t.Implements(nomsValueInterface) {
+			return nil
+		}
+		if nt.Kind() == types.StructKind {
+			rt := registeredType(nt.Desc.(types.StructDesc).Name)
+			if rt == nil {
+				return mismatch("")
+			}
+			if !rt.AssignableTo(t) {
+				return mismatch(", registered type " + rt.String() + " does not implement it")
+			}
+			return validateType(nt, rt, path, opt, visiting)
+		}
+		if t != emptyInterface {
+			return mismatch("")
+		}
+		// interface{} is unmarshaled onto as getGoTypeForNomsType says.
+		switch nt.Kind() {
+		case types.BoolKind, types.NumberKind, types.StringKind:
+			return nil
+		case types.ListKind:
+			return validateType(elemTypes()[0], t, path+"[]", opt, visiting)
+		case types.MapKind:
+			if err := validateType(elemTypes()[0], t, path+"[]@key", opt, visiting); err != nil {
+				return err
+			}
+			return validateType(elemTypes()[1], t, path+"[]", opt, visiting)
+		}
+		return mismatch("")
+	case reflect.Struct:
+		if t.Implements(nomsValueInterface) {
+			if k, ok := nomsValueKinds[t]; ok {
+				return expectKind(k)
+			}
+			return nil
+		}
+		if err := expectKind(types.StructKind); err != nil {
+			err.details = ", expected struct"
+			return err
+		}
+		desc := nt.Desc.(types.StructDesc)
+		if !strings.EqualFold(desc.Name, t.Name()) {
+			return mismatch(", names do not match")
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tags := getTags(f)
+			if tags.skip || tags.original {
+				continue
+			}
+			name := getFieldName(tags.name, f, opt.FieldCase)
+			ft := desc.Field(name)
+			if ft == nil {
+				if tags.omitEmpty {
+					continue
+				}
+				return mismatch(", missing field \"" + name + "\"")
+			}
+			if tags.encrypted {
+				// What it's the encryption of can't be checked until it's decrypted.
+				if ft.Kind() != types.EncryptedKind {
+					return &TypeMismatchError{path + "." + name, ft, f.Type, ", expected Encrypted"}
+				}
+				continue
+			}
+			if err := validateType(ft, f.Type, path+"."+name, opt, visiting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package marshal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestMarshalType(t *testing.T) {
+	assert := assert.New(t)
+
+	type Address struct {
+		Street string
+		Zip    int
+	}
+	type Person struct {
+		Name      string
+		Tags      []string
+		Scores    map[string]float64
+		Addresses []Address
+		Any       interface{}
+		List      types.List
+		Maybe     bool `noms:",omitempty"`
+		Skipped   bool `noms:"-"`
+	}
+	nt, err := MarshalType(reflect.TypeOf(Person{}))
+	assert.NoError(err)
+	assert.True(types.MakeStructTypeFromFields("Person", types.FieldMap{
+		"name":      types.StringType,
+		"tags":      types.MakeListType(types.StringType),
+		"scores":    types.MakeMapType(types.StringType, types.NumberType),
+		"addresses": types.MakeListType(types.MakeStructTypeFromFields("Address", types.FieldMap{"street": types.StringType, "zip": types.NumberType})),
+		"any":       types.ValueType,
+		"list":      types.MakeListType(types.ValueType),
+	}).Equals(nt))
+
+	// The types of the values Marshal encodes are subtypes.
+	v, err := Marshal(Person{Name: "a", Any: 1.0, List: types.NewList(types.Number(1)), Maybe: true})
+	assert.NoError(err)
+	assert.True(types.IsSubtype(nt, v.Type()))
+
+	_, err = MarshalType(reflect.TypeOf(make(chan int)))
+	assert.Equal("Type is not supported, type: chan int", err.Error())
+}
+
+func TestMarshalTypeCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	type Node struct {
+		Value    int
+		Children []Node
+		Next     *Node
+	}
+	nt, err := MarshalType(reflect.TypeOf(Node{}))
+	assert.NoError(err)
+	assert.True(types.MakeStructTypeFromFields("Node", types.FieldMap{
+		"value":    types.NumberType,
+		"children": types.MakeListType(types.MakeCycleType(0)),
+		"next":     types.MakeCycleType(0),
+	}).Equals(nt))
+
+	nt, err = MarshalTypeOpt(reflect.TypeOf(&Node{}), Options{VRW: types.NewTestValueStore()})
+	assert.NoError(err)
+	assert.Equal(types.RefKind, nt.Kind())
+	nt, err = MarshalTypeOpt(reflect.TypeOf(&Node{}), Options{VRW: types.NewTestValueStore(), MaxInlineBytes: 100})
+	assert.NoError(err)
+	assert.Equal(types.UnionKind, nt.Kind())
+}
+
+func TestUnmarshalValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	type Address struct {
+		Zip int
+	}
+	type Person struct {
+		Name      string
+		Addresses []Address
+		Tags      map[string]bool `noms:",omitempty"`
+	}
+	address := func(zip types.Value) types.Struct {
+		return types.NewStruct("Address", types.StructData{"zip": zip})
+	}
+	valid := types.NewStruct("Person", types.StructData{
+		"name":      types.String("a"),
+		"addresses": types.NewList(address(types.Number(1))),
+	})
+	var p Person
+	assert.NoError(UnmarshalOpt(valid, &p, Options{Validate: true}))
+	assert.Equal(Person{"a", []Address{{1}}, nil}, p)
+
+	test := func(v types.Value, msg string) {
+		p := Person{Name: "unchanged"}
+		err := UnmarshalOpt(v, &p, Options{Validate: true})
+		assert.IsType(&TypeMismatchError{}, err)
+		assert.Equal(msg, err.Error())
+		// Nothing is unmarshaled.
+		assert.Equal(Person{Name: "unchanged"}, p)
+	}
+	test(valid.Set("addresses", types.NewList(address(types.Number(1)), address(types.String("x")))),
+		"Cannot unmarshal String at .addresses[].zip into Go value of type int")
+	test(valid.Set("addresses", types.NewList(types.Number(1))),
+		"Cannot unmarshal Number at .addresses[] into Go value of type marshal.Address, expected struct")
+	test(valid.Set("tags", types.NewMap(types.String("k"), types.String("v"))),
+		"Cannot unmarshal String at .tags[] into Go value of type bool")
+	test(valid.Set("tags", types.NewMap(types.Number(1), types.Bool(true))),
+		"Cannot unmarshal Number at .tags[]@key into Go value of type string")
+	test(types.NewStruct("Person", types.StructData{"name": types.String("a")}),
+		"Cannot unmarshal struct Person {\n  name: String,\n} into Go value of type marshal.Person, missing field \"addresses\"")
+	test(types.NewStruct("Persona", types.StructData{}),
+		"Cannot unmarshal struct Persona {} into Go value of type marshal.Person, names do not match")
+}
+
+func TestUnmarshalValidateRefs(t *testing.T) {
+	assert := assert.New(t)
+
+	type Node struct {
+		Value int
+		Next  *Node `noms:",omitempty"`
+	}
+	vs := types.NewTestValueStore()
+	v, err := MarshalOpt(Node{1, &Node{2, nil}}, Options{VRW: vs})
+	assert.NoError(err)
+	var n Node
+	assert.NoError(UnmarshalOpt(v, &n, Options{VRW: vs, Validate: true}))
+	assert.Equal(2, n.Next.Value)
+
+	bad := v.(types.Struct).Set("next", vs.WriteValue(types.NewStruct("Node", types.StructData{"value": types.String("x")})))
+	err = UnmarshalOpt(bad, &n, Options{VRW: vs, Validate: true})
+	assert.Equal("Cannot unmarshal String at .next@target.value into Go value of type int", err.Error())
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"fmt"
+
+	"github.com/stormasm/noms/go/marshal"
+	"github.com/stormasm/noms/go/types"
+)
+
+// ConflictRecorder is a Policy that resolves conflicts with another Policy where it can, and otherwise records them in Conflicts, so that ThreeWay merges everything else rather than failing. The conflicts it records are resolved, for now, with the ancestor's value, or by removing the value if the ancestor didn't have one, so that the merged value can be fixed up later, once they've been settled.
+type ConflictRecorder struct {
+	policy    Policy
+	Conflicts []Conflict
+}
+
+// NewConflictRecorder returns a ConflictRecorder that resolves what conflicts it can with |p|, which can be nil.
+func NewConflictRecorder(p Policy) *ConflictRecorder {
+	if p == nil {
+		p = Fail
+	}
+	return &ConflictRecorder{policy: p}
+}
+
+// Resolve resolves |c| with the ConflictRecorder's Policy, or records it.
+func (r *ConflictRecorder) Resolve(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+	if change, merged, ok = r.policy.Resolve(c); ok {
+		return
+	}
+	r.Conflicts = append(r.Conflicts, c)
+	if c.Parent == nil {
+		return types.DiffChangeRemoved, nil, true
+	}
+	return types.DiffChangeModified, c.Parent, true
+}
+
+// conflict is how a Conflict is stored in Noms, as a struct named Conflict. Its Path is a types.Path, and its changes are "added", "modified" or "removed". Values that aren't there are left out.
+type conflict struct {
+	Path        string
+	LeftChange  string
+	RightChange string
+	Base        types.Value `noms:",omitempty"`
+	Left        types.Value `noms:",omitempty"`
+	Right       types.Value `noms:",omitempty"`
+}
+
+var changeNames = map[types.DiffChangeType]string{
+	types.DiffChangeAdded:    "added",
+	types.DiffChangeModified: "modified",
+	types.DiffChangeRemoved:  "removed",
+}
+
+// NewConflictList returns a Noms List of structs describing |conflicts|, with the path, the base, left and right values, and the left and right changes of each, so that they can be committed, as to a <dataset>/conflicts dataset, for people or other programs to settle later. ReadConflictList reads them back.
+func NewConflictList(conflicts []Conflict) types.List {
+	values := make([]types.Value, len(conflicts))
+	for i, c := range conflicts {
+		v, err := marshal.Marshal(conflict{c.Path.String(), changeNames[c.AChange], changeNames[c.BChange], c.Parent, c.A, c.B})
+		if err != nil {
+			panic(err)
+		}
+		values[i] = v
+	}
+	return types.NewList(values...)
+}
+
+// ReadConflictList returns the Conflicts described by |l|, a List made by NewConflictList.
+func ReadConflictList(l types.List) (conflicts []Conflict, err error) {
+	changeTypes := map[string]types.DiffChangeType{}
+	for ct, name := range changeNames {
+		changeTypes[name] = ct
+	}
+	l.Iter(func(v types.Value, i uint64) bool {
+		var c conflict
+		if err = marshal.Unmarshal(v, &c); err != nil {
+			return true
+		}
+		var path types.Path
+		if path, err = types.ParsePath(c.Path); err != nil {
+			return true
+		}
+		aChange, aOk := changeTypes[c.LeftChange]
+		bChange, bOk := changeTypes[c.RightChange]
+		if !aOk || !bOk {
+			err = fmt.Errorf("Invalid changes %s and %s in conflict %d", c.LeftChange, c.RightChange, i)
+			return true
+		}
+		conflicts = append(conflicts, Conflict{path, aChange, bChange, c.Left, c.Right, c.Base})
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestConflictRecorder(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	doc := func(data types.StructData) types.Struct {
+		return types.NewStruct("Doc", data)
+	}
+	parent := doc(types.StructData{"a": types.Number(1), "b": types.String("b"), "list": types.NewList(types.Number(1))})
+	left := doc(types.StructData{"a": types.Number(2), "b": types.String("left"), "list": types.NewList(types.Number(1), types.Number(2)), "new": types.Bool(true)})
+	right := doc(types.StructData{"a": types.Number(3), "list": types.NewList(types.Number(1), types.Number(3)), "new": types.Bool(false)})
+
+	ps := NewPolicies(nil)
+	assert.NoError(ps.Set(".a", NumericAdd))
+	r := NewConflictRecorder(ps)
+	merged, err := ThreeWay(left, right, parent, vs, r, nil)
+	assert.NoError(err)
+	// What could be merged was, and the conflicts were left as they were in the parent.
+	assert.True(doc(types.StructData{"a": types.Number(4), "b": types.String("b"), "list": types.NewList(types.Number(1))}).Equals(merged), "%s", types.EncodedValue(merged))
+
+	paths := []string{}
+	for _, c := range r.Conflicts {
+		paths = append(paths, c.Path.String())
+	}
+	assert.Equal([]string{".b", ".list", ".new"}, paths)
+	assert.Equal(Conflict{r.Conflicts[0].Path, types.DiffChangeModified, types.DiffChangeRemoved, types.String("left"), nil, types.String("b")}, r.Conflicts[0])
+
+	l := NewConflictList(r.Conflicts)
+	assert.Equal(uint64(3), l.Len())
+	assert.True(types.NewStruct("Conflict", types.StructData{
+		"path":        types.String(".b"),
+		"leftChange":  types.String("modified"),
+		"rightChange": types.String("removed"),
+		"base":        types.String("b"),
+		"left":        types.String("left"),
+	}).Equals(l.Get(0)))
+
+	conflicts, err := ReadConflictList(l)
+	assert.NoError(err)
+	assert.Len(conflicts, 3)
+	for i, c := range conflicts {
+		assert.Equal(r.Conflicts[i].Path.String(), c.Path.String())
+		assert.Equal(r.Conflicts[i].AChange, c.AChange)
+		assert.Equal(r.Conflicts[i].BChange, c.BChange)
+		for _, pair := range [][2]types.Value{{r.Conflicts[i].A, c.A}, {r.Conflicts[i].B, c.B}, {r.Conflicts[i].Parent, c.Parent}} {
+			assert.True(pair[0] == nil && pair[1] == nil || pair[0].Equals(pair[1]))
+		}
+	}
+
+	_, err = ReadConflictList(types.NewList(types.Number(1)))
+	assert.Error(err)
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stormasm/noms/go/types"
+)
+
+// Conflict describes two changes, made at the same path on either side of a merge, that ThreeWay can't merge by itself. A and B are what the two sides changed the value at Path to, and Parent is what it was in their common ancestor. Each is nil if there's no value there, as when it was removed.
+type Conflict struct {
+	Path             types.Path
+	AChange, BChange types.DiffChangeType
+	A, B, Parent     types.Value
+}
+
+// Policy resolves the conflicts ThreeWay comes across. If it can't resolve a conflict, ok should be false upon return and the other return values are undefined. If it can, it should return the type of change to apply, the new value to be used (if any), and true.
+type Policy interface {
+	Resolve(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool)
+}
+
+// PolicyFunc is an adapter to use a function as a Policy.
+type PolicyFunc func(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool)
+
+// Resolve calls f(c).
+func (f PolicyFunc) Resolve(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+	return f(c)
+}
+
+// Resolve calls f with the changes and values of |c|, letting a ResolveFunc be used as a Policy. A nil ResolveFunc resolves nothing.
+func (f ResolveFunc) Resolve(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+	if f == nil {
+		return
+	}
+	return f(c.AChange, c.BChange, c.A, c.B, c.Path)
+}
+
+var (
+	// Fail resolves no conflicts, so that ThreeWay fails at the first one. It's what ThreeWay does without a Policy.
+	Fail Policy = PolicyFunc(func(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+		return
+	})
+
+	// Ours resolves conflicts by keeping the change made on ThreeWay's a side.
+	Ours Policy = PolicyFunc(func(c Conflict) (types.DiffChangeType, types.Value, bool) {
+		return c.AChange, c.A, true
+	})
+
+	// Theirs resolves conflicts by keeping the change made on ThreeWay's b side.
+	Theirs Policy = PolicyFunc(func(c Conflict) (types.DiffChangeType, types.Value, bool) {
+		return c.BChange, c.B, true
+	})
+
+	// LastWriterWins resolves conflicts by keeping the change that was made last. Noms values don't say when they were written, so the b side of ThreeWay is taken to be the later one, as it is when it's what's being merged in, which makes this Theirs. Use types.LWWRegister for values that need to know which write was last.
+	LastWriterWins = Theirs
+
+	// NumericAdd resolves conflicting changes to a Number as if both sides had added to it, so that the merged Number is a + b - parent, where a missing parent is 0. It's for counters kept as Numbers, rather than as types.Counter, which ThreeWay merges by itself. It doesn't resolve conflicts between values that aren't Numbers, or where a side removed the Number.
+	NumericAdd Policy = PolicyFunc(func(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+		a, aOk := c.A.(types.Number)
+		b, bOk := c.B.(types.Number)
+		if !aOk || !bOk || c.AChange == types.DiffChangeRemoved || c.BChange == types.DiffChangeRemoved {
+			return
+		}
+		p, _ := c.Parent.(types.Number)
+		return c.AChange, types.Number(float64(a) + float64(b) - float64(p)), true
+	})
+
+	// SetUnion resolves conflicts between Sets, or Lists, by keeping the elements of both, as for tags, where each side's additions should be kept. Lists are merged as a's elements followed by those of b's that a doesn't have. If one side removed the collection, the other side's is kept. It doesn't resolve conflicts between other values.
+	SetUnion Policy = PolicyFunc(func(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+		if c.AChange == types.DiffChangeRemoved || c.BChange == types.DiffChangeRemoved {
+			if c.AChange == types.DiffChangeRemoved {
+				change, merged = c.BChange, c.B
+			} else {
+				change, merged = c.AChange, c.A
+			}
+			switch merged.(type) {
+			case types.Set, types.List:
+				return change, merged, true
+			}
+			return
+		}
+		switch a := c.A.(type) {
+		case types.Set:
+			if b, isSet := c.B.(types.Set); isSet {
+				values := []types.Value{}
+				b.IterAll(func(v types.Value) {
+					values = append(values, v)
+				})
+				return c.AChange, a.Insert(values...), true
+			}
+		case types.List:
+			if b, isList := c.B.(types.List); isList {
+				seen := map[string]bool{}
+				a.IterAll(func(v types.Value, _ uint64) {
+					seen[v.Hash().String()] = true
+				})
+				values := []types.Value{}
+				b.IterAll(func(v types.Value, _ uint64) {
+					if h := v.Hash().String(); !seen[h] {
+						seen[h] = true
+						values = append(values, v)
+					}
+				})
+				return c.AChange, a.Append(values...), true
+			}
+		}
+		return
+	})
+)
+
+// Policies is a Policy that resolves each conflict with the Policy set for its path, or for the closest of its ancestors that has one, and otherwise with its default Policy. For example, with a Policy set for .counts, conflicts at .counts["a"] are resolved with it.
+type Policies struct {
+	def   Policy
+	paths map[string]Policy
+}
+
+// NewPolicies returns Policies that resolve conflicts with |def| where no Policy is set for their paths. If |def| is nil, those conflicts aren't resolved.
+func NewPolicies(def Policy) *Policies {
+	if def == nil {
+		def = Fail
+	}
+	return &Policies{def, map[string]Policy{}}
+}
+
+// Set makes |p| resolve the conflicts at |path|, and below it, which is parsed as a types.Path, such as .tags or .counts["a"].
+func (ps *Policies) Set(path string, p Policy) error {
+	parsed, err := types.ParsePath(path)
+	if err != nil {
+		return err
+	}
+	ps.paths[parsed.String()] = p
+	return nil
+}
+
+// Resolve resolves |c| with the Policy set for the longest prefix of its path, or the default Policy.
+func (ps *Policies) Resolve(c Conflict) (change types.DiffChangeType, merged types.Value, ok bool) {
+	for i := len(c.Path); i > 0; i-- {
+		if p, found := ps.paths[c.Path[:i].String()]; found {
+			return p.Resolve(c)
+		}
+	}
+	return ps.def.Resolve(c)
+}
+
+type policyRegistryT struct {
+	sync.RWMutex
+	m map[string]Policy
+}
+
+var policyRegistry = &policyRegistryT{m: map[string]Policy{
+	"fail":   Fail,
+	"ours":   Ours,
+	"theirs": Theirs,
+	"lww":    LastWriterWins,
+	"add":    NumericAdd,
+	"union":  SetUnion,
+}}
+
+// RegisterPolicy makes |p| available as |name| to LookupPolicy and ParsePolicies, and so to the --policy flag of noms merge. The built in Policies are registered as fail, ours, theirs, lww, add and union.
+func RegisterPolicy(name string, p Policy) {
+	policyRegistry.Lock()
+	defer policyRegistry.Unlock()
+	policyRegistry.m[name] = p
+}
+
+// LookupPolicy returns the Policy registered as |name|, if there is one.
+func LookupPolicy(name string) (p Policy, ok bool) {
+	policyRegistry.RLock()
+	defer policyRegistry.RUnlock()
+	p, ok = policyRegistry.m[name]
+	return
+}
+
+// PolicyNames returns the names of the registered Policies, sorted.
+func PolicyNames() []string {
+	policyRegistry.RLock()
+	defer policyRegistry.RUnlock()
+	names := make([]string, 0, len(policyRegistry.m))
+	for name := range policyRegistry.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePolicies returns Policies that resolve conflicts as |spec| says, which is a comma-separated list of path=name pairs, such as .count=add,.tags=union, naming registered Policies to set for paths, and otherwise with |def|.
+func ParsePolicies(spec string, def Policy) (*Policies, error) {
+	ps := NewPolicies(def)
+	if spec == "" {
+		return ps, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid policy %s, must be path=name", pair)
+		}
+		p, ok := LookupPolicy(kv[1])
+		if !ok {
+			return nil, fmt.Errorf("Unknown policy %s, must be one of %s", kv[1], strings.Join(PolicyNames(), ", "))
+		}
+		if err := ps.Set(kv[0], p); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestPolicies(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	doc := func(name string, count float64, tags ...string) types.Struct {
+		tagValues := []types.Value{}
+		for _, tag := range tags {
+			tagValues = append(tagValues, types.String(tag))
+		}
+		return types.NewStruct("Doc", types.StructData{
+			"name":  types.String(name),
+			"count": types.Number(count),
+			"tags":  types.NewList(tagValues...),
+		})
+	}
+	parent := doc("p", 10, "x")
+	a := doc("a", 15, "x", "y")
+	b := doc("b", 12, "x", "z")
+
+	_, err := ThreeWay(a, b, parent, vs, nil, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	ps, err := ParsePolicies(".count=add,.tags=union", Theirs)
+	assert.NoError(err)
+	merged, err := ThreeWay(a, b, parent, vs, ps, nil)
+	assert.NoError(err)
+	assert.True(doc("b", 17, "x", "y", "z").Equals(merged), "%s", types.EncodedValue(merged))
+
+	// Without a default, the rest of the conflicts aren't resolved.
+	ps, err = ParsePolicies(".count=add,.tags=union", nil)
+	assert.NoError(err)
+	_, err = ThreeWay(a, b, parent, vs, ps, nil)
+	assert.IsType(&ErrMergeConflict{}, err)
+
+	// Policies set for a path resolve the conflicts below it.
+	counts := func(n float64) types.Struct {
+		return types.NewStruct("", types.StructData{"counts": types.NewMap(types.String("views"), types.Number(n))})
+	}
+	ps = NewPolicies(nil)
+	assert.NoError(ps.Set(".counts", NumericAdd))
+	merged, err = ThreeWay(counts(3), counts(4), counts(1), vs, ps, nil)
+	assert.NoError(err)
+	assert.True(counts(6).Equals(merged))
+}
+
+func TestBuiltInPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	c := Conflict{
+		AChange: types.DiffChangeModified,
+		BChange: types.DiffChangeRemoved,
+		A:       types.NewSet(types.Number(1)),
+		Parent:  types.NewSet(),
+	}
+	change, merged, ok := SetUnion.Resolve(c)
+	assert.True(ok)
+	assert.Equal(types.DiffChangeModified, change)
+	assert.True(c.A.Equals(merged))
+
+	c.BChange, c.B = types.DiffChangeModified, types.NewSet(types.Number(2))
+	_, merged, ok = SetUnion.Resolve(c)
+	assert.True(ok)
+	assert.True(types.NewSet(types.Number(1), types.Number(2)).Equals(merged))
+
+	_, _, ok = NumericAdd.Resolve(c)
+	assert.False(ok)
+	_, merged, ok = NumericAdd.Resolve(Conflict{AChange: types.DiffChangeAdded, BChange: types.DiffChangeAdded, A: types.Number(1), B: types.Number(2)})
+	assert.True(ok)
+	assert.True(types.Number(3).Equals(merged))
+
+	_, merged, ok = Ours.Resolve(c)
+	assert.True(ok)
+	assert.True(c.A.Equals(merged))
+	_, merged, ok = LastWriterWins.Resolve(c)
+	assert.True(ok)
+	assert.True(c.B.Equals(merged))
+	_, _, ok = Fail.Resolve(c)
+	assert.False(ok)
+
+	var resolve ResolveFunc
+	_, _, ok = resolve.Resolve(c)
+	assert.False(ok)
+}
+
+func TestParsePolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParsePolicies(".count", nil)
+	assert.Equal("Invalid policy .count, must be path=name", err.Error())
+	_, err = ParsePolicies(".count=nope", nil)
+	assert.Contains(err.Error(), "Unknown policy nope, must be one of add, fail, lww, ours, theirs, union")
+	_, err = ParsePolicies("count=add", nil)
+	assert.Error(err)
+
+	RegisterPolicy("zz-test", Ours)
+	p, ok := LookupPolicy("zz-test")
+	assert.True(ok)
+	_, merged, _ := p.Resolve(Conflict{A: types.Number(1)})
+	assert.True(types.Number(1).Equals(merged))
+}
@@ -19,7 +19,8 @@ import (
 // ResolveFunc cannot devise a resolution, ok should be false upon return and
 // the other return values are undefined. If the conflict can be resolved, the
 // function should return the appropriate type of change to apply, the new value
-// to be used (if any), and true.
+// to be used (if any), and true. A ResolveFunc is a Policy, which is given the
+// ancestor's value too.
 type ResolveFunc func(aChange, bChange types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool)
 
 // ErrMergeConflict indicates that a merge attempt failed and must be resolved
@@ -52,10 +53,17 @@ func newMergeConflict(format string, args ...interface{}) *ErrMergeConflict {
 //    - same index is inserted wrt parent, but with different values: conflict
 //  - If we are dealing with a set:
 //    - `merged` is essentially union(a, b, parent)
+//  - If we are dealing with a counter:
+//    - `merged` is parent + (a - parent) + (b - parent), never a conflict
+//  - If we are dealing with a last-writer-wins register:
+//    - `merged` is whichever of a and b was written last, never a conflict
 //
-// All other modifications are allowed.
-// ThreeWay() works on types.List, types.Map, types.Set, and types.Struct.
-func ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, resolve ResolveFunc, progress chan struct{}) (merged types.Value, err error) {
+// All other modifications are allowed. Conflicts are resolved by policy, if it
+// can, or fail the merge. A nil policy resolves nothing, as Fail does, and
+// Policies resolve conflicts at different paths with different Policies.
+// ThreeWay() works on types.List, types.Map, types.Set, types.Struct,
+// types.Counter and types.LWWRegister.
+func ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, policy Policy, progress chan struct{}) (merged types.Value, err error) {
 	describe := func(v types.Value) string {
 		if v != nil {
 			return v.Type().Describe()
@@ -69,10 +77,10 @@ func ThreeWay(a, b, parent types.Value, vrw types.ValueReadWriter, resolve Resol
 		return parent, newMergeConflict("Cannot merge %s with %s.", describe(a), describe(b))
 	}
 
-	if resolve == nil {
-		resolve = defaultResolve
+	if policy == nil {
+		policy = Fail
 	}
-	m := &merger{vrw, resolve, progress}
+	m := &merger{vrw, policy, progress}
 	return m.threeWay(a, b, parent, types.Path{})
 }
 
@@ -87,14 +95,10 @@ func unmergeable(a, b types.Value) bool {
 
 type merger struct {
 	vrw      types.ValueReadWriter
-	resolve  ResolveFunc
+	policy   Policy
 	progress chan<- struct{}
 }
 
-func defaultResolve(aChange, bChange types.DiffChangeType, a, b types.Value, p types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
-	return
-}
-
 func updateProgress(progress chan<- struct{}) {
 	// TODO: Eventually we'll want more information than a single bit :).
 	if progress != nil {
@@ -135,6 +139,18 @@ func (m *merger) threeWay(a, b, parent types.Value, path types.Path) (merged typ
 		if aStruct, bStruct, pStruct, ok := structAssert(a, b, parent); ok {
 			return m.threeWayStructMerge(aStruct, bStruct, pStruct, path)
 		}
+
+	case types.CounterKind:
+		if aCounter, bCounter, pCounter, ok := counterAssert(a, b, parent); ok {
+			return types.MergeCounters(aCounter, bCounter, pCounter), nil
+		}
+
+	case types.LWWRegisterKind:
+		if aReg, aOk := a.(types.LWWRegister); aOk {
+			if bReg, bOk := b.(types.LWWRegister); bOk {
+				return aReg.Merge(bReg), nil
+			}
+		}
 	}
 
 	pDescription := "<nil>"
@@ -255,6 +271,18 @@ func setAssert(a, b, parent types.Value) (aSet, bSet, pSet types.Set, ok bool) {
 	return aSet, bSet, pSet, aOk && bOk && pOk
 }
 
+func counterAssert(a, b, parent types.Value) (aCounter, bCounter, pCounter types.Counter, ok bool) {
+	var aOk, bOk, pOk bool
+	aCounter, aOk = a.(types.Counter)
+	bCounter, bOk = b.(types.Counter)
+	if parent != nil {
+		pCounter, pOk = parent.(types.Counter)
+	} else {
+		pCounter, pOk = 0, true
+	}
+	return aCounter, bCounter, pCounter, aOk && bOk && pOk
+}
+
 func structAssert(a, b, parent types.Value) (aStruct, bStruct, pStruct types.Struct, ok bool) {
 	var aOk, bOk, pOk bool
 	aStruct, aOk = a.(types.Struct)
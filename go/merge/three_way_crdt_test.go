@@ -0,0 +1,55 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestThreeWayCounterMerge(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	merged, err := ThreeWay(types.Counter(15), types.Counter(7), types.Counter(10), vs, nil, nil)
+	assert.NoError(err)
+	assert.True(types.Counter(12).Equals(merged))
+
+	// Counters nested in a Map merge too, even when both sides added the same key.
+	parent := types.NewMap(types.String("views"), types.Counter(1))
+	a := types.NewMap(types.String("views"), types.Counter(3), types.String("likes"), types.Counter(1))
+	b := types.NewMap(types.String("views"), types.Counter(2), types.String("likes"), types.Counter(2))
+	merged, err = ThreeWay(a, b, parent, vs, nil, nil)
+	assert.NoError(err)
+	expected := types.NewMap(types.String("views"), types.Counter(4), types.String("likes"), types.Counter(3))
+	assert.True(expected.Equals(merged), "%s", types.EncodedValue(merged))
+}
+
+func TestThreeWayLWWRegisterMerge(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	parent := types.NewStruct("Profile", types.StructData{
+		"name": types.NewLWWRegister(types.String("bob"), 1),
+	})
+	a := types.NewStruct("Profile", types.StructData{
+		"name": types.NewLWWRegister(types.String("robert"), 3),
+	})
+	b := types.NewStruct("Profile", types.StructData{
+		"name": types.NewLWWRegister(types.String("bobby"), 2),
+	})
+
+	merged, err := ThreeWay(a, b, parent, vs, nil, nil)
+	assert.NoError(err)
+	assert.True(a.Equals(merged))
+
+	merged, err = ThreeWay(b, a, parent, vs, nil, nil)
+	assert.NoError(err)
+	assert.True(a.Equals(merged))
+}
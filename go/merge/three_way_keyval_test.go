@@ -165,7 +165,7 @@ func (s *ThreeWayKeyValMergeSuite) TestThreeWayMerge_CustomMerge() {
 		return aChange, aVal, true
 	}
 
-	merged, err := ThreeWay(s.create(a), s.create(b), s.create(p), s.vs, resolve, nil)
+	merged, err := ThreeWay(s.create(a), s.create(b), s.create(p), s.vs, ResolveFunc(resolve), nil)
 	if s.NoError(err) {
 		expected := s.create(exp)
 		s.True(expected.Equals(merged), "%s != %s", types.EncodedValue(expected), types.EncodedValue(merged))
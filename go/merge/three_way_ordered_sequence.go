@@ -71,9 +71,10 @@ func (m *merger) threeWayOrderedSequenceMerge(a, b, parent candidate, apply appl
 func (m *merger) mergeChanges(aChange, bChange types.ValueChanged, a, b, p candidate, apply applyFunc, path types.Path) (change types.ValueChanged, mergedVal types.Value, err error) {
 	path = a.pathConcat(aChange, path)
 	aValue, bValue := a.get(aChange.V), b.get(bChange.V)
+	conflict := Conflict{path, aChange.ChangeType, bChange.ChangeType, aValue, bValue, p.get(aChange.V)}
 	// If the two diffs generate different kinds of changes at the same key, conflict.
 	if aChange.ChangeType != bChange.ChangeType {
-		if change, mergedVal, ok := m.resolve(aChange.ChangeType, bChange.ChangeType, aValue, bValue, path); ok {
+		if change, mergedVal, ok := m.policy.Resolve(conflict); ok {
 			return types.ValueChanged{change, aChange.V}, mergedVal, nil
 		}
 		return change, nil, newMergeConflict("Conflict:\n%s\nvs\n%s\n", describeChange(aChange), describeChange(bChange))
@@ -91,10 +92,16 @@ func (m *merger) mergeChanges(aChange, bChange types.ValueChanged, a, b, p candi
 		if mergedVal, err = m.threeWay(aValue, bValue, p.get(aChange.V), path); err == nil {
 			return aChange, mergedVal, nil
 		}
+		// The policy may still resolve the conflict, as a whole, where it couldn't be merged.
+		if _, isConflict := err.(*ErrMergeConflict); isConflict {
+			if change, mergedVal, ok := m.policy.Resolve(conflict); ok {
+				return types.ValueChanged{change, aChange.V}, mergedVal, nil
+			}
+		}
 		return change, nil, err
 	}
 
-	if change, mergedVal, ok := m.resolve(aChange.ChangeType, bChange.ChangeType, aValue, bValue, path); ok {
+	if change, mergedVal, ok := m.policy.Resolve(conflict); ok {
 		return types.ValueChanged{change, aChange.V}, mergedVal, nil
 	}
 	return change, nil, newMergeConflict("Conflict:\n%s = %s\nvs\n%s = %s", describeChange(aChange), types.EncodedValue(aValue), describeChange(bChange), types.EncodedValue(bValue))
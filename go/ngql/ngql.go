@@ -0,0 +1,547 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package ngql runs GraphQL queries against Noms values, through a schema generated from their types. Bools, Numbers and Strings are GraphQL Booleans, Floats and Strings, and a struct is an object with the same fields. Lists, Sets and Maps are objects with their size, and their values, or for Maps their entries, keys and values, a page at a time: e.g. values(at: 100, count: 10). A Ref is an object with its targetHash, and its targetValue, which is only read if it's asked for, so queries can follow Refs as far as they like without the rest of the graph being read. Values whose types have no GraphQL counterpart, like Types and Tuples, are Values, a scalar which is the JSON for a Bool, Number or String, and the Noms encoding of anything else.
+package ngql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+const (
+	// rootField is the field of the query type that is the value being queried.
+	rootField = "value"
+	// scalarValueField is the field of the objects that Bools, Numbers, Strings and Values are wrapped in where they're part of a union, since GraphQL unions can only be of objects.
+	scalarValueField = "scalarValue"
+)
+
+// vrKey is the key of the ValueReader in the context of a query, which Refs are read with.
+type vrKey struct{}
+
+var (
+	schemaMu sync.Mutex
+	schemas  = map[hash.Hash]graphql.Schema{}
+)
+
+// NewSchema returns the GraphQL schema for querying values of type |t|: a query type, Query, with one field, value. Schemas are cached, since they're typically needed for many queries of values of the same type.
+func NewSchema(t *types.Type) (graphql.Schema, error) {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if s, ok := schemas[t.Hash()]; ok {
+		return s, nil
+	}
+	c := newConverter()
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: c.unique("Query"),
+		Fields: graphql.Fields{
+			rootField: &graphql.Field{
+				Type: c.output(t, nil),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return goValue(p.Source.(map[string]interface{})[rootField].(types.Value)), nil
+				},
+			},
+		},
+	})
+	s, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err == nil {
+		schemas[t.Hash()] = s
+	}
+	return s, err
+}
+
+// Query runs |query|, a GraphQL query, with |variables| and |operationName| if it has several operations, against |v|, reading any Refs it follows from |vr|.
+func Query(ctx context.Context, v types.Value, vr types.ValueReader, query string, variables map[string]interface{}, operationName string) *graphql.Result {
+	schema, err := NewSchema(v.Type())
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	return graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  query,
+		RootObject:     map[string]interface{}{rootField: v},
+		VariableValues: variables,
+		OperationName:  operationName,
+		Context:        context.WithValue(ctx, vrKey{}, vr),
+	})
+}
+
+// converter makes the GraphQL types for Noms types, making each just once, so that the names of those in a schema are unique.
+type converter struct {
+	// structs are the objects made for struct types, by structKey.
+	structs map[string]*graphql.Object
+	// derived are the types made for the other kinds of types, by the names they're derived from.
+	derived map[string]graphql.Output
+	used    map[string]bool
+}
+
+func newConverter() *converter {
+	c := &converter{map[string]*graphql.Object{}, map[string]graphql.Output{}, map[string]bool{}}
+	for _, t := range []graphql.Type{graphql.Boolean, graphql.Float, graphql.String, graphql.Int, valueScalar} {
+		c.used[t.Name()] = true
+	}
+	return c
+}
+
+// unique returns |name|, or if that's already the name of a type, name followed by the first of _2, _3... that isn't.
+func (c *converter) unique(name string) string {
+	unique := name
+	for i := 2; c.used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	c.used[unique] = true
+	return unique
+}
+
+// output returns the GraphQL type for values of type |t|, which is inside the structs whose objects are |enclosing|, innermost last, which the Cycles in t refer to.
+func (c *converter) output(t *types.Type, enclosing []*graphql.Object) graphql.Output {
+	switch t.Kind() {
+	case types.BoolKind:
+		return graphql.Boolean
+	case types.NumberKind:
+		return graphql.Float
+	case types.StringKind:
+		return graphql.String
+	case types.BlobKind:
+		return c.blob()
+	case types.StructKind:
+		return c.structObject(t, enclosing)
+	case types.CycleKind:
+		return enclosing[len(enclosing)-1-int(t.Desc.(types.CycleDesc))]
+	case types.ListKind, types.SetKind:
+		return c.collection(t, c.output(t.Desc.(types.CompoundDesc).ElemTypes[0], enclosing))
+	case types.MapKind:
+		elemTypes := t.Desc.(types.CompoundDesc).ElemTypes
+		return c.mapObject(c.output(elemTypes[0], enclosing), c.output(elemTypes[1], enclosing))
+	case types.RefKind:
+		return c.ref(c.output(t.Desc.(types.CompoundDesc).ElemTypes[0], enclosing))
+	case types.UnionKind:
+		return c.union(t.Desc.(types.CompoundDesc).ElemTypes, enclosing)
+	}
+	return valueScalar
+}
+
+// structKey identifies a struct type: by its hash, or if it has Cycles that refer to structs outside it, by its encoding and the structs it's in.
+func structKey(t *types.Type, enclosing []*graphql.Object) string {
+	if !t.HasUnresolvedCycle() {
+		return t.Hash().String()
+	}
+	names := make([]string, len(enclosing))
+	for i, o := range enclosing {
+		names[i] = o.Name()
+	}
+	return t.Describe() + " in " + strings.Join(names, ", ")
+}
+
+func (c *converter) structObject(t *types.Type, enclosing []*graphql.Object) *graphql.Object {
+	key := structKey(t, enclosing)
+	if o, ok := c.structs[key]; ok {
+		return o
+	}
+	desc := t.Desc.(types.StructDesc)
+	name := desc.Name
+	if name == "" {
+		name = "Struct"
+	}
+	var o *graphql.Object
+	// The fields are made once the object is, so that Cycles in them can refer to it.
+	o = graphql.NewObject(graphql.ObjectConfig{
+		Name: c.unique(name),
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			inner := append(append([]*graphql.Object{}, enclosing...), o)
+			fields := graphql.Fields{}
+			desc.IterFields(func(name string, ft *types.Type) {
+				fields[name] = &graphql.Field{
+					Type: c.output(ft, inner),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						if v, ok := p.Source.(types.Struct).MaybeGet(name); ok {
+							return goValue(v), nil
+						}
+						return nil, nil
+					},
+				}
+			})
+			if len(fields) == 0 {
+				// GraphQL objects must have a field, so empty structs have their hash.
+				fields["hash"] = &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(types.Struct).Hash().String(), nil
+					},
+				}
+			}
+			return fields
+		}),
+	})
+	c.structs[key] = o
+	return o
+}
+
+// derive returns the type derived with |name|, making it with |build|, given the unique name to give it, if it hasn't been already.
+func (c *converter) derive(name string, build func(name string) graphql.Output) graphql.Output {
+	if t, ok := c.derived[name]; ok {
+		return t
+	}
+	t := build(c.unique(name))
+	c.derived[name] = t
+	return t
+}
+
+func (c *converter) blob() graphql.Output {
+	return c.derive("Blob", func(name string) graphql.Output {
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				"size": sizeField(),
+			},
+		})
+	})
+}
+
+// collection returns the object for a List or Set of |elem|s.
+func (c *converter) collection(t *types.Type, elem graphql.Output) graphql.Output {
+	kind := types.KindToString[t.Kind()]
+	var ordered graphql.Output
+	if t.Kind() == types.SetKind {
+		ordered = elem
+	}
+	return c.derive(elem.Name()+kind, func(name string) graphql.Output {
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				"size": sizeField(),
+				"values": &graphql.Field{
+					Type: graphql.NewList(elem),
+					Args: pageArgs(ordered),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						values := []interface{}{}
+						err := iterPage(p, func(cb func(k, v types.Value) bool) {
+							switch coll := p.Source.(type) {
+							case types.List:
+								iterList(coll, p, cb)
+							case types.Set:
+								iterSet(coll, p, cb)
+							}
+						}, func(k, v types.Value) {
+							values = append(values, goValue(v))
+						})
+						return values, err
+					},
+				},
+			},
+		})
+	})
+}
+
+// mapEntry is an entry of a Map, which is the source of the fields of the object for it.
+type mapEntry struct {
+	key, value types.Value
+}
+
+func (c *converter) mapObject(key, value graphql.Output) graphql.Output {
+	base := key.Name() + "To" + value.Name()
+	return c.derive(base+"Map", func(name string) graphql.Output {
+		entry := graphql.NewObject(graphql.ObjectConfig{
+			Name: c.unique(base + "Entry"),
+			Fields: graphql.Fields{
+				"key": &graphql.Field{
+					Type: key,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return goValue(p.Source.(mapEntry).key), nil
+					},
+				},
+				"value": &graphql.Field{
+					Type: value,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return goValue(p.Source.(mapEntry).value), nil
+					},
+				},
+			},
+		})
+		page := func(t graphql.Output, f func(k, v types.Value) interface{}) *graphql.Field {
+			args := pageArgs(key)
+			if in, ok := key.(*graphql.Scalar); ok && in != valueScalar {
+				args["key"] = &graphql.ArgumentConfig{Type: in, Description: "the key of the one entry to return, if there is one"}
+			}
+			return &graphql.Field{
+				Type: graphql.NewList(t),
+				Args: args,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					m := p.Source.(types.Map)
+					results := []interface{}{}
+					err := iterPage(p, func(cb func(k, v types.Value) bool) {
+						if k, ok := p.Args["key"]; ok {
+							if v, ok := m.MaybeGet(nomsValue(k)); ok {
+								cb(nomsValue(k), v)
+							}
+							return
+						}
+						if from, ok := p.Args["from"]; ok {
+							m.IterFrom(nomsValue(from), cb)
+							return
+						}
+						m.Iter(cb)
+					}, func(k, v types.Value) {
+						results = append(results, f(k, v))
+					})
+					return results, err
+				},
+			}
+		}
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				"size": sizeField(),
+				"entries": page(entry, func(k, v types.Value) interface{} {
+					return mapEntry{k, v}
+				}),
+				"keys": page(key, func(k, v types.Value) interface{} {
+					return goValue(k)
+				}),
+				"values": page(value, func(k, v types.Value) interface{} {
+					return goValue(v)
+				}),
+			},
+		})
+	})
+}
+
+func (c *converter) ref(target graphql.Output) graphql.Output {
+	return c.derive(target.Name()+"Ref", func(name string) graphql.Output {
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				"targetHash": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(types.Ref).TargetHash().String(), nil
+					},
+				},
+				"targetValue": &graphql.Field{
+					Type: target,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						r := p.Source.(types.Ref)
+						v := p.Context.Value(vrKey{}).(types.ValueReader).ReadValue(r.TargetHash())
+						if v == nil {
+							return nil, fmt.Errorf("Ref to missing value #%s", r.TargetHash())
+						}
+						return goValue(v), nil
+					},
+				},
+			},
+		})
+	})
+}
+
+// union returns the type for a union of |members|. If they all have the same GraphQL type, that's it; otherwise, it's a GraphQL union of their objects, with the scalars among them wrapped in objects.
+func (c *converter) union(members []*types.Type, enclosing []*graphql.Object) graphql.Output {
+	outputs := []graphql.Output{}
+	kinds := map[string][]*types.Type{}
+	for _, m := range members {
+		o := c.output(m, enclosing)
+		if _, ok := kinds[o.Name()]; !ok {
+			outputs = append(outputs, o)
+		}
+		kinds[o.Name()] = append(kinds[o.Name()], m)
+	}
+	if len(outputs) == 0 {
+		return valueScalar
+	}
+	if len(outputs) == 1 {
+		return outputs[0]
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Name() < outputs[j].Name()
+	})
+	names := make([]string, len(outputs))
+	for i, o := range outputs {
+		names[i] = o.Name()
+	}
+	return c.derive(strings.Join(names, "Or"), func(name string) graphql.Output {
+		objects := make([]*graphql.Object, len(outputs))
+		for i, o := range outputs {
+			objects[i] = c.wrap(o)
+		}
+		return graphql.NewUnion(graphql.UnionConfig{
+			Name:  name,
+			Types: objects,
+			ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+				return objects[memberOf(p.Value, outputs, kinds)]
+			},
+		})
+	})
+}
+
+// wrap returns |o| if it's an object, or the object for it as a member of a union if it's a scalar.
+func (c *converter) wrap(o graphql.Output) *graphql.Object {
+	if obj, ok := o.(*graphql.Object); ok {
+		return obj
+	}
+	return c.derive(o.Name()+"Value", func(name string) graphql.Output {
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				scalarValueField: &graphql.Field{
+					Type: o,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		})
+	}).(*graphql.Object)
+}
+
+// memberOf returns the index of the one of |outputs| that |v|, as returned by goValue, is a value of, where |kinds| are the Noms types each is the type of.
+func memberOf(v interface{}, outputs []graphql.Output, kinds map[string][]*types.Type) int {
+	nv := nomsValue(v)
+	t := nv.Type()
+	best, bestScore := 0, -1
+	for i, o := range outputs {
+		for _, mt := range kinds[o.Name()] {
+			score := -1
+			switch {
+			case !mt.HasUnresolvedCycle() && mt.Equals(t):
+				score = 2
+			case mt.Kind() == t.Kind() && (t.Kind() != types.StructKind || mt.Desc.(types.StructDesc).Name == t.Desc.(types.StructDesc).Name):
+				score = 1
+			case mt.Kind() == t.Kind():
+				score = 0
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+	}
+	return best
+}
+
+func sizeField() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Float,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return float64(p.Source.(types.Collection).Len()), nil
+		},
+	}
+}
+
+// pageArgs are the arguments of the fields that return the values of a collection: at, the index of the first to return, and count, how many to return at most. If the values of a Set, or the keys of a Map, are |ordered| Bools, Numbers or Strings, from, the first of them to return, can be given too, and at counts from there.
+func pageArgs(ordered graphql.Output) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"at":    &graphql.ArgumentConfig{Type: graphql.Int, Description: "the index of the first value to return"},
+		"count": &graphql.ArgumentConfig{Type: graphql.Int, Description: "the most values to return"},
+	}
+	if in, ok := ordered.(*graphql.Scalar); ok && in != valueScalar {
+		args["from"] = &graphql.ArgumentConfig{Type: in, Description: "the first value, or key, to return"}
+	}
+	return args
+}
+
+// iterPage calls |page| with |cb| for each value, in the page the at and count arguments of |p| ask for, of those |iter| iterates over.
+func iterPage(p graphql.ResolveParams, iter func(cb func(k, v types.Value) bool), cb func(k, v types.Value)) error {
+	at, _ := p.Args["at"].(int)
+	count, hasCount := p.Args["count"].(int)
+	if at < 0 || count < 0 {
+		return fmt.Errorf("at and count must not be negative")
+	}
+	if hasCount && count == 0 {
+		return nil
+	}
+	if _, isList := p.Source.(types.List); isList {
+		// Lists skip to at themselves.
+		at = 0
+	}
+	i := 0
+	iter(func(k, v types.Value) bool {
+		if i >= at {
+			cb(k, v)
+		}
+		i++
+		return hasCount && i >= at+count
+	})
+	return nil
+}
+
+func iterList(l types.List, p graphql.ResolveParams, cb func(k, v types.Value) bool) {
+	at, _ := p.Args["at"].(int)
+	if uint64(at) >= l.Len() {
+		return
+	}
+	it := l.IteratorAt(uint64(at))
+	for i := uint64(at); i < l.Len(); i++ {
+		if cb(types.Number(i), it.Next()) {
+			return
+		}
+	}
+}
+
+func iterSet(s types.Set, p graphql.ResolveParams, cb func(k, v types.Value) bool) {
+	it := s.Iterator()
+	var v types.Value
+	if from, ok := p.Args["from"]; ok {
+		v = it.SkipTo(nomsValue(from))
+	} else {
+		v = it.Next()
+	}
+	for ; v != nil; v = it.Next() {
+		if cb(v, v) {
+			return
+		}
+	}
+}
+
+// goValue returns what a resolver returns for |v|: a bool, float64 or string for a Bool, Number or String, and otherwise v.
+func goValue(v types.Value) interface{} {
+	switch v := v.(type) {
+	case types.Bool:
+		return bool(v)
+	case types.Number:
+		return float64(v)
+	case types.String:
+		return string(v)
+	}
+	return v
+}
+
+// nomsValue undoes goValue. GraphQL arguments can also be ints, which it returns as Numbers.
+func nomsValue(v interface{}) types.Value {
+	switch v := v.(type) {
+	case bool:
+		return types.Bool(v)
+	case float64:
+		return types.Number(v)
+	case int:
+		return types.Number(v)
+	case string:
+		return types.String(v)
+	}
+	return v.(types.Value)
+}
+
+// valueScalar is the type of values that don't have a GraphQL type of their own. It's serialized as the JSON for a Bool, Number or String, and as the Noms encoding of anything else. It can't be an argument.
+var valueScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Value",
+	Description: "A Noms value: a Bool, Number or String as itself, and anything else as its Noms encoding",
+	Serialize: func(v interface{}) interface{} {
+		if nv, ok := v.(types.Value); ok {
+			return types.EncodedValue(nv)
+		}
+		return v
+	},
+	ParseValue: func(v interface{}) interface{} {
+		return nil
+	},
+	ParseLiteral: func(v ast.Value) interface{} {
+		return nil
+	},
+})
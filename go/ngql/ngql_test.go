@@ -0,0 +1,101 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package ngql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+// query runs |q| against |v| and returns the JSON of the result.
+func query(t *testing.T, v types.Value, vr types.ValueReader, q string) string {
+	res := Query(context.Background(), v, vr, q, nil, "")
+	data, err := json.Marshal(res)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestQueryScalarsAndStructs(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	assert.Equal(`{"data":{"value":42}}`, query(t, types.Number(42), vs, "{value}"))
+	assert.Equal(`{"data":{"value":"hi"}}`, query(t, types.String("hi"), vs, "{value}"))
+	assert.Equal(`{"data":{"value":true}}`, query(t, types.Bool(true), vs, "{value}"))
+
+	person := types.NewStruct("Person", types.StructData{
+		"name":    types.String("Alice"),
+		"age":     types.Number(30),
+		"address": types.NewStruct("", types.StructData{"city": types.String("Paris")}),
+		"meta":    types.NewStruct("Meta", types.StructData{}),
+	})
+	assert.Equal(`{"data":{"value":{"address":{"city":"Paris"},"name":"Alice"}}}`, query(t, person, vs, "{value {name address {city}}}"))
+	assert.Contains(query(t, person, vs, "{value {meta {hash}}}"), types.NewStruct("Meta", types.StructData{}).Hash().String())
+	assert.Contains(query(t, person, vs, "{value {nope}}"), `Cannot query field \"nope\"`)
+}
+
+func TestQueryCollections(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	list := types.NewList(types.String("a"), types.String("b"), types.String("c"), types.String("d"))
+	assert.Equal(`{"data":{"value":{"size":4,"values":["a","b","c","d"]}}}`, query(t, list, vs, "{value {size values}}"))
+	assert.Equal(`{"data":{"value":{"values":["b","c"]}}}`, query(t, list, vs, "{value {values(at: 1, count: 2)}}"))
+	assert.Equal(`{"data":{"value":{"values":[]}}}`, query(t, list, vs, "{value {values(at: 10)}}"))
+	assert.Contains(query(t, list, vs, "{value {values(at: -1)}}"), "must not be negative")
+
+	set := types.NewSet(types.Number(1), types.Number(2), types.Number(3), types.Number(4))
+	assert.Equal(`{"data":{"value":{"values":[2,3]}}}`, query(t, set, vs, "{value {values(at: 1, count: 2)}}"))
+	assert.Equal(`{"data":{"value":{"values":[3,4]}}}`, query(t, set, vs, "{value {values(from: 2.5)}}"))
+
+	m := types.NewMap(
+		types.String("a"), types.Number(1),
+		types.String("b"), types.Number(2),
+		types.String("c"), types.Number(3),
+	)
+	assert.Equal(`{"data":{"value":{"entries":[{"key":"a","value":1},{"key":"b","value":2}],"keys":["c"],"size":3,"values":[2]}}}`,
+		query(t, m, vs, `{value {size entries(count: 2) {key value} keys(from: "bb") values(key: "b")}}`))
+
+	// Lists of unions have objects for each member, with the scalars wrapped.
+	mixed := types.NewList(types.Number(1), types.String("two"), types.NewStruct("Three", types.StructData{"n": types.Number(3)}))
+	assert.Equal(`{"data":{"value":{"values":[{"number":1},{"string":"two"},{"n":3}]}}}`,
+		query(t, mixed, vs, "{value {values {... on FloatValue {number: scalarValue} ... on StringValue {string: scalarValue} ... on Three {n}}}}"))
+}
+
+func TestQueryRefs(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	// Nodes refer to their parents through a Cycle, as Commits do, so they can be followed as far back as there are nodes.
+	nodeType := types.MakeStructType("Node",
+		[]string{"parents", "value"},
+		[]*types.Type{types.MakeSetType(types.MakeRefType(types.MakeCycleType(0))), types.StringType},
+	)
+	first := types.NewStructWithType(nodeType, types.ValueSlice{types.NewSet(), types.String("first")})
+	second := types.NewStructWithType(nodeType, types.ValueSlice{types.NewSet(vs.WriteValue(first)), types.String("second")})
+	res := query(t, second, vs, "{value {value parents {values {targetValue {value parents {size}}}}}}")
+	assert.Equal(`{"data":{"value":{"parents":{"values":[{"targetValue":{"parents":{"size":0},"value":"first"}}]},"value":"second"}}}`, res)
+
+	r := vs.WriteValue(types.Number(7))
+	assert.Equal(`{"data":{"value":{"targetHash":"`+r.TargetHash().String()+`","targetValue":7}}}`, query(t, r, vs, "{value {targetHash targetValue}}"))
+}
+
+func TestSchemaNames(t *testing.T) {
+	assert := assert.New(t)
+	v := types.NewStruct("Query", types.StructData{
+		"a": types.NewStruct("S", types.StructData{"x": types.Number(1)}),
+		"b": types.NewStruct("S", types.StructData{"y": types.Number(1)}),
+		"c": types.NewMap(types.String("k"), types.NewList(types.Number(1))),
+	})
+	s, err := NewSchema(v.Type())
+	assert.NoError(err)
+	for _, name := range []string{"Query", "Query_2", "S", "S_2", "FloatList", "StringToFloatListMap", "StringToFloatListEntry"} {
+		assert.NotNil(s.Type(name), name)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package gen generates synthetic datasets for benchmarking Noms, and runs benchmark scenarios over them, so that the performance of chunk stores can be compared, and tracked over time, on the same data.
+//
+// A Gen makes values from a seed: two Gens with the same seed make the same values, with the same hashes, every time. Scenarios, e.g. Import, Iterate, Diff and Sync, each time one operation over values a Gen makes, and Bench runs them against each of the Stores as Go benchmarks, e.g.
+//
+//  func BenchmarkScenarios(b *testing.B) {
+//    gen.Bench(b, gen.Scenarios, gen.Stores, 10000)
+//  }
+package gen
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyz"
+
+// Gen makes values that are random, but the same every time for the same seed.
+type Gen struct {
+	r *rand.Rand
+}
+
+// New returns a Gen that makes values from |seed|.
+func New(seed int64) *Gen {
+	return &Gen{rand.New(rand.NewSource(seed))}
+}
+
+// Number returns a random Number.
+func (g *Gen) Number() types.Number {
+	return types.Number(g.r.Int63n(1 << 40))
+}
+
+// String returns a random String of |n| lowercase letters.
+func (g *Gen) String(n int) types.String {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[g.r.Intn(len(letters))]
+	}
+	return types.String(b)
+}
+
+// Record returns a Struct like a row of imported data: an id, a name, a score, a flag and a List of tags.
+func (g *Gen) Record() types.Struct {
+	tags := make([]types.Value, g.r.Intn(4))
+	for i := range tags {
+		tags[i] = g.String(6)
+	}
+	return types.NewStruct("Record", types.StructData{
+		"id":     g.Number(),
+		"name":   g.String(12),
+		"score":  types.Number(g.r.Float64() * 100),
+		"active": types.Bool(g.r.Intn(2) == 0),
+		"tags":   types.NewList(tags...),
+	})
+}
+
+// DeepStruct returns a Struct nested |depth| levels deep, each level of which has |width| fields of Numbers and Strings, and a "child" field with the next level in it.
+func (g *Gen) DeepStruct(depth, width int) types.Struct {
+	data := types.StructData{}
+	for i := 0; i < width; i++ {
+		if i%2 == 0 {
+			data[fmt.Sprintf("n%d", i)] = g.Number()
+		} else {
+			data[fmt.Sprintf("s%d", i)] = g.String(8)
+		}
+	}
+	if depth > 1 {
+		data["child"] = g.DeepStruct(depth-1, width)
+	}
+	return types.NewStruct("Deep", data)
+}
+
+// Key returns the |i|th key of the Maps WideMap makes.
+func Key(i int) types.String {
+	return types.String(fmt.Sprintf("key-%08d", i))
+}
+
+// WideMap returns a Map of |n| Keys to Records, built in |vrw|, which it writes the chunks of as it goes.
+func (g *Gen) WideMap(vrw types.ValueReadWriter, n int) types.Map {
+	kvs := make(chan types.Value)
+	out := types.NewStreamingMap(vrw, kvs)
+	for i := 0; i < n; i++ {
+		kvs <- Key(i)
+		kvs <- g.Record()
+	}
+	close(kvs)
+	return <-out
+}
+
+// EditMap returns |m|, which WideMap made, with |edits| random Keys of it set to new Records.
+func (g *Gen) EditMap(m types.Map, edits int) types.Map {
+	n := int(m.Len())
+	for i := 0; i < edits; i++ {
+		m = m.Set(Key(g.r.Intn(n)), g.Record())
+	}
+	return m
+}
+
+// BigBlob returns a Blob of |size| random bytes, built in |vrw|, which it writes the chunks of as it goes.
+func (g *Gen) BigBlob(vrw types.ValueReadWriter, size int) types.Blob {
+	return types.NewStreamingBlob(vrw, io.LimitReader(g.r, int64(size)))
+}
+
+// History commits a WideMap of |n| entries to |ds| in |db|, and then |commits|-1 more versions of it, each with |edits| entries changed, returning the dataset as it is afterwards.
+func (g *Gen) History(db datas.Database, ds datas.Dataset, commits, n, edits int) (datas.Dataset, error) {
+	m := g.WideMap(db, n)
+	for i := 0; i < commits; i++ {
+		if i > 0 {
+			m = g.EditMap(m, edits)
+		}
+		var err error
+		if ds, err = db.CommitValue(ds, m); err != nil {
+			return ds, err
+		}
+	}
+	return ds, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package gen
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestReproducible(t *testing.T) {
+	assert := assert.New(t)
+	values := func(seed int64) []types.Value {
+		g := New(seed)
+		vs := types.NewTestValueStore()
+		m := g.WideMap(vs, 1000)
+		return []types.Value{g.DeepStruct(5, 10), m, g.EditMap(m, 10), g.BigBlob(vs, 1<<16)}
+	}
+
+	a, b, c := values(1), values(1), values(2)
+	for i := range a {
+		assert.True(a[i].Equals(b[i]))
+		assert.False(a[i].Equals(c[i]))
+	}
+	assert.Equal(uint64(1000), a[1].(types.Map).Len())
+	assert.Equal(uint64(1<<16), a[3].(types.Blob).Len())
+	assert.True(a[0].(types.Struct).Get("child").(types.Struct).Get("child").(types.Struct).Get("s1").(types.String) != "")
+}
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	ds, err := New(Seed).History(db, db.GetDataset("ds"), 3, 100, 5)
+	assert.NoError(err)
+	commits := 0
+	for c, ok := ds.MaybeHead(); ok; {
+		commits++
+		parents := c.Get(datas.ParentsField).(types.Set)
+		if ok = !parents.Empty(); ok {
+			c = parents.First().(types.Ref).TargetValue(db).(types.Struct)
+		}
+	}
+	assert.Equal(3, commits)
+	assert.Equal(uint64(100), ds.HeadValue().(types.Map).Len())
+}
+
+func TestScenarios(t *testing.T) {
+	for _, sc := range Scenarios {
+		for _, st := range Stores {
+			cs, cleanup := st.New()
+			db := datas.NewDatabase(cs)
+			sc.Prepare(New(Seed), db, 100)()
+			db.Close()
+			cleanup()
+		}
+	}
+}
+
+func BenchmarkScenarios(b *testing.B) {
+	Bench(b, Scenarios, Stores, 10000)
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Seed is the seed Bench makes the values of each scenario from, so that every run benchmarks the same data.
+const Seed = 0
+
+// Scenario is an operation to benchmark. Prepare makes what the operation needs in |db|, with values from |g| and sized by |n|, and returns a function that does the operation once, which is what's timed.
+type Scenario struct {
+	Name    string
+	Prepare func(g *Gen, db datas.Database, n int) (run func())
+}
+
+// Store is a kind of ChunkStore to run Scenarios against. New returns a new, empty, one, and a function that cleans up after it once the Database it's given to has been closed, which closes it.
+type Store struct {
+	Name string
+	New  func() (cs chunks.ChunkStore, cleanup func())
+}
+
+var (
+	// Import commits a WideMap of n entries.
+	Import = Scenario{"Import", func(g *Gen, db datas.Database, n int) func() {
+		return func() {
+			_, err := db.CommitValue(db.GetDataset("import"), g.WideMap(db, n))
+			d.PanicIfError(err)
+		}
+	}}
+
+	// Iterate reads every entry of a committed WideMap of n entries.
+	Iterate = Scenario{"Iterate", func(g *Gen, db datas.Database, n int) func() {
+		ds, err := db.CommitValue(db.GetDataset("iterate"), g.WideMap(db, n))
+		d.PanicIfError(err)
+		h := ds.HeadRef().TargetHash()
+		return func() {
+			count := 0
+			db.ReadValue(h).(types.Struct).Get(datas.ValueField).(types.Map).IterAll(func(k, v types.Value) {
+				v.(types.Struct).Get("score")
+				count++
+			})
+			d.PanicIfFalse(count == n)
+		}
+	}}
+
+	// Diff diffs two commits of a WideMap of n entries, one percent of which differ between them.
+	Diff = Scenario{"Diff", func(g *Gen, db datas.Database, n int) func() {
+		ds, err := g.History(db, db.GetDataset("diff"), 2, n, n/100+1)
+		d.PanicIfError(err)
+		newer := ds.Head()
+		older := newer.Get(datas.ParentsField).(types.Set).First().(types.Ref).TargetHash()
+		return func() {
+			last := db.ReadValue(older).(types.Struct).Get(datas.ValueField).(types.Map)
+			changes := make(chan types.ValueChanged)
+			go func() {
+				newer.Get(datas.ValueField).(types.Map).Diff(last, changes, nil)
+				close(changes)
+			}()
+			for range changes {
+			}
+		}
+	}}
+
+	// Sync pulls a history of 10 commits of a WideMap of n entries from a database in memory, and makes it the head of a dataset.
+	Sync = Scenario{"Sync", func(g *Gen, db datas.Database, n int) func() {
+		src := datas.NewDatabase(chunks.NewMemoryStore())
+		ds, err := g.History(src, src.GetDataset("sync"), 10, n, n/100+1)
+		d.PanicIfError(err)
+		return func() {
+			defer src.Close()
+			datas.Pull(src, db, ds.HeadRef(), types.Ref{}, 4, nil)
+			_, err := db.SetHead(db.GetDataset("sync"), ds.HeadRef())
+			d.PanicIfError(err)
+		}
+	}}
+
+	// Scenarios are the scenarios Bench usually runs.
+	Scenarios = []Scenario{Import, Iterate, Diff, Sync}
+
+	// Stores are the kinds of ChunkStores Bench usually runs scenarios against: one in memory, and a LevelDB in a temporary directory.
+	Stores = []Store{
+		{"mem", func() (chunks.ChunkStore, func()) {
+			return chunks.NewMemoryStore(), func() {}
+		}},
+		{"ldb", func() (chunks.ChunkStore, func()) {
+			dir, err := ioutil.TempDir("", "noms-gen")
+			d.PanicIfError(err)
+			return chunks.NewLevelDBStore(dir, "", 24, false), func() {
+				os.RemoveAll(dir)
+			}
+		}},
+	}
+)
+
+// Bench runs each of |scenarios| against each of |stores|, with values sized by |n|, as a sub-benchmark of |b| named for both, e.g. Import/ldb. Each time a scenario is run, it's prepared in a new Database on a new store, with values from a Gen seeded with Seed, and only its operation is timed.
+func Bench(b *testing.B, scenarios []Scenario, stores []Store, n int) {
+	for _, sc := range scenarios {
+		for _, st := range stores {
+			sc, st := sc, st
+			b.Run(sc.Name+"/"+st.Name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					cs, cleanup := st.New()
+					db := datas.NewDatabase(cs)
+					run := sc.Prepare(New(Seed), db, n)
+					b.StartTimer()
+					run()
+					b.StopTimer()
+					db.Close()
+					cleanup()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/stormasm/noms/go/types"
+)
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	// quotedToken is an identifier in double quotes, which is never a keyword.
+	quotedToken
+	stringToken
+	numberToken
+	symbolToken
+	endToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(keyword string) bool {
+	return (t.kind == identToken && strings.EqualFold(t.text, keyword)) || (t.kind == symbolToken && t.text == keyword)
+}
+
+func (t token) String() string {
+	if t.kind == endToken {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// symbols are the operators and punctuation of a query, longest first so that they're matched greedily.
+var symbols = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*"}
+
+// lex splits |sql| into tokens, ending with an endToken.
+func lex(sql string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(sql); {
+		c := rune(sql[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			text := []byte{}
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, fmt.Errorf("Invalid query, unterminated %c", c)
+				}
+				if rune(sql[j]) == c {
+					// Quotes are escaped by doubling them.
+					if j+1 < len(sql) && rune(sql[j+1]) == c {
+						text = append(text, sql[j])
+						j += 2
+						continue
+					}
+					break
+				}
+				text = append(text, sql[j])
+				j++
+			}
+			kind := stringToken
+			if c == '"' {
+				kind = quotedToken
+			}
+			tokens = append(tokens, token{kind, string(text)})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(sql) && unicode.IsDigit(rune(sql[i+1]))) || (c == '.' && i+1 < len(sql) && unicode.IsDigit(rune(sql[i+1]))):
+			j := i + 1
+			for j < len(sql) && (unicode.IsDigit(rune(sql[j])) || strings.ContainsRune(".eE", rune(sql[j])) || ((sql[j] == '-' || sql[j] == '+') && strings.ContainsRune("eE", rune(sql[j-1])))) {
+				j++
+			}
+			tokens = append(tokens, token{numberToken, sql[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(sql) && (unicode.IsLetter(rune(sql[j])) || unicode.IsDigit(rune(sql[j])) || sql[j] == '_' || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{identToken, sql[i:j]})
+			i = j
+		default:
+			found := false
+			for _, sym := range symbols {
+				if strings.HasPrefix(sql[i:], sym) {
+					tokens = append(tokens, token{symbolToken, sym})
+					i += len(sym)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("Invalid query, unexpected %q", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: endToken}), nil
+}
+
+// parser parses a query from its tokens.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != endToken {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's |keyword|, and returns whether it was.
+func (p *parser) accept(keyword string) bool {
+	if p.peek().is(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(keyword string) error {
+	if !p.accept(keyword) {
+		return fmt.Errorf("Invalid query, expected %s but found %s", keyword, p.peek())
+	}
+	return nil
+}
+
+// keywords can't be used as field names without quoting them.
+var keywords = []string{"SELECT", "FROM", "WHERE", "ORDER", "BY", "ASC", "DESC", "LIMIT", "OFFSET", "AND", "OR", "NOT", "IS", "NULL", "LIKE", "IN", "AS", "TRUE", "FALSE"}
+
+func isKeyword(t token) bool {
+	for _, kw := range keywords {
+		if t.is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// name parses the name of a field, or of the source of a query.
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t.kind == quotedToken || (t.kind == identToken && !isKeyword(t)) {
+		return t.text, nil
+	}
+	return "", fmt.Errorf("Invalid query, expected a name but found %s", t)
+}
+
+// Parse parses |sql|, a query of the form:
+//
+//   SELECT * | <field> [AS <name>], ... FROM <source> [WHERE <condition>] [ORDER BY <field> [ASC | DESC], ...] [LIMIT <n> [OFFSET <m>]]
+//
+// Fields are the fields of the structs being queried, which may be nested, e.g. address.city, or _key, which is the key of each row of a Map, or the index of each row of a List. Conditions compare fields with each other and with literals, which are 'strings', numbers, TRUE, FALSE and NULL, using =, != (or <>), <, <=, > and >=, IS [NOT] NULL, [NOT] LIKE, with % and _ as wildcards, and [NOT] IN (<literal>, ...), and combine them with AND, OR, NOT and parentheses. Keywords aren't case sensitive, and names that are keywords, or that aren't just letters, digits, underscores and dots, can be put in double quotes, e.g. FROM "ldb:/data::people".
+func Parse(sql string) (*Query, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q := &Query{Limit: -1}
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	if !p.accept("*") {
+		for {
+			f := Field{}
+			if f.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			f.As = defaultFieldName(f.Name)
+			if p.accept("AS") {
+				if f.As, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if !types.IsValidStructFieldName(f.As) {
+				return nil, fmt.Errorf("Invalid query, %s can't be a field of a result, so it needs a name given with AS", f.As)
+			}
+			q.Fields = append(q.Fields, f)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	if q.From, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.accept("WHERE") {
+		if q.Where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			o := Order{}
+			if o.Field, err = p.name(); err != nil {
+				return nil, err
+			}
+			if p.accept("DESC") {
+				o.Desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		if q.Limit, err = p.count(); err != nil {
+			return nil, err
+		}
+		if p.accept("OFFSET") {
+			if q.Offset, err = p.count(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if t := p.next(); t.kind != endToken {
+		return nil, fmt.Errorf("Invalid query, unexpected %s", t)
+	}
+	return q, nil
+}
+
+// defaultFieldName is the name of the field of a result that |name| is selected as: its last part, or key for _key.
+func defaultFieldName(name string) string {
+	if name == keyField {
+		return "key"
+	}
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func (p *parser) count() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != numberToken || err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid query, expected a count but found %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) or() (Expr, error) {
+	e, err := p.and()
+	for err == nil && p.accept("OR") {
+		var r Expr
+		if r, err = p.and(); err == nil {
+			e = binaryExpr{"OR", e, r}
+		}
+	}
+	return e, err
+}
+
+func (p *parser) and() (Expr, error) {
+	e, err := p.not()
+	for err == nil && p.accept("AND") {
+		var r Expr
+		if r, err = p.not(); err == nil {
+			e = binaryExpr{"AND", e, r}
+		}
+	}
+	return e, err
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.accept("NOT") {
+		e, err := p.not()
+		return notExpr{e}, err
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<>", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			if op == "<>" {
+				op = "!="
+			}
+			r, err := p.operand()
+			return binaryExpr{op, l, r}, err
+		}
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return negate(isNullExpr{l}, not), nil
+	}
+	not := p.accept("NOT")
+	if p.accept("LIKE") {
+		t := p.next()
+		if t.kind != stringToken {
+			return nil, fmt.Errorf("Invalid query, expected a pattern after LIKE but found %s", t)
+		}
+		return negate(newLikeExpr(l, t.text), not), nil
+	}
+	if p.accept("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := inExpr{e: l}
+		for {
+			r, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := r.(literal); !ok {
+				return nil, fmt.Errorf("Invalid query, IN can only have literals")
+			}
+			in.list = append(in.list, r.(literal).v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return negate(in, not), nil
+	}
+	if not {
+		return nil, fmt.Errorf("Invalid query, expected LIKE or IN after NOT but found %s", p.peek())
+	}
+	return l, nil
+}
+
+func negate(e Expr, not bool) Expr {
+	if not {
+		return notExpr{e}
+	}
+	return e
+}
+
+func (p *parser) operand() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.is("("):
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case t.kind == stringToken:
+		p.next()
+		return literal{types.String(t.text)}, nil
+	case t.kind == numberToken:
+		p.next()
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid query, bad number %s", t.text)
+		}
+		return literal{types.Number(n)}, nil
+	case t.is("TRUE"), t.is("FALSE"):
+		p.next()
+		return literal{types.Bool(t.is("TRUE"))}, nil
+	case t.is("NULL"):
+		p.next()
+		return literal{nil}, nil
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	return fieldExpr(name), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package query
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	q, err := Parse(`select name, address.city, _key AS id from "ldb:/data::people" where age >= 21 and not (name like 'a%' or email is null) order by age desc, name limit 10 offset 5`)
+	assert.NoError(err)
+	assert.Equal([]Field{{"name", "name"}, {"address.city", "city"}, {"_key", "id"}}, q.Fields)
+	assert.Equal("ldb:/data::people", q.From)
+	assert.Equal([]Order{{"age", true}, {"name", false}}, q.OrderBy)
+	assert.Equal(10, q.Limit)
+	assert.Equal(5, q.Offset)
+	and, ok := q.Where.(binaryExpr)
+	assert.True(ok)
+	assert.Equal("AND", and.op)
+	assert.Equal(binaryExpr{">=", fieldExpr("age"), literal{types.Number(21)}}, and.l)
+	assert.IsType(notExpr{}, and.r)
+
+	q, err = Parse("SELECT * FROM people WHERE name IN ('a', 'it''s') AND age <> -1.5")
+	assert.NoError(err)
+	assert.Nil(q.Fields)
+	assert.Equal(-1, q.Limit)
+	and = q.Where.(binaryExpr)
+	assert.Equal(inExpr{fieldExpr("name"), []types.Value{types.String("a"), types.String("it's")}}, and.l)
+	assert.Equal(binaryExpr{"!=", fieldExpr("age"), literal{types.Number(-1.5)}}, and.r)
+
+	for _, bad := range []string{
+		"",
+		"SELECT FROM people",
+		"SELECT * people",
+		"SELECT * FROM people WHERE",
+		"SELECT * FROM people WHERE name = 'unterminated",
+		"SELECT * FROM people WHERE name NOT = 'a'",
+		"SELECT * FROM people WHERE name IN (age)",
+		"SELECT * FROM people LIMIT -1",
+		"SELECT * FROM people LIMIT 10 extra",
+		"SELECT \"first name\" FROM people",
+		"SELECT * FROM people WHERE name ~ 'a'",
+	} {
+		_, err := Parse(bad)
+		assert.Error(err, bad)
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package query runs SQL-like queries, e.g. SELECT name, email FROM people WHERE age >= 21 ORDER BY name LIMIT 10, over the Lists and Maps of structs in Noms databases. Conditions on the keys of a Map are answered by looking them up, or by scanning the range of keys that can match, rather than by reading the whole Map, and so are conditions that a field equals a literal if the dataset being queried has an up to date index of that field.
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/index"
+	"github.com/stormasm/noms/go/types"
+)
+
+// keyField is the name queries use for the key of each row of a Map, or the index of each row of a List.
+const keyField = "_key"
+
+// Query is a parsed query; see Parse.
+type Query struct {
+	// Fields are the fields to select, or nil for SELECT *.
+	Fields []Field
+	// From names what to query. It isn't used by Run, which is given what to query; the noms query command takes it to be a dataset or a path.
+	From    string
+	Where   Expr
+	OrderBy []Order
+	// Limit is the most rows to return, or -1 for no limit. Offset is how many rows to skip first.
+	Limit  int
+	Offset int
+}
+
+// Field is a field to select: its Name in the rows queried, and the name it has in the results, As.
+type Field struct {
+	Name string
+	As   string
+}
+
+// Order is a field to order the results by, ascending unless Desc is set.
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// Expr is a condition of a query, or an operand of one. It evaluates to a Value, or nil for NULL; conditions are true if they evaluate to Bool(true).
+type Expr interface {
+	eval(r row) types.Value
+}
+
+// row is a row being queried: its key in the Map, or index in the List, and its value.
+type row struct {
+	key, value types.Value
+}
+
+type literal struct {
+	v types.Value
+}
+
+func (l literal) eval(r row) types.Value {
+	return l.v
+}
+
+// fieldExpr is a field of the rows, which may be nested, e.g. address.city. Rows that don't have it, or aren't structs, have NULL for it.
+type fieldExpr string
+
+func (f fieldExpr) eval(r row) types.Value {
+	if f == keyField {
+		return r.key
+	}
+	v := r.value
+	for _, part := range strings.Split(string(f), ".") {
+		s, ok := v.(types.Struct)
+		if !ok {
+			return nil
+		}
+		if v, ok = s.MaybeGet(part); !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+// binaryExpr is a comparison, or AND or OR. Comparisons with NULL are NULL, as are ordering comparisons between different kinds of values, and AND and OR follow SQL's three-valued logic.
+type binaryExpr struct {
+	op   string
+	l, r Expr
+}
+
+func (b binaryExpr) eval(r row) types.Value {
+	lv, rv := b.l.eval(r), b.r.eval(r)
+	switch b.op {
+	case "AND":
+		if lv == types.Bool(false) || rv == types.Bool(false) {
+			return types.Bool(false)
+		}
+		if lv == nil || rv == nil {
+			return nil
+		}
+		return types.Bool(lv == types.Bool(true) && rv == types.Bool(true))
+	case "OR":
+		if lv == types.Bool(true) || rv == types.Bool(true) {
+			return types.Bool(true)
+		}
+		if lv == nil || rv == nil {
+			return nil
+		}
+		return types.Bool(false)
+	}
+	if lv == nil || rv == nil {
+		return nil
+	}
+	switch b.op {
+	case "=":
+		return types.Bool(lv.Equals(rv))
+	case "!=":
+		return types.Bool(!lv.Equals(rv))
+	}
+	if lv.Type().Kind() != rv.Type().Kind() {
+		return nil
+	}
+	switch b.op {
+	case "<":
+		return types.Bool(lv.Less(rv))
+	case "<=":
+		return types.Bool(!rv.Less(lv))
+	case ">":
+		return types.Bool(rv.Less(lv))
+	case ">=":
+		return types.Bool(!lv.Less(rv))
+	}
+	panic("unreachable")
+}
+
+type notExpr struct {
+	e Expr
+}
+
+func (n notExpr) eval(r row) types.Value {
+	if b, ok := n.e.eval(r).(types.Bool); ok {
+		return !b
+	}
+	return nil
+}
+
+type isNullExpr struct {
+	e Expr
+}
+
+func (n isNullExpr) eval(r row) types.Value {
+	return types.Bool(n.e.eval(r) == nil)
+}
+
+// likeExpr matches strings with a LIKE pattern, in which % matches any run of characters and _ any one character. As in SQLite, it isn't case sensitive.
+type likeExpr struct {
+	e  Expr
+	re *regexp.Regexp
+}
+
+func newLikeExpr(e Expr, pattern string) likeExpr {
+	re := &strings.Builder{}
+	re.WriteString("(?is)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return likeExpr{e, regexp.MustCompile(re.String())}
+}
+
+func (l likeExpr) eval(r row) types.Value {
+	if s, ok := l.e.eval(r).(types.String); ok {
+		return types.Bool(l.re.MatchString(string(s)))
+	}
+	return nil
+}
+
+type inExpr struct {
+	e    Expr
+	list []types.Value
+}
+
+func (in inExpr) eval(r row) types.Value {
+	v := in.e.eval(r)
+	if v == nil {
+		return nil
+	}
+	for _, lv := range in.list {
+		if lv != nil && v.Equals(lv) {
+			return types.Bool(true)
+		}
+	}
+	return types.Bool(false)
+}
+
+// Run runs q over |v|, which must be a List or a Map, usually of structs, and returns a List of the results: the rows that match, or just the fields of them that are selected, as structs with the same names as the rows.
+func (q *Query) Run(v types.Value) (types.List, error) {
+	return q.run(v, nil)
+}
+
+// RunDataset runs q over the value at the head of |ds|, as Run does. If the condition has a top-level field equalling a literal, and ds has an index named by_<field> that has been updated with its head, the index is used to find the rows with that value; such an index is taken to be index.ByField("by_<field>", "<field>").
+func (q *Query) RunDataset(db datas.Database, ds datas.Dataset) (types.List, error) {
+	v, ok := ds.MaybeHeadValue()
+	if !ok {
+		return types.NewList(), fmt.Errorf("Dataset %s has no head to query", ds.ID())
+	}
+	return q.run(v, func(field string, key types.Value) (types.Map, bool) {
+		name := "by_" + field
+		if strings.Contains(field, ".") || !index.IsCurrent(db, ds.ID(), name) {
+			return types.Map{}, false
+		}
+		found, err := index.Lookup(db, ds.ID(), name, key)
+		return found, err == nil
+	})
+}
+
+// indexLookup returns the rows of a Map whose |field| is |key|, if there's an index to find them with.
+type indexLookup func(field string, key types.Value) (types.Map, bool)
+
+func (q *Query) run(v types.Value, lookup indexLookup) (types.List, error) {
+	switch v.(type) {
+	case types.List, types.Map:
+	default:
+		return types.NewList(), fmt.Errorf("Can only query a List or a Map, not a %s", v.Type().Describe())
+	}
+	p := q.plan(v, lookup)
+
+	// Scans are in key order, so they only need sorting if they're to be put in another.
+	sorted := len(q.OrderBy) == 0 || (len(q.OrderBy) == 1 && q.OrderBy[0].Field == keyField && !q.OrderBy[0].Desc)
+	rows := []row{}
+	p.scan(func(r row) bool {
+		if q.Where != nil && q.Where.eval(r) != types.Bool(true) {
+			return false
+		}
+		rows = append(rows, r)
+		return sorted && q.Limit >= 0 && len(rows) >= q.Offset+q.Limit
+	})
+	if !sorted {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, o := range q.OrderBy {
+				a, b := fieldExpr(o.Field).eval(rows[i]), fieldExpr(o.Field).eval(rows[j])
+				if o.Desc {
+					a, b = b, a
+				}
+				if less(a, b) {
+					return true
+				}
+				if less(b, a) {
+					return false
+				}
+			}
+			return false
+		})
+	}
+
+	if q.Offset >= len(rows) {
+		rows = rows[:0]
+	} else {
+		rows = rows[q.Offset:]
+	}
+	if q.Limit >= 0 && q.Limit < len(rows) {
+		rows = rows[:q.Limit]
+	}
+	results := make([]types.Value, len(rows))
+	for i, r := range rows {
+		results[i] = q.project(r)
+	}
+	return types.NewList(results...), nil
+}
+
+// less orders values for ORDER BY: NULLs first, and then in Noms' order.
+func less(a, b types.Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	return a.Less(b)
+}
+
+func (q *Query) project(r row) types.Value {
+	if q.Fields == nil {
+		return r.value
+	}
+	name := "Row"
+	if s, ok := r.value.(types.Struct); ok {
+		name = s.Type().Desc.(types.StructDesc).Name
+	}
+	data := types.StructData{}
+	for _, f := range q.Fields {
+		if v := fieldExpr(f.Name).eval(r); v != nil {
+			data[f.As] = v
+		}
+	}
+	return types.NewStruct(name, data)
+}
+
+// plan is how the rows that may match a query are found: by getting the one row with a key, looking them up in an index, scanning the range of keys between lower and upper, either of which may be nil if there's no bound, or scanning everything.
+type plan struct {
+	v            types.Value
+	get          types.Value
+	indexField   string
+	indexed      types.Map
+	lower, upper types.Value
+}
+
+func (p plan) String() string {
+	switch {
+	case p.get != nil:
+		return fmt.Sprintf("get %s = %s", keyField, types.EncodedValue(p.get))
+	case p.indexField != "":
+		return fmt.Sprintf("index lookup of %s", p.indexField)
+	case p.lower != nil || p.upper != nil:
+		bound := func(v types.Value) string {
+			if v == nil {
+				return "the end"
+			}
+			return types.EncodedValue(v)
+		}
+		return fmt.Sprintf("range scan of %s from %s to %s", keyField, bound(p.lower), bound(p.upper))
+	}
+	return "full scan"
+}
+
+// comparison is a condition that compares a field with a literal.
+type comparison struct {
+	field string
+	op    string
+	v     types.Value
+}
+
+// flipped are the comparison operators that mean the same with their operands swapped.
+var flipped = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// comparisons returns the comparisons of fields with literals that |e| requires to be true.
+func comparisons(e Expr) []comparison {
+	b, ok := e.(binaryExpr)
+	if !ok {
+		return nil
+	}
+	if b.op == "AND" {
+		return append(comparisons(b.l), comparisons(b.r)...)
+	}
+	op, ok := flipped[b.op]
+	if !ok {
+		return nil
+	}
+	if f, ok := b.l.(fieldExpr); ok {
+		if l, ok := b.r.(literal); ok && l.v != nil {
+			return []comparison{{string(f), b.op, l.v}}
+		}
+	}
+	if f, ok := b.r.(fieldExpr); ok {
+		if l, ok := b.l.(literal); ok && l.v != nil {
+			return []comparison{{string(f), op, l.v}}
+		}
+	}
+	return nil
+}
+
+// plan picks how to find the rows of |v| that may match q. The condition is still checked against every row found, so the plan only needs to find all of the rows that match, not only them.
+func (q *Query) plan(v types.Value, lookup indexLookup) plan {
+	p := plan{v: v}
+	cmps := comparisons(q.Where)
+	for _, c := range cmps {
+		if c.field == keyField && c.op == "=" {
+			p.get = c.v
+			return p
+		}
+	}
+	if _, ok := v.(types.Map); ok && lookup != nil {
+		for _, c := range cmps {
+			if c.field != keyField && c.op == "=" {
+				if found, ok := lookup(c.field, c.v); ok {
+					p.indexField, p.indexed = c.field, found
+					return p
+				}
+			}
+		}
+	}
+	for _, c := range cmps {
+		if c.field != keyField {
+			continue
+		}
+		switch c.op {
+		case ">", ">=":
+			if p.lower == nil || p.lower.Less(c.v) {
+				p.lower = c.v
+			}
+		case "<", "<=":
+			if p.upper == nil || c.v.Less(p.upper) {
+				p.upper = c.v
+			}
+		}
+	}
+	return p
+}
+
+// scan calls |cb| with each row the plan finds, in key order, until it returns true.
+func (p plan) scan(cb func(r row) bool) {
+	switch v := p.v.(type) {
+	case types.Map:
+		switch {
+		case p.get != nil:
+			if val, ok := v.MaybeGet(p.get); ok {
+				cb(row{p.get, val})
+			}
+		case p.indexField != "":
+			p.indexed.Iter(func(k, val types.Value) bool {
+				return cb(row{k, val})
+			})
+		default:
+			f := func(k, val types.Value) bool {
+				if p.upper != nil && p.upper.Less(k) {
+					return true
+				}
+				return cb(row{k, val})
+			}
+			if p.lower != nil {
+				v.IterFrom(p.lower, f)
+			} else {
+				v.Iter(f)
+			}
+		}
+	case types.List:
+		// The keys of a List are its indexes, so only Numbers bound them.
+		start, end := uint64(0), v.Len()
+		if n, ok := p.get.(types.Number); ok {
+			if float64(n) < 0 || float64(n) != math.Floor(float64(n)) {
+				return
+			}
+			start, end = uint64(n), uint64(n)+1
+		} else if p.get != nil {
+			return
+		}
+		if n, ok := p.lower.(types.Number); ok && float64(n) > 0 {
+			start = uint64(math.Ceil(float64(n)))
+		}
+		if n, ok := p.upper.(types.Number); ok && float64(n) < float64(end) {
+			if float64(n) < 0 {
+				return
+			}
+			end = uint64(math.Floor(float64(n))) + 1
+		}
+		if start >= end || start >= v.Len() {
+			return
+		}
+		if end > v.Len() {
+			end = v.Len()
+		}
+		it := v.IteratorAt(start)
+		for i := start; i < end; i++ {
+			if cb(row{types.Number(i), it.Next()}) {
+				return
+			}
+		}
+	}
+}
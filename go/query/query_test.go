@@ -0,0 +1,138 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package query
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/index"
+	"github.com/stormasm/noms/go/types"
+)
+
+func person(name string, age float64, city string) types.Struct {
+	data := types.StructData{"name": types.String(name), "age": types.Number(age)}
+	if city != "" {
+		data["address"] = types.NewStruct("Address", types.StructData{"city": types.String(city)})
+	}
+	return types.NewStruct("Person", data)
+}
+
+var people = types.NewMap(
+	types.String("a"), person("Alice", 30, "Paris"),
+	types.String("b"), person("Bob", 17, "Rome"),
+	types.String("c"), person("Carol", 42, ""),
+	types.String("d"), person("Dave", 30, "Paris"),
+	types.String("e"), types.Number(42),
+)
+
+// names runs |sql| over |v| and returns the names of the rows it finds.
+func names(t *testing.T, sql string, v types.Value) []string {
+	q, err := Parse(sql)
+	assert.NoError(t, err, sql)
+	res, err := q.Run(v)
+	assert.NoError(t, err, sql)
+	names := []string{}
+	res.IterAll(func(v types.Value, i uint64) {
+		names = append(names, string(v.(types.Struct).Get("name").(types.String)))
+	})
+	return names
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"Alice", "Carol", "Dave"}, names(t, "SELECT * FROM p WHERE age >= 21", people))
+	assert.Equal([]string{"Carol", "Alice", "Dave", "Bob"}, names(t, "SELECT name FROM p WHERE age > 0 ORDER BY age DESC, name", people))
+	assert.Equal([]string{"Alice", "Dave"}, names(t, "SELECT * FROM p WHERE address.city = 'Paris'", people))
+	assert.Equal([]string{"Carol"}, names(t, "SELECT * FROM p WHERE address.city IS NULL AND name IS NOT NULL", people))
+	assert.Equal([]string{"Bob", "Dave"}, names(t, "SELECT * FROM p WHERE name LIKE '%B' OR name LIKE 'd_ve'", people))
+	assert.Equal([]string{"Alice", "Bob"}, names(t, "SELECT * FROM p WHERE name NOT IN ('Carol', 'Dave')", people))
+	assert.Equal([]string{"Bob", "Carol"}, names(t, "SELECT * FROM p WHERE _key > 'a' AND _key < 'd'", people))
+	assert.Equal([]string{"Carol"}, names(t, "SELECT * FROM p WHERE 'c' = _key", people))
+	assert.Equal([]string{"Dave", "Alice"}, names(t, "SELECT * FROM p WHERE age = 30 ORDER BY _key DESC", people))
+	assert.Equal([]string{"Carol", "Dave"}, names(t, "SELECT * FROM p WHERE age > 20 LIMIT 2 OFFSET 1", people))
+	assert.Empty(names(t, "SELECT * FROM p WHERE age > 'x'", people))
+	assert.Empty(names(t, "SELECT * FROM p LIMIT 2 OFFSET 10", people))
+
+	// Lists are keyed by index.
+	list := types.NewList(person("Alice", 30, ""), person("Bob", 17, ""), person("Carol", 42, ""))
+	assert.Equal([]string{"Bob", "Carol"}, names(t, "SELECT * FROM p WHERE _key >= 1", list))
+	assert.Equal([]string{"Alice", "Bob"}, names(t, "SELECT * FROM p WHERE _key < 1.5", list))
+	assert.Equal([]string{"Bob"}, names(t, "SELECT * FROM p WHERE _key = 1", list))
+	assert.Empty(names(t, "SELECT * FROM p WHERE _key = 0.5", list))
+	assert.Empty(names(t, "SELECT * FROM p WHERE _key > 5", list))
+
+	// Selected fields are projected into structs of the same name, without those rows don't have.
+	q, err := Parse("SELECT name, address.city, _key FROM p WHERE _key <= 'c'")
+	assert.NoError(err)
+	res, err := q.Run(people)
+	assert.NoError(err)
+	assert.True(types.NewList(
+		types.NewStruct("Person", types.StructData{"name": types.String("Alice"), "city": types.String("Paris"), "key": types.String("a")}),
+		types.NewStruct("Person", types.StructData{"name": types.String("Bob"), "city": types.String("Rome"), "key": types.String("b")}),
+		types.NewStruct("Person", types.StructData{"name": types.String("Carol"), "key": types.String("c")}),
+	).Equals(res))
+
+	_, err = q.Run(types.String("not a collection"))
+	assert.Error(err)
+}
+
+func TestPlan(t *testing.T) {
+	assert := assert.New(t)
+	plan := func(sql string, lookup indexLookup) string {
+		q, err := Parse(sql)
+		assert.NoError(err)
+		return q.plan(people, lookup).String()
+	}
+
+	assert.Equal("full scan", plan("SELECT * FROM p", nil))
+	assert.Equal("full scan", plan("SELECT * FROM p WHERE _key > 'a' OR age = 1", nil))
+	assert.Equal(`get _key = "b"`, plan("SELECT * FROM p WHERE age = 1 AND _key = 'b'", nil))
+	assert.Equal(`range scan of _key from "b" to the end`, plan("SELECT * FROM p WHERE _key > 'a' AND _key >= 'b'", nil))
+	assert.Equal(`range scan of _key from the end to "c"`, plan("SELECT * FROM p WHERE 'c' > _key", nil))
+	byAge := func(field string, key types.Value) (types.Map, bool) {
+		return types.NewMap(), field == "age"
+	}
+	assert.Equal("index lookup of age", plan("SELECT * FROM p WHERE name = 'Bob' AND age = 17", byAge))
+	assert.Equal("full scan", plan("SELECT * FROM p WHERE age > 17", byAge))
+}
+
+func TestRunDataset(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	q, err := Parse("SELECT name FROM people WHERE name = 'Bob'")
+	assert.NoError(err)
+	ds := db.GetDataset("people")
+	_, err = q.RunDataset(db, ds)
+	assert.Error(err)
+
+	// An index that leaves out the young shows whether it's used.
+	byName := index.Index{Name: "by_name", Keys: func(k, v types.Value) []types.Value {
+		if s, ok := v.(types.Struct); ok && s.Get("age").(types.Number) >= 21 {
+			return []types.Value{s.Get("name")}
+		}
+		return nil
+	}}
+	ds, err = index.Commit(db, ds, people, datas.CommitOptions{}, byName)
+	assert.NoError(err)
+	res, err := q.RunDataset(db, ds)
+	assert.NoError(err)
+	assert.True(res.Empty())
+	res, err = q.Run(people)
+	assert.NoError(err)
+	assert.True(types.NewList(types.NewStruct("Person", types.StructData{"name": types.String("Bob")})).Equals(res))
+
+	// A stale index isn't used, since it may be missing rows.
+	ds, err = db.CommitValue(ds, people.Set(types.String("f"), person("Frank", 50, "Paris")))
+	assert.NoError(err)
+	res, err = q.RunDataset(db, ds)
+	assert.NoError(err)
+	assert.Equal(uint64(1), res.Len())
+}
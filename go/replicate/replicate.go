@@ -0,0 +1,136 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package replicate keeps copies of a Noms database up to date, e.g. as hot standbys, by tailing the root of the source database and copying the novel chunks and dataset heads to each destination.
+package replicate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Destination is a database to which a Replicator copies the source.
+type Destination struct {
+	// Name identifies the destination in the progress file, so it should be stable across runs, e.g. the destination's database spec.
+	Name string
+	DB   datas.Database
+}
+
+// Replicator makes the datasets of each of its destinations mirror those of its source: every dataset in the source is copied to the destinations, along with all of the chunks it references, and datasets that are no longer in the source are deleted from them. Destinations shouldn't be written to by anything else.
+//
+// Each dataset head is copied with datas.Pull(), which only copies the chunks a destination doesn't already have, and is committed as soon as it's copied. So if replication is interrupted, the next round carries on with the datasets that haven't been copied yet. In addition, the source root that was last completely replicated to each destination is kept in a progress file, so a restarted Replicator doesn't need to visit destinations which are already up to date.
+type Replicator struct {
+	src          datas.Database
+	dests        []Destination
+	concurrency  int
+	progressFile string
+	mu           sync.Mutex
+	progress     map[string]hash.Hash // Destination.Name -> the last source root replicated to it
+}
+
+// New returns a Replicator which copies |src| to |dests|, pulling with |concurrency| goroutines. If |progressFile| isn't empty, progress is loaded from and saved to it.
+func New(src datas.Database, dests []Destination, concurrency int, progressFile string) *Replicator {
+	r := &Replicator{src: src, dests: dests, concurrency: concurrency, progressFile: progressFile, progress: map[string]hash.Hash{}}
+	if progressFile != "" {
+		data, err := ioutil.ReadFile(progressFile)
+		if !os.IsNotExist(err) {
+			d.PanicIfError(err)
+			roots := map[string]string{}
+			d.PanicIfError(json.Unmarshal(data, &roots))
+			for name, root := range roots {
+				r.progress[name] = hash.Parse(root)
+			}
+		}
+	}
+	return r
+}
+
+// Sync brings every destination up to date with the current root of the source, and returns the number of dataset heads that were changed. It stops at the first destination which can't be updated, e.g. because it was modified concurrently; calling Sync again retries it.
+func (r *Replicator) Sync() (updated int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = d.Unwrap(d.Try(func() {
+		r.src.Rebase()
+		srcDatasets := r.src.Datasets()
+		for _, dest := range r.dests {
+			if r.progress[dest.Name] == srcDatasets.Hash() {
+				continue
+			}
+			updated += r.syncDest(dest, srcDatasets)
+			r.progress[dest.Name] = srcDatasets.Hash()
+			r.saveProgress()
+		}
+	}))
+	return
+}
+
+// syncDest makes the datasets of |dest| match |srcDatasets|, and returns how many of them it changed. It panics if a dataset can't be updated.
+func (r *Replicator) syncDest(dest Destination, srcDatasets types.Map) (updated int) {
+	dest.DB.Rebase()
+	destDatasets := dest.DB.Datasets()
+
+	srcDatasets.IterAll(func(k, v types.Value) {
+		headRef := v.(types.Ref)
+		ds := dest.DB.GetDataset(string(k.(types.String)))
+		sinkRef, ok := ds.MaybeHeadRef()
+		if ok && sinkRef.TargetHash() == headRef.TargetHash() {
+			return
+		}
+		datas.Pull(r.src, dest.DB, headRef, sinkRef, r.concurrency, nil)
+		_, err := dest.DB.SetHead(ds, headRef)
+		d.PanicIfError(err)
+		updated++
+	})
+
+	destDatasets.IterAll(func(k, v types.Value) {
+		if srcDatasets.Has(k) {
+			return
+		}
+		_, err := dest.DB.Delete(dest.DB.GetDataset(string(k.(types.String))))
+		d.PanicIfError(err)
+		updated++
+	})
+	return
+}
+
+func (r *Replicator) saveProgress() {
+	if r.progressFile == "" {
+		return
+	}
+	roots := map[string]string{}
+	for name, root := range r.progress {
+		roots[name] = root.String()
+	}
+	data, err := json.Marshal(roots)
+	d.PanicIfError(err)
+
+	d.PanicIfError(os.MkdirAll(filepath.Dir(r.progressFile), 0777))
+	tmp := r.progressFile + ".tmp"
+	d.PanicIfError(ioutil.WriteFile(tmp, data, 0644))
+	d.PanicIfError(os.Rename(tmp, r.progressFile))
+}
+
+// Run calls Sync() every |interval| until |stop| is closed, passing the results of each round to |cb|. Rounds that fail are simply retried at the next interval.
+func (r *Replicator) Run(interval time.Duration, stop <-chan struct{}, cb func(updated int, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cb(r.Sync())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
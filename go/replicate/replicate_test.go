@@ -0,0 +1,143 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package replicate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/suite"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+func TestReplicateSuite(t *testing.T) {
+	suite.Run(t, &ReplicateSuite{})
+}
+
+type ReplicateSuite struct {
+	suite.Suite
+	dir               string
+	srcCS             *chunks.MemoryStore
+	destCS1, destCS2  *chunks.TestStore
+	src, dest1, dest2 datas.Database
+}
+
+func (suite *ReplicateSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir("", "replicate")
+	suite.NoError(err)
+	suite.srcCS = chunks.NewMemoryStore()
+	suite.destCS1, suite.destCS2 = chunks.NewTestStore(), chunks.NewTestStore()
+	suite.src = datas.NewDatabase(suite.srcCS)
+	suite.dest1, suite.dest2 = datas.NewDatabase(suite.destCS1), datas.NewDatabase(suite.destCS2)
+}
+
+func (suite *ReplicateSuite) TearDownTest() {
+	suite.src.Close()
+	suite.dest1.Close()
+	suite.dest2.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *ReplicateSuite) newReplicator() *Replicator {
+	dests := []Destination{{"dest1", suite.dest1}, {"dest2", suite.dest2}}
+	return New(suite.src, dests, 4, filepath.Join(suite.dir, "progress"))
+}
+
+func (suite *ReplicateSuite) commit(db datas.Database, id string, v types.Value) {
+	_, err := db.CommitValue(db.GetDataset(id), v)
+	suite.NoError(err)
+}
+
+func (suite *ReplicateSuite) assertMirrored() {
+	srcDatasets := suite.src.Datasets()
+	for _, db := range []datas.Database{suite.dest1, suite.dest2} {
+		db.Rebase()
+		suite.True(srcDatasets.Equals(db.Datasets()))
+		srcDatasets.IterAll(func(k, v types.Value) {
+			head := db.GetDataset(string(k.(types.String))).HeadValue()
+			suite.True(suite.src.GetDataset(string(k.(types.String))).HeadValue().Equals(head))
+		})
+	}
+}
+
+func (suite *ReplicateSuite) TestSync() {
+	r := suite.newReplicator()
+	updated, err := r.Sync()
+	suite.NoError(err)
+	suite.Equal(0, updated)
+
+	suite.commit(suite.src, "ds1", types.NewList(types.String("a"), types.String("b")))
+	suite.commit(suite.src, "ds2", types.Number(42))
+	updated, err = r.Sync()
+	suite.NoError(err)
+	suite.Equal(4, updated)
+	suite.assertMirrored()
+
+	// Only the dataset which changed is copied again, and deleted datasets are deleted from the destinations too.
+	suite.commit(suite.src, "ds1", types.NewList(types.String("c")))
+	_, err = suite.src.Delete(suite.src.GetDataset("ds2"))
+	suite.NoError(err)
+	updated, err = r.Sync()
+	suite.NoError(err)
+	suite.Equal(4, updated)
+	suite.assertMirrored()
+	suite.Equal(uint64(1), suite.dest1.GetDataset("ds1").Head().Get(datas.ParentsField).(types.Set).Len())
+}
+
+func (suite *ReplicateSuite) TestResume() {
+	suite.commit(suite.src, "ds1", types.String("a"))
+	_, err := suite.newReplicator().Sync()
+	suite.NoError(err)
+
+	// A new Replicator knows from the progress file that the destinations are up to date, so it doesn't read from them.
+	reads1, reads2 := suite.destCS1.Reads, suite.destCS2.Reads
+	updated, err := suite.newReplicator().Sync()
+	suite.NoError(err)
+	suite.Equal(0, updated)
+	suite.Equal(reads1, suite.destCS1.Reads)
+	suite.Equal(reads2, suite.destCS2.Reads)
+
+	// Datasets which have diverged from the source are replaced.
+	suite.commit(suite.src, "ds2", types.String("b"))
+	suite.commit(suite.dest1, "ds2", types.String("b"))
+	suite.commit(suite.dest1, "ds2", types.String("b"))
+	updated, err = suite.newReplicator().Sync()
+	suite.NoError(err)
+	suite.Equal(2, updated)
+	suite.assertMirrored()
+}
+
+func (suite *ReplicateSuite) TestRun() {
+	r := suite.newReplicator()
+	stop, done := make(chan struct{}), make(chan struct{})
+	rounds := make(chan int)
+	go func() {
+		defer close(done)
+		r.Run(time.Millisecond, stop, func(updated int, err error) {
+			suite.NoError(err)
+			select {
+			case rounds <- updated:
+			case <-stop:
+			}
+		})
+	}()
+
+	suite.Equal(0, <-rounds)
+	suite.commit(suite.src, "ds1", types.String("a"))
+	total := 0
+	for total < 2 {
+		total += <-rounds
+	}
+	suite.Equal(2, total)
+	close(stop)
+	<-done
+	suite.assertMirrored()
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package retention prunes the histories of datasets, so that datasets that are committed to often, e.g. by noms ingest, don't grow without bound. A Policy says which commits of a dataset's history to keep: the latest few, and the last of each day for a number of days. Prune rewrites the history of a dataset so that it only has those commits, each with the value and meta it had and with the nearest kept commits before it as its parents, and sets the head of the dataset to the rewritten head.
+//
+// Noms doesn't delete chunks in place, so the chunks that only dropped commits reference stay in the database until it's copied. noms backup, noms sync and datas.Pull only copy the chunks that are reachable from the heads of datasets, so restoring a backup of a pruned database, or syncing its datasets to a new one, leaves them behind. Commits that are also in the history of another dataset stay reachable through it, so pruning one dataset of a family of branches only frees space once they've all been pruned.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+	"github.com/BurntSushi/toml"
+)
+
+// Policy says which commits of the history of a dataset to keep: its head, which is always kept, the KeepLast latest commits, and for each of the last KeepDaily days, the latest commit made that day, by the date in its meta, in UTC. Commits without a date in their meta are only kept by KeepLast.
+type Policy struct {
+	KeepLast  int `toml:"keep_last"`
+	KeepDaily int `toml:"keep_daily"`
+}
+
+// Config is the Policy for each dataset of a database, as read from a TOML file by LoadConfig, e.g.
+//
+//   [dataset.events]
+//   keep_last = 1000
+//
+//   [dataset."metrics-*"]
+//   keep_last = 10
+//   keep_daily = 90
+type Config struct {
+	Dataset map[string]Policy
+}
+
+// LoadConfig reads a Config from the TOML file at |path|.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	if _, err := toml.DecodeFile(path, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for name, p := range c.Dataset {
+		if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepLast == 0 && p.KeepDaily == 0 {
+			return nil, fmt.Errorf("%s: dataset %s must keep_last or keep_daily a positive number of commits", path, name)
+		}
+	}
+	return c, nil
+}
+
+// PolicyFor returns the Policy for the dataset |datasetID|: the one named by its ID, if there is one, or otherwise the one whose name is the longest pattern, as understood by path.Match, that matches it. The audit dataset is never pruned, since pruning it would defeat its purpose.
+func (c *Config) PolicyFor(datasetID string) (Policy, bool) {
+	if datasetID == datas.AuditDatasetID {
+		return Policy{}, false
+	}
+	if p, ok := c.Dataset[datasetID]; ok {
+		return p, true
+	}
+	best, found := "", false
+	for pattern := range c.Dataset {
+		if ok, _ := path.Match(pattern, datasetID); ok && (!found || len(pattern) > len(best) || len(pattern) == len(best) && pattern < best) {
+			best, found = pattern, true
+		}
+	}
+	return c.Dataset[best], found
+}
+
+// Result says what Prune did to a dataset: how many Commits its history had, how many of them were Kept, and what its head was Before and After.
+type Result struct {
+	Commits, Kept int
+	Before, After hash.Hash
+}
+
+type entry struct {
+	ref    types.Ref
+	commit types.Struct
+}
+
+// history returns the commits of the history of |head|, newest first: by height, and then by hash, so that the order is the same each time.
+func history(vr types.ValueReader, head types.Struct) []entry {
+	entries := []entry{{types.NewRef(head), head}}
+	seen := hash.HashSet{head.Hash(): struct{}{}}
+	for i := 0; i < len(entries); i++ {
+		entries[i].commit.Get(datas.ParentsField).(types.Set).IterAll(func(v types.Value) {
+			r := v.(types.Ref)
+			if !seen.Has(r.TargetHash()) {
+				seen.Insert(r.TargetHash())
+				entries = append(entries, entry{r, r.TargetValue(vr).(types.Struct)})
+			}
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		hi, hj := entries[i].ref.Height(), entries[j].ref.Height()
+		return hi > hj || hi == hj && entries[i].ref.TargetHash().String() < entries[j].ref.TargetHash().String()
+	})
+	return entries
+}
+
+// keep returns the hashes of the commits of |entries|, newest first, that |p| keeps as of |now|.
+func keep(entries []entry, p Policy, now time.Time) hash.HashSet {
+	kept := hash.HashSet{}
+	for i, e := range entries {
+		if i == 0 || i < p.KeepLast {
+			kept.Insert(e.ref.TargetHash())
+		}
+	}
+	if p.KeepDaily > 0 {
+		cutoff := now.UTC().AddDate(0, 0, -p.KeepDaily)
+		latest := map[string]time.Time{}
+		latestHash := map[string]hash.Hash{}
+		for _, e := range entries {
+			date, ok := spec.CommitMetaDate(e.commit)
+			if !ok || !date.After(cutoff) || date.After(now) {
+				continue
+			}
+			day := date.UTC().Format("2006-01-02")
+			if last, ok := latest[day]; !ok || date.After(last) {
+				latest[day], latestHash[day] = date, e.ref.TargetHash()
+			}
+		}
+		for _, h := range latestHash {
+			kept.Insert(h)
+		}
+	}
+	return kept
+}
+
+// Plan returns the commits of the history of |head| that |p| keeps as of |now|, and how many commits the history has, without changing anything.
+func Plan(vr types.ValueReader, head types.Struct, p Policy, now time.Time) (kept hash.HashSet, commits int) {
+	entries := history(vr, head)
+	return keep(entries, p, now), len(entries)
+}
+
+// Prune rewrites the history of |ds| in |db| to only have the commits |p| keeps as of |now|, and sets its head to the rewritten head, returning the dataset as it is afterwards. If no commits are dropped, the dataset is left as it is. Since the head is set with SetHead, Prune fails if the head of the dataset moves while its history is being rewritten, and can be tried again.
+func Prune(db datas.Database, ds datas.Dataset, p Policy, now time.Time) (datas.Dataset, Result, error) {
+	head, ok := ds.MaybeHead()
+	if !ok {
+		return ds, Result{}, nil
+	}
+	entries := history(db, head)
+	kept := keep(entries, p, now)
+	res := Result{Commits: len(entries), Kept: len(kept), Before: head.Hash(), After: head.Hash()}
+	if len(kept) == len(entries) {
+		return ds, res, nil
+	}
+
+	// Each commit is rewritten after its parents, so that each carries the refs of the nearest kept commits at or before it to its children.
+	carry := map[hash.Hash]types.Set{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		parents := types.NewSet()
+		e.commit.Get(datas.ParentsField).(types.Set).IterAll(func(v types.Value) {
+			carry[v.(types.Ref).TargetHash()].IterAll(func(r types.Value) {
+				parents = parents.Insert(r)
+			})
+		})
+		if kept.Has(e.ref.TargetHash()) {
+			c := datas.NewCommit(e.commit.Get(datas.ValueField), parents, e.commit.Get(datas.MetaField).(types.Struct))
+			parents = types.NewSet(db.WriteValue(c))
+		}
+		carry[e.ref.TargetHash()] = parents
+	}
+
+	newHead := carry[head.Hash()].First().(types.Ref)
+	ds, err := db.SetHead(ds, newHead)
+	if err != nil {
+		return ds, res, err
+	}
+	res.After = newHead.TargetHash()
+	return ds, res, nil
+}
+
+// PruneAll prunes each dataset of |db| that |c| has a Policy for, as of |now|, and returns what was done to each. It stops at the first dataset that can't be pruned.
+func PruneAll(db datas.Database, c *Config, now time.Time) (map[string]Result, error) {
+	results := map[string]Result{}
+	ids := []string{}
+	db.Datasets().IterAll(func(k, v types.Value) {
+		ids = append(ids, string(k.(types.String)))
+	})
+	for _, id := range ids {
+		p, ok := c.PolicyFor(id)
+		if !ok {
+			continue
+		}
+		_, res, err := Prune(db, db.GetDataset(id), p, now)
+		if err != nil {
+			return results, fmt.Errorf("%s: %s", id, err)
+		}
+		results[id] = res
+	}
+	return results, nil
+}
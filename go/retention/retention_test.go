@@ -0,0 +1,157 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package retention
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/spec"
+	"github.com/stormasm/noms/go/types"
+)
+
+var now = time.Date(2016, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// commitAt commits |v| to |ds| with |date| in its meta.
+func commitAt(assert *assert.Assertions, db datas.Database, ds datas.Dataset, v types.Value, date time.Time) datas.Dataset {
+	meta := types.NewStruct("Meta", types.StructData{"date": types.String(date.Format(spec.CommitMetaDateFormat))})
+	ds, err := db.Commit(ds, v, datas.CommitOptions{Meta: meta})
+	assert.NoError(err)
+	return ds
+}
+
+// values returns the values of the commits of the history of |ds|, oldest first.
+func values(db datas.Database, ds datas.Dataset) []types.Value {
+	vals := []types.Value{}
+	for _, e := range history(db, ds.Head()) {
+		vals = append([]types.Value{e.commit.Get(datas.ValueField)}, vals...)
+	}
+	return vals
+}
+
+func TestPrune(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	// Four commits a day, at 0:00, 6:00, 12:00 and 18:00, for ten days up to now.
+	ds := db.GetDataset("ds")
+	start := now.AddDate(0, 0, -10).Add(6 * time.Hour)
+	for i := 0; i < 40; i++ {
+		ds = commitAt(assert, db, ds, types.Number(i), start.Add(time.Duration(i)*6*time.Hour))
+	}
+	head := ds.Head()
+
+	kept, commits := Plan(db, head, Policy{KeepLast: 3, KeepDaily: 5}, now)
+	assert.Equal(40, commits)
+	assert.Equal(8, len(kept))
+
+	ds, res, err := Prune(db, ds, Policy{KeepLast: 3, KeepDaily: 5}, now)
+	assert.NoError(err)
+	assert.Equal(Result{Commits: 40, Kept: 8, Before: head.Hash(), After: ds.HeadRef().TargetHash()}, res)
+	// The last of each day of the last five, from 18:00 five days ago, and the last three.
+	assert.Equal([]types.Value{types.Number(20), types.Number(24), types.Number(28), types.Number(32), types.Number(36), types.Number(37), types.Number(38), types.Number(39)}, values(db, ds))
+	assert.True(head.Get(datas.MetaField).Equals(ds.Head().Get(datas.MetaField)))
+	assert.Equal(uint64(1), ds.Head().Get(datas.ParentsField).(types.Set).Len())
+
+	// Pruning again changes nothing.
+	before := ds.HeadRef()
+	ds, res, err = Prune(db, ds, Policy{KeepLast: 3, KeepDaily: 5}, now)
+	assert.NoError(err)
+	assert.Equal(before, ds.HeadRef())
+	assert.Equal(res.Before, res.After)
+
+	ds, _, err = Prune(db, ds, Policy{KeepLast: 1}, now)
+	assert.NoError(err)
+	assert.Equal([]types.Value{types.Number(39)}, values(db, ds))
+	assert.True(ds.Head().Get(datas.ParentsField).(types.Set).Empty())
+}
+
+func TestPruneMerges(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("root"))
+	assert.NoError(err)
+	root := ds.HeadRef()
+	ds, err = db.CommitValue(ds, types.String("a1"))
+	assert.NoError(err)
+	ds, err = db.CommitValue(ds, types.String("a2"))
+	assert.NoError(err)
+	side, err := db.Commit(db.GetDataset("side"), types.String("b1"), datas.CommitOptions{Parents: types.NewSet(root)})
+	assert.NoError(err)
+	side, err = db.CommitValue(side, types.String("b2"))
+	assert.NoError(err)
+	ds, err = db.Commit(ds, types.String("merged"), datas.CommitOptions{Parents: types.NewSet(ds.HeadRef(), side.HeadRef())})
+	assert.NoError(err)
+
+	// The merge keeps both of its sides, which now start with the nearest kept commits.
+	ds, res, err := Prune(db, ds, Policy{KeepLast: 3}, time.Now())
+	assert.NoError(err)
+	assert.Equal(6, res.Commits)
+	parents := ds.Head().Get(datas.ParentsField).(types.Set)
+	assert.Equal(uint64(2), parents.Len())
+	parents.IterAll(func(v types.Value) {
+		c := v.(types.Ref).TargetValue(db).(types.Struct)
+		assert.True(c.Get(datas.ParentsField).(types.Set).Empty())
+	})
+	vals := values(db, ds)
+	assert.Len(vals, 3)
+	assert.Contains(vals, types.String("a2"))
+	assert.Contains(vals, types.String("b2"))
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "retention")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "retention.toml")
+	assert.NoError(ioutil.WriteFile(file, []byte(`
+[dataset.events]
+keep_last = 1000
+
+[dataset."metrics-*"]
+keep_last = 10
+keep_daily = 90
+
+[dataset."*"]
+keep_daily = 7
+`), 0644))
+	c, err := LoadConfig(file)
+	assert.NoError(err)
+
+	p, ok := c.PolicyFor("events")
+	assert.True(ok)
+	assert.Equal(Policy{KeepLast: 1000}, p)
+	p, _ = c.PolicyFor("metrics-cpu")
+	assert.Equal(Policy{KeepLast: 10, KeepDaily: 90}, p)
+	p, _ = c.PolicyFor("other")
+	assert.Equal(Policy{KeepDaily: 7}, p)
+	_, ok = c.PolicyFor(datas.AuditDatasetID)
+	assert.False(ok)
+
+	db := datas.NewDatabase(chunks.NewTestStore())
+	defer db.Close()
+	ds := db.GetDataset("metrics-cpu")
+	for i := 0; i < 20; i++ {
+		ds = commitAt(assert, db, ds, types.Number(i), now.Add(time.Duration(i-20)*time.Minute))
+	}
+	results, err := PruneAll(db, c, now)
+	assert.NoError(err)
+	assert.Equal(10, results["metrics-cpu"].Kept)
+	assert.Len(values(db, db.GetDataset("metrics-cpu")), 10)
+
+	assert.NoError(ioutil.WriteFile(file, []byte("[dataset.x]\nkeep_last = 0\n"), 0644))
+	_, err = LoadConfig(file)
+	assert.Error(err)
+}
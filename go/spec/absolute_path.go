@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/datas"
@@ -17,15 +19,27 @@ import (
 
 var datasetCapturePrefixRe = regexp.MustCompile("^(" + datas.DatasetRe.String() + ")")
 
+// historyRe matches the optional "@<time>" and "~<n>" that may follow the dataset or hash of a path, e.g. "ds@2016-01-02T15:04:05Z~1.value". Times are RFC 3339 or CommitMetaDateFormat, or just a date, meaning its midnight UTC.
+var historyRe = regexp.MustCompile(`^(@(\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2}))?))?(~(\d+))?`)
+
 // AbsolutePath represents a path originating at a dataset or a well-formed
 // hash (i.e. '#' + 32 chars) representing a Noms Value that is independently
 // addressable. Either the Dataset of Hash field will indicate the beginning of
 // the AbsolutePath and the other one will be nil. The Path field holds the
 // remainder of the path.
+//
+// If At isn't zero, the path starts instead at the most recent commit before
+// or at that time, going back through the history of the commit the Dataset
+// or Hash refers to. Then, it goes back Ancestors commits more. This is
+// spelled "ds@2016-01-02T15:04:05Z~3.value". Only the first parent of a
+// merge is followed, which is the one with the greatest height, since parents
+// are unordered.
 type AbsolutePath struct {
-	Dataset string
-	Hash    hash.Hash
-	Path    types.Path
+	Dataset   string
+	Hash      hash.Hash
+	At        time.Time
+	Ancestors int
+	Path      types.Path
 }
 
 // NewAbsolutePath attempts to parse 'str' and return an AbsolutePath.
@@ -45,7 +59,8 @@ func NewAbsolutePath(str string) (AbsolutePath, error) {
 		}
 
 		hashStr := tail[:hash.StringLen]
-		if h2, ok := hash.MaybeParse(hashStr); ok {
+		// The empty hash parses, but doesn't address anything.
+		if h2, ok := hash.MaybeParse(hashStr); ok && !h2.IsEmpty() {
 			h = h2
 		} else {
 			return AbsolutePath{}, errors.New("Invalid hash: " + hashStr)
@@ -62,8 +77,25 @@ func NewAbsolutePath(str string) (AbsolutePath, error) {
 		pathStr = str[len(dataset):]
 	}
 
+	var at time.Time
+	ancestors := 0
+	if historyParts := historyRe.FindStringSubmatch(pathStr); len(historyParts[0]) > 0 {
+		var err error
+		if historyParts[2] != "" {
+			if at, err = ParseCommitMetaDate(historyParts[2]); err != nil {
+				return AbsolutePath{}, fmt.Errorf("Invalid time: %s", historyParts[2])
+			}
+		}
+		if historyParts[7] != "" {
+			if ancestors, err = strconv.Atoi(historyParts[7]); err != nil {
+				return AbsolutePath{}, fmt.Errorf("Invalid number of ancestors: %s", historyParts[7])
+			}
+		}
+		pathStr = pathStr[len(historyParts[0]):]
+	}
+
 	if len(pathStr) == 0 {
-		return AbsolutePath{Hash: h, Dataset: dataset}, nil
+		return AbsolutePath{Hash: h, Dataset: dataset, At: at, Ancestors: ancestors}, nil
 	}
 
 	path, err := types.ParsePath(pathStr)
@@ -71,7 +103,7 @@ func NewAbsolutePath(str string) (AbsolutePath, error) {
 		return AbsolutePath{}, err
 	}
 
-	return AbsolutePath{Hash: h, Dataset: dataset, Path: path}, nil
+	return AbsolutePath{Hash: h, Dataset: dataset, At: at, Ancestors: ancestors, Path: path}, nil
 }
 
 // Resolve returns the Value reachable by 'p' in 'db'.
@@ -88,12 +120,60 @@ func (p AbsolutePath) Resolve(db datas.Database) (val types.Value) {
 		d.Chk.Fail("Unreachable")
 	}
 
+	if val != nil && (!p.At.IsZero() || p.Ancestors > 0) {
+		val = p.resolveHistory(db, val)
+	}
 	if val != nil && p.Path != nil {
 		val = p.Path.Resolve(val)
 	}
 	return
 }
 
+// ResolveE is like Resolve, but returns an error rather than panicking if reading the values along p fails. It returns nil, without an error, if there's nothing at p.
+func (p AbsolutePath) ResolveE(db datas.Database) (val types.Value, err error) {
+	err = d.TryAll(func() { val = p.Resolve(db) })
+	return
+}
+
+// resolveHistory returns the commit that p.At and p.Ancestors refer to, starting from |val|, or nil if |val| isn't a commit or there's no such commit.
+func (p AbsolutePath) resolveHistory(db datas.Database, val types.Value) types.Value {
+	if !datas.IsCommitType(val.Type()) {
+		return nil
+	}
+	commit, ok := val.(types.Struct), true
+	if !p.At.IsZero() {
+		for {
+			if date, dated := CommitMetaDate(commit); dated && !date.After(p.At) {
+				break
+			}
+			if commit, ok = firstParent(db, commit); !ok {
+				return nil
+			}
+		}
+	}
+	for i := 0; i < p.Ancestors; i++ {
+		if commit, ok = firstParent(db, commit); !ok {
+			return nil
+		}
+	}
+	return commit
+}
+
+// firstParent returns the parent of |commit| with the greatest height, or false if it has no parents.
+func firstParent(db datas.Database, commit types.Struct) (types.Struct, bool) {
+	var first types.Ref
+	found := false
+	commit.Get(datas.ParentsField).(types.Set).IterAll(func(v types.Value) {
+		if r := v.(types.Ref); !found || r.Height() > first.Height() {
+			first, found = r, true
+		}
+	})
+	if !found {
+		return types.Struct{}, false
+	}
+	return first.TargetValue(db).(types.Struct), true
+}
+
 func (p AbsolutePath) String() (str string) {
 	if len(p.Dataset) > 0 {
 		str = p.Dataset
@@ -103,6 +183,12 @@ func (p AbsolutePath) String() (str string) {
 		d.Chk.Fail("Unreachable")
 	}
 
+	if !p.At.IsZero() {
+		str += "@" + p.At.Format(time.RFC3339Nano)
+	}
+	if p.Ancestors > 0 {
+		str += fmt.Sprintf("~%d", p.Ancestors)
+	}
 	return str + p.Path.String()
 }
 
@@ -117,7 +203,10 @@ func ReadAbsolutePaths(db datas.Database, paths ...string) ([]types.Value, error
 			return nil, fmt.Errorf("Invalid input path '%s'", ps)
 		}
 
-		v := p.Resolve(db)
+		v, err := p.ResolveE(db)
+		if err != nil {
+			return nil, err
+		}
 		if v == nil {
 			return nil, fmt.Errorf("Input path '%s' does not exist in database", ps)
 		}
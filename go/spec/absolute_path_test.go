@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/datas"
@@ -28,6 +29,56 @@ func TestAbsolutePathToAndFromString(t *testing.T) {
 	h := types.Number(42).Hash() // arbitrary hash
 	test(fmt.Sprintf("foo.bar[#%s]", h.String()))
 	test(fmt.Sprintf("#%s.bar[42]", h.String()))
+	test("foo~3.value")
+	test("foo@2016-01-02T15:04:05Z.value")
+	test(fmt.Sprintf("#%s@2016-01-02T15:04:05.5-08:00~1", h.String()))
+
+	p, err := NewAbsolutePath("foo@2016-01-02.value")
+	assert.NoError(err)
+	assert.Equal(time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC), p.At)
+	assert.Equal("foo@2016-01-02T00:00:00Z.value", p.String())
+}
+
+func TestAbsolutePathHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	ds := db.GetDataset("ds")
+	var err error
+	for i, date := range []string{"2016-01-01T00:00:00-0800", "2016-02-01T00:00:00Z", ""} {
+		meta := types.EmptyStruct
+		if date != "" {
+			meta = types.NewStruct("Meta", types.StructData{"date": types.String(date)})
+		}
+		ds, err = db.Commit(ds, types.Number(i), datas.CommitOptions{Meta: meta})
+		assert.NoError(err)
+	}
+
+	resolvesTo := func(exp types.Value, str string) {
+		p, err := NewAbsolutePath(str)
+		assert.NoError(err)
+		act := p.Resolve(db)
+		if exp == nil {
+			assert.Nil(act, str)
+		} else {
+			assert.True(exp.Equals(act), "%s Expected %s Actual %s", str, types.EncodedValue(exp), types.EncodedValue(act))
+		}
+	}
+
+	resolvesTo(types.Number(2), "ds~0.value")
+	resolvesTo(types.Number(1), "ds~1.value")
+	resolvesTo(types.Number(0), "ds~2.value")
+	resolvesTo(nil, "ds~3.value")
+	resolvesTo(types.Number(0), "#"+ds.Head().Hash().String()+"~2.value")
+	resolvesTo(nil, "#"+types.Number(2).Hash().String()+"~1")
+
+	// The undated head is skipped, and times in different zones compare correctly.
+	resolvesTo(types.Number(1), "ds@2016-03-01.value")
+	resolvesTo(types.Number(1), "ds@2016-02-01T00:00:00Z.value")
+	resolvesTo(types.Number(0), "ds@2016-01-31T23:59:59Z.value")
+	resolvesTo(types.Number(0), "ds@2016-01-01T08:00:00Z.value")
+	resolvesTo(nil, "ds@2016-01-01T07:59:59Z.value")
+	resolvesTo(types.Number(0), "ds@2016-03-01~1.value")
 }
 
 func TestAbsolutePaths(t *testing.T) {
@@ -105,6 +156,14 @@ func TestReadAbsolutePaths(t *testing.T) {
 	vals, err = ReadAbsolutePaths(db, "invalid.monkey")
 	assert.Nil(vals)
 	assert.Equal("Input path 'invalid.monkey' does not exist in database", err.Error())
+
+	// A value that can't be decoded is an error, not a panic.
+	cs := chunks.NewMemoryStore()
+	bad := chunks.NewChunk([]byte{0xff, 0xff, 0xff})
+	cs.Put(bad)
+	vals, err = ReadAbsolutePaths(datas.NewDatabase(cs), "#"+bad.Hash().String())
+	assert.Nil(vals)
+	assert.Error(err)
 }
 
 func TestAbsolutePathParseErrors(t *testing.T) {
@@ -124,4 +183,7 @@ func TestAbsolutePathParseErrors(t *testing.T) {
 	test("#abc", "Invalid hash: abc")
 	invHash := strings.Repeat("z", hash.StringLen)
 	test("#"+invHash, "Invalid hash: "+invHash)
+	emptyHash := strings.Repeat("0", hash.StringLen)
+	test("#"+emptyHash, "Invalid hash: "+emptyHash)
+	test("foo@2016-13-01", "Invalid time: 2016-13-01")
 }
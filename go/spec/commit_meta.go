@@ -113,3 +113,33 @@ func CreateCommitMetaStruct(db datas.Database, date, message string, keyValueStr
 	}
 	return types.NewStruct("Meta", metaValues), nil
 }
+
+var timeLayouts = []string{time.RFC3339, CommitMetaDateFormat, "2006-01-02"}
+
+// ParseCommitMetaDate parses a date like those in commit meta, in CommitMetaDateFormat, or RFC 3339, or just a date, which means its midnight UTC.
+func ParseCommitMetaDate(str string) (t time.Time, err error) {
+	for _, layout := range timeLayouts {
+		if t, err = time.Parse(layout, str); err == nil {
+			return
+		}
+	}
+	return
+}
+
+// CommitMetaDate returns the date in the meta of |commit|, if it has one that ParseCommitMetaDate() can parse.
+func CommitMetaDate(commit types.Struct) (time.Time, bool) {
+	meta, ok := commit.Get(datas.MetaField).(types.Struct)
+	if !ok {
+		return time.Time{}, false
+	}
+	date, ok := meta.MaybeGet("date")
+	if !ok {
+		return time.Time{}, false
+	}
+	str, ok := date.(types.String)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := ParseCommitMetaDate(string(str))
+	return t, err == nil
+}
@@ -0,0 +1,17 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package spec
+
+// Credentials grant access to a database. Unlike the rest of a DatabaseSpec, they can't be given in a spec string, so that secrets don't end up in shell history or process listings; they're set by whatever resolves the spec, e.g. from the database's alias in .nomsconfig.
+type Credentials struct {
+	// AuthToken is sent as a bearer token to http(s) databases, in place of any access_token in the spec.
+	AuthToken string
+	// AWSProfile selects a profile in the shared AWS credentials file for s3 databases, in place of the credentials in the environment.
+	AWSProfile string
+	// KeyFile names a file holding the key with which the database's chunks are encrypted, as by chunks.EncryptedStore; see chunks.ReadKeyFile(). Can't be used with http(s) databases, whose chunks are stored by the server.
+	KeyFile string
+	// AccessFile names an access control file, as read by datas.LoadAccessControl. If it's given, the database only lets its user read and change the datasets that the file grants AuthToken, or grants anonymous users if there's no AuthToken; see datas.NewAuthorizedDatabase.
+	AccessFile string
+}
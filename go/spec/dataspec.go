@@ -8,8 +8,10 @@ package spec
 import (
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/d"
@@ -26,6 +28,22 @@ const (
 var (
 	datasetRe = regexp.MustCompile("^" + datas.DatasetRe.String() + "$")
 	ldbStores = map[string]*refCountingLdbStore{}
+
+	// badgerStores are the open BadgerStores, by path. Badger locks its directory, so all the specs for a path in this process share one store.
+	badgerStores = map[string]*refCountingLdbStore{}
+
+	// memStores are the shared in-memory databases named by "mem://<name>" specs.
+	memStoresMu sync.Mutex
+	memStores   = map[string]*chunks.MemoryStore{}
+	memNameRe   = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+
+	// cacheDir, if set, is the directory under which local caches of remote databases are kept.
+	cacheDir            string
+	cacheFlagRegistered = false
+
+	// bloomFilter, if set, wraps local (ldb and nbs) databases in a chunks.BloomStore.
+	bloomFilter         bool
+	bloomFlagRegistered = false
 )
 
 func GetDatabase(str string) (datas.Database, error) {
@@ -41,19 +59,11 @@ func GetChunkStore(str string) (chunks.ChunkStore, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	switch sp.Protocol {
-	case "ldb":
-		return getLDBStore(sp.Path), nil
-	case "mem":
-		return chunks.NewMemoryStore(), nil
-	default:
-		return nil, fmt.Errorf("Unable to create chunkstore for protocol: %s", str)
-	}
+	return sp.ChunkStore()
 }
 
 func GetDataset(str string) (datas.Database, datas.Dataset, error) {
-	sp, err := parseDatasetSpec(str)
+	sp, err := ParseDatasetSpec(str)
 	if err != nil {
 		return nil, datas.Dataset{}, err
 	}
@@ -76,9 +86,17 @@ type DatabaseSpec struct {
 	Protocol    string
 	Path        string
 	accessToken string
+	// ReadOnly is set by a "mode=ro" query parameter. Databases opened from a read-only spec reject changes with a datas.ReadOnlyError, and ldb databases are opened without holding LevelDB's lock except while reading.
+	ReadOnly bool
+	// LevelDBOptions tunes ldb databases. It's set by query parameters; see applyParams().
+	LevelDBOptions chunks.LevelDBOptions
+	// HTTPClientOptions configures the HTTP client of http(s) databases. It's set by parameters in their URL; see parseHTTPParams().
+	HTTPClientOptions datas.HTTPClientOptions
+	// Credentials are never part of a spec string; see Credentials.
+	Credentials Credentials
 }
 
-type datasetSpec struct {
+type DatasetSpec struct {
 	DbSpec      DatabaseSpec
 	DatasetName string
 }
@@ -90,6 +108,28 @@ type PathSpec struct {
 
 // ParseDatabaseSpec parses a database spec string into its parts
 func ParseDatabaseSpec(spec string) (DatabaseSpec, error) {
+	// The query of an http(s) URL is parsed along with the rest of it. Other specs may end in a query of parameters too, e.g. "ldb:/path?mode=ro"; see applyParams().
+	var query url.Values
+	if !strings.HasPrefix(spec, "http:") && !strings.HasPrefix(spec, "https:") {
+		if i := strings.LastIndex(spec, "?"); i >= 0 {
+			var err error
+			if query, err = url.ParseQuery(spec[i+1:]); err != nil {
+				return DatabaseSpec{}, fmt.Errorf("Invalid database spec %s: %s", spec, err)
+			}
+			spec = spec[:i]
+		}
+	}
+	sp, err := parseDatabaseSpec(spec)
+	if err != nil {
+		return DatabaseSpec{}, err
+	}
+	if err = sp.applyParams(query); err != nil {
+		return DatabaseSpec{}, fmt.Errorf("Invalid database spec %s?%s: %s", spec, query.Encode(), err)
+	}
+	return sp, nil
+}
+
+func parseDatabaseSpec(spec string) (DatabaseSpec, error) {
 	ldbDatabaseSpec := func(path string) (DatabaseSpec, error) {
 		if len(path) == 0 {
 			return DatabaseSpec{}, fmt.Errorf("Empty file system path")
@@ -118,15 +158,63 @@ func ParseDatabaseSpec(spec string) (DatabaseSpec, error) {
 			return DatabaseSpec{}, fmt.Errorf("Invalid URL: %s", spec)
 		}
 		token := u.Query().Get("access_token")
-		return DatabaseSpec{Protocol: protocol, Path: path, accessToken: token}, nil
+		readOnly, err := parseMode(u.Query().Get("mode"))
+		if err != nil {
+			return DatabaseSpec{}, fmt.Errorf("Invalid URL %s: %s", spec, err)
+		}
+		opts, err := parseHTTPParams(u.Query())
+		if err != nil {
+			return DatabaseSpec{}, fmt.Errorf("Invalid URL %s: %s", spec, err)
+		}
+		return DatabaseSpec{Protocol: protocol, Path: path, accessToken: token, ReadOnly: readOnly, HTTPClientOptions: opts}, nil
+
+	case "grpc", "grpcs":
+		u, err := url.Parse(spec)
+		if err != nil || len(u.Host) == 0 || (u.Path != "" && u.Path != "/") {
+			return DatabaseSpec{}, fmt.Errorf("gRPC databases must be specified as %s://host:port: %s", protocol, spec)
+		}
+		return DatabaseSpec{Protocol: protocol, Path: "//" + u.Host}, nil
 
 	case "ldb":
 		return ldbDatabaseSpec(path)
 
+	case "s3":
+		if bucket, _ := splitS3Path(path); len(bucket) == 0 {
+			return DatabaseSpec{}, fmt.Errorf("Missing S3 bucket: %s", spec)
+		}
+		return DatabaseSpec{Protocol: protocol, Path: path}, nil
+
+	case "gs":
+		if bucket, _ := splitS3Path(path); len(bucket) == 0 {
+			return DatabaseSpec{}, fmt.Errorf("Missing GCS bucket: %s", spec)
+		}
+		return DatabaseSpec{Protocol: protocol, Path: path}, nil
+
+	case "azure":
+		if account, container, _ := splitAzurePath(path); len(account) == 0 || len(container) == 0 {
+			return DatabaseSpec{}, fmt.Errorf("Azure databases must be specified as azure:account/container[/prefix]: %s", spec)
+		}
+		return DatabaseSpec{Protocol: protocol, Path: path}, nil
+
+	case "nbs", "badger":
+		if len(path) == 0 {
+			return DatabaseSpec{}, fmt.Errorf("Empty file system path")
+		}
+		return DatabaseSpec{Protocol: protocol, Path: path}, nil
+
 	case "mem":
-		return DatabaseSpec{}, fmt.Errorf(`In-memory database must be specified as "mem", not "mem:%s"`, path)
+		if strings.HasPrefix(path, "//") && memNameRe.MatchString(path[2:]) {
+			return DatabaseSpec{Protocol: protocol, Path: path[2:]}, nil
+		}
+		return DatabaseSpec{}, fmt.Errorf(`In-memory database must be specified as "mem" or "mem://<name>", not "mem:%s"`, path)
 
 	default:
+		if _, ok := registeredProtocol(protocol); ok {
+			if len(path) == 0 {
+				return DatabaseSpec{}, fmt.Errorf("Empty %s database path", protocol)
+			}
+			return DatabaseSpec{Protocol: protocol, Path: path}, nil
+		}
 		return DatabaseSpec{}, fmt.Errorf("Invalid database protocol: %s", spec)
 	}
 }
@@ -145,17 +233,18 @@ func splitAndParseDatabaseSpec(spec string) (DatabaseSpec, string, error) {
 	return dbSpec, parts[1], nil
 }
 
-func parseDatasetSpec(spec string) (datasetSpec, error) {
+// ParseDatasetSpec parses a dataset spec string into its parts
+func ParseDatasetSpec(spec string) (DatasetSpec, error) {
 	dbSpec, dsName, err := splitAndParseDatabaseSpec(spec)
 	if err != nil {
-		return datasetSpec{}, err
+		return DatasetSpec{}, err
 	}
 
 	if !datasetRe.MatchString(dsName) {
-		return datasetSpec{}, fmt.Errorf("Invalid dataset, must match %s: %s", datas.DatasetRe.String(), dsName)
+		return DatasetSpec{}, fmt.Errorf("Invalid dataset, must match %s: %s", datas.DatasetRe.String(), dsName)
 	}
 
-	return datasetSpec{dbSpec, dsName}, nil
+	return DatasetSpec{dbSpec, dsName}, nil
 }
 
 // ParsePathSpec parses a path spec string into its parts
@@ -174,28 +263,120 @@ func ParsePathSpec(spec string) (PathSpec, error) {
 }
 
 func (spec DatabaseSpec) String() string {
-	return spec.Protocol + ":" + spec.Path
+	str := spec.Protocol + ":" + spec.Path
+	if spec.Protocol == "mem" {
+		str = spec.Protocol
+		if spec.Path != "" {
+			str += "://" + spec.Path
+		}
+	}
+	if spec.Protocol != "http" && spec.Protocol != "https" {
+		if params := spec.params(); len(params) > 0 {
+			str += "?" + params.Encode()
+		}
+	}
+	return str
 }
 
 func (spec DatabaseSpec) Database() (ds datas.Database, err error) {
 	switch spec.Protocol {
 	case "http", "https":
+		if spec.Credentials.KeyFile != "" {
+			return nil, fmt.Errorf("Chunks can't be encrypted with a key file in %s databases", spec.Protocol)
+		}
+		token := spec.accessToken
+		if spec.Credentials.AuthToken != "" {
+			token = spec.Credentials.AuthToken
+		}
 		err = d.Unwrap(d.Try(func() {
-			ds = datas.NewRemoteDatabase(spec.String(), "Bearer "+spec.accessToken)
-		}))
-	case "ldb":
-		err = d.Unwrap(d.Try(func() {
-			ds = datas.NewDatabase(getLDBStore(spec.Path))
+			ds = datas.NewRemoteDatabaseWithOptions(spec.String(), "Bearer "+token, spec.HTTPClientOptions, spec.localCache())
 		}))
-	case "mem":
-		ds = datas.NewDatabase(chunks.NewMemoryStore())
 	default:
-		err = fmt.Errorf("Invalid path prototocol: %s", spec.Protocol)
+		var cs chunks.ChunkStore
+		if cs, err = spec.ChunkStore(); err == nil {
+			ds = datas.NewDatabase(cs)
+		}
+	}
+	if err == nil && spec.Credentials.AccessFile != "" {
+		ds, err = authorize(ds, spec.Credentials)
+	}
+	if err == nil && spec.ReadOnly {
+		ds = datas.NewReadOnlyDatabase(ds)
 	}
 	return
 }
 
-func (spec datasetSpec) Dataset() (datas.Dataset, error) {
+// authorize returns |db| limited to what the access control file in |creds| grants its auth token, or closes db if the file can't be read or doesn't know the token.
+func authorize(db datas.Database, creds Credentials) (datas.Database, error) {
+	ac, err := datas.LoadAccessControl(creds.AccessFile)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	g, ok := ac.GrantFor(creds.AuthToken)
+	if !ok {
+		db.Close()
+		return nil, fmt.Errorf("%s: unknown auth token", creds.AccessFile)
+	}
+	return datas.NewAuthorizedDatabase(db, g), nil
+}
+
+// ChunkStore returns the ChunkStore underlying spec's database. http(s) databases don't have one.
+func (spec DatabaseSpec) ChunkStore() (cs chunks.ChunkStore, err error) {
+	err = d.Unwrap(d.Try(func() {
+		switch spec.Protocol {
+		case "ldb":
+			cs = getLDBStore(spec.Path, spec.ReadOnly, spec.LevelDBOptions)
+		case "s3":
+			cs = spec.s3Store()
+		case "gs":
+			cs = spec.gcsStore()
+		case "azure":
+			cs = spec.azureStore()
+		case "nbs":
+			cs = getNBSStore(spec.Path)
+		case "badger":
+			cs = getBadgerStore(spec.Path)
+		case "grpc", "grpcs":
+			var err error
+			cs, err = datas.NewGRPCStore(strings.TrimPrefix(spec.Path, "//"), spec.Protocol == "grpcs", spec.Credentials.AuthToken)
+			d.PanicIfError(err)
+		case "mem":
+			if spec.Path == "" {
+				cs = chunks.NewMemoryStore()
+			} else {
+				cs = getMemStore(spec.Path)
+			}
+		default:
+			factory, ok := registeredProtocol(spec.Protocol)
+			d.PanicIfFalse(ok, "Unable to create chunkstore for protocol: %s", spec.Protocol)
+			var err error
+			cs, err = factory(spec.Path)
+			d.PanicIfError(err)
+		}
+		if spec.Credentials.KeyFile != "" {
+			keys, err := chunks.ReadKeyFile(spec.Credentials.KeyFile)
+			if err != nil {
+				cs.Close()
+				d.PanicIfError(err)
+			}
+			cs = chunks.NewEncryptedStore(cs, keys)
+		}
+	}))
+	return
+}
+
+// GetDatabaseReadOnly returns the database named by |str|, which is read-only whether or not |str| has a "mode=ro" parameter.
+func GetDatabaseReadOnly(str string) (datas.Database, error) {
+	sp, err := ParseDatabaseSpec(str)
+	if err != nil {
+		return nil, err
+	}
+	sp.ReadOnly = true
+	return sp.Database()
+}
+
+func (spec DatasetSpec) Dataset() (datas.Dataset, error) {
 	store, err := spec.DbSpec.Database()
 	if err != nil {
 		return datas.Dataset{}, err
@@ -204,11 +385,11 @@ func (spec datasetSpec) Dataset() (datas.Dataset, error) {
 	return store.GetDataset(spec.DatasetName), nil
 }
 
-func (spec datasetSpec) String() string {
+func (spec DatasetSpec) String() string {
 	return spec.DbSpec.String() + Separator + spec.DatasetName
 }
 
-func (spec datasetSpec) Value() (datas.Database, types.Value, error) {
+func (spec DatasetSpec) Value() (datas.Database, types.Value, error) {
 	dataset, err := spec.Dataset()
 	if err != nil {
 		return nil, nil, err
@@ -237,6 +418,15 @@ func (spec PathSpec) String() string {
 
 func RegisterDatabaseFlags(flags *flag.FlagSet) {
 	chunks.RegisterLevelDBFlags(flags)
+	chunks.RegisterS3Flags(flags)
+	if !cacheFlagRegistered {
+		cacheFlagRegistered = true
+		flags.StringVar(&cacheDir, "cache-dir", "", "directory in which to cache chunks read from or written to remote (http, https, s3, gs and azure) databases. Caching is disabled if empty")
+	}
+	if !bloomFlagRegistered {
+		bloomFlagRegistered = true
+		flags.BoolVar(&bloomFilter, "bloom-filter", false, "keep a bloom filter of the chunks in local (ldb and nbs) databases, so that lookups of chunks they don't have, e.g. while pulling into them, don't touch the disk")
+	}
 }
 
 func CreateDatabaseSpecString(protocol, path string) string {
@@ -251,15 +441,130 @@ func CreateHashSpecString(protocol, path string, h hash.Hash) string {
 	return fmt.Sprintf("%s:%s::#%s", protocol, path, h.String())
 }
 
-func getLDBStore(path string) chunks.ChunkStore {
-	if store, ok := ldbStores[path]; ok {
+// getLDBStore returns the LevelDBStore for |path|, tuned with |opts|, which is shared by all the specs for |path| in this process; |opts| only applies if the store isn't open yet. A read-only spec uses the writable store if it's already open, since it holds LevelDB's lock anyway.
+func getLDBStore(path string, readOnly bool, opts chunks.LevelDBOptions) chunks.ChunkStore {
+	key := path
+	if readOnly {
+		if store, ok := ldbStores[path]; ok {
+			store.AddRef()
+			return store
+		}
+		key += "?mode=ro"
+	}
+	if store, ok := ldbStores[key]; ok {
 		store.AddRef()
 		return store
 	}
 
-	store := newRefCountingLdbStore(path, func() {
-		delete(ldbStores, path)
+	var cs chunks.ChunkStore
+	if readOnly {
+		cs = chunks.NewReadOnlyLevelDBStoreUseFlags(path, "", opts)
+	} else {
+		cs = withBloomFilter(chunks.NewLevelDBStoreWithOptionsUseFlags(path, "", opts), path)
+	}
+	store := newRefCountingLdbStore(cs, func() {
+		delete(ldbStores, key)
+	})
+	ldbStores[key] = store
+	return store
+}
+
+// getMemStore returns the shared in-memory store named |name|, creating it if there isn't one. Closing a MemoryStore doesn't discard its chunks, so the store lives as long as the process does, unless it's dropped with DropMemStore().
+func getMemStore(name string) chunks.ChunkStore {
+	memStoresMu.Lock()
+	defer memStoresMu.Unlock()
+	store, ok := memStores[name]
+	if !ok {
+		store = chunks.NewMemoryStore()
+		memStores[name] = store
+	}
+	return store
+}
+
+// DropMemStore discards the shared in-memory database named |name|, i.e. that of the spec "mem://<name>", so that the next spec naming it opens an empty one. Databases already open on it are unaffected.
+func DropMemStore(name string) {
+	memStoresMu.Lock()
+	defer memStoresMu.Unlock()
+	delete(memStores, name)
+}
+
+func getNBSStore(path string) chunks.ChunkStore {
+	return withBloomFilter(chunks.NewTableStore(path), path)
+}
+
+// getBadgerStore returns the BadgerStore for |path|, which is shared by all the specs for |path| in this process.
+func getBadgerStore(path string) chunks.ChunkStore {
+	if store, ok := badgerStores[path]; ok {
+		store.AddRef()
+		return store
+	}
+	store := newRefCountingLdbStore(chunks.NewBadgerStoreUseFlags(path), func() {
+		delete(badgerStores, path)
 	})
-	ldbStores[path] = store
+	badgerStores[path] = store
 	return store
 }
+
+// withBloomFilter wraps |store|, which holds the local database in the directory |dir|, in a BloomStore if --bloom-filter is set.
+func withBloomFilter(store chunks.ChunkStore, dir string) chunks.ChunkStore {
+	if !bloomFilter {
+		return store
+	}
+	return chunks.NewBloomStore(store, filepath.Join(dir, "noms.bloom"))
+}
+
+// splitS3Path splits the path of an s3: or gs: spec, which is of the form bucket/prefix, into its bucket and (possibly empty) key prefix.
+func splitS3Path(path string) (bucket, prefix string) {
+	parts := strings.SplitN(path, "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+	return
+}
+
+// splitAzurePath splits the path of an azure: spec, which is of the form account/container/prefix, into its storage account, container and (possibly empty) blob name prefix.
+func splitAzurePath(path string) (account, container, prefix string) {
+	parts := strings.SplitN(path, "/", 3)
+	account = parts[0]
+	if len(parts) > 1 {
+		container = parts[1]
+	}
+	if len(parts) > 2 {
+		prefix = parts[2]
+	}
+	return
+}
+
+func (spec DatabaseSpec) s3Store() chunks.ChunkStore {
+	bucket, prefix := splitS3Path(spec.Path)
+	return spec.withLocalCache(chunks.NewS3StoreWithProfileUseFlags(bucket, prefix, spec.Credentials.AWSProfile))
+}
+
+func (spec DatabaseSpec) gcsStore() chunks.ChunkStore {
+	return spec.withLocalCache(chunks.NewGCSStore(splitS3Path(spec.Path)))
+}
+
+func (spec DatabaseSpec) azureStore() chunks.ChunkStore {
+	return spec.withLocalCache(chunks.NewAzureStore(splitAzurePath(spec.Path)))
+}
+
+// withLocalCache puts the local cache of spec's database, if there is one, in front of |store|.
+func (spec DatabaseSpec) withLocalCache(store chunks.ChunkStore) chunks.ChunkStore {
+	if cache := spec.localCache(); cache != nil {
+		return chunks.NewTieredStore(cache, store)
+	}
+	return store
+}
+
+// localCache returns the LevelDB store in which chunks of the remote database named by spec are cached, or nil if caching isn't enabled. Each remote database is cached in its own directory, named after its location.
+func (spec DatabaseSpec) localCache() chunks.ChunkStore {
+	if cacheDir == "" {
+		return nil
+	}
+	location := spec.Path
+	if u, err := url.Parse(spec.String()); err == nil && u.Host != "" {
+		location = u.Host + u.Path
+	}
+	return getLDBStore(filepath.Join(cacheDir, spec.Protocol, url.QueryEscape(location)), false, chunks.LevelDBOptions{})
+}
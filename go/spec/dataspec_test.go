@@ -5,11 +5,15 @@
 package spec
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/datas"
@@ -44,6 +48,56 @@ func TestLDBDatabase(t *testing.T) {
 	os.Remove(dir)
 }
 
+func TestNBSDatabase(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	spec := fmt.Sprintf("nbs:%s", dir)
+
+	sp, err := ParseDatabaseSpec(spec)
+	assert.NoError(err)
+	store, err := sp.Database()
+	assert.NoError(err)
+	s1 := types.String("A String")
+	store.CommitValue(store.GetDataset("testDs"), s1)
+	store.Close()
+
+	store, err = sp.Database()
+	assert.NoError(err)
+	assert.True(s1.Equals(store.GetDataset("testDs").HeadValue()))
+	store.Close()
+}
+
+func TestBadgerDatabase(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	spec := fmt.Sprintf("badger:%s", dir)
+
+	sp, err := ParseDatabaseSpec(spec)
+	assert.NoError(err)
+	store, err := sp.Database()
+	assert.NoError(err)
+	s1 := types.String("A String")
+	store.CommitValue(store.GetDataset("testDs"), s1)
+
+	// Badger locks its directory, so a second database for the same spec shares the store.
+	store2, err := sp.Database()
+	assert.NoError(err)
+	assert.True(s1.Equals(store2.GetDataset("testDs").HeadValue()))
+	store2.Close()
+	store.Close()
+
+	store, err = sp.Database()
+	assert.NoError(err)
+	assert.True(s1.Equals(store.GetDataset("testDs").HeadValue()))
+	store.Close()
+}
+
 func TestMemDatabase(t *testing.T) {
 	assert := assert.New(t)
 
@@ -62,7 +116,7 @@ func TestMemDataset(t *testing.T) {
 	assert := assert.New(t)
 
 	spec := "mem::datasetTest"
-	sp1, err := parseDatasetSpec(spec)
+	sp1, err := ParseDatasetSpec(spec)
 	assert.NoError(err)
 	dataset1, err := sp1.Dataset()
 	assert.NoError(err)
@@ -72,6 +126,39 @@ func TestMemDataset(t *testing.T) {
 	assert.EqualValues(headVal, dsTest.HeadValue())
 }
 
+func TestSharedMemDatabase(t *testing.T) {
+	assert := assert.New(t)
+	defer DropMemStore("shared")
+
+	db, ds, err := GetDataset("mem://shared::ds")
+	assert.NoError(err)
+	_, err = db.CommitValue(ds, types.String("shared"))
+	assert.NoError(err)
+	db.Close()
+
+	// Other specs naming the same store see its data, even after it's closed, and other names and unnamed stores don't.
+	db, val, err := GetPath("mem://shared::ds.value")
+	assert.NoError(err)
+	assert.Equal(types.String("shared"), val)
+	db.Close()
+	for _, str := range []string{"mem://other::ds.value", "mem::ds.value"} {
+		db, val, err = GetPath(str)
+		assert.NoError(err)
+		assert.Nil(val, str)
+		db.Close()
+	}
+
+	sp, err := ParseDatabaseSpec("mem://shared?mode=ro")
+	assert.NoError(err)
+	assert.Equal("mem://shared?mode=ro", sp.String())
+
+	DropMemStore("shared")
+	db, val, err = GetPath("mem://shared::ds.value")
+	assert.NoError(err)
+	assert.Nil(val)
+	db.Close()
+}
+
 func TestLDBDataset(t *testing.T) {
 	assert := assert.New(t)
 
@@ -89,7 +176,7 @@ func TestLDBDataset(t *testing.T) {
 	db.Close()
 
 	spec := fmt.Sprintf("ldb:%s::%s", ldbPath, id)
-	sp, err := parseDatasetSpec(spec)
+	sp, err := ParseDatasetSpec(spec)
 	assert.NoError(err)
 	dataset, err := sp.Dataset()
 	assert.NoError(err)
@@ -116,7 +203,7 @@ func TestLDBObject(t *testing.T) {
 
 	spec2 := fmt.Sprintf("ldb:%s::%s", ldbpath, dsId)
 	assert.NoError(err)
-	sp1, err := parseDatasetSpec(spec2)
+	sp1, err := ParseDatasetSpec(spec2)
 	assert.NoError(err)
 	dataset2, err := sp1.Dataset()
 	assert.NoError(err)
@@ -164,7 +251,7 @@ func TestReadHash(t *testing.T) {
 func TestDatabaseSpecs(t *testing.T) {
 	assert := assert.New(t)
 
-	badSpecs := []string{"mem:stuff", "mem:", "http:", "https:", "random:", "random:random", "/file/ba:d"}
+	badSpecs := []string{"mem:stuff", "mem:", "mem://", "mem://a/b", "mem:///", "http:", "https:", "random:", "random:random", "/file/ba:d", "s3:", "s3:/prefix", "nbs:", "badger:", "badger:/path?block_cache=1MB", "grpc:", "grpc://", "grpc:host:8000", "grpcs://host:8000/db", "gs:", "gs:/prefix", "azure:account", "azure:/container", "azure:account/", "ldb:/path?mode=rx", "ldb:/path?foo=bar", "http://host?mode=rx", "ldb:/path?block_cache=lots", "ldb:/path?bloom_bits=0", "ldb:/path?max_open_files=-1", "nbs:/path?write_buffer=1MB", "mem?bloom_bits=10", "http://host?timeout=fast", "http://host?retries=-1", "https://host?max_idle_conns=0", "http://host?retry_backoff=-1s"}
 	for _, spec := range badSpecs {
 		_, err := ParseDatabaseSpec(spec)
 		assert.Error(err, spec)
@@ -183,6 +270,16 @@ func TestDatabaseSpecs(t *testing.T) {
 		{"john/doe", "ldb", "john/doe", ""},
 		{"/john/doe", "ldb", "/john/doe", ""},
 		{"mem", "mem", "", ""},
+		{"mem://shared-1", "mem", "shared-1", ""},
+		{"s3:bucket", "s3", "bucket", ""},
+		{"s3:bucket/john/doe", "s3", "bucket/john/doe", ""},
+		{"gs:bucket/john/doe", "gs", "bucket/john/doe", ""},
+		{"azure:account/container", "azure", "account/container", ""},
+		{"azure:account/container/john/doe", "azure", "account/container/john/doe", ""},
+		{"nbs:/filesys/john/doe", "nbs", "/filesys/john/doe", ""},
+		{"badger:/filesys/john/doe", "badger", "/filesys/john/doe", ""},
+		{"grpc://localhost:8000", "grpc", "//localhost:8000", ""},
+		{"grpcs://server.com:443/", "grpcs", "//server.com:443", ""},
 		{"http://server.com/john/doe?access_token=jane", "http", "//server.com/john/doe?access_token=jane", "jane"},
 		{"https://server.com/john/doe/?arg=2&qp1=true&access_token=jane", "https", "//server.com/john/doe/?arg=2&qp1=true&access_token=jane", "jane"},
 	}
@@ -199,19 +296,19 @@ func TestDatasetSpecs(t *testing.T) {
 	badSpecs := []string{"mem", "mem:", "mem:::ds", "http", "http:", "http://foo", "monkey", "monkey:balls", "mem:/a/bogus/path:dsname", "http://localhost:8000/one"}
 
 	for _, spec := range badSpecs {
-		_, err := parseDatasetSpec(spec)
+		_, err := ParseDatasetSpec(spec)
 		assert.Error(err, spec)
 	}
 
 	invalidDatasetNames := []string{" ", "", "$", "#", ":", "\n", "💩"}
 	for _, s := range invalidDatasetNames {
-		_, err := parseDatasetSpec("mem::" + s)
+		_, err := ParseDatasetSpec("mem::" + s)
 		assert.Error(err)
 	}
 
 	validDatasetNames := []string{"a", "Z", "0", "/", "-", "_"}
 	for _, s := range validDatasetNames {
-		_, err := parseDatasetSpec("mem::" + s)
+		_, err := ParseDatasetSpec("mem::" + s)
 		assert.NoError(err)
 	}
 
@@ -230,10 +327,10 @@ func TestDatasetSpecs(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		dsSpec, err := parseDatasetSpec(tc.spec)
+		dsSpec, err := ParseDatasetSpec(tc.spec)
 		assert.NoError(err)
 		dbSpec1 := DatabaseSpec{Protocol: tc.scheme, Path: tc.path, accessToken: tc.accessToken}
-		assert.Equal(datasetSpec{DbSpec: dbSpec1, DatasetName: tc.ds}, dsSpec)
+		assert.Equal(DatasetSpec{DbSpec: dbSpec1, DatasetName: tc.ds}, dsSpec)
 	}
 }
 
@@ -268,3 +365,282 @@ func TestPathSpec(t *testing.T) {
 		assert.Equal(expected, actual)
 	}
 }
+
+func TestRemoteDatabaseCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "cache")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	cacheDir = dir
+	defer func() { cacheDir = "" }()
+
+	server := datas.NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	spec := fmt.Sprintf("http://localhost:%d", <-portChan)
+
+	db, err := GetDatabase(spec)
+	assert.NoError(err)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("cached"))
+	assert.NoError(err)
+	head := ds.HeadRef().TargetHash()
+	db.Close()
+
+	cache := chunks.NewLevelDBStore(path.Join(dir, "http", url.QueryEscape(strings.TrimPrefix(spec, "http://"))), "", 24, false)
+	defer cache.Close()
+	assert.True(cache.Has(head))
+}
+
+func TestGRPCDatabase(t *testing.T) {
+	assert := assert.New(t)
+	server := datas.NewGRPCServer(chunks.NewMemoryStore(), 0)
+	portChan := make(chan int)
+	server.Ready = func() { portChan <- server.Port() }
+	go server.Run()
+	defer server.Stop()
+	spec := fmt.Sprintf("grpc://localhost:%d", <-portChan)
+
+	db, err := GetDatabase(spec)
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("remote"))
+	assert.NoError(err)
+	db.Close()
+
+	db, err = GetDatabase(spec + "?mode=ro")
+	assert.NoError(err)
+	defer db.Close()
+	assert.Equal(types.String("remote"), db.GetDataset("ds").HeadValue())
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("changed"))
+	assert.True(datas.IsReadOnlyError(err))
+}
+
+func TestBloomFilterFlag(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	bloomFilter = true
+	defer func() { bloomFilter = false }()
+
+	for _, protocol := range []string{"ldb", "nbs"} {
+		dbDir := path.Join(dir, protocol)
+		db, err := GetDatabase(fmt.Sprintf("%s:%s", protocol, dbDir))
+		assert.NoError(err)
+		s1 := types.String("A String")
+		_, err = db.CommitValue(db.GetDataset("testDs"), s1)
+		assert.NoError(err)
+		db.Close()
+
+		_, err = os.Stat(path.Join(dbDir, "noms.bloom"))
+		assert.NoError(err, protocol)
+
+		db, err = GetDatabase(fmt.Sprintf("%s:%s", protocol, dbDir))
+		assert.NoError(err)
+		assert.True(s1.Equals(db.GetDataset("testDs").HeadValue()))
+		db.Close()
+	}
+}
+
+func TestReadOnlySpecs(t *testing.T) {
+	assert := assert.New(t)
+	for spec, expected := range map[string]DatabaseSpec{
+		"ldb:/filesys/john/doe?mode=ro":      {Protocol: "ldb", Path: "/filesys/john/doe", ReadOnly: true},
+		"/john/doe?mode=ro":                  {Protocol: "ldb", Path: "/john/doe", ReadOnly: true},
+		"nbs:/filesys/john/doe?mode=rw":      {Protocol: "nbs", Path: "/filesys/john/doe"},
+		"mem?mode=ro":                        {Protocol: "mem", ReadOnly: true},
+		"http://server.com/john?mode=ro&x=1": {Protocol: "http", Path: "//server.com/john?mode=ro&x=1", ReadOnly: true},
+	} {
+		dbSpec, err := ParseDatabaseSpec(spec)
+		assert.NoError(err)
+		assert.Equal(expected, dbSpec)
+		roundTripped, err := ParseDatabaseSpec(dbSpec.String())
+		assert.NoError(err)
+		assert.Equal(dbSpec, roundTripped)
+	}
+}
+
+func TestReadOnlyDatabase(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ldbDir := path.Join(dir, "store")
+	db, err := GetDatabase("ldb:" + ldbDir)
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("A String"))
+	assert.NoError(err)
+	db.Close()
+
+	_, err = GetDatabase(fmt.Sprintf("ldb:%s?mode=ro", path.Join(dir, "missing")))
+	assert.Error(err)
+
+	db, ds, err := GetDataset(fmt.Sprintf("ldb:%s?mode=ro::ds", ldbDir))
+	assert.NoError(err)
+	assert.True(types.String("A String").Equals(ds.HeadValue()))
+	_, err = db.CommitValue(ds, types.String("Another String"))
+	assert.True(datas.IsReadOnlyError(err))
+	db.Close()
+
+	for _, spec := range []string{"ldb:" + ldbDir, "nbs:" + path.Join(dir, "nbs"), "mem"} {
+		db, err = GetDatabaseReadOnly(spec)
+		assert.NoError(err, spec)
+		_, err = db.Delete(db.GetDataset("ds"))
+		assert.True(datas.IsReadOnlyError(err), spec)
+		db.Close()
+	}
+
+	// The writable store is still usable afterwards.
+	db, err = GetDatabase("ldb:" + ldbDir)
+	assert.NoError(err)
+	assert.True(types.String("A String").Equals(db.GetDataset("ds").HeadValue()))
+	db.Close()
+}
+
+func TestLevelDBSpecParams(t *testing.T) {
+	assert := assert.New(t)
+	dbSpec, err := ParseDatabaseSpec("ldb:/filesys/john/doe?block_cache=1GiB&write_buffer=64MB&bloom_bits=-1&max_open_files=1000&mode=ro")
+	assert.NoError(err)
+	assert.Equal(DatabaseSpec{
+		Protocol:       "ldb",
+		Path:           "/filesys/john/doe",
+		ReadOnly:       true,
+		LevelDBOptions: chunks.LevelDBOptions{MaxOpenFiles: 1000, BlockCacheSize: 1 << 30, WriteBuffer: 64000000, BloomBits: -1},
+	}, dbSpec)
+	roundTripped, err := ParseDatabaseSpec(dbSpec.String())
+	assert.NoError(err)
+	assert.Equal(dbSpec, roundTripped)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := GetDatabase(fmt.Sprintf("ldb:%s?block_cache=16MiB&write_buffer=1MiB", dir))
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("tuned"))
+	assert.NoError(err)
+	db.Close()
+}
+
+func TestHTTPSpecParams(t *testing.T) {
+	assert := assert.New(t)
+	dbSpec, err := ParseDatabaseSpec("http://server.com/john?max_idle_conns=20&timeout=1m&retries=5&retry_backoff=250ms&x=1")
+	assert.NoError(err)
+	assert.Equal(datas.HTTPClientOptions{MaxIdleConns: 20, Timeout: time.Minute, Retries: 5, RetryBackoff: 250 * time.Millisecond}, dbSpec.HTTPClientOptions)
+	roundTripped, err := ParseDatabaseSpec(dbSpec.String())
+	assert.NoError(err)
+	assert.Equal(dbSpec, roundTripped)
+
+	dbSpec, err = ParseDatabaseSpec("https://server.com?retries=0")
+	assert.NoError(err)
+	assert.Equal(datas.HTTPClientOptions{Retries: -1}, dbSpec.HTTPClientOptions)
+
+	dbSpec, err = ParseDatabaseSpec("https://server.com?write_buffer=8MiB&flush_interval=0")
+	assert.NoError(err)
+	assert.Equal(datas.HTTPClientOptions{WriteBufferBytes: 8 << 20, FlushInterval: -1}, dbSpec.HTTPClientOptions)
+}
+
+func TestCredentials(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	keyFile := path.Join(dir, "key")
+	assert.NoError(ioutil.WriteFile(keyFile, []byte("000102030405060708090a0b0c0d0e0f"), 0600))
+
+	sp, err := ParseDatabaseSpec("nbs:" + path.Join(dir, "store"))
+	assert.NoError(err)
+	sp.Credentials = Credentials{KeyFile: keyFile}
+	// Credentials aren't part of the spec string.
+	assert.Equal("nbs:"+path.Join(dir, "store"), sp.String())
+	db, err := sp.Database()
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("ds"), types.String("secret"))
+	assert.NoError(err)
+	db.Close()
+
+	// The chunks are only readable with the key.
+	cs, err := GetChunkStore(sp.String())
+	assert.NoError(err)
+	assert.False(bytes.Contains(cs.Get(cs.Root()).Data(), []byte("ds")))
+	cs.Close()
+	db, err = sp.Database()
+	assert.NoError(err)
+	assert.True(types.String("secret").Equals(db.GetDataset("ds").HeadValue()))
+	db.Close()
+
+	sp.Credentials.KeyFile = path.Join(dir, "missing")
+	_, err = sp.Database()
+	assert.Error(err)
+
+	sp, err = ParseDatabaseSpec("http://localhost:8000")
+	assert.NoError(err)
+	sp.Credentials = Credentials{KeyFile: keyFile}
+	_, err = sp.Database()
+	assert.Error(err)
+}
+
+func TestAccessFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	accessFile := path.Join(dir, "access.toml")
+	assert.NoError(ioutil.WriteFile(accessFile, []byte("[anonymous]\nread = [\"*\"]\n\n[token.alice]\ntoken = \"alice-secret\"\nwrite = [\"alice-*\"]\n"), 0600))
+
+	sp, err := ParseDatabaseSpec("nbs:" + path.Join(dir, "store"))
+	assert.NoError(err)
+	sp.Credentials = Credentials{AuthToken: "alice-secret", AccessFile: accessFile}
+	db, err := sp.Database()
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("alice-notes"), types.String("hi"))
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("notes"), types.String("hi"))
+	assert.True(datas.IsAccessDeniedError(err))
+	db.Close()
+
+	sp.Credentials.AuthToken = ""
+	db, err = sp.Database()
+	assert.NoError(err)
+	assert.True(types.String("hi").Equals(db.GetDataset("alice-notes").HeadValue()))
+	_, err = db.CommitValue(db.GetDataset("alice-notes"), types.String("bye"))
+	assert.True(datas.IsAccessDeniedError(err))
+	db.Close()
+
+	sp.Credentials.AuthToken = "mallory"
+	_, err = sp.Database()
+	assert.Error(err)
+	sp.Credentials.AccessFile = path.Join(dir, "missing")
+	_, err = sp.Database()
+	assert.Error(err)
+}
+
+// FuzzParseSpec checks that parsing arbitrary database, dataset and path specs, as typed by users, fails with an error rather than panicking, and that whatever parses can be written out again.
+func FuzzParseSpec(f *testing.F) {
+	for _, spec := range []string{
+		"mem",
+		"mem://name::ds",
+		"ldb:/path/to/store?mode=ro&max_open_files=10::ds",
+		"http://localhost:8000/db?retries=0&timeout=5s::ds.value",
+		"nbs:/tmp/nbs::#" + types.Number(1).Hash().String() + ".foo[0]",
+		"azure:account/container::ds@2016-01-02T15:04:05Z~3.value",
+		"s3:bucket/prefix::ds[\"key\"]@key",
+		"::",
+		"ldb:?",
+	} {
+		f.Add(spec)
+	}
+
+	f.Fuzz(func(t *testing.T, str string) {
+		if sp, err := ParseDatabaseSpec(str); err == nil {
+			_ = sp.String()
+		}
+		if sp, err := ParseDatasetSpec(str); err == nil {
+			_ = sp.String()
+		}
+		if sp, err := ParsePathSpec(str); err == nil {
+			_ = sp.String()
+		}
+	})
+}
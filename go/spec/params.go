@@ -0,0 +1,155 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package spec
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/stormasm/noms/go/datas"
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Parameters which may be given in the query of a database spec, e.g. "ldb:/path?mode=ro&block_cache=1GiB". The query of an http(s) spec is part of its URL, so only mode and the http parameters are recognized there, and the rest are left for the server.
+const (
+	// modeParam is "ro" to open the database read-only, or "rw", the default.
+	modeParam = "mode"
+	// These tune ldb databases; see chunks.LevelDBOptions. Sizes may have units, e.g. "512MB" or "1GiB".
+	maxOpenFilesParam = "max_open_files"
+	blockCacheParam   = "block_cache"
+	writeBufferParam  = "write_buffer"
+	bloomBitsParam    = "bloom_bits"
+	// These configure the HTTP client of http(s) databases; see datas.HTTPClientOptions. Durations have units, e.g. "30s", and retries may be 0 to never retry. write_buffer also applies there, and it and flush_interval may be 0 to only flush on Commit.
+	maxIdleConnsParam  = "max_idle_conns"
+	timeoutParam       = "timeout"
+	retriesParam       = "retries"
+	retryBackoffParam  = "retry_backoff"
+	flushIntervalParam = "flush_interval"
+)
+
+// parseMode returns true if the database mode |mode| is read-only.
+func parseMode(mode string) (bool, error) {
+	switch mode {
+	case "", "rw":
+		return false, nil
+	case "ro":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Invalid mode %s; it must be ro or rw", mode)
+	}
+}
+
+// applyParams sets the fields of spec given by the parameters in |query|. If a parameter is given more than once, the last value wins.
+func (spec *DatabaseSpec) applyParams(query url.Values) (err error) {
+	for param, vals := range query {
+		val := vals[len(vals)-1]
+		if param != modeParam && spec.Protocol != "ldb" {
+			return fmt.Errorf("Parameter %s only applies to ldb databases", param)
+		}
+		opts := &spec.LevelDBOptions
+		switch param {
+		case modeParam:
+			spec.ReadOnly, err = parseMode(val)
+		case maxOpenFilesParam:
+			opts.MaxOpenFiles, err = parseIntParam(param, val, false)
+		case blockCacheParam:
+			opts.BlockCacheSize, err = parseSizeParam(param, val)
+		case writeBufferParam:
+			opts.WriteBuffer, err = parseSizeParam(param, val)
+		case bloomBitsParam:
+			opts.BloomBits, err = parseIntParam(param, val, true)
+		default:
+			err = fmt.Errorf("Unknown parameter %s", param)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseHTTPParams returns the datas.HTTPClientOptions given by the parameters in the query of an http(s) spec. Parameters it doesn't know are ignored, since they're for the server.
+func parseHTTPParams(query url.Values) (opts datas.HTTPClientOptions, err error) {
+	for param, vals := range query {
+		val := vals[len(vals)-1]
+		switch param {
+		case maxIdleConnsParam:
+			opts.MaxIdleConns, err = parseIntParam(param, val, false)
+		case timeoutParam:
+			opts.Timeout, err = parseDurationParam(param, val)
+		case retriesParam:
+			if val == "0" {
+				opts.Retries = -1
+			} else {
+				opts.Retries, err = parseIntParam(param, val, false)
+			}
+		case retryBackoffParam:
+			opts.RetryBackoff, err = parseDurationParam(param, val)
+		case writeBufferParam:
+			if val == "0" {
+				opts.WriteBufferBytes = -1
+			} else {
+				opts.WriteBufferBytes, err = parseSizeParam(param, val)
+			}
+		case flushIntervalParam:
+			if val == "0" {
+				opts.FlushInterval = -1
+			} else {
+				opts.FlushInterval, err = parseDurationParam(param, val)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseIntParam parses the value of an integer parameter, which must be positive, or if |allowNegative| is true, non-zero.
+func parseIntParam(param, val string, allowNegative bool) (int, error) {
+	i, err := strconv.Atoi(val)
+	if err != nil || i == 0 || (i < 0 && !allowNegative) {
+		return 0, fmt.Errorf("Invalid %s %s", param, val)
+	}
+	return i, nil
+}
+
+func parseSizeParam(param, val string) (int, error) {
+	size, err := humanize.ParseBytes(val)
+	if err != nil || size == 0 || size > 1<<40 {
+		return 0, fmt.Errorf("Invalid %s %s", param, val)
+	}
+	return int(size), nil
+}
+
+func parseDurationParam(param, val string) (time.Duration, error) {
+	dur, err := time.ParseDuration(val)
+	if err != nil || dur <= 0 {
+		return 0, fmt.Errorf("Invalid %s %s", param, val)
+	}
+	return dur, nil
+}
+
+// params returns the parameters that applyParams() would need to recreate the fields of spec they set.
+func (spec DatabaseSpec) params() url.Values {
+	params := url.Values{}
+	if spec.ReadOnly {
+		params.Set(modeParam, "ro")
+	}
+	opts := spec.LevelDBOptions
+	for param, val := range map[string]int{
+		maxOpenFilesParam: opts.MaxOpenFiles,
+		blockCacheParam:   opts.BlockCacheSize,
+		writeBufferParam:  opts.WriteBuffer,
+		bloomBitsParam:    opts.BloomBits,
+	} {
+		if val != 0 {
+			params.Set(param, strconv.Itoa(val))
+		}
+	}
+	return params
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package spec
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+)
+
+// Factory returns the ChunkStore for the database at |path|, which is the part of a database spec after the protocol, e.g. "bucket/prefix" in "myproto:bucket/prefix". |path| is never empty.
+type Factory func(path string) (chunks.ChunkStore, error)
+
+var (
+	builtinProtocols = map[string]bool{"http": true, "https": true, "grpc": true, "grpcs": true, "ldb": true, "s3": true, "gs": true, "azure": true, "nbs": true, "badger": true, "mem": true}
+	protocolsMu      = &sync.RWMutex{}
+	protocols        = map[string]Factory{}
+)
+
+// RegisterProtocol makes databases spelled as "scheme:path" available everywhere a database spec is accepted, including through the config resolver, backed by the ChunkStores that |factory| returns. It's meant to be called from the init function of the package implementing the backend. It panics if |scheme| is invalid, built in, or already registered.
+func RegisterProtocol(scheme string, factory Factory) {
+	d.PanicIfTrue(scheme == "" || strings.ContainsAny(scheme, ":/"), "Invalid database protocol: %s", scheme)
+	d.PanicIfTrue(builtinProtocols[scheme], "Can't replace the built in database protocol: %s", scheme)
+	d.PanicIfTrue(factory == nil, "Nil Factory for database protocol: %s", scheme)
+
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+	_, ok := protocols[scheme]
+	d.PanicIfTrue(ok, "Database protocol %s is already registered", scheme)
+	protocols[scheme] = factory
+}
+
+func registeredProtocol(scheme string) (Factory, bool) {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+	factory, ok := protocols[scheme]
+	return factory, ok
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package spec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+var testProtocolStores = map[string]*chunks.MemoryStore{}
+
+func init() {
+	RegisterProtocol("testproto", func(path string) (chunks.ChunkStore, error) {
+		if path == "broken" {
+			return nil, errors.New("broken database")
+		}
+		if _, ok := testProtocolStores[path]; !ok {
+			testProtocolStores[path] = chunks.NewMemoryStore()
+		}
+		return testProtocolStores[path], nil
+	})
+}
+
+func TestRegisteredProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	sp, err := ParseDatabaseSpec("testproto:some/where")
+	assert.NoError(err)
+	assert.Equal(DatabaseSpec{Protocol: "testproto", Path: "some/where"}, sp)
+
+	_, err = ParseDatabaseSpec("testproto:")
+	assert.Error(err)
+
+	db, ds, err := GetDataset("testproto:some/where::ds")
+	assert.NoError(err)
+	ds, err = db.CommitValue(ds, types.String("hello"))
+	assert.NoError(err)
+	db.Close()
+
+	_, val, err := GetPath("testproto:some/where::ds.value")
+	assert.NoError(err)
+	assert.Equal(types.String("hello"), val)
+
+	cs, err := GetChunkStore("testproto:some/where")
+	assert.NoError(err)
+	assert.True(cs == testProtocolStores["some/where"])
+	assert.False(cs.Root().IsEmpty())
+
+	_, err = GetDatabase("testproto:broken")
+	assert.Error(err)
+	_, err = GetChunkStore("testproto:broken")
+	assert.Error(err)
+}
+
+func TestRegisterProtocolPanics(t *testing.T) {
+	assert := assert.New(t)
+	factory := func(path string) (chunks.ChunkStore, error) { return chunks.NewMemoryStore(), nil }
+
+	assert.Panics(func() { RegisterProtocol("testproto", factory) })
+	assert.Panics(func() { RegisterProtocol("ldb", factory) })
+	assert.Panics(func() { RegisterProtocol("", factory) })
+	assert.Panics(func() { RegisterProtocol("a:b", factory) })
+	assert.Panics(func() { RegisterProtocol("nilfactory", nil) })
+}
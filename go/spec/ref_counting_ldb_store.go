@@ -10,13 +10,13 @@ import (
 )
 
 type refCountingLdbStore struct {
-	*chunks.LevelDBStore
+	chunks.ChunkStore
 	refCount int
 	closeFn  func()
 }
 
-func newRefCountingLdbStore(path string, closeFn func()) *refCountingLdbStore {
-	return &refCountingLdbStore{chunks.NewLevelDBStoreUseFlags(path, ""), 1, closeFn}
+func newRefCountingLdbStore(store chunks.ChunkStore, closeFn func()) *refCountingLdbStore {
+	return &refCountingLdbStore{store, 1, closeFn}
 }
 
 func (r *refCountingLdbStore) AddRef() {
@@ -27,8 +27,15 @@ func (r *refCountingLdbStore) Close() (err error) {
 	d.PanicIfFalse(r.refCount > 0)
 	r.refCount--
 	if r.refCount == 0 {
-		err = r.LevelDBStore.Close()
+		err = r.ChunkStore.Close()
 		r.closeFn()
 	}
 	return
 }
+
+func (r *refCountingLdbStore) RootLog(n int) []chunks.RootLogEntry {
+	if rl, ok := r.ChunkStore.(chunks.RootLogger); ok {
+		return rl.RootLog(n)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// maxDepth is deeper than any b-tree in a valid database, which stops cycles in corrupt ones from recursing forever.
+const maxDepth = 64
+
+// Reader reads the tables of a SQLite database file.
+type Reader struct {
+	r        io.ReaderAt
+	pageSize int
+	usable   int
+	pages    uint32
+	tables   []Table
+}
+
+// NewReader returns a Reader of the SQLite database file |r| of |size| bytes. The database must be UTF-8 encoded.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	header := make([]byte, headerSize)
+	if n, err := r.ReadAt(header, 0); n != headerSize {
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("Invalid SQLite database, it's too short")
+		}
+		return nil, err
+	}
+	if !IsSQLite(header) {
+		return nil, fmt.Errorf("Invalid SQLite database, it doesn't start with %q", fileMagic)
+	}
+	pageSize := int(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("Invalid SQLite database, its page size is %d", pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(header[56:]); encoding > 1 {
+		return nil, fmt.Errorf("SQLite databases encoded in UTF-16 aren't supported")
+	}
+
+	sr := &Reader{r: r, pageSize: pageSize, usable: pageSize - int(header[20]), pages: uint32(size / int64(pageSize))}
+	err := d.Try(func() {
+		sr.walk(1, func(rowid int64, payload []byte) {
+			values := decodeRecord(payload)
+			if len(values) < 5 {
+				return
+			}
+			typ, _ := values[0].(string)
+			name, _ := values[1].(string)
+			root, _ := values[3].(int64)
+			sql, _ := values[4].(string)
+			if typ != "table" || strings.HasPrefix(name, "sqlite_") || root == 0 {
+				return
+			}
+			t, err := parseCreateTable(name, sql)
+			d.PanicIfError(err)
+			t.root = uint32(root)
+			sr.tables = append(sr.tables, t)
+		})
+	})
+	if err != nil {
+		return nil, d.Unwrap(err)
+	}
+	return sr, nil
+}
+
+// Tables returns the tables of the database, leaving out SQLite's own, in the order they were created.
+func (sr *Reader) Tables() []Table {
+	return sr.tables
+}
+
+// Table returns the table named |name|, which like in SQL, is case insensitive.
+func (sr *Reader) Table(name string) (Table, bool) {
+	for _, t := range sr.tables {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return Table{}, false
+}
+
+// ReadTable reads the rows of |t| into a Map of structs, named for the table, with a field for each of its columns, escaped with types.EscapeStructField. NULLs are left out of the structs. Integers and reals are Numbers, except that integers in columns declared as booleans are Bools, text is Strings, and BLOBs are Blobs. The Map is keyed by the value of the table's primary key column, by structs named Key with a field for each column if the primary key has several, or by the rowid if it has none.
+func (sr *Reader) ReadTable(t Table, vrw types.ValueReadWriter) (types.Map, error) {
+	if t.withoutRowid {
+		return types.Map{}, fmt.Errorf("Table %s is a WITHOUT ROWID table, which isn't supported", t.Name)
+	}
+	names := make([]string, len(t.Columns))
+	seen := map[string]bool{}
+	for i, c := range t.Columns {
+		names[i] = types.EscapeStructField(c.Name)
+		if seen[names[i]] {
+			return types.Map{}, fmt.Errorf("Column %s of table %s appears more than once", c.Name, t.Name)
+		}
+		seen[names[i]] = true
+	}
+	pk := make([]int, len(t.PrimaryKey))
+	for i, p := range t.PrimaryKey {
+		pk[i] = t.columnIndex(p)
+	}
+	structName := types.EscapeStructField(t.Name)
+
+	gb := types.NewGraphBuilder(vrw, types.MapKind, false)
+	err := d.Try(func() {
+		sr.walk(t.root, func(rowid int64, payload []byte) {
+			record := decodeRecord(payload)
+			values := make([]types.Value, len(t.Columns))
+			data := types.StructData{}
+			stored := 0
+			for i, c := range t.Columns {
+				if c.virtual {
+					continue
+				}
+				// Columns added since a row was written aren't in its record.
+				v := c.dflt
+				if stored < len(record) {
+					v = record[stored]
+				}
+				stored++
+				if i == t.rowidColumn {
+					v = rowid
+				}
+				if values[i] = nomsValue(v, c, vrw); values[i] != nil {
+					data[names[i]] = values[i]
+				}
+			}
+
+			var key types.Value
+			switch len(pk) {
+			case 0:
+				key = types.Number(rowid)
+			case 1:
+				key = values[pk[0]]
+			default:
+				fields := types.StructData{}
+				for _, i := range pk {
+					if values[i] != nil {
+						fields[names[i]] = values[i]
+					}
+				}
+				if len(fields) == len(pk) {
+					key = types.NewStruct("Key", fields)
+				}
+			}
+			d.PanicIfTrue(key == nil, "Row %d of table %s has a NULL primary key", rowid, t.Name)
+			gb.MapSet(nil, key, types.NewStruct(structName, data))
+		})
+	})
+	// The builder has to be built to stop its goroutines, even if there's an error.
+	m := gb.Build().(types.Map)
+	if err != nil {
+		return types.Map{}, d.Unwrap(err)
+	}
+	return m, nil
+}
+
+// ReadAll reads every table of the database with ReadTable, into a Map from the names of the tables to them.
+func (sr *Reader) ReadAll(vrw types.ValueReadWriter) (types.Map, error) {
+	kvs := []types.Value{}
+	for _, t := range sr.tables {
+		m, err := sr.ReadTable(t, vrw)
+		if err != nil {
+			return types.Map{}, err
+		}
+		kvs = append(kvs, types.String(t.Name), m)
+	}
+	return types.NewMap(kvs...), nil
+}
+
+// isBoolType returns whether a column declared as |typ| holds booleans.
+func isBoolType(typ string) bool {
+	return strings.Contains(strings.ToUpper(typ), "BOOL")
+}
+
+func nomsValue(v value, c Column, vrw types.ValueReadWriter) types.Value {
+	switch v := v.(type) {
+	case int64:
+		if isBoolType(c.Type) {
+			return types.Bool(v != 0)
+		}
+		return types.Number(v)
+	case float64:
+		return types.Number(v)
+	case string:
+		return types.String(v)
+	case []byte:
+		return types.NewStreamingBlob(vrw, bytes.NewReader(v))
+	}
+	return nil
+}
+
+// page returns the contents of page |n|, which are numbered from 1.
+func (sr *Reader) page(n uint32) []byte {
+	d.PanicIfTrue(n == 0 || n > sr.pages, "Invalid SQLite database, page %d is out of range", n)
+	p := make([]byte, sr.pageSize)
+	_, err := sr.r.ReadAt(p, int64(n-1)*int64(sr.pageSize))
+	if err == io.EOF {
+		err = nil
+	}
+	d.PanicIfError(err)
+	return p[:sr.usable]
+}
+
+// walk calls |f| with the rowid and payload of each row of the table b-tree whose root is page |root|, in order of rowid. It panics with wrapped errors, which callers recover with d.Try, if the database is corrupt.
+func (sr *Reader) walk(root uint32, f func(rowid int64, payload []byte)) {
+	sr.walkPage(root, 0, f)
+}
+
+func (sr *Reader) walkPage(n uint32, depth int, f func(rowid int64, payload []byte)) {
+	d.PanicIfTrue(depth > maxDepth, "Invalid SQLite database, a b-tree is too deep")
+	p := sr.page(n)
+	hdr := 0
+	if n == 1 {
+		hdr = headerSize
+	}
+	d.PanicIfTrue(hdr+12 > len(p), "Invalid SQLite database, page %d is too small", n)
+	typ := p[hdr]
+	cells := int(binary.BigEndian.Uint16(p[hdr+3:]))
+	ptrs := hdr + 8
+	if typ == pageTableInterior {
+		ptrs = hdr + 12
+	}
+	d.PanicIfTrue(ptrs+2*cells > len(p), "Invalid SQLite database, page %d has too many cells", n)
+
+	for i := 0; i < cells; i++ {
+		off := int(binary.BigEndian.Uint16(p[ptrs+2*i:]))
+		d.PanicIfTrue(off >= len(p), "Invalid SQLite database, a cell of page %d is out of range", n)
+		cell := p[off:]
+		switch typ {
+		case pageTableLeaf:
+			size, n1 := varint(cell)
+			rowid, n2 := varint(cell[n1:])
+			f(int64(rowid), sr.payload(cell[n1+n2:], size))
+		case pageTableInterior:
+			d.PanicIfTrue(len(cell) < 4, "Invalid SQLite database, a cell of page %d is truncated", n)
+			sr.walkPage(binary.BigEndian.Uint32(cell), depth+1, f)
+		default:
+			d.PanicIfTrue(true, "Invalid SQLite database, page %d isn't a table b-tree page", n)
+		}
+	}
+	if typ == pageTableInterior {
+		sr.walkPage(binary.BigEndian.Uint32(p[hdr+8:]), depth+1, f)
+	}
+}
+
+// payload returns the payload of |size| bytes of a table b-tree cell, which starts at |cell|, and continues on overflow pages if it doesn't fit.
+func (sr *Reader) payload(cell []byte, size uint64) []byte {
+	d.PanicIfTrue(size > uint64(sr.pages)*uint64(sr.usable), "Invalid SQLite database, a payload of %d bytes is too big", size)
+	local := localPayload(int(size), sr.usable, false)
+	d.PanicIfTrue(local > len(cell), "Invalid SQLite database, a cell is truncated")
+	if uint64(local) == size {
+		return cell[:local]
+	}
+
+	d.PanicIfTrue(local+4 > len(cell), "Invalid SQLite database, a cell is truncated")
+	payload := append(make([]byte, 0, size), cell[:local]...)
+	next := binary.BigEndian.Uint32(cell[local:])
+	for uint64(len(payload)) < size {
+		p := sr.page(next)
+		next = binary.BigEndian.Uint32(p)
+		n := len(p) - 4
+		if rest := int(size) - len(payload); rest < n {
+			n = rest
+		}
+		payload = append(payload, p[4:4+n]...)
+	}
+	return payload
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestReadAll(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	f := &memFile{}
+	w := NewWriter(f)
+	a := types.NewList(types.NewStruct("A", types.StructData{"x": types.String("a")}))
+	b := types.NewMap(types.String("b"), types.NewStruct("B", types.StructData{"y": types.String("b")}))
+	assert.NoError(w.WriteTable("a", a, nil))
+	assert.NoError(w.WriteTable("b table", b, nil))
+	assert.NoError(w.Close())
+
+	m, err := f.reader(assert).ReadAll(vs)
+	assert.NoError(err)
+	assert.True(types.NewMap(
+		types.String("a"), types.NewMap(types.Number(1), types.NewStruct("a", types.StructData{"x": types.String("a")})),
+		types.String("b table"), types.NewMap(types.String("b"), types.NewStruct("bQ20table", types.StructData{"y": types.String("b")})),
+	).Equals(m))
+}
+
+func TestReadTableRecords(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	// A table whose records are missing a column added since, which has a default, and have a NULL in a column that's an alias for the rowid.
+	f := &memFile{}
+	w := NewWriter(f)
+	assert.NoError(w.WriteTable("t", types.NewMap(types.Number(7), types.NewStruct("Row", types.StructData{"id": types.Number(7), "on": types.Bool(true)})), nil))
+	assert.NoError(w.Close())
+	r := f.reader(assert)
+	tbl, _ := r.Table("t")
+	tbl.Columns = append(tbl.Columns, Column{Name: "added", Type: "TEXT", dflt: "default"}, Column{Name: "none"})
+	m, err := r.ReadTable(tbl, vs)
+	assert.NoError(err)
+	assert.True(types.NewMap(types.Number(7), types.NewStruct("t", types.StructData{"id": types.Number(7), "on": types.Bool(true), "added": types.String("default")})).Equals(m))
+
+	tbl.withoutRowid = true
+	_, err = r.ReadTable(tbl, vs)
+	assert.Error(err)
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	f := &memFile{}
+	w := NewWriter(f)
+	assert.NoError(w.WriteTable("t", types.NewList(types.NewStruct("Row", types.StructData{"a": types.Number(1)})), nil))
+	assert.NoError(w.Close())
+
+	for _, b := range [][]byte{
+		nil,
+		[]byte("SQLite format 3\x00"),
+		bytes.Repeat([]byte{0}, 100),
+		withPatch(f.b, func(b []byte) { binary.BigEndian.PutUint16(b[16:], 1000) }),
+		withPatch(f.b, func(b []byte) { binary.BigEndian.PutUint32(b[56:], 2) }),
+		withPatch(f.b, func(b []byte) { b[100] = 0x0a }),
+		withPatch(f.b, func(b []byte) { binary.BigEndian.PutUint16(b[103:], 1000) }),
+	} {
+		_, err := NewReader(bytes.NewReader(b), int64(len(b)))
+		assert.Error(err)
+	}
+}
+
+// withPatch returns a copy of |b| changed by |patch|.
+func withPatch(b []byte, patch func(b []byte)) []byte {
+	b = append([]byte{}, b...)
+	patch(b)
+	return b
+}
@@ -0,0 +1,296 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Column is a column of a table, and the type it was declared with, which can be empty.
+type Column struct {
+	Name string
+	Type string
+
+	// virtual is whether the column is generated and not stored in the table's records.
+	virtual bool
+	// dflt is the column's default, if it's a constant, which rows written before the column was added have.
+	dflt value
+}
+
+// Table is a table in a SQLite database, as declared by its CREATE TABLE statement.
+type Table struct {
+	Name       string
+	Columns    []Column
+	PrimaryKey []string
+
+	// rowidColumn is the index of the column that's an alias for the rowid, i.e. an INTEGER PRIMARY KEY, or -1 if there isn't one.
+	rowidColumn  int
+	withoutRowid bool
+	root         uint32
+}
+
+// token is a token of SQL. Identifiers are unquoted, and quoted is whether they were quoted, which stops them being keywords.
+type token struct {
+	text   string
+	quoted bool
+}
+
+func (t token) is(keyword string) bool {
+	return !t.quoted && strings.EqualFold(t.text, keyword)
+}
+
+// tokenize splits |sql| into tokens, leaving out whitespace and comments.
+func tokenize(sql string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid SQL, unterminated comment")
+			}
+			i += end + 4
+		case c == '"' || c == '`' || c == '[' || c == '\'':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			text := []byte{}
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, fmt.Errorf("Invalid SQL, unterminated %c", c)
+				}
+				if sql[j] == closing {
+					// Quotes are escaped by doubling them, except in brackets.
+					if closing != ']' && j+1 < len(sql) && sql[j+1] == closing {
+						text = append(text, closing)
+						j += 2
+						continue
+					}
+					break
+				}
+				text = append(text, sql[j])
+				j++
+			}
+			// Single quotes are string literals, which aren't identifiers, but can stand in for them.
+			tokens = append(tokens, token{string(text), true})
+			i = j + 1
+		case c == '_' || c == '$' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(sql) && (sql[j] == '_' || sql[j] == '$' || sql[j] == '.' && unicode.IsDigit(rune(sql[i])) || sql[j] >= 0x80 || unicode.IsLetter(rune(sql[j])) || unicode.IsDigit(rune(sql[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{sql[i:j], false})
+			i = j
+		default:
+			tokens = append(tokens, token{string(c), false})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// splitItems splits |tokens| at the commas that aren't in parentheses.
+func splitItems(tokens []token) [][]token {
+	items := [][]token{}
+	depth, start := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			items = append(items, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, tokens[start:])
+}
+
+// columnConstraints are the keywords that end the type of a column and start its constraints.
+var columnConstraints = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+// parseCreateTable parses the CREATE TABLE statement that declared the table |name|, as SQLite stores it in the schema table.
+func parseCreateTable(name, sql string) (Table, error) {
+	t := Table{Name: name, rowidColumn: -1}
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return t, err
+	}
+	open, close := -1, -1
+	depth := 0
+	for i, tok := range tokens {
+		if tok.is("(") {
+			if depth == 0 && open < 0 {
+				open = i
+			}
+			depth++
+		} else if tok.is(")") {
+			depth--
+			if depth == 0 && close < 0 {
+				close = i
+			}
+		}
+	}
+	if open < 0 || close < 0 {
+		return t, fmt.Errorf("Can't parse the columns of table %s from %s", name, sql)
+	}
+	for i := close + 1; i+1 < len(tokens); i++ {
+		if tokens[i].is("WITHOUT") && tokens[i+1].is("ROWID") {
+			t.withoutRowid = true
+		}
+	}
+
+	pk := []string{}
+	for _, item := range splitItems(tokens[open+1 : close]) {
+		if len(item) == 0 {
+			return t, fmt.Errorf("Can't parse the columns of table %s from %s", name, sql)
+		}
+		first := item[0]
+		if first.is("CONSTRAINT") || first.is("PRIMARY") || first.is("UNIQUE") || first.is("CHECK") || first.is("FOREIGN") {
+			for i := 0; i+2 < len(item); i++ {
+				if item[i].is("PRIMARY") && item[i+1].is("KEY") && item[i+2].is("(") {
+					end := i + 3
+					for end < len(item) && !item[end].is(")") {
+						end++
+					}
+					for _, col := range splitItems(item[i+3 : end]) {
+						if len(col) > 0 {
+							pk = append(pk, col[0].text)
+						}
+					}
+				}
+			}
+			continue
+		}
+
+		c := Column{Name: first.text}
+		typeEnd := 1
+	typeLoop:
+		for depth := 0; typeEnd < len(item); typeEnd++ {
+			tok := item[typeEnd]
+			switch {
+			case tok.is("("):
+				depth++
+			case tok.is(")"):
+				depth--
+			case depth == 0:
+				for _, kw := range columnConstraints {
+					if tok.is(kw) {
+						break typeLoop
+					}
+				}
+			}
+		}
+		for j, tok := range item[1:typeEnd] {
+			// Words are separated by spaces, but not punctuation, as in DECIMAL(10,2).
+			if j > 0 && !tok.is("(") && !tok.is(")") && !tok.is(",") && !item[j].is("(") && !item[j].is(",") {
+				c.Type += " "
+			}
+			c.Type += tok.text
+		}
+
+		generated, stored := false, false
+		constraints := item[typeEnd:]
+		for i, tok := range constraints {
+			switch {
+			case tok.is("PRIMARY") && i+1 < len(constraints) && constraints[i+1].is("KEY"):
+				pk = append(pk, c.Name)
+			case tok.is("AS"):
+				generated = true
+			case tok.is("STORED"):
+				stored = true
+			case tok.is("DEFAULT") && i+1 < len(constraints):
+				c.dflt = parseLiteral(constraints[i+1:])
+			}
+		}
+		c.virtual = generated && !stored
+		t.Columns = append(t.Columns, c)
+	}
+
+	for i, p := range pk {
+		j := t.columnIndex(p)
+		if j < 0 {
+			return t, fmt.Errorf("Table %s has a primary key column %s, but there's no such column", name, p)
+		}
+		pk[i] = t.Columns[j].Name
+	}
+	t.PrimaryKey = pk
+	if len(pk) == 1 && !t.withoutRowid {
+		if i := t.columnIndex(pk[0]); strings.EqualFold(t.Columns[i].Type, "INTEGER") {
+			t.rowidColumn = i
+		}
+	}
+	return t, nil
+}
+
+// parseLiteral parses the literal at the start of |tokens|, returning nil if it's NULL or isn't a literal.
+func parseLiteral(tokens []token) value {
+	tok, sign := tokens[0], ""
+	if (tok.is("-") || tok.is("+")) && len(tokens) > 1 {
+		tok, sign = tokens[1], tok.text
+	}
+	switch {
+	case tok.quoted:
+		return tok.text
+	case tok.is("TRUE"):
+		return int64(1)
+	case tok.is("FALSE"):
+		return int64(0)
+	}
+	if i, err := strconv.ParseInt(sign+tok.text, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(sign+tok.text, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+// columnIndex returns the index of the column named |name|, which like in SQL, is case insensitive, or -1 if there isn't one.
+func (t Table) columnIndex(name string) int {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// quoteIdentifier quotes |name| for use as an identifier in SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// createTableSQL returns the CREATE TABLE statement for |t|. A primary key that's an alias for the rowid is declared with its column, and any other with a table constraint.
+func createTableSQL(t Table) string {
+	defs := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		defs[i] = quoteIdentifier(c.Name) + " " + c.Type
+		if i == t.rowidColumn {
+			defs[i] += " PRIMARY KEY"
+		}
+	}
+	if len(t.PrimaryKey) > 0 && t.rowidColumn < 0 {
+		cols := make([]string, len(t.PrimaryKey))
+		for i, p := range t.PrimaryKey {
+			cols[i] = quoteIdentifier(p)
+		}
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(cols, ", ")))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(t.Name), strings.Join(defs, ", "))
+}
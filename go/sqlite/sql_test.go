@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	assert := assert.New(t)
+
+	tbl, err := parseCreateTable("people", `CREATE TABLE people (
+		-- The rowid.
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		"full name" VARCHAR (100) NOT NULL, /* quoted */
+		[age] int DEFAULT -1,
+		price DECIMAL(10, 2) CHECK (price > 0),
+		note,
+		active BOOLEAN DEFAULT TRUE,
+		upper_name TEXT GENERATED ALWAYS AS (upper("full name")),
+		CONSTRAINT u UNIQUE (note)
+	)`)
+	assert.NoError(err)
+	assert.Equal([]Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "full name", Type: "VARCHAR(100)"},
+		{Name: "age", Type: "int", dflt: int64(-1)},
+		{Name: "price", Type: "DECIMAL(10,2)"},
+		{Name: "note"},
+		{Name: "active", Type: "BOOLEAN", dflt: int64(1)},
+		{Name: "upper_name", Type: "TEXT", virtual: true},
+	}, tbl.Columns)
+	assert.Equal([]string{"id"}, tbl.PrimaryKey)
+	assert.Equal(0, tbl.rowidColumn)
+	assert.False(tbl.withoutRowid)
+
+	tbl, err = parseCreateTable("pairs", `CREATE TABLE pairs (A text, b INTEGER, 'c' DEFAULT 'x''y', PRIMARY KEY (a, B)) WITHOUT ROWID`)
+	assert.NoError(err)
+	assert.Equal([]string{"A", "b"}, tbl.PrimaryKey)
+	assert.Equal("x'y", tbl.Columns[2].dflt)
+	assert.Equal(-1, tbl.rowidColumn)
+	assert.True(tbl.withoutRowid)
+
+	// INT isn't INTEGER, so it isn't an alias for the rowid, but a table constraint is no different to a column one.
+	tbl, err = parseCreateTable("t", `CREATE TABLE t (a INT PRIMARY KEY)`)
+	assert.NoError(err)
+	assert.Equal(-1, tbl.rowidColumn)
+	tbl, err = parseCreateTable("t", `CREATE TABLE t (a integer, b, PRIMARY KEY (a))`)
+	assert.NoError(err)
+	assert.Equal(0, tbl.rowidColumn)
+
+	for _, sql := range []string{
+		`CREATE TABLE t`,
+		`CREATE TABLE t (a, , b)`,
+		`CREATE TABLE t (a, PRIMARY KEY (b))`,
+		`CREATE TABLE t (a "b)`,
+		`CREATE TABLE t (a /* b)`,
+	} {
+		_, err := parseCreateTable("t", sql)
+		assert.Error(err, sql)
+	}
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tbl := range []Table{
+		{Name: `a "table"`, Columns: []Column{{Name: "id", Type: "INTEGER"}, {Name: "x y", Type: "TEXT"}}, PrimaryKey: []string{"id"}, rowidColumn: 0},
+		{Name: "t", Columns: []Column{{Name: "a", Type: "TEXT"}, {Name: "b", Type: "INT"}}, PrimaryKey: []string{"a", "b"}, rowidColumn: -1},
+		{Name: "t", Columns: []Column{{Name: "a", Type: "BLOB"}}, PrimaryKey: []string{}, rowidColumn: -1},
+	} {
+		parsed, err := parseCreateTable(tbl.Name, createTableSQL(tbl))
+		assert.NoError(err)
+		assert.Equal(tbl, parsed)
+	}
+	assert.Equal(`CREATE TABLE "t" ("id" INTEGER PRIMARY KEY, "v" TEXT)`, createTableSQL(Table{Name: "t", Columns: []Column{{Name: "id", Type: "INTEGER"}, {Name: "v", Type: "TEXT"}}, PrimaryKey: []string{"id"}, rowidColumn: 0}))
+}
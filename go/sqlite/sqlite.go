@@ -0,0 +1,257 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package sqlite reads the tables of SQLite database files into Maps of structs, and writes Lists and Maps of structs out as tables. It reads and writes the file format itself, see https://www.sqlite.org/fileformat.html, rather than depending on SQLite.
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/stormasm/noms/go/d"
+)
+
+const (
+	headerSize = 100
+
+	pageIndexInterior = 0x02
+	pageTableInterior = 0x05
+	pageIndexLeaf     = 0x0a
+	pageTableLeaf     = 0x0d
+)
+
+// fileMagic starts SQLite database files.
+var fileMagic = []byte("SQLite format 3\x00")
+
+// IsSQLite returns whether |b|, the start of a file, is the start of a SQLite database.
+func IsSQLite(b []byte) bool {
+	return bytes.HasPrefix(b, fileMagic)
+}
+
+// A value in a record is nil for NULL, an int64, a float64, a string, or a []byte for a BLOB.
+type value interface{}
+
+// putVarint appends SQLite's encoding of |v| to |buf|: big-endian groups of 7 bits with the high bit set on all but the last, except that a 9th byte holds a full 8 bits.
+func putVarint(buf []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		b := make([]byte, 9)
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, b...)
+	}
+	var b [8]byte
+	n := 0
+	for {
+		b[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i > 0; i-- {
+		buf = append(buf, b[i]|0x80)
+	}
+	return append(buf, b[0])
+}
+
+func varintLen(v uint64) int {
+	return len(putVarint(nil, v))
+}
+
+// varint decodes a varint from the start of |b|, returning it and its length. It panics with a wrapped error, which callers recover with d.Try, if |b| is truncated.
+func varint(b []byte) (uint64, int) {
+	v := uint64(0)
+	for i := 0; i < 9; i++ {
+		d.PanicIfTrue(i >= len(b), "Invalid SQLite database, a varint is truncated")
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	panic("unreachable")
+}
+
+// encodeRecord returns the record format encoding of |values|: a header of their serial types, and then their contents.
+func encodeRecord(values []value) []byte {
+	header, body := []byte{}, []byte{}
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			header = putVarint(header, 0)
+		case int64:
+			switch {
+			case v == 0:
+				header = putVarint(header, 8)
+			case v == 1:
+				header = putVarint(header, 9)
+			default:
+				serial, size := intSerialType(v)
+				header = putVarint(header, serial)
+				for i := size - 1; i >= 0; i-- {
+					body = append(body, byte(v>>uint(8*i)))
+				}
+			}
+		case float64:
+			header = putVarint(header, 7)
+			body = append(body, make([]byte, 8)...)
+			binary.BigEndian.PutUint64(body[len(body)-8:], math.Float64bits(v))
+		case string:
+			header = putVarint(header, uint64(13+2*len(v)))
+			body = append(body, v...)
+		case []byte:
+			header = putVarint(header, uint64(12+2*len(v)))
+			body = append(body, v...)
+		}
+	}
+	// The size of the header includes the varint that gives it.
+	size := len(header) + 1
+	for varintLen(uint64(size))+len(header) != size {
+		size = varintLen(uint64(size)) + len(header)
+	}
+	record := putVarint(make([]byte, 0, size+len(body)), uint64(size))
+	record = append(record, header...)
+	return append(record, body...)
+}
+
+// intSerialType returns the serial type of the smallest integer that holds |v|, and its size.
+func intSerialType(v int64) (uint64, int) {
+	switch {
+	case v >= -1<<7 && v < 1<<7:
+		return 1, 1
+	case v >= -1<<15 && v < 1<<15:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= -1<<31 && v < 1<<31:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// decodeRecord decodes the values of a record.
+func decodeRecord(b []byte) []value {
+	size, n := varint(b)
+	d.PanicIfTrue(size > uint64(len(b)) || size < uint64(n), "Invalid SQLite record, its header is out of range")
+	header, body := b[n:size], b[size:]
+	values := []value{}
+	for len(header) > 0 {
+		serial, n := varint(header)
+		header = header[n:]
+		field := func(size uint64) []byte {
+			d.PanicIfTrue(size > uint64(len(body)), "Invalid SQLite record, it's truncated")
+			f := body[:size]
+			body = body[size:]
+			return f
+		}
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial <= 6:
+			f := field([]uint64{0, 1, 2, 3, 4, 6, 8}[serial])
+			v := int64(int8(f[0]))
+			for _, c := range f[1:] {
+				v = v<<8 | int64(c)
+			}
+			values = append(values, v)
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field(8))))
+		case serial == 8:
+			values = append(values, int64(0))
+		case serial == 9:
+			values = append(values, int64(1))
+		case serial >= 12 && serial%2 == 0:
+			values = append(values, append([]byte{}, field((serial-12)/2)...))
+		case serial >= 13:
+			values = append(values, string(field((serial-13)/2)))
+		default:
+			d.PanicIfTrue(true, "Invalid SQLite record, serial type %d is reserved", serial)
+		}
+	}
+	return values
+}
+
+// compareValues compares |a| and |b| as SQLite does for keys with the BINARY collation: NULLs first, then numbers, then text, then BLOBs.
+func compareValues(a, b value) int {
+	ca, cb := valueClass(a), valueClass(b)
+	if ca != cb {
+		return ca - cb
+	}
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+		return compareFloats(float64(a), b.(float64))
+	case float64:
+		return compareFloats(a, toFloat(b))
+	case string:
+		return bytes.Compare([]byte(a), []byte(b.(string)))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	return 0
+}
+
+func valueClass(v value) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64:
+		return 1
+	case string:
+		return 2
+	}
+	return 3
+}
+
+func toFloat(v value) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// localPayload returns how many bytes of a payload of |size| bytes are stored in a cell on a page of |usable| bytes, with the rest on overflow pages.
+func localPayload(size, usable int, index bool) int {
+	max := usable - 35
+	if index {
+		max = (usable-12)*64/255 - 23
+	}
+	if size <= max {
+		return size
+	}
+	min := (usable-12)*32/255 - 23
+	k := min + (size-min)%(usable-4)
+	if k <= max {
+		return k
+	}
+	return min
+}
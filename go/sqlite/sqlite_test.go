@@ -0,0 +1,86 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestVarint(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range []struct {
+		v       uint64
+		encoded []byte
+	}{
+		{0, []byte{0}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3fff, []byte{0xff, 0x7f}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{math.MaxUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		assert.Equal(c.encoded, putVarint(nil, c.v))
+		v, n := varint(c.encoded)
+		assert.Equal(c.v, v)
+		assert.Equal(len(c.encoded), n)
+	}
+	for _, v := range []uint64{0x00ffffffffffffff, 0x0100000000000000, 1 << 63} {
+		decoded, n := varint(putVarint(nil, v))
+		assert.Equal(v, decoded)
+		assert.Equal(varintLen(v), n)
+	}
+	assert.Panics(func() { varint([]byte{0x81}) })
+}
+
+func TestRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	values := []value{nil, int64(0), int64(1), int64(-1), int64(200), int64(-40000), int64(1 << 23), int64(-1 << 31), int64(1 << 40), int64(math.MinInt64), 1.5, "", "text", []byte{}, []byte{0, 1, 2}}
+	assert.Equal(values, decodeRecord(encodeRecord(values)))
+
+	// The header is its size, 3, then serial types 1 for an 8-bit integer, and 13+2*2 for a string of 2 bytes.
+	assert.Equal([]byte{3, 1, 17, 42, 'h', 'i'}, encodeRecord([]value{int64(42), "hi"}))
+	// With more than 126 values, the size of the header takes 2 bytes.
+	many := make([]value, 127)
+	assert.Equal(many, decodeRecord(encodeRecord(many)))
+
+	assert.Panics(func() { decodeRecord([]byte{3, 1, 17, 42}) })
+	assert.Panics(func() { decodeRecord([]byte{2, 10}) })
+}
+
+func TestCompareValues(t *testing.T) {
+	assert := assert.New(t)
+
+	ordered := []value{nil, -1.5, int64(-1), int64(0), 0.5, int64(1), int64(2), "", "A", "a", "b", []byte{}, []byte{0}}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			switch {
+			case i < j:
+				assert.True(compareValues(a, b) < 0, "%v < %v", a, b)
+			case i > j:
+				assert.True(compareValues(a, b) > 0, "%v > %v", a, b)
+			default:
+				assert.Equal(0, compareValues(a, b))
+			}
+		}
+	}
+	assert.Equal(0, compareValues(int64(2), 2.0))
+}
+
+func TestLocalPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	// The numbers from https://www.sqlite.org/fileformat.html, for pages of 4096 bytes.
+	assert.Equal(4061, localPayload(4061, 4096, false))
+	assert.Equal(489, localPayload(4062, 4096, false))
+	assert.Equal(1002, localPayload(1002, 4096, true))
+	assert.Equal(489, localPayload(1003, 4096, true))
+	// Payloads which would only just overflow their last page keep more of themselves local instead.
+	assert.Equal(489+100, localPayload(489+4092+100, 4096, false))
+}
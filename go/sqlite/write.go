@@ -0,0 +1,577 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// sqliteVersion is the version of SQLite that the files written are compatible with, as it's recorded in their headers.
+const sqliteVersion = 3031001
+
+// Writer writes tables to a new SQLite database file. Pages are written as they fill up, but the first one, which has the schema, is written by Close.
+type Writer struct {
+	w        io.WriterAt
+	pageSize int
+	next     uint32
+	schema   [][]value
+	names    map[string]bool
+}
+
+// NewWriter returns a Writer of a SQLite database to |w|, which should be empty.
+func NewWriter(w io.WriterAt) *Writer {
+	return newWriter(w, 4096)
+}
+
+func newWriter(w io.WriterAt, pageSize int) *Writer {
+	return &Writer{w: w, pageSize: pageSize, next: 2, names: map[string]bool{}}
+}
+
+// column is a column of a table to write, and the kind of its values.
+type column struct {
+	name string
+	kind types.NomsKind
+}
+
+// WriteTable writes |v|, a List of structs or a Map whose values are structs, as a table named |name|, with a column for each field of the structs, in name order. Bools are written as integers in BOOLEAN columns, Numbers as integers if they're whole or reals if they're not, in INTEGER or REAL columns, Strings as text in TEXT columns, and Blobs in BLOB columns. Missing fields are NULLs.
+//
+// The table's primary key is the columns |pk|, or if that's nil and |v| is a Map, whichever columns the Map is keyed by: the column of each row equal to its key, or the fields of the keys if they're structs. A single primary key column of whole Numbers, which a Map is keyed and so sorted by, is the table's INTEGER PRIMARY KEY.
+func (w *Writer) WriteTable(name string, v types.Value, pk []string) error {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "sqlite_") {
+		return fmt.Errorf("Invalid table name %s", name)
+	}
+	if w.names[strings.ToLower(name)] {
+		return fmt.Errorf("Table %s appears more than once", name)
+	}
+	w.names[strings.ToLower(name)] = true
+
+	cols, err := columnsOf(v)
+	if err != nil {
+		return err
+	}
+	m, isMap := v.(types.Map)
+	if pk == nil && isMap {
+		pk = inferPrimaryKey(m, cols)
+	}
+	t := Table{Name: name, PrimaryKey: pk, rowidColumn: -1}
+	for _, c := range cols {
+		// Column names are case insensitive in SQL, but field names aren't.
+		if i := t.columnIndex(c.name); i >= 0 {
+			return fmt.Errorf("Columns %s and %s of table %s have the same name", t.Columns[i].Name, c.name, name)
+		}
+		t.Columns = append(t.Columns, Column{Name: c.name})
+	}
+	pkCols := make([]int, len(pk))
+	for i, p := range pk {
+		if pkCols[i] = t.columnIndex(p); pkCols[i] < 0 || t.Columns[pkCols[i]].Name != p {
+			return fmt.Errorf("Invalid primary key %s, there's no such column", p)
+		}
+	}
+	if len(pk) == 1 && cols[pkCols[0]].kind == types.NumberKind && isMap && keyedByWholeNumbers(m, pk[0]) {
+		t.rowidColumn = pkCols[0]
+	}
+
+	ints := make([]bool, len(cols))
+	for i := range ints {
+		ints[i] = true
+	}
+	entries := []indexEntry{}
+	tb := &tableBuilder{w: w}
+	err = d.Try(func() {
+		rowid, first := int64(0), true
+		write := func(row types.Value) {
+			s, ok := row.(types.Struct)
+			d.PanicIfTrue(!ok, "Expected a struct, found %s", row.Type().Describe())
+			values := make([]value, len(cols))
+			for i, c := range cols {
+				fv, ok := s.MaybeGet(c.name)
+				if !ok {
+					continue
+				}
+				values[i] = sqlValue(fv)
+				if _, isInt := values[i].(int64); !isInt && c.kind == types.NumberKind {
+					ints[i] = false
+				}
+			}
+
+			if t.rowidColumn >= 0 {
+				id, ok := values[t.rowidColumn].(int64)
+				d.PanicIfTrue(!ok || id <= rowid && !first, "Table %s can't have an INTEGER PRIMARY KEY, its rows aren't in order of it", name)
+				// The column is an alias for the rowid, so it isn't stored in the record.
+				rowid, values[t.rowidColumn] = id, nil
+			} else {
+				rowid++
+			}
+			first = false
+			if len(pk) > 0 && t.rowidColumn < 0 {
+				key := make([]value, len(pk))
+				for i, c := range pkCols {
+					key[i] = values[c]
+					d.PanicIfTrue(key[i] == nil, "Row %d of table %s has no %s, which is part of its primary key", rowid, name, pk[i])
+				}
+				entries = append(entries, indexEntry{key, rowid})
+			}
+			tb.add(rowid, encodeRecord(values))
+		}
+		switch v := v.(type) {
+		case types.List:
+			v.IterAll(func(row types.Value, _ uint64) { write(row) })
+		case types.Map:
+			v.IterAll(func(_, row types.Value) { write(row) })
+		}
+
+		for i, c := range cols {
+			t.Columns[i].Type = declaredType(c.kind, ints[i])
+		}
+		// A single primary key column declared as INTEGER is an alias for the rowid, even in a table constraint, and INT isn't.
+		if len(pk) == 1 && t.rowidColumn < 0 && t.Columns[pkCols[0]].Type == "INTEGER" {
+			t.Columns[pkCols[0]].Type = "INT"
+		}
+		w.schema = append(w.schema, []value{"table", name, name, int64(tb.finish(0)), createTableSQL(t)})
+		if len(pk) > 0 && t.rowidColumn < 0 {
+			root := w.writeIndex(name, entries)
+			w.schema = append(w.schema, []value{"index", fmt.Sprintf("sqlite_autoindex_%s_1", name), name, int64(root), nil})
+		}
+	})
+	return d.Unwrap(err)
+}
+
+// Close writes the schema of the tables, and the header of the file.
+func (w *Writer) Close() error {
+	return d.Unwrap(d.Try(func() {
+		tb := &tableBuilder{w: w}
+		for i, row := range w.schema {
+			tb.add(int64(i+1), encodeRecord(row))
+		}
+		tb.finish(1)
+
+		header := make([]byte, headerSize)
+		copy(header, fileMagic)
+		binary.BigEndian.PutUint16(header[16:], uint16(w.pageSize))
+		if w.pageSize == 65536 {
+			binary.BigEndian.PutUint16(header[16:], 1)
+		}
+		header[18], header[19] = 1, 1
+		header[21], header[22], header[23] = 64, 32, 32
+		binary.BigEndian.PutUint32(header[24:], 1)
+		binary.BigEndian.PutUint32(header[28:], w.next-1)
+		binary.BigEndian.PutUint32(header[40:], 1)
+		binary.BigEndian.PutUint32(header[44:], 4)
+		binary.BigEndian.PutUint32(header[56:], 1)
+		binary.BigEndian.PutUint32(header[92:], 1)
+		binary.BigEndian.PutUint32(header[96:], sqliteVersion)
+		_, err := w.w.WriteAt(header, 0)
+		d.PanicIfError(err)
+	}))
+}
+
+// columnsOf returns the columns of a table of the structs in |v|, a List of them or a Map whose values they are.
+func columnsOf(v types.Value) ([]column, error) {
+	var elemType *types.Type
+	switch v := v.(type) {
+	case types.List:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[0]
+	case types.Map:
+		elemType = v.Type().Desc.(types.CompoundDesc).ElemTypes[1]
+	default:
+		return nil, fmt.Errorf("Expected a List or Map of structs, found %s", v.Type().Describe())
+	}
+	structTypes := []*types.Type{elemType}
+	if elemType.Kind() == types.UnionKind {
+		structTypes = elemType.Desc.(types.CompoundDesc).ElemTypes
+	}
+
+	kinds := map[string]types.NomsKind{}
+	for _, t := range structTypes {
+		if t.Kind() != types.StructKind {
+			return nil, fmt.Errorf("Expected structs, found %s", t.Describe())
+		}
+		var err error
+		t.Desc.(types.StructDesc).IterFields(func(name string, ft *types.Type) {
+			k := ft.Kind()
+			if k != types.BoolKind && k != types.NumberKind && k != types.StringKind && k != types.BlobKind {
+				err = fmt.Errorf("Field %s is a %s, but columns must be Bool, Number, String or Blob", name, ft.Describe())
+			} else if prev, ok := kinds[name]; ok && prev != k {
+				err = fmt.Errorf("Field %s is a %s in some structs and a %s in others", name, types.KindToString[prev], types.KindToString[k])
+			}
+			kinds[name] = k
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("Can't write a table with no columns")
+	}
+
+	cols := make([]column, 0, len(kinds))
+	for name, k := range kinds {
+		cols = append(cols, column{name, k})
+	}
+	sort.Sort(columnsByName(cols))
+	return cols, nil
+}
+
+type columnsByName []column
+
+func (c columnsByName) Len() int           { return len(c) }
+func (c columnsByName) Less(i, j int) bool { return c[i].name < c[j].name }
+func (c columnsByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// inferPrimaryKey returns the columns that |m| is keyed by, judging by its first row, or nil if it isn't keyed by any of them.
+func inferPrimaryKey(m types.Map, cols []column) []string {
+	if m.Empty() {
+		return nil
+	}
+	k, v := m.First()
+	row, ok := v.(types.Struct)
+	if !ok {
+		return nil
+	}
+	if ks, ok := k.(types.Struct); ok {
+		pk := []string{}
+		ks.Type().Desc.(types.StructDesc).IterFields(func(name string, _ *types.Type) {
+			pk = append(pk, name)
+		})
+		for _, name := range pk {
+			if fv, ok := row.MaybeGet(name); !ok || !fv.Equals(ks.Get(name)) {
+				return nil
+			}
+		}
+		return pk
+	}
+	for _, c := range cols {
+		if fv, ok := row.MaybeGet(c.name); ok && fv.Equals(k) {
+			return []string{c.name}
+		}
+	}
+	return nil
+}
+
+// keyedByWholeNumbers returns whether the keys of |m| are whole Numbers which can be rowids, equal to the column |pk| of each row.
+func keyedByWholeNumbers(m types.Map, pk string) bool {
+	ok := true
+	m.Iter(func(k, v types.Value) bool {
+		n, isNumber := k.(types.Number)
+		if _, isInt := sqlValue(n).(int64); !isNumber || !isInt {
+			ok = false
+		} else if row, isStruct := v.(types.Struct); !isStruct {
+			ok = false
+		} else if fv, has := row.MaybeGet(pk); !has || !fv.Equals(k) {
+			ok = false
+		}
+		return !ok
+	})
+	return ok
+}
+
+// sqlValue returns the value that |v| is written to a table as.
+func sqlValue(v types.Value) value {
+	switch v := v.(type) {
+	case types.Bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case types.Number:
+		f := float64(v)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+		return f
+	case types.String:
+		return string(v)
+	case types.Blob:
+		b, err := ioutil.ReadAll(v.Reader())
+		d.PanicIfError(err)
+		return b
+	}
+	return nil
+}
+
+func declaredType(k types.NomsKind, ints bool) string {
+	switch k {
+	case types.BoolKind:
+		return "BOOLEAN"
+	case types.NumberKind:
+		if ints {
+			return "INTEGER"
+		}
+		return "REAL"
+	case types.StringKind:
+		return "TEXT"
+	}
+	return "BLOB"
+}
+
+// indexEntry is an entry of the index of a primary key: the values of the key's columns, and the rowid of the row that has them.
+type indexEntry struct {
+	key   []value
+	rowid int64
+}
+
+type indexEntries []indexEntry
+
+func (e indexEntries) Len() int      { return len(e) }
+func (e indexEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e indexEntries) Less(i, j int) bool {
+	if c := compareKeys(e[i].key, e[j].key); c != 0 {
+		return c < 0
+	}
+	return e[i].rowid < e[j].rowid
+}
+
+func compareKeys(a, b []value) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// writeIndex writes the index of the primary key of |table|, whose |entries| are in order of rowid, and returns its root page.
+func (w *Writer) writeIndex(table string, entries []indexEntry) uint32 {
+	sort.Stable(indexEntries(entries))
+	usable := w.pageSize
+	cells := make([][]byte, len(entries))
+	for i, e := range entries {
+		d.PanicIfTrue(i > 0 && compareKeys(entries[i-1].key, e.key) == 0, "Table %s has several rows with the same primary key", table)
+		payload := encodeRecord(append(append([]value{}, e.key...), e.rowid))
+		cells[i] = w.payloadCell(putVarint(nil, uint64(len(payload))), payload, localPayload(len(payload), usable, true))
+	}
+
+	// In an index b-tree, the entries between the leaves are in their parents, rather than the leaves.
+	leaves := []*page{{}}
+	dividers := [][]byte{}
+	size := 8
+	for i, c := range cells {
+		leaf := leaves[len(leaves)-1]
+		if size+2+len(c) <= w.pageSize {
+			leaf.cells = append(leaf.cells, c)
+			size += 2 + len(c)
+			continue
+		}
+		if i == len(cells)-1 {
+			// The last entry has to go in a leaf, so the one before it is the divider.
+			dividers = append(dividers, leaf.cells[len(leaf.cells)-1])
+			leaf.cells = leaf.cells[:len(leaf.cells)-1]
+			leaves = append(leaves, &page{cells: [][]byte{c}})
+			continue
+		}
+		dividers = append(dividers, c)
+		leaves = append(leaves, &page{})
+		size = 8
+	}
+	if len(leaves) == 1 {
+		return w.writeRoot(0, pageIndexLeaf, leaves[0])
+	}
+	children := make([]uint32, len(leaves))
+	for i, p := range leaves {
+		children[i] = w.alloc()
+		w.writePage(children[i], pageIndexLeaf, p)
+	}
+	return w.writeInterior(children, dividers, pageIndexInterior, 0)
+}
+
+// page is a page of a b-tree to write: its cells, and if it's an interior page, its right-most child.
+type page struct {
+	cells [][]byte
+	right uint32
+}
+
+// writeInterior writes the levels of interior pages, of type |typ|, above |children|, up to the root, which is page |root|, or if that's 0, a new page, and which it returns. |dividers| are the cells that go between the children in their parents, without the child pointers at the start of them.
+func (w *Writer) writeInterior(children []uint32, dividers [][]byte, typ byte, root uint32) uint32 {
+	for {
+		pages, promoted := packInterior(children, dividers, w.pageSize)
+		if len(pages) == 1 {
+			return w.writeRoot(root, typ, pages[0])
+		}
+		children = make([]uint32, len(pages))
+		for i, p := range pages {
+			children[i] = w.alloc()
+			w.writePage(children[i], typ, p)
+		}
+		dividers = promoted
+	}
+}
+
+// writeRoot writes |p| as the root of a b-tree, page |n|, or if that's 0, a new page, and returns it. Page 1 has less room, after the header of the file, so if |p| doesn't fit there, it's written to a new page, under a root with no cells, which is only valid for roots.
+func (w *Writer) writeRoot(n uint32, typ byte, p *page) uint32 {
+	if n == 0 {
+		n = w.alloc()
+	}
+	if n == 1 && usedBytes(typ, p) > w.pageSize-headerSize {
+		child := w.alloc()
+		w.writePage(child, typ, p)
+		typ, p = pageTableInterior, &page{right: child}
+	}
+	w.writePage(n, typ, p)
+	return n
+}
+
+// usedBytes returns how many bytes of a page |p| takes up.
+func usedBytes(typ byte, p *page) int {
+	size := 8
+	if typ == pageTableInterior || typ == pageIndexInterior {
+		size = 12
+	}
+	for _, c := range p.cells {
+		size += 2 + len(c)
+	}
+	return size
+}
+
+// packInterior lays out the children of an interior level of a b-tree, and the dividers between them, into pages, and returns the pages, and the dividers to go between them in the level above.
+func packInterior(children []uint32, dividers [][]byte, capacity int) ([]*page, [][]byte) {
+	cell := func(child uint32, divider []byte) []byte {
+		c := make([]byte, 4, 4+len(divider))
+		binary.BigEndian.PutUint32(c, child)
+		return append(c, divider...)
+	}
+	pages := []*page{{right: children[0]}}
+	promoted := [][]byte{}
+	// Which child and divider each cell is made of, to move the last one if need be.
+	cellDividers := [][]int{{}}
+	size := 12
+	for i, div := range dividers {
+		p := pages[len(pages)-1]
+		c := cell(p.right, div)
+		if size+2+len(c) <= capacity {
+			p.cells = append(p.cells, c)
+			cellDividers[len(cellDividers)-1] = append(cellDividers[len(cellDividers)-1], i)
+			p.right = children[i+1]
+			size += 2 + len(c)
+			continue
+		}
+		promoted = append(promoted, div)
+		pages = append(pages, &page{right: children[i+1]})
+		cellDividers = append(cellDividers, []int{})
+		size = 12
+	}
+
+	// A page with no cells only has room for its right-most child, so it takes the last cell of the page before it.
+	if last := pages[len(pages)-1]; len(last.cells) == 0 && len(pages) > 1 {
+		prev, prevDividers := pages[len(pages)-2], cellDividers[len(pages)-2]
+		i := prevDividers[len(prevDividers)-1]
+		last.cells = [][]byte{cell(prev.right, promoted[len(promoted)-1])}
+		prev.cells = prev.cells[:len(prev.cells)-1]
+		prev.right = children[i]
+		promoted[len(promoted)-1] = dividers[i]
+	}
+	return pages, promoted
+}
+
+// tableBuilder writes the leaves of a table b-tree as the rows, which must be in order of rowid, are added, and then the levels of interior pages above them.
+type tableBuilder struct {
+	w       *Writer
+	leaf    page
+	size    int
+	lastRow int64
+	leaves  []uint32
+	keys    [][]byte
+}
+
+func (tb *tableBuilder) add(rowid int64, payload []byte) {
+	usable := tb.w.pageSize
+	prefix := putVarint(nil, uint64(len(payload)))
+	prefix = putVarint(prefix, uint64(rowid))
+	c := tb.w.payloadCell(prefix, payload, localPayload(len(payload), usable, false))
+	if tb.size == 0 {
+		tb.size = 8
+	}
+	if tb.size+2+len(c) > tb.w.pageSize {
+		tb.flush()
+	}
+	tb.leaf.cells = append(tb.leaf.cells, c)
+	tb.size += 2 + len(c)
+	tb.lastRow = rowid
+}
+
+func (tb *tableBuilder) flush() {
+	n := tb.w.alloc()
+	tb.w.writePage(n, pageTableLeaf, &tb.leaf)
+	tb.leaves = append(tb.leaves, n)
+	tb.keys = append(tb.keys, putVarint(nil, uint64(tb.lastRow)))
+	tb.leaf, tb.size = page{}, 8
+}
+
+// finish writes the rest of the b-tree, with its root at page |root|, or if that's 0, a new page, and returns the root.
+func (tb *tableBuilder) finish(root uint32) uint32 {
+	if len(tb.leaves) == 0 {
+		return tb.w.writeRoot(root, pageTableLeaf, &tb.leaf)
+	}
+	tb.flush()
+	// The divider after each leaf is its greatest rowid, which isn't needed after the last one.
+	return tb.w.writeInterior(tb.leaves, tb.keys[:len(tb.keys)-1], pageTableInterior, root)
+}
+
+// payloadCell returns a cell that's |prefix|, then the first |local| bytes of |payload|, and if there's more, the first of the overflow pages it writes the rest to.
+func (w *Writer) payloadCell(prefix, payload []byte, local int) []byte {
+	c := append(prefix, payload[:local]...)
+	rest := payload[local:]
+	if len(rest) == 0 {
+		return c
+	}
+	per := w.pageSize - 4
+	first := w.next
+	c = append(c, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(c[len(c)-4:], first)
+	for len(rest) > 0 {
+		n := w.alloc()
+		p := make([]byte, w.pageSize)
+		if len(rest) > per {
+			binary.BigEndian.PutUint32(p, n+1)
+		}
+		rest = rest[copy(p[4:], rest):]
+		w.writeRaw(n, p)
+	}
+	return c
+}
+
+func (w *Writer) alloc() uint32 {
+	n := w.next
+	w.next++
+	return n
+}
+
+// writePage writes |p| as page |n|, of type |typ|. The cells are laid out from the end of the page back, in order.
+func (w *Writer) writePage(n uint32, typ byte, p *page) {
+	b := make([]byte, w.pageSize)
+	hdr := 0
+	if n == 1 {
+		hdr = headerSize
+	}
+	ptrs := hdr + 8
+	if typ == pageTableInterior || typ == pageIndexInterior {
+		ptrs = hdr + 12
+		binary.BigEndian.PutUint32(b[hdr+8:], p.right)
+	}
+	content := w.pageSize
+	for i, c := range p.cells {
+		content -= len(c)
+		copy(b[content:], c)
+		binary.BigEndian.PutUint16(b[ptrs+2*i:], uint16(content))
+	}
+	b[hdr] = typ
+	binary.BigEndian.PutUint16(b[hdr+3:], uint16(len(p.cells)))
+	// A content area starting at 65536 is written as 0.
+	binary.BigEndian.PutUint16(b[hdr+5:], uint16(content))
+	w.writeRaw(n, b)
+}
+
+func (w *Writer) writeRaw(n uint32, b []byte) {
+	_, err := w.w.WriteAt(b, int64(n-1)*int64(w.pageSize))
+	d.PanicIfError(err)
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stormasm/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// memFile is an io.WriterAt and io.ReaderAt in memory.
+type memFile struct {
+	b []byte
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(f.b) {
+		f.b = append(f.b, make([]byte, end-len(f.b))...)
+	}
+	return copy(f.b[off:], p), nil
+}
+
+func (f *memFile) reader(assert *assert.Assertions) *Reader {
+	r, err := NewReader(bytes.NewReader(f.b), int64(len(f.b)))
+	assert.NoError(err)
+	return r
+}
+
+// testRows returns structs named |name|, as tables named |name| are read into.
+func testRows(n int, name string) []types.Struct {
+	rows := make([]types.Struct, n)
+	for i := range rows {
+		data := types.StructData{
+			"id":   types.Number(i*2 - 10),
+			"name": types.String(fmt.Sprintf("row %d %s", i, strings.Repeat("x", i%30))),
+			"ok":   types.Bool(i%3 == 0),
+			"r":    types.Number(float64(i) / 4),
+		}
+		if i%5 != 0 {
+			data["b"] = types.NewBlob(bytes.NewReader(bytes.Repeat([]byte{byte(i)}, i%700)))
+		}
+		rows[i] = types.NewStruct(name, data)
+	}
+	return rows
+}
+
+func TestWriteTableRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+
+	list, byRowid := []types.Value{}, []types.Value{}
+	for i, row := range testRows(1000, "list") {
+		list = append(list, row)
+		byRowid = append(byRowid, types.Number(i+1), row)
+	}
+	byID, byName, byNameAndOK := []types.Value{}, []types.Value{}, []types.Value{}
+	for _, row := range testRows(1000, "byID") {
+		byID = append(byID, row.Get("id"), row)
+	}
+	for _, row := range testRows(1000, "byName") {
+		byName = append(byName, row.Get("name"), row)
+	}
+	for _, row := range testRows(1000, "byNameAndOK") {
+		byNameAndOK = append(byNameAndOK, types.NewStruct("Key", types.StructData{"name": row.Get("name"), "ok": row.Get("ok")}), row)
+	}
+	tables := map[string]types.Value{
+		"list":        types.NewList(list...),
+		"byID":        types.NewMap(byID...),
+		"byName":      types.NewMap(byName...),
+		"byNameAndOK": types.NewMap(byNameAndOK...),
+	}
+
+	// Small pages make several levels of b-trees, and many overflow pages.
+	for _, pageSize := range []int{512, 4096} {
+		f := &memFile{}
+		w := newWriter(f, pageSize)
+		for _, name := range []string{"list", "byID", "byName", "byNameAndOK"} {
+			assert.NoError(w.WriteTable(name, tables[name], nil))
+		}
+		assert.NoError(w.WriteTable("listByID", types.NewList(list...), []string{"id"}))
+		for i := 0; i < 50; i++ {
+			assert.NoError(w.WriteTable(fmt.Sprintf("t%d", i), types.NewList(types.NewStruct("T", types.StructData{"t": types.Number(i)})), nil))
+		}
+		assert.NoError(w.Close())
+		assert.Equal(0, len(f.b)%pageSize)
+
+		r := f.reader(assert)
+		assert.Len(r.Tables(), 55)
+		read := func(name string) types.Map {
+			tbl, ok := r.Table(name)
+			assert.True(ok)
+			m, err := r.ReadTable(tbl, vs)
+			assert.NoError(err)
+			return m
+		}
+
+		// Without a primary key, rows are keyed by their rowids, which count from 1.
+		assert.True(types.NewMap(byRowid...).Equals(read("LIST")))
+		for _, name := range []string{"byID", "byName", "byNameAndOK"} {
+			assert.True(tables[name].Equals(read(name)), name)
+		}
+		listByID := read("listByID")
+		assert.Equal(uint64(1000), listByID.Len())
+		assert.True(listByID.Get(types.Number(-10)).(types.Struct).Get("name").Equals(types.String("row 0 ")))
+
+		tbl, _ := r.Table("byID")
+		assert.Equal(`CREATE TABLE "byID" ("b" BLOB, "id" INTEGER PRIMARY KEY, "name" TEXT, "ok" BOOLEAN, "r" REAL)`, createTableSQL(tbl))
+		tbl, _ = r.Table("listByID")
+		assert.Equal(-1, tbl.rowidColumn)
+		assert.Equal("INT", tbl.Columns[1].Type)
+	}
+}
+
+func TestWriteTableIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	// The index of the primary key has to be in order of SQLite's comparison of the keys, which isn't Noms'.
+	kvs := []types.Value{}
+	for i := 0; i < 1000; i++ {
+		k := types.String(fmt.Sprintf("%d%s", i, strings.Repeat("k", i%100)))
+		kvs = append(kvs, k, types.NewStruct("t", types.StructData{"k": k}))
+	}
+	f := &memFile{}
+	w := newWriter(f, 512)
+	assert.NoError(w.WriteTable("t", types.NewMap(kvs...), nil))
+	assert.NoError(w.Close())
+
+	r := f.reader(assert)
+	index := []value{}
+	var walkIndex func(n uint32)
+	walkIndex = func(n uint32) {
+		p := r.page(n)
+		cells := int(p[3])<<8 | int(p[4])
+		ptrs := 8
+		if p[0] == pageIndexInterior {
+			ptrs = 12
+		} else {
+			assert.Equal(byte(pageIndexLeaf), p[0])
+		}
+		for i := 0; i < cells; i++ {
+			off := int(p[ptrs+2*i])<<8 | int(p[ptrs+2*i+1])
+			cell := p[off:]
+			if p[0] == pageIndexInterior {
+				walkIndex(uint32(cell[0])<<24 | uint32(cell[1])<<16 | uint32(cell[2])<<8 | uint32(cell[3]))
+				cell = cell[4:]
+			}
+			size, n := varint(cell)
+			local := localPayload(int(size), r.usable, true)
+			if local == int(size) {
+				index = append(index, decodeRecord(cell[n:n+local])[0])
+			} else {
+				index = append(index, nil)
+			}
+		}
+		if p[0] == pageIndexInterior {
+			walkIndex(uint32(p[8])<<24 | uint32(p[9])<<16 | uint32(p[10])<<8 | uint32(p[11]))
+		}
+	}
+	root := uint32(0)
+	r.walk(1, func(rowid int64, payload []byte) {
+		if v := decodeRecord(payload); v[0] == "index" {
+			assert.Equal("sqlite_autoindex_t_1", v[1])
+			root = uint32(v[3].(int64))
+		}
+	})
+	walkIndex(root)
+	assert.Len(index, 1000)
+	prev := value(nil)
+	for _, k := range index {
+		if k != nil {
+			assert.True(prev == nil || compareValues(prev, k) < 0)
+			prev = k
+		}
+	}
+}
+
+func TestWriteTableErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	row := func(data types.StructData) types.Value {
+		return types.NewStruct("Row", data)
+	}
+	w := NewWriter(&memFile{})
+	assert.NoError(w.WriteTable("t", types.NewList(row(types.StructData{"a": types.Number(1)})), nil))
+	for _, c := range []struct {
+		name string
+		v    types.Value
+		pk   []string
+	}{
+		{"T", types.NewList(row(types.StructData{"a": types.Number(1)})), nil},
+		{"", types.NewList(row(types.StructData{"a": types.Number(1)})), nil},
+		{"sqlite_t", types.NewList(row(types.StructData{"a": types.Number(1)})), nil},
+		{"set", types.NewSet(row(types.StructData{"a": types.Number(1)})), nil},
+		{"numbers", types.NewList(types.Number(1)), nil},
+		{"empty", types.NewList(row(types.StructData{})), nil},
+		{"list", types.NewList(row(types.StructData{"a": types.NewList()})), nil},
+		{"kinds", types.NewList(row(types.StructData{"a": types.Number(1)}), row(types.StructData{"a": types.String("1")})), nil},
+		{"cases", types.NewList(row(types.StructData{"a": types.Number(1), "A": types.Number(1)})), nil},
+		{"nopk", types.NewList(row(types.StructData{"a": types.Number(1)})), []string{"b"}},
+		{"nullpk", types.NewList(row(types.StructData{"a": types.Number(1)}), row(types.StructData{"b": types.Number(1)})), []string{"a"}},
+		{"duplicatepk", types.NewList(row(types.StructData{"a": types.String("x")}), row(types.StructData{"a": types.String("x")})), []string{"a"}},
+	} {
+		assert.Error(w.WriteTable(c.name, c.v, c.pk), c.name)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package timeseries rolls up time series: Maps from times, as Numbers of seconds since the Unix epoch, to values, into the count, sum, average, minimum and maximum of their values in each of a number of windows of time. Since Numbers are ordered by value, the points in a window are found by a range scan, and since a Map's prolly tree is split into chunks by their content, a chunk that lies wholly inside a window can be aggregated once and its aggregate cached by its hash. A Rollup keeps that cache, so that only the chunks at the edges of each window are read point by point, and so that a dashboard rolling up each new version of a big time series only reads the chunks that have changed.
+package timeseries
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Key returns the key of a point at |t| in a time series: the Number of seconds since the Unix epoch, with a fraction for the nanoseconds.
+func Key(t time.Time) types.Number {
+	return types.Number(float64(t.Unix()) + float64(t.Nanosecond())/1e9)
+}
+
+// Time returns the time whose Key is |k|.
+func Time(k types.Number) time.Time {
+	sec, frac := math.Modf(float64(k))
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// Aggregate summarizes the values of the points in a window of time. Min and Max are 0 if there are none.
+type Aggregate struct {
+	Count         uint64
+	Sum, Min, Max float64
+}
+
+// Avg returns the mean of the values in |a|, or 0 if there are none.
+func (a Aggregate) Avg() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// Merge returns the aggregate of the values in both |a| and |b|.
+func (a Aggregate) Merge(b Aggregate) Aggregate {
+	switch {
+	case b.Count == 0:
+		return a
+	case a.Count == 0:
+		return b
+	}
+	return Aggregate{a.Count + b.Count, a.Sum + b.Sum, math.Min(a.Min, b.Min), math.Max(a.Max, b.Max)}
+}
+
+func (a Aggregate) add(f float64) Aggregate {
+	return a.Merge(Aggregate{1, f, f, f})
+}
+
+// Window is the Aggregate of the points in a window of time, from Start up to, but not including, End.
+type Window struct {
+	Start, End time.Time
+	Aggregate
+}
+
+// Rollup aggregates windows of time series, caching the aggregate of each chunk of them it reads whole. The cache grows with the number of distinct chunks aggregated, so a Rollup should be shared by the queries of related time series, and dropped once they're done with. A Rollup can be used concurrently.
+type Rollup struct {
+	value func(v types.Value) (float64, bool)
+	mu    sync.Mutex
+	cache map[hash.Hash]Aggregate
+}
+
+// NewRollup returns a Rollup which aggregates what |value| returns for each point's value, skipping those it returns false for. If value is nil, points whose values are Numbers are aggregated, and others are skipped.
+func NewRollup(value func(v types.Value) (float64, bool)) *Rollup {
+	if value == nil {
+		value = func(v types.Value) (float64, bool) {
+			n, ok := v.(types.Number)
+			return float64(n), ok
+		}
+	}
+	return &Rollup{value: value, cache: map[hash.Hash]Aggregate{}}
+}
+
+// Windows returns the aggregates of the points of |m| in consecutive windows |width| long, from |start| up to |end|. The last window is cut short at end if width doesn't divide the time between them.
+func (r *Rollup) Windows(m types.Map, start, end time.Time, width time.Duration) []Window {
+	d.PanicIfFalse(width > 0)
+	windows := []Window{}
+	for s := start; s.Before(end); s = s.Add(width) {
+		e := s.Add(width)
+		if e.After(end) {
+			e = end
+		}
+		windows = append(windows, Window{s, e, r.Range(m, s, e)})
+	}
+	return windows
+}
+
+// Range returns the aggregate of the points of |m| from |start| up to, but not including, |end|.
+func (r *Rollup) Range(m types.Map, start, end time.Time) Aggregate {
+	return r.aggregate(m, Key(start), Key(end), nil)
+}
+
+// aggregate returns the aggregate of the points of |m| whose keys are at least |lo| and less than |hi|, where |after|, if not nil, is a key which all of m's are greater than.
+func (r *Rollup) aggregate(m types.Map, lo, hi types.Number, after types.Value) Aggregate {
+	children, lastKeys := m.Children()
+	if children == nil {
+		agg := Aggregate{}
+		m.IterFrom(lo, func(k, v types.Value) bool {
+			if !k.Less(hi) {
+				return true
+			}
+			if f, ok := r.value(v); ok {
+				agg = agg.add(f)
+			}
+			return false
+		})
+		return agg
+	}
+
+	agg := Aggregate{}
+	for i, c := range children {
+		last := lastKeys[i]
+		if i > 0 && (after == nil || !after.Less(hi)) {
+			// The keys of the rest are past hi, or ordered by hash, which come after all Numbers.
+			break
+		}
+		if last == nil || !last.Less(lo) {
+			if after != nil && !after.Less(lo) && last != nil && last.Less(hi) {
+				agg = agg.Merge(r.whole(c))
+			} else {
+				agg = agg.Merge(r.aggregate(c, lo, hi, after))
+			}
+		}
+		after = last
+	}
+	return agg
+}
+
+// whole returns the aggregate of all the points of |m|, which is cached by m's hash.
+func (r *Rollup) whole(m types.Map) Aggregate {
+	r.mu.Lock()
+	agg, ok := r.cache[m.Hash()]
+	r.mu.Unlock()
+	if ok {
+		return agg
+	}
+
+	if children, _ := m.Children(); children != nil {
+		for _, c := range children {
+			agg = agg.Merge(r.whole(c))
+		}
+	} else {
+		m.IterAll(func(k, v types.Value) {
+			if f, ok := r.value(v); ok {
+				agg = agg.add(f)
+			}
+		})
+	}
+	r.mu.Lock()
+	r.cache[m.Hash()] = agg
+	r.mu.Unlock()
+	return agg
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package timeseries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+var epoch = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// series returns a time series of a point a minute, for |n| minutes from epoch, whose values are the minute of the hour, read back from |vs| so that its chunks are read as they're needed.
+func series(vs *types.ValueStore, n int) types.Map {
+	kvs := []types.Value{}
+	for i := 0; i < n; i++ {
+		kvs = append(kvs, Key(epoch.Add(time.Duration(i)*time.Minute)), types.Number(i%60))
+	}
+	return vs.ReadValue(vs.WriteValue(types.NewMap(kvs...)).TargetHash()).(types.Map)
+}
+
+// scan returns the aggregate of the Numbers of |m| from |start| up to |end|, by reading every point.
+func scan(m types.Map, start, end time.Time) Aggregate {
+	agg := Aggregate{}
+	m.IterAll(func(k, v types.Value) {
+		if t := Time(k.(types.Number)); !t.Before(start) && t.Before(end) {
+			agg = agg.add(float64(v.(types.Number)))
+		}
+	})
+	return agg
+}
+
+func TestKey(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1476600000, 500000000)
+	assert.Equal(types.Number(1476600000.5), Key(now))
+	assert.True(now.Equal(Time(Key(now))))
+	assert.True(Key(epoch).Less(Key(epoch.Add(time.Second))))
+}
+
+func TestWindows(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	m := series(vs, 10000)
+	children, _ := m.Children()
+	assert.NotNil(children, "the series should be big enough to span chunks")
+
+	r := NewRollup(nil)
+	hours := r.Windows(m, epoch, epoch.Add(24*time.Hour), time.Hour)
+	assert.Len(hours, 24)
+	for _, w := range hours {
+		assert.Equal(scan(m, w.Start, w.End), w.Aggregate)
+		assert.Equal(w.Start.Add(time.Hour), w.End)
+	}
+	assert.Equal(Aggregate{60, 1770, 0, 59}, hours[0].Aggregate)
+	assert.Equal(29.5, hours[0].Avg())
+	// 10000 minutes is 166 hours and 40 minutes.
+	last := r.Windows(m, epoch.Add(166*time.Hour), epoch.Add(168*time.Hour), time.Hour)
+	assert.Equal(Aggregate{40, 780, 0, 39}, last[0].Aggregate)
+	assert.Equal(Aggregate{}, last[1].Aggregate)
+	assert.Equal(0.0, last[1].Avg())
+
+	// Windows that don't divide the range, or are at odd offsets.
+	odd := r.Windows(m, epoch.Add(7*time.Minute+30*time.Second), epoch.Add(5000*time.Minute), 97*time.Minute)
+	assert.Equal(epoch.Add(5000*time.Minute), odd[len(odd)-1].End)
+	for _, w := range odd {
+		assert.Equal(scan(m, w.Start, w.End), w.Aggregate)
+	}
+	assert.Equal(scan(m, epoch.Add(-time.Hour), epoch.Add(time.Hour*1000)), r.Range(m, epoch.Add(-time.Hour), epoch.Add(time.Hour*1000)))
+	assert.Empty(r.Windows(m, epoch, epoch, time.Hour))
+}
+
+func TestRollupCachesChunks(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	m := series(vs, 10000)
+
+	read := 0
+	r := NewRollup(func(v types.Value) (float64, bool) {
+		read++
+		return float64(v.(types.Number)), true
+	})
+	all := r.Range(m, epoch, epoch.Add(10000*time.Minute))
+	assert.Equal(uint64(10000), all.Count)
+	assert.Equal(10000, read)
+
+	// Only the points in the chunks at the edges of windows are read again.
+	read = 0
+	assert.Equal(all, r.Range(m, epoch, epoch.Add(10000*time.Minute)))
+	assert.True(read < 10000/4, "read %d points", read)
+	read = 0
+	days := r.Windows(m, epoch, epoch.Add(7*24*time.Hour), 24*time.Hour)
+	assert.Equal(scan(m, epoch, epoch.Add(24*time.Hour)), days[0].Aggregate)
+	assert.True(read < 10000, "read %d points", read)
+
+	// A new version of the series shares most of its chunks with the last.
+	m = m.Set(Key(epoch.Add(5*time.Minute)), types.Number(1000))
+	read = 0
+	all = r.Range(m, epoch, epoch.Add(10000*time.Minute))
+	assert.Equal(1000.0, all.Max)
+	assert.True(read < 10000/4, "read %d points", read)
+
+	// Points whose values are skipped aren't counted.
+	strings := types.NewMap(Key(epoch), types.String("a"), Key(epoch.Add(time.Second)), types.Number(2))
+	assert.Equal(Aggregate{1, 2, 2, 2}, NewRollup(nil).Range(strings, epoch, epoch.Add(time.Minute)))
+}
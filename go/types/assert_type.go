@@ -46,6 +46,10 @@ func isSubtype(requiredType, concreteType *Type, parentStructTypes []*Type) bool
 
 	if desc, ok := requiredType.Desc.(CompoundDesc); ok {
 		concreteElemTypes := concreteType.Desc.(CompoundDesc).ElemTypes
+		if len(desc.ElemTypes) != len(concreteElemTypes) {
+			// Only Tuple types can differ in arity.
+			return false
+		}
 		for i, t := range desc.ElemTypes {
 			if !compoundSubtype(t, concreteElemTypes[i], parentStructTypes) {
 				return false
@@ -19,6 +19,9 @@ type BatchStore interface {
 	// Get returns from the store the Value Chunk by h. If h is absent from the store, chunks.EmptyChunk is returned.
 	Get(h hash.Hash) chunks.Chunk
 
+	// GetMany returns from the store the Value Chunks for |hashes|, in the same order. Absent Chunks are returned as chunks.EmptyChunk. Remote stores fetch them in as few round trips as they can.
+	GetMany(hashes hash.HashSlice) []chunks.Chunk
+
 	// SchedulePut enqueues a write for the Chunk c with the given refHeight. Typically, the Value which was encoded to provide c can also be queried for its refHeight. The call may or may not block until c is persisted. The provided hints are used to assist in validation. Validation requires checking that all refs embedded in c are themselves valid, which could naively be done by resolving each one. Instead, hints provides a (smaller) set of refs that point to Chunks that themselves contain many of c's refs. Thus, by checking only the hinted Chunks, c can be validated with fewer read operations.
 	// c may or may not be persisted when Put() returns, but is guaranteed to be persistent after a call to Flush() or Close().
 	SchedulePut(c chunks.Chunk, refHeight uint64, hints Hints)
@@ -52,6 +55,12 @@ func (bsa *BatchStoreAdaptor) Get(h hash.Hash) chunks.Chunk {
 	return bsa.cs.Get(h)
 }
 
+// GetMany simply proxies to the backing ChunkStore
+func (bsa *BatchStoreAdaptor) GetMany(hashes hash.HashSlice) []chunks.Chunk {
+	bsa.once.Do(bsa.expectVersion)
+	return bsa.cs.GetMany(hashes)
+}
+
 // SchedulePut simply calls Put on the underlying ChunkStore, and ignores hints.
 func (bsa *BatchStoreAdaptor) SchedulePut(c chunks.Chunk, refHeight uint64, hints Hints) {
 	bsa.once.Do(bsa.expectVersion)
@@ -60,6 +69,7 @@ func (bsa *BatchStoreAdaptor) SchedulePut(c chunks.Chunk, refHeight uint64, hint
 
 func (bsa *BatchStoreAdaptor) expectVersion() {
 	dataVersion := bsa.cs.Version()
+	d.PanicIfTrue(constants.CanUpgrade(dataVersion), "SDK version %s incompatible with data of version %s; upgrade the database with noms backup and noms restore", constants.NomsVersion, dataVersion)
 	d.PanicIfTrue(constants.NomsVersion != dataVersion, "SDK version %s incompatible with data of version %s", constants.NomsVersion, dataVersion)
 }
 
@@ -65,6 +65,54 @@ func (b Blob) Concat(other Blob) Blob {
 	return newBlob(seq)
 }
 
+// Diff streams the ranges of bytes that differ between |last| and b to |changes|, as Splices whose indices are byte offsets. Rather than comparing bytes, it compares chunks, skipping those the two Blobs share without reading them, so each Splice covers whole chunks, and the bytes it says were removed and added are those of the chunks that differ. That's a good measure of how big a change to a big Blob is, since Blobs are chunked by their content, so that a small change only changes the chunks around it. Caller can close |closeChan| to cancel the diff operation.
+func (b Blob) Diff(last Blob, changes chan<- Splice, closeChan <-chan struct{}) {
+	if b.Equals(last) {
+		return
+	}
+	lastCur := newCursorAtIndex(last.seq, 0)
+	bCur := newCursorAtIndex(b.seq, 0)
+	indexedSequenceDiff(last.seq, lastCur.depth(), 0, b.seq, bCur.depth(), 0, changes, closeChan, DEFAULT_MAX_SPLICE_MATRIX_SIZE, true)
+}
+
+// BlobEdit replaces the |Remove| bytes at |At| in a Blob with |Data|.
+type BlobEdit struct {
+	At     uint64
+	Remove uint64
+	Data   []byte
+}
+
+// Delta returns the BlobEdits which turn |last| into b, a binary delta holding only the bytes of the chunks that b doesn't share with |last|, as Diff finds them. The edits are in order of At, each an offset into |last|, and ApplyDelta applies them.
+func (b Blob) Delta(last Blob) []BlobEdit {
+	splices := make(chan Splice)
+	go func() {
+		b.Diff(last, splices, nil)
+		close(splices)
+	}()
+
+	edits := []BlobEdit{}
+	r := b.Reader()
+	for sp := range splices {
+		edit := BlobEdit{At: sp.SpAt, Remove: sp.SpRemoved, Data: make([]byte, sp.SpAdded)}
+		if sp.SpAdded > 0 {
+			_, err := r.Seek(int64(sp.SpFrom), 0)
+			d.PanicIfError(err)
+			_, err = io.ReadFull(r, edit.Data)
+			d.PanicIfError(err)
+		}
+		edits = append(edits, edit)
+	}
+	return edits
+}
+
+// ApplyDelta returns b with |edits|, made by Delta, applied. Since the offsets of the edits are into b as it is, they're applied last first, so that none moves the bytes another is to edit.
+func (b Blob) ApplyDelta(edits []BlobEdit) Blob {
+	for i := len(edits) - 1; i >= 0; i-- {
+		b = b.Splice(edits[i].At, edits[i].Remove, edits[i].Data)
+	}
+	return b
+}
+
 func (b Blob) newChunker(cur *sequenceCursor, vr ValueReader) *sequenceChunker {
 	return newSequenceChunker(cur, vr, nil, makeBlobLeafChunkFn(vr), newIndexedMetaSequenceChunkFn(BlobKind, vr), hashValueByte)
 }
@@ -276,6 +276,68 @@ func TestBlobConcat(t *testing.T) {
 	assert.True(b.Equals(b7.Concat(b8)))
 }
 
+func TestBlobDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	smallTestChunks()
+	defer normalProductionChunks()
+
+	diff := func(b, last Blob) (splices []Splice, removed, added uint64) {
+		ch := make(chan Splice)
+		go func() {
+			b.Diff(last, ch, nil)
+			close(ch)
+		}()
+		for sp := range ch {
+			splices = append(splices, sp)
+			removed += sp.SpRemoved
+			added += sp.SpAdded
+		}
+		return
+	}
+
+	r := rand.New(rand.NewSource(0))
+	data := make([]byte, 1e5)
+	_, err := r.Read(data)
+	assert.NoError(err)
+	b1 := NewBlob(bytes.NewReader(data))
+
+	// Change a few bytes in the middle, and add some at the end.
+	data2 := append([]byte{}, data...)
+	copy(data2[5e4:], "changed")
+	data2 = append(data2, "more"...)
+	b2 := NewBlob(bytes.NewReader(data2))
+
+	splices, removed, added := diff(b2, b1)
+	assert.NotEmpty(splices)
+	assert.True(removed < uint64(len(data))/4, "%d bytes removed", removed)
+	assert.True(added < uint64(len(data2))/4, "%d bytes added", added)
+	assert.Equal(uint64(len(data2)-len(data)), added-removed)
+	for i := 1; i < len(splices); i++ {
+		assert.True(splices[i-1].SpAt+splices[i-1].SpRemoved <= splices[i].SpAt)
+	}
+
+	delta := b2.Delta(b1)
+	assert.Len(delta, len(splices))
+	assert.True(b2.Equals(b1.ApplyDelta(delta)))
+	assert.True(b1.Equals(b2.ApplyDelta(b1.Delta(b2))))
+
+	splices, _, _ = diff(b1, b1)
+	assert.Empty(splices)
+	assert.Empty(b1.Delta(b1))
+
+	// Blobs of a single chunk are replaced whole.
+	small1, small2 := NewBlob(strings.NewReader("hello")), NewBlob(strings.NewReader("help"))
+	splices, _, _ = diff(small2, small1)
+	assert.Equal([]Splice{{0, 5, 4, 0}}, splices)
+	assert.Equal([]BlobEdit{{0, 5, []byte("help")}}, small2.Delta(small1))
+
+	splices, _, _ = diff(b1, NewEmptyBlob())
+	assert.Equal([]Splice{{0, 0, uint64(len(data)), 0}}, splices)
+	assert.True(b1.Equals(NewEmptyBlob().ApplyDelta(b1.Delta(NewEmptyBlob()))))
+	assert.True(NewEmptyBlob().Equals(b1.ApplyDelta(NewEmptyBlob().Delta(b1))))
+}
+
 func TestBlobNewParallel(t *testing.T) {
 	assert := assert.New(t)
 
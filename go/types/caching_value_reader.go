@@ -0,0 +1,89 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/util/sizecache"
+)
+
+// CachingValueReader is a ValueReader that keeps an LRU cache of the decoded
+// Values it has read from an underlying ValueReader. It's useful during graph
+// traversals that call Ref.TargetValue() on the same Refs many times, e.g.
+// walking commit ancestry, when the underlying ValueReader doesn't cache
+// decoded Values itself.
+//
+// Each Value is charged to the cache at the size of the chunk it was decoded
+// from, so only Values read from a ValueStore, or a Database, are cached;
+// reads from other ValueReaders go straight through.
+type CachingValueReader struct {
+	vr    ValueReader
+	svr   sizedValueReader // nil if vr can't report chunk sizes
+	cache *sizecache.SizeCache
+}
+
+// sizedValueReader is implemented by ValueReaders, e.g. ValueStore, that can
+// report the size of the chunk each Value was decoded from.
+type sizedValueReader interface {
+	readValueAndSize(h hash.Hash) (Value, uint64)
+	readManyValuesAndSizes(hashes hash.HashSlice) (ValueSlice, []uint64)
+}
+
+// NewCachingValueReader returns a CachingValueReader that reads through to vr
+// and caches up to roughly maxBytes worth of encoded Values.
+func NewCachingValueReader(vr ValueReader, maxBytes uint64) *CachingValueReader {
+	svr, _ := vr.(sizedValueReader)
+	return &CachingValueReader{vr, svr, sizecache.New(maxBytes)}
+}
+
+// ReadValue returns the cached Value for h if there is one, otherwise it reads
+// the Value from the underlying ValueReader and caches it. Absent values
+// aren't cached, since they may be written later.
+func (cvr *CachingValueReader) ReadValue(h hash.Hash) Value {
+	if v, ok := cvr.cache.Get(h); ok {
+		return v.(Value)
+	}
+	if cvr.svr == nil {
+		return cvr.vr.ReadValue(h)
+	}
+
+	v, size := cvr.svr.readValueAndSize(h)
+	cvr.add(h, v, size)
+	return v
+}
+
+// ReadManyValues returns the cached Values for |hashes|, reading those that aren't cached from the underlying ValueReader with a single call to its ReadManyValues().
+func (cvr *CachingValueReader) ReadManyValues(hashes hash.HashSlice) ValueSlice {
+	if cvr.svr == nil {
+		return cvr.vr.ReadManyValues(hashes)
+	}
+
+	vals := make(ValueSlice, len(hashes))
+	misses, missIdx := hash.HashSlice{}, []int{}
+	for i, h := range hashes {
+		if v, ok := cvr.cache.Get(h); ok {
+			vals[i] = v.(Value)
+			continue
+		}
+		misses = append(misses, h)
+		missIdx = append(missIdx, i)
+	}
+	if len(misses) == 0 {
+		return vals
+	}
+
+	read, sizes := cvr.svr.readManyValuesAndSizes(misses)
+	for i, v := range read {
+		vals[missIdx[i]] = v
+		cvr.add(misses[i], v, sizes[i])
+	}
+	return vals
+}
+
+func (cvr *CachingValueReader) add(h hash.Hash, v Value, size uint64) {
+	if v != nil {
+		cvr.cache.Add(h, size, v)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/hash"
+)
+
+type countingValueReader struct {
+	vs    *ValueStore
+	reads int
+}
+
+func (cvr *countingValueReader) ReadValue(h hash.Hash) Value {
+	cvr.reads++
+	return cvr.vs.ReadValue(h)
+}
+
+func (cvr *countingValueReader) ReadManyValues(hashes hash.HashSlice) ValueSlice {
+	cvr.reads++
+	return cvr.vs.ReadManyValues(hashes)
+}
+
+func (cvr *countingValueReader) readValueAndSize(h hash.Hash) (Value, uint64) {
+	cvr.reads++
+	return cvr.vs.readValueAndSize(h)
+}
+
+func (cvr *countingValueReader) readManyValuesAndSizes(hashes hash.HashSlice) (ValueSlice, []uint64) {
+	cvr.reads++
+	return cvr.vs.readManyValuesAndSizes(hashes)
+}
+
+// plainValueReader hides the chunk sizes a ValueStore reports.
+type plainValueReader struct {
+	ValueReader
+}
+
+func TestCachingValueReader(t *testing.T) {
+	assert := assert.New(t)
+
+	vs := NewTestValueStore()
+	l := NewList(Number(1), Number(2))
+	r := vs.WriteValue(l)
+	vs.Flush()
+
+	counter := &countingValueReader{vs: vs}
+	cvr := NewCachingValueReader(counter, 1<<20)
+
+	assert.True(l.Equals(r.TargetValue(cvr)))
+	assert.True(l.Equals(r.TargetValue(cvr)))
+	assert.Equal(1, counter.reads)
+
+	// Absent values aren't cached.
+	absent := hash.Parse("00000000000000000000000000000001")
+	assert.Nil(cvr.ReadValue(absent))
+	assert.Nil(cvr.ReadValue(absent))
+	assert.Equal(3, counter.reads)
+}
+
+func TestCachingValueReaderEvicts(t *testing.T) {
+	assert := assert.New(t)
+
+	vs := NewTestValueStore()
+	s1, s2 := String("first"), String("second")
+	r1, r2 := vs.WriteValue(s1), vs.WriteValue(s2)
+	vs.Flush()
+
+	counter := &countingValueReader{vs: vs}
+	// Only room for one of the two values at a time.
+	cvr := NewCachingValueReader(counter, uint64(len(EncodeValue(s2, nil).Data())))
+
+	cvr.ReadValue(r1.TargetHash())
+	cvr.ReadValue(r2.TargetHash())
+	assert.Equal(2, counter.reads)
+	cvr.ReadValue(r2.TargetHash())
+	assert.Equal(2, counter.reads)
+	assert.True(s1.Equals(cvr.ReadValue(r1.TargetHash())))
+	assert.Equal(3, counter.reads)
+}
+
+func TestCachingValueReaderReadManyValues(t *testing.T) {
+	assert := assert.New(t)
+
+	vs := NewTestValueStore()
+	v1, v2 := String("one"), String("two")
+	r1, r2 := vs.WriteValue(v1), vs.WriteValue(v2)
+	vs.Flush()
+
+	counter := &countingValueReader{vs: vs}
+	cvr := NewCachingValueReader(counter, 1<<20)
+	absent := hash.Parse("00000000000000000000000000000001")
+
+	vals := cvr.ReadManyValues(hash.HashSlice{r1.TargetHash(), absent, r2.TargetHash()})
+	assert.True(v1.Equals(vals[0]))
+	assert.Nil(vals[1])
+	assert.True(v2.Equals(vals[2]))
+	assert.Equal(1, counter.reads)
+
+	// The values that were present are cached now, but the absent one isn't.
+	cvr.ReadManyValues(hash.HashSlice{r2.TargetHash(), r1.TargetHash()})
+	assert.Equal(1, counter.reads)
+	assert.Nil(cvr.ReadManyValues(hash.HashSlice{r2.TargetHash(), absent})[1])
+	assert.Equal(2, counter.reads)
+}
+
+func TestCachingValueReaderWithoutSizes(t *testing.T) {
+	assert := assert.New(t)
+
+	vs := NewTestValueStore()
+	s := String("uncached")
+	r := vs.WriteValue(s)
+	vs.Flush()
+
+	cvr := NewCachingValueReader(plainValueReader{vs}, 1<<20)
+	assert.True(s.Equals(cvr.ReadValue(r.TargetHash())))
+	_, ok := cvr.cache.Get(r.TargetHash())
+	assert.False(ok)
+}
@@ -6,6 +6,8 @@ package types
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/d"
@@ -14,6 +16,26 @@ import (
 
 const initialBufferSize = 2048
 
+// DecodeError is the error that decoding a value panics with, or that DecodeValueE returns, if the data it's decoded from isn't a valid encoding of one, as when it comes from a database that's corrupt or malicious.
+type DecodeError struct {
+	Reason string
+}
+
+func (e DecodeError) Error() string {
+	return "Invalid value encoding: " + e.Reason
+}
+
+// IsDecodeError returns true if |err|, or the cause of it, if it was wrapped by package d, is a DecodeError.
+func IsDecodeError(err error) bool {
+	_, ok := d.Unwrap(err).(DecodeError)
+	return ok
+}
+
+// decodeErrorf panics with a DecodeError.
+func decodeErrorf(format string, args ...interface{}) {
+	d.PanicIfError(DecodeError{fmt.Sprintf(format, args...)})
+}
+
 func EncodeValue(v Value, vw ValueWriter) chunks.Chunk {
 	w := newBinaryNomsWriter()
 	enc := newValueEncoder(w, vw)
@@ -28,19 +50,29 @@ func EncodeValue(v Value, vw ValueWriter) chunks.Chunk {
 }
 
 func DecodeFromBytes(data []byte, vr ValueReader, tc *TypeCache) Value {
+	return decodeFromBytes(data, vr, tc, false)
+}
+
+// decodeFromBytes decodes a value from |data|. If |lazy| is set, the fields of structs and the elements of list leaves are decoded from data as they're read, rather than all at once, so data mustn't be changed afterwards.
+func decodeFromBytes(data []byte, vr ValueReader, tc *TypeCache, lazy bool) Value {
 	tc.Lock()
 	defer tc.Unlock()
 	br := &binaryNomsReader{data, 0}
 	dec := newValueDecoder(br, vr, tc)
+	if lazy {
+		dec.data = data
+	}
 	v := dec.readValue()
-	d.PanicIfFalse(br.pos() == uint32(len(data)))
+	if br.pos() != uint32(len(data)) {
+		decodeErrorf("%d bytes left over after value", len(data)-int(br.pos()))
+	}
 	return v
 }
 
-// DecodeValue decodes a value from a chunk source. It is an error to provide an empty chunk.
+// DecodeValue decodes a value from a chunk source. It is an error to provide an empty chunk. The fields of structs and the elements of list leaves are only decoded from the chunk's data when they're first read.
 func DecodeValue(c chunks.Chunk, vr ValueReader) Value {
 	d.PanicIfTrue(c.IsEmpty())
-	v := DecodeFromBytes(c.Data(), vr, staticTypeCache)
+	v := decodeFromBytes(c.Data(), vr, staticTypeCache, true)
 	if cacher, ok := v.(hashCacher); ok {
 		assignHash(cacher, c.Hash())
 	}
@@ -48,9 +80,32 @@ func DecodeValue(c chunks.Chunk, vr ValueReader) Value {
 	return v
 }
 
+// DecodeValueE is like DecodeValue, but returns a DecodeError rather than panicking if |c| isn't a valid encoding of a value. Unlike DecodeValue, it decodes all of the chunk at once, so that the value it returns won't panic later on when its parts are read. It's meant for chunks from sources that can't be trusted, such as the requests a server is sent.
+func DecodeValueE(c chunks.Chunk, vr ValueReader) (v Value, err error) {
+	if c.IsEmpty() {
+		return nil, DecodeError{"empty chunk"}
+	}
+	err = d.TryAll(func() {
+		v = decodeFromBytes(c.Data(), vr, staticTypeCache, false)
+	})
+	if err != nil {
+		// Decoding doesn't read from vr, so the checks that fail, such as those of the types that values claim to have, are failing because of c. Anything else, which TryAll returns as a d.PanicError, is a bug.
+		if _, ok := err.(d.PanicError); !ok && !IsDecodeError(err) {
+			err = DecodeError{err.Error()}
+		}
+		return nil, err
+	}
+	if cacher, ok := v.(hashCacher); ok {
+		assignHash(cacher, c.Hash())
+	}
+	return v, nil
+}
+
 type nomsReader interface {
 	pos() uint32
 	seek(pos uint32)
+	skip(n uint32)
+	readCount() uint32
 	readBytes() []byte
 	readUint8() uint8
 	readUint32() uint32
@@ -87,8 +142,29 @@ func (b *binaryNomsReader) seek(pos uint32) {
 	b.offset = pos
 }
 
+// need panics with a DecodeError unless there are at least |n| more bytes to read.
+func (b *binaryNomsReader) need(n uint32) {
+	if uint64(b.offset)+uint64(n) > uint64(len(b.buff)) {
+		decodeErrorf("%d bytes needed at offset %d of %d", n, b.offset, len(b.buff))
+	}
+}
+
+// skip moves past the next |n| bytes.
+func (b *binaryNomsReader) skip(n uint32) {
+	b.need(n)
+	b.offset += n
+}
+
+// readCount reads the number of things that follow, e.g. the elements of a list, which, since each takes at least a byte, can't be more than the bytes left, so that a bad count can't make the decoder allocate more than the data could hold.
+func (b *binaryNomsReader) readCount() uint32 {
+	count := b.readUint32()
+	b.need(count)
+	return count
+}
+
 func (b *binaryNomsReader) readBytes() []byte {
 	size := b.readUint32()
+	b.need(size)
 
 	buff := make([]byte, size, size)
 	copy(buff, b.buff[b.offset:b.offset+size])
@@ -97,12 +173,14 @@ func (b *binaryNomsReader) readBytes() []byte {
 }
 
 func (b *binaryNomsReader) readUint8() uint8 {
+	b.need(1)
 	v := uint8(b.buff[b.offset])
 	b.offset++
 	return v
 }
 
 func (b *binaryNomsReader) readUint32() uint32 {
+	b.need(4)
 	// Big-Endian
 	v := uint32(b.buff[b.offset])<<24 |
 		uint32(b.buff[b.offset+1])<<16 |
@@ -113,6 +191,7 @@ func (b *binaryNomsReader) readUint32() uint32 {
 }
 
 func (b *binaryNomsReader) readUint64() uint64 {
+	b.need(8)
 	// Big-Endian
 	v := uint64(b.buff[b.offset])<<56 |
 		uint64(b.buff[b.offset+1])<<48 |
@@ -127,12 +206,22 @@ func (b *binaryNomsReader) readUint64() uint64 {
 }
 
 func (b *binaryNomsReader) readNumber() Number {
-	// b.assertCanRead(binary.MaxVarintLen64 * 2)
 	i, count := binary.Varint(b.buff[b.offset:])
+	if count <= 0 {
+		decodeErrorf("invalid number at offset %d", b.offset)
+	}
 	b.offset += uint32(count)
 	exp, count2 := binary.Varint(b.buff[b.offset:])
+	if count2 <= 0 {
+		decodeErrorf("invalid number at offset %d", b.offset)
+	}
 	b.offset += uint32(count2)
-	return Number(intExpToFloat64(i, int(exp)))
+	f := intExpToFloat64(i, int(exp))
+	// Numbers are never NaN or infinite, which couldn't be encoded again.
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		decodeErrorf("invalid number at offset %d", b.offset)
+	}
+	return Number(f)
 }
 
 func (b *binaryNomsReader) readBool() bool {
@@ -141,6 +230,7 @@ func (b *binaryNomsReader) readBool() bool {
 
 func (b *binaryNomsReader) readString() string {
 	size := b.readUint32()
+	b.need(size)
 
 	v := string(b.buff[b.offset : b.offset+size])
 	b.offset += size
@@ -150,6 +240,7 @@ func (b *binaryNomsReader) readString() string {
 // Note: It's somewhat of a layering violation that a nomsReaders knows about a TypeCache. The reason why the code is structured this way is that the go compiler can stack-allocate the string which is created from the byte slice, which is a fairly large perf gain.
 func (b *binaryNomsReader) readIdent(tc *TypeCache) uint32 {
 	size := b.readUint32()
+	b.need(size)
 	id, ok := tc.identTable.entries[string(b.buff[b.offset:b.offset+size])]
 	if !ok {
 		id = tc.identTable.GetId(string(b.buff[b.offset : b.offset+size]))
@@ -160,6 +251,7 @@ func (b *binaryNomsReader) readIdent(tc *TypeCache) uint32 {
 }
 
 func (b *binaryNomsReader) readHash() hash.Hash {
+	b.need(hash.ByteLen)
 	digest := hash.Digest{}
 	copy(digest[:], b.buff[b.offset:b.offset+hash.ByteLen])
 	b.offset += hash.ByteLen
@@ -271,6 +363,15 @@ func (b *binaryNomsWriter) writeHash(h hash.Hash) {
 	b.offset += hash.ByteLen
 }
 
+// writeRaw writes |data|, which is already encoded, as it is.
+func (b *binaryNomsWriter) writeRaw(data []byte) {
+	size := uint32(len(data))
+	b.ensureCapacity(size)
+
+	copy(b.buff[b.offset:], data)
+	b.offset += size
+}
+
 func (b *binaryNomsWriter) appendType(t *Type) {
 	data := t.serialization
 	size := uint32(len(data))
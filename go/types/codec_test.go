@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
 )
 
 func TestWriteBigEndianIntegers(t *testing.T) {
@@ -44,3 +46,87 @@ func TestReadBigEndianIntegers(t *testing.T) {
 	assert.True(r.readUint32() == uint32(1))
 	assert.True(r.readUint64() == uint64(1))
 }
+
+func TestDecodeValueE(t *testing.T) {
+	assert := assert.New(t)
+	vs := NewTestValueStore()
+
+	v := NewStruct("S", StructData{"l": NewList(Number(1), String("two")), "b": Bool(true)})
+	c := EncodeValue(v, nil)
+	v2, err := DecodeValueE(c, vs)
+	assert.NoError(err)
+	assert.True(v.Equals(v2))
+
+	_, err = DecodeValueE(chunks.EmptyChunk, vs)
+	assert.True(IsDecodeError(err))
+	for i := 1; i < len(c.Data()); i++ {
+		_, err = DecodeValueE(chunks.NewChunk(c.Data()[:i]), vs)
+		assert.True(IsDecodeError(err), "truncated to %d bytes: %v", i, err)
+	}
+	_, err = DecodeValueE(chunks.NewChunk(append(c.Data(), 0)), vs)
+	assert.True(IsDecodeError(err))
+
+	// A list claiming more elements than there are bytes left fails before allocating them.
+	w := newBinaryNomsWriter()
+	w.writeUint8(uint8(ListKind))
+	w.writeUint8(uint8(NumberKind))
+	w.writeBool(false)
+	w.writeUint32(1 << 30)
+	_, err = DecodeValueE(chunks.NewChunk(w.data()), vs)
+	assert.True(IsDecodeError(err))
+
+	// Types nested deeper than maxDecodeDepth fail rather than overflowing the stack.
+	w = newBinaryNomsWriter()
+	for i := 0; i <= maxDecodeDepth; i++ {
+		w.writeUint8(uint8(ListKind))
+	}
+	w.writeUint8(uint8(NumberKind))
+	_, err = DecodeValueE(chunks.NewChunk(w.data()), vs)
+	assert.True(IsDecodeError(err))
+
+	// Chunks that can't be decoded panic with a DecodeError, which lazily decoded fields only come across when they're read.
+	assert.True(IsDecodeError(d.Try(func() { DecodeValue(chunks.NewChunk([]byte{byte(NomsKind(0xff))}), vs) })))
+}
+
+// FuzzDecodeValue checks that decoding arbitrary chunks, as a server does those it's sent, fails with a DecodeError rather than a runtime panic, such as reading past the end of the chunk, and that whatever does decode can be encoded again.
+func FuzzDecodeValue(f *testing.F) {
+	vs := NewTestValueStore()
+	r := vs.WriteValue(Number(42))
+	for _, v := range []Value{
+		Bool(true),
+		Number(-1.5),
+		String("hello"),
+		NewBlob(bytes.NewBufferString("blob")),
+		NewList(Number(1), String("two"), NewList()),
+		NewSet(Number(1), Number(2)),
+		NewMap(String("k"), Number(1), Number(2), String("v")),
+		NewStruct("S", StructData{"a": Number(1), "b": NewList(String("x"))}),
+		r,
+		NumberType,
+		MakeStructType("T", []string{"x"}, []*Type{MakeListType(MakeCycleType(0))}),
+	} {
+		f.Add(EncodeValue(v, nil).Data())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := DecodeValueE(chunks.NewChunk(data), vs)
+		if err != nil {
+			if !IsDecodeError(err) {
+				t.Fatalf("decoding %x failed with %#v, not a DecodeError", data, err)
+			}
+			return
+		}
+		EncodeValue(v, nil)
+
+		// DecodeValue, which decodes lazily, and panics, mustn't fail with a runtime panic either.
+		err = d.TryAll(func() {
+			v := DecodeValue(chunks.NewChunk(data), vs)
+			if s, ok := v.(Struct); ok {
+				s.WalkValues(func(Value) {})
+			}
+		})
+		if _, ok := err.(d.PanicError); ok {
+			t.Fatalf("lazily decoding %x failed with %v", data, err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"github.com/stormasm/noms/go/hash"
+)
+
+// Counter is a numeric Value whose concurrent modifications always merge. When
+// two writers independently change a Counter from a common ancestor, the
+// merged value is the ancestor plus both writers' deltas, so increments and
+// decrements made on either side are never lost and never conflict.
+//
+// Unlike Number, Counters are ordered by hash.
+type Counter float64
+
+// Add returns a Counter with |delta| added to c. Use a negative |delta| to
+// decrement.
+func (c Counter) Add(delta float64) Counter {
+	return c + Counter(delta)
+}
+
+// MergeCounters returns the three-way merge of |a| and |b| given their common
+// ancestor |parent|: parent + (a - parent) + (b - parent).
+func MergeCounters(a, b, parent Counter) Counter {
+	return a + b - parent
+}
+
+// Value interface
+func (c Counter) Equals(other Value) bool {
+	return c == other
+}
+
+func (c Counter) Less(other Value) bool {
+	return valueLess(c, other)
+}
+
+func (c Counter) Hash() hash.Hash {
+	return getHash(c)
+}
+
+func (c Counter) WalkValues(cb ValueCallback) {
+}
+
+func (c Counter) WalkRefs(cb RefCallback) {
+}
+
+func (c Counter) Type() *Type {
+	return CounterType
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	c := Counter(10).Add(5).Add(-2)
+	assert.True(Counter(13).Equals(c))
+	assert.False(Number(13).Equals(c))
+	assert.True(CounterType.Equals(c.Type()))
+	assert.Equal(Counter(12), MergeCounters(Counter(15), Counter(7), Counter(10)))
+
+	vs := NewTestValueStore()
+	r := vs.WriteValue(c)
+	assert.True(c.Equals(vs.ReadValue(r.TargetHash())))
+
+	assert.Equal("13", EncodedValue(c))
+	assert.Equal("Counter(13)", EncodedValueWithTags(c))
+}
+
+func TestLWWRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	r1 := NewLWWRegister(String("a"), 1)
+	r2 := r1.Set(String("b"), 2)
+	assert.True(String("a").Equals(r1.Get()))
+	assert.Equal(uint64(2), r2.Timestamp())
+	assert.True(MakeLWWRegisterType(StringType).Equals(r2.Type()))
+	assert.False(r1.Equals(r2))
+
+	assert.True(r2.Equals(r1.Merge(r2)))
+	assert.True(r2.Equals(r2.Merge(r1)))
+
+	// Ties are broken the same way regardless of order.
+	t1, t2 := NewLWWRegister(String("x"), 5), NewLWWRegister(Number(7), 5)
+	assert.True(t1.Merge(t2).Equals(t2.Merge(t1)))
+
+	vs := NewTestValueStore()
+	l := NewList(Number(1))
+	reg := NewLWWRegister(vs.WriteValue(l), 42)
+	ref := vs.WriteValue(reg)
+	v := vs.ReadValue(ref.TargetHash())
+	assert.True(reg.Equals(v))
+	assert.True(reg.Type().Equals(v.Type()))
+	assert.Equal(uint64(42), v.(LWWRegister).Timestamp())
+
+	count := 0
+	reg.WalkRefs(func(Ref) { count++ })
+	assert.Equal(1, count)
+
+	assert.Equal(`"b" @ 2`, EncodedValue(r2))
+	assert.Equal("LWWRegister<String>(\"b\" @ 2)", EncodedValueWithTags(r2))
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+// Difference describes a single change found by DiffStream. Path is the
+// location of the change relative to the root values that were diffed.
+// OldValue is nil for DiffChangeAdded and NewValue is nil for
+// DiffChangeRemoved.
+type Difference struct {
+	Path       Path
+	ChangeType DiffChangeType
+	OldValue   Value
+	NewValue   Value
+}
+
+// DiffStream computes the differences from |older| to |newer| and sends them
+// to |ch|, descending into Lists, Maps, Sets and Structs so that each
+// Difference is reported at the deepest Path where the two values diverge.
+// Subtrees with the same hash are skipped without being read, so the cost is
+// proportional to the size of the change rather than the size of the values.
+//
+// Either of |older| or |newer| may be nil, in which case a single Added or
+// Removed Difference is sent for the root. Map keys and Set values which
+// can't be spelled in a Path are addressed by hash. DiffStream returns once
+// all differences have been sent, or after |stopCh| is closed. It does not
+// close |ch|.
+func DiffStream(older, newer Value, ch chan<- Difference, stopCh <-chan struct{}) {
+	switch {
+	case older == nil && newer == nil:
+		return
+	case older == nil:
+		sendDifference(ch, stopCh, Difference{Path{}, DiffChangeAdded, nil, newer})
+	case newer == nil:
+		sendDifference(ch, stopCh, Difference{Path{}, DiffChangeRemoved, older, nil})
+	default:
+		diffValues(Path{}, older, newer, ch, stopCh)
+	}
+}
+
+func sendDifference(ch chan<- Difference, stopCh <-chan struct{}, diff Difference) bool {
+	select {
+	case ch <- diff:
+		return true
+	case <-stopCh:
+		return false
+	}
+}
+
+// canDescend returns true if |v1| and |v2| are collections of the same kind
+// whose differences can be expressed at a finer granularity than the values
+// themselves.
+func canDescend(v1, v2 Value) bool {
+	k := v1.Type().Kind()
+	if k != v2.Type().Kind() {
+		return false
+	}
+	switch k {
+	case ListKind, MapKind, SetKind, StructKind:
+		return true
+	}
+	return false
+}
+
+// appendPath returns a copy of |p| with |part| appended, so that Paths sent on
+// the channel never share a backing array.
+func appendPath(p Path, part PathPart) Path {
+	res := make(Path, len(p), len(p)+1)
+	copy(res, p)
+	return append(res, part)
+}
+
+func diffValues(p Path, v1, v2 Value, ch chan<- Difference, stopCh <-chan struct{}) bool {
+	if v1.Equals(v2) {
+		return true
+	}
+	if !canDescend(v1, v2) {
+		return sendDifference(ch, stopCh, Difference{p, DiffChangeModified, v1, v2})
+	}
+
+	switch v1 := v1.(type) {
+	case List:
+		return diffListValues(p, v1, v2.(List), ch, stopCh)
+	case Map:
+		return diffMapValues(p, v1, v2.(Map), ch, stopCh)
+	case Set:
+		return diffSetValues(p, v1, v2.(Set), ch, stopCh)
+	case Struct:
+		return diffStructValues(p, v1, v2.(Struct), ch, stopCh)
+	}
+	panic("unreachable")
+}
+
+func diffListValues(p Path, l1, l2 List, ch chan<- Difference, stopCh <-chan struct{}) bool {
+	splices := make(chan Splice)
+	go func() {
+		l2.Diff(l1, splices, stopCh)
+		close(splices)
+	}()
+
+	ok := true
+	for splice := range splices {
+		if !ok {
+			continue // drain
+		}
+		if splice.SpRemoved == splice.SpAdded {
+			// Elements were replaced in place, so compare them pairwise.
+			for i := uint64(0); i < splice.SpRemoved && ok; i++ {
+				idx := splice.SpAt + i
+				ok = diffValues(appendPath(p, NewIndexPath(Number(idx))), l1.Get(idx), l2.Get(splice.SpFrom+i), ch, stopCh)
+			}
+			continue
+		}
+		for i := uint64(0); i < splice.SpRemoved && ok; i++ {
+			idx := splice.SpAt + i
+			ok = sendDifference(ch, stopCh, Difference{appendPath(p, NewIndexPath(Number(idx))), DiffChangeRemoved, l1.Get(idx), nil})
+		}
+		for i := uint64(0); i < splice.SpAdded && ok; i++ {
+			idx := splice.SpFrom + i
+			ok = sendDifference(ch, stopCh, Difference{appendPath(p, NewIndexPath(Number(idx))), DiffChangeAdded, nil, l2.Get(idx)})
+		}
+	}
+	return ok
+}
+
+func diffMapValues(p Path, m1, m2 Map, ch chan<- Difference, stopCh <-chan struct{}) bool {
+	changes := make(chan ValueChanged)
+	go func() {
+		m2.Diff(m1, changes, stopCh)
+		close(changes)
+	}()
+
+	ok := true
+	for change := range changes {
+		if !ok {
+			continue // drain
+		}
+		kp := appendPath(p, indexPathPart(change.V))
+		switch change.ChangeType {
+		case DiffChangeAdded:
+			ok = sendDifference(ch, stopCh, Difference{kp, DiffChangeAdded, nil, m2.Get(change.V)})
+		case DiffChangeRemoved:
+			ok = sendDifference(ch, stopCh, Difference{kp, DiffChangeRemoved, m1.Get(change.V), nil})
+		case DiffChangeModified:
+			ok = diffValues(kp, m1.Get(change.V), m2.Get(change.V), ch, stopCh)
+		}
+	}
+	return ok
+}
+
+func diffSetValues(p Path, s1, s2 Set, ch chan<- Difference, stopCh <-chan struct{}) bool {
+	changes := make(chan ValueChanged)
+	go func() {
+		s2.Diff(s1, changes, stopCh)
+		close(changes)
+	}()
+
+	ok := true
+	for change := range changes {
+		if !ok {
+			continue // drain
+		}
+		vp := appendPath(p, indexPathPart(change.V))
+		switch change.ChangeType {
+		case DiffChangeAdded:
+			ok = sendDifference(ch, stopCh, Difference{vp, DiffChangeAdded, nil, change.V})
+		case DiffChangeRemoved:
+			ok = sendDifference(ch, stopCh, Difference{vp, DiffChangeRemoved, change.V, nil})
+		}
+	}
+	return ok
+}
+
+func diffStructValues(p Path, s1, s2 Struct, ch chan<- Difference, stopCh <-chan struct{}) bool {
+	changes := make(chan ValueChanged)
+	go func() {
+		s2.Diff(s1, changes, stopCh)
+		close(changes)
+	}()
+
+	ok := true
+	for change := range changes {
+		if !ok {
+			continue // drain
+		}
+		name := string(change.V.(String))
+		fp := appendPath(p, NewFieldPath(name))
+		switch change.ChangeType {
+		case DiffChangeAdded:
+			ok = sendDifference(ch, stopCh, Difference{fp, DiffChangeAdded, nil, s2.Get(name)})
+		case DiffChangeRemoved:
+			ok = sendDifference(ch, stopCh, Difference{fp, DiffChangeRemoved, s1.Get(name), nil})
+		case DiffChangeModified:
+			ok = diffValues(fp, s1.Get(name), s2.Get(name), ch, stopCh)
+		}
+	}
+	return ok
+}
+
+// indexPathPart returns the PathPart that addresses |k| in a Map or Set.
+// Primitive values are spelled inline, anything else is addressed by hash.
+func indexPathPart(k Value) PathPart {
+	switch k.Type().Kind() {
+	case BoolKind, NumberKind, StringKind:
+		return NewIndexPath(k)
+	}
+	return NewHashIndexPath(k.Hash())
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func collectDifferences(older, newer Value) []Difference {
+	ch := make(chan Difference)
+	go func() {
+		DiffStream(older, newer, ch, nil)
+		close(ch)
+	}()
+	diffs := []Difference{}
+	for d := range ch {
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+func assertDifference(assert *assert.Assertions, d Difference, path string, ct DiffChangeType, oldV, newV Value) {
+	assert.Equal(path, d.Path.String())
+	assert.Equal(ct, d.ChangeType)
+	if oldV == nil {
+		assert.Nil(d.OldValue)
+	} else {
+		assert.True(oldV.Equals(d.OldValue))
+	}
+	if newV == nil {
+		assert.Nil(d.NewValue)
+	} else {
+		assert.True(newV.Equals(d.NewValue))
+	}
+}
+
+func TestDiffStreamPrimitives(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(collectDifferences(Number(1), Number(1)))
+
+	diffs := collectDifferences(Number(1), String("a"))
+	assert.Len(diffs, 1)
+	assertDifference(assert, diffs[0], "", DiffChangeModified, Number(1), String("a"))
+
+	diffs = collectDifferences(nil, Bool(true))
+	assert.Len(diffs, 1)
+	assertDifference(assert, diffs[0], "", DiffChangeAdded, nil, Bool(true))
+
+	diffs = collectDifferences(Bool(true), nil)
+	assert.Len(diffs, 1)
+	assertDifference(assert, diffs[0], "", DiffChangeRemoved, Bool(true), nil)
+}
+
+func TestDiffStreamNested(t *testing.T) {
+	assert := assert.New(t)
+
+	older := NewStruct("Person", StructData{
+		"name":   String("alice"),
+		"age":    Number(30),
+		"emails": NewList(String("a@x.com"), String("a@y.com")),
+		"tags":   NewMap(String("team"), String("red"), String("role"), String("dev")),
+	})
+	newer := NewStruct("Person", StructData{
+		"name":   String("alice"),
+		"email":  String("a@z.com"),
+		"emails": NewList(String("a@x.com"), String("a@w.com")),
+		"tags":   NewMap(String("team"), String("blue"), String("level"), Number(3)),
+	})
+
+	diffs := collectDifferences(older, newer)
+	assert.Len(diffs, 6)
+	assertDifference(assert, diffs[0], ".age", DiffChangeRemoved, Number(30), nil)
+	assertDifference(assert, diffs[1], ".email", DiffChangeAdded, nil, String("a@z.com"))
+	assertDifference(assert, diffs[2], ".emails[1]", DiffChangeModified, String("a@y.com"), String("a@w.com"))
+	assertDifference(assert, diffs[3], `.tags["level"]`, DiffChangeAdded, nil, Number(3))
+	assertDifference(assert, diffs[4], `.tags["role"]`, DiffChangeRemoved, String("dev"), nil)
+	assertDifference(assert, diffs[5], `.tags["team"]`, DiffChangeModified, String("red"), String("blue"))
+
+	for _, d := range diffs {
+		if d.ChangeType != DiffChangeAdded {
+			assert.True(d.OldValue.Equals(d.Path.Resolve(older)))
+		}
+		if d.ChangeType != DiffChangeRemoved {
+			assert.True(d.NewValue.Equals(d.Path.Resolve(newer)))
+		}
+	}
+}
+
+func TestDiffStreamListSplices(t *testing.T) {
+	assert := assert.New(t)
+
+	diffs := collectDifferences(NewList(Number(1), Number(2), Number(3)), NewList(Number(1), Number(4), Number(5), Number(3)))
+	assert.Len(diffs, 3)
+	assertDifference(assert, diffs[0], "[1]", DiffChangeRemoved, Number(2), nil)
+	assertDifference(assert, diffs[1], "[1]", DiffChangeAdded, nil, Number(4))
+	assertDifference(assert, diffs[2], "[2]", DiffChangeAdded, nil, Number(5))
+}
+
+func TestDiffStreamSetAndComplexKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	k := NewStruct("Key", StructData{"id": Number(1)})
+	s1, s2 := NewSet(Number(1), k), NewSet(Number(2), k)
+	diffs := collectDifferences(NewMap(k, s1), NewMap(k, s2))
+	assert.Len(diffs, 2)
+	for _, d := range diffs {
+		switch d.ChangeType {
+		case DiffChangeAdded:
+			assert.True(Number(2).Equals(d.Path.Resolve(NewMap(k, s2))))
+		case DiffChangeRemoved:
+			assert.True(Number(1).Equals(d.Path.Resolve(NewMap(k, s1))))
+		default:
+			assert.Fail("unexpected change type")
+		}
+	}
+}
+
+func TestDiffStreamLargeMapPrunes(t *testing.T) {
+	assert := assert.New(t)
+
+	kvs := []Value{}
+	for i := 0; i < 10000; i++ {
+		kvs = append(kvs, Number(i), NewList(Number(i)))
+	}
+	m1 := NewMap(kvs...)
+	m2 := m1.Set(Number(5000), NewList(Number(5000), Number(1)))
+
+	diffs := collectDifferences(m1, m2)
+	assert.Len(diffs, 1)
+	assertDifference(assert, diffs[0], "[5000][1]", DiffChangeAdded, nil, Number(1))
+}
+
+func TestDiffStreamStop(t *testing.T) {
+	assert := assert.New(t)
+
+	l1, l2 := []Value{}, []Value{}
+	for i := 0; i < 1000; i++ {
+		l1 = append(l1, Number(i))
+		l2 = append(l2, Number(i+1))
+	}
+
+	ch := make(chan Difference)
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		DiffStream(NewList(l1...), NewList(l2...), ch, stopCh)
+		close(done)
+	}()
+
+	<-ch
+	close(stopCh)
+	<-done
+	assert.True(true)
+}
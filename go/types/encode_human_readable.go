@@ -104,7 +104,7 @@ func (w *hrsWriter) Write(v Value) {
 
 	case BlobKind:
 		w.maybeWriteIndentation()
-		blob := v.(Blob)
+		blob := asBlob(v)
 		encoder := &hexWriter{hrs: w, size: blob.Len()}
 		_, w.err = io.Copy(encoder, blob.Reader())
 
@@ -167,6 +167,29 @@ func (w *hrsWriter) Write(v Value) {
 	case StructKind:
 		w.writeStruct(v.(Struct), true)
 
+	case CounterKind:
+		w.write(strconv.FormatFloat(float64(v.(Counter)), w.floatFormat, -1, 64))
+
+	case EncryptedKind:
+		e := v.(Encrypted)
+		w.write(fmt.Sprintf("key %d, %d bytes", e.keyID, len(e.data)))
+
+	case LWWRegisterKind:
+		r := v.(LWWRegister)
+		w.Write(r.Get())
+		w.write(" @ ")
+		w.write(strconv.FormatUint(r.Timestamp(), 10))
+
+	case TupleKind:
+		w.write("(")
+		v.(Tuple).IterAll(func(v Value, i uint64) {
+			if i != 0 {
+				w.write(", ")
+			}
+			w.Write(v)
+		})
+		w.write(")")
+
 	default:
 		panic("unreachable")
 	}
@@ -204,7 +227,7 @@ func (w *hrsWriter) WriteTagged(v Value) {
 	switch t.Kind() {
 	case BoolKind, NumberKind, StringKind:
 		w.Write(v)
-	case BlobKind, ListKind, MapKind, RefKind, SetKind, TypeKind, CycleKind:
+	case BlobKind, ListKind, MapKind, RefKind, SetKind, TupleKind, CounterKind, LWWRegisterKind, EncryptedKind, TypeKind, CycleKind:
 		w.writeType(t, nil)
 		w.write("(")
 		w.Write(v)
@@ -240,9 +263,9 @@ func (w *hrsWriter) writeSize(v Value) {
 
 func (w *hrsWriter) writeType(t *Type, parentStructTypes []*Type) {
 	switch t.Kind() {
-	case BlobKind, BoolKind, NumberKind, StringKind, TypeKind, ValueKind:
+	case BlobKind, BoolKind, NumberKind, StringKind, TypeKind, ValueKind, CounterKind, EncryptedKind:
 		w.write(KindToString[t.Kind()])
-	case ListKind, RefKind, SetKind, MapKind:
+	case ListKind, RefKind, SetKind, MapKind, TupleKind, LWWRegisterKind:
 		w.write(KindToString[t.Kind()])
 		w.write("<")
 		for i, et := range t.Desc.(CompoundDesc).ElemTypes {
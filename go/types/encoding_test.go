@@ -28,6 +28,14 @@ func (r *nomsTestReader) seek(pos uint32) {
 	r.i = int(pos)
 }
 
+func (r *nomsTestReader) skip(n uint32) {
+	r.i += int(n)
+}
+
+func (r *nomsTestReader) readCount() uint32 {
+	return r.readUint32()
+}
+
 func (r *nomsTestReader) readIdent(tc *TypeCache) uint32 {
 	s := r.readString()
 	id, ok := tc.identTable.entries[s]
@@ -133,7 +141,7 @@ func assertEncoding(t *testing.T, expect []interface{}, v Value) {
 	assert.EqualValues(t, expect, tw.a)
 
 	ir := &nomsTestReader{expect, 0}
-	dec := valueDecoder{ir, vs, staticTypeCache}
+	dec := valueDecoder{ir, vs, staticTypeCache, nil, 0}
 	v2 := dec.readValue()
 	assert.True(t, ir.atEnd())
 	assert.True(t, v.Equals(v2))
@@ -0,0 +1,126 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// Encrypted is a Value encrypted with AES-GCM, together with the id of the
+// key it was encrypted with, so that sensitive fields of a struct can be kept
+// in a database that others can read. Keys come from a chunks.KeyProvider,
+// as they do for an EncryptedStore, so keys can be rotated without
+// re-encrypting what's already been written.
+//
+// Each encryption uses a fresh nonce, so encrypting the same value twice gives
+// different Encrypteds, and nothing about a value can be learned from its
+// Encrypted but its size. Only values which don't refer to others can be
+// encrypted, since the chunks they refer to wouldn't be, and since Refs hidden
+// in ciphertext couldn't be followed, e.g. by Pull.
+//
+// Encrypteds are ordered by hash.
+type Encrypted struct {
+	keyID uint32
+	data  []byte // nonce | ciphertext
+	h     *hash.Hash
+}
+
+// Encrypt returns |v| encrypted with the current key of |kp|. It's an error
+// if v refers to other values.
+func Encrypt(v Value, kp chunks.KeyProvider) (Encrypted, error) {
+	hasRefs := false
+	v.WalkRefs(func(Ref) {
+		hasRefs = true
+	})
+	if hasRefs {
+		return Encrypted{}, fmt.Errorf("Can't encrypt a %s, because it refers to other values", v.Type().Describe())
+	}
+
+	id, key := kp.CurrentKey()
+	aead, err := newAEAD(key)
+	if err != nil {
+		return Encrypted{}, err
+	}
+	plaintext := EncodeValue(v, nil).Data()
+	data := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err = io.ReadFull(rand.Reader, data)
+	d.Chk.NoError(err)
+	return Encrypted{id, aead.Seal(data, data, plaintext, nil), &hash.Hash{}}, nil
+}
+
+// KeyID returns the id of the key e was encrypted with.
+func (e Encrypted) KeyID() uint32 {
+	return e.keyID
+}
+
+// Decrypt returns the Value that e is the encryption of, using the key of
+// |kp| it was encrypted with. It's an error if kp doesn't know the key, or if
+// e was encrypted with another key of the same id or has been tampered with.
+func (e Encrypted) Decrypt(kp chunks.KeyProvider) (Value, error) {
+	key, err := kp.Key(e.keyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.data) < aead.NonceSize() {
+		return nil, fmt.Errorf("Encrypted value is truncated")
+	}
+	nonce := e.data[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, e.data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt value with key %d", e.keyID)
+	}
+	return DecodeValue(chunks.NewChunk(plaintext), nil), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e Encrypted) hashPointer() *hash.Hash {
+	return e.h
+}
+
+// Value interface
+func (e Encrypted) Equals(other Value) bool {
+	return e.Hash() == other.Hash()
+}
+
+func (e Encrypted) Less(other Value) bool {
+	return valueLess(e, other)
+}
+
+func (e Encrypted) Hash() hash.Hash {
+	if e.h.IsEmpty() {
+		*e.h = getHash(e)
+	}
+
+	return *e.h
+}
+
+func (e Encrypted) WalkValues(cb ValueCallback) {
+}
+
+func (e Encrypted) WalkRefs(cb RefCallback) {
+}
+
+func (e Encrypted) Type() *Type {
+	return EncryptedType
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+)
+
+func TestEncrypted(t *testing.T) {
+	assert := assert.New(t)
+	key1, key2 := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 32)
+	kp := chunks.StaticKeyProvider{1: key1}
+
+	secret := NewStruct("Card", StructData{"number": String("4111 1111 1111 1111"), "cvc": Number(123)})
+	e, err := Encrypt(secret, kp)
+	assert.NoError(err)
+	assert.Equal(uint32(1), e.KeyID())
+	assert.True(EncryptedType.Equals(e.Type()))
+	assert.False(bytes.Contains(EncodeValue(e, nil).Data(), []byte("4111")))
+	v, err := e.Decrypt(kp)
+	assert.NoError(err)
+	assert.True(secret.Equals(v))
+
+	// Each encryption has its own nonce.
+	e2, err := Encrypt(secret, kp)
+	assert.NoError(err)
+	assert.False(e.Equals(e2))
+
+	// Encrypteds round trip, and can be decrypted after the key is rotated.
+	vs := NewTestValueStore()
+	r := vs.WriteValue(NewStruct("Customer", StructData{"name": String("Alice"), "card": e}))
+	read := vs.ReadValue(r.TargetHash()).(Struct).Get("card").(Encrypted)
+	assert.True(e.Equals(read))
+	kp[2] = key2
+	v, err = read.Decrypt(kp)
+	assert.NoError(err)
+	assert.True(secret.Equals(v))
+	e3, err := Encrypt(String("new"), kp)
+	assert.NoError(err)
+	assert.Equal(uint32(2), e3.KeyID())
+
+	_, err = read.Decrypt(chunks.StaticKeyProvider{2: key2})
+	assert.Error(err)
+	_, err = read.Decrypt(chunks.StaticKeyProvider{1: key2[:16]})
+	assert.Error(err)
+	tampered := Encrypted{read.keyID, append([]byte{}, read.data...), read.h}
+	tampered.data[len(tampered.data)-1] ^= 1
+	_, err = tampered.Decrypt(kp)
+	assert.Error(err)
+
+	_, err = Encrypt(NewList(vs.WriteValue(String("elsewhere"))), kp)
+	assert.Error(err)
+
+	assert.True(strings.HasPrefix(EncodedValueWithTags(e), "Encrypted(key 1, "))
+	assert.Equal("struct Customer {\n  card: Encrypted,\n  name: String,\n}", vs.ReadValue(r.TargetHash()).Type().Describe())
+}
@@ -13,15 +13,21 @@ func sendSpliceChange(changes chan<- Splice, closeChan <-chan struct{}, splice S
 	return true
 }
 
-func indexedSequenceDiff(last sequence, lastHeight int, lastOffset uint64, current sequence, currentHeight int, currentOffset uint64, changes chan<- Splice, closeChan <-chan struct{}, maxSpliceMatrixSize uint64) bool {
+// indexedSequenceDiff sends the Splices which turn |last| into |current| to |changes|. If |chunkAligned| is true, it doesn't compare the items of leaf sequences, but reports the leaf chunks that differ as whole, so that each Splice covers whole chunks.
+func indexedSequenceDiff(last sequence, lastHeight int, lastOffset uint64, current sequence, currentHeight int, currentOffset uint64, changes chan<- Splice, closeChan <-chan struct{}, maxSpliceMatrixSize uint64, chunkAligned bool) bool {
+	if chunkAligned && (lastHeight == 1 || currentHeight == 1) {
+		// A leaf chunk can't share anything with another sequence but the whole of it.
+		return sendSpliceChange(changes, closeChan, Splice{lastOffset, last.numLeaves(), current.numLeaves(), currentOffset})
+	}
+
 	if lastHeight > currentHeight {
 		lastChild := last.(metaSequence).getCompositeChildSequence(0, uint64(last.seqLen()))
-		return indexedSequenceDiff(lastChild, lastHeight-1, lastOffset, current, currentHeight, currentOffset, changes, closeChan, maxSpliceMatrixSize)
+		return indexedSequenceDiff(lastChild, lastHeight-1, lastOffset, current, currentHeight, currentOffset, changes, closeChan, maxSpliceMatrixSize, chunkAligned)
 	}
 
 	if currentHeight > lastHeight {
 		currentChild := current.(metaSequence).getCompositeChildSequence(0, uint64(current.seqLen()))
-		return indexedSequenceDiff(last, lastHeight, lastOffset, currentChild, currentHeight-1, currentOffset, changes, closeChan, maxSpliceMatrixSize)
+		return indexedSequenceDiff(last, lastHeight, lastOffset, currentChild, currentHeight-1, currentOffset, changes, closeChan, maxSpliceMatrixSize, chunkAligned)
 	}
 
 	compareFn := last.getCompareFn(current)
@@ -45,8 +51,8 @@ func indexedSequenceDiff(last sequence, lastHeight int, lastOffset uint64, curre
 		lastMeta := last.(metaSequence)
 		currentMeta := current.(metaSequence)
 
-		if splice.SpRemoved == 0 || splice.SpAdded == 0 {
-			// An entire subtree was removed at a meta level. We must do some math to map the splice from the meta level into the leaf coordinates.
+		if splice.SpRemoved == 0 || splice.SpAdded == 0 || (chunkAligned && lastHeight == 2) {
+			// An entire subtree was removed at a meta level, or the leaf chunks are to be reported whole. We must do some math to map the splice from the meta level into the leaf coordinates.
 			beginRemoveIndex := uint64(0)
 			if splice.SpAt > 0 {
 				beginRemoveIndex = lastMeta.cumulativeNumberOfLeaves(int(splice.SpAt) - 1)
@@ -89,7 +95,7 @@ func indexedSequenceDiff(last sequence, lastHeight int, lastOffset uint64, curre
 		if splice.SpFrom > 0 {
 			currentChildOffset += currentMeta.cumulativeNumberOfLeaves(int(splice.SpFrom) - 1)
 		}
-		if ok := indexedSequenceDiff(lastChild, lastHeight-1, lastChildOffset, currentChild, currentHeight-1, currentChildOffset, changes, closeChan, maxSpliceMatrixSize); !ok {
+		if ok := indexedSequenceDiff(lastChild, lastHeight-1, lastChildOffset, currentChild, currentHeight-1, currentChildOffset, changes, closeChan, maxSpliceMatrixSize, chunkAligned); !ok {
 			return false
 		}
 	}
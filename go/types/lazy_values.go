@@ -0,0 +1,53 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import "sync"
+
+// lazyValues is a run of values, e.g. the fields of a Struct or the elements of a List leaf, as they're encoded in the chunk they were read from. Each value is only decoded the first time it's read, so that reading one field of a wide struct doesn't allocate all of the others. Chunk data is never modified once it's made, so lazyValues refers to it rather than copying it, which means that a value decoded lazily keeps the chunk it came from in memory for as long as it's reachable.
+type lazyValues struct {
+	mu      sync.Mutex
+	data    []byte
+	offsets []uint32 // where each value starts in data, and where the last one ends
+	values  ValueSlice
+	vr      ValueReader
+	tc      *TypeCache
+}
+
+func (lv *lazyValues) len() int {
+	return len(lv.offsets) - 1
+}
+
+// get returns the |i|th value, decoding it if it hasn't been read before.
+func (lv *lazyValues) get(i int) Value {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	if lv.values == nil {
+		lv.values = make(ValueSlice, lv.len())
+	}
+	if lv.values[i] == nil {
+		lv.tc.Lock()
+		// Unlocked by a defer, so that a value that can't be decoded doesn't leave the TypeCache locked.
+		defer lv.tc.Unlock()
+		dec := newValueDecoder(&binaryNomsReader{lv.data, lv.offsets[i]}, lv.vr, lv.tc)
+		dec.data = lv.data
+		lv.values[i] = dec.readValue()
+	}
+	return lv.values[i]
+}
+
+// all returns all of the values, decoding those that haven't been read before.
+func (lv *lazyValues) all() ValueSlice {
+	values := make(ValueSlice, lv.len())
+	for i := range values {
+		values[i] = lv.get(i)
+	}
+	return values
+}
+
+// encoded returns the values as they're encoded, one after the other, so that they can be written out again without decoding them.
+func (lv *lazyValues) encoded() []byte {
+	return lv.data[lv.offsets[0]:lv.offsets[lv.len()]]
+}
@@ -268,7 +268,7 @@ func (l List) DiffWithLimit(last List, changes chan<- Splice, closeChan <-chan s
 
 	lastCur := newCursorAtIndex(last.seq, 0)
 	lCur := newCursorAtIndex(l.seq, 0)
-	indexedSequenceDiff(last.seq, lastCur.depth(), 0, l.seq, lCur.depth(), 0, changes, closeChan, maxSpliceMatrixSize)
+	indexedSequenceDiff(last.seq, lastCur.depth(), 0, l.seq, lCur.depth(), 0, changes, closeChan, maxSpliceMatrixSize, false)
 }
 
 func (l List) newChunker(cur *sequenceCursor, vr ValueReader) *sequenceChunker {
@@ -7,6 +7,7 @@ package types
 type listLeafSequence struct {
 	leafSequence
 	values []Value
+	lazy   *lazyValues // the elements, if the sequence was decoded from a chunk, in which case values is nil
 }
 
 func newListLeafSequence(vr ValueReader, v ...Value) sequence {
@@ -15,7 +16,23 @@ func newListLeafSequence(vr ValueReader, v ...Value) sequence {
 		ts[i] = v.Type()
 	}
 	t := MakeListType(MakeUnionType(ts...))
-	return listLeafSequence{leafSequence{vr, len(v), t}, v}
+	return listLeafSequence{leafSequence{vr, len(v), t}, v, nil}
+}
+
+// item returns the |idx|th element, decoding it if the sequence was decoded lazily.
+func (ll listLeafSequence) item(idx int) Value {
+	if ll.lazy != nil {
+		return ll.lazy.get(idx)
+	}
+	return ll.values[idx]
+}
+
+// items returns all of the elements.
+func (ll listLeafSequence) items() ValueSlice {
+	if ll.lazy != nil {
+		return ll.lazy.all()
+	}
+	return ll.values
 }
 
 // sequence interface
@@ -23,16 +40,16 @@ func newListLeafSequence(vr ValueReader, v ...Value) sequence {
 func (ll listLeafSequence) getCompareFn(other sequence) compareFn {
 	oll := other.(listLeafSequence)
 	return func(idx, otherIdx int) bool {
-		return ll.values[idx].Equals(oll.values[otherIdx])
+		return ll.item(idx).Equals(oll.item(otherIdx))
 	}
 }
 
 func (ll listLeafSequence) getItem(idx int) sequenceItem {
-	return ll.values[idx]
+	return ll.item(idx)
 }
 
 func (ll listLeafSequence) WalkRefs(cb RefCallback) {
-	for _, v := range ll.values {
+	for _, v := range ll.items() {
 		v.WalkRefs(cb)
 	}
 }
@@ -280,6 +280,69 @@ func TestStreamingListCreation(t *testing.T) {
 	})
 }
 
+func TestStreamingListEncodesChunksConcurrently(t *testing.T) {
+	smallTestChunks()
+	defer normalProductionChunks()
+
+	if testing.Short() {
+		t.Skip("Skipping test in short mode.")
+	}
+	assert := assert.New(t)
+
+	cs := chunks.NewTestStore()
+	vs := newLocalValueStore(cs)
+	simpleList := getTestList()
+
+	valueChan := make(chan Value)
+	listChan := NewStreamingList(vs, valueChan)
+	for _, v := range simpleList {
+		valueChan <- v
+	}
+	close(valueChan)
+	sl := <-listChan
+	assert.True(NewList(simpleList...).Equals(sl))
+
+	// Each chunk was written after the chunks it refers to, so the list can be written and read back from another ValueStore.
+	r := vs.WriteValue(sl)
+	vs.Flush()
+	rl := newLocalValueStore(cs).ReadValue(r.TargetHash()).(List)
+	assert.Equal(sl.Len(), rl.Len())
+	rl.IterAll(func(v Value, idx uint64) {
+		assert.True(simpleList[idx].Equals(v))
+	})
+}
+
+func TestStreamingListOfUnwrittenLists(t *testing.T) {
+	smallTestChunks()
+	defer normalProductionChunks()
+
+	if testing.Short() {
+		t.Skip("Skipping test in short mode.")
+	}
+	assert := assert.New(t)
+
+	cs := chunks.NewTestStore()
+	vs := newLocalValueStore(cs)
+	// inner is chunked, but its chunks are only written when a list holding it is.
+	inner := NewList(generateNumbersAsValues(2000)...)
+	assert.True(hasUnwrittenChunks(inner))
+
+	valueChan := make(chan Value)
+	listChan := NewStreamingList(vs, valueChan)
+	for i := 0; i < 300; i++ {
+		valueChan <- inner
+	}
+	close(valueChan)
+	sl := <-listChan
+
+	r := vs.WriteValue(sl)
+	vs.Flush()
+	rl := newLocalValueStore(cs).ReadValue(r.TargetHash()).(List)
+	assert.Equal(uint64(300), rl.Len())
+	assert.True(inner.Equals(rl.Get(299)))
+	assert.Equal(inner.Len(), rl.Get(299).(List).Len())
+}
+
 func TestListAppend(t *testing.T) {
 	smallTestChunks()
 	defer normalProductionChunks()
@@ -0,0 +1,95 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// LWWRegister is a last-writer-wins register: a single Value tagged with the
+// timestamp at which it was written. When two writers concurrently set a
+// register, the merged value is the one with the later timestamp, so merging
+// registers never conflicts. Timestamps are opaque to Noms; callers typically
+// use wall clock time in nanoseconds, or a logical clock. Ties are broken by
+// picking the value with the greater hash, which makes merge deterministic
+// regardless of which side is considered first.
+//
+// The type of a LWWRegister is LWWRegister<T> where T is the type of its
+// Value.
+type LWWRegister struct {
+	value     Value
+	timestamp uint64
+	t         *Type
+	h         *hash.Hash
+}
+
+// NewLWWRegister creates a LWWRegister holding |v|, written at |timestamp|.
+func NewLWWRegister(v Value, timestamp uint64) LWWRegister {
+	d.PanicIfTrue(v == nil, "LWWRegister value cannot be nil")
+	return LWWRegister{v, timestamp, MakeLWWRegisterType(v.Type()), &hash.Hash{}}
+}
+
+// Get returns the current value of the register.
+func (r LWWRegister) Get() Value {
+	return r.value
+}
+
+// Timestamp returns the timestamp at which the current value was written.
+func (r LWWRegister) Timestamp() uint64 {
+	return r.timestamp
+}
+
+// Set returns a LWWRegister holding |v|, written at |timestamp|.
+func (r LWWRegister) Set(v Value, timestamp uint64) LWWRegister {
+	return NewLWWRegister(v, timestamp)
+}
+
+// Merge returns whichever of r and |other| was written last.
+func (r LWWRegister) Merge(other LWWRegister) LWWRegister {
+	if r.timestamp != other.timestamp {
+		if r.timestamp > other.timestamp {
+			return r
+		}
+		return other
+	}
+	if other.value.Hash().Less(r.value.Hash()) {
+		return r
+	}
+	return other
+}
+
+func (r LWWRegister) hashPointer() *hash.Hash {
+	return r.h
+}
+
+// Value interface
+func (r LWWRegister) Equals(other Value) bool {
+	return r.Hash() == other.Hash()
+}
+
+func (r LWWRegister) Less(other Value) bool {
+	return valueLess(r, other)
+}
+
+func (r LWWRegister) Hash() hash.Hash {
+	if r.h.IsEmpty() {
+		*r.h = getHash(r)
+	}
+
+	return *r.h
+}
+
+func (r LWWRegister) WalkValues(cb ValueCallback) {
+	cb(r.value)
+}
+
+func (r LWWRegister) WalkRefs(cb RefCallback) {
+	r.value.WalkRefs(cb)
+}
+
+func (r LWWRegister) Type() *Type {
+	return r.t
+}
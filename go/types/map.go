@@ -242,6 +242,60 @@ func (m Map) IterFrom(start Value, cb mapIterCallback) {
 	})
 }
 
+// IterPrefix calls |cb| in order for every entry whose key is a Tuple having
+// |prefix| as a prefix. Because a Tuple sorts immediately before all Tuples it
+// is a prefix of, this is a range scan beginning at |prefix|.
+func (m Map) IterPrefix(prefix Tuple, cb mapIterCallback) {
+	m.IterFrom(prefix, func(key, value Value) bool {
+		if t, ok := key.(Tuple); !ok || !t.HasPrefix(prefix) {
+			return true
+		}
+		return cb(key, value)
+	})
+}
+
+// CountRange returns the number of entries whose keys are at least |start|
+// and less than |end|. A nil start counts from the first entry, and a nil end
+// to the last. It reads only the chunks on the way down to start and end,
+// since the number of entries under each chunk is kept in its parent.
+func (m Map) CountRange(start, end Value) uint64 {
+	lo, hi := uint64(0), m.Len()
+	if start != nil {
+		lo = indexOfKey(m.seq, newOrderedKey(start))
+	}
+	if end != nil {
+		hi = indexOfKey(m.seq, newOrderedKey(end))
+	}
+	if hi < lo {
+		return 0
+	}
+	return hi - lo
+}
+
+// Children returns the Maps of the chunks one level down the prolly tree of
+// m, in order, together with the last key of each, or nil for the keys of
+// those whose keys are ordered by hash, not value. They're nil if m is a
+// single chunk. Since a chunk's Map is the same wherever it's part of a
+// bigger one, anything worked out from its entries can be cached by its hash,
+// and reused for later versions of m that share it.
+func (m Map) Children() (children []Map, lastKeys []Value) {
+	ms, ok := m.seq.(metaSequence)
+	if !ok {
+		return nil, nil
+	}
+	for _, mt := range ms.tuples {
+		child := newMap(mt.getChildSequence(ms.vr).(orderedSequence))
+		*child.h = mt.ref.TargetHash()
+		var last Value
+		if mt.key.isOrderedByValue {
+			last = mt.key.v
+		}
+		children = append(children, child)
+		lastKeys = append(lastKeys, last)
+	}
+	return
+}
+
 func (m Map) elemTypes() []*Type {
 	return m.Type().Desc.(CompoundDesc).ElemTypes
 }
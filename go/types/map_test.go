@@ -1254,3 +1254,66 @@ func TestMapIterFrom(t *testing.T) {
 	assert.True(kvs[0:0].Equals(test(m1, Number(100), Number(1000))))
 	assert.True(kvs[50:60].Equals(test(m1, Number(0), Number(8))))
 }
+
+func TestMapChildren(t *testing.T) {
+	assert := assert.New(t)
+
+	children, lastKeys := NewMap(Number(1), Number(2)).Children()
+	assert.Nil(children)
+	assert.Nil(lastKeys)
+
+	vs := NewTestValueStore()
+	kvs := generateNumbersAsValuesFromToBy(0, 5000, 1)
+	m := vs.ReadValue(vs.WriteValue(NewMap(kvs...)).TargetHash()).(Map)
+	children, lastKeys = m.Children()
+	assert.True(len(children) > 1)
+	assert.Equal(len(children), len(lastKeys))
+	entries, n := ValueSlice{}, uint64(0)
+	for i, c := range children {
+		last, _ := c.Last()
+		assert.True(last.Equals(lastKeys[i]))
+		assert.Equal(getHash(c), c.Hash())
+		c.IterAll(func(k, v Value) {
+			entries = append(entries, k, v)
+		})
+		n += c.Len()
+	}
+	assert.Equal(m.Len(), n)
+	assert.True(kvs.Equals(entries))
+
+	// Keys ordered by hash have no last key.
+	m = NewMap()
+	for i := 0; !isMetaSequence(m.sequence()); i++ {
+		m = m.Set(NewStruct("", StructData{"n": Number(i)}), Number(i))
+	}
+	_, lastKeys = m.Children()
+	assert.Nil(lastKeys[len(lastKeys)-1])
+}
+
+func TestMapCountRange(t *testing.T) {
+	assert := assert.New(t)
+
+	vs := NewTestValueStore()
+	kvs := ValueSlice{}
+	for i := 0; i < 5000; i++ {
+		kvs = append(kvs, Number(i), Number(i))
+	}
+	m := vs.ReadValue(vs.WriteValue(NewMap(kvs...)).TargetHash()).(Map)
+	assert.True(isMetaSequence(m.sequence()))
+
+	assert.Equal(uint64(5000), m.CountRange(nil, nil))
+	assert.Equal(uint64(100), m.CountRange(Number(100), Number(200)))
+	assert.Equal(uint64(100), m.CountRange(Number(99.5), Number(199.5)))
+	assert.Equal(uint64(4900), m.CountRange(Number(100), nil))
+	assert.Equal(uint64(100), m.CountRange(nil, Number(100)))
+	assert.Equal(uint64(5000), m.CountRange(Number(-10), Number(1e6)))
+	assert.Equal(uint64(0), m.CountRange(Number(200), Number(100)))
+	assert.Equal(uint64(0), m.CountRange(Number(6000), nil))
+	// Strings sort after Numbers.
+	assert.Equal(uint64(5000), m.CountRange(Number(0), String("a")))
+	assert.Equal(uint64(0), NewMap().CountRange(nil, nil))
+
+	small := NewMap(String("a"), Number(1), String("b"), Number(2), String("c"), Number(3))
+	assert.Equal(uint64(2), small.CountRange(String("a"), String("c")))
+	assert.Equal(uint64(1), small.CountRange(String("bb"), nil))
+}
@@ -173,6 +173,7 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 	metaItems := []metaTuple{}
 	mapItems := []mapEntry{}
 	valueItems := []Value{}
+	byteItems := []byte{}
 
 	childIsMeta := false
 	isIndexedSequence := false
@@ -193,7 +194,9 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 		case setLeafSequence:
 			valueItems = append(valueItems, t.data...)
 		case listLeafSequence:
-			valueItems = append(valueItems, t.values...)
+			valueItems = append(valueItems, t.items()...)
+		case blobLeafSequence:
+			byteItems = append(byteItems, t.data...)
 		default:
 			panic("unreachable")
 		}
@@ -207,6 +210,10 @@ func (ms metaSequence) getCompositeChildSequence(start uint64, length uint64) se
 		return newListLeafSequence(ms.vr, valueItems...)
 	}
 
+	if BlobKind == ms.Type().Kind() {
+		return newBlobLeafSequence(ms.vr, byteItems)
+	}
+
 	if MapKind == ms.Type().Kind() {
 		return newMapLeafSequence(ms.vr, mapItems...)
 	}
@@ -23,6 +23,10 @@ const (
 	TypeKind
 	CycleKind // Only used in encoding/decoding.
 	UnionKind
+	TupleKind
+	CounterKind
+	LWWRegisterKind
+	EncryptedKind
 )
 
 // IsPrimitiveKind returns true if k represents a Noms primitive type, which excludes collections (List, Map, Set), Refs, Structs, Symbolic and Unresolved types.
@@ -37,5 +41,5 @@ func IsPrimitiveKind(k NomsKind) bool {
 
 // isKindOrderedByValue determines if a value is ordered by its value instead of its hash.
 func isKindOrderedByValue(k NomsKind) bool {
-	return k <= StringKind
+	return k <= StringKind || k == TupleKind
 }
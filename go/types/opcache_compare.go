@@ -86,7 +86,8 @@ func compareEncodedKey(a, b []byte) int {
 	//   NomsKind(1-byte) + hash digest(20-bytes)
 
 	aKind, bKind := NomsKind(a[0]), NomsKind(b[0])
-	if !isKindOrderedByValue(aKind) && !isKindOrderedByValue(bKind) {
+	aByValue, bByValue := isKindOrderedByValue(aKind), isKindOrderedByValue(bKind)
+	if !aByValue && !bByValue {
 		a, b := a[1:], b[1:]
 		d.PanicIfFalse(len(a) == hash.ByteLen && len(b) == hash.ByteLen)
 		res := bytes.Compare(a, b)
@@ -94,15 +95,23 @@ func compareEncodedKey(a, b []byte) int {
 		return res
 	}
 
-	// Now, we know that at least one of a and b is ordered by value. So if the
-	// kinds are different, we can sort just by comparing them.
+	// Values ordered by value always sort before values ordered by hash.
+	if aByValue != bByValue {
+		if aByValue {
+			return -1
+		}
+		return 1
+	}
+
+	// Now, we know that both a and b are ordered by value. So if the kinds are
+	// different, we can sort just by comparing them.
 	if res := compareKinds(aKind, bKind); res != 0 {
 		return res
 	}
 
 	// Now we know that we are comparing two values that are both Bools, Numbers,
-	// or Strings. Extract their length and create slices that just contain their
-	// Noms encodings.
+	// Strings or Tuples. Extract their length and create slices that just
+	// contain their Noms encodings.
 	lenA := binary.BigEndian.Uint32(a[1:5])
 	lenB := binary.BigEndian.Uint32(b[1:5])
 
@@ -141,6 +150,11 @@ func compareEncodedNomsValues(a, b []byte) int {
 	case StringKind:
 		res := bytes.Compare(a[1+uint32Size:], b[1+uint32Size:])
 		return res
+	case TupleKind:
+		// Tuple elements may be of any kind, so there's no shortcut here.
+		aTuple := DecodeFromBytes(a, nil, staticTypeCache).(Tuple)
+		bTuple := DecodeFromBytes(b, nil, staticTypeCache).(Tuple)
+		return aTuple.compare(bTuple)
 	}
 	panic("unreachable")
 }
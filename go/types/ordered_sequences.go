@@ -88,6 +88,27 @@ func seekTo(cur *sequenceCursor, key orderedKey, lastPositionIfNotFound bool) bo
 	return cur.idx < seq.seqLen()
 }
 
+// indexOfKey returns the number of items of |seq| whose keys are less than |key|. Since each metaTuple records the number of items under it, only the chunks on the way down to key are read.
+func indexOfKey(seq orderedSequence, key orderedKey) uint64 {
+	idx := uint64(0)
+	for {
+		i := sort.Search(seq.seqLen(), func(i int) bool {
+			return !seq.getKey(i).Less(key)
+		})
+		ms, ok := seq.(metaSequence)
+		if !ok {
+			return idx + uint64(i)
+		}
+		if i > 0 {
+			idx += ms.cumulativeNumberOfLeaves(i - 1)
+		}
+		if i == ms.seqLen() {
+			return idx
+		}
+		seq = ms.getChildSequence(i).(orderedSequence)
+	}
+}
+
 // Gets the key used for ordering the sequence at current index.
 func getCurrentKey(cur *sequenceCursor) orderedKey {
 	seq, ok := cur.seq.(orderedSequence)
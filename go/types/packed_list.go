@@ -0,0 +1,383 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// blobBacked is implemented by Values which are persisted as Blobs.
+type blobBacked interface {
+	Blob() Blob
+}
+
+// asBlob returns |v|, which must be of BlobKind, as a Blob.
+func asBlob(v Value) Blob {
+	if b, ok := v.(Blob); ok {
+		return b
+	}
+	return v.(blobBacked).Blob()
+}
+
+// packedList stores fixed width elements contiguously in a Blob.
+type packedList struct {
+	b     Blob
+	width uint64
+}
+
+func newPackedListFromBlob(b Blob, width uint64) packedList {
+	d.PanicIfFalse(b.Len()%width == 0, "Blob length %d is not a multiple of %d", b.Len(), width)
+	return packedList{b, width}
+}
+
+func (pl packedList) len() uint64 {
+	return pl.b.Len() / pl.width
+}
+
+func (pl packedList) get(idx uint64) []byte {
+	d.PanicIfFalse(idx < pl.len(), "Index out of range: %d", idx)
+	r := pl.b.Reader()
+	_, err := r.Seek(int64(idx*pl.width), 0)
+	d.Chk.NoError(err)
+	buf := make([]byte, pl.width)
+	_, err = io.ReadFull(r, buf)
+	d.Chk.NoError(err)
+	return buf
+}
+
+func (pl packedList) iter(cb func(buf []byte, idx uint64) bool) {
+	r := bufio.NewReader(pl.b.Reader())
+	buf := make([]byte, pl.width)
+	for i := uint64(0); i < pl.len(); i++ {
+		_, err := io.ReadFull(r, buf)
+		d.Chk.NoError(err)
+		if cb(buf, i) {
+			return
+		}
+	}
+}
+
+func (pl packedList) splice(idx, deleteCount uint64, data []byte) packedList {
+	d.PanicIfFalse(idx+deleteCount <= pl.len(), "Splice out of range")
+	return packedList{pl.b.Splice(idx*pl.width, deleteCount*pl.width, data), pl.width}
+}
+
+// Float64List is a packed list of float64s. Float64List, Int64List and
+// ByteList store their elements contiguously in fixed width little-endian form
+// inside a Blob, rather than as boxed Number Values, so they are chunked,
+// deduplicated and synced like any other Blob, at a fraction of the memory and
+// encoded size of the equivalent List of Numbers.
+//
+// Packed lists are Values, and can be stored anywhere a Value can. They are
+// persisted as Blobs, so reading one back from a ValueReader yields a Blob;
+// use Float64ListFromBlob() to view it as a packed list again.
+type Float64List struct {
+	pl packedList
+}
+
+func encodeFloat64s(vs []float64) []byte {
+	data := make([]byte, len(vs)*8)
+	for i, v := range vs {
+		binary.LittleEndian.PutUint64(data[i*8:], math.Float64bits(v))
+	}
+	return data
+}
+
+// NewFloat64List creates a Float64List containing |vs|.
+func NewFloat64List(vs ...float64) Float64List {
+	return Float64List{packedList{NewBlob(bytes.NewReader(encodeFloat64s(vs))), 8}}
+}
+
+// Float64ListFromBlob returns a view of |b| as a Float64List. It panics if the
+// length of |b| isn't a multiple of 8.
+func Float64ListFromBlob(b Blob) Float64List {
+	return Float64List{newPackedListFromBlob(b, 8)}
+}
+
+// Blob returns the Blob backing the list.
+func (l Float64List) Blob() Blob {
+	return l.pl.b
+}
+
+func (l Float64List) Len() uint64 {
+	return l.pl.len()
+}
+
+func (l Float64List) Empty() bool {
+	return l.Len() == 0
+}
+
+func (l Float64List) Get(idx uint64) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(l.pl.get(idx)))
+}
+
+// Iter calls |cb| for each element in order, until |cb| returns true.
+func (l Float64List) Iter(cb func(v float64, idx uint64) (stop bool)) {
+	l.pl.iter(func(buf []byte, idx uint64) bool {
+		return cb(math.Float64frombits(binary.LittleEndian.Uint64(buf)), idx)
+	})
+}
+
+func (l Float64List) Set(idx uint64, v float64) Float64List {
+	return Float64List{l.pl.splice(idx, 1, encodeFloat64s([]float64{v}))}
+}
+
+func (l Float64List) Append(vs ...float64) Float64List {
+	return l.Insert(l.Len(), vs...)
+}
+
+func (l Float64List) Insert(idx uint64, vs ...float64) Float64List {
+	return Float64List{l.pl.splice(idx, 0, encodeFloat64s(vs))}
+}
+
+func (l Float64List) Remove(start, end uint64) Float64List {
+	d.PanicIfFalse(start <= end)
+	return Float64List{l.pl.splice(start, end-start, nil)}
+}
+
+// ToList returns the elements of l as a List of Numbers.
+func (l Float64List) ToList() List {
+	vs := make([]Value, 0, l.Len())
+	l.Iter(func(v float64, idx uint64) bool {
+		vs = append(vs, Number(v))
+		return false
+	})
+	return NewList(vs...)
+}
+
+// Value interface
+func (l Float64List) hashPointer() *hash.Hash {
+	return l.pl.b.hashPointer()
+}
+
+func (l Float64List) Equals(other Value) bool {
+	return l.pl.b.Equals(other)
+}
+
+func (l Float64List) Less(other Value) bool {
+	return l.pl.b.Less(other)
+}
+
+func (l Float64List) Hash() hash.Hash {
+	return l.pl.b.Hash()
+}
+
+func (l Float64List) WalkValues(cb ValueCallback) {
+	l.pl.b.WalkValues(cb)
+}
+
+func (l Float64List) WalkRefs(cb RefCallback) {
+	l.pl.b.WalkRefs(cb)
+}
+
+func (l Float64List) Type() *Type {
+	return l.pl.b.Type()
+}
+
+// Int64List is a packed list of int64s. See Float64List.
+type Int64List struct {
+	pl packedList
+}
+
+func encodeInt64s(vs []int64) []byte {
+	data := make([]byte, len(vs)*8)
+	for i, v := range vs {
+		binary.LittleEndian.PutUint64(data[i*8:], uint64(v))
+	}
+	return data
+}
+
+// NewInt64List creates an Int64List containing |vs|.
+func NewInt64List(vs ...int64) Int64List {
+	return Int64List{packedList{NewBlob(bytes.NewReader(encodeInt64s(vs))), 8}}
+}
+
+// Int64ListFromBlob returns a view of |b| as an Int64List. It panics if the
+// length of |b| isn't a multiple of 8.
+func Int64ListFromBlob(b Blob) Int64List {
+	return Int64List{newPackedListFromBlob(b, 8)}
+}
+
+// Blob returns the Blob backing the list.
+func (l Int64List) Blob() Blob {
+	return l.pl.b
+}
+
+func (l Int64List) Len() uint64 {
+	return l.pl.len()
+}
+
+func (l Int64List) Empty() bool {
+	return l.Len() == 0
+}
+
+func (l Int64List) Get(idx uint64) int64 {
+	return int64(binary.LittleEndian.Uint64(l.pl.get(idx)))
+}
+
+// Iter calls |cb| for each element in order, until |cb| returns true.
+func (l Int64List) Iter(cb func(v int64, idx uint64) (stop bool)) {
+	l.pl.iter(func(buf []byte, idx uint64) bool {
+		return cb(int64(binary.LittleEndian.Uint64(buf)), idx)
+	})
+}
+
+func (l Int64List) Set(idx uint64, v int64) Int64List {
+	return Int64List{l.pl.splice(idx, 1, encodeInt64s([]int64{v}))}
+}
+
+func (l Int64List) Append(vs ...int64) Int64List {
+	return l.Insert(l.Len(), vs...)
+}
+
+func (l Int64List) Insert(idx uint64, vs ...int64) Int64List {
+	return Int64List{l.pl.splice(idx, 0, encodeInt64s(vs))}
+}
+
+func (l Int64List) Remove(start, end uint64) Int64List {
+	d.PanicIfFalse(start <= end)
+	return Int64List{l.pl.splice(start, end-start, nil)}
+}
+
+// ToList returns the elements of l as a List of Numbers.
+func (l Int64List) ToList() List {
+	vs := make([]Value, 0, l.Len())
+	l.Iter(func(v int64, idx uint64) bool {
+		vs = append(vs, Number(v))
+		return false
+	})
+	return NewList(vs...)
+}
+
+// Value interface
+func (l Int64List) hashPointer() *hash.Hash {
+	return l.pl.b.hashPointer()
+}
+
+func (l Int64List) Equals(other Value) bool {
+	return l.pl.b.Equals(other)
+}
+
+func (l Int64List) Less(other Value) bool {
+	return l.pl.b.Less(other)
+}
+
+func (l Int64List) Hash() hash.Hash {
+	return l.pl.b.Hash()
+}
+
+func (l Int64List) WalkValues(cb ValueCallback) {
+	l.pl.b.WalkValues(cb)
+}
+
+func (l Int64List) WalkRefs(cb RefCallback) {
+	l.pl.b.WalkRefs(cb)
+}
+
+func (l Int64List) Type() *Type {
+	return l.pl.b.Type()
+}
+
+// ByteList is a packed list of bytes. See Float64List.
+type ByteList struct {
+	pl packedList
+}
+
+// NewByteList creates a ByteList containing |vs|.
+func NewByteList(vs ...byte) ByteList {
+	return ByteList{packedList{NewBlob(bytes.NewReader(vs)), 1}}
+}
+
+// ByteListFromBlob returns a view of |b| as a ByteList.
+func ByteListFromBlob(b Blob) ByteList {
+	return ByteList{newPackedListFromBlob(b, 1)}
+}
+
+// Blob returns the Blob backing the list.
+func (l ByteList) Blob() Blob {
+	return l.pl.b
+}
+
+func (l ByteList) Len() uint64 {
+	return l.pl.len()
+}
+
+func (l ByteList) Empty() bool {
+	return l.Len() == 0
+}
+
+func (l ByteList) Get(idx uint64) byte {
+	return l.pl.get(idx)[0]
+}
+
+// Iter calls |cb| for each element in order, until |cb| returns true.
+func (l ByteList) Iter(cb func(v byte, idx uint64) (stop bool)) {
+	l.pl.iter(func(buf []byte, idx uint64) bool {
+		return cb(buf[0], idx)
+	})
+}
+
+func (l ByteList) Set(idx uint64, v byte) ByteList {
+	return ByteList{l.pl.splice(idx, 1, []byte{v})}
+}
+
+func (l ByteList) Append(vs ...byte) ByteList {
+	return l.Insert(l.Len(), vs...)
+}
+
+func (l ByteList) Insert(idx uint64, vs ...byte) ByteList {
+	return ByteList{l.pl.splice(idx, 0, vs)}
+}
+
+func (l ByteList) Remove(start, end uint64) ByteList {
+	d.PanicIfFalse(start <= end)
+	return ByteList{l.pl.splice(start, end-start, nil)}
+}
+
+// ToList returns the elements of l as a List of Numbers.
+func (l ByteList) ToList() List {
+	vs := make([]Value, 0, l.Len())
+	l.Iter(func(v byte, idx uint64) bool {
+		vs = append(vs, Number(v))
+		return false
+	})
+	return NewList(vs...)
+}
+
+// Value interface
+func (l ByteList) hashPointer() *hash.Hash {
+	return l.pl.b.hashPointer()
+}
+
+func (l ByteList) Equals(other Value) bool {
+	return l.pl.b.Equals(other)
+}
+
+func (l ByteList) Less(other Value) bool {
+	return l.pl.b.Less(other)
+}
+
+func (l ByteList) Hash() hash.Hash {
+	return l.pl.b.Hash()
+}
+
+func (l ByteList) WalkValues(cb ValueCallback) {
+	l.pl.b.WalkValues(cb)
+}
+
+func (l ByteList) WalkRefs(cb RefCallback) {
+	l.pl.b.WalkRefs(cb)
+}
+
+func (l ByteList) Type() *Type {
+	return l.pl.b.Type()
+}
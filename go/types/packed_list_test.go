@@ -0,0 +1,72 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestFloat64List(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewFloat64List(1.5, -2, 3.25)
+	assert.Equal(uint64(3), l.Len())
+	assert.Equal(1.5, l.Get(0))
+	assert.Equal(-2.0, l.Get(1))
+	assert.Equal(3.25, l.Get(2))
+	assert.Panics(func() { l.Get(3) })
+
+	l2 := l.Append(4).Set(0, 0).Remove(1, 2).Insert(1, 7)
+	vs := []float64{}
+	l2.Iter(func(v float64, idx uint64) bool {
+		vs = append(vs, v)
+		return false
+	})
+	assert.Equal([]float64{0, 7, 3.25, 4}, vs)
+	assert.True(NewList(Number(0), Number(7), Number(3.25), Number(4)).Equals(l2.ToList()))
+	assert.Equal(uint64(3), l.Len())
+
+	assert.True(BlobType.Equals(l.Type()))
+	assert.True(l.Equals(NewFloat64List(1.5, -2, 3.25)))
+	assert.Panics(func() { Float64ListFromBlob(NewByteList(1, 2, 3).Blob()) })
+}
+
+func TestInt64ListAndByteList(t *testing.T) {
+	assert := assert.New(t)
+
+	il := NewInt64List(-1, 1<<40).Append(3)
+	assert.Equal(uint64(3), il.Len())
+	assert.Equal(int64(-1), il.Get(0))
+	assert.Equal(int64(1<<40), il.Get(1))
+	assert.Equal(int64(3), il.Get(2))
+
+	bl := NewByteList(1, 2, 3).Set(1, 255)
+	assert.Equal(uint64(3), bl.Len())
+	assert.Equal(byte(255), bl.Get(1))
+	assert.True(NewList(Number(1), Number(255), Number(3)).Equals(bl.ToList()))
+}
+
+func TestPackedListRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := NewTestValueStore()
+
+	data := make([]float64, 10000)
+	for i := range data {
+		data[i] = float64(i) / 3
+	}
+	l := NewFloat64List(data...)
+	s := NewStruct("Series", StructData{"points": l})
+	r := vs.WriteValue(s)
+	vs.Flush()
+
+	s2 := vs.ReadValue(r.TargetHash()).(Struct)
+	assert.True(s.Equals(s2))
+	l2 := Float64ListFromBlob(s2.Get("points").(Blob))
+	assert.Equal(uint64(len(data)), l2.Len())
+	assert.Equal(data[1234], l2.Get(1234))
+	assert.Equal(data[9999], l2.Get(9999))
+}
@@ -110,6 +110,12 @@ func (p Path) Resolve(v Value) (resolved Value) {
 	return
 }
 
+// ResolveE is like Resolve, but returns an error rather than panicking if reading the values along p fails, as when they're in a database that can't be reached or is corrupt.
+func (p Path) ResolveE(v Value) (resolved Value, err error) {
+	err = d.TryAll(func() { resolved = p.Resolve(v) })
+	return
+}
+
 func (p Path) String() string {
 	strs := make([]string, 0, len(p))
 	for _, part := range p {
@@ -142,7 +148,7 @@ func (fp FieldPath) String() string {
 	return fmt.Sprintf(".%s", fp.Name)
 }
 
-// Indexes into Maps and Lists by key or index.
+// Indexes into Maps and Lists by key or index, or into Sets by value.
 type IndexPath struct {
 	// The value of the index, e.g. `[42]` or `["value"]`.
 	Index Value
@@ -189,6 +195,11 @@ func (ip IndexPath) Resolve(v Value) Value {
 		if !ip.IntoKey {
 			return v.Get(ip.Index)
 		}
+
+	case Set:
+		if v.Has(ip.Index) {
+			return ip.Index
+		}
 	}
 
 	return nil
@@ -271,6 +282,10 @@ func (hip HashIndexPath) String() string {
 // true|false -> types.Boolean
 // #<chars> ->   hash.Hash
 func ParsePathIndex(str string) (idx Value, h hash.Hash, rem string, err error) {
+	if len(str) == 0 {
+		err = errors.New("Empty index value")
+		return
+	}
 Switch:
 	switch str[0] {
 	case '"':
@@ -317,8 +332,8 @@ Switch:
 			idx = Bool(true)
 		} else if idxStr == "false" {
 			idx = Bool(false)
-		} else if i, err2 := strconv.ParseFloat(idxStr, 64); err2 == nil {
-			// Should we be more strict here? ParseFloat allows leading and trailing dots, and exponents.
+		} else if i, err2 := strconv.ParseFloat(idxStr, 64); err2 == nil && !math.IsNaN(i) && !math.IsInf(i, 0) {
+			// Should we be more strict here? ParseFloat allows leading and trailing dots, and exponents. It also allows NaN and Inf, which aren't Numbers.
 			idx = Number(i)
 		} else {
 			err = errors.New("Invalid index: " + idxStr)
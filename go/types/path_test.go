@@ -91,6 +91,13 @@ func TestPathIndex(t *testing.T) {
 	resolvesTo(Number(23), Bool(false), "[false]")
 	resolvesTo(Number(4.5), Number(2.3), "[2.3]")
 	resolvesTo(nil, Number(4), "[4]")
+
+	v = NewSet(Number(1), String("two"), Bool(false))
+
+	resolvesTo(Number(1), Number(1), "[1]")
+	resolvesTo(String("two"), String("two"), `["two"]`)
+	resolvesTo(Bool(false), Bool(false), "[false]")
+	resolvesTo(nil, Number(4), "[4]")
 }
 
 func TestPathHashIndex(t *testing.T) {
@@ -291,4 +298,32 @@ func TestPathParseErrors(t *testing.T) {
 	test("@foo", "Invalid operator: @")
 	test("@key", "Invalid operator: @")
 	test(fmt.Sprintf(".foo[#%s]@soup", hash.FromData([]byte{42}).String()), "Unsupported annotation: @soup")
+	test(".foo[NaN]", "Invalid index: NaN")
+	test(".foo[-Inf]", "Invalid index: -Inf")
+	test(".foo[1e400]", "Invalid index: 1e400")
+
+	_, _, _, err := ParsePathIndex("")
+	assert.Error(err)
+}
+
+// FuzzParsePath checks that parsing arbitrary paths, as typed by users, fails with an error rather than panicking, and that whatever parses can be written out again.
+func FuzzParsePath(f *testing.F) {
+	for _, str := range []string{
+		".foo",
+		".foo[0].bar[4.5][false]",
+		`["qu\\ote\""]@key`,
+		`["[[br][]acke]]ts"]`,
+		fmt.Sprintf(".foo[#%s]@key", Number(42).Hash().String()),
+		".foo[",
+		`.foo["\`,
+	} {
+		f.Add(str)
+	}
+
+	f.Fuzz(func(t *testing.T, str string) {
+		p, err := ParsePath(str)
+		if err == nil {
+			_ = p.String()
+		}
+	})
 }
@@ -6,6 +6,7 @@ package types
 
 import (
 	"sort"
+	"sync"
 
 	"github.com/stormasm/noms/go/hash"
 )
@@ -71,11 +72,38 @@ func (h *RefByHeight) Unique() {
 
 // PopRefsOfHeight pops off and returns all refs r in h for which r.Height() == height.
 func (h *RefByHeight) PopRefsOfHeight(height uint64) (refs RefSlice) {
+	return h.AppendRefsOfHeight(nil, height)
+}
+
+// AppendRefsOfHeight is like PopRefsOfHeight, but appends the refs it pops off to |refs|, so that callers that pop refs over and over can reuse the same slice.
+func (h *RefByHeight) AppendRefsOfHeight(refs RefSlice, height uint64) RefSlice {
 	for h.MaxHeight() == height {
 		r := h.PopBack()
 		refs = append(refs, r)
 	}
-	return
+	return refs
+}
+
+// Reset empties h, keeping the memory it's already allocated to be reused.
+func (h *RefByHeight) Reset() {
+	old := *h
+	for i := range old {
+		old[i] = Ref{}
+	}
+	*h = old[:0]
+}
+
+var refByHeightPool = sync.Pool{New: func() interface{} { return &RefByHeight{} }}
+
+// GetRefByHeight returns an empty RefByHeight from a pool of them, which may have memory allocated already. Graph walks that are done over and over, e.g. by FindCommonAncestor, use it to cut down on garbage, and give it back with PutRefByHeight once they're done with it.
+func GetRefByHeight() *RefByHeight {
+	return refByHeightPool.Get().(*RefByHeight)
+}
+
+// PutRefByHeight empties |h| and returns it to the pool GetRefByHeight takes from. |h| mustn't be used afterwards.
+func PutRefByHeight(h *RefByHeight) {
+	h.Reset()
+	refByHeightPool.Put(h)
 }
 
 // MaxHeight returns the height of the 'tallest' Ref in h.
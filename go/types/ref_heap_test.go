@@ -104,3 +104,29 @@ func TestPopRefsOfHeight(t *testing.T) {
 		assert.NotContains(t, *h, popped, "Should not contain ref of height 6")
 	}
 }
+
+func TestRefByHeightReset(t *testing.T) {
+	assert := assert.New(t)
+
+	h := GetRefByHeight()
+	assert.True(h.Empty())
+	for i := 0; i < 10; i++ {
+		r := NewRef(Number(i))
+		r.height = uint64(i % 3)
+		h.PushBack(r)
+	}
+	sort.Sort(h)
+
+	refs := h.AppendRefsOfHeight(RefSlice{}, 2)
+	assert.Len(refs, 3)
+	refs = h.AppendRefsOfHeight(refs[:0], 1)
+	assert.Len(refs, 3)
+	assert.Equal(uint64(1), refs[0].Height())
+
+	c := cap(*h)
+	h.Reset()
+	assert.True(h.Empty())
+	assert.Equal(c, cap(*h))
+	assert.Equal(Ref{}, (*h)[:1][0])
+	PutRefByHeight(h)
+}
@@ -4,7 +4,12 @@
 
 package types
 
-import "github.com/stormasm/noms/go/d"
+import (
+	"runtime"
+
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/d"
+)
 
 type hashValueBytesFn func(item sequenceItem, rv *rollingValueHasher)
 
@@ -19,8 +24,30 @@ type sequenceChunker struct {
 	hashValueBytes             hashValueBytesFn
 	rv                         *rollingValueHasher
 	done                       bool
+	// If vw is an encodedValueWriter, the chunks the chunker makes are encoded and hashed concurrently, and pending holds those that haven't been written and appended to parent yet, in order.
+	pending []*pendingChunk
+}
+
+// encodedValueWriter is implemented by ValueWriters, i.e. ValueStore, that can write a value that's already been encoded.
+type encodedValueWriter interface {
+	writeEncodedValue(v Value, c chunks.Chunk) Ref
 }
 
+// pendingChunk is a chunk made by a sequenceChunker, which is being encoded and hashed by a worker.
+type pendingChunk struct {
+	col       Collection
+	key       orderedKey
+	numLeaves uint64
+	c         chunks.Chunk
+	done      chan struct{}
+}
+
+// encodeSlots limits how many chunks are encoded and hashed at once, across all sequenceChunkers.
+var encodeSlots = make(chan struct{}, runtime.NumCPU())
+
+// maxPendingChunks is how many chunks a sequenceChunker has encoded ahead of the last one it wrote, before it waits for them.
+var maxPendingChunks = 2 * runtime.NumCPU()
+
 // makeChunkFn takes a sequence of items to chunk, and returns the result of chunking those items, a tuple of a reference to that chunk which can itself be chunked + its underlying value.
 type makeChunkFn func(values []sequenceItem) (Collection, orderedKey, uint64)
 
@@ -45,6 +72,7 @@ func newSequenceChunker(cur *sequenceCursor, vr ValueReader, vw ValueWriter, mak
 		hashValueBytes,
 		newRollingValueHasher(),
 		false,
+		nil,
 	}
 
 	if cur != nil {
@@ -182,6 +210,15 @@ func (sc *sequenceChunker) createSequence() (sequence, metaTuple) {
 func (sc *sequenceChunker) handleChunkBoundary() {
 	d.Chk.NotEmpty(sc.current)
 
+	if _, ok := sc.vw.(encodedValueWriter); ok {
+		sc.encodeSequence()
+		if sc.parent == nil {
+			sc.createParent()
+		}
+		sc.writePending(len(sc.pending) > maxPendingChunks)
+		return
+	}
+
 	_, mt := sc.createSequence()
 	if sc.parent == nil {
 		sc.createParent()
@@ -189,9 +226,69 @@ func (sc *sequenceChunker) handleChunkBoundary() {
 	sc.parent.Append(mt)
 }
 
+// encodeSequence makes a chunk of the items in |current|, like createSequence, and hands it to a worker to encode and hash, which is what writing a chunk mostly costs, so that the chunker can carry on with the next one.
+func (sc *sequenceChunker) encodeSequence() {
+	col, key, numLeaves := sc.makeChunk(sc.current)
+	pc := &pendingChunk{col: col, key: key, numLeaves: numLeaves, done: make(chan struct{})}
+	sc.pending = append(sc.pending, pc)
+	sc.current = []sequenceItem{}
+
+	if hasUnwrittenChunks(col) {
+		// An item holds a collection whose chunks haven't been written, e.g. a big List made with NewList(), so col is encoded here, where its ValueWriter writes them.
+		pc.c = EncodeValue(col, sc.vw)
+		close(pc.done)
+		return
+	}
+	go func() {
+		encodeSlots <- struct{}{}
+		pc.c = EncodeValue(pc.col, nil)
+		<-encodeSlots
+		close(pc.done)
+	}()
+}
+
+// hasUnwrittenChunks returns true if |v| is, or holds, a chunked collection whose child chunks haven't been written yet, which encoding v with a ValueWriter would write.
+func hasUnwrittenChunks(v Value) bool {
+	if col, ok := v.(Collection); ok {
+		if ms, ok := col.sequence().(metaSequence); ok {
+			for i := 0; i < ms.seqLen(); i++ {
+				if ms.getItem(i).(metaTuple).child != nil {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	found := false
+	v.WalkValues(func(c Value) {
+		found = found || hasUnwrittenChunks(c)
+	})
+	return found
+}
+
+// writePending writes the chunks in |pending| that have been encoded, oldest first, and appends them to the parent, stopping at the first that hasn't been encoded yet, unless |wait| is set, in which case it waits for all of them. Chunks are written in the order they were made, so that the chunks a chunk refers to are always written before it is.
+func (sc *sequenceChunker) writePending(wait bool) {
+	for len(sc.pending) > 0 {
+		pc := sc.pending[0]
+		if wait {
+			<-pc.done
+		} else {
+			select {
+			case <-pc.done:
+			default:
+				return
+			}
+		}
+		ref := sc.vw.(encodedValueWriter).writeEncodedValue(pc.col, pc.c)
+		sc.pending[0] = nil
+		sc.pending = sc.pending[1:]
+		sc.parent.Append(newMetaTuple(ref, pc.key, pc.numLeaves, nil))
+	}
+}
+
 // Returns true if this chunker or any of its parents have any pending items in their |current| slice.
 func (sc *sequenceChunker) anyPending() bool {
-	if len(sc.current) > 0 {
+	if len(sc.current) > 0 || len(sc.pending) > 0 {
 		return true
 	}
 
@@ -210,12 +307,14 @@ func (sc *sequenceChunker) Done() sequence {
 	if sc.cur != nil {
 		sc.finalizeCursor()
 	}
+	sc.writePending(true)
 
 	// There is pending content above us, so we must push any remaining items from this level up and allow some parent to find the root of the resulting tree.
 	if sc.parent != nil && sc.parent.anyPending() {
 		if len(sc.current) > 0 {
 			// If there are items in |current| at this point, they represent the final items of the sequence which occurred beyond the previous *explicit* chunk boundary. The end of input of a sequence is considered an *implicit* boundary.
 			sc.handleChunkBoundary()
+			sc.writePending(true)
 		}
 
 		return sc.parent.Done()
@@ -16,12 +16,13 @@ import (
 )
 
 var EmptyStructType = MakeStructType("", []string{}, []*Type{})
-var EmptyStruct = Struct{ValueSlice{}, EmptyStructType, &hash.Hash{}}
+var EmptyStruct = Struct{ValueSlice{}, nil, EmptyStructType, &hash.Hash{}}
 
 type StructData map[string]Value
 
 type Struct struct {
 	values []Value
+	lazy   *lazyValues // the values of the fields, if the struct was decoded from a chunk, in which case values is nil
 	t      *Type
 	h      *hash.Hash
 }
@@ -42,7 +43,7 @@ func NewStruct(name string, data StructData) Struct {
 		values[i] = data[fn]
 	}
 
-	return Struct{values, MakeStructType(name, fieldNames, fieldTypes), &hash.Hash{}}
+	return Struct{values, nil, MakeStructType(name, fieldNames, fieldTypes), &hash.Hash{}}
 }
 
 func NewStructWithType(t *Type, data ValueSlice) Struct {
@@ -52,7 +53,23 @@ func NewStructWithType(t *Type, data ValueSlice) Struct {
 		v := data[i]
 		assertSubtype(field.t, v)
 	}
-	return Struct{data, t, &hash.Hash{}}
+	return Struct{data, nil, t, &hash.Hash{}}
+}
+
+// fieldValue returns the value of the |i|th field, decoding it if the struct was decoded lazily.
+func (s Struct) fieldValue(i int) Value {
+	if s.lazy != nil {
+		return s.lazy.get(i)
+	}
+	return s.values[i]
+}
+
+// fieldValues returns the values of all of the fields, in the order of the fields of the struct's type.
+func (s Struct) fieldValues() ValueSlice {
+	if s.lazy != nil {
+		return s.lazy.all()
+	}
+	return s.values
 }
 
 func (s Struct) hashPointer() *hash.Hash {
@@ -77,13 +94,13 @@ func (s Struct) Hash() hash.Hash {
 }
 
 func (s Struct) WalkValues(cb ValueCallback) {
-	for _, v := range s.values {
+	for _, v := range s.fieldValues() {
 		cb(v)
 	}
 }
 
 func (s Struct) WalkRefs(cb RefCallback) {
-	for _, v := range s.values {
+	for _, v := range s.fieldValues() {
 		v.WalkRefs(cb)
 	}
 
@@ -104,7 +121,7 @@ func (s Struct) MaybeGet(n string) (Value, bool) {
 	if i == -1 {
 		return nil, false
 	}
-	return s.values[i], true
+	return s.fieldValue(i), true
 }
 
 // Get returns the value of a field in the struct. If the struct does not a have a field with the
@@ -114,7 +131,7 @@ func (s Struct) Get(n string) Value {
 	if i == -1 {
 		d.Chk.Fail(fmt.Sprintf(`Struct has no field "%s"`, n))
 	}
-	return s.values[i]
+	return s.fieldValue(i)
 }
 
 // Set returns a new struct where the field name has been set to value. If name is not an
@@ -122,20 +139,21 @@ func (s Struct) Get(n string) Value {
 // struct field a new struct type is created.
 func (s Struct) Set(n string, v Value) Struct {
 	f, i := s.desc().findField(n)
+	current := s.fieldValues()
 	if i == -1 || !IsSubtype(f.t, v.Type()) {
 		// New/change field
-		data := make(StructData, len(s.values)+1)
+		data := make(StructData, len(current)+1)
 		for i, f := range s.desc().fields {
-			data[f.name] = s.values[i]
+			data[f.name] = current[i]
 		}
 		data[n] = v
 		return NewStruct(s.desc().Name, data)
 	}
 
-	values := make([]Value, len(s.values))
-	copy(values, s.values)
+	values := make([]Value, len(current))
+	copy(values, current)
 	values[i] = v
-	return Struct{values, s.t, &hash.Hash{}}
+	return Struct{values, nil, s.t, &hash.Hash{}}
 }
 
 func (s Struct) Diff(last Struct, changes chan<- ValueChanged, closeChan <-chan struct{}) {
@@ -150,7 +168,7 @@ func (s Struct) Diff(last Struct, changes chan<- ValueChanged, closeChan <-chan
 
 		var change ValueChanged
 		if fn1 == fn2 {
-			if !s.values[i1].Equals(last.values[i2]) {
+			if !s.fieldValue(i1).Equals(last.fieldValue(i2)) {
 				change = ValueChanged{ChangeType: DiffChangeModified, V: String(fn1)}
 			}
 			i1++
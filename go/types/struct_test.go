@@ -5,6 +5,7 @@
 package types
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/attic-labs/testify/assert"
@@ -204,3 +205,42 @@ func TestCycles(t *testing.T) {
 	rootInode := NewStruct("Inode", StructData{"contents": rootDir})
 	NewStructWithType(fsType, ValueSlice{rootInode})
 }
+
+func TestStructDecodesFieldsLazily(t *testing.T) {
+	assert := assert.New(t)
+
+	data := StructData{}
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprintf("f%d", i)] = NewStruct("Field", StructData{"s": String(fmt.Sprintf("field %d", i))})
+	}
+	data["l"] = NewList(Number(0), Number(1), String("two"))
+	st := NewStruct("Wide", data)
+	c := EncodeValue(st, nil)
+
+	s := DecodeValue(c, nil).(Struct)
+	assert.Equal(String("field 42"), s.Get("f42").(Struct).Get("s"))
+	decoded := 0
+	for _, v := range s.lazy.values {
+		if v != nil {
+			decoded++
+		}
+	}
+	assert.Equal(1, decoded)
+	l := s.Get("l").(List)
+	assert.Equal(String("two"), l.Get(2))
+
+	// Values that haven't been decoded are written out as they were read.
+	assert.Equal(c.Data(), EncodeValue(s, nil).Data())
+	assert.True(st.Equals(s))
+	assert.True(st.Equals(DecodeValue(c, nil)))
+	assert.True(s.Set("f1", String("x")).Equals(st.Set("f1", String("x"))))
+	assert.Equal(getChunks(st), getChunks(s))
+
+	eager := testing.AllocsPerRun(10, func() {
+		DecodeFromBytes(c.Data(), nil, staticTypeCache).(Struct).Get("f42")
+	})
+	lazy := testing.AllocsPerRun(10, func() {
+		DecodeValue(c, nil).(Struct).Get("f42")
+	})
+	assert.True(lazy*10 < eager, "lazy: %v, eager: %v", lazy, eager)
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+)
+
+// Tuple is a fixed length, ordered sequence of Values. Unlike other compound
+// values, Tuples are ordered by value rather than by hash: two Tuples compare
+// lexicographically, element by element, and a Tuple that is a prefix of
+// another sorts before it. This makes Tuples suitable as multi-column Map keys
+// (e.g. (userID, timestamp)) which can be range-scanned by key prefix using
+// Map.IterPrefix().
+//
+// In the total ordering of Noms values, Tuples sort after Strings and before
+// all values that are ordered by hash.
+type Tuple struct {
+	values ValueSlice
+	t      *Type
+	h      *hash.Hash
+}
+
+// NewTuple creates a Tuple from |vs|. The type of the Tuple is
+// Tuple<T0, T1, ...> where Tn is the type of the n-th element.
+func NewTuple(vs ...Value) Tuple {
+	values := make(ValueSlice, len(vs))
+	elemTypes := make([]*Type, len(vs))
+	for i, v := range vs {
+		d.PanicIfTrue(v == nil, "Tuple elements cannot be nil")
+		values[i] = v
+		elemTypes[i] = v.Type()
+	}
+	return Tuple{values, MakeTupleType(elemTypes...), &hash.Hash{}}
+}
+
+func (t Tuple) hashPointer() *hash.Hash {
+	return t.h
+}
+
+// Value interface
+func (t Tuple) Equals(other Value) bool {
+	return t.Hash() == other.Hash()
+}
+
+func (t Tuple) Less(other Value) bool {
+	if t2, ok := other.(Tuple); ok {
+		return t.compare(t2) < 0
+	}
+	switch other.Type().Kind() {
+	case BoolKind, NumberKind, StringKind:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t Tuple) Hash() hash.Hash {
+	if t.h.IsEmpty() {
+		*t.h = getHash(t)
+	}
+
+	return *t.h
+}
+
+func (t Tuple) WalkValues(cb ValueCallback) {
+	for _, v := range t.values {
+		cb(v)
+	}
+}
+
+func (t Tuple) WalkRefs(cb RefCallback) {
+	for _, v := range t.values {
+		v.WalkRefs(cb)
+	}
+}
+
+func (t Tuple) Type() *Type {
+	return t.t
+}
+
+// Len returns the number of elements in the Tuple.
+func (t Tuple) Len() uint64 {
+	return uint64(len(t.values))
+}
+
+// Get returns the element at |idx|. It panics if |idx| is out of range.
+func (t Tuple) Get(idx uint64) Value {
+	d.PanicIfFalse(idx < t.Len(), "Tuple index out of range: %d", idx)
+	return t.values[idx]
+}
+
+// IterAll calls |cb| with each element of the Tuple, in order.
+func (t Tuple) IterAll(cb func(v Value, idx uint64)) {
+	for i, v := range t.values {
+		cb(v, uint64(i))
+	}
+}
+
+// Append returns a new Tuple with |vs| added to the end of t.
+func (t Tuple) Append(vs ...Value) Tuple {
+	values := make(ValueSlice, 0, len(t.values)+len(vs))
+	values = append(values, t.values...)
+	return NewTuple(append(values, vs...)...)
+}
+
+// HasPrefix returns true if the first prefix.Len() elements of t are equal to
+// the elements of |prefix|. Every Tuple has the empty Tuple as a prefix.
+func (t Tuple) HasPrefix(prefix Tuple) bool {
+	if len(prefix.values) > len(t.values) {
+		return false
+	}
+	for i, v := range prefix.values {
+		if !v.Equals(t.values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare returns -1, 0 or 1 depending on whether t sorts before, the same as
+// or after |other|.
+func (t Tuple) compare(other Tuple) int {
+	for i := 0; i < len(t.values) && i < len(other.values); i++ {
+		a, b := t.values[i], other.values[i]
+		if a.Less(b) {
+			return -1
+		}
+		if b.Less(a) {
+			return 1
+		}
+	}
+	switch {
+	case len(t.values) < len(other.values):
+		return -1
+	case len(t.values) > len(other.values):
+		return 1
+	}
+	return 0
+}
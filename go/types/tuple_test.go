@@ -0,0 +1,164 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestTupleBasics(t *testing.T) {
+	assert := assert.New(t)
+
+	tup := NewTuple(String("user"), Number(42))
+	assert.Equal(uint64(2), tup.Len())
+	assert.True(String("user").Equals(tup.Get(0)))
+	assert.True(Number(42).Equals(tup.Get(1)))
+	assert.Panics(func() { tup.Get(2) })
+
+	assert.True(MakeTupleType(StringType, NumberType).Equals(tup.Type()))
+	assert.True(tup.Equals(NewTuple(String("user"), Number(42))))
+	assert.False(tup.Equals(NewTuple(Number(42), String("user"))))
+
+	tup2 := tup.Append(Bool(true))
+	assert.Equal(uint64(3), tup2.Len())
+	assert.Equal(uint64(2), tup.Len())
+	assert.True(tup2.HasPrefix(tup))
+	assert.True(tup2.HasPrefix(NewTuple()))
+	assert.False(tup.HasPrefix(tup2))
+	assert.False(tup2.HasPrefix(NewTuple(String("other"))))
+}
+
+func TestTupleOrdering(t *testing.T) {
+	assert := assert.New(t)
+
+	// values in increasing order.
+	values := ValueSlice{
+		Bool(true),
+		Number(10),
+		String("z"),
+		NewTuple(),
+		NewTuple(Number(1)),
+		NewTuple(Number(1), String("a")),
+		NewTuple(Number(1), String("b")),
+		NewTuple(Number(2)),
+		NewTuple(String("a"), Number(1)),
+		NewTuple(NewTuple(Number(1)), Number(1)),
+	}
+
+	for i, vi := range values {
+		for j, vj := range values {
+			assert.Equal(i < j, vi.Less(vj), "%s < %s", EncodedValue(vi), EncodedValue(vj))
+		}
+	}
+
+	// Hash ordered values always sort after Tuples.
+	l := NewList(Number(1))
+	assert.True(NewTuple(Number(1)).Less(l))
+	assert.False(l.Less(NewTuple(Number(1))))
+}
+
+func TestTupleRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	vs := NewTestValueStore()
+
+	tup := NewTuple(String("k"), Number(1), NewList(Number(2)), NewTuple(Bool(false)))
+	r := vs.WriteValue(tup)
+	v := vs.ReadValue(r.TargetHash())
+	assert.True(tup.Equals(v))
+	assert.True(tup.Type().Equals(v.Type()))
+	assert.Equal(EncodedValue(tup), EncodedValue(v))
+}
+
+func TestTupleEncodeHumanReadable(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`(1, "a")`, EncodedValue(NewTuple(Number(1), String("a"))))
+	assert.Equal("()", EncodedValue(NewTuple()))
+	assert.Equal("Tuple<Number, String>", EncodedValue(MakeTupleType(NumberType, StringType)))
+	assert.Equal(`Tuple<Bool>((true))`, EncodedValueWithTags(NewTuple(Bool(true))))
+}
+
+func TestTupleSubtype(t *testing.T) {
+	assert := assert.New(t)
+
+	tup := NewTuple(Number(1), String("a"))
+	assert.True(IsSubtype(MakeTupleType(NumberType, StringType), tup.Type()))
+	assert.True(IsSubtype(MakeTupleType(ValueType, StringType), tup.Type()))
+	assert.False(IsSubtype(MakeTupleType(NumberType), tup.Type()))
+	assert.False(IsSubtype(MakeTupleType(NumberType, StringType, BoolType), tup.Type()))
+}
+
+func TestMapTupleKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	kvs := []Value{}
+	for user := 0; user < 10; user++ {
+		for ts := 0; ts < 100; ts++ {
+			kvs = append(kvs, NewTuple(Number(user), Number(ts)), Number(user*ts))
+		}
+	}
+	m := NewMap(kvs...)
+	assert.Equal(uint64(1000), m.Len())
+
+	k, _ := m.First()
+	assert.True(NewTuple(Number(0), Number(0)).Equals(k))
+	k, _ = m.Last()
+	assert.True(NewTuple(Number(9), Number(99)).Equals(k))
+	assert.True(Number(15).Equals(m.Get(NewTuple(Number(3), Number(5)))))
+
+	count := 0
+	m.IterPrefix(NewTuple(Number(7)), func(k, v Value) bool {
+		tup := k.(Tuple)
+		assert.True(Number(7).Equals(tup.Get(0)))
+		assert.True(Number(count).Equals(tup.Get(1)))
+		count++
+		return false
+	})
+	assert.Equal(100, count)
+
+	count = 0
+	m.IterPrefix(NewTuple(Number(7), Number(50)), func(k, v Value) bool {
+		count++
+		return false
+	})
+	assert.Equal(1, count)
+
+	count = 0
+	m.IterPrefix(NewTuple(Number(70)), func(k, v Value) bool {
+		count++
+		return false
+	})
+	assert.Equal(0, count)
+}
+
+func TestCompareEncodedTuples(t *testing.T) {
+	assert := assert.New(t)
+	vrw := NewTestValueStore()
+	defer vrw.Close()
+
+	blob := NewBlob(bytes.NewBuffer([]byte{1, 2, 3}))
+	vals := ValueSlice{
+		String("hello"),
+		NewTuple(Number(1), String("b")),
+		NewTuple(Number(1), String("a")),
+		NewTuple(Number(1)),
+		blob,
+		NewList(Number(1)),
+	}
+	sort.Sort(vals)
+
+	for i, v1 := range vals {
+		for j, v2 := range vals {
+			iBytes := [1024]byte{}
+			jBytes := [1024]byte{}
+			res := compareEncodedKey(encodeGraphKey(iBytes[:0], v1, vrw), encodeGraphKey(jBytes[:0], v2, vrw))
+			assert.Equal(compareInts(i, j), res)
+		}
+	}
+}
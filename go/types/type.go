@@ -16,7 +16,7 @@ import (
 //     specializations, field descriptions for structs, etc. Either way, checking Kind() allows code
 //     to understand how to interpret the rest of the data.
 // If Kind() refers to a primitive, then Desc has no more info.
-// If Kind() refers to List, Map, Ref, Set, or Union, then Desc is a list of Types describing the element type(s).
+// If Kind() refers to List, Map, Ref, Set, Tuple or Union, then Desc is a list of Types describing the element type(s).
 // If Kind() refers to Struct, then Desc contains a []field.
 
 type Type struct {
@@ -123,6 +123,10 @@ func MakePrimitiveType(k NomsKind) *Type {
 		return ValueType
 	case TypeKind:
 		return TypeType
+	case CounterKind:
+		return CounterType
+	case EncryptedKind:
+		return EncryptedType
 	}
 	d.Chk.Fail("invalid NomsKind: %d", k)
 	return nil
@@ -142,6 +146,10 @@ func MakePrimitiveTypeByString(p string) *Type {
 		return ValueType
 	case "Type":
 		return TypeType
+	case "Counter":
+		return CounterType
+	case "Encrypted":
+		return EncryptedType
 	}
 	d.Chk.Fail("invalid type string: %s", p)
 	return nil
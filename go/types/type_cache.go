@@ -31,18 +31,22 @@ var StringType = makePrimitiveType(StringKind)
 var BlobType = makePrimitiveType(BlobKind)
 var TypeType = makePrimitiveType(TypeKind)
 var ValueType = makePrimitiveType(ValueKind)
+var CounterType = makePrimitiveType(CounterKind)
+var EncryptedType = makePrimitiveType(EncryptedKind)
 
 func NewTypeCache() *TypeCache {
 	return &TypeCache{
 		newIdentTable(),
 		map[NomsKind]*typeTrie{
-			ListKind:   newTypeTrie(),
-			SetKind:    newTypeTrie(),
-			RefKind:    newTypeTrie(),
-			MapKind:    newTypeTrie(),
-			StructKind: newTypeTrie(),
-			CycleKind:  newTypeTrie(),
-			UnionKind:  newTypeTrie(),
+			ListKind:        newTypeTrie(),
+			SetKind:         newTypeTrie(),
+			RefKind:         newTypeTrie(),
+			MapKind:         newTypeTrie(),
+			StructKind:      newTypeTrie(),
+			CycleKind:       newTypeTrie(),
+			UnionKind:       newTypeTrie(),
+			TupleKind:       newTypeTrie(),
+			LWWRegisterKind: newTypeTrie(),
 		},
 		256, // The first 255 type ids are reserved for the 8bit space of NomsKinds.
 		&sync.Mutex{},
@@ -261,7 +265,7 @@ func encodeForOID(t *Type, buf nomsWriter, allowUnresolvedCycles bool, root *Typ
 		buf.writeUint8(uint8(desc.Kind()))
 	case CompoundDesc:
 		switch k := desc.Kind(); k {
-		case ListKind, MapKind, RefKind, SetKind:
+		case ListKind, MapKind, RefKind, SetKind, TupleKind, LWWRegisterKind:
 			buf.writeUint8(uint8(k))
 			buf.writeUint32(uint32(len(desc.ElemTypes)))
 			for _, tt := range desc.ElemTypes {
@@ -383,6 +387,18 @@ func MakeMapType(keyType, valType *Type) *Type {
 	return staticTypeCache.getCompoundType(MapKind, keyType, valType)
 }
 
+func MakeTupleType(elemTypes ...*Type) *Type {
+	staticTypeCache.Lock()
+	defer staticTypeCache.Unlock()
+	return staticTypeCache.getCompoundType(TupleKind, elemTypes...)
+}
+
+func MakeLWWRegisterType(elemType *Type) *Type {
+	staticTypeCache.Lock()
+	defer staticTypeCache.Unlock()
+	return staticTypeCache.getCompoundType(LWWRegisterKind, elemType)
+}
+
 type fieldSorter struct {
 	names []string
 	types []*Type
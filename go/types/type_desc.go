@@ -15,6 +15,8 @@ type TypeDesc interface {
 // PrimitiveDesc implements TypeDesc for all primitive Noms types:
 // Blob
 // Bool
+// Counter
+// Encrypted
 // Number
 // Package
 // String
@@ -31,22 +33,26 @@ func (p PrimitiveDesc) HasUnresolvedCycle(visited []*Type) bool {
 }
 
 var KindToString = map[NomsKind]string{
-	BlobKind:   "Blob",
-	BoolKind:   "Bool",
-	CycleKind:  "Cycle",
-	ListKind:   "List",
-	MapKind:    "Map",
-	NumberKind: "Number",
-	RefKind:    "Ref",
-	SetKind:    "Set",
-	StructKind: "Struct",
-	StringKind: "String",
-	TypeKind:   "Type",
-	UnionKind:  "Union",
-	ValueKind:  "Value",
-}
-
-// CompoundDesc describes a List, Map, Set, Ref, or Union type.
+	BlobKind:        "Blob",
+	BoolKind:        "Bool",
+	CounterKind:     "Counter",
+	CycleKind:       "Cycle",
+	EncryptedKind:   "Encrypted",
+	ListKind:        "List",
+	LWWRegisterKind: "LWWRegister",
+	MapKind:         "Map",
+	NumberKind:      "Number",
+	RefKind:         "Ref",
+	SetKind:         "Set",
+	StructKind:      "Struct",
+	StringKind:      "String",
+	TupleKind:       "Tuple",
+	TypeKind:        "Type",
+	UnionKind:       "Union",
+	ValueKind:       "Value",
+}
+
+// CompoundDesc describes a List, Map, Set, Ref, Tuple, LWWRegister or Union type.
 // ElemTypes indicates what type or types are in the container indicated by kind, e.g. Map key and value or Set element.
 type CompoundDesc struct {
 	kind      NomsKind
@@ -5,21 +5,37 @@
 package types
 
 import (
-	"fmt"
-
-	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/hash"
 )
 
+// maxDecodeDepth is how deeply values and types may be nested within a single chunk. It's far deeper than any value Noms writes, but keeps a chunk crafted to nest without end from overflowing the stack of the decoder.
+const maxDecodeDepth = 1 << 12
+
 type valueDecoder struct {
 	nomsReader
 	vr ValueReader
 	tc *TypeCache
+	// If set, data is what the nomsReader reads from, and the fields of structs and the elements of list leaves are decoded from it lazily, as they're read, rather than all at once.
+	data []byte
+	// depth is how many values and types the one being decoded is nested within.
+	depth int
 }
 
 // |tc| must be locked as long as the valueDecoder is being used
 func newValueDecoder(nr nomsReader, vr ValueReader, tc *TypeCache) *valueDecoder {
-	return &valueDecoder{nr, vr, tc}
+	return &valueDecoder{nr, vr, tc, nil, 0}
+}
+
+// enter notes that a nested value or type is being decoded, panicking with a DecodeError if they're nested too deeply. leave must be called once it's done.
+func (r *valueDecoder) enter() {
+	r.depth++
+	if r.depth > maxDecodeDepth {
+		decodeErrorf("values nested more than %d deep", maxDecodeDepth)
+	}
+}
+
+func (r *valueDecoder) leave() {
+	r.depth--
 }
 
 func (r *valueDecoder) readKind() NomsKind {
@@ -33,6 +49,13 @@ func (r *valueDecoder) readRef(t *Type) Ref {
 }
 
 func (r *valueDecoder) readType() *Type {
+	r.enter()
+	t := r.readTypeInner()
+	r.leave()
+	return t
+}
+
+func (r *valueDecoder) readTypeInner() *Type {
 	k := r.readKind()
 	switch k {
 	case ListKind:
@@ -43,15 +66,25 @@ func (r *valueDecoder) readType() *Type {
 		return r.tc.getCompoundType(RefKind, r.readType())
 	case SetKind:
 		return r.tc.getCompoundType(SetKind, r.readType())
+	case LWWRegisterKind:
+		return r.tc.getCompoundType(LWWRegisterKind, r.readType())
+	case CounterKind:
+		return CounterType
+	case EncryptedKind:
+		return EncryptedType
 	case StructKind:
 		return r.readStructType()
 	case UnionKind:
 		return r.readUnionType()
+	case TupleKind:
+		return r.readTupleType()
 	case CycleKind:
 		return r.tc.getCycleType(r.readUint32())
 	}
 
-	d.PanicIfFalse(IsPrimitiveKind(k))
+	if !IsPrimitiveKind(k) {
+		decodeErrorf("invalid kind %d", k)
+	}
 	return MakePrimitiveType(k)
 }
 
@@ -61,7 +94,7 @@ func (r *valueDecoder) readBlobLeafSequence() sequence {
 }
 
 func (r *valueDecoder) readValueSequence() ValueSlice {
-	count := r.readUint32()
+	count := r.readCount()
 
 	data := ValueSlice{}
 	for i := uint32(0); i < count; i++ {
@@ -72,9 +105,24 @@ func (r *valueDecoder) readValueSequence() ValueSlice {
 	return data
 }
 
+// readLazyValues skips over |count| values, recording where each of them starts, so that they can be decoded later.
+func (r *valueDecoder) readLazyValues(count int) *lazyValues {
+	offsets := make([]uint32, count+1)
+	for i := 0; i < count; i++ {
+		offsets[i] = r.pos()
+		r.skipValue()
+	}
+	offsets[count] = r.pos()
+	return &lazyValues{data: r.data, offsets: offsets, vr: r.vr, tc: r.tc}
+}
+
 func (r *valueDecoder) readListLeafSequence(t *Type) sequence {
+	if r.data != nil {
+		lazy := r.readLazyValues(int(r.readCount()))
+		return listLeafSequence{leafSequence{r.vr, lazy.len(), t}, nil, lazy}
+	}
 	data := r.readValueSequence()
-	return listLeafSequence{leafSequence{r.vr, len(data), t}, data}
+	return listLeafSequence{leafSequence{r.vr, len(data), t}, data, nil}
 }
 
 func (r *valueDecoder) readSetLeafSequence(t *Type) orderedSequence {
@@ -83,7 +131,7 @@ func (r *valueDecoder) readSetLeafSequence(t *Type) orderedSequence {
 }
 
 func (r *valueDecoder) readMapLeafSequence(t *Type) orderedSequence {
-	count := r.readUint32()
+	count := r.readCount()
 	data := []mapEntry{}
 	for i := uint32(0); i < count; i++ {
 		k := r.readValue()
@@ -95,11 +143,14 @@ func (r *valueDecoder) readMapLeafSequence(t *Type) orderedSequence {
 }
 
 func (r *valueDecoder) readMetaSequence(t *Type) metaSequence {
-	count := r.readUint32()
+	count := r.readCount()
 
 	data := []metaTuple{}
 	for i := uint32(0); i < count; i++ {
-		ref := r.readValue().(Ref)
+		ref, ok := r.readValue().(Ref)
+		if !ok {
+			decodeErrorf("meta sequence entry isn't a Ref")
+		}
 		v := r.readValue()
 		var key orderedKey
 		if r, ok := v.(Ref); ok {
@@ -116,6 +167,13 @@ func (r *valueDecoder) readMetaSequence(t *Type) metaSequence {
 }
 
 func (r *valueDecoder) readValue() Value {
+	r.enter()
+	v := r.readValueInner()
+	r.leave()
+	return v
+}
+
+func (r *valueDecoder) readValueInner() Value {
 	t := r.readType()
 	switch t.Kind() {
 	case BlobKind:
@@ -156,12 +214,20 @@ func (r *valueDecoder) readValue() Value {
 		return newSet(r.readSetLeafSequence(t))
 	case StructKind:
 		return r.readStruct(t)
+	case TupleKind:
+		return r.readTuple(t)
+	case CounterKind:
+		return Counter(r.readNumber())
+	case EncryptedKind:
+		keyID := r.readUint32()
+		return Encrypted{keyID, r.readBytes(), &hash.Hash{}}
+	case LWWRegisterKind:
+		return r.readLWWRegister(t)
 	case TypeKind:
 		return r.readType()
-	case CycleKind, UnionKind, ValueKind:
-		d.Chk.Fail(fmt.Sprintf("A value instance can never have type %s", KindToString[t.Kind()]))
 	}
 
+	decodeErrorf("a value can never have type %s", KindToString[t.Kind()])
 	panic("not reachable")
 }
 
@@ -169,17 +235,109 @@ func (r *valueDecoder) readStruct(t *Type) Value {
 	// We've read `[StructKind, name, fields, unions` at this point
 	desc := t.Desc.(StructDesc)
 	count := desc.Len()
+	if r.data != nil {
+		return Struct{nil, r.readLazyValues(count), t, &hash.Hash{}}
+	}
 	values := make([]Value, count)
 	for i := 0; i < count; i++ {
 		values[i] = r.readValue()
 	}
 
-	return Struct{values, t, &hash.Hash{}}
+	return Struct{values, nil, t, &hash.Hash{}}
+}
+
+// skipBytes skips over bytes written by writeBytes or writeString.
+func (r *valueDecoder) skipBytes() {
+	r.skip(r.readUint32())
+}
+
+func (r *valueDecoder) skipValueSequence(count uint32) {
+	for i := uint32(0); i < count; i++ {
+		r.skipValue()
+	}
+}
+
+func (r *valueDecoder) skipMetaSequence() {
+	count := r.readCount()
+	for i := uint32(0); i < count; i++ {
+		r.skipValue()
+		r.skipValue()
+		r.readUint64()
+	}
+}
+
+// skipValue moves past the next value without decoding it, which, unlike readValue, doesn't allocate anything unless it comes across a type that isn't in r's TypeCache yet.
+func (r *valueDecoder) skipValue() {
+	r.enter()
+	r.skipValueInner()
+	r.leave()
+}
+
+func (r *valueDecoder) skipValueInner() {
+	t := r.readType()
+	switch t.Kind() {
+	case BlobKind:
+		if r.readBool() {
+			r.skipMetaSequence()
+		} else {
+			r.skipBytes()
+		}
+	case BoolKind:
+		r.readBool()
+	case NumberKind, CounterKind:
+		r.readNumber()
+	case StringKind:
+		r.skipBytes()
+	case ListKind, SetKind:
+		if r.readBool() {
+			r.skipMetaSequence()
+		} else {
+			r.skipValueSequence(r.readCount())
+		}
+	case MapKind:
+		if r.readBool() {
+			r.skipMetaSequence()
+		} else {
+			r.skipValueSequence(2 * r.readCount())
+		}
+	case RefKind:
+		r.readHash()
+		r.readUint64()
+	case StructKind:
+		r.skipValueSequence(uint32(t.Desc.(StructDesc).Len()))
+	case TupleKind:
+		r.skipValueSequence(uint32(len(t.Desc.(CompoundDesc).ElemTypes)))
+	case EncryptedKind:
+		r.readUint32()
+		r.skipBytes()
+	case LWWRegisterKind:
+		r.readUint64()
+		r.skipValue()
+	case TypeKind:
+		r.readType()
+	default:
+		decodeErrorf("a value can never have type %s", KindToString[t.Kind()])
+	}
+}
+
+func (r *valueDecoder) readTuple(t *Type) Value {
+	count := len(t.Desc.(CompoundDesc).ElemTypes)
+	values := make(ValueSlice, count)
+	for i := 0; i < count; i++ {
+		values[i] = r.readValue()
+	}
+
+	return Tuple{values, t, &hash.Hash{}}
+}
+
+func (r *valueDecoder) readLWWRegister(t *Type) Value {
+	timestamp := r.readUint64()
+	return LWWRegister{r.readValue(), timestamp, t, &hash.Hash{}}
 }
 
 func (r *valueDecoder) readCachedStructType() *Type {
 	trie := r.tc.trieRoots[StructKind].Traverse(r.readIdent(r.tc))
-	count := r.readUint32()
+	count := r.readCount()
 
 	for i := uint32(0); i < count; i++ {
 		trie = trie.Traverse(r.readIdent(r.tc))
@@ -201,12 +359,21 @@ func (r *valueDecoder) readStructType() *Type {
 	r.seek(pos)
 
 	name := r.readString()
-	count := r.readUint32()
+	if name != "" && !IsValidStructFieldName(name) {
+		decodeErrorf("invalid struct name %q", name)
+	}
+	count := r.readCount()
 
 	fieldNames := make([]string, count)
 	fieldTypes := make([]*Type, count)
 	for i := uint32(0); i < count; i++ {
 		fieldNames[i] = r.readString()
+		if !IsValidStructFieldName(fieldNames[i]) {
+			decodeErrorf("invalid struct field name %q", fieldNames[i])
+		}
+		if i > 0 && fieldNames[i] <= fieldNames[i-1] {
+			decodeErrorf("struct field names %q and %q out of order", fieldNames[i-1], fieldNames[i])
+		}
 		fieldTypes[i] = r.readType()
 	}
 
@@ -214,10 +381,19 @@ func (r *valueDecoder) readStructType() *Type {
 }
 
 func (r *valueDecoder) readUnionType() *Type {
-	l := r.readUint32()
+	l := r.readCount()
 	ts := make(typeSlice, l)
 	for i := uint32(0); i < l; i++ {
 		ts[i] = r.readType()
 	}
 	return r.tc.getCompoundType(UnionKind, ts...)
 }
+
+func (r *valueDecoder) readTupleType() *Type {
+	l := r.readCount()
+	ts := make(typeSlice, l)
+	for i := uint32(0); i < l; i++ {
+		ts[i] = r.readType()
+	}
+	return r.tc.getCompoundType(TupleKind, ts...)
+}
@@ -31,13 +31,13 @@ func (w *valueEncoder) writeRef(r Ref) {
 func (w *valueEncoder) writeType(t *Type, parentStructTypes []*Type) {
 	k := t.Kind()
 	switch k {
-	case ListKind, MapKind, RefKind, SetKind:
+	case ListKind, MapKind, RefKind, SetKind, LWWRegisterKind:
 		w.writeKind(k)
 		for _, elemType := range t.Desc.(CompoundDesc).ElemTypes {
 			w.writeType(elemType, parentStructTypes)
 		}
 
-	case UnionKind:
+	case TupleKind, UnionKind:
 		w.writeKind(k)
 		elemTypes := t.Desc.(CompoundDesc).ElemTypes
 		w.writeUint32(uint32(len(elemTypes)))
@@ -48,6 +48,8 @@ func (w *valueEncoder) writeType(t *Type, parentStructTypes []*Type) {
 		w.writeStructType(t, parentStructTypes)
 	case CycleKind:
 		w.writeCycle(uint32(t.Desc.(CycleDesc)))
+	case CounterKind, EncryptedKind:
+		w.writeKind(k)
 	default:
 		w.writeKind(k)
 		d.PanicIfFalse(IsPrimitiveKind(k))
@@ -68,6 +70,11 @@ func (w *valueEncoder) writeValueSlice(values ValueSlice) {
 }
 
 func (w *valueEncoder) writeListLeafSequence(seq listLeafSequence) {
+	if seq.lazy != nil {
+		w.writeUint32(uint32(seq.lazy.len()))
+		w.writeLazyValues(seq.lazy)
+		return
+	}
 	w.writeValueSlice(seq.values)
 }
 
@@ -120,7 +127,7 @@ func (w *valueEncoder) writeValue(v Value) {
 	w.appendType(t)
 	switch t.Kind() {
 	case BlobKind:
-		seq := v.(Blob).sequence()
+		seq := asBlob(v).sequence()
 		if w.maybeWriteMetaSequence(seq) {
 			return
 		}
@@ -159,6 +166,16 @@ func (w *valueEncoder) writeValue(v Value) {
 		w.writeType(v.(*Type), nil)
 	case StructKind:
 		w.writeStruct(v, t)
+	case TupleKind:
+		w.writeTuple(v.(Tuple))
+	case CounterKind:
+		w.writeNumber(Number(v.(Counter)))
+	case EncryptedKind:
+		e := v.(Encrypted)
+		w.writeUint32(e.keyID)
+		w.writeBytes(e.data)
+	case LWWRegisterKind:
+		w.writeLWWRegister(v.(LWWRegister))
 	case CycleKind, UnionKind, ValueKind:
 		d.Chk.Fail(fmt.Sprintf("A value instance can never have type %s", KindToString[t.Kind()]))
 	default:
@@ -167,11 +184,38 @@ func (w *valueEncoder) writeValue(v Value) {
 }
 
 func (w *valueEncoder) writeStruct(v Value, t *Type) {
-	for _, v := range v.(Struct).values {
+	s := v.(Struct)
+	if s.lazy != nil {
+		w.writeLazyValues(s.lazy)
+		return
+	}
+	for _, v := range s.values {
 		w.writeValue(v)
 	}
 }
 
+// writeLazyValues writes values that were decoded lazily. If w is writing a chunk, they're copied straight from the chunk they were decoded from, without decoding them. Other nomsWriters, e.g. rollingValueHasher, don't see values as they're encoded, so they're written one by one.
+func (w *valueEncoder) writeLazyValues(lv *lazyValues) {
+	if bw, ok := w.nomsWriter.(*binaryNomsWriter); ok {
+		bw.writeRaw(lv.encoded())
+		return
+	}
+	for _, v := range lv.all() {
+		w.writeValue(v)
+	}
+}
+
+func (w *valueEncoder) writeTuple(t Tuple) {
+	for _, v := range t.values {
+		w.writeValue(v)
+	}
+}
+
+func (w *valueEncoder) writeLWWRegister(r LWWRegister) {
+	w.writeUint64(r.timestamp)
+	w.writeValue(r.value)
+}
+
 func (w *valueEncoder) writeCycle(i uint32) {
 	w.writeKind(CycleKind)
 	w.writeUint32(i)
@@ -16,6 +16,8 @@ import (
 // ValueReader is an interface that knows how to read Noms Values, e.g. datas/Database. Required to avoid import cycle between this package and the package that implements Value reading.
 type ValueReader interface {
 	ReadValue(h hash.Hash) Value
+	// ReadManyValues reads the Values for |hashes|, in the same order, in as few round trips as possible. Absent Values are returned as nil.
+	ReadManyValues(hashes hash.HashSlice) ValueSlice
 }
 
 // ValueWriter is an interface that knows how to write Noms Values, e.g. datas/Database. Required to avoid import cycle between this package and the package that implements Value writing.
@@ -76,13 +78,55 @@ func (lvs *ValueStore) BatchStore() BatchStore {
 
 // ReadValue reads and decodes a value from lvs. It is not considered an error for the requested chunk to be empty; in this case, the function simply returns nil.
 func (lvs *ValueStore) ReadValue(r hash.Hash) Value {
-	if v, ok := lvs.valueCache.Get(r); ok {
+	v, _ := lvs.readValueAndSize(r)
+	return v
+}
+
+// readValueAndSize is like ReadValue, but also returns the size of the chunk the value was decoded from, or 0 if it's absent.
+func (lvs *ValueStore) readValueAndSize(r hash.Hash) (Value, uint64) {
+	if v, size, ok := lvs.valueCache.GetWithSize(r); ok {
 		if v == nil {
-			return nil
+			return nil, 0
 		}
-		return v.(Value)
+		return v.(Value), size
 	}
 	chunk := lvs.bs.Get(r)
+	return lvs.decodeAndCache(r, chunk), uint64(len(chunk.Data()))
+}
+
+// ReadManyValues reads and decodes the values for |hashes| from lvs, fetching all of those that aren't already cached with a single call to the BatchStore's GetMany().
+func (lvs *ValueStore) ReadManyValues(hashes hash.HashSlice) ValueSlice {
+	vals, _ := lvs.readManyValuesAndSizes(hashes)
+	return vals
+}
+
+// readManyValuesAndSizes is like ReadManyValues, but also returns the sizes of the chunks the values were decoded from.
+func (lvs *ValueStore) readManyValuesAndSizes(hashes hash.HashSlice) (ValueSlice, []uint64) {
+	vals, sizes := make(ValueSlice, len(hashes)), make([]uint64, len(hashes))
+	misses, missIdx := hash.HashSlice{}, []int{}
+	for i, h := range hashes {
+		if v, size, ok := lvs.valueCache.GetWithSize(h); ok {
+			if v != nil {
+				vals[i], sizes[i] = v.(Value), size
+			}
+			continue
+		}
+		misses = append(misses, h)
+		missIdx = append(missIdx, i)
+	}
+	if len(misses) == 0 {
+		return vals, sizes
+	}
+
+	for i, chunk := range lvs.bs.GetMany(misses) {
+		vals[missIdx[i]] = lvs.decodeAndCache(misses[i], chunk)
+		sizes[missIdx[i]] = uint64(len(chunk.Data()))
+	}
+	return vals, sizes
+}
+
+// decodeAndCache decodes |chunk|, which was read for |r|, and records the result in lvs's caches.
+func (lvs *ValueStore) decodeAndCache(r hash.Hash, chunk chunks.Chunk) Value {
 	if chunk.IsEmpty() {
 		lvs.valueCache.Add(r, 0, nil)
 		return nil
@@ -108,6 +152,11 @@ func (lvs *ValueStore) WriteValue(v Value) Ref {
 	d.PanicIfFalse(v != nil)
 	// Encoding v causes any child chunks, e.g. internal nodes if v is a meta sequence, to get written. That needs to happen before we try to validate v.
 	c := EncodeValue(v, lvs)
+	return lvs.writeEncodedValue(v, c)
+}
+
+// writeEncodedValue does what WriteValue does for |v|, which has already been encoded into |c|, e.g. by a worker of a sequenceChunker.
+func (lvs *ValueStore) writeEncodedValue(v Value, c chunks.Chunk) Ref {
 	d.PanicIfTrue(c.IsEmpty())
 	hash := c.Hash()
 	height := maxChunkHeight(v) + 1
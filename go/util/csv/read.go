@@ -5,7 +5,7 @@
 package csv
 
 import (
-	"encoding/csv"
+	"context"
 	"fmt"
 	"io"
 	"sort"
@@ -13,6 +13,7 @@ import (
 
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
 )
 
 // StringToKind maps names of valid NomsKinds (e.g. Bool, Number, etc) to their associated types.NomsKind
@@ -91,13 +92,47 @@ func MakeStructTypeFromHeaders(headers []string, structName string, kinds KindSl
 	return
 }
 
+// RecordReader reads CSV records one at a time, as *csv.Reader does.
+type RecordReader interface {
+	Read() (record []string, err error)
+}
+
+// WithContext returns a RecordReader that reads records from |r|, adding each one to the progress of |ctx| as a value, and which fails with ctx.Err() once |ctx| is canceled, so that ReadToList, ReadToMap and ReadToCompositeKeyMap panic with it.
+func WithContext(ctx context.Context, r RecordReader) RecordReader {
+	return contextReader{ctx, r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   RecordReader
+}
+
+func (cr contextReader) Read() ([]string, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return nil, err
+	}
+	record, err := cr.r.Read()
+	if err == nil {
+		progress.Add(cr.ctx, progress.Progress{Values: 1})
+	}
+	return record, err
+}
+
 // ReadToList takes a CSV reader and reads data into a typed List of structs. Each row gets read into a struct named structName, described by headers. If the original data contained headers it is expected that the input reader has already read those and are pointing at the first data row.
 // If kinds is non-empty, it will be used to type the fields in the generated structs; otherwise, they will be left as string-fields.
 // In addition to the list, ReadToList returns the typeDef of the structs in the list.
-func ReadToList(r *csv.Reader, structName string, headers []string, kinds KindSlice, vrw types.ValueReadWriter) (l types.List, t *types.Type) {
+func ReadToList(r RecordReader, structName string, headers []string, kinds KindSlice, vrw types.ValueReadWriter) (l types.List, t *types.Type) {
 	t, fieldOrder, kindMap := MakeStructTypeFromHeaders(headers, structName, kinds)
 	valueChan := make(chan types.Value, 128) // TODO: Make this a function param?
 	listChan := types.NewStreamingList(vrw, valueChan)
+	defer func() {
+		if r := recover(); r != nil {
+			// Let the goroutine building the list finish, rather than leaving it waiting for more values.
+			close(valueChan)
+			<-listChan
+			panic(r)
+		}
+	}()
 
 	for {
 		row, err := r.Read()
@@ -135,9 +170,7 @@ func getPkIndices(strPks []string, headers []string) []int {
 		} else {
 			result[i] = getFieldIndexByHeaderName(headers, pk)
 		}
-		if result[i] < 0 {
-			d.Chk.Fail(fmt.Sprintf("Invalid pk: %v", pk))
-		}
+		d.PanicIfTrue(result[i] < 0 || result[i] >= len(headers), "Invalid pk: %v", pk)
 	}
 	return result
 }
@@ -149,7 +182,7 @@ func readFieldsFromRow(row []string, headers []string, fieldOrder []int, kindMap
 			fieldOrigIndex := fieldOrder[i]
 			val, err := StringToValue(v, kindMap[fieldOrigIndex])
 			if err != nil {
-				d.Chk.Fail(fmt.Sprintf("Error parsing value for column '%s': %s", headers[i], err))
+				d.PanicIfError(fmt.Errorf("Error parsing value for column '%s': %s", headers[i], err))
 			}
 			fields[fieldOrigIndex] = val
 		}
@@ -185,7 +218,7 @@ func primaryKeyValuesFromFields(fields types.ValueSlice, fieldOrder, pkIndices [
 
 // ReadToMap takes a CSV reader and reads data into a typed Map of structs. Each row gets read into a struct named structName, described by headers. If the original data contained headers it is expected that the input reader has already read those and are pointing at the first data row.
 // If kinds is non-empty, it will be used to type the fields in the generated structs; otherwise, they will be left as string-fields.
-func ReadToMap(r *csv.Reader, structName string, headersRaw []string, primaryKeys []string, kinds KindSlice, vrw types.ValueReadWriter) types.Map {
+func ReadToMap(r RecordReader, structName string, headersRaw []string, primaryKeys []string, kinds KindSlice, vrw types.ValueReadWriter) types.Map {
 	t, fieldOrder, kindMap := MakeStructTypeFromHeaders(headersRaw, structName, kinds)
 	pkIndices := getPkIndices(primaryKeys, headersRaw)
 	d.Chk.True(len(pkIndices) >= 1, "No primary key defined when reading into map")
@@ -205,3 +238,33 @@ func ReadToMap(r *csv.Reader, structName string, headersRaw []string, primaryKey
 	}
 	return gb.Build().(types.Map)
 }
+
+// ReadToCompositeKeyMap is like ReadToMap, but rather than nesting a Map for each primary key but the last, it reads the rows into a single Map keyed by structs named keyName, with a field for each of the primary keys. Like ReadToMap, it keeps the rows on disk, rather than in memory, until the Map is built.
+func ReadToCompositeKeyMap(r RecordReader, structName, keyName string, headersRaw []string, primaryKeys []string, kinds KindSlice, vrw types.ValueReadWriter) types.Map {
+	t, fieldOrder, kindMap := MakeStructTypeFromHeaders(headersRaw, structName, kinds)
+	pkIndices := getPkIndices(primaryKeys, headersRaw)
+	d.PanicIfTrue(len(pkIndices) < 2, "A composite key needs at least two primary keys")
+	pkKinds := make(KindSlice, len(pkIndices))
+	for i, idx := range pkIndices {
+		pkKinds[i] = kindMap[fieldOrder[idx]]
+	}
+	keyType, keyOrder, _ := MakeStructTypeFromHeaders(GetFieldNamesFromIndices(headersRaw, pkIndices), keyName, pkKinds)
+	gb := types.NewGraphBuilder(vrw, types.MapKind, false)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+
+		fields := readFieldsFromRow(row, headersRaw, fieldOrder, kindMap)
+		keyFields := make(types.ValueSlice, len(pkIndices))
+		for i, idx := range pkIndices {
+			keyFields[keyOrder[i]] = fields[fieldOrder[idx]]
+		}
+		gb.MapSet(nil, types.NewStructWithType(keyType, keyFields), types.NewStructWithType(t, fields))
+	}
+	return gb.Build().(types.Map)
+}
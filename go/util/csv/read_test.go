@@ -6,12 +6,14 @@ package csv
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"testing"
 
 	"github.com/stormasm/noms/go/chunks"
 	"github.com/stormasm/noms/go/datas"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/progress"
 	"github.com/attic-labs/testify/assert"
 )
 
@@ -110,6 +112,29 @@ func testTrailingHelper(t *testing.T, dataString string) {
 	assert.Equal(uint64(3), m.Len())
 }
 
+func TestReadToCompositeKeyMap(t *testing.T) {
+	assert := assert.New(t)
+	ds := datas.NewDatabase(chunks.NewMemoryStore())
+
+	dataString := `nyc,2016,8.5
+nyc,2015,8.4
+sf,2016,0.8
+`
+	r := NewCSVReader(bytes.NewBufferString(dataString), ',')
+	headers := []string{"city", "year", "pop"}
+	kinds := KindSlice{types.StringKind, types.NumberKind, types.NumberKind}
+	m := ReadToCompositeKeyMap(r, "Row", "Key", headers, []string{"city", "1"}, kinds, ds)
+
+	assert.Equal(uint64(3), m.Len())
+	key := types.NewStruct("Key", types.StructData{"city": types.String("nyc"), "year": types.Number(2015)})
+	row := m.Get(key).(types.Struct)
+	assert.Equal(types.Number(8.4), row.Get("pop"))
+	assert.Equal(types.String("nyc"), row.Get("city"))
+
+	r = NewCSVReader(bytes.NewBufferString(dataString), ',')
+	assert.Panics(func() { ReadToCompositeKeyMap(r, "Row", "Key", headers, []string{"city"}, kinds, ds) })
+}
+
 func TestReadTrailingHole(t *testing.T) {
 	dataString := `a,b,
 d,e,
@@ -179,6 +204,39 @@ func TestReadParseError(t *testing.T) {
 	}()
 }
 
+func TestWithContext(t *testing.T) {
+	assert := assert.New(t)
+	ds := datas.NewDatabase(chunks.NewMemoryStore())
+	headers := []string{"A", "B"}
+	kinds := KindSlice{types.StringKind, types.NumberKind}
+
+	var reported progress.Progress
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = progress.WithReporter(ctx, progress.ReporterFunc(func(p progress.Progress) {
+		reported = p
+	}))
+	r := NewCSVReader(bytes.NewBufferString("a,1\nb,2\nc,3\n"), ',')
+	l, _ := ReadToList(WithContext(ctx, r), "test", headers, kinds, ds)
+	assert.Equal(uint64(3), l.Len())
+	assert.Equal(progress.Progress{Values: 3}, reported)
+
+	// Once the context is canceled, reading stops.
+	cancel()
+	for _, read := range []func(r RecordReader){
+		func(r RecordReader) { ReadToList(r, "test", headers, kinds, ds) },
+		func(r RecordReader) { ReadToMap(r, "test", headers, []string{"A"}, kinds, ds) },
+	} {
+		r = NewCSVReader(bytes.NewBufferString("a,1\nb,2\nc,3\n"), ',')
+		func() {
+			defer func() {
+				assert.Equal(context.Canceled, recover())
+			}()
+			read(WithContext(ctx, r))
+		}()
+	}
+	assert.Equal(progress.Progress{Values: 3}, reported)
+}
+
 func TestDuplicateHeaderName(t *testing.T) {
 	assert := assert.New(t)
 	ds := datas.NewDatabase(chunks.NewMemoryStore())
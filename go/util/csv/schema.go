@@ -117,6 +117,38 @@ func GetSchema(r *csv.Reader, numSamples int, numFields int) KindSlice {
 	return so.MostSpecificKinds()
 }
 
+// InferKinds returns the most specific kinds of the first |numFields| fields of the first |numSamples| records of |r|, along with a RecordReader which reads those records again before the rest of r, so that the kinds of a stream can be inferred without reading it twice. Only the sampled records are held in memory.
+func InferKinds(r RecordReader, numSamples int, numFields int) (KindSlice, RecordReader, error) {
+	so := newSchemaOptions(numFields)
+	sampled := [][]string{}
+	for i := 0; i < numSamples; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		so.Test(row)
+		sampled = append(sampled, row)
+	}
+	return so.MostSpecificKinds(), &replayReader{sampled, r}, nil
+}
+
+// replayReader reads |records| before reading from |r|.
+type replayReader struct {
+	records [][]string
+	r       RecordReader
+}
+
+func (rr *replayReader) Read() ([]string, error) {
+	if len(rr.records) > 0 {
+		record := rr.records[0]
+		rr.records = rr.records[1:]
+		return record, nil
+	}
+	return rr.r.Read()
+}
+
 func GetFieldNamesFromIndices(headers []string, indices []int) []string {
 	result := make([]string, len(indices))
 	for i, idx := range indices {
@@ -5,7 +5,9 @@
 package csv
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"testing"
 
 	"github.com/stormasm/noms/go/types"
@@ -263,6 +265,26 @@ func TestSchemaDetection(t *testing.T) {
 	)
 }
 
+func TestInferKinds(t *testing.T) {
+	assert := assert.New(t)
+	dataString := "a,1,true\nb,2,false\nc,x,true\n"
+	kinds, r, err := InferKinds(NewCSVReader(bytes.NewBufferString(dataString), ','), 2, 3)
+	assert.NoError(err)
+	assert.Equal(KindSlice{types.StringKind, types.NumberKind, types.BoolKind}, kinds)
+
+	// The sampled records are read again, followed by the rest.
+	for _, first := range []string{"a", "b", "c"} {
+		record, err := r.Read()
+		assert.NoError(err)
+		assert.Equal(first, record[0])
+	}
+	_, err = r.Read()
+	assert.Equal(io.EOF, err)
+
+	_, _, err = InferKinds(NewCSVReader(bytes.NewBufferString(`a,"b`), ','), 2, 2)
+	assert.Error(err)
+}
+
 func TestCombinationsWithLength(t *testing.T) {
 	assert := assert.New(t)
 	test := func(input []int, length int, expect [][]int) {
@@ -5,12 +5,36 @@
 package jsontonoms
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/big"
 	"reflect"
+	"strconv"
 
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/types"
 )
 
+// NumberMode says how NomsValueFromJSON converts JSON numbers.
+type NumberMode int
+
+const (
+	// NumbersAsNumber converts numbers to the nearest Number, which loses precision for integers above 2^53, and for some decimals.
+	NumbersAsNumber NumberMode = iota
+	// NumbersExact converts numbers to Numbers, failing if any of them can't be represented exactly.
+	NumbersExact
+	// NumbersAsString converts numbers to Strings of their JSON text, which is exact but not numeric.
+	NumbersAsString
+)
+
+// Options control how NomsValueFromJSON converts JSON values.
+type Options struct {
+	// Structs converts objects to Structs named StructName, with a field for each key, escaped with types.EscapeStructField. Otherwise objects are converted to Maps from Strings to their values.
+	Structs    bool
+	StructName string
+	Numbers    NumberMode
+}
+
 // NomsValueFromDecodedJSON takes a generic Go interface{} and recursively
 // tries to resolve the types within so that it can build up and return
 // a Noms Value with the same structure.
@@ -26,50 +50,81 @@ import (
 //  - []interface{}
 //  - map[string]interface{}
 func NomsValueFromDecodedJSON(o interface{}, useStruct bool) types.Value {
+	v, err := NomsValueFromJSON(o, Options{Structs: useStruct})
+	d.Chk.NoError(err, "Nomsification failed.")
+	return v
+}
+
+// NomsValueFromJSON is like NomsValueFromDecodedJSON, but converts according to |opts|, and returns an error rather than panicking if |o| can't be converted. Besides float64, numbers may be json.Numbers, as decoded by a json.Decoder with UseNumber, which NumbersExact and NumbersAsString need to see the numbers' text.
+func NomsValueFromJSON(o interface{}, opts Options) (types.Value, error) {
 	switch o := o.(type) {
 	case string:
-		return types.String(o)
+		return types.String(o), nil
 	case bool:
-		return types.Bool(o)
+		return types.Bool(o), nil
 	case float64:
-		return types.Number(o)
+		if opts.Numbers == NumbersAsString {
+			return types.String(strconv.FormatFloat(o, 'g', -1, 64)), nil
+		}
+		return types.Number(o), nil
+	case json.Number:
+		return numberFromJSON(o, opts.Numbers)
 	case nil:
-		return nil
+		return nil, nil
 	case []interface{}:
 		items := make([]types.Value, 0, len(o))
 		for _, v := range o {
-			nv := NomsValueFromDecodedJSON(v, useStruct)
+			nv, err := NomsValueFromJSON(v, opts)
+			if err != nil {
+				return nil, err
+			}
 			if nv != nil {
 				items = append(items, nv)
 			}
 		}
-		return types.NewList(items...)
+		return types.NewList(items...), nil
 	case map[string]interface{}:
-		var v types.Value
-		if useStruct {
+		if opts.Structs {
 			fields := make(types.StructData, len(o))
 			for k, v := range o {
-				nv := NomsValueFromDecodedJSON(v, useStruct)
-				if nv != nil {
-					k := types.EscapeStructField(k)
-					fields[k] = nv
+				nv, err := NomsValueFromJSON(v, opts)
+				if err != nil {
+					return nil, err
 				}
-			}
-			v = types.NewStruct("", fields)
-		} else {
-			kv := make([]types.Value, 0, len(o)*2)
-			for k, v := range o {
-				nv := NomsValueFromDecodedJSON(v, useStruct)
 				if nv != nil {
-					kv = append(kv, types.String(k), nv)
+					fields[types.EscapeStructField(k)] = nv
 				}
 			}
-			v = types.NewMap(kv...)
+			return types.NewStruct(opts.StructName, fields), nil
+		}
+		kv := make([]types.Value, 0, len(o)*2)
+		for k, v := range o {
+			nv, err := NomsValueFromJSON(v, opts)
+			if err != nil {
+				return nil, err
+			}
+			if nv != nil {
+				kv = append(kv, types.String(k), nv)
+			}
 		}
-		return v
+		return types.NewMap(kv...), nil
+	}
+	return nil, fmt.Errorf("I don't understand %+v, which is of type %s", o, reflect.TypeOf(o).String())
+}
 
-	default:
-		d.Chk.Fail("Nomsification failed.", "I don't understand %+v, which is of type %s!\n", o, reflect.TypeOf(o).String())
+func numberFromJSON(n json.Number, mode NumberMode) (types.Value, error) {
+	if mode == NumbersAsString {
+		return types.String(n.String()), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("Number %s is out of range", n)
+	}
+	if mode == NumbersExact {
+		r, ok := new(big.Rat).SetString(n.String())
+		if !ok || r.Cmp(new(big.Rat).SetFloat64(f)) != 0 {
+			return nil, fmt.Errorf("Number %s can't be represented exactly", n)
+		}
 	}
-	return nil
+	return types.Number(f), nil
 }
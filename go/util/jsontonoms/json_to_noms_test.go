@@ -5,6 +5,7 @@
 package jsontonoms
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stormasm/noms/go/types"
@@ -84,3 +85,30 @@ func (suite *LibTestSuite) TestCompositeTypeWithStruct() {
 func (suite *LibTestSuite) TestPanicOnUnsupportedType() {
 	suite.Panics(func() { NomsValueFromDecodedJSON(map[int]string{1: "one"}, false) }, "Should panic on map[int]string!")
 }
+
+func (suite *LibTestSuite) TestOptions() {
+	o := map[string]interface{}{
+		"big":   json.Number("9007199254740993"),
+		"small": json.Number("1.5"),
+	}
+	v, err := NomsValueFromJSON(o, Options{Structs: true, StructName: "Row"})
+	suite.NoError(err)
+	suite.True(types.NewStruct("Row", types.StructData{
+		"big":   types.Number(9007199254740992),
+		"small": types.Number(1.5),
+	}).Equals(v))
+
+	_, err = NomsValueFromJSON(o, Options{Numbers: NumbersExact})
+	suite.EqualError(err, "Number 9007199254740993 can't be represented exactly")
+
+	v, err = NomsValueFromJSON(map[string]interface{}{"small": json.Number("1.5")}, Options{Numbers: NumbersExact})
+	suite.NoError(err)
+	suite.True(types.NewMap(types.String("small"), types.Number(1.5)).Equals(v))
+
+	v, err = NomsValueFromJSON([]interface{}{json.Number("9007199254740993"), 2.5}, Options{Numbers: NumbersAsString})
+	suite.NoError(err)
+	suite.True(types.NewList(types.String("9007199254740993"), types.String("2.5")).Equals(v))
+
+	_, err = NomsValueFromJSON([]interface{}{json.Number("1e400")}, Options{})
+	suite.EqualError(err, "Number 1e400 is out of range")
+}
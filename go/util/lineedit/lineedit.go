@@ -0,0 +1,178 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package lineedit reads lines typed at a terminal, with history and tab-completion. When its input isn't a terminal, it reads plain lines, without a prompt.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user types Ctrl-C.
+var ErrInterrupted = errors.New("Interrupted")
+
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCR        = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Completer returns the lines that |line| could be completed to.
+type Completer func(line string) []string
+
+// Editor reads lines, showing Prompt before each one, and completing them with Complete when tab is pressed.
+type Editor struct {
+	Prompt   string
+	Complete Completer
+
+	in       *os.File
+	out      io.Writer
+	r        *bufio.Reader
+	terminal bool
+	history  []string
+}
+
+// New returns an Editor which reads from |in| and echoes to |out|. Lines are only edited if in is a terminal.
+func New(in *os.File, out io.Writer, prompt string, complete Completer) *Editor {
+	e := &Editor{Prompt: prompt, Complete: complete, in: in, out: out, r: bufio.NewReader(in)}
+	if state, err := makeRaw(in.Fd()); err == nil {
+		restore(in.Fd(), state)
+		e.terminal = true
+	}
+	return e
+}
+
+// ReadLine returns the next line, without its line ending, or io.EOF once the input ends, or the user types Ctrl-D on an empty line.
+func (e *Editor) ReadLine() (string, error) {
+	if !e.terminal {
+		line, err := e.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	state, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restore(e.in.Fd(), state)
+
+	line := []rune{}
+	hist := len(e.history)
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r\x1b[K%s%s", e.Prompt, string(line))
+	}
+	redraw()
+	for {
+		c, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\n")
+			s := string(line)
+			if strings.TrimSpace(s) != "" {
+				e.history = append(e.history, s)
+			}
+			return s, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyCtrlH:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				redraw()
+			}
+		case keyCtrlU:
+			line = line[:0]
+			redraw()
+		case keyTab:
+			if e.Complete == nil {
+				continue
+			}
+			completed, choices := Complete(string(line), e.Complete(string(line)))
+			if len(choices) > 1 {
+				fmt.Fprintf(e.out, "\n%s\n", strings.Join(choices, "  "))
+			}
+			line = []rune(completed)
+			redraw()
+		case keyEscape:
+			// Up and down arrows go through the history; other escape sequences are ignored.
+			if b, _ := e.r.ReadByte(); b != '[' {
+				continue
+			}
+			switch b, _ := e.r.ReadByte(); b {
+			case 'A':
+				if hist > 0 {
+					hist--
+					line = []rune(e.history[hist])
+				}
+			case 'B':
+				if hist < len(e.history) {
+					hist++
+					line = line[:0]
+					if hist < len(e.history) {
+						line = []rune(e.history[hist])
+					}
+				}
+			}
+			redraw()
+		default:
+			if c >= ' ' && c != utf8.RuneError {
+				line = append(line, c)
+				fmt.Fprint(e.out, string(c))
+			}
+		}
+	}
+}
+
+// Complete returns what |line| should be completed to given the lines it could complete to, |candidates|: the longest prefix they have in common, along with the parts of them after their last space or dot, to show as the choices, if there's more than one.
+func Complete(line string, candidates []string) (completed string, choices []string) {
+	if len(candidates) == 0 {
+		return line, nil
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		i := 0
+		for i < len(prefix) && i < len(c) && prefix[i] == c[i] {
+			i++
+		}
+		for i < len(prefix) && !utf8.RuneStart(prefix[i]) {
+			i--
+		}
+		prefix = prefix[:i]
+	}
+	if len(prefix) < len(line) {
+		prefix = line
+	}
+	if len(candidates) == 1 {
+		return prefix, nil
+	}
+	for _, c := range candidates {
+		trimmed := strings.TrimRight(c, " ")
+		choices = append(choices, trimmed[strings.LastIndexAny(trimmed, " .")+1:])
+	}
+	sort.Strings(choices)
+	return prefix, choices
+}
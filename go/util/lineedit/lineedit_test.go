@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	assert := assert.New(t)
+
+	completed, choices := Complete("sh", []string{"show "})
+	assert.Equal("show ", completed)
+	assert.Empty(choices)
+
+	completed, choices = Complete("show ds.v", []string{"show ds.value", "show ds.version"})
+	assert.Equal("show ds.v", completed)
+	assert.Equal([]string{"value", "version"}, choices)
+
+	completed, choices = Complete("show p", []string{"show photos-2016", "show photos-2015"})
+	assert.Equal("show photos-201", completed)
+	assert.Equal([]string{"photos-2015", "photos-2016"}, choices)
+
+	completed, choices = Complete("show x", nil)
+	assert.Equal("show x", completed)
+	assert.Empty(choices)
+
+	completed, _ = Complete("", []string{"héllo", "hèllo"})
+	assert.Equal("h", completed)
+}
+
+func TestReadLineNotTerminal(t *testing.T) {
+	assert := assert.New(t)
+	f, err := ioutil.TempFile("", "lineedit")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.WriteString("one\r\ntwo\nthree")
+	assert.NoError(err)
+	_, err = f.Seek(0, 0)
+	assert.NoError(err)
+
+	out := &bytes.Buffer{}
+	e := New(f, out, "> ", nil)
+	for _, expected := range []string{"one", "two", "three"} {
+		line, err := e.ReadLine()
+		assert.NoError(err)
+		assert.Equal(expected, line)
+	}
+	_, err = e.ReadLine()
+	assert.Equal(io.EOF, err)
+	assert.Empty(out.String())
+}
@@ -0,0 +1,20 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd
+
+package lineedit
+
+import "errors"
+
+type termState struct{}
+
+// makeRaw isn't supported here, so lines are read without editing.
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, errors.New("line editing isn't supported on this platform")
+}
+
+func restore(fd uintptr, state *termState) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// +build linux darwin freebsd openbsd netbsd
+
+package lineedit
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type termState struct {
+	termios syscall.Termios
+}
+
+func ioctlTermios(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw turns off echoing, line buffering and signals on the terminal |fd|, so that keys can be handled as they're typed, and returns its previous state, or an error if fd isn't a terminal. Output processing is left alone, so that "\n" still starts a new line.
+func makeRaw(fd uintptr) (*termState, error) {
+	var old termState
+	if err := ioctlTermios(fd, ioctlGetTermios, &old.termios); err != nil {
+		return nil, err
+	}
+	raw := old.termios
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func restore(fd uintptr, state *termState) error {
+	return ioctlTermios(fd, ioctlSetTermios, &state.termios)
+}
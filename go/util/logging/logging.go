@@ -0,0 +1,166 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package logging lets Noms packages log what they're doing, such as retrying root updates, the sizes of the batches of chunks they read and write, and operations that are slow, to a Logger set by the program embedding Noms, so that it ends up wherever the rest of the program's logs do. By default there's no Logger, and nothing is logged.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is how important a message is. Loggers are only told of messages at or above the level they're set with.
+type Level int
+
+const (
+	// LevelDebug is for messages about the details of what's being done, e.g. how many chunks are in a batch.
+	LevelDebug Level = iota
+	// LevelInfo is for messages about things worth knowing have been done, e.g. compacting a store.
+	LevelInfo
+	// LevelWarn is for messages about things that may be problems, e.g. slow operations.
+	LevelWarn
+	// LevelError is for messages about failures.
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("level%d", int(l))
+}
+
+// Field is a named value logged along with a message, e.g. the number of chunks in a batch.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a Field of |key| and |value|.
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// Logger is told of each message logged at or above the level it was set with. Log may be called by many goroutines at once, and operations wait for it, so it should return quickly.
+type Logger interface {
+	Log(level Level, msg string, fields []Field)
+}
+
+// LoggerFunc is a function that's a Logger.
+type LoggerFunc func(level Level, msg string, fields []Field)
+
+func (f LoggerFunc) Log(level Level, msg string, fields []Field) {
+	f(level, msg, fields)
+}
+
+type config struct {
+	l    Logger
+	min  Level
+	slow time.Duration
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(config{slow: time.Second})
+}
+
+func load() config {
+	return current.Load().(config)
+}
+
+// SetLogger makes |l| the Logger of messages at |min| or above, or if l is nil, stops anything being logged.
+func SetLogger(l Logger, min Level) {
+	c := load()
+	c.l, c.min = l, min
+	current.Store(c)
+}
+
+// SetSlowThreshold sets how long an operation has to take for Slow to log it. It's one second to start with.
+func SetSlowThreshold(d time.Duration) {
+	c := load()
+	c.slow = d
+	current.Store(c)
+}
+
+// Enabled returns true if messages at |level| are logged, so that callers can skip working out the fields of messages that wouldn't be.
+func Enabled(level Level) bool {
+	c := load()
+	return c.l != nil && level >= c.min
+}
+
+// Log logs |msg|, with |fields|, at |level|, if messages at that level are logged.
+func Log(level Level, msg string, fields ...Field) {
+	if c := load(); c.l != nil && level >= c.min {
+		c.l.Log(level, msg, fields)
+	}
+}
+
+// Debug logs |msg|, with |fields|, at LevelDebug.
+func Debug(msg string, fields ...Field) {
+	Log(LevelDebug, msg, fields...)
+}
+
+// Info logs |msg|, with |fields|, at LevelInfo.
+func Info(msg string, fields ...Field) {
+	Log(LevelInfo, msg, fields...)
+}
+
+// Warn logs |msg|, with |fields|, at LevelWarn.
+func Warn(msg string, fields ...Field) {
+	Log(LevelWarn, msg, fields...)
+}
+
+// Error logs |msg|, with |fields|, at LevelError.
+func Error(msg string, fields ...Field) {
+	Log(LevelError, msg, fields...)
+}
+
+// Slow logs |msg|, with |fields| and how long it's been since |start| as the field "elapsed", at LevelWarn, if that's at least the slow threshold. It's meant to be deferred by an operation that may be slow, e.g.
+//
+//  defer logging.Slow(time.Now(), "slow commit", logging.F("dataset", id))
+func Slow(start time.Time, msg string, fields ...Field) {
+	c := load()
+	if c.l == nil || LevelWarn < c.min {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= c.slow {
+		c.l.Log(LevelWarn, msg, append(fields, F("elapsed", elapsed)))
+	}
+}
+
+// textLogger writes each message on a line of its own, as its time, level and message, followed by its fields as key=value pairs.
+type textLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextLogger returns a Logger that writes messages to |w| as lines of text, e.g.
+//
+//  2016-11-09T15:04:05.000Z debug writing chunks to server chunks=128 bytes=524288
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w}
+}
+
+func (tl *textLogger) Log(level Level, msg string, fields []Field) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s %s", time.Now().UTC().Format("2006-01-02T15:04:05.000Z"), level, msg)
+	for _, f := range fields {
+		if s, ok := f.Value.(string); ok {
+			fmt.Fprintf(buf, " %s=%q", f.Key, s)
+		} else {
+			fmt.Fprintf(buf, " %s=%v", f.Key, f.Value)
+		}
+	}
+	buf.WriteByte('\n')
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.w.Write(buf.Bytes())
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package logging
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+type message struct {
+	level  Level
+	msg    string
+	fields []Field
+}
+
+func TestLogging(t *testing.T) {
+	assert := assert.New(t)
+	defer SetLogger(nil, LevelDebug)
+
+	// Nothing is logged to start with.
+	assert.False(Enabled(LevelError))
+	Error("nobody hears this")
+
+	logged := []message{}
+	SetLogger(LoggerFunc(func(level Level, msg string, fields []Field) {
+		logged = append(logged, message{level, msg, fields})
+	}), LevelInfo)
+	assert.False(Enabled(LevelDebug))
+	assert.True(Enabled(LevelWarn))
+	Debug("too detailed", F("chunks", 1))
+	Info("done", F("chunks", 2))
+	Warn("careful")
+	assert.Equal([]message{{LevelInfo, "done", []Field{{"chunks", 2}}}, {LevelWarn, "careful", nil}}, logged)
+
+	logged = nil
+	SetSlowThreshold(time.Hour)
+	Slow(time.Now(), "fast")
+	SetSlowThreshold(0)
+	Slow(time.Now(), "slow", F("op", "commit"))
+	SetSlowThreshold(time.Second)
+	assert.Len(logged, 1)
+	assert.Equal("slow", logged[0].msg)
+	assert.Equal(LevelWarn, logged[0].level)
+	assert.Equal("op", logged[0].fields[0].Key)
+	assert.Equal("elapsed", logged[0].fields[1].Key)
+
+	SetLogger(nil, LevelDebug)
+	assert.False(Enabled(LevelError))
+}
+
+func TestTextLogger(t *testing.T) {
+	assert := assert.New(t)
+	buf := &bytes.Buffer{}
+	l := NewTextLogger(buf)
+	l.Log(LevelDebug, "writing chunks", []Field{F("chunks", 128), F("path", "/write value/")})
+	l.Log(LevelError, "failed", nil)
+	assert.Regexp(regexp.MustCompile(`^\S+ debug writing chunks chunks=128 path="/write value/"\n\S+ error failed\n$`), buf.String())
+	assert.Equal("level7", Level(7).String())
+}
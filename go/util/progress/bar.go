@@ -0,0 +1,83 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stormasm/noms/go/util/status"
+	humanize "github.com/dustin/go-humanize"
+)
+
+const barWidth = 20
+
+// Bar is a Reporter that shows progress on the console, with the status package, as a line like "Syncing [=======             ] 37% 1,204 of 3,250 chunks, 12 MB (3.1 MB/s)". The bar is of chunks, or if their total isn't known, of bytes, or of values; if none of their totals are known, there's no bar, just the counts.
+type Bar struct {
+	label    string
+	start    time.Time
+	last     Progress
+	reported bool
+}
+
+// NewBar returns a Bar whose lines start with |label|.
+func NewBar(label string) *Bar {
+	return &Bar{label: label, start: time.Now()}
+}
+
+func (b *Bar) Report(p Progress) {
+	b.last, b.reported = p, true
+	if status.WillPrint() {
+		status.Printf("%s", b.line(p, time.Since(b.start)))
+	}
+}
+
+// Done shows the last progress reported, if there was any, and ends its line.
+func (b *Bar) Done() {
+	if !b.reported {
+		return
+	}
+	status.Printf("%s", b.line(b.last, time.Since(b.start)))
+	status.Done()
+}
+
+// line describes |p|, which has taken |elapsed| to make.
+func (b *Bar) line(p Progress, elapsed time.Duration) string {
+	parts := []string{b.label}
+	for _, c := range [][2]uint64{{p.Chunks, p.TotalChunks}, {p.Bytes, p.TotalBytes}, {p.Values, p.TotalValues}} {
+		if c[1] > 0 {
+			frac := float64(c[0]) / float64(c[1])
+			if frac > 1 {
+				frac = 1
+			}
+			filled := int(frac * barWidth)
+			parts = append(parts, fmt.Sprintf("[%s%s] %d%%", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), int(frac*100)))
+			break
+		}
+	}
+
+	counts := []string{}
+	count := func(done, total uint64, format func(uint64) string, unit string) {
+		switch {
+		case total > 0:
+			counts = append(counts, fmt.Sprintf("%s of %s%s", format(done), format(total), unit))
+		case done > 0:
+			counts = append(counts, format(done)+unit)
+		}
+	}
+	comma := func(n uint64) string { return humanize.Comma(int64(n)) }
+	count(p.Chunks, p.TotalChunks, comma, " chunks")
+	count(p.Bytes, p.TotalBytes, humanize.Bytes, "")
+	count(p.Values, p.TotalValues, comma, " values")
+	if len(counts) > 0 {
+		parts = append(parts, strings.Join(counts, ", "))
+	}
+
+	if p.Bytes > 0 && elapsed > 0 {
+		parts = append(parts, fmt.Sprintf("(%s/s)", humanize.Bytes(uint64(float64(p.Bytes)/elapsed.Seconds()))))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package progress lets long operations, such as pulls, imports and diffs, report how far they've got, and be canceled, through a context.Context.
+package progress
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Progress is how much of an operation has been done: how many chunks, bytes and values it's processed, and how many of each it knows there are to process in all, or 0 if it doesn't know.
+type Progress struct {
+	Chunks, Bytes, Values                uint64
+	TotalChunks, TotalBytes, TotalValues uint64
+}
+
+func (p Progress) add(delta Progress) Progress {
+	return Progress{
+		p.Chunks + delta.Chunks, p.Bytes + delta.Bytes, p.Values + delta.Values,
+		p.TotalChunks + delta.TotalChunks, p.TotalBytes + delta.TotalBytes, p.TotalValues + delta.TotalValues,
+	}
+}
+
+// Reporter is told the progress of an operation each time it changes. Report is called by one goroutine at a time, and operations wait for it, so it should return quickly.
+type Reporter interface {
+	Report(p Progress)
+}
+
+// ReporterFunc is a function that's a Reporter.
+type ReporterFunc func(p Progress)
+
+func (f ReporterFunc) Report(p Progress) {
+	f(p)
+}
+
+// Counter adds up the progress of an operation, which several goroutines can add to at once, and reports the total to a Reporter.
+type Counter struct {
+	mu sync.Mutex
+	p  Progress
+	r  Reporter
+}
+
+// NewCounter returns a Counter which reports to |r|, which may be nil.
+func NewCounter(r Reporter) *Counter {
+	return &Counter{r: r}
+}
+
+// Add adds |delta| to the progress, and reports it.
+func (c *Counter) Add(delta Progress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.p = c.p.add(delta)
+	if c.r != nil {
+		c.r.Report(c.p)
+	}
+}
+
+// Progress returns the progress so far.
+func (c *Counter) Progress() Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.p
+}
+
+type counterKey struct{}
+
+// WithReporter returns a copy of |ctx| in which the progress added by operations, with Add, is counted and reported to |r|.
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, counterKey{}, NewCounter(r))
+}
+
+// Add adds |delta| to the progress of the operation |ctx| is for, if it has a Reporter. Otherwise, it does nothing.
+func Add(ctx context.Context, delta Progress) {
+	if c, ok := ctx.Value(counterKey{}).(*Counter); ok {
+		c.Add(delta)
+	}
+}
+
+// WithInterrupt returns a copy of |ctx| which is canceled when the process is interrupted, e.g. by Ctrl-C, so that an operation using it can stop cleanly. A second interrupt kills the process as usual. The returned function stops listening for interrupts, and must be called when the operation is over.
+func WithInterrupt(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestAdd(t *testing.T) {
+	assert := assert.New(t)
+
+	// Without a Reporter, progress isn't counted.
+	Add(context.Background(), Progress{Chunks: 1})
+
+	reported := []Progress{}
+	ctx := WithReporter(context.Background(), ReporterFunc(func(p Progress) {
+		reported = append(reported, p)
+	}))
+	Add(ctx, Progress{TotalChunks: 3})
+	Add(ctx, Progress{Chunks: 1, Bytes: 10})
+	Add(ctx, Progress{Chunks: 2, Bytes: 20, Values: 5})
+	assert.Equal([]Progress{
+		{TotalChunks: 3},
+		{Chunks: 1, Bytes: 10, TotalChunks: 3},
+		{Chunks: 3, Bytes: 30, Values: 5, TotalChunks: 3},
+	}, reported)
+}
+
+func TestCounterConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	last := Progress{}
+	c := NewCounter(ReporterFunc(func(p Progress) {
+		// Reports are made one at a time, so they only ever go up.
+		assert.True(p.Values > last.Values)
+		last = p
+	}))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Add(Progress{Values: 1})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(Progress{Values: 1000}, c.Progress())
+	assert.Equal(c.Progress(), last)
+}
+
+func TestReader(t *testing.T) {
+	assert := assert.New(t)
+
+	var reported Progress
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = WithReporter(ctx, ReporterFunc(func(p Progress) {
+		reported = p
+	}))
+	b, err := ioutil.ReadAll(NewReader(ctx, bytes.NewReader(make([]byte, 1000))))
+	assert.NoError(err)
+	assert.Len(b, 1000)
+	assert.Equal(Progress{Bytes: 1000}, reported)
+
+	cancel()
+	_, err = ioutil.ReadAll(NewReader(ctx, bytes.NewReader(make([]byte, 1000))))
+	assert.Equal(context.Canceled, err)
+	assert.Equal(Progress{Bytes: 1000}, reported)
+}
+
+func TestWithInterrupt(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, stop := WithInterrupt(context.Background())
+	defer stop()
+	assert.NoError(ctx.Err())
+	assert.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	select {
+	case <-ctx.Done():
+		assert.Equal(context.Canceled, ctx.Err())
+	case <-time.After(10 * time.Second):
+		assert.Fail("Interrupting didn't cancel the context")
+	}
+
+	ctx, stop = WithInterrupt(context.Background())
+	stop()
+	assert.Equal(context.Canceled, ctx.Err())
+}
+
+func TestBarLine(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBar("Syncing")
+	assert.Equal("Syncing", b.line(Progress{}, time.Second))
+	assert.Equal("Syncing [=====               ] 25% 1 of 4 chunks, 2.0 kB (2.0 kB/s)", b.line(Progress{Chunks: 1, TotalChunks: 4, Bytes: 2000}, time.Second))
+	assert.Equal("Syncing [====================] 100% 5 of 4 chunks", b.line(Progress{Chunks: 5, TotalChunks: 4}, time.Second))
+	// Without a total of chunks, the bar is of bytes, or values.
+	assert.Equal("Syncing [==========          ] 50% 3 chunks, 1.0 kB of 2.0 kB (500 B/s)", b.line(Progress{Chunks: 3, Bytes: 1000, TotalBytes: 2000}, 2*time.Second))
+	assert.Equal("Importing [==                  ] 10% 1,000 of 10,000 values", NewBar("Importing").line(Progress{Values: 1000, TotalValues: 10000}, time.Second))
+	assert.Equal("Importing 12,345 values", NewBar("Importing").line(Progress{Values: 12345}, time.Second))
+}
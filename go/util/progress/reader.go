@@ -0,0 +1,31 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"context"
+	"io"
+)
+
+// NewReader returns an io.Reader that reads from |inner|, adding the bytes it reads to the progress of |ctx|, and which fails with ctx.Err() once |ctx| is canceled, so that whatever's reading it stops.
+func NewReader(ctx context.Context, inner io.Reader) io.Reader {
+	return &reader{ctx, inner}
+}
+
+type reader struct {
+	ctx   context.Context
+	inner io.Reader
+}
+
+func (r *reader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err = r.inner.Read(p)
+	if n > 0 {
+		Add(r.ctx, Progress{Bytes: uint64(n)})
+	}
+	return
+}
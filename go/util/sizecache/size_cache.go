@@ -60,6 +60,17 @@ func (c *SizeCache) Get(key interface{}) (interface{}, bool) {
 	return nil, false
 }
 
+// GetWithSize() is like Get(), but also returns the size the entry was added with.
+func (c *SizeCache) GetWithSize(key interface{}) (interface{}, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entry(key); ok {
+		return entry.value, entry.size, true
+	}
+	return nil, 0, false
+}
+
 // Add will add this element to the cache at the back of the queue as long it's
 // size does not exceed maxSize. If the addition of this entry causes the size of
 // the cache to exceed maxSize, the necessary entries at the front of the queue
@@ -0,0 +1,88 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package tracing lets Noms trace the operations that take time, such as pulls, commits and the requests a remote database makes of its server, as spans, tagged with the numbers of chunks and bytes they move, so that services that use Noms can see where their time goes. Spans are made by a Tracer set by the program embedding Noms, typically one that adapts OpenTracing or OpenTelemetry, so that they go wherever the program's other spans do. They're carried from an operation to those it does in context.Contexts, and from a client to a server in the headers of its requests, if the Tracer is a HeaderTracer. By default there's no Tracer, and spans cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// Span is an operation being traced.
+type Span interface {
+	// SetTag records |value| as |key| of the span, e.g. how many chunks the operation read.
+	SetTag(key string, value interface{})
+	// Finish ends the span. It's called once, and the span isn't used again.
+	Finish()
+}
+
+// Tracer makes Spans. It's used by many goroutines at once.
+type Tracer interface {
+	// StartSpan starts a span named |name|, whose parent is the span in |ctx|, if there is one, and returns a copy of ctx with the new span in it.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// HeaderTracer is a Tracer that can carry spans across HTTP requests, so that the spans of a server are children of those of the client that made the requests.
+type HeaderTracer interface {
+	Tracer
+	// Inject writes what identifies the span in |ctx|, if there is one, into |h|.
+	Inject(ctx context.Context, h http.Header)
+	// Extract returns a copy of |ctx| in which the span written into |h| by Inject, if there is one, is the parent of the spans started from it.
+	Extract(ctx context.Context, h http.Header) context.Context
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) Finish()                              {}
+
+// tracerBox holds the Tracer, so that it can be swapped atomically, even for nil.
+type tracerBox struct {
+	t Tracer
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(tracerBox{})
+}
+
+func tracer() Tracer {
+	return current.Load().(tracerBox).t
+}
+
+// SetTracer makes |t| the Tracer of the spans started from now on, or if t is nil, stops spans being traced. A server traces the requests it serves only if it's run while there's a Tracer.
+func SetTracer(t Tracer) {
+	current.Store(tracerBox{t})
+}
+
+// Enabled returns true if there's a Tracer, so that callers can skip working out tags of spans that wouldn't be traced.
+func Enabled() bool {
+	return tracer() != nil
+}
+
+// Start starts a span named |name|, a child of the span in |ctx|, if there is one, and returns a copy of ctx with it in it. The span does nothing if there's no Tracer.
+func Start(ctx context.Context, name string) (context.Context, Span) {
+	if t := tracer(); t != nil {
+		return t.StartSpan(ctx, name)
+	}
+	return ctx, noopSpan{}
+}
+
+// Inject writes the span in |ctx| into |h|, if the Tracer is a HeaderTracer.
+func Inject(ctx context.Context, h http.Header) {
+	if ht, ok := tracer().(HeaderTracer); ok {
+		ht.Inject(ctx, h)
+	}
+}
+
+// Extract returns a copy of |ctx| whose spans are children of the span in |h|, if the Tracer is a HeaderTracer and Inject wrote one there. Otherwise, it returns ctx.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if ht, ok := tracer().(HeaderTracer); ok {
+		return ht.Extract(ctx, h)
+	}
+	return ctx
+}
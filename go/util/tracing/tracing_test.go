@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	name, parent string
+	tags         map[string]interface{}
+	finished     bool
+}
+
+func (s *testSpan) SetTag(key string, value interface{}) { s.tags[key] = value }
+func (s *testSpan) Finish()                              { s.finished = true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	s := &testSpan{name: name, tags: map[string]interface{}{}}
+	if p, ok := ctx.Value(spanKey{}).(*testSpan); ok {
+		s.parent = p.name
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+type testHeaderTracer struct {
+	testTracer
+}
+
+func (t *testHeaderTracer) Inject(ctx context.Context, h http.Header) {
+	if s, ok := ctx.Value(spanKey{}).(*testSpan); ok {
+		h.Set("X-Span", s.name)
+	}
+}
+
+func (t *testHeaderTracer) Extract(ctx context.Context, h http.Header) context.Context {
+	if name := h.Get("X-Span"); name != "" {
+		return context.WithValue(ctx, spanKey{}, &testSpan{name: name})
+	}
+	return ctx
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+	defer SetTracer(nil)
+
+	// Nothing is traced to start with.
+	assert.False(Enabled())
+	ctx, span := Start(context.Background(), "untraced")
+	assert.Equal(context.Background(), ctx)
+	span.SetTag("chunks", 1)
+	span.Finish()
+	h := http.Header{}
+	Inject(ctx, h)
+	assert.Empty(h)
+	assert.Equal(ctx, Extract(ctx, h))
+
+	tr := &testTracer{}
+	SetTracer(tr)
+	assert.True(Enabled())
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.SetTag("chunks", 2)
+	child.Finish()
+	parent.Finish()
+	assert.Len(tr.spans, 2)
+	assert.Equal("parent", tr.spans[1].parent)
+	assert.Equal(2, tr.spans[1].tags["chunks"])
+	assert.True(tr.spans[0].finished)
+
+	// A Tracer that isn't a HeaderTracer doesn't touch headers.
+	Inject(ctx, h)
+	assert.Empty(h)
+
+	SetTracer(nil)
+	assert.False(Enabled())
+}
+
+func TestHeaderTracer(t *testing.T) {
+	assert := assert.New(t)
+	defer SetTracer(nil)
+
+	tr := &testHeaderTracer{}
+	SetTracer(tr)
+	ctx, _ := Start(context.Background(), "client")
+	h := http.Header{}
+	Inject(ctx, h)
+	assert.Equal("client", h.Get("X-Span"))
+
+	_, server := Start(Extract(context.Background(), h), "server")
+	server.Finish()
+	assert.Equal("client", tr.spans[1].parent)
+}
@@ -0,0 +1,338 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package valueformat writes Noms values in formats other programs understand: JSON, YAML and EDN.
+package valueformat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/types"
+)
+
+// Formats are the names of the formats Write supports.
+var Formats = []string{"json", "yaml", "edn"}
+
+// Write writes |v| to |w| in |format|, followed by a newline.
+//
+// Lists, Sets and Tuples become arrays, except that Sets become sets in EDN. Structs and Maps whose keys are all Strings become objects; struct names are dropped. Other Maps become arrays of [key, value] pairs, except in EDN, which has maps with keys of any kind. Blobs become base64 strings, Types their description, Counters and LWWRegisters the value they hold, and Encrypteds a string saying which key they're encrypted with, since they can't be decrypted here.
+//
+// Refs are read from |vr| and written in place of the Ref, down to |expandRefs| Refs deep. Refs deeper than that, or whose target |vr| doesn't have, are written as "#" followed by the hash they refer to.
+func Write(w io.Writer, v types.Value, format string, vr types.ValueReader, expandRefs int) error {
+	n := convert(v, vr, expandRefs)
+	switch format {
+	case "json":
+		return writeJSON(w, n)
+	case "yaml":
+		return writeYAML(w, n)
+	case "edn":
+		return writeEDN(w, n)
+	}
+	return fmt.Errorf("Unknown format %s, must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+// ToJSON returns |v|, with Refs expanded as Write expands them, as something encoding/json marshals the way Write writes v in JSON, so that values can be put in bigger JSON documents.
+func ToJSON(v types.Value, vr types.ValueReader, expandRefs int) interface{} {
+	return toJSON(convert(v, vr, expandRefs))
+}
+
+// The formats are written from a tree of these, plus bool, float64 and string.
+type (
+	array  []interface{}
+	set    []interface{}
+	blob   []byte
+	ref    string
+	pairs  [][2]interface{}
+	object struct {
+		keys []string
+		vals []interface{}
+		// fields is true if keys are the names of struct fields.
+		fields bool
+	}
+)
+
+func convert(v types.Value, vr types.ValueReader, expandRefs int) interface{} {
+	conv := func(v types.Value) interface{} {
+		return convert(v, vr, expandRefs)
+	}
+	switch v := v.(type) {
+	case types.Bool:
+		return bool(v)
+	case types.Number:
+		return float64(v)
+	case types.Counter:
+		return float64(v)
+	case types.String:
+		return string(v)
+	case types.Blob:
+		data, err := ioutil.ReadAll(v.Reader())
+		d.PanicIfError(err)
+		return blob(data)
+	case types.List:
+		a := array{}
+		v.IterAll(func(v types.Value, idx uint64) {
+			a = append(a, conv(v))
+		})
+		return a
+	case types.Tuple:
+		a := array{}
+		v.IterAll(func(v types.Value, idx uint64) {
+			a = append(a, conv(v))
+		})
+		return a
+	case types.Set:
+		s := set{}
+		v.IterAll(func(v types.Value) {
+			s = append(s, conv(v))
+		})
+		return s
+	case types.Map:
+		o := &object{}
+		ps := pairs{}
+		stringKeys := true
+		v.IterAll(func(k, v types.Value) {
+			if s, ok := k.(types.String); ok {
+				o.keys = append(o.keys, string(s))
+				o.vals = append(o.vals, conv(v))
+			} else {
+				stringKeys = false
+			}
+			ps = append(ps, [2]interface{}{conv(k), conv(v)})
+		})
+		if stringKeys {
+			return o
+		}
+		return ps
+	case types.Struct:
+		o := &object{fields: true}
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, t *types.Type) {
+			o.keys = append(o.keys, name)
+			o.vals = append(o.vals, conv(v.Get(name)))
+		})
+		return o
+	case types.LWWRegister:
+		return conv(v.Get())
+	case types.Ref:
+		if expandRefs > 0 {
+			if target := vr.ReadValue(v.TargetHash()); target != nil {
+				return convert(target, vr, expandRefs-1)
+			}
+		}
+		return ref(v.TargetHash().String())
+	case *types.Type:
+		return v.Describe()
+	case types.Encrypted:
+		return types.EncodedValue(v)
+	}
+	panic(fmt.Sprintf("unexpected value of type %s", v.Type().Describe()))
+}
+
+// toJSON returns n as something encoding/json can marshal.
+func toJSON(n interface{}) interface{} {
+	switch n := n.(type) {
+	case array:
+		a := make([]interface{}, len(n))
+		for i, e := range n {
+			a[i] = toJSON(e)
+		}
+		return a
+	case set:
+		return toJSON(array(n))
+	case blob:
+		return []byte(n)
+	case ref:
+		return "#" + string(n)
+	case pairs:
+		a := make([]interface{}, len(n))
+		for i, p := range n {
+			a[i] = []interface{}{toJSON(p[0]), toJSON(p[1])}
+		}
+		return a
+	case *object:
+		return jsonObject{n}
+	}
+	return n
+}
+
+// jsonObject marshals an object with its keys in order, which a map[string]interface{} wouldn't.
+type jsonObject struct {
+	*object
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(toJSON(o.vals[i]))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSON(w io.Writer, n interface{}) error {
+	data, err := json.MarshalIndent(toJSON(n), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+func quote(s string) string {
+	data, err := json.Marshal(s)
+	d.PanicIfError(err)
+	return string(data)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// yamlScalar returns n as a YAML scalar, or false if n is a non-empty collection. Empty collections are written in flow style, since block style can't express them.
+func yamlScalar(n interface{}) (string, bool) {
+	switch n := n.(type) {
+	case bool:
+		return strconv.FormatBool(n), true
+	case float64:
+		return formatNumber(n), true
+	case string:
+		return quote(n), true
+	case blob:
+		return "!!binary " + quote(base64.StdEncoding.EncodeToString(n)), true
+	case ref:
+		return quote("#" + string(n)), true
+	case array:
+		return "[]", len(n) == 0
+	case set:
+		return "[]", len(n) == 0
+	case pairs:
+		return "[]", len(n) == 0
+	case *object:
+		return "{}", len(n.keys) == 0
+	}
+	panic("unreachable")
+}
+
+func writeYAML(w io.Writer, n interface{}) error {
+	buf := &bytes.Buffer{}
+	if s, ok := yamlScalar(n); ok {
+		fmt.Fprintln(buf, s)
+	} else {
+		writeYAMLBlock(buf, n, "")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeYAMLBlock writes the non-empty collection |n| in block style, each line starting with |indent|.
+func writeYAMLBlock(buf *bytes.Buffer, n interface{}, indent string) {
+	entry := func(prefix string, v interface{}) {
+		if s, ok := yamlScalar(v); ok {
+			fmt.Fprintf(buf, "%s%s %s\n", indent, prefix, s)
+			return
+		}
+		fmt.Fprintf(buf, "%s%s\n", indent, prefix)
+		writeYAMLBlock(buf, v, indent+"  ")
+	}
+	switch n := n.(type) {
+	case array:
+		for _, e := range n {
+			entry("-", e)
+		}
+	case set:
+		writeYAMLBlock(buf, array(n), indent)
+	case pairs:
+		for _, p := range n {
+			entry("-", array{p[0], p[1]})
+		}
+	case *object:
+		for i, k := range n.keys {
+			entry(quote(k)+":", n.vals[i])
+		}
+	}
+}
+
+func writeEDN(w io.Writer, n interface{}) error {
+	buf := &bytes.Buffer{}
+	writeEDNValue(buf, n)
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ednString quotes s as an EDN string, which only has escapes for quotes, backslashes and a few whitespace characters.
+func ednString(s string) string {
+	return `"` + strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
+
+func writeEDNValue(buf *bytes.Buffer, n interface{}) {
+	seq := func(open, close string, elems []interface{}) {
+		buf.WriteString(open)
+		for i, e := range elems {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeEDNValue(buf, e)
+		}
+		buf.WriteString(close)
+	}
+	switch n := n.(type) {
+	case bool:
+		buf.WriteString(strconv.FormatBool(n))
+	case float64:
+		buf.WriteString(formatNumber(n))
+	case string:
+		buf.WriteString(ednString(n))
+	case blob:
+		buf.WriteString("#noms/blob " + ednString(base64.StdEncoding.EncodeToString(n)))
+	case ref:
+		buf.WriteString("#noms/ref " + ednString(string(n)))
+	case array:
+		seq("[", "]", n)
+	case set:
+		seq("#{", "}", n)
+	case pairs:
+		kvs := make([]interface{}, 0, len(n)*2)
+		for _, p := range n {
+			kvs = append(kvs, p[0], p[1])
+		}
+		seq("{", "}", kvs)
+	case *object:
+		buf.WriteByte('{')
+		for i, k := range n.keys {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			if n.fields {
+				buf.WriteString(":" + k)
+			} else {
+				buf.WriteString(ednString(k))
+			}
+			buf.WriteByte(' ')
+			writeEDNValue(buf, n.vals[i])
+		}
+		buf.WriteByte('}')
+	}
+}
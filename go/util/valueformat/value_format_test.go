@@ -0,0 +1,107 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package valueformat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/types"
+)
+
+func write(v types.Value, format string, vr types.ValueReader, expandRefs int) string {
+	buf := &bytes.Buffer{}
+	err := Write(buf, v, format, vr, expandRefs)
+	if err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+func testValue() types.Value {
+	return types.NewStruct("Photo", types.StructData{
+		"title": types.String("Beach \"day\""),
+		"tags":  types.NewSet(types.String("sea")),
+		"size":  types.NewList(types.Number(640), types.Number(480.5)),
+		"seen":  types.Bool(true),
+		"exif":  types.NewMap(),
+		"faces": types.NewMap(types.Number(1), types.String("bob")),
+		"data":  types.NewBlob(strings.NewReader("hi")),
+	})
+}
+
+func TestJSON(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`{
+  "data": "aGk=",
+  "exif": {},
+  "faces": [
+    [
+      1,
+      "bob"
+    ]
+  ],
+  "seen": true,
+  "size": [
+    640,
+    480.5
+  ],
+  "tags": [
+    "sea"
+  ],
+  "title": "Beach \"day\""
+}
+`, write(testValue(), "json", nil, 0))
+}
+
+func TestYAML(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`"data": !!binary "aGk="
+"exif": {}
+"faces":
+  -
+    - 1
+    - "bob"
+"seen": true
+"size":
+  - 640
+  - 480.5
+"tags":
+  - "sea"
+"title": "Beach \"day\""
+`, write(testValue(), "yaml", nil, 0))
+	assert.Equal("[]\n", write(types.NewList(), "yaml", nil, 0))
+	assert.Equal("42\n", write(types.Number(42), "yaml", nil, 0))
+}
+
+func TestEDN(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`{:data #noms/blob "aGk=" :exif {} :faces {1 "bob"} :seen true :size [640 480.5] :tags #{"sea"} :title "Beach \"day\""}`+"\n", write(testValue(), "edn", nil, 0))
+	assert.Equal(`{"a\nb" 1}`+"\n", write(types.NewMap(types.String("a\nb"), types.Number(1)), "edn", nil, 0))
+}
+
+func TestExpandRefs(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(chunks.NewMemoryStore()))
+	inner := vs.WriteValue(types.String("inner"))
+	outer := vs.WriteValue(types.NewList(inner))
+	v := types.NewList(outer)
+
+	h := inner.TargetHash().String()
+	assert.Equal(`[["inner"]]`+"\n", write(v, "edn", vs, 2))
+	assert.Equal(`[[#noms/ref "`+h+`"]]`+"\n", write(v, "edn", vs, 1))
+	assert.Equal("[\n  [\n    \"#"+h+"\"\n  ]\n]\n", write(v, "json", vs, 1))
+	assert.Equal("-\n  - \"#"+h+"\"\n", write(v, "yaml", vs, 1))
+
+	missing := types.NewRef(types.String("never written"))
+	assert.Equal("\"#"+missing.TargetHash().String()+"\"\n", write(missing, "json", vs, 1))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	assert.Equal(t, "Unknown format xml, must be one of json, yaml, edn", write(types.Number(1), "xml", nil, 0))
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package view maintains materialized views: datasets whose values are derived from the Map at the head of another dataset, their source, e.g. a filtered copy of it, or a total of its values. A view is brought up to date by feeding its transformation only the entries of the source that have changed since the head it was last made from, and committing the result with that head recorded in the commit's meta. Since the commit fails if anything else has committed to the view in the meantime, and is then retried from the view's new head, each head of the source is applied to the view exactly once, however many processes keep it up to date.
+package view
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+const (
+	// sourceField is the field of the meta of a view's commits that is the commit of the source it was made from.
+	sourceField = "source"
+	// sourceDatasetField is the field of the meta of a view's commits that is the ID of its source.
+	sourceDatasetField = "sourceDataset"
+)
+
+// Change is a change to an entry of the source of a view: its Key, and its value before the change, Old, and after it, New. Old is nil if the entry was added, and New is nil if it was removed.
+type Change struct {
+	Key, Old, New types.Value
+}
+
+// View describes a materialized view.
+type View struct {
+	// Name is the ID of the dataset the view is kept in.
+	Name string
+	// Source is the ID of the dataset the view is derived from, whose head's value must be a Map.
+	Source string
+	// Init is the value of the view of an empty Map.
+	Init types.Value
+	// Apply returns the value of the view |view| after the change |c| to its source. It's called with each entry of the source that changes, in order of their keys, and should be quick, since Update calls it again if it has to retry.
+	Apply func(view types.Value, c Change) types.Value
+}
+
+// MapValues returns a View named |name| which is a Map of the entries of |source| that |f| keeps, each with the value f makes of it. f returns false for entries that aren't to be kept, so a View that filters its source returns the entries' values unchanged.
+func MapValues(name, source string, f func(k, v types.Value) (types.Value, bool)) View {
+	return View{name, source, types.NewMap(), func(view types.Value, c Change) types.Value {
+		m := view.(types.Map)
+		if c.New != nil {
+			if v, ok := f(c.Key, c.New); ok {
+				return m.Set(c.Key, v)
+			}
+		}
+		return m.Remove(c.Key)
+	}}
+}
+
+// Aggregate returns a View named |name| which aggregates the entries of |source|, starting from |init|. |add| returns an aggregate with the entry |k|, |v| added to it, and |remove| returns it with the entry removed; a changed entry is removed and then added again. E.g. a count is |add|ed 1 and has 1 |remove|d for each entry.
+func Aggregate(name, source string, init types.Value, add, remove func(agg, k, v types.Value) types.Value) View {
+	return View{name, source, init, func(view types.Value, c Change) types.Value {
+		if c.Old != nil {
+			view = remove(view, c.Key, c.Old)
+		}
+		if c.New != nil {
+			view = add(view, c.Key, c.New)
+		}
+		return view
+	}}
+}
+
+// Update brings |v| up to date with the head of its source, and returns the dataset the view is kept in. If the view was made from an earlier head, only the entries that have changed since are applied to it; otherwise it's made from Init. Each commit to the view has a meta struct with the commit of the source it was made from, as source, and the source's ID, as sourceDataset.
+func Update(db datas.Database, v View) (datas.Dataset, error) {
+	for {
+		vds := db.GetDataset(v.Name)
+		head, ok := db.GetDataset(v.Source).MaybeHead()
+		if !ok {
+			return vds, fmt.Errorf("Dataset %s has no head to make view %s from", v.Source, v.Name)
+		}
+		m, ok := head.Get(datas.ValueField).(types.Map)
+		if !ok {
+			return vds, fmt.Errorf("Can't make view %s from dataset %s, because its value is a %s, not a Map", v.Name, v.Source, head.Get(datas.ValueField).Type().Describe())
+		}
+
+		value, last := v.Init, types.NewMap()
+		if viewHead, ok := vds.MaybeHead(); ok {
+			source, ok := viewHead.Get(datas.MetaField).(types.Struct).MaybeGet(sourceField)
+			if !ok {
+				return vds, fmt.Errorf("Dataset %s isn't a view", v.Name)
+			}
+			if source.(types.Ref).TargetHash() == head.Hash() {
+				return vds, nil
+			}
+			// If the last head wasn't a Map, there's nothing to diff with, so the view is made again.
+			if lastMap, ok := source.(types.Ref).TargetValue(db).(types.Struct).Get(datas.ValueField).(types.Map); ok {
+				value, last = viewHead.Get(datas.ValueField), lastMap
+			}
+		}
+
+		changes := make(chan types.ValueChanged)
+		go func() {
+			m.Diff(last, changes, nil)
+			close(changes)
+		}()
+		for c := range changes {
+			change := Change{Key: c.V}
+			if c.ChangeType != types.DiffChangeAdded {
+				change.Old = last.Get(c.V)
+			}
+			if c.ChangeType != types.DiffChangeRemoved {
+				change.New = m.Get(c.V)
+			}
+			value = v.Apply(value, change)
+		}
+
+		meta := types.NewStruct("Meta", types.StructData{
+			sourceField:        types.NewRef(head),
+			sourceDatasetField: types.String(v.Source),
+		})
+		vds, err := db.Commit(vds, value, datas.CommitOptions{Meta: meta})
+		if err != datas.ErrMergeNeeded {
+			return vds, err
+		}
+		// Something else has committed to the view since it was read, so it's read again, in case that was this head being applied.
+		db.Rebase()
+	}
+}
+
+// Commit commits |v| to |ds| with |opts|, as db.Commit does, and then updates each of |views|, which should have ds as their source. The returned Dataset is ds after the commit; if a view can't be updated, the error says which.
+func Commit(db datas.Database, ds datas.Dataset, v types.Value, opts datas.CommitOptions, views ...View) (datas.Dataset, error) {
+	ds, err := db.Commit(ds, v, opts)
+	if err != nil {
+		return ds, err
+	}
+	for _, view := range views {
+		if _, err := Update(db, view); err != nil {
+			return ds, fmt.Errorf("Updating view %s: %s", view.Name, err)
+		}
+	}
+	return ds, nil
+}
+
+// Follow keeps |v| up to date with its source, updating it now, if the source has a head, and then each time the source's head changes, as datas.WatchHead sees, checking every |interval| if it has to. After each update, it calls |f| with the view's dataset and the error, if any, from Update, and stops once f returns false.
+func Follow(db datas.Database, v View, interval time.Duration, f func(ds datas.Dataset, err error) bool) {
+	db.Rebase()
+	if _, ok := db.GetDataset(v.Source).MaybeHeadRef(); ok {
+		if !f(Update(db, v)) {
+			return
+		}
+	}
+	datas.WatchHead(db, v.Source, interval, func(old, new datas.Dataset) bool {
+		if _, ok := new.MaybeHeadRef(); !ok {
+			return true
+		}
+		return f(Update(db, v))
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package view
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/chunks"
+	"github.com/stormasm/noms/go/datas"
+	"github.com/stormasm/noms/go/types"
+)
+
+func order(total float64, paid bool) types.Struct {
+	return types.NewStruct("Order", types.StructData{"total": types.Number(total), "paid": types.Bool(paid)})
+}
+
+var (
+	unpaid = MapValues("unpaid", "orders", func(k, v types.Value) (types.Value, bool) {
+		return v.(types.Struct).Get("total"), !bool(v.(types.Struct).Get("paid").(types.Bool))
+	})
+	total = Aggregate("total", "orders", types.Number(0), func(agg, k, v types.Value) types.Value {
+		return agg.(types.Number) + v.(types.Struct).Get("total").(types.Number)
+	}, func(agg, k, v types.Value) types.Value {
+		return agg.(types.Number) - v.(types.Struct).Get("total").(types.Number)
+	})
+)
+
+func TestView(t *testing.T) {
+	assert := assert.New(t)
+	db := datas.NewDatabase(chunks.NewMemoryStore())
+	defer db.Close()
+
+	orders := types.NewMap(
+		types.String("a"), order(10, true),
+		types.String("b"), order(20, false),
+		types.String("c"), order(30, false),
+	)
+	ds, err := Commit(db, db.GetDataset("orders"), orders, datas.CommitOptions{}, unpaid, total)
+	assert.NoError(err)
+	assert.True(types.NewMap(types.String("b"), types.Number(20), types.String("c"), types.Number(30)).Equals(db.GetDataset("unpaid").HeadValue()))
+	assert.Equal(types.Number(60), db.GetDataset("total").HeadValue())
+
+	// Only the changes are applied, so a view that can't reapply what it's already applied shows they weren't.
+	applied := 0
+	counting := View{"counting", "orders", types.Number(0), func(view types.Value, c Change) types.Value {
+		applied++
+		return view.(types.Number) + 1
+	}}
+	_, err = Update(db, counting)
+	assert.NoError(err)
+	assert.Equal(3, applied)
+
+	orders = orders.Set(types.String("b"), order(20, true)).Set(types.String("d"), order(5, false)).Remove(types.String("c"))
+	ds, err = Commit(db, ds, orders, datas.CommitOptions{}, unpaid, total, counting)
+	assert.NoError(err)
+	assert.True(types.NewMap(types.String("d"), types.Number(5)).Equals(db.GetDataset("unpaid").HeadValue()))
+	assert.Equal(types.Number(35), db.GetDataset("total").HeadValue())
+	assert.Equal(6, applied)
+
+	// Each head of the source is applied once, and recorded in the meta.
+	_, err = Update(db, counting)
+	assert.NoError(err)
+	assert.Equal(6, applied)
+	head := db.GetDataset("counting").Head()
+	meta := head.Get(datas.MetaField).(types.Struct)
+	assert.Equal(ds.HeadRef().TargetHash(), meta.Get(sourceField).(types.Ref).TargetHash())
+	assert.Equal(types.String("orders"), meta.Get(sourceDatasetField))
+	assert.Equal(uint64(1), head.Get(datas.ParentsField).(types.Set).Len())
+
+	_, err = Update(db, View{"orders", "nothing", types.NewMap(), nil})
+	assert.Error(err)
+	_, err = Update(db, View{"orders", "counting", types.NewMap(), nil})
+	assert.Error(err)
+	_, err = Update(db, View{"counting", "orders", types.NewMap(), nil})
+	assert.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("other"), types.Number(1))
+	assert.NoError(err)
+	_, err = Update(db, View{"total", "other", types.NewMap(), nil})
+	assert.Error(err)
+}
+
+func TestViewUpdatedConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	db, other := datas.NewDatabase(cs), datas.NewDatabase(cs)
+	defer db.Close()
+
+	_, err := db.CommitValue(db.GetDataset("orders"), types.NewMap(types.String("a"), order(10, false)))
+	assert.NoError(err)
+	// other updates the view after db reads it, so db's commit fails and is retried, finding the head's been applied.
+	calls := 0
+	racing := total
+	racing.Apply = func(view types.Value, c Change) types.Value {
+		calls++
+		if calls == 1 {
+			other.Rebase()
+			_, err := Update(other, total)
+			assert.NoError(err)
+		}
+		return total.Apply(view, c)
+	}
+	ds, err := Update(db, racing)
+	assert.NoError(err)
+	assert.Equal(types.Number(10), ds.HeadValue())
+	assert.True(ds.Head().Get(datas.ParentsField).(types.Set).Empty())
+}
+
+func TestFollow(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewMemoryStore()
+	db, writer := datas.NewDatabase(cs), datas.NewDatabase(cs)
+	defer db.Close()
+
+	ds, err := writer.CommitValue(writer.GetDataset("orders"), types.NewMap(types.String("a"), order(10, false)))
+	assert.NoError(err)
+	totals := []types.Value{}
+	Follow(db, total, 10*time.Millisecond, func(vds datas.Dataset, err error) bool {
+		assert.NoError(err)
+		totals = append(totals, vds.HeadValue())
+		if len(totals) == 1 {
+			_, err = writer.CommitValue(ds, ds.HeadValue().(types.Map).Set(types.String("b"), order(5, false)))
+			assert.NoError(err)
+		}
+		return len(totals) < 2
+	})
+	assert.Equal([]types.Value{types.Number(10), types.Number(15)}, totals)
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package walk
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/stormasm/noms/go/d"
+	"github.com/stormasm/noms/go/hash"
+	"github.com/stormasm/noms/go/types"
+)
+
+// VisitAction tells Walk how to proceed after a Visitor has seen a value.
+type VisitAction uint8
+
+const (
+	// Continue walks the children of the value as usual.
+	Continue VisitAction = iota
+	// SkipChildren doesn't descend into the value, but continues with its siblings.
+	SkipChildren
+	// Stop ends the walk as soon as possible.
+	Stop
+)
+
+// Visitor is called by Walk for every value it reaches. |depth| is the
+// number of Refs that were followed from the root to reach |v|, so inline
+// values have the same depth as the chunk they are contained in.
+//
+// If Options.Concurrency is greater than 1, Visit is called concurrently from
+// multiple goroutines.
+type Visitor interface {
+	Visit(v types.Value, depth int) VisitAction
+}
+
+// VisitorFunc adapts an ordinary function to the Visitor interface.
+type VisitorFunc func(v types.Value, depth int) VisitAction
+
+func (f VisitorFunc) Visit(v types.Value, depth int) VisitAction {
+	return f(v, depth)
+}
+
+// Options control how Walk traverses a graph. The zero value walks the whole
+// graph sequentially, visiting every value.
+type Options struct {
+	// MaxDepth is the maximum number of Refs followed from the root. Refs
+	// beyond that depth are still visited, but their targets are not loaded.
+	// Zero means unlimited.
+	MaxDepth int
+	// Kinds, if not empty, restricts the values passed to the Visitor to those
+	// of the given kinds. Values of other kinds are still traversed.
+	Kinds []types.NomsKind
+	// Concurrency is the maximum number of chunks loaded and processed at
+	// once. Values of 0 or 1 walk on the calling goroutine only.
+	Concurrency int
+}
+
+// Walk traverses all values reachable from |target|, loading the targets of
+// Refs from |vr| and calling |visitor| on each value. Each chunk is visited at
+// most once, no matter how many Refs point to it. When Options.Concurrency is
+// greater than 1, chunks are loaded and processed by a bounded pool of
+// goroutines, so the order in which values are visited is not defined.
+func Walk(target types.Value, vr types.ValueReader, visitor Visitor, opts Options) {
+	w := &walker{vr: vr, visitor: visitor, opts: opts, visited: map[hash.Hash]bool{}}
+	if len(opts.Kinds) > 0 {
+		w.kinds = map[types.NomsKind]bool{}
+		for _, k := range opts.Kinds {
+			w.kinds[k] = true
+		}
+	}
+	if opts.Concurrency > 1 {
+		w.sem = make(chan struct{}, opts.Concurrency-1)
+	}
+
+	w.processVal(target, 0)
+	w.wg.Wait()
+}
+
+type walker struct {
+	vr      types.ValueReader
+	visitor Visitor
+	opts    Options
+	kinds   map[types.NomsKind]bool
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	stopped int32
+
+	mu      sync.Mutex
+	visited map[hash.Hash]bool
+}
+
+func (w *walker) isStopped() bool {
+	return atomic.LoadInt32(&w.stopped) != 0
+}
+
+func (w *walker) processVal(v types.Value, depth int) {
+	if w.isStopped() {
+		return
+	}
+
+	action := Continue
+	if w.kinds == nil || w.kinds[v.Type().Kind()] {
+		action = w.visitor.Visit(v, depth)
+	}
+	switch action {
+	case Stop:
+		atomic.StoreInt32(&w.stopped, 1)
+		return
+	case SkipChildren:
+		return
+	}
+
+	if r, ok := v.(types.Ref); ok {
+		w.processRef(r, depth+1)
+		return
+	}
+	v.WalkValues(func(c types.Value) {
+		w.processVal(c, depth)
+	})
+}
+
+func (w *walker) processRef(r types.Ref, depth int) {
+	if w.opts.MaxDepth > 0 && depth > w.opts.MaxDepth {
+		return
+	}
+
+	target := r.TargetHash()
+	w.mu.Lock()
+	seen := w.visited[target]
+	w.visited[target] = true
+	w.mu.Unlock()
+	if seen {
+		return
+	}
+
+	if w.sem != nil {
+		select {
+		case w.sem <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer func() {
+					<-w.sem
+					w.wg.Done()
+				}()
+				w.loadAndProcess(target, depth)
+			}()
+			return
+		default:
+			// All workers are busy, so do the work on this goroutine rather than queueing it.
+		}
+	}
+	w.loadAndProcess(target, depth)
+}
+
+func (w *walker) loadAndProcess(target hash.Hash, depth int) {
+	if w.isStopped() {
+		return
+	}
+	v := w.vr.ReadValue(target)
+	d.PanicIfTrue(v == nil, "Attempt to visit absent ref:%s", target.String())
+	w.processVal(v, depth)
+}
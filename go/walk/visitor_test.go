@@ -0,0 +1,104 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package walk
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+	"github.com/stormasm/noms/go/types"
+)
+
+// buildTree writes a tree of Lists |height| Refs deep in which every List has
+// |width| children, each ending in a distinct String leaf, and returns a Ref
+// to the root.
+func buildTree(vs *types.ValueStore, height, width int) types.Ref {
+	leaves := 0
+	var build func(height int) types.Ref
+	build = func(height int) types.Ref {
+		if height == 0 {
+			leaves++
+			return vs.WriteValue(types.String(fmt.Sprintf("leaf %d", leaves)))
+		}
+		children := make([]types.Value, width)
+		for i := range children {
+			children[i] = build(height - 1)
+		}
+		return vs.WriteValue(types.NewList(children...))
+	}
+	return build(height)
+}
+
+func countVisits(target types.Value, vs *types.ValueStore, opts Options, cb func(v types.Value, depth int) VisitAction) int {
+	mu := sync.Mutex{}
+	count := 0
+	Walk(target, vs, VisitorFunc(func(v types.Value, depth int) VisitAction {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		if cb != nil {
+			return cb(v, depth)
+		}
+		return Continue
+	}), opts)
+	return count
+}
+
+func TestWalkVisitorMatchesWalkValues(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	root := buildTree(vs, 3, 3)
+
+	expected := 0
+	WalkValues(root, vs, func(v types.Value) bool {
+		expected++
+		return false
+	})
+	assert.Equal(expected, countVisits(root, vs, Options{}, nil))
+	assert.Equal(expected, countVisits(root, vs, Options{Concurrency: 4}, nil))
+}
+
+func TestWalkVisitorSkipAndStop(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	root := buildTree(vs, 3, 3)
+
+	// Skipping the root's target means only the root Ref and its target are seen.
+	n := countVisits(root, vs, Options{}, func(v types.Value, depth int) VisitAction {
+		if depth == 1 {
+			return SkipChildren
+		}
+		return Continue
+	})
+	assert.Equal(2, n)
+
+	n = countVisits(root, vs, Options{}, func(v types.Value, depth int) VisitAction {
+		return Stop
+	})
+	assert.Equal(1, n)
+}
+
+func TestWalkVisitorMaxDepthAndKinds(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	root := buildTree(vs, 3, 2)
+
+	maxSeen := 0
+	countVisits(root, vs, Options{MaxDepth: 2}, func(v types.Value, depth int) VisitAction {
+		if depth > maxSeen {
+			maxSeen = depth
+		}
+		return Continue
+	})
+	assert.Equal(2, maxSeen)
+
+	strings := countVisits(root, vs, Options{Kinds: []types.NomsKind{types.StringKind}, Concurrency: 3}, func(v types.Value, depth int) VisitAction {
+		assert.Equal(types.StringKind, v.Type().Kind())
+		return Continue
+	})
+	assert.Equal(8, strings)
+}
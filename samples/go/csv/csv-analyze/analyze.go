@@ -12,8 +12,8 @@ import (
 
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/csv"
 	"github.com/stormasm/noms/go/util/profile"
-	"github.com/stormasm/noms/samples/go/csv"
 	flag "github.com/juju/gnuflag"
 )
 
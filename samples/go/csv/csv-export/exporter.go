@@ -13,9 +13,9 @@ import (
 	"github.com/stormasm/noms/go/d"
 	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/csv"
 	"github.com/stormasm/noms/go/util/profile"
 	"github.com/stormasm/noms/go/util/verbose"
-	"github.com/stormasm/noms/samples/go/csv"
 	flag "github.com/juju/gnuflag"
 )
 
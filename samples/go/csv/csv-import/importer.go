@@ -17,11 +17,11 @@ import (
 	"github.com/stormasm/noms/go/datas"
 	"github.com/stormasm/noms/go/spec"
 	"github.com/stormasm/noms/go/types"
+	"github.com/stormasm/noms/go/util/csv"
 	"github.com/stormasm/noms/go/util/profile"
 	"github.com/stormasm/noms/go/util/progressreader"
 	"github.com/stormasm/noms/go/util/status"
 	"github.com/stormasm/noms/go/util/verbose"
-	"github.com/stormasm/noms/samples/go/csv"
 	humanize "github.com/dustin/go-humanize"
 	flag "github.com/juju/gnuflag"
 )
@@ -14,7 +14,7 @@ import (
 
 	"github.com/stormasm/noms/go/perf/suite"
 	"github.com/stormasm/noms/go/types"
-	"github.com/stormasm/noms/samples/go/csv"
+	"github.com/stormasm/noms/go/util/csv"
 	"github.com/attic-labs/testify/assert"
 	humanize "github.com/dustin/go-humanize"
 )
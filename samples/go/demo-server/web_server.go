@@ -56,6 +56,12 @@ func setupWebServer(factory chunks.Factory) *httprouter.Router {
 
 	router.POST(constants.HasRefsPath, corsHandle(storeHandle(factory, datas.HandleHasRefs)))
 	router.OPTIONS(constants.HasRefsPath, corsHandle(noopHandle))
+	router.POST(constants.WantRefsPath, corsHandle(storeHandle(factory, datas.HandleWantRefs)))
+	router.OPTIONS(constants.WantRefsPath, corsHandle(noopHandle))
+	router.POST(constants.PullRefsPath, corsHandle(storeHandle(factory, datas.HandlePullRefs)))
+	router.OPTIONS(constants.PullRefsPath, corsHandle(noopHandle))
+	router.GET(constants.NotifyPath, corsHandle(storeHandle(factory, datas.HandleNotify)))
+	router.OPTIONS(constants.NotifyPath, corsHandle(noopHandle))
 
 	router.POST(constants.WriteValuePath, corsHandle(authorizeHandle(storeHandle(factory, datas.HandleWriteValue))))
 	router.OPTIONS(constants.WriteValuePath, corsHandle(noopHandle))
@@ -87,7 +87,7 @@ func nomsMerge() error {
 		resolve := func(aType, bType types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
 			return cliResolve(os.Stdin, os.Stdout, aType, bType, a, b, path)
 		}
-		merged, err := merge.ThreeWay(left, right, parent, db, resolve, pc)
+		merged, err := merge.ThreeWay(left, right, parent, db, merge.ResolveFunc(resolve), pc)
 		d.PanicIfError(err)
 
 		_, err = db.Commit(outDS, merged, datas.CommitOptions{